@@ -0,0 +1,212 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/cheggaaa/pb"
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// backfill args
+var chunkSize string // size of each chunk of the time range, such as 7d
+var retries int      // number of times to retry a failed chunk
+
+// backfillCmd represents the backfill command
+var backfillCmd = &cobra.Command{
+	Use:   "backfill [log type] [command] [args...]",
+	Short: "Run a long pull as a series of smaller chunks that can be resumed.",
+	Long: `Run a long pull as a series of smaller chunks that can be resumed. The time range is split into
+chunks which are pulled one after another, like 'nagini run', each into its own directory inside the
+output directory. A failed chunk is retried, and every finished chunk is recorded in a checkpoint,
+so running the same command again only pulls the chunks that are missing.
+
+Example:
+	nagini backfill -r 2021/03/01:00-2021/05/31:23 --chunk 7d -o ./q2 conn grepcidr 10.0.0.0/24
+`,
+	Args: cobra.MinimumNArgs(1), // log type, then the command to run unless --jq is set
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// parse params and args
+		rc, size, target, e := parseBackfillParams(args[0], args[1:])
+		if showSources {
+			printConfigSources(dataOut, append(flagSettings(cmd, sharedFlags...), flagSettings(cmd, append([]string{"chunk", "retries", "jq", "where"}, limitFlags...)...)...))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+
+		chunks := lib.SplitTimeRange(rc.StartTime, rc.EndTime, size)
+		if rc.NewestFirst {
+			for i, j := 0, len(chunks)-1; i < j; i, j = i+1, j-1 {
+				chunks[i], chunks[j] = chunks[j], chunks[i]
+			}
+		}
+		checkpoint := filepath.Join(rc.OutDir, lib.CheckpointFile)
+		done, e := lib.ReadCheckpoint(checkpoint)
+		if e != nil {
+			return e
+		}
+
+		// list params
+		printRunConfig(cmd, rc, target.label()+
+			lib.T("label.chunks", len(chunks), chunkSize, len(done)))
+
+		// prompt if continue
+		if !noConfirm && !lib.WaitForConfirm(cmd) {
+			// if start is no, do not continue
+			return nil
+		}
+
+		if e = os.MkdirAll(rc.OutDir, 0775); e != nil {
+			return e
+		}
+		// the checkpoint is shared by every backfill into the output directory, so only one
+		// may run at a time.
+		lock, e := lib.LockDir(rc.OutDir)
+		if e != nil {
+			return e
+		}
+		defer lock.Unlock()
+		report := &lib.RunReport{}
+		if target.notices, e = relatedNotices(cmd, rc, report); e != nil {
+			return e
+		}
+		if e = fetchLogs(cmd, &rc); e != nil {
+			return e
+		}
+
+		// pull each chunk in turn, so each one gets every thread. The record limit spans
+		// every chunk, so the backfill stops once it is reached, and so do batch filters.
+		limit := lib.NewRecordLimit(rc)
+		rc.Throttle = lib.NewThrottle(rc.Threads)
+		union, e := normalizedSchema(rc, report)
+		if e != nil {
+			return e
+		}
+		target = target.start()
+		var finished, skipped int
+		var failed []string
+		for i, chunk := range chunks {
+			if limit.Reached() {
+				break
+			}
+			name := chunk.Name()
+			if done[name] {
+				cmd.Print(lib.T("backfill.skip", i+1, len(chunks), name))
+				skipped++
+				continue
+			}
+
+			chunkStart := time.Now()
+			chunkRc := rc
+			chunkRc.StartTime, chunkRc.EndTime = chunk.Start, chunk.End
+			chunkRc.OutDir = filepath.Join(rc.OutDir, name)
+
+			var attempts int
+			var chunkReport *lib.RunReport
+			for attempts = 1; ; attempts++ {
+				// each attempt gets its own report, so corrupt logs only fail the chunk they
+				// are in, and are only listed once.
+				chunkReport = &lib.RunReport{}
+				chunkRc.Report = chunkReport
+
+				// output of an earlier attempt is incomplete, so start over.
+				e = os.RemoveAll(chunkRc.OutDir)
+				if e == nil {
+					e = lib.ParseLogs(dataOut, cmd.OutOrStderr(),
+						func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+							runCommand(target, limit, chunkReport, union, chunkRc.Throttle, logFile, outputFile, curTime, wgDate, taskBar)
+						},
+						debugLog, chunkRc)
+				}
+				if e == nil || attempts > retries {
+					break
+				}
+				cmd.Print(lib.T("backfill.retry", i+1, len(chunks), name, attempts, e))
+			}
+			report.Merge(chunkReport)
+			if e == nil {
+				e = lib.AppendCheckpoint(checkpoint, name)
+			}
+			if e != nil {
+				cmd.Print(lib.T("backfill.failed", i+1, len(chunks), name, attempts, e))
+				failed = append(failed, name)
+				continue
+			}
+
+			cmd.Print(lib.T("backfill.done", i+1, len(chunks), name, time.Since(chunkStart).Round(time.Second)))
+			finished++
+		}
+
+		target.stop(report)
+		cmd.Print(lib.T("backfill.report", finished, skipped, len(failed), rc.OutDir))
+		report.Write(cmd.OutOrStderr())
+		if len(failed) > 0 {
+			return errors.New(lib.T("error.backfill.failed", len(failed), strings.Join(failed, ", ")))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backfillCmd)
+	addLimitFlags(backfillCmd)
+	addFilterFlags(backfillCmd)
+
+	backfillCmd.Flags().StringVar(&chunkSize, "chunk", "7d", "size of each chunk of the time range, in hours, days or weeks. Such as 12h, 7d or 2w.")
+	backfillCmd.Flags().IntVar(&retries, "retries", 2, "number of times to retry a failed chunk before moving on.")
+}
+
+// takes args and params, does error checking, and then produces useful variables.
+// returns a *lib.ValidationError holding every problem found, if any.
+func parseBackfillParams(logTypeArg string, commandToRun []string) (rc lib.RuntimeConfig, size time.Duration, f filter, e error) {
+	var v lib.Validator
+	rc.StartTime, rc.EndTime = v.TimeRange(timeRange)
+	v.Threads(threads)
+	rc.Threads = threads
+	rc.LogDir = v.LogDir(logDir)
+	// a backfill is resumed into its own output directory, so it may hold finished chunks.
+	rc.OutDir = v.OutputDir(outputDir, false)
+	rc.LogType = logTypeArg
+	v.LogType(rc.LogType, rc.LogDir, rc.StartTime, rc.EndTime)
+	rc.SingleFile = singleFile
+	applyPullFlags(&v, &rc)
+	applyLimitFlags(&v, &rc)
+	if writeStdout {
+		v.Add(lib.T("error.backfill.stdout"))
+	}
+	if retries < 0 {
+		v.Add(lib.T("error.retries", retries))
+	}
+
+	size, sizeErr := lib.ParseChunkSize(chunkSize)
+	if sizeErr != nil {
+		v.AddErr(sizeErr)
+	}
+	f = newFilter(&v, rc.LogType, scriptCommand(&v, commandToRun), jqExpr, whereExpr)
+
+	// report every problem at once, before asking to continue.
+	return rc, size, f, v.Err()
+}
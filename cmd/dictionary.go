@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+var dictionarySize int // size in KB of the dictionary to train.
+
+// dictionaryCmd represents the dictionary command
+var dictionaryCmd = &cobra.Command{
+	Use:   "dictionary",
+	Short: "Train zstd dictionaries to compress the outputs of a log type with.",
+}
+
+var dictionaryTrainCmd = &cobra.Command{
+	Use:   "train [log type] [output directory or file]...",
+	Short: "Train a zstd dictionary for a log type from the outputs of past pulls.",
+	Long: `Train a zstd dictionary for a log type from the outputs of past pulls of it, given as output
+directories or files. Later pulls of the log type with --compress zstd compress each output with
+it, which shrinks small daily outputs much more than compressing each on its own. The dictionary
+is kept in dictionary_dir of the config file, and copied next to the outputs compressed with it,
+so they can be read with zstd -d -D once it is trained again. Use --no-dictionary to compress
+without it.
+
+Example:
+	nagini dictionary train dns ./output-20210601-120000 ./output-20210608-120000
+	nagini run --compress zstd dns jq 'select(.qtype_name == "TXT")'
+`,
+	Args: cobra.MinimumNArgs(2), // 2+ arguments: log type, then the outputs to train from.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var v lib.Validator
+		if _, e := exec.LookPath("zstd"); e != nil {
+			v.Add(lib.T("error.compress.zstd"))
+		}
+		if dictionaryDir == "" {
+			v.Add(lib.T("error.dictionary.dir"))
+		}
+		if dictionarySize <= 0 {
+			v.Add(lib.T("error.dictionary.size", dictionarySize))
+		}
+		if e := v.Err(); e != nil {
+			return e
+		}
+
+		dst := lib.DictionaryPath(dictionaryDir, args[0])
+		samples, e := lib.TrainDictionary(args[0], args[1:], dst, dictionarySize<<10)
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("dictionary.trained", dst, samples))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dictionaryCmd)
+	dictionaryCmd.AddCommand(dictionaryTrainCmd)
+
+	dictionaryTrainCmd.Flags().IntVar(&dictionarySize, "size", lib.DefaultDictionarySize>>10, "size in KB of the dictionary. Smaller outputs gain more from a larger one, up to about a hundredth of what it is trained from.")
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// example is a single curated invocation, with a description of what it does.
+// Invocation is a template that is filled in with site configuration.
+type example struct {
+	Description string
+	Invocation  string
+}
+
+// curated examples for each command, keyed by command name.
+var examples = map[string][]example{
+	"run": {
+		{
+			Description: "Pull the last 24 hours of rdp logs that involve a subnet, using grepcidr as the filter.",
+			Invocation:  "nagini run -t {{ .Threads }} rdp grepcidr 10.0.0.0/24",
+		},
+		{
+			Description: "Pull a specific range of dns logs. Time ranges are local time, hour granularity, and inclusive on both ends: YYYY/MM/DD:HH-YYYY/MM/DD:HH.",
+			Invocation:  "nagini run -r {{ .Yesterday }}:00-{{ .Today }}:23 dns grep -F evil.example.com",
+		},
+		{
+			Description: "Pull conn logs from a non-default archive and concatenate everything into a single conn.json in the output directory.",
+			Invocation:  "nagini run -i {{ .LogDir }} -o ./conn-pull -c conn grep -F 192.0.2.10",
+		},
+		{
+			Description: "Skip the confirmation prompt and stream the results to stdout for further processing.",
+			Invocation:  "nagini run -N -S http grep -F /wp-login.php | wc -l",
+		},
+	},
+	"parallel": {
+		{
+			Description: "Run a legacy parallel.py style script over the last 24 hours of rdp logs. The script is called as: my_script.py [input file] [output file]",
+			Invocation:  "nagini parallel -t {{ .Threads }} rdp ./my_script.py",
+		},
+	},
+	"sql": {
+		{
+			Description: "Count yesterday's lookups of .ru domains by each client, busiest first, without writing an output directory.",
+			Invocation:  "nagini sql -r {{ .Yesterday }}:00-{{ .Yesterday }}:23 \"SELECT id_orig_h, count(*) FROM dns WHERE query LIKE '%.ru' GROUP BY 1 ORDER BY 2 DESC\"",
+		},
+	},
+	"profile": {
+		{
+			Description: "Describe the fields of the last two days of dns logs, to see which are worth filtering on before a big pull.",
+			Invocation:  "nagini profile -r {{ .Yesterday }}:00-{{ .Today }}:23 dns",
+		},
+	},
+	"preset": {
+		{
+			Description: "Pull the last two days of SMB, DCE-RPC, Kerberos, NTLM and RDP activity of a host, to scope lateral movement.",
+			Invocation:  "nagini preset -r {{ .Yesterday }}:00-{{ .Today }}:23 lateral-movement --var host=10.1.2.3",
+		},
+	},
+	"fingerprints": {
+		{
+			Description: "Count how often each JA3 or JA4 fingerprint of a list of known bad clients shows up in the last two days of ssl logs.",
+			Invocation:  "nagini fingerprints -r {{ .Yesterday }}:00-{{ .Today }}:23 --targets bad-fingerprints.txt",
+		},
+	},
+	"filehashes": {
+		{
+			Description: "Pull the last two days of files log records matching a list of known bad hashes, and retrieve each matching file with the file_extract_command of the config file.",
+			Invocation:  "nagini filehashes -r {{ .Yesterday }}:00-{{ .Today }}:23 --targets bad-hashes.txt --extract",
+		},
+	},
+	"sessions": {
+		{
+			Description: "Group yesterday's conn, http and dns records of each connection into one JSON object per session, ready to load without joining on uid.",
+			Invocation:  "nagini sessions -r {{ .Yesterday }}:00-{{ .Yesterday }}:23 http dns",
+		},
+	},
+	"k8s": {
+		{
+			Description: "Generate a Kubernetes CronJob that runs a playbook every morning on a cluster next to the log store, reading logs from one PersistentVolumeClaim and writing outputs to another.",
+			Invocation:  "nagini k8s generate --playbook daily.yaml --log-claim zeek-logs --output-claim hunts --schedule \"0 6 * * *\" cronjob.yaml",
+		},
+	},
+	"emit-shipper-config": {
+		{
+			Description: "Generate a Vector config that forwards every record pulled into the output directories under /hunts to Elasticsearch, tagged with the output it came from.",
+			Invocation:  "nagini emit-shipper-config vector --dir /hunts --sink elasticsearch --endpoint http://es:9200 vector.toml",
+		},
+	},
+	"man": {
+		{
+			Description: "Install man pages for every command.",
+			Invocation:  "nagini man /usr/local/share/man/man1",
+		},
+	},
+}
+
+// examplesCmd represents the examples command
+var examplesCmd = &cobra.Command{
+	Use:   "examples [command]",
+	Short: "Print runnable example invocations.",
+	Long: `Print curated, runnable example invocations, filled in with this site's configuration.
+If no command is given, examples for every command are printed.
+
+Example:
+	nagini examples run
+`,
+	Args: cobra.MaximumNArgs(1), // 1 optional argument: command to show examples for
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var names []string
+		if len(args) == 1 {
+			if _, ok := examples[args[0]]; !ok {
+				return fmt.Errorf("no examples for command '%s'", args[0])
+			}
+			names = append(names, args[0])
+		} else {
+			for name := range examples {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		// values substituted into the example templates, based on the site config.
+		values := struct {
+			LogDir    string
+			Threads   string
+			Yesterday string
+			Today     string
+		}{
+			LogDir:    rootCmd.PersistentFlags().Lookup("logdir").DefValue,
+			Threads:   rootCmd.PersistentFlags().Lookup("threads").DefValue,
+			Yesterday: time.Now().AddDate(0, 0, -1).Format(lib.TimeFormatDate),
+			Today:     time.Now().Format(lib.TimeFormatDate),
+		}
+
+		// examples go to stdout so they can be copied or piped.
+		for _, name := range names {
+			fmt.Fprintf(dataOut, "%s:\n", name)
+			for _, ex := range examples[name] {
+				var invocation strings.Builder
+				e := template.Must(template.New(name).Parse(ex.Invocation)).Execute(&invocation, values)
+				if e != nil {
+					return e
+				}
+				fmt.Fprintf(dataOut, "\t# %s\n\t%s\n\n", ex.Description, invocation.String())
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(examplesCmd)
+}
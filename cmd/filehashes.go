@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// filehashes args
+var hashFile string   // file listing hashes to look for, one per line.
+var extractFiles bool // retrieve the files matching a hash with file_extract_command.
+
+// command retrieving a carved file, from the global config, set in root.
+var fileExtractCommand []string
+
+// directory of the output directory that retrieved files are written into.
+const extractedDir = "extracted"
+
+// filehashesCmd represents the filehashes command
+var filehashesCmd = &cobra.Command{
+	Use:   "filehashes [hash...]",
+	Short: "Pull the records of files logs matching a list of hashes.",
+	Long: `Pull the records of files logs whose MD5, SHA1 or SHA256 hash is one of the given hashes, over
+the time range. Hashes are given as args, or listed in a --targets file, one per line, and matched
+regardless of case. Runs like run with a built-in jq filter.
+
+With --extract, each matching file is then retrieved into the extracted directory of the output,
+by running the file_extract_command of the config file once per file. Its args are Go templates
+given the fuid, md5, sha1, sha256 and extracted fields of the file and the dir to write it into:
+	file_extract_command: [scp, "sensor:/opt/zeek/extract_files/{{ .extracted }}", "{{ .dir }}"]
+
+Example:
+	nagini filehashes -r 2021/06/01:00-2021/06/07:23 --targets bad-hashes.txt --extract
+`,
+	Args: cobra.ArbitraryArgs, // hashes to look for, along with those of --targets.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rc, target, action, e := parseFileHashParams(args)
+		if showSources {
+			printConfigSources(dataOut, fileHashSettings(cmd))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+		return runPull(cmd, args, rc, target, action, fileHashSettings(cmd))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(filehashesCmd)
+	addLimitFlags(filehashesCmd)
+	addRenderFlags(filehashesCmd)
+	addTaskManifestFlags(filehashesCmd)
+	filehashesCmd.Flags().StringVar(&hashFile, "targets", "", "file listing the hashes to look for, one per line. Blank lines and lines starting with # are skipped.")
+	filehashesCmd.Flags().BoolVar(&extractFiles, "extract", false, "retrieve each matching file into the extracted directory of the output, with the file_extract_command of the config file.")
+}
+
+// returns the effective settings of every flag of filehashes.
+func fileHashSettings(cmd *cobra.Command) []setting {
+	return flagSettings(cmd, append(append(append(append(sharedFlags, limitFlags...), renderFlags...), taskManifestFlags...), "targets", "extract")...)
+}
+
+// takes the hashes and params, does error checking, and then produces useful variables: the
+// filter matching the hashes, keeping the files to retrieve if --extract is set, and the line
+// describing it. Returns a *lib.ValidationError holding every problem found, if any.
+func parseFileHashParams(args []string) (rc lib.RuntimeConfig, f filter, action string, e error) {
+	var v lib.Validator
+	rc = lib.GenRuntimeConfig(&v, timeRange, logDir, outputDir, "files", threads, singleFile, writeStdout)
+	applyPullFlags(&v, &rc)
+	applyLimitFlags(&v, &rc)
+	applyRenderFlags(&v, writeStdout)
+	applyTaskManifestFlags(&v, &rc)
+
+	hashes := append([]string{}, args...)
+	if hashFile != "" {
+		listed, e := lib.ReadTargets(hashFile)
+		if e != nil {
+			v.AddErr(e)
+		}
+		hashes = append(hashes, listed...)
+	}
+	if len(hashes) == 0 && !v.Failed() {
+		v.Add(lib.T("error.hashes"))
+	}
+	f = newFilter(&v, rc.LogType, nil, lib.FileHashJQ(hashes), "")
+	action = lib.T("label.hashes", len(hashes))
+	if extractFiles {
+		if writeStdout {
+			v.Add(lib.T("error.extract.stdout"))
+		}
+		if len(fileExtractCommand) == 0 {
+			v.Add(lib.T("error.extract.command"))
+		}
+		f.hits = lib.NewUniqueValues(lib.FileHitFields)
+		action += lib.T("label.extract", filepath.Join(rc.OutDir, extractedDir))
+	}
+
+	// report every problem at once, before asking to continue.
+	return rc, f, action, v.Err()
+}
+
+// retrieves the files kept by f over a pull with rc into the extracted directory of its
+// output, and notes how many were.
+func retrieveFiles(cmd *cobra.Command, f filter, rc lib.RuntimeConfig) error {
+	rows, _ := f.hits.Rows()
+	dir := filepath.Join(rc.OutDir, extractedDir)
+	retrieved, e := lib.RetrieveFiles(fileExtractCommand, rows, dir, cmd.OutOrStderr())
+	if e != nil {
+		return e
+	}
+	cmd.Print(lib.T("filehashes.retrieved", retrieved, len(rows), dir))
+	return nil
+}
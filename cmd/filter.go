@@ -0,0 +1,251 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// jq expression to run over every record in-process, instead of a command.
+var jqExpr string
+
+// condition records must match to be kept, evaluated in-process, instead of a command.
+var whereExpr string
+
+// script to run as the command, with the command args as its args, or - to read it from stdin.
+var filterScript string
+
+// whether to run the script with --self-test before the pull, so a broken one fails once.
+var selfTest bool
+
+// inline scripts written to temp files to run, removed once the command is done.
+var inlineScripts []string
+
+// adds the flags that choose the filter of a pull, other than the command args, to the given
+// command. Playbooks set these per data source instead.
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&jqExpr, "jq", "", "run this jq expression over every record in-process, instead of a command, such as 'select(.query | test(\"evil\"))'. TSV records are given to it as objects of their fields.")
+	cmd.Flags().StringVar(&whereExpr, "where", "", "keep only the records matching this condition, evaluated in-process, instead of a command, such as 'id.resp_p == 3389 && id.orig_h in 10.0.0.0/8'. Takes the conditions of sql, with ==, &&, || and ! too, and subnets to match addresses against with in.")
+	cmd.Flags().StringVar(&filterScript, "script", "", "script to run on every log, with the command args as its args. - reads a small inline script from stdin, starting with a #! line, which requires --noconfirm.")
+	cmd.Flags().BoolVar(&selfTest, "self-test", false, "before the pull, run the command once with --self-test and no input, and stop if it fails.")
+}
+
+// returns the command to run: --script, with command as its args, if set, otherwise command.
+// With --script -, the script is read from stdin, once, and written to a temp file to run.
+// Records a problem in v if it cannot be.
+func scriptCommand(v *lib.Validator, command []string) []string {
+	if filterScript == "" {
+		return command
+	}
+	path := filterScript
+	if filterScript == "-" {
+		// stdin holds the script, so there is nothing left to confirm with.
+		if !noConfirm {
+			v.Add(lib.T("error.script.confirm"))
+			return command
+		}
+		script, e := ioutil.ReadAll(rootCmd.InOrStdin())
+		if e != nil {
+			v.AddErr(e)
+			return command
+		}
+		if path = inlineScript(v, script); path == "" {
+			return command
+		}
+	}
+	return append([]string{path}, command...)
+}
+
+// writes the inline script to a temp file, removed by removeInlineScripts, and returns its
+// path. Records a problem in v if it cannot be.
+func inlineScript(v *lib.Validator, script []byte) string {
+	path, e := lib.WriteScript(script)
+	if e != nil {
+		v.AddErr(e)
+		return ""
+	}
+	inlineScripts = append(inlineScripts, path)
+	return path
+}
+
+// removes the temp files of the inline scripts run.
+func removeInlineScripts() {
+	for _, path := range inlineScripts {
+		os.Remove(path)
+	}
+	inlineScripts = nil
+}
+
+// filter is what every log of a pull is run through: a command started for each log, a pool
+// of long-lived filters running it with --batch, or a jq expression or condition run in-process.
+type filter struct {
+	path  string
+	args  []string
+	pool  *lib.FilterPool  // set with --batch, to feed logs to rather than starting path.
+	jq    *lib.JQFilter    // set with --jq, instead of a command.
+	where *lib.WhereFilter // set with --where, instead of a command.
+	ip    *lib.IPFilter    // set by filter-ip, instead of a command.
+	site  *lib.SiteFilter  // set from the site filters of the log type, unless --no-site-filters, to drop records before the filter.
+
+	unique      *lib.UniqueValues // set with --unique, to count the values of fields of records rather than write them.
+	uniqueFile  string            // file of the output directory to write the counts of unique to.
+	summary     *lib.ConnSummary  // set with --conn-summary, to roll up conn records into flows.
+	summaryOnly bool              // set to roll up the records instead of writing them.
+	hits        *lib.UniqueValues // set to keep the values of fields of the records written, such as files to retrieve.
+	notices     *lib.NoticeIndex  // set with --correlate-notices, to annotate records with.
+}
+
+// returns the filter of a pull of logType from the where condition if set, or the jq
+// expression if set, otherwise from the command and its args, behind the site filters of
+// logType. Records a problem in the validator if none or several are given, or if they are
+// invalid.
+func newFilter(v *lib.Validator, logType string, command []string, jqExpr string, where string) (f filter) {
+	f.site = siteFilter(v, logType)
+	if where != "" {
+		if len(command) > 0 || jqExpr != "" {
+			v.Add(lib.T("error.where.command"))
+		}
+		condition, e := lib.NewWhereFilter(where)
+		if e != nil {
+			v.AddErr(e)
+		}
+		f.where = condition
+		return f
+	}
+	if jqExpr != "" {
+		if len(command) > 0 {
+			v.Add(lib.T("error.jq.command"))
+		}
+		jq, e := lib.NewJQFilter(jqExpr)
+		if e != nil {
+			v.AddErr(e)
+		}
+		f.jq = jq
+		return f
+	}
+	if len(command) == 0 {
+		v.Add(lib.T("error.nocommand"))
+		return f
+	}
+	f.path = resolveCommand(v, command[0])
+	f.args = command[1:]
+	checkCommand(v, f.path)
+	return f
+}
+
+// records a problem in the validator for whatever would fail every run of the command at path,
+// rather than each of its tasks: an interpreter or a required command of a script that is
+// missing, or with --self-test, a failed self-test.
+func checkCommand(v *lib.Validator, path string) {
+	if path == "" {
+		return
+	}
+	problems := lib.CheckScript(path)
+	for _, problem := range problems {
+		v.AddErr(problem)
+	}
+	if selfTest && len(problems) == 0 {
+		if e := lib.SelfTestScript(path); e != nil {
+			v.AddErr(e)
+		}
+	}
+}
+
+// returns the site filters of logType, unless --no-site-filters is set, or nil if it has none.
+// Records a problem in the validator if they are invalid.
+func siteFilter(v *lib.Validator, logType string) *lib.SiteFilter {
+	conditions := siteFilters[logType]
+	if len(conditions) == 0 || noSiteFilters {
+		return nil
+	}
+	site, e := lib.NewSiteFilter(conditions)
+	if e != nil {
+		v.AddErr(e)
+	}
+	return site
+}
+
+// starts the pool of the filter if --batch is set, so logs are fed to long-lived filters.
+// Must be followed by stop once the pull is done.
+func (f filter) start() filter {
+	if batch && f.jq == nil && f.ip == nil && f.where == nil {
+		f.pool = lib.NewFilterPool(f.path, f.args, batchDelimiter)
+	}
+	return f
+}
+
+// stops the filters of the pool, if any, once the pull is done, recording what they used in report.
+func (f filter) stop(report *lib.RunReport) {
+	if f.pool == nil {
+		return
+	}
+	for _, usage := range f.pool.Close() {
+		report.AddUsage(usage)
+	}
+}
+
+// describes the filter, such as the command and its args.
+func (f filter) String() string {
+	if f.jq != nil {
+		return "jq " + f.jq.String()
+	}
+	if f.ip != nil {
+		return "filter-ip " + f.ip.String()
+	}
+	if f.where != nil {
+		return "where " + f.where.String()
+	}
+	return strings.TrimSpace(f.path + " " + strings.Join(f.args, " "))
+}
+
+// returns the lines describing the filter before asking to continue.
+func (f filter) label() (label string) {
+	if f.jq != nil {
+		label = lib.T("label.jq", f.jq.String())
+	} else if f.where != nil {
+		label = lib.T("label.where", f.where.String())
+	} else if f.ip != nil {
+		label = lib.T("label.ipfilter", f.ip.String())
+		if fields := f.ip.Fields(); len(fields) > 0 {
+			label += lib.T("label.ipfields", strings.Join(fields, ", "))
+		}
+	} else {
+		label = lib.T("label.command", f.path, strings.Join(f.args, " "))
+	}
+	if f.site != nil {
+		label += lib.T("label.sitefilter", f.site.String())
+	}
+	if f.unique != nil && f.unique.Top > 0 {
+		label += lib.T("label.top", f.unique.Top, strings.Join(f.unique.Fields, ", "))
+	} else if f.unique != nil {
+		label += lib.T("label.unique", strings.Join(f.unique.Fields, ", "))
+	}
+	if f.unique != nil && len(f.unique.HashFields) > 0 {
+		label += lib.T("label.hash", strings.Join(f.unique.HashFields, ", "))
+	}
+	if f.summary != nil && f.summaryOnly {
+		label += lib.T("label.connsummary", lib.ConnSummaryOnly)
+	} else if f.summary != nil {
+		label += lib.T("label.connsummary", lib.ConnSummaryAlongside)
+	}
+	return label
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// filter-ip args
+var subnetFile string // file listing subnets to look for, one per line.
+var ipFields []string // address fields to match on, rather than every one.
+
+// filterIPCmd represents the filter-ip command
+var filterIPCmd = &cobra.Command{
+	Use:   "filter-ip [log type] [cidr...]",
+	Short: "Pull the records of a log type with an address in a list of subnets.",
+	Long: `Pull the records of a log type with an address in one of the given subnets, over the time
+range, filtering in-process rather than with an external tool such as grepcidr. Subnets are given
+as CIDRs, such as 10.0.0.0/24 or 2001:db8::/32, or as addresses, after the log type, or listed in
+a --targets file, one per line. Runs like run with a built-in filter.
+
+Both TSV and JSON logs are read. Every field holding addresses is matched on, such as id.orig_h
+and id.resp_h of conn logs, the tx_hosts of files logs or the src and dst of notice logs: in TSV
+logs, the columns whose #types are addr, set[addr] or vector[addr]. With --fields, only the given
+fields are, such as id.orig_h to match on the source of connections only.
+
+Example:
+	nagini filter-ip -r 2021/06/01:00-2021/06/07:23 conn 10.0.0.0/24 192.168.1.5
+	nagini filter-ip --fields id.resp_h dns 198.51.100.0/24
+	nagini filter-ip --targets scanners.txt ssh
+`,
+	Args: cobra.MinimumNArgs(1), // 1 argument: log type, then the subnets along with those of --targets.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rc, target, action, e := parseFilterIPParams(args[0], args[1:])
+		if showSources {
+			printConfigSources(dataOut, filterIPSettings(cmd))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+		return runPull(cmd, args, rc, target, action, filterIPSettings(cmd))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(filterIPCmd)
+	addLimitFlags(filterIPCmd)
+	addRenderFlags(filterIPCmd)
+	addTaskManifestFlags(filterIPCmd)
+	filterIPCmd.Flags().StringVar(&subnetFile, "targets", "", "file listing the subnets to look for, one per line. Blank lines and lines starting with # are skipped.")
+	filterIPCmd.Flags().StringSliceVar(&ipFields, "fields", nil, "comma separated address fields to match on, such as id.orig_h, rather than every field holding addresses.")
+}
+
+// returns the effective settings of every flag of filter-ip.
+func filterIPSettings(cmd *cobra.Command) []setting {
+	return flagSettings(cmd, append(append(append(append(sharedFlags, limitFlags...), renderFlags...), taskManifestFlags...), "targets", "fields")...)
+}
+
+// takes the log type, subnets and params, does error checking, and then produces useful
+// variables: the filter keeping the records in the subnets, and the lines describing it, with
+// the address fields of the log type if it is known. Returns a *lib.ValidationError holding
+// every problem found, if any.
+func parseFilterIPParams(logTypeArg string, args []string) (rc lib.RuntimeConfig, f filter, action string, e error) {
+	var v lib.Validator
+	rc = lib.GenRuntimeConfig(&v, timeRange, logDir, outputDir, logTypeArg, threads, singleFile, writeStdout)
+	applyPullFlags(&v, &rc)
+	applyLimitFlags(&v, &rc)
+	applyRenderFlags(&v, writeStdout)
+	applyTaskManifestFlags(&v, &rc)
+
+	subnets := append([]string{}, args...)
+	if subnetFile != "" {
+		listed, e := lib.ReadTargets(subnetFile)
+		if e != nil {
+			v.AddErr(e)
+		}
+		subnets = append(subnets, listed...)
+	}
+	if len(subnets) == 0 && !v.Failed() {
+		v.Add(lib.T("error.cidr.none"))
+	}
+	v.Fields(rc.LogType, ipFields, logTypes)
+	f.site = siteFilter(&v, rc.LogType)
+	if f.ip, e = lib.NewIPFilter(subnets, ipFields); e != nil {
+		v.AddErr(e)
+	}
+	action = f.label()
+	if fields := lib.AddressFields(rc.LogType, logTypes); len(ipFields) == 0 && len(fields) > 0 {
+		action += lib.T("label.ipfields", strings.Join(fields, ", "))
+	}
+
+	// report every problem at once, before asking to continue.
+	return rc, f, action, v.Err()
+}
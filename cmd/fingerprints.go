@@ -0,0 +1,101 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// fingerprints args
+var fingerprintFile string    // file listing fingerprints to look for, one per line.
+var fingerprintLogType string // log type holding the fingerprints, ssl or quic.
+
+// fingerprintsCmd represents the fingerprints command
+var fingerprintsCmd = &cobra.Command{
+	Use:   "fingerprints [fingerprint...]",
+	Short: "Count the TLS fingerprints of ssl or quic logs that match a list.",
+	Long: `Count how often each of the given TLS fingerprints (ja3, ja3s, ja4 or ja4s, where the zeek
+packages logging them are loaded) shows up in ssl logs, or quic logs with --log-type quic, over
+the time range. Fingerprints are given as args, or listed in a --targets file, one per line, and
+matched regardless of case. Runs like run with a built-in jq filter, writing the count of each
+matching fingerprint to fingerprints.tsv in the output directory, or to stdout with --stdout.
+
+Example:
+	nagini fingerprints -r 2021/06/01:00-2021/06/07:23 --targets bad-ja3.txt
+	nagini fingerprints --log-type quic -S t13d1516h2_8daaf6152771_02713d6af862
+`,
+	Args: cobra.ArbitraryArgs, // fingerprints to look for, along with those of --targets.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rc, target, action, e := parseFingerprintParams(args)
+		if showSources {
+			printConfigSources(dataOut, fingerprintSettings(cmd))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+		return runPull(cmd, args, rc, target, action, fingerprintSettings(cmd))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fingerprintsCmd)
+	addLimitFlags(fingerprintsCmd)
+	addRenderFlags(fingerprintsCmd)
+	addTaskManifestFlags(fingerprintsCmd)
+	fingerprintsCmd.Flags().StringVar(&fingerprintFile, "targets", "", "file listing the fingerprints to look for, one per line. Blank lines and lines starting with # are skipped.")
+	fingerprintsCmd.Flags().StringVar(&fingerprintLogType, "log-type", "ssl", "log type holding the fingerprints, such as ssl or quic.")
+}
+
+// returns the effective settings of every flag of fingerprints.
+func fingerprintSettings(cmd *cobra.Command) []setting {
+	return flagSettings(cmd, append(append(append(append(sharedFlags, limitFlags...), renderFlags...), taskManifestFlags...), "targets", "log-type")...)
+}
+
+// takes the fingerprints and params, does error checking, and then produces useful variables:
+// the filter matching the fingerprints, counting them, and the line describing it. Returns a
+// *lib.ValidationError holding every problem found, if any.
+func parseFingerprintParams(args []string) (rc lib.RuntimeConfig, f filter, action string, e error) {
+	var v lib.Validator
+	rc = lib.GenRuntimeConfig(&v, timeRange, logDir, outputDir, fingerprintLogType, threads, singleFile, writeStdout)
+	applyPullFlags(&v, &rc)
+	applyLimitFlags(&v, &rc)
+	applyRenderFlags(&v, writeStdout)
+	applyTaskManifestFlags(&v, &rc)
+
+	fingerprints := append([]string{}, args...)
+	if fingerprintFile != "" {
+		listed, e := lib.ReadTargets(fingerprintFile)
+		if e != nil {
+			v.AddErr(e)
+		}
+		fingerprints = append(fingerprints, listed...)
+	}
+	if len(fingerprints) == 0 && !v.Failed() {
+		v.Add(lib.T("error.fingerprints"))
+	}
+	f = newFilter(&v, rc.LogType, nil, lib.FingerprintJQ(fingerprints), "")
+	f.unique = lib.NewUniqueValues([]string{lib.FingerprintTypeField, lib.FingerprintField})
+	f.uniqueFile = "fingerprints.tsv"
+	action = lib.T("label.fingerprints", len(fingerprints), strings.Join(lib.FingerprintFields, ", "))
+
+	// report every problem at once, before asking to continue.
+	return rc, f, action, v.Err()
+}
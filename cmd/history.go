@@ -0,0 +1,92 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// history file of past pulls from the global config, set in root. Empty to keep no history.
+var historyFile string
+
+// describes what a pull through f does to its logs, so pulls that do the same are estimated
+// from each other.
+func historyFilter(f filter) string {
+	if f.unique != nil && len(f.unique.HashFields) > 0 {
+		return f.String() + " | unique " + strings.Join(f.unique.Fields, ",") + " | hash " + strings.Join(f.unique.HashFields, ",")
+	} else if f.unique != nil {
+		return f.String() + " | unique " + strings.Join(f.unique.Fields, ",")
+	}
+	return f.String()
+}
+
+// returns the line estimating how long a pull with rc through f takes and how much it writes,
+// from the history of past pulls, or nothing if there are none to go by. Logs on another
+// host, or in tar containers, are not sized until fetched, so are not estimated.
+func estimateLabel(rc lib.RuntimeConfig, f filter) string {
+	if historyFile == "" || lib.IsRemoteLogDir(rc.LogDir) {
+		return ""
+	}
+	logFiles, e := lib.PullLogs(rc)
+	if e != nil || len(logFiles) == 0 {
+		return ""
+	}
+	history, e := lib.ReadHistory(os.ExpandEnv(historyFile))
+	if e != nil {
+		return ""
+	}
+	estimate, ok := lib.EstimateRun(history, rc.LogType, historyFilter(f), lib.FilesSize(logFiles))
+	if !ok {
+		return ""
+	}
+	return estimate.Label()
+}
+
+// records a finished pull with rc through f, started at started, in the history file, warning
+// if it cannot be written.
+func recordHistory(cmd *cobra.Command, rc lib.RuntimeConfig, f filter, started time.Time) {
+	if historyFile == "" {
+		return
+	}
+	// the logs skipped were already reported by the pull.
+	rc.Report = nil
+	logFiles, e := lib.PullLogs(rc)
+	if e != nil || len(logFiles) == 0 {
+		return
+	}
+	entry := lib.HistoryEntry{
+		Time:       time.Now(),
+		LogType:    rc.LogType,
+		Filter:     historyFilter(f),
+		Threads:    rc.Threads,
+		InputBytes: lib.FilesSize(logFiles),
+		Stdout:     rc.WriteStdout,
+		Seconds:    time.Since(started).Seconds(),
+	}
+	if !rc.WriteStdout {
+		entry.OutputBytes = lib.DirSize(rc.OutDir)
+	}
+	path := os.ExpandEnv(historyFile)
+	if e = lib.AppendHistory(path, entry); e != nil {
+		cmd.Print(lib.T("warn.history", path, e))
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+var initSystem bool // if set, writes the system config rather than the user config.
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively create a nagini config file.",
+	Long: `Interactively create a nagini config file. Detects the Zeek log directory, proposes a
+thread count, writes the config, and runs a tiny validation pull against the archive.
+
+By default the user config (~/.config/nagini/config.yaml) is written. Use --system to
+write /etc/nagini/config.yaml instead.
+
+Example:
+	nagini init
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// pick the zeek log directory, offering any we can find.
+		chosenLogDir := ""
+		detected := lib.DetectZeekLogDirs()
+		if len(detected) > 0 {
+			choice := lib.PromptChoice(cmd, lib.T("init.logdir"), append(detected, lib.T("init.logdir.other")), 0)
+			if choice < len(detected) {
+				chosenLogDir = detected[choice]
+			}
+		} else {
+			cmd.Println(lib.T("init.logdir.none"))
+		}
+		if chosenLogDir == "" {
+			chosenLogDir = lib.PromptString(cmd, lib.T("init.logdir.enter"), logDir)
+		}
+
+		// propose a thread count based on the CPUs available.
+		chosenThreads := 0
+		for chosenThreads <= 0 {
+			answer := lib.PromptString(cmd, lib.T("init.threads", runtime.NumCPU()), strconv.Itoa(runtime.NumCPU()))
+			chosenThreads, _ = strconv.Atoi(answer)
+			if chosenThreads <= 0 {
+				cmd.PrintErr(lib.T("error.number", answer))
+			}
+		}
+
+		// write the config, making sure not to clobber an existing one by accident.
+		configPath := os.ExpandEnv(lib.UserConfigPath)
+		if initSystem {
+			configPath = lib.SystemConfigPath
+		}
+		if _, e := os.Stat(configPath); e == nil && !noConfirm {
+			if lib.PromptChoice(cmd, lib.T("init.overwrite", configPath), []string{lib.T("confirm.yes"), lib.T("confirm.no")}, 1) != 0 {
+				return nil
+			}
+		}
+		globalConfig := lib.DefaultGlobalConfig()
+		globalConfig.ZeekLogDir = chosenLogDir
+		globalConfig.DefaultThreadCount = chosenThreads
+		e := lib.WriteGlobalConfig(configPath, globalConfig)
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("init.written", configPath))
+
+		// make sure the archive can actually be read.
+		cmd.Print(lib.T("init.validating", "conn", chosenLogDir))
+		logFile, records, e := lib.ValidationPull(chosenLogDir, "conn", 10)
+		if e != nil {
+			cmd.PrintErr(lib.T("init.novalidation", e))
+			return nil
+		}
+		cmd.Print(lib.T("init.validated", records, logFile))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().BoolVar(&initSystem, "system", false, "write the system config (/etc/nagini/config.yaml) instead of the user config.")
+}
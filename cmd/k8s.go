@@ -0,0 +1,155 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// k8s generate args
+var k8sPlaybook string    // playbook to run in the job.
+var k8sImage string       // nagini image to run.
+var k8sSchedule string    // cron schedule, to generate a CronJob rather than a Job.
+var k8sLogClaim string    // PersistentVolumeClaim holding the zeek logs.
+var k8sOutputClaim string // PersistentVolumeClaim to write outputs to.
+var k8sNamespace string   // namespace of the manifest.
+var k8sName string        // name of the job, rather than one from the playbook file name.
+
+// k8sCmd represents the k8s command
+var k8sCmd = &cobra.Command{
+	Use:   "k8s",
+	Short: "Generate Kubernetes manifests that run pulls on a cluster.",
+}
+
+var k8sGenerateCmd = &cobra.Command{
+	Use:   "generate [manifest YAML]",
+	Short: "Generate a Kubernetes Job, or CronJob, that runs a playbook.",
+	Long: `Generate a Kubernetes Job that runs a playbook once, or with --schedule a CronJob that runs it
+on a schedule, for batch pulls on a cluster next to the log store. The manifest is written to the
+given file, or to stdout.
+
+The playbook is filled in with its variables and stored in a ConfigMap next to the job. The logs
+are mounted read-only from --log-claim, and outputs written to --output-claim, or to a scratch
+volume without one. Each thread of the playbook gets a cpu and 256Mi of memory, and may use up
+to twice that.
+
+Example:
+	nagini k8s generate --playbook hunt.yaml --log-claim zeek-logs --output-claim hunts job.yaml
+	nagini k8s generate --playbook daily.yaml --log-claim zeek-logs --output-claim hunts --schedule "0 6 * * *" cronjob.yaml
+	kubectl apply -f job.yaml
+`,
+	Args: cobra.MaximumNArgs(1), // 1 argument: file to write the manifest to, or none for stdout.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, e := parseK8sParams()
+		if e != nil {
+			return e
+		}
+
+		var out io.Writer = dataOut
+		if len(args) == 1 {
+			f, e := os.Create(args[0])
+			if e != nil {
+				return e
+			}
+			defer f.Close()
+			out = f
+		}
+		if e = lib.RenderJobManifest(out, manifest); e != nil {
+			return e
+		}
+		if len(args) == 1 {
+			cmd.Print(lib.T("k8s.written", args[0]))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(k8sCmd)
+	k8sCmd.AddCommand(k8sGenerateCmd)
+
+	k8sGenerateCmd.Flags().StringVar(&k8sPlaybook, "playbook", "", "playbook to run in the job.")
+	k8sGenerateCmd.Flags().StringArrayVar(&playVars, "var", nil, "set a {{ .name }} variable of the playbook, as name=value. Can be given more than once.")
+	k8sGenerateCmd.Flags().StringVar(&k8sImage, "image", "nagini:latest", "nagini image to run, such as one built from build/docker/Dockerfile.")
+	k8sGenerateCmd.Flags().StringVar(&k8sSchedule, "schedule", "", "cron schedule to run the playbook on, such as \"0 6 * * *\", generating a CronJob rather than a Job.")
+	k8sGenerateCmd.Flags().StringVar(&k8sLogClaim, "log-claim", "", "PersistentVolumeClaim holding the zeek logs, mounted read-only.")
+	k8sGenerateCmd.Flags().StringVar(&k8sOutputClaim, "output-claim", "", "PersistentVolumeClaim to write outputs to. Without one, outputs are lost with the pod.")
+	k8sGenerateCmd.Flags().StringVar(&k8sNamespace, "namespace", "", "namespace of the job. The current one if not set.")
+	k8sGenerateCmd.Flags().StringVar(&k8sName, "name", "", "name of the job. From the playbook file name if not set.")
+}
+
+// takes the k8s generate flags, does error checking, and then reads the playbook into a
+// manifest. returns a *lib.ValidationError holding every problem found, if any.
+func parseK8sParams() (manifest lib.JobManifest, e error) {
+	var v lib.Validator
+	if k8sPlaybook == "" {
+		v.Add(lib.T("error.k8s.playbook"))
+	}
+	if k8sLogClaim == "" {
+		v.Add(lib.T("error.k8s.claim"))
+	}
+	// five fields, or a macro such as @daily.
+	if k8sSchedule != "" && len(strings.Fields(k8sSchedule)) != 5 && !strings.HasPrefix(k8sSchedule, "@") {
+		v.Add(lib.T("error.k8s.schedule", k8sSchedule))
+	}
+	if k8sImage == "" {
+		v.Add(lib.T("error.k8s.image"))
+	}
+	if v.Failed() {
+		return manifest, v.Err()
+	}
+
+	vars, e := playbookVars(playVars)
+	if e != nil {
+		return manifest, e
+	}
+	playbook, e := lib.ParsePlaybookWithVars(k8sPlaybook, vars)
+	if e != nil {
+		return manifest, fmt.Errorf("could not read playbook %s: %w", k8sPlaybook, e)
+	}
+
+	// the pod is sized for the data source with the most threads.
+	jobThreads := playbook.Threads
+	for _, source := range playbook.DataSources {
+		if source.Threads > jobThreads {
+			jobThreads = source.Threads
+		}
+	}
+	if jobThreads == 0 {
+		jobThreads = threads
+	}
+	name := k8sName
+	if name == "" {
+		name = lib.JobName(k8sPlaybook)
+	}
+	return lib.JobManifest{
+		Name:        name,
+		Namespace:   k8sNamespace,
+		Image:       k8sImage,
+		Schedule:    k8sSchedule,
+		LogClaim:    k8sLogClaim,
+		OutputClaim: k8sOutputClaim,
+		Threads:     jobThreads,
+		Playbook:    playbook,
+	}, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// manCmd represents the man command
+var manCmd = &cobra.Command{
+	Use:   "man [output directory]",
+	Short: "Generate man pages for nagini and all of its commands.",
+	Long: `Generate man pages for nagini and all of its commands into the given directory.
+
+Example:
+	nagini man /usr/local/share/man/man1
+`,
+	Args: cobra.ExactArgs(1), // 1 argument: directory to write pages to
+	RunE: func(cmd *cobra.Command, args []string) error {
+		e := lib.TryCreateDir(args[0], false)
+		if e != nil {
+			return e
+		}
+
+		header := &doc.GenManHeader{
+			Title:   "NAGINI",
+			Section: "1",
+			Source:  "nagini",
+			Manual:  "Nagini Manual",
+		}
+		// the generated pages should not depend on the current day.
+		rootCmd.DisableAutoGenTag = true
+		e = doc.GenManTree(rootCmd, header, args[0])
+		if e != nil {
+			return e
+		}
+		cmd.Printf("Wrote man pages to %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(manCmd)
+}
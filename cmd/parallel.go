@@ -41,70 +41,105 @@ where my_script.py has the following required syntax:
 	./my_script.py [input file] [output file]
 `,
 	Args: cobra.ExactArgs(2), // 1 argument: script to run
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// parse params and args
-		startTime, endTime, resolvedOutDir, resolvedLogDir, logType, scriptPath := parseParallelParams(cmd, args[0], args[1])
+		rc, scriptPath, e := parseParallelParams(args[0], args[1])
+		if showSources {
+			printConfigSources(dataOut, flagSettings(cmd, append(append(sharedFlags, renderFlags...), taskManifestFlags...)...))
+			return e
+		}
+		if e != nil {
+			return e
+		}
 
 		// list params
-		cmd.Printf("Zeek Log Directory:\t%s\n", logDir)
-		cmd.Printf("Log Type:\t\t%s\n", logType)
-		cmd.Printf("Date Range:\t\t%s - %s\n", startTime.Format(lib.TimeFormatHuman), endTime.Format(lib.TimeFormatHuman))
-		cmd.Printf("Script to Run:\t\t%s\n", scriptPath)
-		cmd.Printf("Threads:\t\t%d\n", threads)
-		cmd.Printf("Output Directory:\t%s\n\n", resolvedOutDir)
+		printRunConfig(cmd, rc, lib.T("label.script", scriptPath))
+		if verifyAccess {
+			return verifyPullAccess(cmd, []lib.RuntimeConfig{rc})
+		}
+		if emitManifest != "" {
+			return emitTaskManifest(cmd, rc)
+		}
+		if e = checkInputSize(cmd, []lib.RuntimeConfig{rc}); e != nil {
+			return e
+		}
 
 		// prompt if continue
 		if !noConfirm && !lib.WaitForConfirm(cmd) {
 			// if start is no, do not continue
-			return
+			return nil
+		}
+
+		if e = fetchLogs(cmd, &rc); e != nil {
+			return e
 		}
 
 		// parse the given logs based on the runScript handler.
-		lib.ParseLogs(cmd,
+		report := &lib.RunReport{}
+		rc.Report = report
+		rc.Throttle = lib.NewThrottle(rc.Threads)
+		uploader := newUploader(rc.OutDir, false)
+		uploadDates(uploader, &rc)
+		e = lib.ParseLogs(dataOut, cmd.OutOrStderr(),
 			func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
-				runScript(scriptPath, logFile, outputFile, curTime, wgDate, taskBar)
+				runScript(scriptPath, report, rc.Throttle, logFile, outputFile, curTime, wgDate, taskBar)
 			},
-			debugLog, startTime, endTime, logType, resolvedLogDir, resolvedOutDir, threads, singleFile, false,
+			debugLog, rc,
 		)
+		if e != nil {
+			return e
+		}
+		if e = writeProvenance(cmd, args, rc, scriptPath); e != nil {
+			return e
+		}
 
-		cmd.Printf("\nComplete. Output: %s\n", outputDir)
-		return
+		cmd.Print(lib.T("parallel.complete", rc.OutDir))
+		report.Write(cmd.OutOrStderr())
+
+		pulls := []lib.PullSummary{{Name: rc.LogType, OutDir: rc.OutDir}}
+		// the outputs are complete, so they are uploaded even if they cannot be reported on.
+		e = renderSummary(cmd, args, rc.OutDir, reportParameters(flagSettings(cmd, append(append(sharedFlags, renderFlags...), taskManifestFlags...)...)), pulls, report)
+		if uploadErr := finishUpload(cmd, uploader); e == nil {
+			e = uploadErr
+		}
+		return e
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(parallelCmd)
+	addRenderFlags(parallelCmd)
+	addTaskManifestFlags(parallelCmd)
 }
 
 // takes args and params, does error checking, and then produces useful variables.
-func parseParallelParams(cmd *cobra.Command, logTypeArg string, scriptPathArg string) (startTime time.Time, endTime time.Time, resolvedOutDir string, resolvedLogDir string, logType string, scriptPath string) {
-	startTime, endTime, resolvedOutDir, resolvedLogDir, logType = lib.ParseSharedArgs(cmd, timeRange, logDir, outputDir, logTypeArg)
-
-	// try to resolve script, see if it exists.
-	scriptPath, e := filepath.Abs(scriptPathArg)
-	if e != nil {
-		cmd.PrintErrln("error: could not resolve relative path in user provided input.")
-		os.Exit(1)
-	}
-
-	// check to see if script file exists.
-	_, e = os.Stat(scriptPath)
-	if os.IsNotExist(e) {
-		cmd.PrintErrf("error: script '%s' does not exist.\n", scriptPath)
-		os.Exit(1)
-	}
-
-	_, e = exec.LookPath(scriptPath)
+// returns a *lib.ValidationError holding every problem found, if any.
+func parseParallelParams(logTypeArg string, scriptPathArg string) (rc lib.RuntimeConfig, scriptPath string, e error) {
+	var v lib.Validator
+	rc = lib.GenRuntimeConfig(&v, timeRange, logDir, outputDir, logTypeArg, threads, singleFile, false)
+	applyPullFlags(&v, &rc)
+	applyRenderFlags(&v, false)
+	applyTaskManifestFlags(&v, &rc)
+
+	// try to resolve script, see if it exists and is executable.
+	scriptPath, e = filepath.Abs(scriptPathArg)
 	if e != nil {
-		cmd.PrintErrf("error: script '%s' exists but is not marked as an executable.\n", scriptPath)
-		os.Exit(1)
+		v.Add(lib.T("error.relativepath"))
+	} else if _, e = os.Stat(scriptPath); os.IsNotExist(e) {
+		v.Add(lib.T("error.script", scriptPath))
+	} else if _, e = exec.LookPath(scriptPath); e != nil {
+		v.Add(lib.T("error.scriptexec", scriptPath))
 	}
 
-	return
+	// report every problem at once, before asking to continue.
+	return rc, scriptPath, v.Err()
 }
 
 // takes input file, script, and output file, and runs script in parallel, syncing given wait group.
-func runScript(scriptPath string, logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+// the resources used by the script, and the checksum of the log if verifyChecksums, are
+// recorded in report. A script that cannot be started for lack of resources is run again once
+// throttle lets fewer scripts run at once.
+func runScript(scriptPath string, report *lib.RunReport, throttle *lib.Throttle, logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
 	wgDate.Add(1)
 
 	// start concurrent method. Look through this log file, write to temp file, and then let
@@ -112,11 +147,29 @@ func runScript(scriptPath string, logFile string, outputFile string, curTime tim
 	go func(logFile string, outputFile string, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
 		debugLog.Printf("queued: %s -> %s\n", logFile, outputFile)
 
+		if verifyChecksums {
+			report.AddChecksum(logFile, lib.VerifyChecksum(logFile))
+		}
+
 		// run script, which should handle the file writing itself currently.
-		runErr := exec.Command(scriptPath, logFile, outputFile).Run()
+		slots := throttle.Limit()
+		script := exec.Command(scriptPath, logFile, outputFile)
+		runErr := script.Start()
+		for lib.IsResourceExhausted(runErr) && slots > 1 {
+			waitForFewerTasks(throttle, report, logFile, runErr, slots)
+			slots = throttle.Limit()
+			script = exec.Command(scriptPath, logFile, outputFile)
+			runErr = script.Start()
+		}
+		if runErr == nil {
+			runErr = script.Wait()
+		}
 		if runErr != nil {
 			debugLog.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), runErr)
 		}
+		if script.ProcessState != nil {
+			report.AddUsage(lib.UsageOf(logFile, script.ProcessState))
+		}
 		defer wgDate.Done()
 		taskBar.Increment()
 	}(logFile, outputFile, wgDate, taskBar)
@@ -0,0 +1,378 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/cheggaaa/pb"
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// a single data source of a playbook, resolved and ready to run.
+type play struct {
+	name     string
+	rc       lib.RuntimeConfig
+	target   filter
+	settings []setting // effective settings, listed by --show-config-sources
+}
+
+// playCmd represents the play command
+var playCmd = &cobra.Command{
+	Use:   "play [playbook YAML]",
+	Short: "Run every pull described in a playbook.",
+	Long: `Run every pull described in a playbook. Each data source is filtered with its own
+command, like 'nagini run', and written to its own directory inside the output directory.
+
+Command line flags take priority over the playbook, and settings of a data source take
+priority over playbook-wide settings.
+
+Example:
+	nagini play hunt.yaml
+
+To validate a playbook without running it, such as when reviewing a shared playbook, use
+--check. Unknown keys, missing paths and commands, and log types with no logs in the time
+range are all reported, and the exit status is non-zero if anything is wrong:
+	nagini play --check hunt.yaml
+
+Playbooks can use {{ .name }} variables, filled in from --var name=value or from the
+NAGINI_VAR_name environment variable, so one reviewed playbook can be reused:
+	nagini play --var ip=10.0.0.5 --var since=2021/06/01:00 ip-hunt.yaml
+
+where hunt.yaml looks like:
+	time_range: 2021/06/01:00-2021/06/02:23
+	output_dir: ./hunt
+	data_sources:
+	  - name: rdp-subnet
+	    log_type: rdp
+	    command: [grepcidr, 10.0.0.0/24]
+	  - name: dns-evil
+	    log_type: dns
+	    threads: 4
+	    command: [grep, -F, evil.example.com]
+`,
+	Args: cobra.ExactArgs(1), // 1 argument: playbook to run
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPlaybook(cmd, args[0])
+	},
+}
+
+// play args
+var playVars []string // playbook variables, as name=value
+var playCheck bool    // only validate the playbook
+
+func init() {
+	rootCmd.AddCommand(playCmd)
+	addPlayFlags(playCmd)
+}
+
+// adds the flags of running a playbook to cmd.
+func addPlayFlags(cmd *cobra.Command) {
+	addLimitFlags(cmd)
+	addRenderFlags(cmd)
+	cmd.Flags().StringArrayVar(&playVars, "var", nil, "set a {{ .name }} variable of the playbook, as name=value. Can be given more than once.")
+	cmd.Flags().BoolVar(&playCheck, "check", false, "only validate the playbook, without running anything.")
+}
+
+// reads the playbook at path, lists its data sources and, once confirmed, runs each in turn.
+// With --check, only validates it. With --show-config-sources, only lists its settings.
+func runPlaybook(cmd *cobra.Command, path string) error {
+	vars, e := playbookVars(playVars)
+	if e != nil {
+		return e
+	}
+	parse := lib.ParsePlaybookWithVars
+	if playCheck {
+		parse = lib.ParsePlaybookStrict
+	}
+	playbook, e := parse(path, vars)
+	if e != nil {
+		return fmt.Errorf("could not read playbook %s: %w", path, e)
+	}
+	return runParsedPlaybook(cmd, path, playbook, vars)
+}
+
+// runs a playbook read from path, or named path, filled in with vars, like runPlaybook.
+func runParsedPlaybook(cmd *cobra.Command, path string, playbook lib.Playbook, vars map[string]string) error {
+	// parse params and playbook. Log directories are only looked in once the pre_run hooks,
+	// which may mount them, have run.
+	plays, e := parsePlayParams(cmd, playbook, len(playbook.PreRun) > 0)
+	if showSources {
+		for _, p := range plays {
+			fmt.Fprint(dataOut, lib.T("label.play", p.name))
+			printConfigSources(dataOut, p.settings)
+		}
+		return e
+	}
+	if e != nil {
+		return e
+	}
+	if playCheck {
+		fmt.Fprint(dataOut, lib.T("play.check.ok", path, len(plays)))
+		return nil
+	}
+
+	// list params of every data source
+	for _, p := range plays {
+		cmd.Print(lib.T("label.play", p.name))
+		printRunConfig(cmd, p.rc, p.target.label())
+	}
+	printHooks(cmd, "label.prerun", playbook.PreRun)
+	printHooks(cmd, "label.postrun", playbook.PostRun)
+
+	// prompt if continue. --verify-access pulls nothing, so is not asked about.
+	if !verifyAccess && !noConfirm && !lib.WaitForConfirm(cmd) {
+		// if start is no, do not continue
+		return nil
+	}
+
+	hookEnv := []string{lib.HookEnvPlaybook + "=" + path, lib.HookEnvOutputDir + "=" + filepath.Dir(plays[0].rc.OutDir)}
+	if len(playbook.PreRun) > 0 {
+		if e = runHooks(cmd, "pre_run", playbook.PreRun, hookEnv); e != nil {
+			return e
+		}
+		if plays, e = parsePlayParams(cmd, playbook, false); e != nil {
+			return e
+		}
+	}
+	// the log directories pre_run hooks mount are only there to be checked and sized once they
+	// have run.
+	var inputs []lib.RuntimeConfig
+	for _, p := range plays {
+		inputs = append(inputs, p.rc)
+	}
+	if verifyAccess {
+		return verifyPullAccess(cmd, inputs)
+	}
+	if e = checkInputSize(cmd, inputs); e != nil {
+		return e
+	}
+
+	// run each data source in turn, each with its own pool of threads.
+	report := &lib.RunReport{}
+	// post_run hooks may read the outputs, so they are only removed once the hooks are done.
+	uploader := newUploader(filepath.Dir(plays[0].rc.OutDir), len(playbook.PostRun) > 0)
+	for _, p := range plays {
+		p := p
+		uploadDates(uploader, &p.rc)
+		limit := lib.NewRecordLimit(p.rc)
+		p.rc.Report = report
+		p.rc.Throttle = lib.NewThrottle(p.rc.Threads)
+		cmd.Print(lib.T("label.play", p.name))
+		run := startLineage(cmd, playbookName(path)+"."+p.name, p.rc, p.target.String())
+		e := runPlay(cmd, path, p, limit, report)
+		run.end(e)
+		if e != nil {
+			return fmt.Errorf("%s: %w", p.name, e)
+		}
+	}
+
+	cmd.Print(lib.T("run.complete"))
+	cmd.Print(lib.T("run.output", filepath.Dir(plays[0].rc.OutDir)))
+	cmd.Println()
+	report.Write(cmd.OutOrStderr())
+
+	// the report covers every data source, with the variables the playbook was filled in with.
+	parameters := []lib.Parameter{{Name: "playbook", Value: path}}
+	for _, name := range sortedKeys(vars) {
+		parameters = append(parameters, lib.Parameter{Name: "var " + name, Value: vars[name]})
+	}
+	var pulls []lib.PullSummary
+	for _, p := range plays {
+		command := setting{"command", p.target.String(), lib.SourcePlaybook}
+		pulls = append(pulls, lib.PullSummary{Name: p.name, OutDir: p.rc.OutDir, Parameters: reportParameters(append(p.settings, command))})
+	}
+	// the outputs are complete, so they are uploaded even if they cannot be reported on.
+	e = renderSummary(cmd, []string{path}, filepath.Dir(plays[0].rc.OutDir), parameters, pulls, report)
+	if e == nil {
+		e = runHooks(cmd, "post_run", playbook.PostRun, hookEnv)
+	}
+	if uploadErr := finishUpload(cmd, uploader); e == nil {
+		e = uploadErr
+	}
+	return e
+}
+
+// runs the pull of the data source p of the playbook read from path, recording into report.
+func runPlay(cmd *cobra.Command, path string, p play, limit *lib.RecordLimit, report *lib.RunReport) error {
+	notices, e := relatedNotices(cmd, p.rc, report)
+	if e != nil {
+		return e
+	}
+	if e = fetchLogs(cmd, &p.rc); e != nil {
+		return e
+	}
+	union, e := normalizedSchema(p.rc, report)
+	if e != nil {
+		return e
+	}
+	p.target.notices = notices
+	target := p.target.start()
+	e = lib.ParseLogs(dataOut, cmd.OutOrStderr(),
+		func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+			runCommand(target, limit, report, union, p.rc.Throttle, logFile, outputFile, curTime, wgDate, taskBar)
+		},
+		debugLog, p.rc)
+	target.stop(report)
+	if e != nil {
+		report.Write(cmd.OutOrStderr())
+		return e
+	}
+	return writeProvenance(cmd, []string{path}, p.rc, p.target.String())
+}
+
+// returns the name of the playbook read from path, without its directory or extension.
+func playbookName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// lists the commands of hooks, each on a line of label.
+func printHooks(cmd *cobra.Command, label string, hooks []lib.PlaybookHook) {
+	for _, hook := range hooks {
+		onFailure := lib.HookAbort
+		if hook.Warns() {
+			onFailure = lib.HookWarn
+		}
+		cmd.Print(lib.T(label, hook, onFailure))
+	}
+	if len(hooks) > 0 {
+		cmd.Println()
+	}
+}
+
+// runs the hooks of stage in turn, with env added to their environment. Returns an error once
+// one fails, unless it is only to be warned about.
+func runHooks(cmd *cobra.Command, stage string, hooks []lib.PlaybookHook, env []string) error {
+	for _, hook := range hooks {
+		cmd.Print(lib.T("play.hook", stage, hook))
+		if e := lib.RunHook(hook, env, cmd.OutOrStderr()); e != nil {
+			if !hook.Warns() {
+				return errors.New(lib.T("error.hook", stage, hook, e))
+			}
+			cmd.Print(lib.T("warn.hook", stage, hook, e))
+		}
+	}
+	return nil
+}
+
+// records a problem for each hook of stage with no command, or an unknown on_failure.
+func validateHooks(v *lib.Validator, stage string, hooks []lib.PlaybookHook) {
+	for i, hook := range hooks {
+		if len(hook.Command) == 0 {
+			v.Add(lib.T("error.hook.nocommand", stage, i+1))
+		}
+		if hook.OnFailure != "" && hook.OnFailure != lib.HookAbort && hook.OnFailure != lib.HookWarn {
+			v.Add(lib.T("error.hook.onfailure", stage, i+1, hook.OnFailure, lib.HookAbort, lib.HookWarn))
+		}
+	}
+}
+
+// returns the variables to fill the playbook in with: those from the environment, overridden
+// by those given as name=value args.
+func playbookVars(args []string) (vars map[string]string, e error) {
+	vars = lib.PlaybookVarsFromEnv()
+	for _, arg := range args {
+		keyValue := strings.SplitN(arg, "=", 2)
+		if len(keyValue) != 2 || keyValue[0] == "" {
+			return vars, errors.New(lib.T("error.var", arg))
+		}
+		vars[keyValue[0]] = keyValue[1]
+	}
+	return vars, nil
+}
+
+// returns the keys of m, sorted.
+func sortedKeys(m map[string]string) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resolves every data source of the playbook into a play, applying flags, then data source
+// settings, then playbook settings. Returns a *lib.ValidationError holding every problem found
+// across all data sources and hooks, if any. If logDirPending is set, log directories are not
+// looked in, see lib.Validator.
+func parsePlayParams(cmd *cobra.Command, playbook lib.Playbook, logDirPending bool) (plays []play, e error) {
+	v := lib.Validator{LogDirPending: logDirPending}
+	if len(playbook.DataSources) == 0 {
+		v.Add(lib.T("error.play.empty"))
+	}
+	if writeStdout {
+		v.Add(lib.T("error.play.stdout"))
+	}
+	validateHooks(&v, "pre_run", playbook.PreRun)
+	validateHooks(&v, "post_run", playbook.PostRun)
+
+	playTimeRange, timeRangeSource := stringSetting(cmd, "timerange", timeRange, playbook.TimeRange)
+	playOutDir, outDirSource := stringSetting(cmd, "outdir", outputDir, playbook.OutputDir)
+	v.OutputDir(playOutDir, true)
+	applyRenderFlags(&v, false)
+
+	seen := make(map[string]bool)
+	for i, source := range playbook.DataSources {
+		if source.Name == "" {
+			v.Add(lib.T("error.play.noname", i+1))
+			continue
+		}
+		if seen[source.Name] {
+			v.Add(lib.T("error.play.duplicate", source.Name))
+			continue
+		}
+		seen[source.Name] = true
+		if len(source.Command) == 0 && source.JQ == "" && source.Where == "" && source.Script == "" {
+			v.Add(lib.T("error.play.nocommand", source.Name))
+			continue
+		}
+
+		sourceLogDir, logDirSource := stringSetting(cmd, "logdir", logDir, source.ManualPath, playbook.ZeekLogDir)
+		sourceOutDir := filepath.Join(playOutDir, source.Name)
+		sourceThreads, threadsSource := intSetting(cmd, "threads", threads, source.Threads, playbook.Threads)
+
+		p := play{name: source.Name}
+		p.rc = lib.GenRuntimeConfig(&v, playTimeRange, sourceLogDir, sourceOutDir, source.Type, sourceThreads, singleFile, false)
+		applyPullFlags(&v, &p.rc)
+		applyLimitFlags(&v, &p.rc)
+		p.settings = append([]setting{
+			{"timerange", playTimeRange, timeRangeSource},
+			{"logdir", sourceLogDir, logDirSource},
+			{"outdir", sourceOutDir, outDirSource},
+			{"threads", sourceThreads, threadsSource},
+		}, flagSettings(cmd, append([]string{"order", "hours", "weekdays", "weekends", "outside-mask", "modified-since", "modified-before", "file-time", "cluster", "on-change", "wait-late", "verify-checksums", "progress-threshold", "cache-dir", "cache-size", "concat", "manifest", "compress", "lang"}, append(limitFlags, renderFlags...)...)...)...)
+		command := source.Command
+		if source.Script != "" {
+			script := inlineScript(&v, []byte(source.Script))
+			if script == "" {
+				continue
+			}
+			command = append([]string{script}, source.Command...)
+		}
+		p.target = newFilter(&v, p.rc.LogType, command, source.JQ, source.Where)
+		plays = append(plays, p)
+	}
+
+	// report every problem at once, before asking to continue.
+	return plays, v.Err()
+}
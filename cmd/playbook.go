@@ -0,0 +1,115 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// playbookCmd represents the playbook command
+var playbookCmd = &cobra.Command{
+	Use:   "playbook",
+	Short: "List, show and run playbooks from the shared playbook library.",
+	Long: `List, show and run playbooks from the shared playbook library, by name rather than by path.
+
+The library is a directory of playbooks, set with playbook_dir in the config file or with
+--playbook-dir. Playbooks are named by their path inside it without the extension, so
+dns/evil is dns/evil.yaml. If the directory is a git checkout, the commit it is at is shown,
+so it is clear which version of a playbook was run.
+
+Example:
+	nagini playbook list
+	nagini playbook show dns/evil
+	nagini playbook run --var domain=evil.example.com dns/evil
+`,
+}
+
+var playbookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the playbooks in the library.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		playbooks, e := lib.ListPlaybooks(playbookDir)
+		if e != nil {
+			return fmt.Errorf("could not read playbook library %s: %w", playbookDir, e)
+		}
+		cmd.Print(lib.T("label.library", playbookDir, libraryRevision()))
+
+		// the list goes to stdout so it can be piped.
+		w := tabwriter.NewWriter(dataOut, 0, 8, 2, ' ', 0)
+		for _, playbook := range playbooks {
+			fmt.Fprintf(w, "%s\t%s\n", playbook.Name, playbook.Description)
+		}
+		return w.Flush()
+	},
+}
+
+var playbookShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print a playbook from the library.",
+	Args:  cobra.ExactArgs(1), // 1 argument: playbook to show
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, e := lib.FindPlaybook(playbookDir, args[0])
+		if e != nil {
+			return e
+		}
+		content, e := ioutil.ReadFile(path)
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("label.playbook", path, libraryRevision()))
+		_, e = dataOut.Write(content)
+		return e
+	},
+}
+
+var playbookRunCmd = &cobra.Command{
+	Use:   "run [name]",
+	Short: "Run a playbook from the library, like 'nagini play'.",
+	Args:  cobra.ExactArgs(1), // 1 argument: playbook to run
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, e := lib.FindPlaybook(playbookDir, args[0])
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("label.playbook", path, libraryRevision()))
+		return runPlaybook(cmd, path)
+	},
+}
+
+// playbook args
+var playbookDir string // directory of the playbook library, set in root with the config default.
+
+func init() {
+	rootCmd.AddCommand(playbookCmd)
+	playbookCmd.AddCommand(playbookListCmd, playbookShowCmd, playbookRunCmd)
+
+	addPlayFlags(playbookRunCmd)
+}
+
+// returns the git commit the library is at, for labels, or a note that it is not versioned.
+func libraryRevision() string {
+	if revision := lib.LibraryRevision(playbookDir); revision != "" {
+		return revision
+	}
+	return lib.T("library.unversioned")
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// preset args
+var presetShow bool // print the playbook of the preset rather than running it.
+
+// presetCmd represents the preset command
+var presetCmd = &cobra.Command{
+	Use:   "preset [name]",
+	Short: "Run a built-in playbook, such as lateral-movement.",
+	Long: `Run a built-in playbook by name, like 'nagini play'. Presets pull several log types at once with
+filters for a common investigation, such as the SMB, DCE-RPC, Kerberos, NTLM and RDP activity of
+a host for lateral movement. With no name, the presets are listed. With --show, the playbook of
+a preset is printed instead, to copy into the playbook library and adapt.
+
+Example:
+	nagini preset
+	nagini preset -r 2021/06/01:00-2021/06/07:23 lateral-movement --var host=10.1.2.3
+	nagini preset --show kerberoasting
+`,
+	Args: cobra.MaximumNArgs(1), // 1 argument: preset to run, or none to list them.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			// the list goes to stdout so it can be piped.
+			w := tabwriter.NewWriter(dataOut, 0, 8, 2, ' ', 0)
+			for _, preset := range lib.ListPresets() {
+				fmt.Fprintf(w, "%s\t%s\n", preset.Name, preset.Description)
+			}
+			return w.Flush()
+		}
+		if presetShow {
+			content, e := lib.PresetContent(args[0])
+			if e != nil {
+				return e
+			}
+			_, e = dataOut.Write(content)
+			return e
+		}
+
+		vars, e := playbookVars(playVars)
+		if e != nil {
+			return e
+		}
+		playbook, e := lib.ParsePreset(args[0], vars, playCheck)
+		if e != nil {
+			return fmt.Errorf("could not read preset %s: %w", args[0], e)
+		}
+		return runParsedPlaybook(cmd, "preset:"+args[0], playbook, vars)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(presetCmd)
+	addPlayFlags(presetCmd)
+	presetCmd.Flags().BoolVar(&presetShow, "show", false, "print the playbook of the preset, rather than running it.")
+}
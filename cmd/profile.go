@@ -0,0 +1,128 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// longest value listed among the top values of a field, past which it is cut short.
+const profileValueWidth = 40
+
+// profile args
+var profileLogs int    // number of logs to sample, spread over the time range.
+var profileRecords int // number of records to read from each sampled log.
+var profileTop int     // number of most common values to list for each field.
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile [log type]",
+	Short: "Describe the fields of a log type over the time range.",
+	Long: `Describe the fields of a log type over the time range, from a sample of its logs: how often
+each field is unset, how many distinct values it has, and its most common values. Useful to decide
+which fields to filter on or project before a big pull. Nothing is written to an output directory.
+
+Example:
+	nagini profile -r 2021/06/01:00-2021/06/07:23 dns
+`,
+	Args: cobra.ExactArgs(1), // 1 argument: log type
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rc, e := parseProfileParams(args[0])
+		if showSources {
+			printConfigSources(dataOut, flagSettings(cmd, append(queryFlags, "sample-logs", "sample-records", "top")...))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+		if e = fetchLogs(cmd, &rc); e != nil {
+			return e
+		}
+
+		report := &lib.RunReport{}
+		rc.Report = report
+		profile, e := lib.ProfileLogs(rc, profileLogs, profileRecords, profileTop)
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("profile.sampled", profile.Records, len(profile.Sampled), profile.Logs))
+
+		// the profile goes to stdout so it can be piped.
+		w := tabwriter.NewWriter(dataOut, 0, 8, 2, ' ', 0)
+		fmt.Fprint(w, lib.T("profile.header"))
+		for _, field := range profile.Fields {
+			distinct := fmt.Sprint(field.Distinct)
+			if field.MoreDistinct {
+				distinct += "+"
+			}
+			var top []string
+			for _, value := range field.Top {
+				top = append(top, fmt.Sprintf("%s (%d)", shorten(value.Value, profileValueWidth), value.Count))
+			}
+			fmt.Fprintf(w, "%s\t%.1f%%\t%s\t%s\n", field.Name, 100*profile.NullRate(field), distinct, strings.Join(top, ", "))
+		}
+		if e = w.Flush(); e != nil {
+			return e
+		}
+		report.Write(cmd.OutOrStderr())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.Flags().IntVar(&profileLogs, "sample-logs", 24, "number of logs to read, spread evenly over the time range. 0 to read every log.")
+	profileCmd.Flags().IntVar(&profileRecords, "sample-records", 10000, "number of records to read from each sampled log. 0 to read every record.")
+	profileCmd.Flags().IntVar(&profileTop, "top", 5, "number of most common values to list for each field.")
+}
+
+// takes args and params, does error checking, and then produces useful variables.
+// returns a *lib.ValidationError holding every problem found, if any.
+func parseProfileParams(logTypeArg string) (rc lib.RuntimeConfig, e error) {
+	var v lib.Validator
+	rc.StartTime, rc.EndTime = v.TimeRange(timeRange)
+	v.Threads(threads)
+	rc.Threads = threads
+	rc.LogDir = v.LogDir(logDir)
+	rc.LogType = logTypeArg
+	v.LogType(rc.LogType, rc.LogDir, rc.StartTime, rc.EndTime)
+	applyPullFlags(&v, &rc)
+	for _, flag := range []struct {
+		name  string
+		value int
+	}{{"sample-logs", profileLogs}, {"sample-records", profileRecords}, {"top", profileTop}} {
+		if flag.value < 0 {
+			v.Add(lib.T("error.profile.sample", flag.name, flag.value))
+		}
+	}
+
+	// report every problem at once.
+	return rc, v.Err()
+}
+
+// returns s, cut short with an ellipsis if it is longer than width characters.
+func shorten(s string, width int) string {
+	if runes := []rune(s); len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+var pruneRoot string      // directory to prune the outputs under, rather than the retention rules.
+var pruneOlderThan string // age of the outputs to prune under pruneRoot.
+var pruneDryRun bool      // if set, only lists the outputs that would be removed.
+var retention []lib.RetentionRule
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the outputs of pulls kept past their retention.",
+	Long: `Remove the output directories of pulls that nothing was modified in for longer than they
+are kept for. Each directory under a root holding the .nagini-output marker every pull leaves
+is taken as the output of a pull, and removed whole unless a run is still writing into it.
+Other directories, such as those of cases, are only looked in for outputs, and anything else
+in them is kept. Without --root and --older-than, every rule under retention in the global
+config is applied, such as:
+
+	retention:
+	  - root: /cases
+	    older_than: 30d
+
+The outputs to remove are listed, with when they were last modified and their size, before
+asking to continue. With --dry-run they are only listed. A root holding the log directory, or
+inside it, is refused. To prune on a schedule, run nagini prune -N from cron or a timer.
+
+Example:
+	nagini prune --root /cases --older-than 30d --dry-run
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var v lib.Validator
+		rules := retention
+		if cmd.Flags().Changed("root") || cmd.Flags().Changed("older-than") {
+			if pruneRoot == "" || pruneOlderThan == "" {
+				v.Add(lib.T("error.prune.flags"))
+			}
+			rules = []lib.RetentionRule{{Root: pruneRoot, OlderThan: pruneOlderThan}}
+		} else if len(rules) == 0 {
+			v.Add(lib.T("error.prune.rules"))
+		}
+		ages := make([]time.Duration, len(rules))
+		for i, rule := range rules {
+			if rule.Root == "" || rule.OlderThan == "" {
+				continue
+			}
+			age, e := lib.ParseAge(rule.OlderThan)
+			if e != nil {
+				v.AddErr(e)
+			}
+			ages[i] = age
+			v.PruneRoot(rule.Root, logDir)
+		}
+		if e := v.Err(); e != nil {
+			return e
+		}
+
+		var expired []lib.ExpiredOutput
+		now := time.Now()
+		for i, rule := range rules {
+			outputs, e := lib.ExpiredOutputs(rule.Root, ages[i], now)
+			if e != nil {
+				return e
+			}
+			cmd.Print(lib.T("prune.rule", rule.Root, rule.OlderThan, len(outputs)))
+			for _, output := range outputs {
+				cmd.Print(output.Label())
+			}
+			expired = append(expired, outputs...)
+		}
+		if len(expired) == 0 || pruneDryRun {
+			return nil
+		}
+
+		// prompt if continue
+		if !noConfirm && !lib.WaitForConfirm(cmd) {
+			return nil
+		}
+		if e := lib.PruneOutputs(expired); e != nil {
+			return e
+		}
+		cmd.Print(lib.PrunedLabel(expired))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().StringVar(&pruneRoot, "root", "", "directory whose pull outputs are pruned, rather than the retention rules of the global config")
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "remove the outputs under --root not modified for this long, such as 30d, 2w or 72h")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "only list the outputs that would be removed")
+}
@@ -0,0 +1,247 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// rendered report args, for commands that write to an output directory.
+var renderReport string   // format to render a report of the output in, if any.
+var reportTemplate string // template to render the report with, instead of the built in one.
+var ticket string         // ticket to post the report to, if any.
+var provenance bool       // write a provenance sidecar next to each output file.
+var upload string         // s3://bucket/prefix/ to upload the output to once done, if any.
+var uploadRemove bool     // remove each output file once uploaded.
+
+// ticket webhook from the global config, set in root.
+var ticketWebhook string
+var ticketToken string
+
+// OpenLineage endpoint the events of every pull are posted to from the global config, set in
+// root. Empty to post none.
+var lineageURL string
+var lineageToken string
+var lineageNamespace string
+
+// store --upload writes to, with its credentials, from the global config, set in root. The
+// standard AWS environment variables take precedence.
+var s3Client lib.S3Client
+
+// flags that report on the output once done, listed by --show-config-sources.
+var renderFlags = []string{"render-report", "report-template", "ticket", "provenance", "upload", "upload-remove"}
+
+// adds the flags that report on the output once done to the given command.
+func addRenderFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&renderReport, "render-report", "",
+		fmt.Sprintf("once done, render a report of the output (parameters, records per day, top talkers) into the output directory. One of: %s", strings.Join(lib.SummaryFormats(), ", ")))
+	cmd.Flags().StringVar(&reportTemplate, "report-template", "", "go template to render the report with, instead of the built in one. Requires --render-report.")
+	cmd.Flags().StringVar(&ticket, "ticket", "", "once done, post the report and output locations to the ticket webhook set in the config file, to create or update this ticket, such as INC-1234.")
+	cmd.Flags().BoolVar(&provenance, "provenance", false, "write a sidecar next to each output file, named for it with "+lib.ProvenanceExtension+" added, with the nagini version, command line, filter and source range it was made with.")
+	cmd.Flags().StringVar(&upload, "upload", "", "upload the output of each date once it is final, and every other file of the output directory once done, to S3, or the S3 compatible store set by s3_endpoint in the config file, under this s3://bucket/prefix/ and the name of the output directory.")
+	cmd.Flags().BoolVar(&uploadRemove, "upload-remove", false, "remove each output file once uploaded by --upload, and the directories left empty, for hosts with little disk.")
+}
+
+// records a problem if the report flags are invalid, or cannot be used with the output.
+func applyRenderFlags(v *lib.Validator, writeStdout bool) {
+	if provenance && writeStdout {
+		v.Add(lib.T("error.provenance.stdout"))
+	}
+	if ticket != "" && ticketWebhook == "" {
+		v.Add(lib.T("error.ticket.nowebhook"))
+	}
+	if upload != "" {
+		if _, e := lib.ParseS3Target(upload); e != nil {
+			v.Add(lib.T("error.upload.target", upload))
+		}
+		if writeStdout {
+			v.Add(lib.T("error.upload.stdout"))
+		}
+		if c := s3Client.WithEnv(); c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			v.Add(lib.T("error.upload.credentials"))
+		}
+	} else if uploadRemove {
+		v.Add(lib.T("error.upload.remove"))
+	}
+	if renderReport == "" {
+		if reportTemplate != "" {
+			v.Add(lib.T("error.reporttemplate.noformat"))
+		}
+		return
+	}
+	known := false
+	for _, format := range lib.SummaryFormats() {
+		known = known || renderReport == format
+	}
+	if !known {
+		v.Add(lib.T("error.reportformat", renderReport, strings.Join(lib.SummaryFormats(), ", ")))
+	}
+	if writeStdout {
+		v.Add(lib.T("error.reportstdout"))
+	}
+	if reportTemplate != "" {
+		if _, e := os.Stat(reportTemplate); e != nil {
+			v.Add(lib.T("error.reporttemplate", reportTemplate))
+		}
+	}
+}
+
+// returns the given settings as report parameters.
+func reportParameters(settings []setting) (parameters []lib.Parameter) {
+	for _, s := range settings {
+		parameters = append(parameters, lib.Parameter{Name: s.name, Value: fmt.Sprint(s.value)})
+	}
+	return parameters
+}
+
+// writes the provenance sidecar of every output file of the pull of rc through filter, if
+// asked to with --provenance. The command line is that of cmd, with the flags set and args.
+func writeProvenance(cmd *cobra.Command, args []string, rc lib.RuntimeConfig, filter string) error {
+	if !provenance || rc.WriteStdout {
+		return nil
+	}
+	commandLine := []string{cmd.CommandPath()}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		commandLine = append(commandLine, "--"+f.Name+"="+f.Value.String())
+	})
+	p := lib.NewProvenance(strings.Join(append(commandLine, args...), " "), filter, rc)
+	if _, e := lib.WriteProvenance(rc.OutDir, p); e != nil {
+		return fmt.Errorf("could not write provenance of %s: %w", rc.OutDir, e)
+	}
+	return nil
+}
+
+// lineage of a pull: the OpenLineage run its events are posted for, if lineage_url is set.
+type lineage struct {
+	cmd    *cobra.Command
+	runID  string
+	job    string
+	rc     lib.RuntimeConfig
+	filter string
+}
+
+// posts the start of the pull of rc through filter, run as job, to the lineage endpoint, and
+// returns its lineage to post how it ended with. rc is the pull as given, before any remote
+// logs are fetched.
+func startLineage(cmd *cobra.Command, job string, rc lib.RuntimeConfig, filter string) lineage {
+	l := lineage{cmd: cmd, runID: lib.NewLineageRunID(), job: job, rc: rc, filter: filter}
+	l.post(lib.LineageStart, nil)
+	return l
+}
+
+// posts that the pull is complete, or has failed with e if set.
+func (l lineage) end(e error) {
+	if e != nil {
+		l.post(lib.LineageFail, e)
+	} else {
+		l.post(lib.LineageComplete, nil)
+	}
+}
+
+// posts an event of the pull, only warning if it cannot be, as the pull is not at fault.
+func (l lineage) post(eventType string, failure error) {
+	if lineageURL == "" {
+		return
+	}
+	event := lib.NewLineageEvent(eventType, l.runID, lineageNamespace, l.job, l.rc, l.filter, failure)
+	if e := lib.PostLineageEvent(lineageURL, lineageToken, event); e != nil {
+		l.cmd.Print(lib.T("warn.lineage", eventType, l.job, e))
+	}
+}
+
+// renders the report of the given pulls into dir and posts it to the ticket, if requested.
+// The report is titled with the command line, and each pull is summarized from its output directory.
+func renderSummary(cmd *cobra.Command, args []string, dir string, parameters []lib.Parameter, pulls []lib.PullSummary, report *lib.RunReport) error {
+	if renderReport == "" && ticket == "" {
+		return nil
+	}
+	summary := lib.NewSummary(strings.Join(append([]string{cmd.CommandPath()}, args...), " "), parameters, report)
+	var outputs []string
+	for _, pull := range pulls {
+		summarized, e := lib.SummarizeOutput(pull.Name, pull.OutDir, pull.Parameters)
+		if e != nil {
+			return fmt.Errorf("could not summarize %s: %w", pull.OutDir, e)
+		}
+		summary.Pulls = append(summary.Pulls, summarized)
+		outputs = append(outputs, pull.OutDir)
+	}
+
+	if renderReport != "" {
+		path, e := lib.WriteSummary(dir, renderReport, reportTemplate, summary)
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("run.rendered", path))
+		outputs = append(outputs, path)
+	}
+
+	if ticket != "" {
+		update, e := lib.NewTicketUpdate(ticket, summary, outputs)
+		if e == nil {
+			e = lib.PostTicketUpdate(ticketWebhook, ticketToken, update)
+		}
+		if e != nil {
+			return errors.New(lib.T("error.ticket", ticket, e))
+		}
+		cmd.Print(lib.T("run.ticket", ticket))
+	}
+	return nil
+}
+
+// returns the uploader of the outputs under the output directory dir to --upload, or nil
+// without it. Reports and provenance written once the pull is done read the outputs, so with
+// them, or if readLater is set, the outputs are only removed once every output is uploaded.
+func newUploader(dir string, readLater bool) *lib.Uploader {
+	if upload == "" {
+		return nil
+	}
+	// already validated.
+	target, _ := lib.ParseS3Target(upload)
+	keep := readLater || renderReport != "" || ticket != "" || provenance
+	return &lib.Uploader{Client: s3Client.WithEnv(), Target: target, Dir: dir, Remove: uploadRemove, KeepUntilFinish: keep}
+}
+
+// uploads the output of each date of the pull of rc with u as soon as it is final, so with
+// --upload-remove, only the outputs of the dates being pulled are on disk at once. With
+// --concat, they are merged into a single output once the pull is done, left to finishUpload.
+func uploadDates(u *lib.Uploader, rc *lib.RuntimeConfig) {
+	if u != nil && !rc.SingleFile {
+		rc.OnDayDone = u.DayDone
+	}
+}
+
+// uploads the outputs u has not uploaded yet, such as reports, removing every output once
+// uploaded with --upload-remove.
+func finishUpload(cmd *cobra.Command, u *lib.Uploader) error {
+	if u == nil {
+		return nil
+	}
+	uploaded, e := u.Finish()
+	if e != nil {
+		return errors.New(lib.T("error.upload", u.Target, e))
+	}
+	cmd.Print(lib.T("run.uploaded", uploaded, u.Target.String()+filepath.Base(u.Dir)+"/"))
+	return nil
+}
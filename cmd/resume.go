@@ -0,0 +1,61 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume [output directory]",
+	Short: "Finish building the output of a pull that died while concatenating it.",
+	Long: `Finish building the output files of a pull that died, such as by being killed, while
+concatenating the output of each day or, with --concat, the single output file. The progress of
+each output file is journaled next to it, in a .concat-journal file, until it is complete, and
+the files it is built from are kept until they are written to it, so it is finished from where
+it was rather than lost.
+
+Example:
+	nagini resume ./output-20210601-120000
+`,
+	Args: cobra.ExactArgs(1), // 1 argument: output directory of the pull.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// a pull still writing the output directory has not died, and must not be resumed.
+		lock, e := lib.LockDir(args[0])
+		if e != nil {
+			return e
+		}
+		defer lock.Unlock()
+		finished, e := lib.ResumeConcats(debugLog, args[0])
+		for _, output := range finished {
+			cmd.Print(lib.T("resume.finished", output))
+		}
+		if e != nil {
+			return e
+		}
+		if len(finished) == 0 {
+			cmd.Print(lib.T("resume.none", args[0]))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
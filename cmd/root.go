@@ -1,27 +1,72 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	lib "github.com/OSU-SOC/nagini/lib"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // args
-var threads int      // number of threads to run
-var verbose bool     // verbose
-var timeRange string // string format of time range to go over
-var outputDir string // directory to output logs
-var logDir string    // directory containing all zeek logs
-var singleFile bool  // holds whether or not to concat into one file.
-var noConfirm bool   // if set, skips continue prompt.
-var writeStdout bool // if set, writes to Stdout instead of the output directory.
+var threads int           // number of threads to run
+var verbose bool          // verbose
+var timeRange string      // string format of time range to go over
+var outputDir string      // directory to output logs
+var logDir string         // directory containing all zeek logs
+var singleFile bool       // holds whether or not to concat into one file.
+var noConfirm bool        // if set, skips continue prompt.
+var writeStdout bool      // if set, writes to Stdout instead of the output directory.
+var lang string           // language for user-facing messages.
+var showSources bool      // if set, lists every effective setting and its source.
+var order string          // order to pull dates in, oldest or newest first.
+var verifyChecksums bool  // if set, checks each log against its sha256 sidecar first.
+var verifyAccess bool     // if set, only checks that every log of the pull can be read.
+var maxInputSize string   // largest input a pull may read, such as 500G, or "" for no limit.
+var maxInputBytes int64   // maxInputSize in bytes, set once validated.
+var force bool            // if set, pulls more than maxInputSize, with a warning.
+var modifiedSince string  // only pull logs modified at or after this time.
+var modifiedBefore string // only pull logs modified before this time.
+var fileTime string       // file time to compare, mtime or ctime.
+var month string          // shorthand for a time range covering a whole month.
+var hours string          // only pull these hours of each day, HH-HH.
+var weekdays bool         // only pull monday to friday.
+var weekends bool         // only pull saturday and sunday.
+var outsideMask bool      // pull everything except what --hours, --weekdays and --weekends select.
+var cluster bool          // also pull the per-worker logs of a zeek cluster.
+var progressThreshold int // logs over this many MB show their own progress.
+var cacheDir string       // directory to cache logs fetched from remote archives in.
+var cacheSize int         // size in MB the cache is kept under.
+var onChange string       // what to do with a log that changes while read.
+
+// how long to wait for logs delivered late.
+var waitLate time.Duration
+
+// also pull the un-rotated logs of the hour in progress.
+var current bool
+
+// write outputs under partial names and list them in a manifest once complete.
+var writeManifest bool
+
+// format to compress outputs in once finished, or none if empty.
+var compress string
+
+// format to compress every output in as it is written instead, or none if empty, and the
+// level to compress at, 0 for the default of the format.
+var compressOutput string
+var compressLevel int
+
+// directory of the zstd dictionaries trained for each log type, and whether to not use them.
+var dictionaryDir string
+var noDictionary bool
 
 // calculated start time and end time values
 var startTime time.Time
@@ -29,31 +74,105 @@ var endTime time.Time
 
 // global vars
 var debugLog *log.Logger
-var runtimeConfig *viper.Viper
 
 // other
 var taskCount int // hold count of goroutines to wait on
 
+// where command output (as opposed to messages) is written, such as results with --stdout.
+// messages go to the command's configured output, which is stderr.
+var dataOut io.Writer = os.Stdout
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "nagini",
 	Short: "Pull and filter logs to a subset for easier parsing.",
 	Long:  `Pull and filter logs to a subset for easier parsing.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	// errors are printed once by Execute, and are about input rather than usage.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		// set up logger based on verbosity
 		if verbose == true {
-			debugLog = log.New(os.Stderr, "", log.LstdFlags)
+			debugLog = log.New(cmd.ErrOrStderr(), "", log.LstdFlags)
 		} else {
 			debugLog = log.New(io.Discard, "", 0)
 		}
 
+		// switch message language if requested
+		if e := lib.SetLanguage(lang); e != nil {
+			return errors.New(lib.T("error.language", lang, strings.Join(lib.SupportedLanguages(), ", ")))
+		}
+
+		// --month is shorthand for the time range of a whole month.
+		if month != "" {
+			if cmd.Flags().Changed("timerange") {
+				return errors.New(lib.T("error.monthrange"))
+			}
+			cmd.Flags().Set("timerange", month+"/*")
+		}
+
+		// --compress-output given without a format takes the next word as an argument, so
+		// --compress-output zstd would compress with gzip and hand zstd to the filter.
+		if cmd.Flags().Changed("compress-output") && compressOutput == lib.CompressGzip {
+			for _, arg := range args {
+				if oneOf(arg, lib.OutputCompressions()) {
+					return errors.New(lib.T("error.compressoutput.arg", arg))
+				}
+			}
+		}
+		return loadTaskManifest(cmd)
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	e := rootCmd.Execute()
+	removeInlineScripts()
+	cobra.CheckErr(e)
+}
+
+// ExecuteWith runs nagini with the given arguments, reading prompts from stdin, writing
+// command output to stdout and messages to stderr, and returns any error rather than exiting.
+// Flags are reset to their defaults first, so it can be called repeatedly, such as from tests.
+func ExecuteWith(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	rootCmd.SetIn(stdin)
+	rootCmd.SetOut(stderr)
+	rootCmd.SetErr(stderr)
+	dataOut = stdout
+	defer func() {
+		rootCmd.SetIn(os.Stdin)
+		rootCmd.SetOut(os.Stderr)
+		rootCmd.SetErr(os.Stderr)
+		dataOut = os.Stdout
+		removeInlineScripts()
+	}()
+	return rootCmd.Execute()
+}
+
+// sets every flag of the given command and its subcommands back to its default value.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		// slice flags append on Set, so they have to be replaced with their default values,
+		// written as [a,b], rather than set.
+		if sliceValue, ok := f.Value.(pflag.SliceValue); ok {
+			var values []string
+			if defaults := strings.Trim(f.DefValue, "[]"); defaults != "" {
+				values = strings.Split(defaults, ",")
+			}
+			sliceValue.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
 }
 
 func init() {
@@ -63,32 +182,175 @@ func init() {
 
 	rootCmd.SetOut(os.Stderr)
 	// read flags
-	// Set up global configuration path.
-	globalConfig := lib.ReadGlobalConfig()
+	// Set up global configuration path. Messages printed while reading the config
+	// can only use the language from the environment.
+	lib.SetLanguage(lib.DetectLanguage(""))
+	globalConfig, globalSources, e := lib.ReadGlobalConfig()
+	if _, ok := e.(viper.ConfigFileNotFoundError); ok {
+		// a container is configured with environment variables rather than a config file.
+		if !lib.InContainer() {
+			fmt.Fprintln(os.Stderr, lib.T("config.notfound"))
+		}
+	} else if e != nil {
+		fmt.Fprintln(os.Stderr, "error:", e)
+		os.Exit(1)
+	}
+	lib.SetLanguage(lib.DetectLanguage(globalConfig.Language))
+	flagSources["threads"] = globalSources["default_thread_count"]
+	flagSources["logdir"] = globalSources["zeek_log_dir"]
+	flagSources["concat"] = globalSources["concat_by_default"]
+	flagSources["cluster"] = globalSources["cluster_logs"]
+	flagSources["progress-threshold"] = globalSources["progress_threshold_mb"]
+	flagSources["cache-dir"] = globalSources["cache_dir"]
+	flagSources["cache-size"] = globalSources["cache_size_mb"]
+	flagSources["lang"] = globalSources["language"]
+	flagSources["playbook-dir"] = globalSources["playbook_dir"]
+	flagSources["outdir"] = globalSources["output_dir"]
+	flagSources["compress-output"] = globalSources["compress_output"]
+	flagSources["compress-level"] = globalSources["compress_level"]
+	flagSources["max-input-size"] = globalSources["max_input_size"]
+	ticketWebhook, ticketToken = globalConfig.TicketWebhook, globalConfig.TicketToken
+	lineageURL, lineageToken, lineageNamespace = globalConfig.LineageURL, globalConfig.LineageToken, globalConfig.LineageNamespace
+	s3Client = lib.S3Client{Endpoint: globalConfig.S3Endpoint, Region: globalConfig.S3Region, AccessKeyID: globalConfig.S3AccessKeyID, SecretAccessKey: globalConfig.S3SecretAccessKey}
+	sensors = globalConfig.Sensors
+	logTypes = lib.KnownLogTypes(globalConfig.LogTypes)
+	siteFilters = globalConfig.SiteFilters
+	outputRoots, deniedOutputRoots = globalConfig.OutputRoots, globalConfig.DeniedOutputRoots
+	retention = globalConfig.Retention
+	fileExtractCommand = globalConfig.FileExtractCommand
+	historyFile = globalConfig.HistoryFile
+	dictionaryDir = globalConfig.DictionaryDir
+	outputParent = lib.DefaultOutputParent(globalConfig.OutputDir)
 
 	// threads
-	rootCmd.PersistentFlags().IntVarP(&threads, "threads", "t", globalConfig.GetInt("default_thread_count"), "Number of threads to run in parallel")
+	rootCmd.PersistentFlags().IntVarP(&threads, "threads", "t", globalConfig.DefaultThreadCount, "Number of threads to run in parallel")
 
 	// default zeek dir
 	rootCmd.PersistentFlags().StringVarP(&logDir, "logdir", "i",
-		globalConfig.GetString("zeek_log_dir"),
-		"Zeek log directory",
+		globalConfig.ZeekLogDir,
+		"Zeek log directory, or an sftp://, http:// or https:// URL of one",
 	)
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 
+	rootCmd.PersistentFlags().StringVar(&lang, "lang",
+		lib.Language(),
+		fmt.Sprintf("language for messages and prompts. One of: %s", strings.Join(lib.SupportedLanguages(), ", ")),
+	)
+
 	rootCmd.PersistentFlags().BoolVarP(&singleFile, "concat", "c",
-		globalConfig.GetBool("concat_by_default"),
+		globalConfig.ConcatByDefault,
 		"concat all output to one file, rather than files for each date.",
 	)
-	rootCmd.PersistentFlags().BoolVarP(&noConfirm, "noconfirm", "N",
+	rootCmd.PersistentFlags().BoolVar(&writeManifest, "manifest",
+		false,
+		"write each output file under a hidden partial name, rename it into place once complete, and only then list it in manifest.jsonl in the output directory, for shippers such as Filebeat or Vector to read.",
+	)
+	rootCmd.PersistentFlags().StringVar(&compress, "compress",
+		"",
+		fmt.Sprintf("compress each output file once finished, while the rest of the pull runs. One of: %s. zstd needs the zstd command.", strings.Join(lib.Compressions(), ", ")),
+	)
+	rootCmd.PersistentFlags().StringVar(&compressOutput, "compress-output",
+		globalConfig.CompressOutput,
+		fmt.Sprintf("with run, play and backfill, compress every output as it is written instead, down to the temp files of each log, so none is ever written uncompressed, with the extension of the format added to their names. Given without a value, gzip, so a format is given as --compress-output=zstd. One of: %s. zstd needs the zstd command.", strings.Join(lib.OutputCompressions(), ", ")),
+	)
+	rootCmd.PersistentFlags().Lookup("compress-output").NoOptDefVal = lib.CompressGzip
+	rootCmd.PersistentFlags().IntVar(&compressLevel, "compress-level",
+		globalConfig.CompressLevel,
+		"level --compress-output compresses at, from 1, the fastest, to 9 for gzip or 19 for zstd. 0 for the default of the format.",
+	)
+	rootCmd.PersistentFlags().BoolVar(&noDictionary, "no-dictionary",
 		false,
-		"Skip confirmation and begin operation.",
+		"with --compress zstd, do not compress with the dictionary trained for the log type by nagini dictionary train.",
+	)
+	// a container has no one to answer a prompt.
+	rootCmd.PersistentFlags().BoolVarP(&noConfirm, "noconfirm", "N",
+		lib.InContainer(),
+		"Skip confirmation and begin operation. The default when running in a container.",
 	)
 	rootCmd.PersistentFlags().BoolVarP(&writeStdout, "stdout", "S",
 		false,
 		"Do not write to output directory, instead write to STDOUT.",
 	)
+	rootCmd.PersistentFlags().StringVar(&order, "order",
+		lib.OrderOldestFirst,
+		fmt.Sprintf("order to pull dates in, %s or %s. Newest first finishes the most recent dates first.", lib.OrderOldestFirst, lib.OrderNewestFirst),
+	)
+	rootCmd.PersistentFlags().BoolVar(&verifyChecksums, "verify-checksums",
+		false,
+		"check each log against its .sha256 sidecar before filtering it, and list mismatches in the report.",
+	)
+	rootCmd.PersistentFlags().BoolVar(&verifyAccess, "verify-access",
+		false,
+		"instead of pulling, check that every date directory and log of the time range can be read, and list those that cannot, such as logs owned by another user. Fails if any cannot be read.",
+	)
+	rootCmd.PersistentFlags().StringVar(&maxInputSize, "max-input-size",
+		globalConfig.MaxInputSize,
+		"refuse, before it starts, a pull whose logs add up to more than this size, such as 500G, to keep an accidental pull of a whole year off shared sensors. Logs in tar containers are counted by their whole container, and remote logs are not counted.",
+	)
+	rootCmd.PersistentFlags().BoolVar(&force, "force",
+		false,
+		"pull even if the logs are over --max-input-size, with a warning.",
+	)
+	rootCmd.PersistentFlags().StringVar(&hours, "hours",
+		"",
+		"only pull these hours of each day, from the first up to the second. Wraps past midnight, so 18-08 is overnight. Format: HH-HH",
+	)
+	rootCmd.PersistentFlags().BoolVar(&weekdays, "weekdays", false, "only pull monday to friday.")
+	rootCmd.PersistentFlags().BoolVar(&weekends, "weekends", false, "only pull saturday and sunday.")
+	rootCmd.PersistentFlags().BoolVar(&outsideMask, "outside-mask",
+		false,
+		"pull every hour except those selected by --hours, --weekdays and --weekends, such as off-hours.",
+	)
+	rootCmd.PersistentFlags().StringVar(&modifiedSince, "modified-since",
+		"",
+		"only pull logs modified at or after this time, whatever their date directory. Format: YYYY/MM/DD:HH (local time)",
+	)
+	rootCmd.PersistentFlags().StringVar(&modifiedBefore, "modified-before",
+		"",
+		"only pull logs modified before this time, whatever their date directory. Format: YYYY/MM/DD:HH (local time)",
+	)
+	rootCmd.PersistentFlags().StringVar(&fileTime, "file-time",
+		"mtime",
+		"file time compared by --modified-since and --modified-before: mtime, or ctime for when the file was last written or restored.",
+	)
+	rootCmd.PersistentFlags().BoolVar(&cluster, "cluster",
+		globalConfig.ClusterLogs,
+		"also pull the per-worker logs of a zeek cluster, named worker.type.hour or in a directory per worker, merging every worker's logs of an hour.",
+	)
+	rootCmd.PersistentFlags().StringVar(&onChange, "on-change",
+		lib.ChangeFlag,
+		"when the time range includes now, logs that change while read are listed in the report (flag), or read again once (reprocess). Logs that appear after the pull starts are left out, unless --wait-late is given.",
+	)
+	rootCmd.PersistentFlags().DurationVar(&waitLate, "wait-late",
+		0,
+		"after the first pass over the logs, watch the date directories this long, such as 30m, for logs delivered late (such as by a sensor catching up) and pull them before finishing each date.",
+	)
+	rootCmd.PersistentFlags().BoolVar(&current, "current",
+		false,
+		"when the time range includes the hour in progress, also pull its logs not yet rotated out of the current directory, from a copy of each taken when the hour is reached, without a record still being written.",
+	)
+	rootCmd.PersistentFlags().IntVar(&progressThreshold, "progress-threshold",
+		globalConfig.ProgressThresholdMB,
+		"logs larger than this many MB show how much of them has been read after the task bar, so a huge log does not look hung. 0 to turn off.",
+	)
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir",
+		globalConfig.CacheDir,
+		"directory to cache logs fetched from a remote log directory (sftp://[user@]host[:port]/path) in.",
+	)
+	rootCmd.PersistentFlags().IntVar(&cacheSize, "cache-size",
+		globalConfig.CacheSizeMB,
+		"size in MB the cache of remote logs is kept under, by removing the logs used least recently.",
+	)
+	rootCmd.PersistentFlags().BoolVar(&showSources, "show-config-sources",
+		false,
+		"list every effective setting and where it came from (flag, playbook, environment, user config, system config, default), then stop.",
+	)
+
+	playbookCmd.PersistentFlags().StringVar(&playbookDir, "playbook-dir",
+		globalConfig.PlaybookDir,
+		"directory of the shared playbook library, optionally a git checkout.",
+	)
 
 	// time range to parse
 	rootCmd.PersistentFlags().StringVarP(
@@ -97,12 +359,16 @@ func init() {
 			"%s-%s",
 			time.Now().AddDate(0, 0, -1).Format(lib.TimeFormatShort), // yesterday at this time
 			time.Now().Format(lib.TimeFormatShort)),                  // right now
-		"time-range (local time). unspecified: last 24 hours. Format: YYYY/MM/DD:HH-YYYY/MM/DD:HH",
+		"time-range (local time). unspecified: last 24 hours. Format: YYYY/MM/DD:HH-YYYY/MM/DD:HH, or YYYY/MM/DD:* for a whole day, or YYYY/MM/* for a whole month",
+	)
+	rootCmd.PersistentFlags().StringVar(&month, "month",
+		"",
+		"pull a whole month, same as --timerange YYYY/MM/*. Format: YYYY/MM",
 	)
 
 	// default path for log storage is ./output-DATE
 	// uses this if no path specified.
-	defaultPath, e := filepath.Abs("./output-" + time.Now().Format(lib.TimeFormatLongNum))
+	defaultPath, e := filepath.Abs(filepath.Join(outputParent, "output-"+time.Now().Format(lib.TimeFormatLongNum)))
 	if e != nil {
 		panic("fatal error: could not resolve relative path")
 	}
@@ -16,7 +16,7 @@ limitations under the License.
 package cmd
 
 import (
-	"compress/gzip"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -36,65 +36,801 @@ var runCmd = &cobra.Command{
 	Use:   "run [log type] [command] [args...]",
 	Short: "Parallelize log pull using filter from given command.",
 	Long: `Parallelize log pull using filter from given command. Requires a command that accepts input from stdin, and produces output on stdout.
+With --jq, every record is run through a jq expression in-process instead, and no command is given.
+Several log types, as a comma separated list or with --type, are each pulled over the same time range into a directory of their own in the output directory.
+A log type can also be a glob, such as conn*, or a regular expression between slashes, such as /^(conn|dns)$/, pulling every log type it matches in the time range that way.
 
 Example:
 	nagini run -t 8 rdp grecidr 10.0.0.0/24
+	nagini run dns --jq 'select(.query | test("evil"))'
+	nagini run conn --jq 'select(.service == "ssh")' --unique id.resp_h
+	nagini run dns,http,ssl grep 10.0.0.5
+	nagini run --type dns --type http --jq 'select(.id.orig_h == "10.0.0.5")'
+	nagini run 'conn*' grep 10.0.0.5
 `,
-	Args: cobra.MinimumNArgs(2), // 1 argument: script to run
-	Run: func(cmd *cobra.Command, args []string) {
+	Args: func(cmd *cobra.Command, args []string) error {
+		// 1 argument: log type, then the script to run unless --jq is set. With --type, only the script.
+		if len(runTypes) > 0 {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logTypes, command := runTypes, args
+		if len(logTypes) == 0 {
+			logTypes, command = strings.Split(args[0], ","), args[1:]
+		}
+
 		// parse params and args
-		startTime, endTime, resolvedOutDir, resolvedLogDir, logType, targetCommand, targetCommandArgs := parseRunParams(cmd, args[0], args[1:])
-
-		// list params
-		cmd.Printf("Zeek Log Directory:\t%s\n", logDir)
-		cmd.Printf("Log Type:\t\t%s\n", logType)
-		cmd.Printf("Date Range:\t\t%s - %s\n", startTime.Format(lib.TimeFormatHuman), endTime.Format(lib.TimeFormatHuman))
-		cmd.Printf("Command to run:\t\t%s %s\n", targetCommand, strings.Join(targetCommandArgs, " "))
-		cmd.Printf("Threads:\t\t%d\n", threads)
-		if writeStdout {
-			cmd.Printf("Temp Directory:\t\t%s\n\n", resolvedOutDir)
+		var pulls []pull
+		var e error
+		if len(logTypes) == 1 && !lib.IsLogTypePattern(logTypes[0]) {
+			rc, target, err := parseRunParams(logTypes[0], command)
+			pulls, e = []pull{{rc, target, target.label()}}, err
 		} else {
-			cmd.Printf("Output Directory:\t%s\n\n", resolvedOutDir)
+			pulls, e = parseRunTypes(logTypes, command)
+		}
+		if showSources {
+			printConfigSources(dataOut, runSettings(cmd))
+			return e
+		}
+		if e != nil {
+			return e
 		}
 
-		// prompt if continue
-		if !noConfirm && !lib.WaitForConfirm(cmd) {
-			// if start is no, do not continue
-			return
+		outDir := pulls[0].rc.OutDir
+		if len(pulls) > 1 {
+			outDir = filepath.Dir(outDir)
 		}
+		return runPulls(cmd, args, outDir, pulls, runSettings(cmd))
+	},
+}
 
-		// The response was yes- continue.
+func init() {
+	rootCmd.AddCommand(runCmd)
+	addLimitFlags(runCmd)
+	addFilterFlags(runCmd)
+	addRenderFlags(runCmd)
+	addTaskManifestFlags(runCmd)
+	runCmd.Flags().StringSliceVar(&uniqueFields, "unique", nil, "instead of the records, write the distinct values of these comma separated fields across the time range, such as id.resp_h, with the number of records that had each, most common first. Written to unique.tsv in the output directory, or to stdout with --stdout.")
+	runCmd.Flags().StringSliceVar(&runTypes, "type", nil, "log types to pull, comma separated or given more than once, each into a directory named for it in the output directory. Every arg is then the command to run.")
+	runCmd.Flags().StringVar(&connSummary, "conn-summary", "",
+		fmt.Sprintf("roll up the records of conn logs into a flow per id.orig_h, id.resp_h, id.resp_p and proto, with their conns, bytes, packets and duration summed over the time range, the most bytes first. Written to %s in the output directory alongside the records, or only the summary, instead of the records, to stdout with --stdout. One of: %s.", lib.ConnSummaryFile, strings.Join(lib.ConnSummaryModes(), ", ")))
+	runCmd.Flags().IntVar(&topValues, "top", 0, "with --unique, write only this many of the most common values, counted approximately in bounded memory rather than keeping every distinct value, for huge time ranges. 0 for every value.")
+	runCmd.Flags().StringSliceVar(&hashFields, "hash", nil, "write the values of these comma separated fields as salted hashes, HMAC-SHA256 keyed by --hash-salt, so the counts can be shared without the values. Counts the distinct values of the fields like --unique if it is not set, otherwise hashes those of its fields listed.")
+	runCmd.Flags().StringVar(&hashSalt, "hash-salt", "", fmt.Sprintf("secret salt to hash the values of --hash fields with. Counts hashed with the same salt can be compared with each other. Read from %s if not set, to keep it out of the shell history.", hashSaltEnv))
+}
 
-		// parse the given logs based on the runCommand handler.
-		lib.ParseLogs(cmd,
-			func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
-				runCommand(targetCommand, targetCommandArgs, logFile, outputFile, curTime, wgDate, taskBar)
-			},
-			debugLog, startTime, endTime, logType, resolvedLogDir, resolvedOutDir, threads, singleFile, writeStdout)
+// log types to pull, from --type, instead of the first arg.
+var runTypes []string
 
-		cmd.Printf("\nComplete.")
-		if !writeStdout {
-			cmd.Printf("Output: %s", outputDir)
-		} else {
+// fields to write the distinct values of, instead of records.
+var uniqueFields []string
+
+// number of most common values of uniqueFields to write, 0 for all of them.
+var topValues int
+
+// fields of uniqueFields to write the values of as hashes salted with hashSalt, and the fields
+// to count the values of if uniqueFields is not set.
+var hashFields []string
+
+// salt to hash the values of hashFields with, not listed in the settings of a run.
+var hashSalt string
+
+// environment variable holding the salt of --hash, unless --hash-salt is set.
+const hashSaltEnv = "NAGINI_HASH_SALT"
+
+// how to write the roll-up of conn records into flows, alongside or instead of the records,
+// or not at all if empty.
+var connSummary string
+
+// returns the effective settings of every flag of run.
+func runSettings(cmd *cobra.Command) []setting {
+	return flagSettings(cmd, append(append(append(append(sharedFlags, limitFlags...), renderFlags...), taskManifestFlags...), "jq", "where", "type", "unique", "top", "hash", "conn-summary")...)
+}
+
+// a pull of a log type, with the filter run on its logs and what it is described as.
+type pull struct {
+	rc     lib.RuntimeConfig
+	target filter
+	action string
+}
+
+// runs the pull of rc through target once confirmed, after listing its settings with action
+// describing what is run on each log, then renders a report of it with the given settings.
+func runPull(cmd *cobra.Command, args []string, rc lib.RuntimeConfig, target filter, action string, settings []setting) error {
+	return runPulls(cmd, args, rc.OutDir, []pull{{rc, target, action}}, settings)
+}
+
+// runs each of pulls in turn once confirmed, like runPull, sharing the notices they are
+// correlated with and the listing of their date directories. Renders a single report of them,
+// with outDir as the directory they were written under.
+func runPulls(cmd *cobra.Command, args []string, outDir string, pulls []pull, settings []setting) (e error) {
+	// list params
+	for _, p := range pulls {
+		printRunConfig(cmd, p.rc, p.action+estimateLabel(p.rc, p.target))
+	}
+	var rcs []lib.RuntimeConfig
+	for _, p := range pulls {
+		rcs = append(rcs, p.rc)
+	}
+	if verifyAccess {
+		return verifyPullAccess(cmd, rcs)
+	}
+	if emitManifest != "" {
+		return emitTaskManifest(cmd, pulls[0].rc)
+	}
+	if e = checkInputSize(cmd, rcs); e != nil {
+		return e
+	}
 
+	// prompt if continue
+	if !noConfirm && !lib.WaitForConfirm(cmd) {
+		// if start is no, do not continue
+		return nil
+	}
+
+	// The response was yes- continue.
+
+	report := &lib.RunReport{}
+	notices, e := relatedNotices(cmd, pulls[0].rc, report)
+	if e != nil {
+		return e
+	}
+	listing := lib.NewDirListing()
+	uploader := newUploader(outDir, false)
+	var summaries []lib.PullSummary
+	for _, p := range pulls {
+		uploadDates(uploader, &p.rc)
+		if e = runTypePull(cmd, p, notices, listing, report); e != nil {
+			report.Write(cmd.OutOrStderr())
+			if len(pulls) > 1 {
+				return fmt.Errorf("%s: %w", p.rc.LogType, e)
+			}
+			return e
 		}
-		cmd.Println()
+		if e = writeProvenance(cmd, args, p.rc, p.target.String()); e != nil {
+			return e
+		}
+		summaries = append(summaries, lib.PullSummary{Name: p.rc.LogType, OutDir: p.rc.OutDir})
+	}
 
-		return
-	},
+	cmd.Print(lib.T("run.complete"))
+	if !pulls[0].rc.WriteStdout {
+		cmd.Print(lib.T("run.output", outDir))
+	}
+	cmd.Println()
+	report.Write(cmd.OutOrStderr())
+
+	// the outputs are complete, so they are uploaded even if they cannot be reported on.
+	e = renderSummary(cmd, args, outDir, reportParameters(settings), summaries, report)
+	if uploadErr := finishUpload(cmd, uploader); e == nil {
+		e = uploadErr
+	}
+	return e
 }
 
-func init() {
-	rootCmd.AddCommand(runCmd)
+// checks that the pulls of rcs can read every date directory and log they would, listing
+// those that cannot be read, without pulling. Returns an error if any cannot be read.
+func verifyPullAccess(cmd *cobra.Command, rcs []lib.RuntimeConfig) error {
+	denied := 0
+	for _, rc := range rcs {
+		if lib.IsRemoteLogDir(rc.LogDir) {
+			cmd.Print(lib.T("verify.remote", rc.LogType, rc.LogDir))
+			continue
+		}
+		failures, checked, e := lib.VerifyAccess(rc)
+		if e != nil {
+			return e
+		}
+		for _, failure := range failures {
+			fmt.Fprint(dataOut, lib.T("verify.denied", failure.Path, failure.Err))
+		}
+		cmd.Print(lib.T("verify.checked", rc.LogType, checked, len(failures)))
+		denied += len(failures)
+	}
+	if denied > 0 {
+		return errors.New(lib.T("error.verify", denied))
+	}
+	return nil
+}
+
+// checks that the logs the pulls of rcs read, together, are within --max-input-size, unless
+// --force is given, in which case only a warning is printed. Remote logs cannot be counted
+// before they are fetched, so a warning is printed for them instead.
+func checkInputSize(cmd *cobra.Command, rcs []lib.RuntimeConfig) error {
+	if maxInputBytes == 0 {
+		return nil
+	}
+	var size int64
+	for _, rc := range rcs {
+		if lib.IsRemoteLogDir(rc.LogDir) {
+			cmd.Print(lib.T("warn.maxinput.remote", rc.LogType, rc.LogDir, maxInputSize))
+			continue
+		}
+		rcSize, e := lib.InputSize(rc)
+		if e != nil {
+			return e
+		}
+		size += rcSize
+	}
+	if size <= maxInputBytes {
+		return nil
+	}
+	if force {
+		cmd.Print(lib.T("warn.maxinput", lib.FormatBytes(size), maxInputSize))
+		return nil
+	}
+	return errors.New(lib.T("error.maxinput", lib.FormatBytes(size), maxInputSize))
+}
+
+// runs the pull p, recording into report. Its date directories are looked up in listing, when
+// the logs in them are done being written.
+func runTypePull(cmd *cobra.Command, p pull, notices *lib.NoticeIndex, listing *lib.DirListing, report *lib.RunReport) (e error) {
+	started := time.Now()
+	rc, target := p.rc, p.target
+	run := startLineage(cmd, cmd.Name()+"."+rc.LogType, p.rc, target.String())
+	defer func() { run.end(e) }()
+	target.notices = notices
+	// logs fetched or extracted for this log type were not there when an earlier one was listed.
+	shared := !lib.IsRemoteLogDir(rc.LogDir) && !lib.IncludesNow(rc)
+	if e = fetchLogs(cmd, &rc); e != nil {
+		return e
+	}
+	if shared && rc.ExtractDir == "" {
+		rc.Listing = listing
+	}
+
+	// parse the given logs based on the runCommand handler.
+	limit := lib.NewRecordLimit(rc)
+	rc.Report = report
+	rc.Throttle = lib.NewThrottle(rc.Threads)
+	union, e := normalizedSchema(rc, report)
+	if e != nil {
+		return e
+	}
+	target = target.start()
+	e = lib.ParseLogs(dataOut, cmd.OutOrStderr(),
+		func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+			runCommand(target, limit, report, union, rc.Throttle, logFile, outputFile, curTime, wgDate, taskBar)
+		},
+		debugLog, rc)
+	target.stop(report)
+	if e == nil && target.unique != nil {
+		e = writeUniqueValues(target, rc)
+	}
+	if e == nil && target.summary != nil {
+		e = writeConnSummary(target, rc)
+	}
+	if e == nil && target.hits != nil {
+		e = retrieveFiles(cmd, target, rc)
+	}
+	if e != nil {
+		return e
+	}
+
+	recordHistory(cmd, rc, target, started)
+	return nil
+}
+
+// writes the distinct values counted by f over a pull with rc to stdout if --stdout is set,
+// otherwise to its unique file in the output directory.
+func writeUniqueValues(f filter, rc lib.RuntimeConfig) error {
+	if rc.WriteStdout {
+		return f.unique.WriteCounts(dataOut)
+	}
+	file, e := os.Create(filepath.Join(rc.OutDir, f.uniqueFile))
+	if e != nil {
+		return e
+	}
+	if e = f.unique.WriteCounts(file); e != nil {
+		file.Close()
+		return e
+	}
+	return file.Close()
+}
+
+// writes the flows rolled up by f over a pull with rc to stdout if --stdout is set, otherwise
+// to the conn summary file in the output directory.
+func writeConnSummary(f filter, rc lib.RuntimeConfig) error {
+	if rc.WriteStdout {
+		return f.summary.WriteSummary(dataOut)
+	}
+	file, e := os.Create(filepath.Join(rc.OutDir, lib.ConnSummaryFile))
+	if e != nil {
+		return e
+	}
+	if e = f.summary.WriteSummary(file); e != nil {
+		file.Close()
+		return e
+	}
+	return file.Close()
+}
+
+// applies the flags that choose which logs to pull, and in what order, to rc. Records a
+// problem if they are invalid.
+func applyPullFlags(v *lib.Validator, rc *lib.RuntimeConfig) {
+	// what is written to stdout only passes through a temp directory.
+	if rc.OutDir != "" && !rc.WriteStdout {
+		v.OutputRoot(rc.OutDir, rc.LogDir, outputRoots, deniedOutputRoots)
+	}
+	rc.NewestFirst = v.Order(order)
+	maxInputBytes = v.OptionalByteSize("max-input-size", maxInputSize)
+	rc.Mask = v.TimeMask(hours, weekdays, weekends, outsideMask)
+
+	rc.ModifiedSince = v.OptionalTime("modified-since", modifiedSince)
+	rc.ModifiedBefore = v.OptionalTime("modified-before", modifiedBefore)
+	if !rc.ModifiedSince.IsZero() && !rc.ModifiedBefore.IsZero() && !rc.ModifiedSince.Before(rc.ModifiedBefore) {
+		v.Add(lib.T("error.filetimewindow"))
+	}
+	if fileTime != "mtime" && fileTime != "ctime" {
+		v.Add(lib.T("error.filetimefield", fileTime))
+	}
+	rc.UseCtime = fileTime == "ctime"
+	rc.Cluster = cluster
+	knownChange := false
+	for _, action := range lib.ChangeActions() {
+		knownChange = knownChange || onChange == action
+	}
+	if !knownChange {
+		v.Add(lib.T("error.onchange", onChange, strings.Join(lib.ChangeActions(), ", ")))
+	}
+	rc.OnChange = onChange
+	if waitLate < 0 {
+		v.Add(lib.T("error.waitlate", waitLate))
+	} else if waitLate > 0 && lib.IsRemoteLogDir(rc.LogDir) {
+		v.Add(lib.T("error.waitlate.remote"))
+	}
+	rc.WaitLate = waitLate
+	if current && lib.IsRemoteLogDir(rc.LogDir) {
+		v.Add(lib.T("error.current.remote"))
+	}
+	rc.Current = current
+	rc.ClockOffset = lib.ClockOffsetOf(rc.LogDir, sensors)
+	if writeManifest && writeStdout {
+		v.Add(lib.T("error.manifest.stdout"))
+	}
+	rc.Manifest = writeManifest
+	if compress != "" {
+		knownCompress := false
+		for _, format := range lib.Compressions() {
+			knownCompress = knownCompress || compress == format
+		}
+		if !knownCompress {
+			v.Add(lib.T("error.compress", compress, strings.Join(lib.Compressions(), ", ")))
+		} else if writeStdout {
+			v.Add(lib.T("error.compress.stdout"))
+		} else if compress == lib.CompressZstd {
+			if _, e := exec.LookPath("zstd"); e != nil {
+				v.Add(lib.T("error.compress.zstd"))
+			}
+		}
+	}
+	rc.Compress = compress
+	if !noDictionary {
+		rc.DictionaryDir = dictionaryDir
+	}
+	if cacheSize < 0 {
+		v.Add(lib.T("error.cachesize", cacheSize))
+	}
+}
+
+// fetches the logs a pull with rc would read into the cache, if its log directory is on
+// another host, and points rc at the cache instead. The logs it would read from the tar
+// containers of its dates are then extracted into the cache, and rc is pointed at them too.
+func fetchLogs(cmd *cobra.Command, rc *lib.RuntimeConfig) error {
+	dir, e := filepath.Abs(cacheDir)
+	if e != nil {
+		return e
+	}
+	cache := lib.LogCache{Dir: dir, MaxBytes: int64(cacheSize) << 20}
+	if lib.IsRemoteLogDir(rc.LogDir) {
+		remote, e := lib.ParseRemoteArchive(rc.LogDir)
+		if e != nil {
+			return e
+		}
+		localDir, e := lib.FetchRemoteLogs(*rc, remote, cache, cmd.OutOrStderr())
+		if e != nil {
+			return fmt.Errorf("could not fetch logs from %s: %w", remote, e)
+		}
+		rc.LogDir = localDir
+	}
+	extractDir, e := lib.ExtractTarLogs(*rc, cache, cmd.OutOrStderr())
+	if e != nil {
+		return e
+	}
+	if extractDir != "" {
+		rc.ExtractDir = extractDir
+		sensors = lib.ExtractedSensors(sensors, rc.LogDir, extractDir)
+	}
+	return nil
+}
+
+// early-stop args, for commands that filter with a command.
+var maxRecords int        // stop after this many records in total
+var firstMatchPerDay bool // stop each day after its first record
+
+// corrupt input args, for commands that decompress logs for a command.
+var skipCorrupt bool   // record corrupt logs and carry on. The default.
+var failOnCorrupt bool // fail the pull if any log is corrupt.
+
+// provenance, schema, format and stall args, for commands that filter with a command.
+var tagSensor bool             // add the sensor of each log to its records.
+var correctTS bool             // correct the ts of records for the clock offset of their sensor.
+var normalizeSchema bool       // rewrite every TSV record with the union of the fields of the pulled logs.
+var outputFormat string        // format to write records in, json or msgpack.
+var fieldOrder string          // order to write the fields of records in: source, alphabetical or a list of fields.
+var stallTimeout time.Duration // warn about a filter idle for this long, 0 to never.
+var stallAction string         // what to do with a stalled filter: warn, kill or retry.
+var batch bool                 // feed logs one after another to a long-lived filter per thread.
+var batchDelimiter string      // line written to a batch filter between logs.
+var correlateNotices bool      // annotate records with the notices and intel hits related to them.
+var stageBuffer int            // size in KB of the buffers handed between the stages of a task.
+var readAhead int              // buffers of each log decompressed ahead of its filter.
+var noSiteFilters bool         // keep the records the site filters of the global config drop.
+
+// sensors from the global config, set in root.
+var sensors []lib.SensorConfig
+
+// fields of each known log type, from the global config, set in root.
+var logTypes lib.LogTypes
+
+// conditions of the records of each log type to drop before any filter, from the global
+// config, set in root.
+var siteFilters map[string][]string
+
+// directories outputs may only be written under, if any, and may not be written under, from
+// the global config, set in root.
+var outputRoots, deniedOutputRoots []string
+
+// parsed --field-order, set by applyLimitFlags.
+var outputFieldOrder lib.FieldOrder
+
+// flags that stop a pull early, decide how to handle corrupt logs, stalled filters or tag records, listed by --show-config-sources.
+var limitFlags = []string{"max-records", "stop-after-first-match-per-day", "skip-corrupt", "fail-on-corrupt", "tag-sensor", "correct-ts", "normalize-schema", "output-format", "compress-output", "compress-level", "field-order", "stall-timeout", "stall-action", "batch", "batch-delimiter", "correlate-notices", "stage-buffer", "read-ahead", "no-site-filters"}
+
+// adds the flags that stop a pull early, decide how to handle corrupt logs, stalled filters or tag records, to the given command.
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&maxRecords, "max-records", 0, "stop once this many records have been found in total. 0 for no limit.")
+	cmd.Flags().BoolVar(&firstMatchPerDay, "stop-after-first-match-per-day", false, "stop each day once a single record has been found in it.")
+	cmd.Flags().BoolVar(&skipCorrupt, "skip-corrupt", false, "list logs that cannot be decompressed in the report and carry on without them. The default.")
+	cmd.Flags().BoolVar(&failOnCorrupt, "fail-on-corrupt", false, "fail, before writing final output, if any log cannot be decompressed.")
+	cmd.Flags().BoolVar(&tagSensor, "tag-sensor", false, "add a sensor field (and site, if configured) to every record, from the sensors in the config file, the cluster worker or the log directory.")
+	cmd.Flags().BoolVar(&correctTS, "correct-ts", false, "take the clock_offset of the sensor of each log in the config file off the ts of its records, before any filter, so they are in true time. Its logs are read by their offset hours either way.")
+	cmd.Flags().BoolVar(&normalizeSchema, "normalize-schema", false, "when the fields of TSV logs change across the time range, such as after a zeek upgrade, write every record with the union of the fields, leaving missing ones unset.")
+	cmd.Flags().DurationVar(&stallTimeout, "stall-timeout", 0, "warn about any filter that neither reads input nor writes output for this long, such as 10m, with the state of its process. 0 to never.")
+	cmd.Flags().StringVar(&stallAction, "stall-action", lib.StallWarn,
+		fmt.Sprintf("what to do with a stalled filter: only warn, kill it keeping its output so far, or kill it and retry the log once. One of: %s", strings.Join(lib.StallActions(), ", ")))
+	cmd.Flags().BoolVar(&batch, "batch", false, "keep a filter running per thread and feed it one log after another over stdin, for filters that are slow to start. After each log a --batch-delimiter line is written, which the filter must write back once done with the log.")
+	cmd.Flags().StringVar(&batchDelimiter, "batch-delimiter", lib.DefaultBatchDelimiter, "line written to a --batch filter after each log, and expected back from it.")
+	cmd.Flags().StringVar(&outputFormat, "output-format", lib.OutputJSON,
+		fmt.Sprintf("format to write records in. msgpack writes each record as a MessagePack map, which is smaller and faster to load than json. parquet writes the records of each log type and date to a Parquet file under log_type=<type>/date=<date>/, for Spark, Athena or DuckDB. One of: %s", strings.Join(lib.OutputFormats(), ", ")))
+	cmd.Flags().StringVar(&fieldOrder, "field-order", lib.FieldOrderSource,
+		"order to write the fields of json records (and the columns of tsv records) in, so output can be diffed between runs: source, alphabetical, or a comma separated list of fields to write first, such as ts,uid,id.orig_h, followed by the rest.")
+	cmd.Flags().BoolVar(&correlateNotices, "correlate-notices", false, "also read the notice and intel logs of the time range, and add a related_notices field to every record sharing the uid of a notice or intel hit, or holding the indicator of an intel hit.")
+	cmd.Flags().IntVar(&stageBuffer, "stage-buffer", lib.DefaultPipeline.BufferSize>>10, "size in KB of the buffers each task hands from decompressing a log to its filter, and from the filter to writing its output. Larger buffers suit fast local disks.")
+	cmd.Flags().IntVar(&readAhead, "read-ahead", lib.DefaultPipeline.ReadAhead, "buffers of each log decompressed ahead of its filter, so neither waits on the other. More help with slow or network disks, at the cost of memory per thread. 0 to only decompress as the filter reads.")
+	cmd.Flags().BoolVar(&noSiteFilters, "no-site-filters", false, "keep the records that the site_filters of the config file drop from the log type before any filter, such as lookups of checkup domains.")
+}
+
+// applies the early-stop and corrupt input flags to rc, recording a problem if they are invalid.
+func applyLimitFlags(v *lib.Validator, rc *lib.RuntimeConfig) {
+	if maxRecords < 0 {
+		v.Add(lib.T("error.maxrecords", maxRecords))
+	}
+	if skipCorrupt && failOnCorrupt {
+		v.Add(lib.T("error.corruptflags"))
+	}
+	known := false
+	for _, format := range lib.OutputFormats() {
+		known = known || outputFormat == format
+	}
+	if !known {
+		v.Add(lib.T("error.outputformat", outputFormat, strings.Join(lib.OutputFormats(), ", ")))
+	} else if outputFormat == lib.OutputParquet {
+		// parquet files are written per date, and compressed by page.
+		flags := []string{"concat", "stdout", "compress", "compress-output"}
+		for i, set := range []bool{singleFile, writeStdout, compress != "", compressOutput != ""} {
+			if set {
+				v.Add(lib.T("error.outputformat.parquet", flags[i]))
+			}
+		}
+	}
+	if compressOutput != "" && !oneOf(compressOutput, lib.OutputCompressions()) {
+		v.Add(lib.T("error.compressoutput", compressOutput, strings.Join(lib.OutputCompressions(), ", ")))
+	} else if compressOutput != "" && compress != "" {
+		v.Add(lib.T("error.compressoutput.compress"))
+	} else if compressOutput != "" && (compressLevel < 0 || compressLevel > lib.MaxCompressLevel(compressOutput)) {
+		v.Add(lib.T("error.compresslevel", compressLevel, compressOutput, lib.MaxCompressLevel(compressOutput)))
+	} else if compressOutput == lib.CompressZstd {
+		if _, e := exec.LookPath("zstd"); e != nil {
+			v.Add(lib.T("error.compressoutput.zstd"))
+		}
+	}
+	lib.SetCompressLevel(compressLevel)
+	var e error
+	if outputFieldOrder, e = lib.ParseFieldOrder(fieldOrder); e != nil {
+		v.AddErr(e)
+	} else if !outputFieldOrder.Source() && outputFormat == lib.OutputMsgpack {
+		v.Add(lib.T("error.fieldorder.msgpack"))
+	}
+	if stallTimeout < 0 {
+		v.Add(lib.T("error.stalltimeout", stallTimeout))
+	}
+	known = false
+	for _, action := range lib.StallActions() {
+		known = known || stallAction == action
+	}
+	if !known {
+		v.Add(lib.T("error.stallaction", stallAction, strings.Join(lib.StallActions(), ", ")))
+	}
+	if batch && batchDelimiter == "" {
+		v.Add(lib.T("error.batchdelimiter"))
+	}
+	if stageBuffer < 1 {
+		v.Add(lib.T("error.stagebuffer", stageBuffer))
+	}
+	if readAhead < 0 {
+		v.Add(lib.T("error.readahead", readAhead))
+	}
+	if stageBuffer >= 1 && readAhead >= 0 {
+		lib.SetPipeline(lib.PipelineConfig{BufferSize: stageBuffer << 10, ReadAhead: readAhead})
+	}
+	rc.MaxRecords = maxRecords
+	rc.FirstMatchPerDay = firstMatchPerDay
+	rc.FailOnCorrupt = failOnCorrupt
+	rc.OutputFormat = outputFormat
+	rc.CompressOutput = compressOutput
+}
+
+// returns the schema to normalize every record of a pull with rc to, if --normalize-schema is
+// set, and notes it in report. Returns an empty schema otherwise.
+func normalizedSchema(rc lib.RuntimeConfig, report *lib.RunReport) (union lib.Schema, e error) {
+	if !normalizeSchema {
+		return union, nil
+	}
+	union, e = lib.ScanSchemas(rc)
+	if e != nil {
+		return union, errors.New(lib.T("error.schemascan", e))
+	}
+	report.SchemaNormalized = !union.Empty()
+	return union, nil
+}
+
+// returns the notices and intel hits of the time range of rc to annotate its records with, if
+// --correlate-notices is set, fetching their logs like those of the pull. Corrupt logs are
+// recorded in report. Returns nil otherwise.
+func relatedNotices(cmd *cobra.Command, rc lib.RuntimeConfig, report *lib.RunReport) (*lib.NoticeIndex, error) {
+	if !correlateNotices {
+		return nil, nil
+	}
+	noticeRC := rc
+	for _, logType := range []string{"notice", "intel"} {
+		typeRC := rc
+		typeRC.LogType = logType
+		if e := fetchLogs(cmd, &typeRC); e != nil {
+			return nil, errors.New(lib.T("error.notices", e))
+		}
+		noticeRC.LogDir, noticeRC.ExtractDir = typeRC.LogDir, typeRC.ExtractDir
+	}
+	noticeRC.Report = report
+	index, e := lib.LoadNotices(noticeRC)
+	if e != nil {
+		return nil, errors.New(lib.T("error.notices", e))
+	}
+	cmd.Print(lib.T("notices.loaded", index.Notices))
+	return index, nil
+}
+
+// flags shared by every pull, listed by --show-config-sources.
+var sharedFlags = []string{"timerange", "logdir", "outdir", "threads", "order", "hours", "weekdays", "weekends", "outside-mask", "modified-since", "modified-before", "file-time", "cluster", "on-change", "wait-late", "current", "verify-checksums", "verify-access", "max-input-size", "force", "progress-threshold", "cache-dir", "cache-size", "concat", "manifest", "compress", "no-dictionary", "stdout", "lang"}
+
+// prints the settings of a pull before asking to continue. action describes what will be
+// run on each log file, such as the command and its args.
+func printRunConfig(cmd *cobra.Command, rc lib.RuntimeConfig, action string) {
+	cmd.Print(lib.T("label.logdir", rc.LogDir))
+	cmd.Print(lib.T("label.logtype", rc.LogType))
+	cmd.Print(lib.T("label.range", rc.StartTime.Format(lib.TimeFormatHuman), rc.EndTime.Format(lib.TimeFormatHuman)))
+	cmd.Print(action)
+	if rc.MaxRecords > 0 {
+		cmd.Print(lib.T("label.maxrecords", rc.MaxRecords))
+	}
+	if rc.FirstMatchPerDay {
+		cmd.Print(lib.T("label.firstmatch"))
+	}
+	if rc.NewestFirst {
+		cmd.Print(lib.T("label.newestfirst"))
+	}
+	if rc.Mask != nil {
+		cmd.Print(lib.T("label.mask", rc.Mask))
+	}
+	if rc.ClockOffset != 0 {
+		cmd.Print(lib.T("label.clockoffset", rc.ClockOffset))
+	}
+	if rc.Cluster {
+		cmd.Print(lib.T("label.cluster"))
+	}
+	if !rc.ModifiedSince.IsZero() || !rc.ModifiedBefore.IsZero() {
+		since, before := "*", "*"
+		if !rc.ModifiedSince.IsZero() {
+			since = rc.ModifiedSince.Format(lib.TimeFormatHuman)
+		}
+		if !rc.ModifiedBefore.IsZero() {
+			before = rc.ModifiedBefore.Format(lib.TimeFormatHuman)
+		}
+		cmd.Print(lib.T("label.filetime", fileTime, since, before))
+	}
+	cmd.Print(lib.T("label.threads", rc.Threads))
+	if rc.WriteStdout {
+		cmd.Print(lib.T("label.tempdir", rc.OutDir))
+	} else {
+		cmd.Print(lib.T("label.outdir", rc.OutDir))
+	}
 }
 
 // takes args and params, does error checking, and then produces useful variables.
-func parseRunParams(cmd *cobra.Command, logTypeArg string, commandToRun []string) (startTime time.Time, endTime time.Time, resolvedOutDir string, resolvedLogDir string, logType string, execPath string, execArgs []string) {
-	startTime, endTime, resolvedOutDir, resolvedLogDir, logType = lib.ParseSharedArgs(cmd, timeRange, logDir, outputDir, logTypeArg)
+// returns a *lib.ValidationError holding every problem found, if any.
+func parseRunParams(logTypeArg string, commandToRun []string) (rc lib.RuntimeConfig, f filter, e error) {
+	var v lib.Validator
+	rc = lib.GenRuntimeConfig(&v, timeRange, logDir, outputDir, logTypeArg, threads, singleFile, writeStdout)
+	applyPullFlags(&v, &rc)
+	applyLimitFlags(&v, &rc)
+	applyRenderFlags(&v, writeStdout)
+	applyTaskManifestFlags(&v, &rc)
+	f = parseTypeFilter(&v, rc.LogType, scriptCommand(&v, commandToRun))
+	validateTop(&v)
+	validateConnSummary(&v)
+
+	// report every problem at once, before asking to continue.
+	return rc, f, v.Err()
+}
+
+// like parseRunParams, for a pull of each of logTypes over the same time range into a directory
+// named for it in the output directory. Patterns among logTypes are replaced by the log types
+// they match.
+func parseRunTypes(logTypes []string, commandToRun []string) (pulls []pull, e error) {
+	var v lib.Validator
+	if writeStdout {
+		v.Add(lib.T("error.types.stdout"))
+	}
+	base := lib.GenRuntimeConfig(&v, timeRange, logDir, outputDir, "", threads, singleFile, false)
+	applyPullFlags(&v, &base)
+	applyLimitFlags(&v, &base)
+	applyRenderFlags(&v, false)
+	applyTaskManifestFlags(&v, &base)
+	validateTop(&v)
+	validateConnSummary(&v)
+	commandToRun = scriptCommand(&v, commandToRun)
+	seen := make(map[string]bool)
+	for _, logType := range expandLogTypes(&v, base, logTypes) {
+		if seen[logType] {
+			v.Add(lib.T("error.types.duplicate", logType))
+			continue
+		}
+		seen[logType] = true
+		rc := base
+		rc.LogType, rc.OutDir = logType, filepath.Join(base.OutDir, logType)
+		v.LogType(rc.LogType, rc.LogDir, rc.StartTime, rc.EndTime)
+		f := parseTypeFilter(&v, logType, commandToRun)
+		pulls = append(pulls, pull{rc, f, f.label()})
+	}
+
+	// report every problem at once, before asking to continue.
+	return pulls, v.Err()
+}
+
+// returns logTypes with each pattern among them replaced by the log types it matches over the
+// time range of rc, leaving out those already given. Records a problem if a pattern is
+// malformed or matches none.
+func expandLogTypes(v *lib.Validator, rc lib.RuntimeConfig, logTypes []string) (expanded []string) {
+	given := make(map[string]bool)
+	for _, logType := range logTypes {
+		given[logType] = !lib.IsLogTypePattern(logType)
+	}
+	for _, logType := range logTypes {
+		if !lib.IsLogTypePattern(logType) {
+			expanded = append(expanded, logType)
+			continue
+		}
+		// the time range or log directory are no use to match against.
+		if v.Failed() {
+			continue
+		}
+		if lib.IsRemoteLogDir(rc.LogDir) {
+			v.Add(lib.T("error.logtype.remote", logType))
+			continue
+		}
+		matched, e := lib.MatchLogTypes(rc, logType)
+		if e != nil {
+			v.AddErr(e)
+		}
+		for _, match := range matched {
+			if !given[match] {
+				given[match] = true
+				expanded = append(expanded, match)
+			}
+		}
+	}
+	return expanded
+}
 
+// returns the filter of a pull of logType through commandToRun, recording any problem in v.
+func parseTypeFilter(v *lib.Validator, logType string, commandToRun []string) (f filter) {
+	f = newFilter(v, logType, commandToRun, jqExpr, whereExpr)
+	if fields := countedFields(); len(fields) > 0 {
+		v.Fields(logType, fields, logTypes)
+		f.unique, f.uniqueFile = lib.NewUniqueValues(fields), "unique.tsv"
+		f.unique.Top = topValues
+		f.unique.HashFields, f.unique.Salt = hashFields, resolvedHashSalt()
+	}
+	if connSummary != "" {
+		if logType != "conn" {
+			v.Add(lib.T("error.connsummary.conn", logType))
+		}
+		f.summary, f.summaryOnly = lib.NewConnSummary(), connSummary == lib.ConnSummaryOnly
+	}
+	return f
+}
+
+// returns the fields to count the distinct values of: those of --unique, otherwise those of
+// --hash.
+func countedFields() []string {
+	if len(uniqueFields) > 0 {
+		return uniqueFields
+	}
+	return hashFields
+}
+
+// returns the salt of --hash, from --hash-salt or the environment.
+func resolvedHashSalt() string {
+	if hashSalt != "" {
+		return hashSalt
+	}
+	return os.Getenv(hashSaltEnv)
+}
+
+// checks --top against --unique, and --hash against its salt and the fields counted.
+func validateTop(v *lib.Validator) {
+	if topValues < 0 {
+		v.Add(lib.T("error.top", topValues))
+	} else if topValues > 0 && len(countedFields()) == 0 {
+		v.Add(lib.T("error.top.unique"))
+	}
+	if len(hashFields) == 0 {
+		return
+	}
+	if resolvedHashSalt() == "" {
+		v.Add(lib.T("error.hash.salt", hashSaltEnv))
+	}
+	for _, field := range hashFields {
+		if !oneOf(field, countedFields()) {
+			v.Add(lib.T("error.hash.unique", field))
+		}
+	}
+}
+
+// checks --conn-summary, and that what it writes has somewhere to go.
+func validateConnSummary(v *lib.Validator) {
+	known := connSummary == ""
+	for _, mode := range lib.ConnSummaryModes() {
+		known = known || connSummary == mode
+	}
+	switch {
+	case !known:
+		v.Add(lib.T("error.connsummary", connSummary, strings.Join(lib.ConnSummaryModes(), ", ")))
+	case connSummary != "" && len(countedFields()) > 0:
+		v.Add(lib.T("error.connsummary.unique"))
+	case connSummary == lib.ConnSummaryAlongside && writeStdout:
+		v.Add(lib.T("error.connsummary.stdout"))
+	}
+}
+
+// finds the executable for the given command, preferring a local file over one in PATH.
+// records a problem in the validator if no executable can be found.
+func resolveCommand(v *lib.Validator, command string) (execPath string) {
 	lookInPath := false
 	// try to resolve script, see if it exists.
-	localExecPath, e1 := filepath.Abs(commandToRun[0])
+	localExecPath, e1 := filepath.Abs(command)
 	_, e2 := os.Stat(localExecPath)
 	if e1 != nil || e2 != nil {
 		// could not find local file, so look for it in path
@@ -113,20 +849,21 @@ func parseRunParams(cmd *cobra.Command, logTypeArg string, commandToRun []string
 
 	// if we failed at all to look for a local file, look in path.
 	if lookInPath {
-		execPath, e1 = exec.LookPath(commandToRun[0])
+		execPath, e1 = exec.LookPath(command)
 		if e1 != nil {
-			// no local file or file in path that is executable. Error and exit.
-			cmd.PrintErrf("error: could not find an executable '%s'. Make sure it exists and is marked as executable.\n", commandToRun[0])
-			os.Exit(1)
+			// no local file or file in path that is executable.
+			v.Add(lib.T("error.command", command))
 		}
 	}
-
-	execArgs = commandToRun[1:]
-	return
+	return execPath
 }
 
 // takes input file, script, and output file, and runs script in parallel, syncing given wait group.
-func runCommand(cmdPath string, cmdArgs []string, logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+// output is cut short, and the script stopped, once the limit needs no more records. The
+// resources used by the script, and the checksum of the log if verifyChecksums, are recorded
+// in report. A script that stalls is handled as set by --stall-timeout and --stall-action. The
+// log is fed to a long-lived filter of the pool, or run through jq, instead if f has one.
+func runCommand(f filter, limit *lib.RecordLimit, report *lib.RunReport, union lib.Schema, throttle *lib.Throttle, logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
 	wgDate.Add(1)
 
 	// start concurrent method. Look through this log file, write to temp file, and then let
@@ -137,38 +874,208 @@ func runCommand(cmdPath string, cmdArgs []string, logFile string, outputFile str
 
 		debugLog.Printf("queued: %s -> %s\n", logFile, outputFile)
 
-		// open input file for reading as compressed
-		cmdInputCompressed, fileReadErr := os.Open(logFile)
-		if fileReadErr != nil {
-			fmt.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), fileReadErr)
-			return
+		// a task that ran out of resources is run again once fewer tasks are running, and a
+		// stalled script is killed and run once more from the start, if asked to.
+		retriedStall := false
+		for attempt := 1; ; attempt++ {
+			slots := throttle.Limit()
+			stalled, exhausted := runTask(f, limit, report, union, logFile, outputFile, curTime, taskBar, attempt)
+			switch {
+			case exhausted != nil && slots > 1:
+				waitForFewerTasks(throttle, report, logFile, exhausted, slots)
+			case exhausted != nil:
+				fmt.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), exhausted)
+				return
+			case stalled && stallAction == lib.StallRetry && !retriedStall:
+				retriedStall = true
+				debugLog.Printf("retrying stalled: %s\n", logFile)
+			default:
+				return
+			}
 		}
-		defer cmdInputCompressed.Close()
+	}(logFile, outputFile, wgDate, taskBar)
+}
 
-		// open input file for reading as compressed
-		cmdInput, fileReadZipErr := gzip.NewReader(cmdInputCompressed)
-		if fileReadZipErr != nil {
-			fmt.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), fileReadErr)
-			return
-		}
-		defer cmdInput.Close()
+// lowers the number of tasks let run at once, after the task of logFile ran out of resources
+// with slots tasks let run at once, then gives up its slot and waits for one under the lowered
+// limit, so it can be run again.
+func waitForFewerTasks(throttle *lib.Throttle, report *lib.RunReport, logFile string, exhausted error, slots int) {
+	lowered := throttle.Shrink(slots)
+	report.AddExhausted(lowered)
+	fmt.Fprint(os.Stderr, lib.T("warn.exhausted", logFile, exhausted, lowered))
+	throttle.Release()
+	throttle.Acquire()
+}
 
-		// open output file for writing
-		cmdOutput, fileWriteErr := os.Create(outputFile)
-		if fileWriteErr != nil {
-			fmt.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), fileWriteErr)
-			return
-		}
-		defer cmdOutput.Close()
+// runs a single attempt of the script over logFile, writing to outputFile, which is created
+// anew. Returns true if the script stalled and was killed, or the error if the attempt failed
+// for lack of resources, such as open files, memory or processes.
+func runTask(f filter, limit *lib.RecordLimit, report *lib.RunReport, union lib.Schema, logFile string, outputFile string, curTime time.Time, taskBar *pb.ProgressBar, attempt int) (stalled bool, exhausted error) {
+	// open output file for writing, compressed with --compress-output. It is needed to concat
+	// the date even if the input turns out to be unusable.
+	cmdOutput, fileWriteErr := lib.CreateOutput(outputFile)
+	if lib.IsResourceExhausted(fileWriteErr) {
+		return false, fileWriteErr
+	} else if fileWriteErr != nil {
+		fmt.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), fileWriteErr)
+		return false, nil
+	}
+	defer cmdOutput.Close()
+
+	// open input file for reading as compressed
+	cmdInputCompressed, fileReadErr := os.Open(logFile)
+	if lib.IsResourceExhausted(fileReadErr) {
+		return false, fileReadErr
+	} else if fileReadErr != nil {
+		fmt.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), fileReadErr)
+		return false, nil
+	}
+	defer cmdInputCompressed.Close()
+
+	// large logs show how much of them has been read, going by the compressed bytes.
+	var size int64
+	if info, statErr := cmdInputCompressed.Stat(); statErr == nil {
+		size = info.Size()
+	}
+	progress := lib.NewProgressReader(cmdInputCompressed, taskBar, logFile, size, int64(progressThreshold)<<20)
+	defer progress.Close()
 
-		// run script, which should handle the file writing itself currently.
-		cmdContext := exec.Command(cmdPath, cmdArgs...)
-		cmdContext.Stdin = cmdInput
-		cmdContext.Stdout = cmdOutput
+	// open input file for reading as compressed, recording it as corrupt if it is not.
+	cmdInput, fileReadZipErr := lib.NewCheckedReader(progress)
+	if fileReadZipErr != nil {
+		debugLog.Printf("ERROR (%s): %s: %s\n", curTime.Format(lib.TimeFormatHuman), logFile, fileReadZipErr)
+		report.AddCorrupt(logFile, fileReadZipErr)
+		return false, nil
+	}
+	defer cmdInput.Close()
 
-		runErr := cmdContext.Run()
-		if runErr != nil {
-			debugLog.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), runErr)
+	// the output file can stay empty if enough records were already found.
+	ctx := limit.Context(curTime)
+	if ctx.Err() != nil {
+		debugLog.Printf("skipped: %s, record limit reached\n", logFile)
+		return false, nil
+	}
+	if verifyChecksums && attempt == 1 {
+		report.AddChecksum(logFile, lib.VerifyChecksum(logFile))
+	}
+	schema, schemaErr := lib.ReadSchema(logFile)
+	if schemaErr == nil {
+		report.AddSchema(logFile, schema)
+	}
+
+	// records are normalized to the union schema, then annotated with related notices, then
+	// tagged, then counted, then ordered, then rolled up into flows with --conn-summary, then
+	// collected if hits are kept, then encoded, or their values counted with --unique, or
+	// only rolled up.
+	encodedOutput := lib.NewOutputWriter(cmdOutput, outputFormat)
+	if f.unique != nil {
+		encodedOutput = f.unique.Writer(outputFile)
+	} else if f.summary != nil && f.summaryOnly {
+		encodedOutput = f.summary.Writer(outputFile)
+	}
+	collectedOutput := encodedOutput
+	if f.hits != nil {
+		collectedOutput = f.hits.Tee(outputFile, encodedOutput)
+	}
+	summarizedOutput := collectedOutput
+	if f.summary != nil && !f.summaryOnly {
+		summarizedOutput = f.summary.Tee(outputFile, collectedOutput)
+	}
+	orderedOutput := lib.NewFieldOrderWriter(summarizedOutput, outputFieldOrder)
+	limitedOutput := limit.Writer(orderedOutput, curTime)
+	taggedOutput := limitedOutput
+	if tagSensor {
+		taggedOutput = lib.NewSensorWriter(limitedOutput, lib.SensorOf(logFile, sensors))
+	}
+	annotatedOutput := lib.NewNoticeWriter(taggedOutput, f.notices)
+	normalizedOutput := annotatedOutput
+	if !union.Empty() && schemaErr == nil {
+		normalizedOutput = lib.NewSchemaWriter(annotatedOutput, schema, union)
+	}
+
+	// the log is decompressed ahead of the filter, the ts of its records corrected for the
+	// clock of its sensor with --correct-ts, the records the site never wants are dropped,
+	// and what the filter writes is handed on in batches.
+	ahead := lib.NewReadAhead(cmdInput)
+	corrected := ahead
+	if offset := lib.SensorOf(logFile, sensors).ClockOffset; correctTS && offset != 0 {
+		corrected = lib.NewClockReader(ahead, offset)
+	}
+	input := corrected
+	if f.site != nil {
+		input = f.site.Reader(corrected)
+	}
+
+	// run script, which should handle the file writing itself currently. Reads and writes
+	// are watched, to tell a slow script apart from a hung one.
+	activity := lib.NewActivity()
+	onStall := func(pid int, kill func() error) func(time.Duration) {
+		return func(idle time.Duration) {
+			state := lib.ProcessState(pid)
+			fmt.Fprint(os.Stderr, lib.T("warn.stall", logFile, idle.Round(time.Second), state, stallAction))
+			report.AddStall(lib.StalledTask{LogFile: logFile, Idle: idle, State: state, Action: stallAction})
+			if stallAction != lib.StallWarn {
+				stalled = true
+				kill()
+			}
 		}
-	}(logFile, outputFile, wgDate, taskBar)
+	}
+	var runErr, startErr error
+	var cmdContext *exec.Cmd
+	if f.jq != nil {
+		// jq runs in-process, so there is no process to watch or record the usage of.
+		runErr = f.jq.Filter(ctx, input, normalizedOutput)
+	} else if f.ip != nil {
+		// so does the subnet filter of filter-ip.
+		runErr = f.ip.Filter(ctx, input, normalizedOutput)
+	} else if f.where != nil {
+		// and the condition of --where.
+		runErr = f.where.Filter(ctx, input, normalizedOutput)
+	} else if f.pool != nil {
+		// a batch filter outlives the log, so it is only given the log until no more
+		// records are wanted, and its usage is recorded once the pull is done.
+		var filter *lib.BatchFilter
+		if filter, startErr = f.pool.Get(); startErr == nil {
+			stop := lib.WatchStall(activity, stallTimeout, onStall(filter.Pid(), filter.Kill))
+			runErr = filter.Filter(ctx, activity.Reader(input), activity.Writer(normalizedOutput))
+			stop()
+			f.pool.Put(filter, runErr != nil)
+		}
+	} else {
+		cmdContext = exec.CommandContext(ctx, f.path, f.args...)
+		cmdContext.Stdin = activity.Reader(input)
+		cmdContext.Stdout = lib.NewStageWriter(activity.Writer(normalizedOutput))
+		if startErr = cmdContext.Start(); startErr == nil {
+			stop := lib.WatchStall(activity, stallTimeout, onStall(cmdContext.Process.Pid, cmdContext.Process.Kill))
+			runErr = cmdContext.Wait()
+			stop()
+		}
+	}
+	input.Close()
+	corrected.Close()
+	ahead.Close()
+	normalizedOutput.Close()
+	annotatedOutput.Close()
+	taggedOutput.Close()
+	limitedOutput.Close()
+	orderedOutput.Close()
+	summarizedOutput.Close()
+	collectedOutput.Close()
+	encodedOutput.Close()
+	if cmdInput.Err != nil {
+		debugLog.Printf("ERROR (%s): %s: %s\n", curTime.Format(lib.TimeFormatHuman), logFile, cmdInput.Err)
+		report.AddCorrupt(logFile, cmdInput.Err)
+	}
+	if cmdContext != nil && cmdContext.ProcessState != nil {
+		report.AddUsage(lib.UsageOf(logFile, cmdContext.ProcessState))
+	}
+	if lib.IsResourceExhausted(startErr) {
+		return stalled, startErr
+	} else if startErr != nil {
+		runErr = startErr
+	}
+	if runErr != nil && ctx.Err() == nil {
+		debugLog.Printf("ERROR (%s): %s\n", curTime.Format(lib.TimeFormatHuman), runErr)
+	}
+	return stalled, nil
 }
@@ -0,0 +1,127 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions [app log types...]",
+	Short: "Group the conn and app-layer records of each connection into one object.",
+	Long: `Group the records of conn logs and the given app-layer logs by their zeek uid, into one
+JSON object per session holding an array of the records of each log type, such as
+{"uid":"C1","conn":[...],"http":[...]}. Sessions are grouped one day at a time, and written to
+sessions-YYYY-MM-DD.json in the output directory, or to stdout with --stdout, in order of their
+earliest record. Records without a uid are left out.
+
+Example:
+	nagini sessions -r 2021/06/01:00-2021/06/01:23 http dns ssl
+`,
+	Args: cobra.ArbitraryArgs, // app log types, if any, to group with conn.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rc, types, e := parseSessionsParams(args)
+		if showSources {
+			printConfigSources(dataOut, flagSettings(cmd, append(queryFlags, "outdir", "stdout")...))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+		// the logs of every log type are fetched, or extracted, into the same directories.
+		for _, logType := range types {
+			typeRC := rc
+			typeRC.LogType = logType
+			if e = fetchLogs(cmd, &typeRC); e != nil {
+				return e
+			}
+			rc.LogDir, rc.ExtractDir = typeRC.LogDir, typeRC.ExtractDir
+		}
+
+		report := &lib.RunReport{}
+		rc.Report = report
+		written, e := lib.ReassembleSessions(rc, types, func(day time.Time) (io.WriteCloser, error) {
+			if rc.WriteStdout {
+				return nopCloser{dataOut}, nil
+			}
+			if e := os.MkdirAll(rc.OutDir, 0775); e != nil {
+				return nil, e
+			}
+			return os.Create(filepath.Join(rc.OutDir, "sessions-"+day.Format(lib.TimeFormatDay)+".json"))
+		})
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("sessions.written", written))
+		if !rc.WriteStdout && written > 0 {
+			cmd.Print(lib.T("run.output", rc.OutDir))
+		}
+		cmd.Println()
+		report.Write(cmd.OutOrStderr())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+}
+
+// nopCloser is a writer that is not closed once written to, such as stdout.
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// takes the app log types and params, does error checking, and then produces useful variables.
+// returns the log types to group, conn first, and a *lib.ValidationError holding every problem
+// found, if any.
+func parseSessionsParams(appTypes []string) (rc lib.RuntimeConfig, types []string, e error) {
+	var v lib.Validator
+	rc.StartTime, rc.EndTime = v.TimeRange(timeRange)
+	v.Threads(threads)
+	rc.Threads = threads
+	rc.LogDir = v.LogDir(logDir)
+	rc.WriteStdout = writeStdout
+	if !writeStdout {
+		rc.OutDir = v.OutputDir(outputDir, true)
+	}
+	applyPullFlags(&v, &rc)
+
+	types = []string{"conn"}
+	for _, logType := range appTypes {
+		duplicate := false
+		for _, seen := range types {
+			duplicate = duplicate || logType == seen
+		}
+		if !duplicate {
+			types = append(types, logType)
+		}
+	}
+	for _, logType := range types {
+		v.LogType(logType, rc.LogDir, rc.StartTime, rc.EndTime)
+		v.Fields(logType, []string{"uid"}, logTypes)
+	}
+
+	// report every problem at once.
+	return rc, types, v.Err()
+}
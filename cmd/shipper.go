@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// emit-shipper-config args
+var shipperDir string      // directory the outputs to ship are under.
+var shipperLogType string  // only ship outputs of this log type.
+var shipperSink string     // sink to forward records to.
+var shipperEndpoint string // URL of the sink, or its brokers.
+var shipperTarget string   // index or topic to write to.
+
+// directory output directories are created in by default, from the global config, set in root.
+var outputParent string
+
+var emitShipperConfigCmd = &cobra.Command{
+	Use:       "emit-shipper-config vector|fluentd [config file]",
+	Short:     "Generate a Vector or Fluentd config that forwards outputs to a sink.",
+	ValidArgs: lib.Shippers(),
+	Long: `Generate a ready-to-use config for Vector or Fluentd that tails the JSON outputs of pulls
+under --dir, at any depth, and forwards each record to a sink: elasticsearch, http, kafka, or
+console to try it out. The config is written to the given file, or to stdout.
+
+Each record gets the path of the output it was read from as nagini_file. Outputs written with
+--manifest are only matched once renamed into place, so a record is never shipped from a file
+half written. MessagePack outputs are not shipped.
+
+Example:
+	nagini emit-shipper-config vector --dir /hunts --sink elasticsearch --endpoint http://es:9200 vector.toml
+	nagini emit-shipper-config fluentd --dir /hunts --log-type dns --sink kafka --endpoint kafka:9092 --target hunts fluent.conf
+`,
+	Args: cobra.RangeArgs(1, 2), // 2 arguments: shipper, and file to write the config to, or none for stdout.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, e := parseShipperParams(args[0])
+		if e != nil {
+			return e
+		}
+
+		var out io.Writer = dataOut
+		if len(args) == 2 {
+			f, e := os.Create(args[1])
+			if e != nil {
+				return e
+			}
+			defer f.Close()
+			out = f
+		}
+		if e = lib.RenderShipperConfig(out, config); e != nil {
+			return e
+		}
+		if len(args) == 2 {
+			cmd.Print(lib.T("shipper.written", args[1]))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(emitShipperConfigCmd)
+
+	emitShipperConfigCmd.Flags().StringVar(&shipperDir, "dir", "", "directory the outputs to ship are under, such as the one output directories are created in. The default output parent if not set.")
+	emitShipperConfigCmd.Flags().StringVar(&shipperLogType, "log-type", "", "only ship the outputs of this log type, such as dns.")
+	emitShipperConfigCmd.Flags().StringVar(&shipperSink, "sink", lib.SinkConsole, "sink to forward records to. One of: "+strings.Join(lib.ShipperSinks(), ", "))
+	emitShipperConfigCmd.Flags().StringVar(&shipperEndpoint, "endpoint", "", "URL of the sink, such as http://es:9200, or its brokers for kafka, such as kafka:9092.")
+	emitShipperConfigCmd.Flags().StringVar(&shipperTarget, "target", "nagini", "index (elasticsearch) or topic (kafka) to write records to.")
+}
+
+// takes the emit-shipper-config args and flags, and does error checking. returns a
+// *lib.ValidationError holding every problem found, if any.
+func parseShipperParams(shipper string) (config lib.ShipperConfig, e error) {
+	var v lib.Validator
+	known := false
+	for _, name := range lib.Shippers() {
+		known = known || shipper == name
+	}
+	if !known {
+		v.Add(lib.T("error.shipper", shipper, strings.Join(lib.Shippers(), ", ")))
+	}
+	known = false
+	for _, name := range lib.ShipperSinks() {
+		known = known || shipperSink == name
+	}
+	if !known {
+		v.Add(lib.T("error.shipper.sink", shipperSink, strings.Join(lib.ShipperSinks(), ", ")))
+	} else if shipperSink != lib.SinkConsole && shipperEndpoint == "" {
+		v.Add(lib.T("error.shipper.endpoint", shipperSink))
+	}
+	dir := shipperDir
+	if dir == "" {
+		dir = outputParent
+	}
+	dir, e = filepath.Abs(dir)
+	if e != nil {
+		v.AddErr(e)
+	}
+	if v.Failed() {
+		return config, v.Err()
+	}
+	return lib.ShipperConfig{
+		Shipper:  shipper,
+		Dir:      dir,
+		LogType:  shipperLogType,
+		Sink:     shipperSink,
+		Endpoint: shipperEndpoint,
+		Target:   shipperTarget,
+	}, nil
+}
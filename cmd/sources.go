@@ -0,0 +1,93 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// an effective setting and where its value came from, listed by --show-config-sources.
+type setting struct {
+	name   string
+	value  interface{}
+	source lib.ConfigSource
+}
+
+// flags whose defaults come from the global config, and the source of each default.
+// filled in when the global config is read.
+var flagSources = map[string]lib.ConfigSource{}
+
+// returns where the value of the given flag came from.
+func flagSource(cmd *cobra.Command, flag string) lib.ConfigSource {
+	if cmd.Flags().Changed(flag) {
+		return lib.SourceFlag
+	}
+	if source, ok := flagSources[flag]; ok {
+		return source
+	}
+	return lib.SourceDefault
+}
+
+// returns the effective setting of the given flags, which nothing else can override.
+func flagSettings(cmd *cobra.Command, flags ...string) (settings []setting) {
+	for _, flag := range flags {
+		settings = append(settings, setting{flag, cmd.Flags().Lookup(flag).Value.String(), flagSource(cmd, flag)})
+	}
+	return settings
+}
+
+// returns the value of the given flag if it was set on the command line, otherwise the first
+// non-empty candidate from the playbook, falling back to the flag's default.
+func stringSetting(cmd *cobra.Command, flag string, flagValue string, candidates ...string) (string, lib.ConfigSource) {
+	if cmd.Flags().Changed(flag) {
+		return flagValue, lib.SourceFlag
+	}
+	for _, candidate := range candidates {
+		if candidate != "" {
+			return candidate, lib.SourcePlaybook
+		}
+	}
+	return flagValue, flagSource(cmd, flag)
+}
+
+// returns the value of the given flag if it was set on the command line, otherwise the first
+// non-zero candidate from the playbook, falling back to the flag's default.
+func intSetting(cmd *cobra.Command, flag string, flagValue int, candidates ...int) (int, lib.ConfigSource) {
+	if cmd.Flags().Changed(flag) {
+		return flagValue, lib.SourceFlag
+	}
+	for _, candidate := range candidates {
+		if candidate != 0 {
+			return candidate, lib.SourcePlaybook
+		}
+	}
+	return flagValue, flagSource(cmd, flag)
+}
+
+// writes every given setting, its value, and where the value came from as an aligned table.
+func printConfigSources(w io.Writer, settings []setting) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, s := range settings {
+		fmt.Fprintf(tw, "%s\t%v\t(%s)\n", s.name, s.value, s.source)
+	}
+	tw.Flush()
+}
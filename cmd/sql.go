@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// sql args
+var sqlFormat string // format to write the result in, tsv or json.
+
+// flags of commands that only read logs, without writing a pull, listed by --show-config-sources.
+var queryFlags = []string{"timerange", "logdir", "threads", "order", "hours", "weekdays", "weekends", "outside-mask", "modified-since", "modified-before", "file-time", "cluster", "cache-dir", "cache-size", "lang"}
+
+// sqlCmd represents the sql command
+var sqlCmd = &cobra.Command{
+	Use:   "sql [query]",
+	Short: "Run a SQL query over the logs of the time range.",
+	Long: `Run a SQL query over the logs of the time range, and print the result. The log type is
+taken from the FROM clause, and every log is read in-process, several at a time, so nothing is
+written to an output directory. Meant for quick counts and breakdowns, it supports WHERE with
+=, !=, <, >, LIKE, IN and IS NULL, the aggregates count, sum, min, max and avg, GROUP BY,
+ORDER BY and LIMIT, but no joins or subqueries.
+
+Example:
+	nagini sql -r 2021/06/01:00-2021/06/01:23 "SELECT id_orig_h, count(*) FROM dns WHERE query LIKE '%.ru' GROUP BY 1 ORDER BY 2 DESC"
+`,
+	Args: cobra.ExactArgs(1), // 1 argument: the query
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query, rc, e := parseSQLParams(args[0])
+		if showSources {
+			printConfigSources(dataOut, flagSettings(cmd, append(queryFlags, "format")...))
+			return e
+		}
+		if e != nil {
+			return e
+		}
+		if e = fetchLogs(cmd, &rc); e != nil {
+			return e
+		}
+
+		report := &lib.RunReport{}
+		rc.Report = report
+		rows, e := lib.RunSQL(query, rc)
+		if e != nil {
+			return e
+		}
+		if e = lib.WriteSQLResult(dataOut, query, rows, sqlFormat); e != nil {
+			return e
+		}
+		report.Write(cmd.OutOrStderr())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sqlCmd)
+	sqlCmd.Flags().StringVar(&sqlFormat, "format", lib.SQLFormatTSV,
+		"format to print the result in: tsv, with a header of the columns, or json, with an object per row. One of: "+strings.Join(lib.SQLFormats(), ", "))
+}
+
+// takes the query and params, does error checking, and then produces useful variables.
+// returns a *lib.ValidationError holding every problem found, if any.
+func parseSQLParams(queryArg string) (query *lib.SQLQuery, rc lib.RuntimeConfig, e error) {
+	var v lib.Validator
+	rc.StartTime, rc.EndTime = v.TimeRange(timeRange)
+	v.Threads(threads)
+	rc.Threads = threads
+	rc.LogDir = v.LogDir(logDir)
+	applyPullFlags(&v, &rc)
+
+	query, e = lib.ParseSQL(queryArg)
+	if e != nil {
+		v.AddErr(e)
+	} else {
+		rc.LogType = query.LogType()
+		v.LogType(rc.LogType, rc.LogDir, rc.StartTime, rc.EndTime)
+		v.Fields(rc.LogType, query.Fields(), logTypes)
+	}
+	if sqlFormat != lib.SQLFormatTSV && sqlFormat != lib.SQLFormatJSON {
+		v.Add(lib.T("error.outputformat", sqlFormat, strings.Join(lib.SQLFormats(), ", ")))
+	}
+
+	// report every problem at once.
+	return query, rc, v.Err()
+}
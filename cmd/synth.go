@@ -0,0 +1,125 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// synth args
+var synthStart string    // first day of the archive, YYYY/MM/DD.
+var synthDays int        // number of days to write.
+var synthTypes []string  // log types to write.
+var synthRecords int     // records in each hourly log.
+var synthFormat string   // json or tsv.
+var synthCompress string // gzip, zstd or none.
+var synthSeed int64      // seed of the made up values.
+
+// synthCmd represents the synth command
+var synthCmd = &cobra.Command{
+	Use:   "synth [log directory]",
+	Short: "Write a synthetic Zeek archive to try pulls and configs against.",
+	Long: `Write a synthetic Zeek archive into an empty or new directory: a date directory per day, each
+holding an hourly log of each log type named as Zeek rotates them, so every part of a pull can be
+tried without real logs, such as in CI or to check a config file before pointing it at an archive.
+Records are made up from the fields of each log type, including those set in log_types of the
+config file. Connections are from 10.0.0.0/24 to 192.0.2.0/24 and 198.51.100.0/24, and the same
+--seed always writes the same archive.
+
+Example:
+	nagini synth --days 2 --types conn,dns --records 1000 ./synthetic
+	nagini run -i ./synthetic -r 2021/06/01:00-2021/06/02:23 conn grepcidr 10.0.0.5
+`,
+	Args: cobra.ExactArgs(1), // 1 argument: directory to write the archive into.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var v lib.Validator
+		start, e := time.Parse(lib.TimeFormatDate, synthStart)
+		if e != nil {
+			v.Add(lib.T("error.synth.start", synthStart))
+		}
+		if synthDays <= 0 {
+			v.Add(lib.T("error.synth.days", synthDays))
+		}
+		if synthRecords < 0 {
+			v.Add(lib.T("error.synth.records", synthRecords))
+		}
+		if len(synthTypes) == 0 {
+			v.Add(lib.T("error.synth.types"))
+		}
+		for _, logType := range synthTypes {
+			if _, ok := logTypes[logType]; !ok {
+				v.Add(lib.T("error.synth.logtype", logType))
+			}
+		}
+		if !oneOf(synthFormat, lib.SynthFormats()) {
+			v.Add(lib.T("error.synth.format", synthFormat, strings.Join(lib.SynthFormats(), ", ")))
+		}
+		if !oneOf(synthCompress, lib.SynthCompressions()) {
+			v.Add(lib.T("error.compress", synthCompress, strings.Join(lib.SynthCompressions(), ", ")))
+		} else if synthCompress == lib.CompressZstd {
+			if _, e := exec.LookPath("zstd"); e != nil {
+				v.Add(lib.T("error.compress.zstd"))
+			}
+		}
+		logDir := v.OutputDir(args[0], true)
+		if e := v.Err(); e != nil {
+			return e
+		}
+
+		files, e := lib.GenerateArchive(logDir, lib.SynthConfig{
+			Start:          start,
+			Days:           synthDays,
+			LogTypes:       synthTypes,
+			RecordsPerHour: synthRecords,
+			Format:         synthFormat,
+			Compress:       synthCompress,
+			Seed:           synthSeed,
+		}, logTypes)
+		if e != nil {
+			return e
+		}
+		cmd.Print(lib.T("synth.written", files, logDir, start.Format(lib.TimeFormatDate), start.AddDate(0, 0, synthDays-1).Format(lib.TimeFormatDate)))
+		return nil
+	},
+}
+
+// returns whether value is one of values.
+func oneOf(value string, values []string) bool {
+	for _, candidate := range values {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(synthCmd)
+
+	synthCmd.Flags().StringVar(&synthStart, "start", "2021/06/01", "first day of the archive, as YYYY/MM/DD.")
+	synthCmd.Flags().IntVar(&synthDays, "days", 1, "number of days to write.")
+	synthCmd.Flags().StringSliceVar(&synthTypes, "types", []string{"conn", "dns"}, "comma separated log types to write.")
+	synthCmd.Flags().IntVar(&synthRecords, "records", 100, "records in each hourly log.")
+	synthCmd.Flags().StringVar(&synthFormat, "format", lib.SynthJSON, "format of the logs, "+strings.Join(lib.SynthFormats(), " or ")+".")
+	synthCmd.Flags().StringVar(&synthCompress, "compress", lib.CompressGzip, "compression of the logs. One of: "+strings.Join(lib.SynthCompressions(), ", ")+". zstd needs the zstd command.")
+	synthCmd.Flags().Int64Var(&synthSeed, "seed", 1, "seed of the made up values. The same seed always writes the same archive.")
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 Drew S. Ortega <DrewSOrtega@pm.me>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	lib "github.com/OSU-SOC/nagini/lib"
+)
+
+// task manifest args, for commands that pull a single log type into an output directory.
+var emitManifest string // file to write the task manifest of the pull to, instead of pulling.
+var fromManifest string // task manifest to read the logs of, instead of looking for them.
+
+var taskManifest *lib.TaskManifest // the task manifest of --from-manifest, once read.
+
+// flags that split the discovery of the logs of a pull from pulling them, listed by
+// --show-config-sources.
+var taskManifestFlags = []string{"emit-manifest", "from-manifest"}
+
+// adds the flags that split the discovery of the logs of a pull from pulling them to the
+// given command.
+func addTaskManifestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&emitManifest, "emit-manifest", "", "instead of pulling, find every log the pull would read, and write them by date and output file to this JSON task manifest, to pull later with --from-manifest.")
+	cmd.Flags().StringVar(&fromManifest, "from-manifest", "", "read the logs listed in this task manifest, written by --emit-manifest, instead of looking for them, so a pull can be run again over the same logs. Its log type must be the one pulled, and its log directory and time range are used.")
+}
+
+// reads the task manifest of --from-manifest, and pulls over its log directory and time
+// range, which cannot be given too.
+func loadTaskManifest(cmd *cobra.Command) error {
+	taskManifest = nil
+	if fromManifest == "" {
+		return nil
+	}
+	for _, name := range []string{"logdir", "timerange", "month"} {
+		if cmd.Flags().Changed(name) {
+			return errors.New(lib.T("error.taskmanifest.flag", name))
+		}
+	}
+	m, e := lib.ReadTaskManifest(fromManifest)
+	if e != nil {
+		return errors.New(lib.T("error.taskmanifest.read", fromManifest, e))
+	}
+	cmd.Flags().Set("logdir", m.LogDir)
+	cmd.Flags().Set("timerange", m.Start.Format(lib.TimeFormatShort)+"-"+m.End.Format(lib.TimeFormatShort))
+	taskManifest = &m
+	return nil
+}
+
+// applies the task manifest flags to rc, pointing it at the logs of --from-manifest. Records a
+// problem if they cannot be used with the pull.
+func applyTaskManifestFlags(v *lib.Validator, rc *lib.RuntimeConfig) {
+	if emitManifest == "" && fromManifest == "" {
+		return
+	}
+	switch {
+	case emitManifest != "" && fromManifest != "":
+		v.Add(lib.T("error.taskmanifest.both"))
+	case rc.LogType == "":
+		v.Add(lib.T("error.taskmanifest.types"))
+	case current || waitLate > 0:
+		v.Add(lib.T("error.taskmanifest.live"))
+	case emitManifest != "" && lib.IsRemoteLogDir(rc.LogDir):
+		v.Add(lib.T("error.taskmanifest.remote", rc.LogDir))
+	case taskManifest != nil && taskManifest.LogType != rc.LogType:
+		v.Add(lib.T("error.taskmanifest.logtype", fromManifest, taskManifest.LogType, rc.LogType))
+	case taskManifest != nil:
+		rc.Tasks = taskManifest
+	}
+}
+
+// writes the task manifest of the pull of rc to --emit-manifest, without pulling. The logs of
+// its tar containers are extracted first, to be listed.
+func emitTaskManifest(cmd *cobra.Command, rc lib.RuntimeConfig) error {
+	if e := fetchLogs(cmd, &rc); e != nil {
+		return e
+	}
+	m := lib.DiscoverTasks(rc, debugLog)
+	if e := lib.WriteTaskManifest(emitManifest, m); e != nil {
+		return e
+	}
+	logs := 0
+	for _, day := range m.Days {
+		logs += len(day.Tasks)
+	}
+	cmd.Print(lib.T("run.taskmanifest", logs, len(m.Days), emitManifest))
+	return nil
+}
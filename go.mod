@@ -5,9 +5,12 @@ go 1.16
 require (
 	github.com/cheggaaa/pb v1.0.29
 	github.com/daviddengcn/go-colortext v1.0.0 // indirect
-	github.com/mattn/go-isatty v0.0.13 // indirect
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/itchyny/gojq v0.12.7
 	github.com/spf13/cobra v1.1.3
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
+	golang.org/x/sys v0.10.0 // indirect
 	gopkg.in/dixonwille/wlog.v2 v2.0.0 // indirect
 	gopkg.in/dixonwille/wmenu.v4 v4.0.2
 	gopkg.in/yaml.v2 v2.4.0
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// AccessFailure is a path a pull would read that cannot be read, such as a log owned by
+// another user in an archive of mixed ownership.
+type AccessFailure struct {
+	Path string
+	Err  error // why it cannot be read, such as permission denied
+}
+
+// VerifyAccess checks, without pulling, that everything a pull with rc would read can be read:
+// the date directories of its range, or the tar containers in their place, and every log in
+// them it would read. Returns the paths that cannot be, and how many paths were checked, so
+// they are known up front rather than as the pull comes across them. Remote log directories
+// are fetched before they are read, so they cannot be checked this way.
+func VerifyAccess(rc RuntimeConfig) (failures []AccessFailure, checked int, err error) {
+	check := func(path string, err error) {
+		checked++
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		if err != nil {
+			failures = append(failures, AccessFailure{Path: path, Err: err})
+		}
+	}
+	for _, day := range pullDays(rc) {
+		dateDir := filepath.Join(rc.LogDir, day.Start.Format(TimeFormatDay))
+		if info, statErr := os.Stat(dateDir); statErr == nil && info.IsDir() {
+			check(dateDir, readable(dateDir, true))
+		} else if os.IsPermission(statErr) {
+			check(dateDir, statErr)
+		} else if container := dateContainer(rc.LogDir, day.Start); container != "" {
+			check(container, readable(container, false))
+		}
+	}
+	// logs in an unreadable date directory cannot be listed, so are only reported as it.
+	logFiles, err := PullLogs(rc)
+	if err != nil {
+		return failures, checked, err
+	}
+	for _, logFile := range logFiles {
+		check(logFile, readable(logFile, false))
+	}
+	return failures, checked, nil
+}
+
+// returns why path cannot be read, or nil if it can: a file is opened and its first byte read,
+// and a directory is listed.
+func readable(path string, dir bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if dir {
+		_, err = f.Readdirnames(1)
+	} else {
+		_, err = f.Read(make([]byte, 1))
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// Filters with an expensive startup, such as a script loading a large intel set, can be kept
+// running and fed one log after another over stdin rather than started once per log. After
+// each log, a delimiter line is written to the filter's stdin, and the filter must write the
+// same line to its stdout once it has written everything for that log. The output before it
+// belongs to that log.
+
+// default line written between logs fed to a batch filter.
+const DefaultBatchDelimiter = "#nagini-end-of-log"
+
+// returned when a batch filter exits, or closes its stdout, in the middle of a log.
+var errBatchExited = errors.New("batch filter exited before the end of the log")
+
+// BatchFilter is a single long-lived filter process, fed one log at a time.
+type BatchFilter struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *bufio.Reader
+	delimiter []byte
+	logs      int // logs fed to it so far
+}
+
+// starts the filter at path with args.
+func StartBatchFilter(path string, args []string, delimiter string) (*BatchFilter, error) {
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &BatchFilter{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout), delimiter: []byte(delimiter)}, nil
+}
+
+// returns the process id of the filter.
+func (b *BatchFilter) Pid() int {
+	return b.cmd.Process.Pid
+}
+
+// feeds input to the filter, followed by the delimiter, and writes what the filter writes
+// up to the delimiter to output. Input stops early once ctx is cancelled, such as when no
+// more records are wanted. Once writing to output fails, such as when the record limit is
+// reached, the rest of the filter's output for the log is dropped, so it is ready for the
+// next log. Returns an error if the filter failed, and cannot be fed again.
+func (b *BatchFilter) Filter(ctx context.Context, input io.Reader, output io.Writer) (err error) {
+	b.logs++
+	fed := make(chan error, 1)
+	go func() {
+		fed <- b.feed(ctx, input)
+	}()
+
+	var outputErr error // output is only written until it fails.
+	for {
+		line, readErr := b.stdout.ReadBytes('\n')
+		if bytes.Equal(bytes.TrimRight(line, "\r\n"), b.delimiter) {
+			break
+		}
+		if len(line) > 0 && outputErr == nil {
+			_, outputErr = output.Write(line)
+		}
+		if readErr == io.EOF {
+			err = errBatchExited
+			break
+		} else if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+	if err != nil {
+		// the filter is gone, so nothing will read the rest of the input.
+		b.stdin.Close()
+	}
+	if feedErr := <-fed; err == nil {
+		err = feedErr
+	}
+	return err
+}
+
+// writes input to the filter's stdin, ending with a newline and the delimiter. The delimiter is
+// written even if input fails part way, such as a corrupt log, so the filter still ends the
+// log, and the error of input is returned once it is.
+func (b *BatchFilter) feed(ctx context.Context, input io.Reader) (err error) {
+	w := getWriter(b.stdin)
+	defer putWriter(w)
+	pooled := getBuffer()
+	defer putBuffer(pooled)
+	buf := *pooled
+	last := byte('\n')
+	for ctx.Err() == nil {
+		n, readErr := input.Read(buf)
+		if n > 0 {
+			last = buf[n-1]
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+	if last != '\n' {
+		w.WriteByte('\n')
+	}
+	w.Write(b.delimiter)
+	w.WriteByte('\n')
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// stops the filter at once.
+func (b *BatchFilter) Kill() error {
+	return b.cmd.Process.Kill()
+}
+
+// closes the filter's stdin, so it can finish, and waits for it to exit. Returns what it
+// used, listed as the filter with the number of logs fed to it.
+func (b *BatchFilter) Close() (TaskUsage, error) {
+	b.stdin.Close()
+	err := b.cmd.Wait()
+	name := fmt.Sprintf("%s (pid %d, %d logs)", filepath.Base(b.cmd.Path), b.cmd.Process.Pid, b.logs)
+	if b.cmd.ProcessState == nil {
+		return TaskUsage{LogFile: name}, err
+	}
+	return UsageOf(name, b.cmd.ProcessState), err
+}
+
+// FilterPool keeps batch filters running for a pull, handing each task one that is not in
+// use, and starting another when all are busy. Safe for concurrent use.
+type FilterPool struct {
+	path      string
+	args      []string
+	delimiter string
+
+	lock  sync.Mutex
+	idle  []*BatchFilter
+	usage []TaskUsage // resources used by filters that have exited.
+}
+
+// returns a pool of filters at path with args, fed logs separated by delimiter.
+func NewFilterPool(path string, args []string, delimiter string) *FilterPool {
+	return &FilterPool{path: path, args: args, delimiter: delimiter}
+}
+
+// returns a filter that is not in use, starting one if there is none.
+func (p *FilterPool) Get() (*BatchFilter, error) {
+	p.lock.Lock()
+	if n := len(p.idle); n > 0 {
+		filter := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.lock.Unlock()
+		return filter, nil
+	}
+	p.lock.Unlock()
+	return StartBatchFilter(p.path, p.args, p.delimiter)
+}
+
+// gives back a filter once its log is done. A filter that failed is stopped rather than
+// used again.
+func (p *FilterPool) Put(filter *BatchFilter, failed bool) {
+	if failed {
+		filter.Kill()
+		usage, _ := filter.Close()
+		p.lock.Lock()
+		p.usage = append(p.usage, usage)
+		p.lock.Unlock()
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.idle = append(p.idle, filter)
+}
+
+// stops every filter once the pull is done, and returns what every filter of the pool used.
+// Filters must not be in use.
+func (p *FilterPool) Close() []TaskUsage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, filter := range p.idle {
+		usage, _ := filter.Close()
+		p.usage = append(p.usage, usage)
+	}
+	p.idle = nil
+	return p.usage
+}
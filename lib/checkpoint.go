@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// name of the file inside a backfill's output directory that records its finished chunks.
+const CheckpointFile = ".nagini-checkpoint"
+
+// reads the names recorded in the checkpoint file at path. A missing file means nothing
+// has finished yet, and is not an error.
+func ReadCheckpoint(path string) (done map[string]bool, err error) {
+	done = make(map[string]bool)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return done, fmt.Errorf("could not read checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			done[name] = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return done, fmt.Errorf("could not read checkpoint %s: %w", path, err)
+	}
+	return done, nil
+}
+
+// records name as finished in the checkpoint file at path, creating the file if needed.
+func AppendCheckpoint(path string, name string) (err error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintln(f, name); err != nil {
+		return fmt.Errorf("could not write checkpoint %s: %w", path, err)
+	}
+	return f.Sync()
+}
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// suffix of the checksum sidecar written next to each rotated log, such as
+// conn.00:00:00-01:00:00.log.gz.sha256. It holds the hex sha256 of the log, optionally
+// followed by the file name, as written by sha256sum.
+const ChecksumSuffix = ".sha256"
+
+// checks logFile against its sha256 sidecar. Returns an error wrapping ErrNoChecksum if
+// there is no sidecar, or ErrChecksumMismatch if the log does not match it.
+func VerifyChecksum(logFile string) error {
+	sidecar, err := ioutil.ReadFile(logFile + ChecksumSuffix)
+	if os.IsNotExist(err) {
+		return ErrNoChecksum
+	} else if err != nil {
+		return fmt.Errorf("could not read checksum of %s: %w", logFile, err)
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty checksum sidecar for %s: %w", logFile, ErrChecksumMismatch)
+	}
+	expected := strings.ToLower(fields[0])
+
+	f, err := os.Open(logFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("expected sha256 %s, got %s: %w", expected, actual, ErrChecksumMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layout of the ts of zeek JSON logs written with ISO 8601 timestamps.
+const isoTimestamp = "2006-01-02T15:04:05.000000Z07:00"
+
+// returns the clock offset of the configured sensor whose path holds logDir, or 0 if none
+// does, see SensorConfig.
+func ClockOffsetOf(logDir string, sensors []SensorConfig) time.Duration {
+	if sensor := SensorOf(filepath.Join(logDir, "sensor.log"), sensors); sensor.Path != "" {
+		return sensor.ClockOffset
+	}
+	return 0
+}
+
+// returns the first and last hour of logs a pull with rc reads: its time range in the clock of
+// the sensor of its log directory, which runs rc.ClockOffset ahead of true time. A sensor whose
+// clock is off by part of an hour spreads the records of each hour over two of its logs, so
+// both are read.
+func sensorRange(rc RuntimeConfig) (start time.Time, end time.Time) {
+	if rc.ClockOffset == 0 {
+		return rc.StartTime, rc.EndTime
+	}
+	start = rc.StartTime.Add(rc.ClockOffset).Truncate(time.Hour)
+	end = rc.EndTime.Add(time.Hour + rc.ClockOffset - time.Nanosecond).Truncate(time.Hour)
+	return start, end
+}
+
+// returns whether the logs of the hour at curTime, in the clock of the sensor of rc, hold
+// records of an hour rc.Mask includes, if it is set.
+func includesHour(rc RuntimeConfig, curTime time.Time) bool {
+	if rc.Mask == nil {
+		return true
+	}
+	first := curTime.Add(-rc.ClockOffset)
+	return rc.Mask.Includes(first) || rc.Mask.Includes(first.Add(time.Hour-time.Nanosecond))
+}
+
+// NewClockReader returns a reader of the records (lines) of r with their ts corrected for the
+// clock of the sensor that wrote them, which ran offset ahead of true time. offset is taken off
+// the ts of JSON records, as a number or an ISO 8601 string, and of TSV records after a
+// #fields header naming ts. Other lines, and records whose ts cannot be read, are read as they
+// are.
+func NewClockReader(r io.Reader, offset time.Duration) io.ReadCloser {
+	return &clockReader{offset: offset, lines: newLineReader(r), column: -1}
+}
+
+type clockReader struct {
+	offset  time.Duration
+	lines   lineReader
+	column  int    // column of ts in the last #fields header, or -1
+	pending []byte // rest of the line being read, good until the next is
+	err     error  // error that ended r, once every line before it is read
+}
+
+func (cr *clockReader) Read(p []byte) (n int, err error) {
+	for len(cr.pending) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		var line []byte
+		line, cr.err = cr.lines.next()
+		cr.pending = cr.correct(line)
+	}
+	n = copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+	return n, nil
+}
+
+// gives the buffers of the reader back to the pool.
+func (cr *clockReader) Close() error {
+	if cr.lines.reader != nil {
+		cr.lines.close()
+	}
+	return nil
+}
+
+// returns the line with its ts corrected, or as it is if it has none.
+func (cr *clockReader) correct(line []byte) []byte {
+	record := bytes.TrimRight(line, "\r\n")
+	newline := line[len(record):]
+	switch {
+	case len(record) > 0 && record[0] == '{':
+		start, end := -1, -1
+		scanObject(record, func(key []byte, value []byte) bool {
+			if string(key) != "ts" {
+				return true
+			}
+			// value is a slice of record, so it starts as far in as its capacity is short.
+			start = cap(record) - cap(value)
+			end = start + len(value)
+			return false
+		})
+		if start < 0 {
+			return line
+		}
+		ts, ok := shiftTimestamp(record[start:end], cr.offset)
+		if !ok {
+			return line
+		}
+		corrected := append(append([]byte{}, record[:start]...), ts...)
+		return append(append(corrected, record[end:]...), newline...)
+	case bytes.HasPrefix(record, []byte("#fields\t")):
+		cr.column = -1
+		for i, field := range strings.Split(string(record), "\t")[1:] {
+			if field == "ts" {
+				cr.column = i
+			}
+		}
+		return line
+	case len(record) == 0 || record[0] == '#' || cr.column < 0:
+		return line
+	}
+	values := bytes.Split(record, []byte("\t"))
+	if cr.column >= len(values) {
+		return line
+	}
+	ts, ok := shiftTimestamp(values[cr.column], cr.offset)
+	if !ok {
+		return line
+	}
+	values[cr.column] = ts
+	return append(bytes.Join(values, []byte("\t")), newline...)
+}
+
+// returns the ts value, as zeek writes it, offset earlier: epoch seconds, keeping their
+// decimals, or a quoted ISO 8601 time. Returns false if it is neither, such as if it is unset.
+func shiftTimestamp(value []byte, offset time.Duration) ([]byte, bool) {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		t, err := time.Parse(time.RFC3339Nano, string(value[1:len(value)-1]))
+		if err != nil {
+			return nil, false
+		}
+		return []byte(`"` + t.Add(-offset).Format(isoTimestamp) + `"`), true
+	}
+	seconds, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return nil, false
+	}
+	decimals := -1
+	if dot := bytes.IndexByte(value, '.'); dot >= 0 {
+		decimals = len(value) - dot - 1
+	}
+	return []byte(strconv.FormatFloat(seconds-offset.Seconds(), 'f', decimals, 64)), true
+}
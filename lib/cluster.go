@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Zeek cluster can leave one log per worker for each hour, rather than one merged log:
+// either with the worker as a prefix (YYYY-MM-DD/worker-01.dns.00:00:00-01:00:00.log.gz),
+// or in a directory per worker (YYYY-MM-DD/worker-01/dns.00:00:00-01:00:00.log.gz). The logs
+// of every worker for an hour are pulled together, and merged into the output of their date.
+
+// returns the logs of logType for the hour of t, from its date directory in logDir, sorted.
+// If cluster is set, the logs of every worker are included. If logDir has no such date
+// directory, the logs are taken from extractDir instead, if set, see ExtractTarLogs. The date
+// directory is looked up in listing, if set, rather than listed again.
+func hourLogs(logDir string, extractDir string, logType string, t time.Time, cluster bool, listing *DirListing) (logFiles []string, err error) {
+	dateDir := fmt.Sprintf("%s/%04d-%02d-%02d", logDir, t.Year(), t.Month(), t.Day())
+	if _, err := os.Stat(dateDir); err != nil && extractDir != "" {
+		dateDir = fmt.Sprintf("%s/%04d-%02d-%02d", extractDir, t.Year(), t.Month(), t.Day())
+	}
+	for _, pattern := range hourPatterns(logType, t, cluster) {
+		glob := filepath.Glob
+		if listing != nil {
+			glob = listing.Glob
+		}
+		matches, err := glob(filepath.Join(dateDir, pattern))
+		if err != nil {
+			return logFiles, err
+		}
+		logFiles = append(logFiles, matches...)
+	}
+	sort.Strings(logFiles)
+	return logFiles, nil
+}
+
+// returns the patterns of the logs of logType for the hour of t, relative to its date
+// directory. If cluster is set, the patterns of the logs of every worker are included.
+func hourPatterns(logType string, t time.Time, cluster bool) []string {
+	name := fmt.Sprintf("%s.%02d*", logType, t.Hour())
+	if cluster {
+		return []string{name, "*." + name, "*/" + name}
+	}
+	return []string{name}
+}
+
+// returns the patterns of every log of logType, relative to a date directory. If cluster is
+// set, the patterns of the logs of every worker are included.
+func datePatterns(logType string, cluster bool) []string {
+	if cluster {
+		return []string{logType + ".*", "*." + logType + ".*", "*/" + logType + ".*"}
+	}
+	return []string{logType + ".*"}
+}
+
+// returns the name of the temporary output of logFile, pulled for the hour of t and written in
+// format. Logs in a directory per worker share their names, so the directory is made part of
+// the name. The hour comes before it, so the outputs of a date, concatenated in the order of
+// their names, are in time order, with those of every worker for an hour together.
+func taskOutputName(logDir string, logFile string, t time.Time, format string) string {
+	name := filepath.Base(logFile)
+	dateDir := filepath.Join(logDir, t.Format(TimeFormatDay))
+	if rel, err := filepath.Rel(dateDir, logFile); err == nil && !strings.HasPrefix(rel, "..") {
+		name = strings.ReplaceAll(filepath.ToSlash(rel), "/", ".")
+	}
+	return t.Format(TimeFormatDateNum) + t.Format("15.") + name + outputExtension(format)
+}
@@ -0,0 +1,321 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// formats outputs can be compressed in once finished. zstd is run through the system zstd
+// command.
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// returns the formats outputs can be compressed in, in the order they are documented.
+func Compressions() []string {
+	return []string{CompressGzip, CompressZstd}
+}
+
+// returns the formats outputs can be compressed in as they are written, see CreateOutput.
+func OutputCompressions() []string {
+	return []string{CompressGzip, CompressZstd}
+}
+
+// returns the highest level outputs can be compressed at in format as they are written.
+func MaxCompressLevel(format string) int {
+	if format == CompressZstd {
+		return 19
+	}
+	return gzip.BestCompression
+}
+
+// level outputs are compressed at as they are written, 0 for the default of their format.
+var compressLevel int
+
+// sets the level outputs are compressed at as they are written, see CreateOutput, from 1 to
+// the MaxCompressLevel of their format, or 0 for its default. Must not be called while a pull
+// runs.
+func SetCompressLevel(level int) {
+	compressLevel = level
+}
+
+// returns the extension added to outputs compressed in format.
+func compressedExtension(format string) string {
+	if format == CompressZstd {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+// compresses src into dst in format, writing it under the partial name of dst and renaming it
+// into place once complete, then removes src. zstd compresses with the dictionary next to dst
+// for its log type, if there is one.
+func CompressFile(src string, dst string, format string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	partial := PartialName(dst)
+	out, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+
+	if format == CompressZstd {
+		args := []string{"-q", "-c"}
+		if dictionary := outputDictionary(dst); dictionary != "" {
+			args = append(args, "-D", dictionary)
+		}
+		zstd := exec.Command("zstd", args...)
+		zstd.Stdin, zstd.Stdout = in, out
+		var stderr bytes.Buffer
+		zstd.Stderr = &stderr
+		if err = zstd.Run(); err != nil {
+			err = fmt.Errorf("zstd: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	} else {
+		gz := gzip.NewWriter(out)
+		if _, err = copyPooled(gz, in); err == nil {
+			err = gz.Close()
+		}
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, dst)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// reads an output file, decompressing it if it was compressed once finished.
+type outputReader struct {
+	io.Reader
+	closers []func() error
+}
+
+// closes the output file, and whatever decompresses it, returning the first error.
+func (r *outputReader) Close() (err error) {
+	for _, close := range r.closers {
+		if closeErr := close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// opens the output file at path, decompressing it if its extension says it was compressed.
+func openOutput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(path, compressedExtension(CompressGzip)):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &outputReader{gz, []func() error{gz.Close, f.Close}}, nil
+	case strings.HasSuffix(path, compressedExtension(CompressZstd)):
+		zstd, err := newZstdReader(f, outputDictionary(path))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &outputReader{zstd, []func() error{zstd.Close, f.Close}}, nil
+	}
+	return f, nil
+}
+
+// zstdReader decompresses with the zstd command, as the standard library has no zstd decoder.
+type zstdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	waited bool
+	err    error // why zstd failed, once it exited
+}
+
+// starts decompressing r with the zstd command, with the given dictionary if not empty.
+func newZstdReader(r io.Reader, dictionary string) (*zstdReader, error) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		return nil, fmt.Errorf("zstd is needed to read zstd compressed files: %w", err)
+	}
+	args := []string{"-dc"}
+	if dictionary != "" {
+		args = append(args, "-D", dictionary)
+	}
+	z := &zstdReader{cmd: exec.Command("zstd", args...)}
+	z.cmd.Stdin = r
+	z.cmd.Stderr = &z.stderr
+	stdout, err := z.cmd.StdoutPipe()
+	if err == nil {
+		err = z.cmd.Start()
+	}
+	if err != nil {
+		return nil, err
+	}
+	z.stdout = stdout
+	return z, nil
+}
+
+// reads what zstd wrote. Once it is all read, returns why zstd failed, if it did, such as for
+// a truncated file, rather than io.EOF.
+func (z *zstdReader) Read(p []byte) (n int, err error) {
+	n, err = z.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := z.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// waits for zstd to exit, returning why it failed, if it did.
+func (z *zstdReader) wait() error {
+	if !z.waited {
+		z.waited = true
+		if err := z.cmd.Wait(); err != nil {
+			z.err = fmt.Errorf("zstd: %w: %s", err, strings.TrimSpace(z.stderr.String()))
+		}
+	}
+	return z.err
+}
+
+// stops zstd if it was not read to the end, and waits for it to exit. Returns why it failed
+// if it was read to the end.
+func (z *zstdReader) Close() error {
+	if !z.waited {
+		z.cmd.Process.Kill()
+		z.wait()
+		return nil
+	}
+	return z.err
+}
+
+// returns the format an output file at path is compressed in as it is written, going by its
+// extension, or "" if it is written as it is.
+func writtenCompression(path string) string {
+	for _, format := range OutputCompressions() {
+		if strings.HasSuffix(path, compressedExtension(format)) {
+			return format
+		}
+	}
+	return ""
+}
+
+// returns a writer compressing what is written to it in format, at the level set by
+// SetCompressLevel, into w. It must be closed to finish the compressed stream, which does not
+// close w. zstd compresses through the zstd command.
+func newCompressor(w io.Writer, format string) (io.WriteCloser, error) {
+	if format == CompressZstd {
+		return newZstdWriter(w, compressLevel)
+	}
+	if compressLevel == 0 {
+		return gzip.NewWriter(w), nil
+	}
+	return gzip.NewWriterLevel(w, compressLevel)
+}
+
+// zstdWriter compresses with the zstd command, as the standard library has no zstd encoder.
+type zstdWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// starts compressing into w with the zstd command, at level, or its default if 0. A file is
+// written by zstd itself, from where it is at.
+func newZstdWriter(w io.Writer, level int) (*zstdWriter, error) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		return nil, fmt.Errorf("zstd is needed to write zstd compressed files: %w", err)
+	}
+	args := []string{"-q", "-c"}
+	if level > 0 {
+		args = append(args, fmt.Sprintf("-%d", level))
+	}
+	z := &zstdWriter{cmd: exec.Command("zstd", args...)}
+	z.cmd.Stdout = w
+	z.cmd.Stderr = &z.stderr
+	stdin, err := z.cmd.StdinPipe()
+	if err == nil {
+		err = z.cmd.Start()
+	}
+	if err != nil {
+		return nil, err
+	}
+	z.stdin = stdin
+	return z, nil
+}
+
+func (z *zstdWriter) Write(p []byte) (n int, err error) {
+	return z.stdin.Write(p)
+}
+
+// ends the input of zstd and waits for it to write the rest, returning why it failed, if it
+// did.
+func (z *zstdWriter) Close() error {
+	z.stdin.Close()
+	if err := z.cmd.Wait(); err != nil {
+		return fmt.Errorf("zstd: %w: %s", err, strings.TrimSpace(z.stderr.String()))
+	}
+	return nil
+}
+
+// writes an output file, compressing what is written to it.
+type outputWriter struct {
+	io.Writer
+	closers []func() error
+}
+
+// finishes compressing, then closes the output file, returning the first error.
+func (w *outputWriter) Close() (err error) {
+	for _, close := range w.closers {
+		if closeErr := close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// CreateOutput creates the output file at path, compressing what is written to it if its
+// extension says it is compressed as it is written, such as the outputs of a pull with
+// RuntimeConfig.CompressOutput. It must be closed to finish the compressed stream.
+func CreateOutput(path string) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil || writtenCompression(path) == "" {
+		return f, err
+	}
+	compressor, err := newCompressor(f, writtenCompression(path))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &outputWriter{compressor, []func() error{compressor.Close, f.Close}}, nil
+}
+
+// returns the name of an output file without the extension of its compression, if any.
+func uncompressedName(name string) string {
+	for _, format := range Compressions() {
+		if trimmed := strings.TrimSuffix(name, compressedExtension(format)); trimmed != name {
+			return trimmed
+		}
+	}
+	return name
+}
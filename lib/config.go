@@ -1,108 +1,552 @@
 package lib
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
-	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 )
 
+// Configuration is split into three models, each with a single owner:
+//   - GlobalConfig: site wide defaults, read from /etc/nagini or ~/.config/nagini.
+//   - Playbook: a reviewed set of pulls to run, read from a YAML file given by the user.
+//   - RuntimeConfig: the fully resolved settings of a single pull, built by cmd from
+//     flags (which default to the GlobalConfig) and consumed by ParseLogs.
+
+// The GlobalConfig struct holds site wide defaults. Every field is optional in the file,
+// missing fields take their value from DefaultGlobalConfig.
+type GlobalConfig struct {
+	DefaultThreadCount  int                 `yaml:"default_thread_count" mapstructure:"default_thread_count"`   // default_thread_count
+	ZeekLogDir          string              `yaml:"zeek_log_dir" mapstructure:"zeek_log_dir"`                   // zeek_log_dir
+	ConcatByDefault     bool                `yaml:"concat_by_default" mapstructure:"concat_by_default"`         // concat_by_default
+	ClusterLogs         bool                `yaml:"cluster_logs" mapstructure:"cluster_logs"`                   // cluster_logs: archive has per-worker logs
+	Language            string              `yaml:"language" mapstructure:"language"`                           // language
+	PlaybookDir         string              `yaml:"playbook_dir" mapstructure:"playbook_dir"`                   // playbook_dir: shared playbook library
+	TicketWebhook       string              `yaml:"ticket_webhook" mapstructure:"ticket_webhook"`               // ticket_webhook: url posted to by --ticket
+	TicketToken         string              `yaml:"ticket_token" mapstructure:"ticket_token"`                   // ticket_token: bearer token of ticket_webhook
+	Sensors             []SensorConfig      `yaml:"sensors" mapstructure:"sensors"`                             // sensors: names logs for --tag-sensor, and corrects skewed clocks
+	ProgressThresholdMB int                 `yaml:"progress_threshold_mb" mapstructure:"progress_threshold_mb"` // progress_threshold_mb: logs over this show their own progress
+	CacheDir            string              `yaml:"cache_dir" mapstructure:"cache_dir"`                         // cache_dir: logs fetched from remote archives
+	CacheSizeMB         int                 `yaml:"cache_size_mb" mapstructure:"cache_size_mb"`                 // cache_size_mb: size cache_dir is kept under
+	LogTypes            map[string][]string `yaml:"log_types" mapstructure:"log_types"`                         // log_types: fields of each log type, replacing the standard ones
+	FileExtractCommand  []string            `yaml:"file_extract_command" mapstructure:"file_extract_command"`   // file_extract_command: retrieves a carved file of files logs
+	OutputDir           string              `yaml:"output_dir" mapstructure:"output_dir"`                       // output_dir: where output directories are created by default
+	HistoryFile         string              `yaml:"history_file" mapstructure:"history_file"`                   // history_file: past pulls, to estimate new ones from
+	DictionaryDir       string              `yaml:"dictionary_dir" mapstructure:"dictionary_dir"`               // dictionary_dir: zstd dictionaries trained for each log type, to compress outputs with
+	SiteFilters         map[string][]string `yaml:"site_filters" mapstructure:"site_filters"`                   // site_filters: SQL conditions of records of each log type to always drop
+	OutputRoots         []string            `yaml:"output_roots" mapstructure:"output_roots"`                   // output_roots: the only directories outputs may be written under, if set
+	DeniedOutputRoots   []string            `yaml:"denied_output_roots" mapstructure:"denied_output_roots"`     // denied_output_roots: directories outputs may not be written under
+	Retention           []RetentionRule     `yaml:"retention" mapstructure:"retention"`                         // retention: how long the outputs under each root are kept, for prune
+	CompressOutput      string              `yaml:"compress_output" mapstructure:"compress_output"`             // compress_output: default of --compress-output
+	CompressLevel       int                 `yaml:"compress_level" mapstructure:"compress_level"`               // compress_level: default of --compress-level
+	LineageURL          string              `yaml:"lineage_url" mapstructure:"lineage_url"`                     // lineage_url: OpenLineage endpoint posted the events of every pull
+	LineageToken        string              `yaml:"lineage_token" mapstructure:"lineage_token"`                 // lineage_token: bearer token of lineage_url
+	LineageNamespace    string              `yaml:"lineage_namespace" mapstructure:"lineage_namespace"`         // lineage_namespace: namespace of the jobs of lineage events
+	S3Endpoint          string              `yaml:"s3_endpoint" mapstructure:"s3_endpoint"`                     // s3_endpoint: S3 compatible store --upload writes to, such as MinIO, instead of AWS
+	S3Region            string              `yaml:"s3_region" mapstructure:"s3_region"`                         // s3_region: region --upload signs requests for
+	S3AccessKeyID       string              `yaml:"s3_access_key_id" mapstructure:"s3_access_key_id"`           // s3_access_key_id: access key --upload signs requests with
+	S3SecretAccessKey   string              `yaml:"s3_secret_access_key" mapstructure:"s3_secret_access_key"`   // s3_secret_access_key: secret key of s3_access_key_id
+	MaxInputSize        string              `yaml:"max_input_size" mapstructure:"max_input_size"`               // max_input_size: default of --max-input-size
+}
+
 // The DataSource struct represents fields for an individual data source
-// found in the config YAML file. It represents an individual log pull
+// found in a playbook YAML file. It represents an individual log pull
 // set, which will be stored in {ProjectName}/{Name}, unless ManualPath
 // is specified.
 // It will use Threads as the number of threads on the system to pull data
 // with.
 type DataSource struct {
-	Name    string // name
-	Threads int    // threads
+	Name    string `yaml:"name,omitempty"`    // name
+	Threads int    `yaml:"threads,omitempty"` // threads
 
 	// one of: use specified log-path OR specify
-	ManualPath string `yaml:"manual_path"` // manual_path
-	Type       string `yaml:"log_type"`    //log_type
+	ManualPath string   `yaml:"manual_path,omitempty"` // manual_path
+	Type       string   `yaml:"log_type,omitempty"`    //log_type
+	Command    []string `yaml:"command,omitempty"`     // command: filter command and its args
+	JQ         string   `yaml:"jq,omitempty"`          // jq: expression to filter with in-process, instead of a command
+	Where      string   `yaml:"where,omitempty"`       // where: condition records must match, evaluated in-process, instead of a command
+	Script     string   `yaml:"script,omitempty"`      // script: inline script to run, with command as its args
+}
+
+// what a playbook does when one of its hooks fails, see PlaybookHook.
+const (
+	HookAbort = "abort" // stop the run with an error, the default
+	HookWarn  = "warn"  // print a warning and carry on
+)
+
+// The PlaybookHook struct is a command run by a playbook before or after its data sources,
+// such as one mounting an archive snapshot, or one triggering the ingestion of the outputs.
+type PlaybookHook struct {
+	Command   []string `yaml:"command,omitempty"`    // command: program and its args
+	OnFailure string   `yaml:"on_failure,omitempty"` // on_failure: HookAbort or HookWarn
 }
 
-// The High-Level Config
-type Config struct {
-	DataSources []DataSource `yaml:"data_sources"` // data_sources
+// The Playbook struct is the high-level playbook file: a list of data sources to pull,
+// and optional settings shared by all of them. Command line flags take priority over
+// playbook settings, and data source settings take priority over playbook-wide ones.
+// A playbook can build on others with Extends and Include, see ParsePlaybookWithVars.
+type Playbook struct {
+	Description string         `yaml:"description,omitempty"`  // description: listed by 'nagini playbook list'
+	Extends     string         `yaml:"extends,omitempty"`      // extends: playbook this one builds on
+	Include     []string       `yaml:"include,omitempty"`      // include: fragments merged in after extends
+	TimeRange   string         `yaml:"time_range,omitempty"`   // time_range
+	OutputDir   string         `yaml:"output_dir,omitempty"`   // output_dir
+	ZeekLogDir  string         `yaml:"zeek_log_dir,omitempty"` // zeek_log_dir
+	Threads     int            `yaml:"threads,omitempty"`      // threads
+	PreRun      []PlaybookHook `yaml:"pre_run,omitempty"`      // pre_run: commands run before the data sources
+	PostRun     []PlaybookHook `yaml:"post_run,omitempty"`     // post_run: commands run once every data source is pulled
+	DataSources []DataSource   `yaml:"data_sources,omitempty"` // data_sources
+}
+
+// The RuntimeConfig struct holds the resolved settings of a single pull. Paths are absolute.
+type RuntimeConfig struct {
+	StartTime   time.Time // first hour to pull
+	EndTime     time.Time // last hour to pull, inclusive
+	LogType     string    // zeek log type, such as conn
+	LogDir      string    // zeek log directory
+	ExtractDir  string    // directory logs were extracted into from the tar containers of LogDir, if any
+	OutDir      string    // output directory, or temp directory if WriteStdout
+	Threads     int       // number of threads to run in parallel
+	SingleFile  bool      // concat all output into one file
+	WriteStdout bool      // write output to stdout instead of OutDir
+	Manifest    bool      // write each output under a partial name, renamed once complete, and list it in ManifestFile
+	Compress    string    // compress each output once finished, CompressGzip or CompressZstd, or leave it as is if empty
+	// compress every output as it is written instead, CompressGzip or CompressZstd, at the
+	// level of SetCompressLevel, down to the output of each task, which handlers must then
+	// write with CreateOutput. Leave empty to write them as they are.
+	CompressOutput string
+	// directory of the zstd dictionaries trained for each log type, see TrainDictionary. If
+	// Compress is CompressZstd and one was trained for LogType, it is copied into OutDir and
+	// the outputs are compressed with it. Empty to not use dictionaries.
+	DictionaryDir string
+
+	NewestFirst   bool // pull the newest dates first
+	FailOnCorrupt bool // fail the pull if any source log is corrupt, rather than skip it
+
+	ModifiedSince  time.Time // only pull logs modified at or after this time, if set
+	ModifiedBefore time.Time // only pull logs modified before this time, if set
+	UseCtime       bool      // compare the inode change time of logs, rather than modification time
+
+	Mask *TimeMask // only pull the hours selected by this mask, if set
+
+	// how far ahead of true time the clock of the sensor of LogDir runs, see SensorConfig. The
+	// logs of the hours of the time range in its clock are pulled, and Mask is applied to the
+	// true hours of their records.
+	ClockOffset time.Duration
+
+	Cluster bool // also pull the per-worker logs of a Zeek cluster, see hourLogs
+
+	// optional, the listing of date directories shared with pulls of other log types over the
+	// same time range, so each is listed once. If not set, the logs of each hour are listed
+	// as they are reached.
+	Listing *DirListing
+
+	OnChange string        // what to do with a log that changes while read, ChangeFlag or ChangeReprocess. Only checked when the time range includes now.
+	WaitLate time.Duration // after the first pass over the logs, how long to wait for logs delivered late before finishing each date. 0 to not wait.
+	Current  bool          // also pull the un-rotated log in the current directory of LogDir for the hour in progress, from a copy taken when it is reached
+
+	OutputFormat string // format handlers write records in, OutputJSON, OutputMsgpack or OutputParquet. Names the output files.
+
+	// optional, the logs to read, found by the discovery pass of an earlier pull, see
+	// DiscoverTasks. If set, they are read instead of looking for the logs of the time range.
+	Tasks *TaskManifest
+
+	// optional, collects what happened during the pull. Handlers record into it, and
+	// ParseLogs checks it for corrupt source logs before writing the final output.
+	Report *RunReport
+
+	// optional, bounds the number of tasks ParseLogs runs at once, so handlers can lower it
+	// once they run out of resources. If not set, Threads tasks run at once.
+	Throttle *Throttle
+
+	MaxRecords       int  // stop after this many records in total, 0 for no limit
+	FirstMatchPerDay bool // stop each day after its first record
+
+	// optional, called by ParseLogs with the output file of each date as soon as it is final,
+	// so it can be processed before the whole pull is done. Dates with no logs are not passed,
+	// nor dates whose output could not be compressed or converted. Called from a goroutine per
+	// date, so it must be safe for concurrent use. If WriteStdout or SingleFile are set, the file
+	// is removed once the pull is done. If Compress or CompressOutput is set, it is the
+	// compressed output, and with OutputParquet, the Parquet file of the date, if it has records.
+	OnDayDone func(date time.Time, outputFile string)
 }
 
-// Read the YAML config file from the specified path by string input,
+// Read the playbook YAML file from the specified path by string input,
 // and then populate a struct based on present fields. Returns
 // the struct parsed and if there was an error in parsing.
-func ParseConfig(filepath string) (configData Config, err error) {
+func ParsePlaybook(filepath string) (playbook Playbook, err error) {
 	// Try to read file from config.
 	configBuffer, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return playbook, err
+	}
 
 	// Parse the YAML file, and check for generated errors.
-	err = yaml.Unmarshal(configBuffer, &configData)
-	return configData, err
+	err = yaml.Unmarshal(configBuffer, &playbook)
+	return playbook, err
+}
+
+// prefix of environment variables that set playbook variables, such as NAGINI_VAR_ip for {{ .ip }}.
+const PlaybookVarEnvPrefix = "NAGINI_VAR_"
+
+// Read the playbook YAML file like ParsePlaybook, first filling in {{ .name }} variables from
+// vars. Returns an error if the playbook uses a variable missing from vars.
+// The playbook named by extends, then each fragment in include, are read the same way
+// (relative to the file naming them) and merged in order underneath the playbook: settings
+// it sets win, and data sources it defines replace those of the same name.
+func ParsePlaybookWithVars(path string, vars map[string]string) (playbook Playbook, err error) {
+	return parsePlaybookTree(path, vars, false, map[string]bool{})
+}
+
+// Read the playbook like ParsePlaybookWithVars, but return an error for any key it does not
+// know, such as a misspelled setting that would otherwise be silently ignored.
+func ParsePlaybookStrict(path string, vars map[string]string) (playbook Playbook, err error) {
+	return parsePlaybookTree(path, vars, true, map[string]bool{})
+}
+
+// reads a playbook and everything it extends or includes. seen holds the files being read
+// further up the tree, to catch a playbook that ends up including itself.
+func parsePlaybookTree(path string, vars map[string]string, strict bool, seen map[string]bool) (playbook Playbook, err error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return playbook, err
+	}
+	if seen[absPath] {
+		return playbook, fmt.Errorf("playbook %s includes itself", path)
+	}
+	seen[absPath] = true
+	defer delete(seen, absPath)
+
+	own, err := parsePlaybookFile(path, vars, strict)
+	if err != nil {
+		return playbook, err
+	}
+
+	bases := own.Include
+	if own.Extends != "" {
+		bases = append([]string{own.Extends}, bases...)
+	}
+	for _, base := range bases {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(path), base)
+		}
+		basePlaybook, err := parsePlaybookTree(base, vars, strict, seen)
+		if err != nil {
+			return playbook, fmt.Errorf("%s: %w", path, err)
+		}
+		playbook = mergePlaybooks(playbook, basePlaybook)
+	}
+	return mergePlaybooks(playbook, own), nil
+}
+
+// returns base with the settings and data sources of over laid on top of it.
+func mergePlaybooks(base Playbook, over Playbook) (merged Playbook) {
+	merged = base
+	merged.Extends, merged.Include = "", nil
+	if over.Description != "" {
+		merged.Description = over.Description
+	}
+	if over.TimeRange != "" {
+		merged.TimeRange = over.TimeRange
+	}
+	if over.OutputDir != "" {
+		merged.OutputDir = over.OutputDir
+	}
+	if over.ZeekLogDir != "" {
+		merged.ZeekLogDir = over.ZeekLogDir
+	}
+	if over.Threads != 0 {
+		merged.Threads = over.Threads
+	}
+	// hooks of base run first, such as a site wide mount of the archive.
+	merged.PreRun = append(append([]PlaybookHook(nil), base.PreRun...), over.PreRun...)
+	merged.PostRun = append(append([]PlaybookHook(nil), base.PostRun...), over.PostRun...)
+
+	// only sources from base are replaced, so duplicates within over are still reported.
+	merged.DataSources = append([]DataSource(nil), base.DataSources...)
+	for _, source := range over.DataSources {
+		replaced := false
+		for i := range base.DataSources {
+			if source.Name != "" && merged.DataSources[i].Name == source.Name {
+				merged.DataSources[i] = source
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged.DataSources = append(merged.DataSources, source)
+		}
+	}
+	return merged
+}
+
+// reads a single playbook file, filling in variables, without following extends or include.
+// If strict is set, unknown keys are an error.
+func parsePlaybookFile(path string, vars map[string]string, strict bool) (playbook Playbook, err error) {
+	configBuffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return playbook, err
+	}
+	return parsePlaybookContent(filepath.Base(path), configBuffer, vars, strict)
+}
+
+// parses the content of a playbook called name, filling in variables. If strict is set,
+// unknown keys are an error.
+func parsePlaybookContent(name string, configBuffer []byte, vars map[string]string, strict bool) (playbook Playbook, err error) {
+	// fill in variables, failing on any that are missing rather than leaving them blank.
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(configBuffer))
+	if err != nil {
+		return playbook, err
+	}
+	placeholders := make(map[string]playbookVar, len(vars))
+	for key, value := range vars {
+		placeholders[key] = playbookVar(value)
+	}
+	var rendered bytes.Buffer
+	if err = tmpl.Execute(&rendered, placeholders); err != nil {
+		return playbook, err
+	}
+
+	if strict {
+		err = yaml.UnmarshalStrict(rendered.Bytes(), &playbook)
+	} else {
+		err = yaml.Unmarshal(rendered.Bytes(), &playbook)
+	}
+	if err == nil {
+		fillVars(reflect.ValueOf(&playbook).Elem())
+	}
+	return playbook, err
+}
+
+// a playbook variable. It is printed into the playbook as a placeholder holding its value in
+// hex, filled back into the string fields once parsed, so values such as "# x" or "a, --flag"
+// are kept as they are, rather than read as YAML. Values of only digits are printed as they
+// are, so they can set numbers such as threads.
+type playbookVar string
+
+// matches the placeholders of playbook variables, holding their values in hex.
+var playbookVarPattern = regexp.MustCompile(`__nagini_var_([0-9a-f]*)__`)
+
+func (v playbookVar) String() string {
+	if v != "" && strings.Trim(string(v), "0123456789") == "" {
+		return string(v)
+	}
+	return "__nagini_var_" + hex.EncodeToString([]byte(v)) + "__"
+}
+
+// replaces the placeholders of playbook variables in every string held by v with their values.
+func fillVars(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(playbookVarPattern.ReplaceAllStringFunc(v.String(), func(placeholder string) string {
+			value, _ := hex.DecodeString(playbookVarPattern.FindStringSubmatch(placeholder)[1])
+			return string(value)
+		}))
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			fillVars(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fillVars(v.Field(i))
+			}
+		}
+	}
+}
+
+// returns the playbook variables set in the environment with PlaybookVarEnvPrefix.
+func PlaybookVarsFromEnv() map[string]string {
+	vars := make(map[string]string)
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, PlaybookVarEnvPrefix) {
+			keyValue := strings.SplitN(strings.TrimPrefix(env, PlaybookVarEnvPrefix), "=", 2)
+			if len(keyValue) == 2 && keyValue[0] != "" {
+				vars[keyValue[0]] = keyValue[1]
+			}
+		}
+	}
+	return vars
+}
+
+// returns the global config used when no config file sets a value.
+func DefaultGlobalConfig() GlobalConfig {
+	return GlobalConfig{
+		DefaultThreadCount:  8,
+		ZeekLogDir:          "/data/zeek/logs",
+		ConcatByDefault:     false,
+		Language:            "",
+		PlaybookDir:         "/etc/nagini/playbooks",
+		ProgressThresholdMB: 1024,
+		CacheDir:            defaultCacheDir(),
+		CacheSizeMB:         10240,
+		HistoryFile:         DefaultHistoryFile,
+		DictionaryDir:       DefaultDictionaryDir,
+		LineageNamespace:    DefaultLineageNamespace,
+		S3Region:            DefaultS3Region,
+	}
+}
+
+// returns the directory to cache logs fetched from remote archives in, in the user's cache
+// directory if they have one.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "nagini")
+}
+
+// parses and verifies the arguments of a single pull into a RuntimeConfig. Every problem
+// found is recorded in the given validator rather than stopping at the first one.
+func GenRuntimeConfig(v *Validator, timeRange string, logDir string, outputDir string, logType string, threads int, singleFile bool, writeStdout bool) (rc RuntimeConfig) {
+	rc.StartTime, rc.EndTime = v.TimeRange(timeRange)
+	v.Threads(threads)
+	rc.Threads = threads
+	rc.LogDir = v.LogDir(logDir)
+	rc.OutDir = v.OutputDir(outputDir, true)
+
+	rc.LogType = logType
+	v.LogType(rc.LogType, rc.LogDir, rc.StartTime, rc.EndTime)
+
+	rc.SingleFile = singleFile
+	rc.WriteStdout = writeStdout
+	return rc
+}
+
+// well known locations for a Zeek log archive, checked by DetectZeekLogDirs.
+var zeekLogDirCandidates = []string{
+	"/data/zeek/logs",
+	"/opt/zeek/logs",
+	"/usr/local/zeek/logs",
+	"/nsm/zeek/logs",
+	"/var/log/zeek",
+	"/opt/bro/logs",
+	"/usr/local/bro/logs",
+}
+
+// ConfigSource names where an effective setting got its value.
+type ConfigSource string
+
+// sources of a setting, in order of priority.
+const (
+	SourceFlag         ConfigSource = "flag"
+	SourcePlaybook     ConfigSource = "playbook"
+	SourceEnv          ConfigSource = "environment"
+	SourceUserConfig   ConfigSource = "user config"
+	SourceSystemConfig ConfigSource = "system config"
+	SourceDefault      ConfigSource = "default"
+)
+
+// paths of the system and user config files, in order of priority.
+const SystemConfigPath = "/etc/nagini/config.yaml"
+const UserConfigPath = "$HOME/.config/nagini/config.yaml"
+
+// sets the default values of every global config key on the given viper config.
+func setGlobalConfigDefaults(v *viper.Viper) {
+	defaults := DefaultGlobalConfig()
+	v.SetDefault("default_thread_count", defaults.DefaultThreadCount)
+	v.SetDefault("zeek_log_dir", defaults.ZeekLogDir)
+	v.SetDefault("concat_by_default", defaults.ConcatByDefault)
+	v.SetDefault("cluster_logs", defaults.ClusterLogs)
+	v.SetDefault("language", defaults.Language)
+	v.SetDefault("playbook_dir", defaults.PlaybookDir)
+	v.SetDefault("ticket_webhook", defaults.TicketWebhook)
+	v.SetDefault("ticket_token", defaults.TicketToken)
+	v.SetDefault("progress_threshold_mb", defaults.ProgressThresholdMB)
+	v.SetDefault("cache_dir", defaults.CacheDir)
+	v.SetDefault("cache_size_mb", defaults.CacheSizeMB)
+	v.SetDefault("output_dir", defaults.OutputDir)
+	v.SetDefault("history_file", defaults.HistoryFile)
+	v.SetDefault("dictionary_dir", defaults.DictionaryDir)
+	v.SetDefault("compress_output", defaults.CompressOutput)
+	v.SetDefault("compress_level", defaults.CompressLevel)
+	v.SetDefault("lineage_url", defaults.LineageURL)
+	v.SetDefault("lineage_token", defaults.LineageToken)
+	v.SetDefault("lineage_namespace", defaults.LineageNamespace)
+	v.SetDefault("s3_endpoint", defaults.S3Endpoint)
+	v.SetDefault("s3_region", defaults.S3Region)
+	v.SetDefault("s3_access_key_id", defaults.S3AccessKeyID)
+	v.SetDefault("s3_secret_access_key", defaults.S3SecretAccessKey)
+	v.SetDefault("max_input_size", defaults.MaxInputSize)
 }
 
 // takes a global config from /etc/nagini or ~/.config/nagini, reads in vars that are present,
-// and passes them as a viper config.
-func ReadGlobalConfig() (globalConfig *viper.Viper) {
-	globalConfig = viper.New()
-	globalConfig.SetConfigName("config")
-	globalConfig.SetConfigType("yaml")
+// and returns them with defaults filled in, along with the source of each key. Keys with a
+// default can also be set with an environment variable, such as NAGINI_ZEEK_LOG_DIR, which
+// overrides the config file, so a container can be configured without one. If no config
+// file exists, a viper.ConfigFileNotFoundError is returned alongside the defaults.
+func ReadGlobalConfig() (globalConfig GlobalConfig, sources map[string]ConfigSource, err error) {
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
 	// Config paths in order of priority.
-	globalConfig.AddConfigPath("/etc/nagini/")
-	globalConfig.AddConfigPath("$HOME/.config/nagini/")
-
-	// set default vals for config generation
-	globalConfig.SetDefault("default_thread_count", 8)
-	globalConfig.SetDefault("zeek_log_dir", "/data/zeek/logs")
-	globalConfig.SetDefault("concat_by_default", false)
-
-	readConfig := true
-	for readConfig {
-		readConfig = false
-		// Try ingesting config from one of the config paths.
-		if err := globalConfig.ReadInConfig(); err != nil {
-			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-				fmt.Println("WARN: could not find a config file. Trying to write a default to /etc/nagini/config.yaml")
-				// no config file exists.
-
-				// first, try to see if we have write acess to /etc/nagini.
-				err = TryCreateDir("/etc/nagini", false)
-				if err == nil {
-					// we have write access, create log file.
-					err = globalConfig.WriteConfigAs("/etc/nagini/config.yaml")
-					if err == nil {
-						fmt.Println("WARN: Successfully created log file at /etc/nagini/config.yaml")
-						readConfig = true
-						continue
-					}
-				}
-				fmt.Println("WARN: could not read or write /etc/nagini/config.yaml, trying home directory ~/.config/nagini/config.yaml")
-				// next, try to write to home directory if we don't have correct perms. Make sure config dir and nagini exists.
-				homedir, err0 := os.UserHomeDir()
-				err1 := TryCreateDir(homedir+"/.config", false)
-				err2 := TryCreateDir(homedir+"/.config/nagini", false)
-				if err0 != nil || err1 != nil || err2 != nil {
-					panic(fmt.Errorf("No config file present, and failed to write a default. Please manually add one to /etc/nagini or ~/.config/nagini: %s %s", err1, err2))
-				} else {
-					err = globalConfig.WriteConfigAs(homedir + "/.config/nagini/config.yaml")
-					if err != nil {
-						panic(fmt.Errorf("No config file present, and failed to write a default. Please manually add one to /etc/nagini or ~/.config/nagini: %s", err))
-					} else {
-						fmt.Printf("WARN: created a new config file at %s/.config/nagini/config.yaml\n", homedir)
-						readConfig = true
-					}
-				}
-			} else {
-				// Config file was found but another error was produced
-				panic(fmt.Errorf("Unexpected Error: %s", err))
-			}
+	v.AddConfigPath(filepath.Dir(SystemConfigPath))
+	v.AddConfigPath(filepath.Dir(UserConfigPath))
+
+	setGlobalConfigDefaults(v)
+	v.SetEnvPrefix("nagini")
+	v.AutomaticEnv()
+
+	// Try ingesting config from one of the config paths.
+	err = v.ReadInConfig()
+	if _, ok := err.(viper.ConfigFileNotFoundError); err != nil && !ok {
+		// Config file was found but another error was produced
+		return DefaultGlobalConfig(), nil, fmt.Errorf("could not read config file %s: %w", v.ConfigFileUsed(), err)
+	}
+	if e := v.Unmarshal(&globalConfig); e != nil {
+		return DefaultGlobalConfig(), nil, fmt.Errorf("could not parse config file %s: %w", v.ConfigFileUsed(), e)
+	}
+
+	// only one config file is read, so every key set in it shares its source.
+	fileSource := SourceUserConfig
+	if v.ConfigFileUsed() == SystemConfigPath {
+		fileSource = SourceSystemConfig
+	}
+	sources = make(map[string]ConfigSource)
+	for _, key := range v.AllKeys() {
+		sources[key] = SourceDefault
+		if _, ok := os.LookupEnv(ConfigEnvVar(key)); ok {
+			sources[key] = SourceEnv
+		} else if v.InConfig(key) {
+			sources[key] = fileSource
 		}
 	}
-	return globalConfig
+	return globalConfig, sources, err
 }
 
-// TODO
-func GenRuntimeConfig(globalConfig *viper.Viper, cmd *cobra.Command) {
+// writes the given global config to path, creating the parent directory if needed.
+func WriteGlobalConfig(path string, globalConfig GlobalConfig) (err error) {
+	path = os.ExpandEnv(path)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	configBuffer, err := yaml.Marshal(globalConfig)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, configBuffer, 0644)
+}
 
+// returns the well known Zeek log directories that exist on this system and contain
+// at least one date directory (YYYY-MM-DD).
+func DetectZeekLogDirs() (found []string) {
+	for _, dir := range zeekLogDirCandidates {
+		dates, _ := filepath.Glob(filepath.Join(dir, "[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]"))
+		if len(dates) > 0 {
+			found = append(found, dir)
+		}
+	}
+	return found
 }
@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// what a pull of conn logs writes with a conn summary, see ConnSummary.
+const (
+	ConnSummaryAlongside = "alongside" // the records, and the summary next to them
+	ConnSummaryOnly      = "only"      // only the summary, instead of the records
+)
+
+// returns the ways a conn summary can be written.
+func ConnSummaryModes() []string {
+	return []string{ConnSummaryAlongside, ConnSummaryOnly}
+}
+
+// ConnSummaryFile is the file of the output directory a conn summary is written to.
+const ConnSummaryFile = "conn-summary.tsv"
+
+// fields of conn records a flow is keyed by, and summed over.
+var (
+	connFlowKey    = []string{"id.orig_h", "id.resp_h", "id.resp_p", "proto"}
+	connFlowTotals = []string{"orig_bytes", "resp_bytes", "orig_pkts", "resp_pkts"}
+)
+
+// ConnFlow is the roll-up of the conn records of a flow, those between the same hosts to the
+// same port over the same protocol, over the time range of a pull.
+type ConnFlow struct {
+	Key       []string   // id.orig_h, id.resp_h, id.resp_p and proto
+	Conns     int        // conn records of the flow
+	Totals    [4]float64 // orig_bytes, resp_bytes, orig_pkts and resp_pkts, summed
+	Duration  float64    // duration of the conns, summed
+	FirstSeen float64    // ts of the first conn
+	LastSeen  float64    // ts of the last conn
+}
+
+// returns the bytes of the flow, sent and received.
+func (f *ConnFlow) Bytes() float64 {
+	return f.Totals[0] + f.Totals[1]
+}
+
+// adds a conn record to the flow.
+func (f *ConnFlow) add(record map[string]interface{}) {
+	f.Conns++
+	for i, field := range connFlowTotals {
+		f.Totals[i] += connNumber(record, field)
+	}
+	f.Duration += connNumber(record, "duration")
+	if ts := connNumber(record, "ts"); ts > 0 {
+		if f.FirstSeen == 0 || ts < f.FirstSeen {
+			f.FirstSeen = ts
+		}
+		if ts > f.LastSeen {
+			f.LastSeen = ts
+		}
+	}
+}
+
+// adds the conns of another roll-up of the flow to it.
+func (f *ConnFlow) merge(other *ConnFlow) {
+	f.Conns += other.Conns
+	for i := range f.Totals {
+		f.Totals[i] += other.Totals[i]
+	}
+	f.Duration += other.Duration
+	if f.FirstSeen == 0 || other.FirstSeen > 0 && other.FirstSeen < f.FirstSeen {
+		f.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen > f.LastSeen {
+		f.LastSeen = other.LastSeen
+	}
+}
+
+// returns the number field of a conn record holds, or 0 if it is unset or not a number.
+func connNumber(record map[string]interface{}, field string) float64 {
+	value, _ := sqlNumber((&sqlColumn{name: field}).eval(sqlRow{record: record}))
+	return value
+}
+
+// ConnSummary rolls up the conn records of a pull into a flow per originator, responder,
+// responder port and protocol, with the bytes, packets and duration of its conns summed,
+// the most common aggregation of conn logs, without keeping the records.
+type ConnSummary struct {
+	lock  sync.Mutex
+	flows map[string]map[string]*ConnFlow // for each writer key, the flows by their key, joined by tabs.
+}
+
+// returns an empty conn summary.
+func NewConnSummary() *ConnSummary {
+	return &ConnSummary{flows: make(map[string]map[string]*ConnFlow)}
+}
+
+// returns a writer that rolls up the conn records (lines) written to it, JSON records or TSV
+// records after a #fields header, rather than passing them on. Each writer rolls up on its
+// own, and its flows are added to s once it is closed, replacing those of an earlier writer
+// of the same key, such as a task over the same log run again.
+func (s *ConnSummary) Writer(key string) io.WriteCloser {
+	return &connSummaryWriter{s: s, key: key, flows: make(map[string]*ConnFlow)}
+}
+
+// returns a writer that rolls up the conn records written to it like Writer, while also
+// passing them on to w as they are. Closing it does not close w.
+func (s *ConnSummary) Tee(key string, w io.Writer) io.WriteCloser {
+	sw := s.Writer(key).(*connSummaryWriter)
+	sw.w = w
+	return sw
+}
+
+type connSummaryWriter struct {
+	s       *ConnSummary
+	key     string
+	w       io.Writer // passed every record, if set.
+	fields  []string  // fields of the last #fields header, for TSV records
+	flows   map[string]*ConnFlow
+	pending []byte // start of a record whose newline has not been written yet
+}
+
+func (sw *connSummaryWriter) Write(p []byte) (n int, err error) {
+	if sw.w != nil {
+		if n, err = sw.w.Write(p); err != nil {
+			return n, err
+		}
+	}
+	n = len(p)
+	for {
+		end := bytes.IndexByte(p, '\n')
+		if end < 0 {
+			sw.pending = append(sw.pending, p...)
+			return n, nil
+		}
+		sw.pending = append(sw.pending, p[:end]...)
+		sw.add(sw.pending)
+		sw.pending = sw.pending[:0]
+		p = p[end+1:]
+	}
+}
+
+func (sw *connSummaryWriter) Close() error {
+	sw.add(sw.pending)
+	sw.pending = nil
+	sw.s.lock.Lock()
+	defer sw.s.lock.Unlock()
+	sw.s.flows[sw.key] = sw.flows
+	return nil
+}
+
+// adds a conn record to its flow. Records with none of the fields of the key are left out.
+func (sw *connSummaryWriter) add(line []byte) {
+	record, ok := sqlRecord(bytes.TrimRight(line, "\r\n"), &sw.fields)
+	if !ok {
+		return
+	}
+	key, set := make([]string, len(connFlowKey)), false
+	for i, field := range connFlowKey {
+		value := (&sqlColumn{name: field}).eval(sqlRow{record: record})
+		set = set || value != nil
+		key[i] = sqlString(value)
+		if value == nil {
+			key[i] = unsetField
+		}
+	}
+	if !set {
+		return
+	}
+	joined := strings.Join(key, "\t")
+	flow := sw.flows[joined]
+	if flow == nil {
+		flow = &ConnFlow{Key: key}
+		sw.flows[joined] = flow
+	}
+	flow.add(record)
+}
+
+// returns the flows rolled up so far, those with the most bytes first.
+func (s *ConnSummary) Flows() []*ConnFlow {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	merged := make(map[string]*ConnFlow)
+	for _, keyFlows := range s.flows {
+		for key, flow := range keyFlows {
+			if total := merged[key]; total != nil {
+				total.merge(flow)
+			} else {
+				copied := *flow
+				merged[key] = &copied
+			}
+		}
+	}
+	flows := make([]*ConnFlow, 0, len(merged))
+	for _, flow := range merged {
+		flows = append(flows, flow)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].Bytes() != flows[j].Bytes() {
+			return flows[i].Bytes() > flows[j].Bytes()
+		}
+		return strings.Join(flows[i].Key, "\t") < strings.Join(flows[j].Key, "\t")
+	})
+	return flows
+}
+
+// writes the flows rolled up so far as TSV, with a header, those with the most bytes first.
+func (s *ConnSummary) WriteSummary(w io.Writer) error {
+	header := append(append(append([]string{}, connFlowKey...), "conns"), connFlowTotals...)
+	header = append(header, "duration", "first_ts", "last_ts")
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, flow := range s.Flows() {
+		row := append(append([]string{}, flow.Key...), strconv.Itoa(flow.Conns))
+		for _, total := range flow.Totals {
+			row = append(row, strconv.FormatFloat(total, 'f', -1, 64))
+		}
+		row = append(row, strconv.FormatFloat(flow.Duration, 'f', 6, 64), connTime(flow.FirstSeen), connTime(flow.LastSeen))
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns ts as zeek writes it, or unset if there is none.
+func connTime(ts float64) string {
+	if ts == 0 {
+		return unsetField
+	}
+	return strconv.FormatFloat(ts, 'f', 6, 64)
+}
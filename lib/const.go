@@ -7,4 +7,12 @@ const (
 	TimeFormatHuman   = "2006/01/02 15:04:05"
 	TimeFormatDate    = "2006/01/02"
 	TimeFormatDateNum = "2006_01_02_"
+	TimeFormatChunk   = "2006-01-02T15"
+	TimeFormatDay     = "2006-01-02"
+)
+
+// orders to pull the dates of a time range in.
+const (
+	OrderOldestFirst = "oldest-first"
+	OrderNewestFirst = "newest-first"
 )
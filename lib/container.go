@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ContainerEnv, set to true or false, says whether nagini runs in a container, rather than
+// detecting it.
+const ContainerEnv = "NAGINI_CONTAINER"
+
+// ContainerOutputDir is the volume outputs are written under when running in a container, if
+// it is mounted.
+const ContainerOutputDir = "/output"
+
+// files that container runtimes create in the containers they run.
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// cgroup names of the processes of containers, as listed in /proc/1/cgroup.
+var containerCgroups = []string{"docker", "kubepods", "containerd", "libpod", "lxc"}
+
+// returns whether nagini runs in a container, such as under docker, podman or a Kubernetes
+// Job, unless ContainerEnv says otherwise.
+func InContainer() bool {
+	if forced, err := strconv.ParseBool(os.Getenv(ContainerEnv)); err == nil {
+		return forced
+	}
+	// set by systemd-nspawn, podman and images built FROM centos, and by Kubernetes in pods.
+	if os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	cgroup, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, name := range containerCgroups {
+		if strings.Contains(string(cgroup), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the directory the output directories of pulls are created in by default: outputDir
+// from the config if set, otherwise ContainerOutputDir when running in a container with it
+// mounted, otherwise the working directory.
+func DefaultOutputParent(outputDir string) string {
+	if outputDir != "" {
+		return os.ExpandEnv(outputDir)
+	}
+	if InContainer() {
+		if info, err := os.Stat(ContainerOutputDir); err == nil && info.IsDir() {
+			return ContainerOutputDir
+		}
+	}
+	return "."
+}
+
+// returns the environment variable that sets the given global config key, such as
+// NAGINI_ZEEK_LOG_DIR for zeek_log_dir.
+func ConfigEnvVar(key string) string {
+	return "NAGINI_" + strings.ToUpper(key)
+}
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// magic number that zstd compressed source logs start with.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// CheckedReader decompresses a gzipped or zstd compressed source log, or reads a plain one, remembering the first
+// error found mid-stream. A filter reading it only sees its input end early, so the error is
+// the only way to tell a corrupt log apart from a filter that failed on its own.
+type CheckedReader struct {
+	r   io.ReadCloser
+	Err error // first error other than io.EOF, if any.
+}
+
+// starts decompressing r, as zstd if it starts like a zstd frame, such as a .log.zst rotated
+// by a Zeek set to zstd, and as gzip otherwise. zstd logs are read through the zstd command.
+// A log starting like a Zeek log does, with a # header or a JSON record, is read as it is,
+// such as the uncompressed .log files of a test sensor. Returns an error if r does not start
+// with a valid header.
+func NewCheckedReader(r io.Reader) (*CheckedReader, error) {
+	head := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(head[:n]), r)
+	if n > 0 && (head[0] == '#' || head[0] == '{') {
+		return &CheckedReader{r: io.NopCloser(r)}, nil
+	}
+	if bytes.Equal(head[:n], zstdMagic) {
+		zstd, err := newZstdReader(r, "")
+		if err != nil {
+			return nil, err
+		}
+		return &CheckedReader{r: zstd}, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckedReader{r: gz}, nil
+}
+
+func (c *CheckedReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	if err != nil && err != io.EOF && c.Err == nil {
+		c.Err = err
+	}
+	return n, err
+}
+
+func (c *CheckedReader) Close() error {
+	return c.r.Close()
+}
@@ -0,0 +1,16 @@
+package lib
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// returns the time the file's inode last changed, falling back to its modification time.
+func changeTime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec))
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package lib
+
+import (
+	"os"
+	"time"
+)
+
+// change time is not available on this platform, so the modification time is used instead.
+func changeTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
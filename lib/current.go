@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CurrentDir is the directory of a zeek log directory that Zeek writes the logs of the hour in
+// progress to, before rotating them into the date directory.
+const CurrentDir = "current"
+
+// returns the un-rotated log of logType in the current directory of logDir.
+func currentLog(logDir string, logType string) string {
+	return filepath.Join(logDir, CurrentDir, logType+".log")
+}
+
+// returns whether the hour starting at t is in progress, so its logs are still in the current
+// directory rather than rotated.
+func hourInProgress(t time.Time) bool {
+	now := time.Now()
+	return !t.After(now) && t.Add(time.Hour).After(now)
+}
+
+// copies the un-rotated log of logType from the current directory of logDir into dir, as it is
+// while Zeek keeps writing it: up to its size when copied, and without a last record that was
+// only partly written. The copy is named like logType.current.log. Returns an empty path if
+// there is no un-rotated log of logType.
+func snapshotCurrentLog(logDir string, logType string, dir string) (string, error) {
+	src, err := os.Open(currentLog(logDir, logType))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(dir, logType+"."+CurrentDir+".log")
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	w := getWriter(out)
+	lines := newLineReader(&io.LimitedReader{R: src, N: info.Size()})
+	for {
+		line, readErr := lines.next()
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			w.Write(line)
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+			break
+		}
+	}
+	lines.close()
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	putWriter(w)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDictionaryDir is where a zstd dictionary is kept for each log type, unless
+// dictionary_dir in the config file says otherwise. Expanded when used.
+const DefaultDictionaryDir = "$HOME/.local/share/nagini/dictionaries"
+
+// DictionaryExtension is the extension of a zstd dictionary, both in the dictionary directory
+// and next to the outputs compressed with it.
+const DictionaryExtension = ".zdict"
+
+// DefaultDictionarySize is the size in bytes of a trained dictionary, as zstd defaults to.
+const DefaultDictionarySize = 110 << 10
+
+// outputs are cut into blocks of this size to train from, as records of small daily outputs
+// are what a dictionary helps compress.
+const dictionarySampleSize = 4 << 10
+
+// returns the path of the dictionary trained for logType in dir.
+func DictionaryPath(dir string, logType string) string {
+	return filepath.Join(os.ExpandEnv(dir), logType+DictionaryExtension)
+}
+
+// returns the dictionary to compress or decompress the zstd output at path with: the one next
+// to it named for its log type, as ParseLogs copies it there. Empty if there is none.
+func outputDictionary(path string) string {
+	name := filepath.Base(path)
+	if i := strings.IndexAny(name, "-."); i > 0 {
+		name = name[:i]
+	}
+	dictionary := filepath.Join(filepath.Dir(path), name+DictionaryExtension)
+	if info, err := os.Stat(dictionary); err != nil || info.IsDir() {
+		return ""
+	}
+	return dictionary
+}
+
+// copies the dictionary trained for logType in dir next to the outputs in outDir, so they are
+// compressed with it and stay readable if it is trained again. Returns the path of the copy, or
+// an empty string if no dictionary was trained for logType.
+func copyDictionary(dir string, logType string, outDir string) (string, error) {
+	src, err := os.Open(DictionaryPath(dir, logType))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst := filepath.Join(outDir, logType+DictionaryExtension)
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err = copyPooled(out, src); err != nil {
+		out.Close()
+		return "", err
+	}
+	return dst, out.Close()
+}
+
+// trains a zstd dictionary of size bytes for logType from the outputs of past pulls of it, and
+// writes it to dst, renaming it into place once complete. Each of paths is an output file, or
+// an output directory whose files named for logType are used. Compressed outputs are
+// decompressed to train from. Returns the number of outputs trained from.
+func TrainDictionary(logType string, paths []string, dst string, size int) (samples int, err error) {
+	tmp, err := ioutil.TempDir("", "nagini-dictionary")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	args := []string{"--train", "-q", fmt.Sprintf("-B%d", dictionarySampleSize), fmt.Sprintf("--maxdict=%d", size)}
+	for _, output := range dictionarySamples(logType, paths) {
+		if uncompressedName(output) != output {
+			plain := filepath.Join(tmp, fmt.Sprintf("%d-%s", samples, uncompressedName(filepath.Base(output))))
+			if err = decompressOutput(output, plain); err != nil {
+				return samples, fmt.Errorf("%s: %w", output, err)
+			}
+			output = plain
+		}
+		args = append(args, output)
+		samples++
+	}
+	if samples == 0 {
+		return 0, &messageError{T("error.dictionary.samples", logType), ErrNoMatches}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return samples, err
+	}
+	partial := PartialName(dst)
+	zstd := exec.Command("zstd", append(args, "-f", "-o", partial)...)
+	var stderr bytes.Buffer
+	zstd.Stderr = &stderr
+	if err = zstd.Run(); err != nil {
+		os.Remove(partial)
+		return samples, fmt.Errorf("zstd: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return samples, os.Rename(partial, dst)
+}
+
+// returns the output files of logType among paths, looking in the directories of them.
+func dictionarySamples(logType string, paths []string) (outputs []string) {
+	isOutput := func(name string) bool {
+		if IsProvenanceFile(name) {
+			return false
+		}
+		name = uncompressedName(name)
+		ext := filepath.Ext(name)
+		if ext != outputExtension(OutputJSON) && ext != outputExtension(OutputMsgpack) {
+			return false
+		}
+		return name == logType+ext || strings.HasPrefix(name, logType+"-")
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			outputs = append(outputs, path)
+			continue
+		}
+		entries, _ := os.ReadDir(path)
+		for _, entry := range entries {
+			if !entry.IsDir() && isOutput(entry.Name()) {
+				outputs = append(outputs, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	return outputs
+}
+
+// decompresses the output at src into dst.
+func decompressOutput(src string, dst string) error {
+	in, err := openOutput(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = copyPooled(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"errors"
+	"strings"
+)
+
+// sentinel errors that callers can branch on with errors.Is.
+var (
+	// no logs of the requested type exist for the requested time range.
+	ErrNoMatches = errors.New("no matching logs")
+	// the output directory already exists and has files in it.
+	ErrOutputNotEmpty = errors.New("output directory is not empty")
+	// the output directory is being written to by another run of nagini.
+	ErrOutputLocked = errors.New("output directory is locked")
+	// the time range is malformed, or its start is after its end.
+	ErrBadTimeRange = errors.New("bad time range")
+	// a source log could not be decompressed, and corrupt input is not allowed.
+	ErrCorruptInput = errors.New("corrupt source log")
+	// a source log does not match the checksum in its sidecar file.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// a source log has no checksum sidecar file to verify it against.
+	ErrNoChecksum = errors.New("no checksum sidecar")
+)
+
+// an error with a user-facing (possibly translated) message, that still matches the
+// wrapped sentinel error with errors.Is.
+type messageError struct {
+	message string
+	err     error
+}
+
+func (e *messageError) Error() string {
+	return e.message
+}
+
+func (e *messageError) Unwrap() error {
+	return e.err
+}
+
+// ValidationError holds every problem found by a Validator. errors.Is matches it against
+// any of the problems it holds.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	lines := []string{T("validate.failed", len(e.Problems))}
+	for _, problem := range e.Problems {
+		lines = append(lines, "  - "+problem.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	for _, problem := range e.Problems {
+		if errors.Is(problem, target) {
+			return true
+		}
+	}
+	return false
+}
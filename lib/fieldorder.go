@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// orders the fields of output records can be written in, besides a list of fields.
+const (
+	FieldOrderSource       = "source"
+	FieldOrderAlphabetical = "alphabetical"
+)
+
+// FieldOrder is the order the fields of output records are written in: as the source wrote
+// them, alphabetically, or with the fields of First first, in their order, then the rest as
+// the source wrote them.
+type FieldOrder struct {
+	Alphabetical bool
+	First        []string
+}
+
+// ParseFieldOrder parses a field order: source, alphabetical, or a comma separated list of the
+// fields to write first, such as ts,uid,id.orig_h.
+func ParseFieldOrder(order string) (fieldOrder FieldOrder, err error) {
+	switch order {
+	case FieldOrderSource:
+		return fieldOrder, nil
+	case FieldOrderAlphabetical:
+		return FieldOrder{Alphabetical: true}, nil
+	}
+	for _, field := range strings.Split(order, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return FieldOrder{}, errors.New(T("error.fieldorder", order))
+		}
+		fieldOrder.First = append(fieldOrder.First, field)
+	}
+	return fieldOrder, nil
+}
+
+// returns whether records are written with their fields as the source wrote them.
+func (o FieldOrder) Source() bool {
+	return !o.Alphabetical && len(o.First) == 0
+}
+
+// returns the given fields in order. If all is set, fields of First that are not given are
+// included too, so every record has the same leading columns.
+func (o FieldOrder) apply(fields []string, all bool) (ordered []string) {
+	if o.Alphabetical {
+		ordered = append(ordered, fields...)
+		sort.Strings(ordered)
+		return ordered
+	}
+	present := make(map[string]bool)
+	for _, field := range fields {
+		present[field] = true
+	}
+	first := make(map[string]bool)
+	for _, field := range o.First {
+		if (all || present[field]) && !first[field] {
+			ordered = append(ordered, field)
+		}
+		first[field] = true
+	}
+	for _, field := range fields {
+		if !first[field] {
+			ordered = append(ordered, field)
+		}
+	}
+	return ordered
+}
+
+// returns a writer that rewrites the records (lines) written to it with their fields in order
+// before passing them to w. JSON records are written with their keys in order, leaving out
+// listed fields they do not have. The columns of TSV records, and of their #fields and #types
+// headers, are moved, and listed fields they do not have are written unset, so every record
+// has the same leading columns. Other lines are passed through as they are. Close must be
+// called to write a final record without a trailing newline.
+func NewFieldOrderWriter(w io.Writer, order FieldOrder) io.WriteCloser {
+	if order.Source() {
+		return nopWriteCloser{w}
+	}
+	return &fieldOrderWriter{w: w, order: order}
+}
+
+type fieldOrderWriter struct {
+	w       io.Writer
+	order   FieldOrder
+	columns []int  // for each column written, its column in the last #fields header, or -1
+	fields  int    // number of fields of the last #fields header
+	pending []byte // start of a record whose newline has not been written yet
+}
+
+func (ow *fieldOrderWriter) Write(p []byte) (n int, err error) {
+	ow.pending = append(ow.pending, p...)
+	for {
+		end := bytes.IndexByte(ow.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if _, err = io.WriteString(ow.w, ow.rewrite(string(ow.pending[:end]))+"\n"); err != nil {
+			return 0, err
+		}
+		ow.pending = ow.pending[end+1:]
+	}
+}
+
+func (ow *fieldOrderWriter) Close() error {
+	if len(ow.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(ow.w, ow.rewrite(string(ow.pending)))
+	ow.pending = nil
+	return err
+}
+
+// returns the record with its fields in order.
+func (ow *fieldOrderWriter) rewrite(record string) string {
+	switch {
+	case strings.HasPrefix(record, "{"):
+		return ow.rewriteJSON(record)
+	case strings.HasPrefix(record, "#fields\t"):
+		fields := strings.Split(record, "\t")[1:]
+		index := make(map[string]int)
+		for i, field := range fields {
+			index[field] = i
+		}
+		ordered := ow.order.apply(fields, true)
+		ow.fields, ow.columns = len(fields), make([]int, len(ordered))
+		for i, field := range ordered {
+			ow.columns[i] = -1
+			if column, ok := index[field]; ok {
+				ow.columns[i] = column
+			}
+		}
+		return "#fields\t" + strings.Join(ordered, "\t")
+	case strings.HasPrefix(record, "#types\t"):
+		return "#types\t" + ow.rewriteColumns(strings.Split(record, "\t")[1:], "string")
+	case strings.HasPrefix(record, "#"):
+		return record
+	}
+	values := strings.Split(record, "\t")
+	if ow.columns == nil || len(values) != ow.fields {
+		return record
+	}
+	return ow.rewriteColumns(values, unsetField)
+}
+
+// returns the values of a TSV line in the order of the last #fields header, with missing for
+// the columns it does not have.
+func (ow *fieldOrderWriter) rewriteColumns(values []string, missing string) string {
+	if len(values) != ow.fields {
+		return strings.Join(values, "\t")
+	}
+	rewritten := make([]string, len(ow.columns))
+	for i, column := range ow.columns {
+		rewritten[i] = missing
+		if column >= 0 {
+			rewritten[i] = values[column]
+		}
+	}
+	return strings.Join(rewritten, "\t")
+}
+
+// returns a JSON record with its keys in order. Keys and values are written as they are,
+// without decoding them. A record that is not a JSON object is returned as it is.
+func (ow *fieldOrderWriter) rewriteJSON(record string) string {
+	var keys []string
+	var rawKeys, values [][]byte
+	scanned := scanObject([]byte(record), func(key []byte, value []byte) bool {
+		name := string(key)
+		if bytes.IndexByte(key, '\\') >= 0 {
+			// ordered by its name, but written as the source wrote it.
+			quoted := append(append([]byte{'"'}, key...), '"')
+			if json.Unmarshal(quoted, &name) != nil {
+				return false
+			}
+		}
+		// a key given twice keeps its first place, and its last value, as when decoded.
+		for i, seen := range keys {
+			if seen == name {
+				rawKeys[i], values[i] = key, value
+				return true
+			}
+		}
+		keys, rawKeys, values = append(keys, name), append(rawKeys, key), append(values, value)
+		return true
+	})
+	if !scanned {
+		return record
+	}
+
+	index := make(map[string]int, len(keys))
+	for i, key := range keys {
+		index[key] = i
+	}
+	var rewritten bytes.Buffer
+	rewritten.Grow(len(record))
+	rewritten.WriteByte('{')
+	for i, key := range ow.order.apply(keys, false) {
+		if i > 0 {
+			rewritten.WriteByte(',')
+		}
+		rewritten.WriteByte('"')
+		rewritten.Write(rawKeys[index[key]])
+		rewritten.WriteString(`":`)
+		rewritten.Write(values[index[key]])
+	}
+	rewritten.WriteByte('}')
+	return rewritten.String()
+}
@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// HashFields are the fields of files logs holding the hashes of a file.
+var HashFields = []string{"md5", "sha1", "sha256"}
+
+// FileHitFields are the fields of a files log record kept for each file matching a hash, to
+// retrieve it with: its fuid, its hashes, and the name zeek extracted it to, if it did.
+var FileHitFields = []string{"fuid", "md5", "sha1", "sha256", "extracted"}
+
+// returns a jq expression selecting the records of files logs with any of the given hashes,
+// MD5, SHA1 or SHA256, matched regardless of case. Hashes are looked up in an object, so long
+// lists stay fast.
+func FileHashJQ(hashes []string) string {
+	targets := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		targets[strings.ToLower(hash)] = true
+	}
+	encodedTargets, _ := json.Marshal(targets)
+	encodedFields, _ := json.Marshal(HashFields)
+	return fmt.Sprintf(`%s as $targets | select(any(. as $record | %s[] | $record[.]; type == "string" and $targets[ascii_downcase]))`,
+		encodedTargets, encodedFields)
+}
+
+// RetrieveFiles runs command once for each of the given files, rows of the values of
+// FileHitFields, to retrieve the file into dir, such as by copying it from the extract_files
+// directory of its sensor. Every arg of command is a Go template, given the fields of the
+// file and dir, such as {{ .sha256 }} or {{ .dir }}, with unset fields empty. A file that
+// cannot be retrieved is warned about on out, and the rest are still tried. Returns the
+// number of files retrieved.
+func RetrieveFiles(command []string, rows [][]string, dir string, out io.Writer) (retrieved int, err error) {
+	templates := make([]*template.Template, len(command))
+	for i, arg := range command {
+		if templates[i], err = template.New("arg").Option("missingkey=zero").Parse(arg); err != nil {
+			return 0, fmt.Errorf("invalid file_extract_command arg %q: %w", arg, err)
+		}
+	}
+	if err = os.MkdirAll(dir, 0775); err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		values := map[string]string{"dir": dir}
+		for i, field := range FileHitFields {
+			if i < len(row) && row[i] != unsetField {
+				values[field] = row[i]
+			}
+		}
+		args := make([]string, len(templates))
+		for i, t := range templates {
+			var arg strings.Builder
+			if err = t.Execute(&arg, values); err != nil {
+				return retrieved, fmt.Errorf("invalid file_extract_command arg %q: %w", command[i], err)
+			}
+			args[i] = arg.String()
+		}
+		retrieve := exec.Command(args[0], args[1:]...)
+		retrieve.Stdout, retrieve.Stderr = out, out
+		if runErr := retrieve.Run(); runErr != nil {
+			fmt.Fprint(out, T("warn.retrieve", values["fuid"], runErr))
+			continue
+		}
+		retrieved++
+	}
+	return retrieved, nil
+}
@@ -2,9 +2,10 @@ package lib
 
 import (
 	"bufio"
-	"errors"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -15,7 +16,6 @@ import (
 	"time"
 
 	"github.com/cheggaaa/pb"
-	"github.com/spf13/cobra"
 )
 
 // tries to create a directory at the given path.
@@ -26,17 +26,17 @@ import (
 func TryCreateDir(dir string, empty bool) (err error) {
 	dir, err = filepath.Abs(dir)
 	if err != nil {
-		return errors.New(fmt.Sprintf("failed to resolve path %s.", dir))
+		return fmt.Errorf("failed to resolve path %s: %w", dir, err)
 	}
 	dirInfo, err := os.Stat(dir)
 	if os.IsNotExist(err) {
 		// directory exists. See if permissions to use and is non-empty.
 		baseDirInfo, baseDirErr := os.Stat(filepath.Dir(dir))
 		if os.IsNotExist(baseDirErr) {
-			err = errors.New(fmt.Sprintf("cannot use parent directory %s: does not exist.", filepath.Dir(dir)))
+			err = fmt.Errorf("cannot use parent directory %s: %w", filepath.Dir(dir), baseDirErr)
 			return err
 		} else if !baseDirInfo.IsDir() {
-			err = errors.New(fmt.Sprintf("cannot use parent directory %s: exists but is not a directory.", filepath.Dir(dir)))
+			err = fmt.Errorf("cannot use parent directory %s: exists but is not a directory", filepath.Dir(dir))
 			return err
 		}
 
@@ -44,20 +44,28 @@ func TryCreateDir(dir string, empty bool) (err error) {
 
 	} else if !dirInfo.IsDir() {
 		// if exists but is not a directory, error out.
-		err = errors.New("cannot create output directory: file of same name already exists, and is not a directory.")
+		err = fmt.Errorf("cannot create output directory %s: file of same name already exists, and is not a directory", dir)
 	} else {
 		// directory exists. See if permissions to use and is non-empty.
-		f, fErr := os.OpenFile(dir, os.O_RDWR, 0)
+		// directories cannot be opened for writing, so probe with a temp file instead.
+		probe, fErr := ioutil.TempFile(dir, ".nagini-write-test")
 		if fErr != nil {
 			// failed to write to directory, use this error
-			return err
+			return fmt.Errorf("cannot write to directory %s: %w", dir, fErr)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+
+		f, fErr := os.Open(dir)
+		if fErr != nil {
+			return fmt.Errorf("cannot read directory %s: %w", dir, fErr)
 		}
 		defer f.Close()
 
 		if empty {
 			_, dirErr := f.Readdirnames(1)
 			if dirErr != io.EOF {
-				err = errors.New("cannot use specified directory: directory exists and is non-empty.")
+				err = fmt.Errorf("cannot use directory %s: %w", dir, ErrOutputNotEmpty)
 			}
 		}
 	}
@@ -65,140 +73,172 @@ func TryCreateDir(dir string, empty bool) (err error) {
 	return err
 }
 
-// Waits until the given sync group is done. When it finishes, concats all files together of that particular date, and then lets the global sync group know it has finished.
-func ConcatFilesParallelByDate(logType string, inputFiles []string, outputFile, outputDir string, logger *log.Logger, curDate time.Time, wgDate *sync.WaitGroup, wgAll *sync.WaitGroup, bar *pb.ProgressBar) {
+// Waits until the given sync group is done. When it finishes, concats all files together of that particular date.
+// Returns an error if the concatenation failed. If manifest is set, the output is renamed into place once complete and
+// recorded in the manifest at that path.
+func ConcatFilesParallelByDate(logType string, inputFiles []string, outputFile, outputDir string, manifest string, logger *log.Logger, curDate time.Time, wgDate *sync.WaitGroup, bar *pb.ProgressBar) (e error) {
 	// Wait for all log files for this date to finish.
 	wgDate.Wait()
-	defer wgAll.Done()
 	defer bar.Increment()
 
 	logger.Printf("All logs for %s finished. Concatinating into '%s'\n", curDate.Format(TimeFormatDate), outputFile)
 
-	// keep track of concat failures to alert the program.
-	failure := false
-
 	// if no input files, ignore.
 	if len(inputFiles) == 0 {
 		logger.Printf("WARN: No matches for date %s. Skipping.\n", curDate.Format(TimeFormatDate))
 	} else {
-		e := ConcatFiles(logger, inputFiles, outputFile, true, false)
+		if manifest != "" {
+			entry := ManifestEntry{LogType: logType, Date: curDate.Format(TimeFormatDate)}
+			e = ConcatFilesAtomic(logger, inputFiles, outputFile, manifest, entry, true, false)
+		} else {
+			e = ConcatFiles(logger, inputFiles, outputFile, true, false)
+		}
 		if e != nil {
+			e = fmt.Errorf("concat %s: %w", curDate.Format(TimeFormatDate), e)
 			logger.Println("ERROR: ", e)
-			failure = true
 		}
 	}
 
 	// print whether or not we failed to concat the files together.
-	if failure {
+	if e != nil {
 		logger.Printf("FAIL: %s\n", curDate.Format(TimeFormatDate))
 	} else {
 		logger.Printf("SUCCESS: %s\n", curDate.Format(TimeFormatDate))
 	}
+	return e
 }
 
-// takes a list of files and writes them to STDOUT
-func ConcatToStdout(logger *log.Logger, inputFiles []string, deleteInputAfterRead bool, ignoreMissing bool) (e error) {
-	return concatFilesToFd(logger, inputFiles, os.Stdout, deleteInputAfterRead, ignoreMissing)
+// takes a list of files, sorts them and writes them in order to the given writer, such as stdout.
+// if deleteInputAfterRead, also deletes the input after use.
+func ConcatToWriter(logger *log.Logger, inputFiles []string, w io.Writer, deleteInputAfterRead bool, ignoreMissing bool) (e error) {
+	return concatFilesToWriter(logger, inputFiles, w, deleteInputAfterRead, ignoreMissing)
 }
 
 // takes a list of files, sorts them and concats them into a single file. if deleteInputAfterRead, also deletes the input after use.
+// Progress is journaled next to the output file until done, so a concatenation cut short, such as
+// by the process being killed, can be finished with ResumeConcats rather than losing its inputs.
 func ConcatFiles(logger *log.Logger, inputFiles []string, outputFile string, deleteInputAfterRead bool, ignoreMissing bool) (e error) {
-	// try to create outputFile
-	outFd, fcErr := os.Create(outputFile)
-	if fcErr != nil {
-		return fcErr
-	}
-	return concatFilesToFd(logger, inputFiles, outFd, deleteInputAfterRead, ignoreMissing)
+	journal := &concatJournal{Output: outputFile, Inputs: inputFiles, DeleteInputs: deleteInputAfterRead, IgnoreMissing: ignoreMissing}
+	return journal.start(logger)
 }
 
-// takes the given os.File and the list of inputFiles, and writes to it in-order.
+// takes the given writer and the list of inputFiles, and writes to it in-order.
 // used by Concat exported functions.
-func concatFilesToFd(logger *log.Logger, inputFiles []string, outFd *os.File, deleteInputAfterRead bool, ignoreMissing bool) (e error) {
+func concatFilesToWriter(logger *log.Logger, inputFiles []string, w io.Writer, deleteInputAfterRead bool, ignoreMissing bool) (e error) {
 
 	// no error. Sort alphabetically (therefore in time order)
 	sort.Strings(inputFiles)
 
 	// for every input file, concat together.
 	for _, inputFile := range inputFiles {
-		tempFd, err := os.Open(inputFile)
-		if err != nil {
-			if !ignoreMissing {
-				logger.Printf("ERROR: could not read file '%s': %s\n", inputFile, err)
-			}
-			continue
-		}
-		logger.Printf("Concatting %s\n", inputFile)
-
-		// read temp file and write to final output file
-		scanner := bufio.NewScanner(tempFd)
-		for scanner.Scan() {
-			outFd.WriteString(scanner.Text() + "\n")
+		if e = concatFile(logger, inputFile, w, ignoreMissing); e != nil {
+			return e
 		}
 
-		// close temp file as we no longer need it.
-		tempFd.Close()
-
 		// if delete flag is set to true, delete the input file.
 		if deleteInputAfterRead {
-			err = os.Remove(inputFile)
-			if err != nil {
-				logger.Printf("ERROR: could not remove temp file '%s': %s\n", inputFile, err)
-			}
+			removeConcatInput(logger, inputFile)
 		}
 	}
 
-	return outFd.Close()
+	return nil
 }
 
-// parses and verifies arguments that are global to the root command.
-func ParseSharedArgs(cmd *cobra.Command, timeRange string, logDir string, outputDir string, logTypeArg string) (startTime time.Time, endTime time.Time, resolvedOutDir string, resolvedLogDir string, logType string) {
-	// build time range timestamps
-	var dateStrings = strings.Split(timeRange, "-")
-	startTime, startErr := time.Parse(TimeFormatShort, dateStrings[0])
-	endTime, endErr := time.Parse(TimeFormatShort, dateStrings[1])
-
-	// if failed to generate timestamp values, error out
-	if startErr != nil || endErr != nil {
-		cmd.PrintErrln("error: Provided dates malformed. Please provide dates in the following format: YYYY/MM/DD:HH-YYYY/MM/DD:HH")
-		os.Exit(1)
-	}
-
-	// try to resolve output directory, see if it is valid input.
-	resolvedOutDir, e := filepath.Abs(outputDir)
-	if e != nil {
-		cmd.PrintErrln("error: could not resolve relative path in user provided input.")
-		os.Exit(1)
+// writes the given input file to w, decompressed if it was compressed as it was written. A
+// missing file is skipped, and logged unless ignoreMissing.
+func concatFile(logger *log.Logger, inputFile string, w io.Writer, ignoreMissing bool) (e error) {
+	tempFd, err := openOutput(inputFile)
+	if err != nil {
+		if !ignoreMissing {
+			logger.Printf("ERROR: could not read file '%s': %s\n", inputFile, err)
+		}
+		return nil
 	}
+	logger.Printf("Concatting %s\n", inputFile)
 
-	// try to resolve zeek log dir and see if exists and is real dir.
-	resolvedLogDir, e = filepath.Abs(logDir)
-	if e != nil {
-		cmd.PrintErrln("error: could not resolve relative path in user provided input.")
-		os.Exit(1)
-	}
-	logDirInfo, e := os.Stat(resolvedLogDir)
-	if os.IsNotExist(e) || !logDirInfo.IsDir() {
-		cmd.PrintErrf("error: invalid Zeek log directory %s, either does not exist or is not a directory.\n", resolvedLogDir)
-		os.Exit(1)
+	// read temp file and write to final output file. msgpack records are not lines, so
+	// they are copied as they are.
+	if filepath.Ext(uncompressedName(inputFile)) == outputExtension(OutputMsgpack) {
+		_, e = copyPooled(w, tempFd)
+	} else {
+		// every line is written ending in a newline, without any carriage return before it.
+		lines, out := newLineReader(tempFd), getWriter(w)
+		for e == nil {
+			line, readErr := lines.next()
+			if len(line) > 0 {
+				out.Write(bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")))
+				e = out.WriteByte('\n')
+			}
+			if readErr != nil {
+				break
+			}
+		}
+		if e == nil {
+			e = out.Flush()
+		}
+		putWriter(out)
+		lines.close()
 	}
 
-	// TODO: add logType verification
-	logType = logTypeArg
+	// close temp file as we no longer need it.
+	tempFd.Close()
+	return e
+}
 
-	return
+// deletes an input file once it has been concatenated.
+func removeConcatInput(logger *log.Logger, inputFile string) {
+	if err := os.Remove(inputFile); err != nil && !os.IsNotExist(err) {
+		logger.Printf("ERROR: could not remove temp file '%s': %s\n", inputFile, err)
+	}
 }
 
-// takes a log type, time range, zeek log directory, thread information, and output directory info.
+// takes a runtime config with the log type, time range, zeek log directory, thread information, and output directory info.
 // it then parses logs based on the logHandler and then outputs the files to the given directory, all parallelized.
-func ParseLogs(cmd *cobra.Command, logHandler func(string, string, time.Time, *sync.WaitGroup, *pb.ProgressBar), logger *log.Logger, startTime time.Time, endTime time.Time, logType string, resolvedLogDir string, resolvedOutDir string, threads int, singleFile bool, writeStdout bool) {
+// user-facing progress messages are written to out, and output is written to stdout if rc.WriteStdout. Returns an error if the output could not be
+// created, or if any date failed to be written.
+func ParseLogs(stdout io.Writer, out io.Writer, logHandler func(string, string, time.Time, *sync.WaitGroup, *pb.ProgressBar), logger *log.Logger, rc RuntimeConfig) (e error) {
+	// unpack the runtime config.
+	logType := rc.LogType
+	resolvedLogDir, resolvedOutDir := rc.LogDir, rc.OutDir
+	threads, singleFile, writeStdout := rc.Threads, rc.SingleFile, rc.WriteStdout
+
 	var taskCount = 0
 
-	// create the output directory.
-	e := TryCreateDir(resolvedOutDir, true)
+	// create the output directory, and any missing parents.
+	e = os.MkdirAll(filepath.Dir(resolvedOutDir), 0775)
 	if e != nil {
-		cmd.PrintErrln(e)
-	} else {
-		logger.Printf("created dir %s\n", resolvedOutDir)
+		return e
+	}
+	e = TryCreateDir(resolvedOutDir, true)
+	if e != nil {
+		return e
+	}
+	logger.Printf("created dir %s\n", resolvedOutDir)
+
+	// another run given the same output directory would corrupt the temp files of this one.
+	lock, e := LockDir(resolvedOutDir)
+	if e != nil {
+		return e
+	}
+	defer lock.Unlock()
+	// marks the directory as an output, so prune can tell it from other directories. With
+	// --stdout, it is only a temp directory, removed once done.
+	if !writeStdout {
+		if e = ioutil.WriteFile(filepath.Join(resolvedOutDir, OutputMarker), nil, 0644); e != nil {
+			return e
+		}
+	}
+
+	// outputs are compressed with the dictionary trained for the log type, if any, from a copy
+	// kept with them so they can be read once it is trained again.
+	if rc.Compress == CompressZstd && rc.DictionaryDir != "" {
+		dictionary, e := copyDictionary(rc.DictionaryDir, logType, resolvedOutDir)
+		if e != nil {
+			return e
+		}
+		if dictionary != "" {
+			fmt.Fprint(out, T("run.dictionary", dictionary))
+		}
 	}
 
 	var outputFiles []string
@@ -206,79 +246,279 @@ func ParseLogs(cmd *cobra.Command, logHandler func(string, string, time.Time, *s
 	// set parallel routine thread limit
 	runtime.GOMAXPROCS(threads)
 
-	// time iterators
-	curDate := startTime.Truncate(24 * time.Hour) // start at this date, at 00:00:00
-	curTime := startTime                          // start at this hour
+	// the days of the pull, and the logs found for each, are those of its task manifest if
+	// given, and are otherwise found before any is pulled, below.
+	days := pullDays(rc)
+	var found [][]foundLog
+	if rc.Tasks != nil {
+		if days, found, e = rc.Tasks.found(); e != nil {
+			return e
+		}
+	}
+
+	// logs of a range that includes now may still be written or rotated, so only those listed
+	// before the pull starts are read, and any that change while read are reported, or read
+	// again if asked to.
+	var snapshot *LogSnapshot
+	if IncludesNow(rc) && rc.Tasks == nil {
+		if snapshot, e = TakeLogSnapshot(rc); e != nil {
+			return e
+		}
+	}
+
+	// with a grace period for late logs, the date directories are watched from before they are
+	// first listed, so no log is missed in between.
+	var late *lateWatcher
+	if rc.WaitLate > 0 {
+		if late, e = newLateWatcher(resolvedLogDir, days, logger); e != nil {
+			return e
+		}
+		defer late.Close()
+	}
+
+	// un-rotated logs of the hour in progress are copied into a directory of their own, so they
+	// are read as they were while Zeek keeps writing them, and removed once the pull is done.
+	var currentDir string
+	if rc.Current {
+		if currentDir, e = ioutil.TempDir("", "nagini-current"); e != nil {
+			return e
+		}
+		defer os.RemoveAll(currentDir)
+	}
+
+	// the logs of every date are found before any is pulled, so the task bar starts with its
+	// total rather than growing as each date is reached, and only moves forward. Only logs
+	// found once the pull is underway, late or read again, still add to it.
+	if rc.Tasks == nil {
+		found = make([][]foundLog, len(days))
+		for i, day := range days {
+			found[i] = discoverDay(rc, day, snapshot, late != nil, currentDir != "", logger)
+		}
+	}
+	for _, logs := range found {
+		taskCount += len(logs)
+	}
 
 	// progress bars init
-	dayCount := int(
-		endTime.Sub(startTime).Hours()/24.0,
-	) + 1 // calculate total number of days
+	dayCount := len(days)
 	barPool, dayBar, taskBar := InitBars(dayCount, taskCount, logger)
 
 	// holds wait interface for all routines to finish.
 	var wgAll sync.WaitGroup
 
+	// dates that failed to be written, guarded by failedLock.
+	var failedDates []string
+	var failedLock sync.Mutex
+
+	// bounds the number of tasks running at once. Tasks take a slot in the order they are
+	// queued, so the dates queued first are also finished first.
+	slots := rc.Throttle
+	if slots == nil {
+		slots = NewThrottle(threads)
+	}
+
+	// with a manifest, only the outputs left once the pull is done are recorded in it, so the
+	// outputs of each date are not when they are concatenated into one.
+	var manifest, dateManifest string
+	if rc.Manifest {
+		manifest = filepath.Join(resolvedOutDir, ManifestFile)
+		if !singleFile {
+			dateManifest = manifest
+		}
+	}
+
+	// with compression, the outputs left once the pull is done are concatenated under their
+	// partial names, and only appear once compressed. The output of each date is compressed in
+	// a task slot as soon as it is done, while the other dates are still pulled.
+	compressDates := rc.Compress != "" && !singleFile && !writeStdout
+
+	// Parquet outputs are the same: the output of each date is concatenated under its partial
+	// name, then converted into its partition in a task slot.
+	parquetDates := rc.OutputFormat == OutputParquet && !singleFile && !writeStdout
+
+	// with CompressOutput, every output is compressed as it is written instead, down to those
+	// of each task, so none is ever left uncompressed on disk.
+	var outputCompression string
+	if rc.CompressOutput != "" {
+		outputCompression = compressedExtension(rc.CompressOutput)
+	}
+
+	// counts logs found once the pull is underway into the task bar.
+	var taskLock sync.Mutex
+	addTasks := func(count int) {
+		taskLock.Lock()
+		defer taskLock.Unlock()
+		taskCount += count
+		taskBar.SetTotal(taskCount)
+		taskBar.Update()
+	}
+
+	// queues a task running the handler over logFile, returning the output it is written to.
+	queueTask := func(logFile string, curTime time.Time, wgDate *sync.WaitGroup) string {
+		logRoot := resolvedLogDir
+		if rc.ExtractDir != "" && strings.HasPrefix(logFile, rc.ExtractDir+string(filepath.Separator)) {
+			logRoot = rc.ExtractDir
+		}
+		outputFileTemp := filepath.Join(resolvedOutDir, taskOutputName(logRoot, logFile, curTime, rc.OutputFormat)+outputCompression)
+
+		// wait for a free slot, then handle logs based on given input of a log file and a
+		// place to output the data, also given the current hour we are looking at, a sync
+		// group to sync on, and a task bar to update. The handler syncs on a group of its
+		// own, so its slot can be freed as soon as it is done.
+		slots.Acquire()
+		wgDate.Add(1)
+		var wgTask sync.WaitGroup
+		logHandler(logFile, outputFileTemp, curTime, &wgTask, taskBar)
+		go func() {
+			wgTask.Wait()
+			if snapshot != nil && snapshot.Listed(logFile) && snapshot.Changed(logFile) {
+				// the log is read again in the same slot, over the same output.
+				reprocessed := false
+				if rc.OnChange == ChangeReprocess {
+					addTasks(1)
+					var wgRetry sync.WaitGroup
+					logHandler(logFile, outputFileTemp, curTime, &wgRetry, taskBar)
+					wgRetry.Wait()
+					reprocessed = !snapshot.Changed(logFile)
+				}
+				if rc.Report != nil {
+					rc.Report.AddChanged(logFile, reprocessed)
+				}
+			}
+			slots.Release()
+			wgDate.Done()
+		}()
+		return outputFileTemp
+	}
+
 	// for each date
-	for curDate.Before(endTime) || curDate.Equal(endTime) {
+	for i, day := range days {
+		curDate := day.Start.Truncate(24 * time.Hour)
 		// holds wait interface for all routines of this particular day.
 		var wgDate sync.WaitGroup
-		var tempFiles []string
-		// for each hour of that date, excluding the last date where we may end early.
-		for curTime.Before(curDate.AddDate(0, 0, 1)) && (curTime.Before(endTime) || curTime.Equal(endTime)) {
-			// find all input files that match this hour
-			inputFileGlob := fmt.Sprintf("%s/%04d-%02d-%02d/%s.%02d*", resolvedLogDir, curTime.Year(), curTime.Month(), curTime.Day(), logType, curTime.Hour())
-			logFileMatches, e := filepath.Glob(inputFileGlob)
-			if e != nil {
-				logger.Printf("ERROR (%s): %s\n", curTime.Format(TimeFormatHuman), e)
+		var tempFiles, logFiles []string
+		handled := make(map[string]bool)
+		// for every found log file, run the script.
+		for _, task := range found[i] {
+			if !task.current {
+				handled[task.file] = true
+				logFiles = append(logFiles, task.file)
+				tempFiles = append(tempFiles, queueTask(task.file, task.hour, &wgDate))
 				continue
 			}
-			taskCount += len(logFileMatches) // set total number of found log files, plus one for the concatenation step.
-			taskBar.SetTotal(taskCount)      // set new total on bar to include found log files
-			taskBar.Update()
-
-			// for every found log file, run the script.
-			for _, logFile := range logFileMatches {
-				outputFileTemp := filepath.Join(
-					resolvedOutDir,
-					curTime.Format(TimeFormatDateNum)+filepath.Base(logFile)+".json",
-				)
-				tempFiles = append(tempFiles, outputFileTemp)
-
-				// handle logs based on given input of a log file and a place to output the data,
-				// also given the current hour we are looking at, a sync group to sync on, and a
-				// task bar to update.
-				logHandler(logFile, outputFileTemp, curTime, &wgDate, taskBar)
+			// the hour in progress is not rotated yet, so it is read from the current directory.
+			logFile, e := snapshotCurrentLog(resolvedLogDir, logType, currentDir)
+			if e != nil {
+				logger.Printf("ERROR (%s): %s\n", task.hour.Format(TimeFormatHuman), e)
 			}
-			curTime = curTime.Add(time.Hour)
+			if e != nil || logFile == "" {
+				taskBar.Increment()
+				continue
+			}
+			fmt.Fprint(out, T("run.current", currentLog(resolvedLogDir, logType)))
+			logFiles = append(logFiles, logFile)
+			tempFiles = append(tempFiles, queueTask(logFile, task.hour, &wgDate))
 		}
 
 		// wait for all date's to finish each log and then for them to concat into a single file.
 		wgAll.Add(1)
 
 		// determine output file and concat all temp files by date to it.
-		outputFile := filepath.Join(
-			resolvedOutDir,
-			fmt.Sprintf("%s-%04d-%02d-%02d.json", logType, curDate.Year(), curDate.Month(), curDate.Day()),
-		)
+		outputFile := filepath.Join(resolvedOutDir, dateOutputName(rc, curDate))
 		outputFiles = append(outputFiles, outputFile)
-		go ConcatFilesParallelByDate(logType, tempFiles, outputFile, resolvedOutDir, logger, curDate, &wgDate, &wgAll, dayBar)
-
-		// iterate to next date
-		curDate = curDate.AddDate(0, 0, 1)
+		go func(day TimeChunk, tempFiles []string, logFiles []string, handled map[string]bool, outputFile string, curDate time.Time, wgDate *sync.WaitGroup) {
+			defer wgAll.Done()
+			if late != nil {
+				// logs delivered late are queued with the rest of the date, before it is finished.
+				late.watchDay(rc, day, handled, func(logFile string, curTime time.Time) {
+					logger.Printf("late log %s\n", logFile)
+					if rc.Report != nil {
+						rc.Report.AddLate(logFile)
+					}
+					addTasks(1)
+					logFiles = append(logFiles, logFile)
+					tempFiles = append(tempFiles, queueTask(logFile, curTime, wgDate))
+				})
+			}
+			if rc.FailOnCorrupt && rc.Report != nil {
+				// a corrupt log fails the pull, so no output of its date is built from the
+				// rest of the date, or handed on, such as to be uploaded.
+				wgDate.Wait()
+				if rc.Report.anyCorrupt(logFiles) {
+					for _, tempFile := range tempFiles {
+						os.Remove(tempFile)
+					}
+					return
+				}
+			}
+			concatOutput, concatManifest := outputFile, dateManifest
+			if compressDates || parquetDates {
+				concatOutput, concatManifest = PartialName(outputFile), ""
+			}
+			e := ConcatFilesParallelByDate(logType, tempFiles, concatOutput, resolvedOutDir, concatManifest, logger, curDate, wgDate, dayBar)
+			if e == nil && len(tempFiles) > 0 {
+				finalOutput := concatOutput
+				if compressDates {
+					entry := ManifestEntry{LogType: logType, Date: curDate.Format(TimeFormatDate)}
+					if finalOutput, e = compressOutput(concatOutput, outputFile, rc.Compress, slots, dateManifest, entry); e != nil {
+						logger.Println("ERROR: ", e)
+					}
+				} else if parquetDates {
+					entry := ManifestEntry{LogType: logType, Date: curDate.Format(TimeFormatDate)}
+					if finalOutput, e = parquetOutput(concatOutput, ParquetPartition(resolvedOutDir, logType, curDate), slots, dateManifest, entry); e != nil {
+						logger.Println("ERROR: ", e)
+					}
+				}
+				if e == nil && finalOutput != "" && rc.OnDayDone != nil {
+					// the output of this date is final, and is not removed until every date is done.
+					rc.OnDayDone(curDate, finalOutput)
+				}
+			}
+			if e != nil {
+				failedLock.Lock()
+				failedDates = append(failedDates, curDate.Format(TimeFormatDate))
+				failedLock.Unlock()
+			}
+		}(day, tempFiles, logFiles, handled, outputFile, curDate, &wgDate)
 	}
 
+	// dates may have been pulled newest first, but output is always written oldest first.
+	sort.Strings(outputFiles)
+
 	// wait for each day's go routine to finish. When done, exit!
 	logger.Println("All routines queued. Waiting for them to finish.")
 
+	if late != nil {
+		logger.Printf("waiting %s for late logs\n", rc.WaitLate)
+		late.start(rc.WaitLate)
+	}
+
 	wgAll.Wait()
+	defer barPool.Stop()
+
+	if len(failedDates) > 0 {
+		sort.Strings(failedDates)
+		return fmt.Errorf("failed to write output for %d date(s): %s", len(failedDates), strings.Join(failedDates, ", "))
+	}
+
+	// stop before writing anything final if corrupt logs are not allowed. The dates they are
+	// in were not written.
+	if rc.FailOnCorrupt && rc.Report != nil {
+		if corrupt := rc.Report.CorruptFiles(); len(corrupt) > 0 {
+			var names []string
+			for _, c := range corrupt {
+				names = append(names, c.LogFile)
+			}
+			return &messageError{T("error.corrupt", len(corrupt), strings.Join(names, ", ")), ErrCorruptInput}
+		}
+	}
 
 	// if we want to write to stdout, concat output directory, write to std, then delete output directory.
 	if writeStdout {
 		// read all output to stdout
-		e = ConcatToStdout(logger, outputFiles, true, true)
+		e = ConcatToWriter(logger, outputFiles, stdout, true, true)
 		if e != nil {
-			cmd.PrintErrln(e)
+			return e
 		}
 
 		// delete output dir, if possible.
@@ -288,12 +528,229 @@ func ParseLogs(cmd *cobra.Command, logHandler func(string, string, time.Time, *s
 		}
 	} else if singleFile {
 		// not stdout and singleFile flag set, so we should write to a single file.
-		cmd.Printf("Concat flag set. Concatting all output into a single %s.json file.\n", logType)
-		e = ConcatFiles(logger, outputFiles, filepath.Join(resolvedOutDir, fmt.Sprintf("%s.json", logType)), true, true)
+		singleName := logType + outputExtension(rc.OutputFormat) + outputCompression
+		fmt.Fprint(out, T("run.concat", singleName))
+		singleOutput := filepath.Join(resolvedOutDir, singleName)
+		if rc.Compress != "" {
+			e = ConcatFiles(logger, outputFiles, PartialName(singleOutput), true, true)
+			if e == nil {
+				_, e = compressOutput(PartialName(singleOutput), singleOutput, rc.Compress, nil, manifest, ManifestEntry{LogType: logType})
+			}
+		} else if manifest != "" {
+			e = ConcatFilesAtomic(logger, outputFiles, singleOutput, manifest, ManifestEntry{LogType: logType}, true, true)
+		} else {
+			e = ConcatFiles(logger, outputFiles, singleOutput, true, true)
+		}
 		if e != nil {
-			cmd.PrintErrln(e)
+			return e
 		}
 	}
 
-	barPool.Stop()
+	return nil
+}
+
+// returns the name of the output file of the date of a pull with rc.
+func dateOutputName(rc RuntimeConfig, date time.Time) string {
+	name := fmt.Sprintf("%s-%04d-%02d-%02d%s", rc.LogType, date.Year(), date.Month(), date.Day(), outputExtension(rc.OutputFormat))
+	if rc.CompressOutput != "" {
+		name += compressedExtension(rc.CompressOutput)
+	}
+	return name
+}
+
+// a log found for an hour of a pull, before it is pulled.
+type foundLog struct {
+	file    string
+	hour    time.Time
+	current bool // the un-rotated log of the hour in progress, copied once it is reached
+}
+
+// returns the logs of day that a pull with rc reads, in the order it reads them. Logs that
+// appeared since snapshot are left out, unless late logs are watched for, and the log of the
+// hour in progress is included if current is set.
+func discoverDay(rc RuntimeConfig, day TimeChunk, snapshot *LogSnapshot, late bool, current bool, logger *log.Logger) (logs []foundLog) {
+	// for each hour of that date, excluding the first and last date where we may start late or end early.
+	for curTime := day.Start; !curTime.After(day.End); curTime = curTime.Add(time.Hour) {
+		if !includesHour(rc, curTime) {
+			continue
+		}
+		// find all input files that match this hour
+		logFileMatches, e := hourLogs(rc.LogDir, rc.ExtractDir, rc.LogType, curTime, rc.Cluster, rc.Listing)
+		if e != nil {
+			logger.Printf("ERROR (%s): %s\n", curTime.Format(TimeFormatHuman), e)
+			continue
+		}
+		logFileMatches = selectByFileTime(withoutSidecars(logFileMatches), rc)
+		// logs that appeared since the snapshot are left to the late watcher, if any.
+		if snapshot != nil && !late {
+			logFileMatches = selectListed(logFileMatches, snapshot, rc)
+		}
+		for _, logFile := range logFileMatches {
+			logs = append(logs, foundLog{file: logFile, hour: curTime})
+		}
+		if current && hourInProgress(curTime) {
+			logs = append(logs, foundLog{hour: curTime, current: true})
+		}
+	}
+	return logs
+}
+
+// compresses the finished output src into outputFile, with the extension of format added, in
+// a slot of slots if given. If manifest is set, the compressed output is then recorded in the
+// manifest at that path as entry. Returns the compressed output.
+func compressOutput(src string, outputFile string, format string, slots *Throttle, manifest string, entry ManifestEntry) (dst string, e error) {
+	dst, e = filepath.Abs(outputFile + compressedExtension(format))
+	if e != nil {
+		return "", e
+	}
+	if slots != nil {
+		slots.Acquire()
+		e = CompressFile(src, dst, format)
+		slots.Release()
+	} else {
+		e = CompressFile(src, dst, format)
+	}
+	if e != nil {
+		return "", fmt.Errorf("compress %s: %w", filepath.Base(dst), e)
+	}
+	if manifest != "" {
+		entry.Path = dst
+		return dst, recordOutput(manifest, entry)
+	}
+	return dst, nil
+}
+
+// converts the finished output src into the Parquet file outputFile, in a slot of slots. If
+// manifest is set and src had records, outputFile is then recorded in the manifest at that
+// path as entry. Returns the Parquet file, or "" if src had no records to write to it.
+func parquetOutput(src string, outputFile string, slots *Throttle, manifest string, entry ManifestEntry) (string, error) {
+	dst, e := filepath.Abs(outputFile)
+	if e != nil {
+		return "", e
+	}
+	slots.Acquire()
+	written, e := WriteParquet(src, dst)
+	slots.Release()
+	if e != nil {
+		return "", fmt.Errorf("write %s: %w", filepath.Base(dst), e)
+	}
+	if !written {
+		return "", nil
+	}
+	if manifest != "" {
+		entry.Path = dst
+		return dst, recordOutput(manifest, entry)
+	}
+	return dst, nil
+}
+
+// returns the files listed in snapshot, counting the rest in rc.Report.
+func selectListed(files []string, snapshot *LogSnapshot, rc RuntimeConfig) (listed []string) {
+	for _, file := range files {
+		if snapshot.Listed(file) {
+			listed = append(listed, file)
+		} else if rc.Report != nil {
+			rc.Report.AddAppeared(file)
+		}
+	}
+	return listed
+}
+
+// returns every date of the time range of rc, each with the first and last hour to pull
+// from it, in the order to pull them in.
+func pullDays(rc RuntimeConfig) (days []TimeChunk) {
+	start, end := sensorRange(rc)
+	for curDate := start.Truncate(24 * time.Hour); !curDate.After(end); curDate = curDate.AddDate(0, 0, 1) {
+		day := TimeChunk{curDate, curDate.Add(23 * time.Hour)}
+		if day.Start.Before(start) {
+			day.Start = start
+		}
+		if day.End.After(end) {
+			day.End = end
+		}
+		days = append(days, day)
+	}
+	if rc.NewestFirst {
+		for i, j := 0, len(days)-1; i < j; i, j = i+1, j-1 {
+			days[i], days[j] = days[j], days[i]
+		}
+	}
+	return days
+}
+
+// returns every log that a pull with rc would read, in the order it would read them, without
+// reading them: those of rc.Tasks if set. Logs skipped for their file time are recorded in
+// rc.Report, if set.
+func PullLogs(rc RuntimeConfig) (logFiles []string, err error) {
+	if rc.Tasks != nil {
+		return rc.Tasks.logs(), nil
+	}
+	for _, day := range pullDays(rc) {
+		for curTime := day.Start; !curTime.After(day.End); curTime = curTime.Add(time.Hour) {
+			if !includesHour(rc, curTime) {
+				continue
+			}
+			hour, err := hourLogs(rc.LogDir, rc.ExtractDir, rc.LogType, curTime, rc.Cluster, rc.Listing)
+			if err != nil {
+				return logFiles, err
+			}
+			logFiles = append(logFiles, selectByFileTime(withoutSidecars(hour), rc)...)
+		}
+	}
+	return logFiles, nil
+}
+
+// returns the given files, leaving out checksum sidecars that sit next to the logs.
+func withoutSidecars(files []string) (logFiles []string) {
+	for _, file := range files {
+		if !strings.HasSuffix(file, ChecksumSuffix) {
+			logFiles = append(logFiles, file)
+		}
+	}
+	return logFiles
+}
+
+// does a tiny pull to make sure the given zeek log directory is usable: finds the most
+// recent date directory, picks the first log of the given type in it, and reads up to
+// maxRecords records from it. Returns the file read and the number of records found.
+func ValidationPull(logDir string, logType string, maxRecords int) (logFile string, records int, err error) {
+	dates, err := filepath.Glob(filepath.Join(logDir, "[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]"))
+	if err != nil {
+		return "", 0, err
+	}
+	if len(dates) == 0 {
+		return "", 0, fmt.Errorf("no date directories (YYYY-MM-DD) found in %s: %w", logDir, ErrNoMatches)
+	}
+	sort.Strings(dates)
+
+	// walk back from the newest date until one has logs of this type.
+	var matches []string
+	for i := len(dates) - 1; i >= 0 && len(matches) == 0; i-- {
+		matches, _ = filepath.Glob(filepath.Join(dates[i], logType+".*"))
+	}
+	if len(matches) == 0 {
+		return "", 0, fmt.Errorf("no %s logs found in %s: %w", logType, logDir, ErrNoMatches)
+	}
+	sort.Strings(matches)
+	logFile = matches[0]
+
+	fd, err := os.Open(logFile)
+	if err != nil {
+		return logFile, 0, err
+	}
+	defer fd.Close()
+	reader, err := NewCheckedReader(fd)
+	if err != nil {
+		return logFile, 0, err
+	}
+	defer reader.Close()
+
+	// count records, skipping zeek TSV header lines.
+	scanner := bufio.NewScanner(reader)
+	for records < maxRecords && scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "#") {
+			records++
+		}
+	}
+	return logFile, records, scanner.Err()
 }
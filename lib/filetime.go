@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"os"
+)
+
+// returns true if the given file was modified (or changed, if useCtime) within the file time
+// window of rc. A zero ModifiedSince or ModifiedBefore leaves that side of the window open.
+// Files that cannot be checked are kept, so they are reported by whatever reads them.
+func inFileTimeWindow(file string, rc RuntimeConfig) bool {
+	if rc.ModifiedSince.IsZero() && rc.ModifiedBefore.IsZero() {
+		return true
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return true
+	}
+	fileTime := info.ModTime()
+	if rc.UseCtime {
+		fileTime = changeTime(info)
+	}
+	if !rc.ModifiedSince.IsZero() && fileTime.Before(rc.ModifiedSince) {
+		return false
+	}
+	if !rc.ModifiedBefore.IsZero() && !fileTime.Before(rc.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// returns the files within the file time window of rc, counting the rest in rc.Report.
+func selectByFileTime(files []string, rc RuntimeConfig) (selected []string) {
+	for _, file := range files {
+		if inFileTimeWindow(file, rc) {
+			selected = append(selected, file)
+		} else if rc.Report != nil {
+			rc.Report.AddOutsideFileTime(file)
+		}
+	}
+	return selected
+}
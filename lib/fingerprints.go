@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FingerprintFields are the fields of ssl and quic logs holding TLS fingerprints, where the
+// zeek ja3 and ja4 packages are loaded.
+var FingerprintFields = []string{"ja3", "ja3s", "ja4", "ja4s"}
+
+// fields of the records written by FingerprintJQ.
+const (
+	FingerprintTypeField = "fingerprint_type"
+	FingerprintField     = "fingerprint"
+)
+
+// reads the targets listed in the file at path, one per line, such as fingerprints or
+// hashes. Blank lines and lines starting with # are skipped.
+func ReadTargets(path string) (targets []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read targets %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			targets = append(targets, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read targets %s: %w", path, err)
+	}
+	return targets, nil
+}
+
+// returns a jq expression that, for each fingerprint field of a record holding one of the
+// given fingerprints, outputs an object of the field and the fingerprint, such as
+// {"fingerprint_type":"ja3","fingerprint":"e7d705a3286e19ea42f587b344ee6865"}. Fingerprints
+// are matched regardless of case, and looked up in an object, so long lists stay fast.
+func FingerprintJQ(fingerprints []string) string {
+	targets := make(map[string]bool, len(fingerprints))
+	for _, fingerprint := range fingerprints {
+		targets[strings.ToLower(fingerprint)] = true
+	}
+	encodedTargets, _ := json.Marshal(targets)
+	encodedFields, _ := json.Marshal(FingerprintFields)
+	return fmt.Sprintf(`%s as $targets | . as $record | %s[] | select(($record[.] | type) == "string" and $targets[$record[.] | ascii_downcase]) | {%s: ., %s: $record[.]}`,
+		encodedTargets, encodedFields, FingerprintTypeField, FingerprintField)
+}
@@ -0,0 +1,157 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultHistoryFile is where finished pulls are recorded, unless history_file in the config
+// file says otherwise. Expanded when used.
+const DefaultHistoryFile = "$HOME/.local/share/nagini/history.jsonl"
+
+// number of the most recent matching pulls that an estimate is made from.
+const historyRuns = 20
+
+// HistoryEntry is a finished pull, recorded in the history file as a JSON object per line, to
+// estimate later pulls with the same filter from.
+type HistoryEntry struct {
+	Time        time.Time `json:"time"`         // when the pull finished
+	LogType     string    `json:"log_type"`     // log type pulled
+	Filter      string    `json:"filter"`       // command and its args, or jq expression
+	Threads     int       `json:"threads"`      // threads the pull ran with
+	InputBytes  int64     `json:"input_bytes"`  // compressed size of the logs read
+	OutputBytes int64     `json:"output_bytes"` // size of the output directory, if not written to stdout
+	Stdout      bool      `json:"stdout"`       // written to stdout, so OutputBytes is unknown
+	Seconds     float64   `json:"seconds"`      // time taken, from confirming to the end of the pull
+}
+
+// RunEstimate is the expected duration and output size of a pull, from past pulls.
+type RunEstimate struct {
+	Duration       time.Duration
+	OutputBytes    int64   // -1 if every past pull wrote to stdout
+	BytesPerSecond float64 // compressed input read per second by past pulls
+	Runs           int     // past pulls the estimate is made from
+}
+
+// appends entry to the history file at path, creating it and its directory if needed.
+func AppendHistory(path string, entry HistoryEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoded, _ := json.Marshal(entry)
+	if _, err = f.Write(append(encoded, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// reads the pulls recorded in the history file at path, oldest first. A missing file has no
+// pulls, and lines that cannot be read, such as one cut short, are skipped.
+func ReadHistory(path string) (entries []HistoryEntry, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// estimates how long a pull of inputBytes of logs of logType through filter takes, and how
+// much it writes, from the throughput and output ratio of the most recent past pulls of the
+// same log type and filter. Returns false if there are none to go by.
+func EstimateRun(history []HistoryEntry, logType string, filter string, inputBytes int64) (estimate RunEstimate, ok bool) {
+	var input, written, writtenInput int64
+	var seconds float64
+	for i := len(history) - 1; i >= 0 && estimate.Runs < historyRuns; i-- {
+		entry := history[i]
+		if entry.LogType != logType || entry.Filter != filter || entry.InputBytes <= 0 || entry.Seconds <= 0 {
+			continue
+		}
+		estimate.Runs++
+		input += entry.InputBytes
+		seconds += entry.Seconds
+		if !entry.Stdout {
+			written += entry.OutputBytes
+			writtenInput += entry.InputBytes
+		}
+	}
+	if estimate.Runs == 0 {
+		return estimate, false
+	}
+	estimate.BytesPerSecond = float64(input) / seconds
+	estimate.Duration = time.Duration(float64(inputBytes) / estimate.BytesPerSecond * float64(time.Second))
+	estimate.OutputBytes = -1
+	if writtenInput > 0 {
+		estimate.OutputBytes = int64(float64(inputBytes) * float64(written) / float64(writtenInput))
+	}
+	return estimate, true
+}
+
+// returns the total size of the given files, skipping any that cannot be read.
+func FilesSize(files []string) (size int64) {
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// InputSize returns the size of the logs a pull with rc reads, with the tar containers of its
+// dates counted whole, as the logs in them are only known once extracted. Logs on another host
+// are only sized once fetched, so are not counted.
+func InputSize(rc RuntimeConfig) (size int64, err error) {
+	if IsRemoteLogDir(rc.LogDir) {
+		return 0, nil
+	}
+	logFiles, err := PullLogs(rc)
+	if err != nil {
+		return 0, err
+	}
+	if rc.ExtractDir == "" && rc.Tasks == nil {
+		for _, day := range pullDays(rc) {
+			if container := dateContainer(rc.LogDir, day.Start); container != "" {
+				logFiles = append(logFiles, container)
+			}
+		}
+	}
+	return FilesSize(logFiles), nil
+}
+
+// returns the total size of the files under dir.
+func DirSize(dir string) (size int64) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// returns the line describing the estimate before asking to continue.
+func (e RunEstimate) Label() string {
+	output := T("estimate.stdout")
+	if e.OutputBytes >= 0 {
+		output = FormatBytes(e.OutputBytes)
+	}
+	return T("label.estimate", e.Duration.Round(time.Second), output, e.Runs, FormatBytes(int64(e.BytesPerSecond)))
+}
@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// environment variables a playbook hook is run with, on top of the environment of nagini, so
+// a command such as one triggering ingestion can find the outputs.
+const (
+	HookEnvPlaybook  = "NAGINI_PLAYBOOK"   // path or name of the playbook run
+	HookEnvOutputDir = "NAGINI_OUTPUT_DIR" // output directory of the playbook, holding a directory per data source
+)
+
+// returns the command of the hook, with its args.
+func (h PlaybookHook) String() string {
+	return strings.Join(h.Command, " ")
+}
+
+// returns whether a failure of the hook is only warned about, rather than stopping the run.
+func (h PlaybookHook) Warns() bool {
+	return h.OnFailure == HookWarn
+}
+
+// RunHook runs the command of hook with env added to the environment, and its output written
+// to out. Returns an error if it could not be started, or did not exit successfully.
+func RunHook(hook PlaybookHook, env []string, out io.Writer) error {
+	command := exec.Command(hook.Command[0], hook.Command[1:]...)
+	command.Env = append(os.Environ(), env...)
+	command.Stdout, command.Stderr = out, out
+	return command.Run()
+}
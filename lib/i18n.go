@@ -0,0 +1,622 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// language used when no other language is configured, and the fallback for any
+// message that has not been translated yet.
+const DefaultLanguage = "en"
+
+// currently selected language for user-facing messages.
+var language = DefaultLanguage
+
+// user-facing message catalog, keyed by language and then by message id.
+// debug logging is intentionally left out of the catalog, as it is meant for
+// developers rather than analysts.
+var messages = map[string]map[string]string{
+	"en": {
+		"confirm.continue": "Continue?",
+		"confirm.yes":      "Yes",
+		"confirm.no":       "No",
+
+		"bar.days":          "Days Complete: [",
+		"bar.tasks":         "Log Parses Complete: [",
+		"bar.progress.more": "+%d more",
+
+		"label.logdir":       "Zeek Log Directory:\t%s\n",
+		"label.logtype":      "Log Type:\t\t%s\n",
+		"label.range":        "Date Range:\t\t%s - %s\n",
+		"label.script":       "Script to Run:\t\t%s\n",
+		"label.unique":       "Unique values of:\t\t%s\n",
+		"label.top":          "Top %d values of:\t\t%s\n",
+		"label.hash":         "Hashed Values of:\t%s\n",
+		"label.connsummary":  "Conn Summary:\t\t%s\n",
+		"label.fingerprints": "Fingerprints:\t\t%d, in %s\n",
+		"label.hashes":       "Hashes:\t\t\t%d, in md5, sha1, sha256\n",
+		"label.extract":      "Retrieve Files To:\t%s\n",
+		"label.command":      "Command to run:\t\t%s %s\n",
+		"label.sitefilter":   "Site filters:\t\tdropping %s\n",
+		"label.where":        "Keep Records Where:\t%s\n",
+		"label.jq":           "jq expression:\t\t%s\n",
+		"label.ipfilter":     "Subnets:\t\t%s\n",
+		"label.ipfields":     "Address Fields:\t\t%s\n",
+		"label.prerun":       "Before Running:\t\t%s (on failure: %s)\n",
+		"label.postrun":      "After Running:\t\t%s (on failure: %s)\n",
+		"label.maxrecords":   "Max Records:\t\t%d\n",
+		"label.firstmatch":   "Stop After:\t\tfirst match of each day\n",
+		"label.newestfirst":  "Order:\t\t\tnewest dates first\n",
+		"label.cluster":      "Cluster:\t\tper-worker logs included\n",
+		"label.filetime":     "File Times (%s):\t%s - %s\n",
+		"label.mask":         "Time Mask:\t\t%s\n",
+		"label.clockoffset":  "Sensor Clock Offset:\t%s\n",
+		"label.estimate":     "Estimate:\t\t%s, %s of output (from %d past run(s) at %s/s)\n",
+		"estimate.stdout":    "unknown size",
+		"label.threads":      "Threads:\t\t%d\n",
+		"label.outdir":       "Output Directory:\t%s\n\n",
+		"label.tempdir":      "Temp Directory:\t\t%s\n\n",
+		"label.library":      "Playbook Library:\t%s (%s)\n\n",
+		"label.playbook":     "Playbook:\t\t%s (%s)\n",
+		"label.play":         "Data Source:\t\t%s\n",
+
+		"label.chunks":                  "Chunks:\t\t\t%d of %s, %d already done\n",
+		"backfill.skip":                 "[%d/%d] %s: already done, skipping.\n",
+		"backfill.retry":                "[%d/%d] %s: attempt %d failed: %s\n",
+		"backfill.done":                 "[%d/%d] %s: done in %s.\n",
+		"backfill.failed":               "[%d/%d] %s: failed after %d attempt(s): %s\n",
+		"backfill.report":               "\nBackfill finished: %d done, %d skipped, %d failed. Output: %s\n",
+		"error.backfill.failed":         "%d chunk(s) failed: %s. Run the same command again to retry them.",
+		"report.usage":                  "\nFilter usage: %d task(s), CPU %s user + %s system, peak memory %s\n",
+		"report.top":                    "Most expensive files (top %d by CPU time):\n",
+		"report.corrupt":                "\nCorrupt source logs (%d), output may be missing records from them:\n",
+		"report.checksums":              "\nChecksums: %d verified, %d without a sidecar, %d mismatched\n",
+		"report.schemadrift":            "\nSchema drift: the fields of the logs changed %d time(s) across the time range, so output mixes schemas:\n",
+		"report.schemadrift.hint":       "Use --normalize-schema to write every record with the union of the fields.\n",
+		"report.schemadrift.normalized": "Every record was written with the union of the fields, missing fields unset.\n",
+		"report.exhausted":              "\nRan out of resources (open files, memory or processes): %d task(s) run again, with at most %d running at once.\n",
+		"report.stalled":                "\nStalled tasks (%d), whose filter neither read input nor wrote output:\n",
+		"report.stalled.task":           "  %s: idle %s, state %s, %s\n",
+		"report.filetime":               "\nSkipped %d log(s) modified outside the selected file times.\n",
+		"report.appeared":               "\nLeft out %d log(s) that appeared after the pull started. Pull again to include them.\n",
+		"report.late":                   "\nRead %d log(s) delivered late, while waiting for them.\n",
+		"report.changed":                "\nLogs that changed while being read (%d):\n",
+		"report.changed.flagged":        "output may not match the log",
+		"report.changed.reprocessed":    "read again once it stopped changing",
+		"play.hook":                     "Running %s hook: %s\n",
+		"play.check.ok":                 "Playbook %s is valid (%d data sources).\n",
+		"run.rendered":                  "Report rendered to %s\n",
+		"run.ticket":                    "Ticket %s updated.\n",
+		"run.uploaded":                  "Uploaded %d output files to %s.\n",
+		"verify.denied":                 "%s: %v\n",
+		"verify.checked":                "%s: %d paths checked, %d cannot be read.\n",
+		"verify.remote":                 "%s: the logs of %s are fetched before they are read, so cannot be checked.\n",
+		"error.verify":                  "%d paths of the pull cannot be read.",
+		"error.maxinput":                "the pull would read %s of logs, over the --max-input-size of %s. Narrow the time range, or give --force to pull it anyway.",
+		"run.taskmanifest":              "Wrote the task manifest of %d logs over %d dates to %s.\n",
+		"error.taskmanifest.both":       "--emit-manifest and --from-manifest cannot be used together.",
+		"error.taskmanifest.types":      "a task manifest holds the logs of a single log type, so --emit-manifest and --from-manifest cannot be used with --type.",
+		"error.taskmanifest.live":       "a task manifest lists the logs found up front, so --emit-manifest and --from-manifest cannot be used with --current or --wait-late.",
+		"error.taskmanifest.remote":     "--emit-manifest lists the logs of a local log directory, not of %s.",
+		"error.taskmanifest.read":       "could not read the task manifest %s: %v",
+		"error.taskmanifest.logtype":    "the task manifest %s lists %s logs, not %s logs.",
+		"error.taskmanifest.flag":       "--from-manifest pulls over the log directory and time range of the manifest, so --%s cannot be given too.",
+		"run.complete":                  "\nComplete.",
+		"run.output":                    " Output: %s",
+		"run.concat":                    "Concat flag set. Concatting all output into a single %s file.\n",
+		"parallel.complete":             "\nComplete. Output: %s\n",
+		"error.relativepath":            "could not resolve relative path in user provided input.",
+		"error.timerange":               "provided dates malformed. Please provide dates in the following format: YYYY/MM/DD:HH-YYYY/MM/DD:HH, or YYYY/MM/DD:* for a whole day, or YYYY/MM/* for a whole month",
+		"error.rangeorder":              "start of time range (%s) is after the end (%s).",
+		"error.threads":                 "thread count must be greater than 0, got %d.",
+		"error.outdir.notdir":           "output directory %s exists but is not a directory.",
+		"error.outdir.notempty":         "output directory %s exists and is non-empty.",
+		"error.outdir.parent":           "cannot create output directory: %s is not a directory.",
+		"error.outdir.root":             "output directory %s is not under any of the output_roots of the config file: %s.",
+		"error.outdir.denied":           "output directory %s is under %s, which the denied_output_roots of the config file do not allow writing in.",
+		"error.outdir.logdir":           "output directory %s is inside the log directory %s. Write outputs elsewhere, so the archive is left as it is.",
+		"error.outdir.write":            "cannot write to %s.",
+		"error.logtype":                 "no '%s' logs found in %s between %s and %s.",
+		"error.field.closest":           "unknown field '%s' of %s logs, did you mean '%s'?",
+		"error.field":                   "unknown field '%s' of %s logs, which have the fields: %s.",
+		"error.locked":                  "output directory %s is in use by another run of nagini. Wait for it to finish, or choose another output directory.",
+		"error.play.empty":              "playbook has no data sources.",
+		"error.play.stdout":             "--stdout cannot be used with a playbook.",
+		"error.play.noname":             "data source #%d has no name.",
+		"error.play.duplicate":          "more than one data source is named '%s'.",
+		"error.nocommand":               "a command to filter with is required, unless --jq or --where is set.",
+		"error.where.command":           "a command or jq expression cannot be given together with a where condition.",
+		"error.where.empty":             "the where condition is empty.",
+		"error.where":                   "invalid where condition '%s': %v.",
+		"error.jq.command":              "a command cannot be given together with a jq expression.",
+		"error.hook.nocommand":          "%s hook #%d has no command.",
+		"error.hook.onfailure":          "%s hook #%d has on_failure '%s', expected '%s' or '%s'.",
+		"error.hook":                    "%s hook '%s' failed: %v.",
+		"error.play.nocommand":          "data source '%s' has no command, script, jq expression or where condition.",
+		"error.chunk":                   "invalid chunk size '%s'. Use a whole number of hours, days or weeks, such as 12h, 7d or 2w.",
+		"error.backfill.stdout":         "--stdout cannot be used with backfill.",
+		"error.profile.sample":          "--%s cannot be negative, got %d.",
+		"sessions.written":              "\nWrote %d session(s).",
+		"notices.loaded":                "Read %d notice(s) and intel hit(s) to correlate records with.\n",
+		"error.notices":                 "could not read the notice and intel logs: %v",
+		"shipper.written":               "Wrote the shipper config to %s.\n",
+		"k8s.written":                   "Wrote the manifest to %s. Apply it with kubectl apply -f.\n",
+		"error.shipper":                 "unknown shipper '%s'. One of: %s",
+		"error.shipper.sink":            "invalid --sink '%s'. One of: %s",
+		"error.shipper.endpoint":        "the %s sink needs an --endpoint.",
+		"error.k8s.playbook":            "a playbook to run is required, set with --playbook.",
+		"error.k8s.claim":               "a PersistentVolumeClaim holding the logs is required, set with --log-claim.",
+		"error.k8s.schedule":            "invalid schedule '%s'. Use five cron fields, such as \"0 6 * * *\", or a macro such as @daily.",
+		"error.k8s.image":               "an image to run is required, set with --image.",
+		"prune.rule":                    "Outputs under %s not modified for %s: %d\n",
+		"prune.output":                  "  %s  last modified %s  %s\n",
+		"prune.removed":                 "Removed %d outputs, freeing %s.\n",
+		"error.prune.flags":             "--root and --older-than must be given together.",
+		"error.prune.rules":             "no retention rules: give --root and --older-than, or set retention in the config file.",
+		"error.prune.age":               "output age %s is not a positive duration such as 30d, 2w or 72h.",
+		"error.prune.root":              "prune root %s is not an existing directory.",
+		"error.prune.logdir":            "prune root %s holds or is inside the log directory %s. Prune only the outputs of pulls, so the archive is left as it is.",
+		"dictionary.trained":            "Trained %s from %d outputs.\n",
+		"run.dictionary":                "Compressing outputs with the dictionary %s.\n",
+		"error.dictionary.size":         "dictionary size %d must be positive.",
+		"error.dictionary.samples":      "no outputs of %s to train a dictionary from.",
+		"error.dictionary.dir":          "no dictionary_dir in the config file to keep dictionaries in.",
+		"synth.written":                 "Wrote %d logs into %s, from %s to %s.\n",
+		"error.synth.start":             "start day %s is not a date like 2021/06/01.",
+		"error.synth.days":              "number of days %d must be positive.",
+		"error.synth.records":           "records per hour %d cannot be negative.",
+		"error.synth.types":             "no log types to write.",
+		"error.synth.logtype":           "unknown log type %s: add its fields to log_types of the config file.",
+		"error.synth.format":            "unknown log format %s, must be one of: %s.",
+		"run.current":                   "Reading the hour in progress from a copy of %s.\n",
+		"error.current.remote":          "--current needs a local log directory, as the current directory of a remote one is not fetched.",
+		"error.types.stdout":            "--stdout cannot be used with more than one log type, or a pattern of them.",
+		"error.types.duplicate":         "log type '%s' is given more than once.",
+		"error.logtype.nomatch":         "no log types matching '%s' found in %s between %s and %s.",
+		"error.logtype.pattern":         "the log type pattern '%s' is not valid: %v.",
+		"error.logtype.remote":          "the log type pattern '%s' cannot be matched against a remote archive, give the log types instead.",
+		"error.cidr":                    "'%s' is not a subnet, such as 10.0.0.0/24, or an address.",
+		"error.cidr.none":               "at least one subnet to filter by is required, as args or in --targets.",
+		"resume.finished":               "Finished %s.\n",
+		"resume.none":                   "Nothing to finish in %s: no output was cut short.\n",
+		"filehashes.retrieved":          "Retrieved %d of %d file(s) into %s.\n",
+		"warn.history":                  "WARN: could not record the run in the history file %s: %s\n",
+		"warn.maxinput":                 "WARN: the pull reads %s of logs, over the --max-input-size of %s, going on with --force.\n",
+		"warn.maxinput.remote":          "WARN: %s: the logs of %s are fetched before they are read, so are not counted against the --max-input-size of %s.\n",
+		"warn.lineage":                  "WARN: could not post the %s lineage event of %s: %v\n",
+		"warn.hook":                     "WARN: %s hook '%s' failed, continuing: %v\n",
+		"warn.retrieve":                 "WARN: could not retrieve file %s: %s\n",
+		"profile.sampled":               "Profiled %d record(s) from %d of %d log(s).\n",
+		"profile.header":                "FIELD\tNULL\tDISTINCT\tTOP VALUES\n",
+		"error.onchange":                "invalid --on-change '%s'. One of: %s",
+		"error.waitlate":                "invalid --wait-late %s. Must not be negative.",
+		"error.waitlate.remote":         "--wait-late cannot watch a remote log directory.",
+		"error.manifest.stdout":         "--manifest lists the files of an output directory, so it cannot be used with --stdout.",
+		"error.compress":                "invalid --compress '%s'. One of: %s",
+		"error.compress.stdout":         "--compress cannot be used with --stdout.",
+		"error.compress.zstd":           "--compress zstd needs the zstd command, which was not found.",
+		"error.compressoutput":          "invalid --compress-output '%s'. One of: %s",
+		"error.compressoutput.compress": "--compress-output already writes every output compressed, so it cannot be used with --compress.",
+		"error.compressoutput.zstd":     "--compress-output zstd needs the zstd command, which was not found.",
+		"error.compressoutput.arg":      "'%[1]s' was read as an argument, such as of the filter, rather than as the format of --compress-output, which can be given without one. Use --compress-output=%[1]s.",
+		"error.compresslevel":           "invalid --compress-level %d. For %s, from 1 to %d, or 0 for its default.",
+		"error.cachesize":               "cache size cannot be negative, got %d.",
+		"remote.fetch":                  "Fetching %d log(s) from %s, %d already cached.\n",
+		"tar.extract":                   "Extracting %d log(s) from %s, %d already extracted.\n",
+		"error.retries":                 "retry count cannot be negative, got %d.",
+		"warn.exhausted":                "WARN: %s ran out of resources (%s). Running it again with at most %d task(s) at once.\n",
+		"warn.stall":                    "WARN: filter of %s has been idle for %s (state %s), action: %s\n",
+		"error.stagebuffer":             "stage buffer must be at least 1 KB, got %d.",
+		"error.readahead":               "read-ahead cannot be negative, got %d.",
+		"error.stalltimeout":            "stall timeout cannot be negative, got %s.",
+		"error.stallaction":             "unknown stall action '%s'. Use one of: %s.",
+		"error.batchdelimiter":          "--batch-delimiter cannot be empty with --batch.",
+		"error.top":                     "--top cannot be negative, got %d.",
+		"error.connsummary":             "unknown conn summary '%s'. Use one of: %s.",
+		"error.connsummary.conn":        "--conn-summary rolls up conn logs, not %s logs.",
+		"error.connsummary.unique":      "--conn-summary cannot be used together with --unique.",
+		"error.connsummary.stdout":      "--conn-summary alongside needs an output directory to write the summary to. Use --conn-summary only to write it to stdout.",
+		"error.top.unique":              "--top needs the fields to count the values of, given with --unique.",
+		"error.hash.salt":               "--hash needs a salt to hash the values with, given with --hash-salt or in %s.",
+		"error.hash.unique":             "--hash field '%s' is not one of the fields of --unique.",
+		"error.fingerprints":            "no fingerprints to look for: give them as args, or list them in a --targets file.",
+		"error.hashes":                  "no hashes to look for: give them as args, or list them in a --targets file.",
+		"error.extract.stdout":          "--extract writes retrieved files into the output directory, so it cannot be used with --stdout.",
+		"error.extract.command":         "--extract needs a file_extract_command in the config file to retrieve files with.",
+		"error.maxrecords":              "max records cannot be negative, got %d.",
+		"error.order":                   "unknown order '%s'. Use %s or %s.",
+		"error.corrupt":                 "%d source log(s) are corrupt: %s",
+		"error.corruptflags":            "--skip-corrupt and --fail-on-corrupt cannot be used together.",
+		"error.optionaltime":            "--%s '%s' is malformed. Please provide a time in the following format: YYYY/MM/DD:HH",
+		"error.bytesize":                "--%s '%s' is malformed. Please provide a size such as 500G, in K, M, G, T or P.",
+		"error.filetimewindow":          "--modified-since must be before --modified-before.",
+		"error.filetimefield":           "unknown file time '%s'. Use mtime or ctime.",
+		"error.monthrange":              "--month and --timerange cannot be used together.",
+		"error.hours":                   "hours '%s' are malformed. Please provide an hour range in the format HH-HH, such as 08-18.",
+		"error.masknone":                "--outside-mask needs --hours, --weekdays or --weekends to invert.",
+		"error.preset.notfound":         "no preset named '%s'. Use 'nagini preset' to see the available presets.",
+		"error.playbook.name":           "playbook name '%s' is not inside the playbook library.",
+		"error.playbook.notfound":       "no playbook named '%s' in %s. Use 'nagini playbook list' to see the available playbooks.",
+		"library.unversioned":           "not a git checkout",
+		"error.outputformat.parquet":    "--output-format parquet writes a file per log type and date, so it cannot be used with --%s.",
+		"error.outputformat":            "output format '%s' is not supported. Please use one of: %s.",
+		"error.fieldorder":              "field order '%s' is not valid. Please use source, alphabetical, or a comma separated list of fields.",
+		"error.fieldorder.msgpack":      "--field-order only applies to json output, msgpack maps are always written with their keys sorted.",
+		"error.reportformat":            "report format '%s' is not supported. Please use one of: %s.",
+		"error.provenance.stdout":       "--provenance cannot be used with --stdout, as there are no output files to describe.",
+		"error.reportstdout":            "--render-report cannot be used with --stdout, as there is no output directory to render it into.",
+		"error.reporttemplate":          "report template %s does not exist.",
+		"error.reporttemplate.noformat": "--report-template requires --render-report.",
+		"error.ticket.nowebhook":        "--ticket requires ticket_webhook to be set in the config file.",
+		"error.ticket":                  "could not update ticket %s, the output is kept: %v",
+		"error.upload.target":           "--upload must be an s3://bucket/prefix/ URL, not %s.",
+		"error.upload.stdout":           "--upload cannot be used with --stdout, as there is no output directory to upload.",
+		"error.upload.credentials":      "--upload requires s3_access_key_id and s3_secret_access_key in the config file, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY in the environment.",
+		"error.upload.remove":           "--upload-remove requires --upload.",
+		"error.upload":                  "could not upload the output to %s, the files not uploaded are kept: %v",
+		"error.schemascan":              "could not read the schemas of the logs: %v",
+		"error.var":                     "variable '%s' is malformed. Please provide it as name=value.",
+		"validate.failed":               "found %d problem(s) with the given arguments:",
+		"error.logdir":                  "invalid Zeek log directory %s, either does not exist or is not a directory.",
+		"error.script":                  "script '%s' does not exist.",
+		"error.script.confirm":          "--script - reads the script from stdin, so requires --noconfirm.",
+		"error.script.empty":            "the inline script is empty.",
+		"error.script.shebang":          "the inline script must start with a #! line naming its interpreter, such as #!/bin/sh.",
+		"error.script.interpreter":      "script '%s' is run by '%s', which could not be found.",
+		"error.script.requires":         "script '%s' requires '%s', which is not in PATH.",
+		"error.script.selftest":         "script '%s' failed its self-test, run with %s: %s.",
+		"script.timeout":                "timed out after %s",
+		"error.scriptexec":              "script '%s' exists but is not marked as an executable.",
+		"error.command":                 "could not find an executable '%s'. Make sure it exists and is marked as executable.",
+		"error.language":                "error: unsupported language '%s'. Supported languages: %s\n",
+
+		"config.notfound": "WARN: could not find a config file in /etc/nagini or ~/.config/nagini, using defaults. Run 'nagini init' to create one.",
+
+		"init.logdir":       "Which Zeek log directory should be used?",
+		"init.logdir.other": "Another directory",
+		"init.logdir.enter": "Zeek log directory",
+		"init.logdir.none":  "No Zeek log directory was found in the usual locations.",
+		"init.threads":      "Default number of threads (this system has %d CPUs)",
+		"init.overwrite":    "%s already exists. Overwrite it?",
+		"init.written":      "Wrote config to %s\n",
+		"init.validating":   "Running a validation pull of %s logs from %s\n",
+		"init.validated":    "Validation succeeded: read %d records from %s\n",
+		"init.novalidation": "WARN: validation pull failed: %s\n",
+		"error.number":      "error: '%s' is not a positive number.\n",
+	},
+	"es": {
+		"confirm.continue": "¿Continuar?",
+		"confirm.yes":      "Sí",
+		"confirm.no":       "No",
+
+		"bar.days":          "Días completados: [",
+		"bar.tasks":         "Registros procesados: [",
+		"bar.progress.more": "+%d más",
+
+		"label.logdir":       "Directorio de registros Zeek:\t%s\n",
+		"label.logtype":      "Tipo de registro:\t\t%s\n",
+		"label.range":        "Rango de fechas:\t\t%s - %s\n",
+		"label.script":       "Script a ejecutar:\t\t%s\n",
+		"label.unique":       "Valores únicos de:\t\t%s\n",
+		"label.top":          "Los %d valores más comunes de:\t%s\n",
+		"label.hash":         "Valores con hash de:\t%s\n",
+		"label.connsummary":  "Resumen de conn:\t%s\n",
+		"label.fingerprints": "Huellas:\t\t%d, en %s\n",
+		"label.hashes":       "Hashes:\t\t\t%d, en md5, sha1, sha256\n",
+		"label.extract":      "Recuperar Archivos En:\t%s\n",
+		"label.command":      "Comando a ejecutar:\t\t%s %s\n",
+		"label.sitefilter":   "Filtros del sitio:\tdescartando %s\n",
+		"label.where":        "Registros donde:\t%s\n",
+		"label.jq":           "Expresión jq:\t\t%s\n",
+		"label.ipfilter":     "Subredes:\t\t%s\n",
+		"label.ipfields":     "Campos de dirección:\t\t%s\n",
+		"label.prerun":       "Antes de ejecutar:\t%s (si falla: %s)\n",
+		"label.postrun":      "Después de ejecutar:\t%s (si falla: %s)\n",
+		"label.maxrecords":   "Máximo de registros:\t\t%d\n",
+		"label.firstmatch":   "Detener tras:\t\tprimer resultado de cada día\n",
+		"label.newestfirst":  "Orden:\t\t\tfechas más recientes primero\n",
+		"label.cluster":      "Clúster:\t\tse incluyen los logs de cada worker\n",
+		"label.filetime":     "Horas de archivo (%s):\t%s - %s\n",
+		"label.mask":         "Máscara horaria:\t\t%s\n",
+		"label.clockoffset":  "Desfase del Reloj:\t%s\n",
+		"label.estimate":     "Estimación:\t\t%s, %s de salida (según %d ejecución(es) anterior(es) a %s/s)\n",
+		"estimate.stdout":    "tamaño desconocido",
+		"label.threads":      "Hilos:\t\t\t\t%d\n",
+		"label.outdir":       "Directorio de salida:\t\t%s\n\n",
+		"label.tempdir":      "Directorio temporal:\t\t%s\n\n",
+		"label.library":      "Biblioteca de playbooks:\t%s (%s)\n\n",
+		"label.playbook":     "Playbook:\t\t\t%s (%s)\n",
+		"label.play":         "Fuente de datos:\t\t%s\n",
+
+		"label.chunks":                  "Bloques:\t\t\t%d de %s, %d ya completados\n",
+		"backfill.skip":                 "[%d/%d] %s: ya completado, se omite.\n",
+		"backfill.retry":                "[%d/%d] %s: el intento %d falló: %s\n",
+		"backfill.done":                 "[%d/%d] %s: completado en %s.\n",
+		"backfill.failed":               "[%d/%d] %s: falló tras %d intento(s): %s\n",
+		"backfill.report":               "\nBackfill terminado: %d completados, %d omitidos, %d fallidos. Salida: %s\n",
+		"error.backfill.failed":         "%d bloque(s) fallaron: %s. Ejecute el mismo comando de nuevo para reintentarlos.",
+		"report.usage":                  "\nUso de filtros: %d tarea(s), CPU %s usuario + %s sistema, memoria máxima %s\n",
+		"report.top":                    "Archivos más costosos (los %d con más tiempo de CPU):\n",
+		"report.corrupt":                "\nRegistros de origen corruptos (%d), puede faltar parte de su salida:\n",
+		"report.checksums":              "\nSumas de verificación: %d verificadas, %d sin archivo .sha256, %d no coinciden\n",
+		"report.schemadrift":            "\nDeriva de esquema: los campos de los logs cambiaron %d vez/veces en el rango de tiempo, por lo que la salida mezcla esquemas:\n",
+		"report.schemadrift.hint":       "Use --normalize-schema para escribir cada registro con la unión de los campos.\n",
+		"report.schemadrift.normalized": "Cada registro se escribió con la unión de los campos, con los campos faltantes sin valor.\n",
+		"report.exhausted":              "\nSin recursos (archivos abiertos, memoria o procesos): %d tarea(s) ejecutadas de nuevo, con un máximo de %d a la vez.\n",
+		"report.stalled":                "\nTareas detenidas (%d), cuyo filtro no leyó entrada ni escribió salida:\n",
+		"report.stalled.task":           "  %s: inactiva %s, estado %s, %s\n",
+		"report.filetime":               "\nSe omitieron %d registro(s) modificados fuera de las horas de archivo seleccionadas.\n",
+		"report.appeared":               "\nSe omitieron %d log(s) que aparecieron después de iniciar la extracción. Vuelva a extraer para incluirlos.\n",
+		"report.late":                   "\nSe leyeron %d log(s) entregados tarde, mientras se esperaban.\n",
+		"report.changed":                "\nLogs que cambiaron mientras se leían (%d):\n",
+		"report.changed.flagged":        "la salida puede no coincidir con el log",
+		"report.changed.reprocessed":    "se leyó de nuevo una vez que dejó de cambiar",
+		"play.hook":                     "Ejecutando el hook %s: %s\n",
+		"play.check.ok":                 "El playbook %s es válido (%d fuentes de datos).\n",
+		"run.rendered":                  "Informe generado en %s\n",
+		"run.ticket":                    "Ticket %s actualizado.\n",
+		"run.uploaded":                  "Se subieron %d archivos de salida a %s.\n",
+		"verify.denied":                 "%s: %v\n",
+		"verify.checked":                "%s: %d rutas comprobadas, %d no se pueden leer.\n",
+		"verify.remote":                 "%s: los logs de %s se descargan antes de leerlos, así que no se pueden comprobar.\n",
+		"error.verify":                  "%d rutas del pull no se pueden leer.",
+		"error.maxinput":                "el pull leería %s de logs, por encima del --max-input-size de %s. Reduzca el rango de tiempo, o use --force para hacerlo de todos modos.",
+		"run.taskmanifest":              "Se escribió el manifiesto de tareas de %d logs en %d fechas en %s.\n",
+		"error.taskmanifest.both":       "--emit-manifest y --from-manifest no se pueden usar juntos.",
+		"error.taskmanifest.types":      "un manifiesto de tareas contiene los logs de un solo tipo, así que --emit-manifest y --from-manifest no se pueden usar con --type.",
+		"error.taskmanifest.live":       "un manifiesto de tareas enumera los logs encontrados de antemano, así que --emit-manifest y --from-manifest no se pueden usar con --current ni --wait-late.",
+		"error.taskmanifest.remote":     "--emit-manifest enumera los logs de un directorio de logs local, no de %s.",
+		"error.taskmanifest.read":       "no se pudo leer el manifiesto de tareas %s: %v",
+		"error.taskmanifest.logtype":    "el manifiesto de tareas %s enumera logs %s, no logs %s.",
+		"error.taskmanifest.flag":       "--from-manifest usa el directorio de logs y el rango de tiempo del manifiesto, así que no se puede dar también --%s.",
+		"run.complete":                  "\nCompletado.",
+		"run.output":                    " Salida: %s",
+		"run.concat":                    "Opción de concatenación activa. Concatenando toda la salida en un único archivo %s.\n",
+		"parallel.complete":             "\nCompletado. Salida: %s\n",
+		"error.relativepath":            "no se pudo resolver la ruta relativa proporcionada.",
+		"error.timerange":               "fechas mal formadas. Proporcione las fechas con el siguiente formato: AAAA/MM/DD:HH-AAAA/MM/DD:HH, o AAAA/MM/DD:* para un día entero, o AAAA/MM/* para un mes entero",
+		"error.rangeorder":              "el inicio del rango (%s) es posterior al final (%s).",
+		"error.threads":                 "el número de hilos debe ser mayor que 0, se recibió %d.",
+		"error.outdir.notdir":           "el directorio de salida %s existe pero no es un directorio.",
+		"error.outdir.notempty":         "el directorio de salida %s existe y no está vacío.",
+		"error.outdir.parent":           "no se puede crear el directorio de salida: %s no es un directorio.",
+		"error.outdir.root":             "el directorio de salida %s no está bajo ninguno de los output_roots del archivo de configuración: %s.",
+		"error.outdir.denied":           "el directorio de salida %s está bajo %s, donde los denied_output_roots del archivo de configuración no permiten escribir.",
+		"error.outdir.logdir":           "el directorio de salida %s está dentro del directorio de logs %s. Escriba las salidas en otro lugar, para no modificar el archivo.",
+		"error.outdir.write":            "no se puede escribir en %s.",
+		"error.logtype":                 "no se encontraron registros '%s' en %s entre %s y %s.",
+		"error.field.closest":           "campo '%s' desconocido en los registros %s, ¿quiso decir '%s'?",
+		"error.field":                   "campo '%s' desconocido en los registros %s, que tienen los campos: %s.",
+		"error.locked":                  "el directorio de salida %s está en uso por otra ejecución de nagini. Espere a que termine, o elija otro directorio de salida.",
+		"error.play.empty":              "el playbook no tiene fuentes de datos.",
+		"error.play.stdout":             "--stdout no se puede usar con un playbook.",
+		"error.play.noname":             "la fuente de datos #%d no tiene nombre.",
+		"error.play.duplicate":          "hay más de una fuente de datos llamada '%s'.",
+		"error.nocommand":               "se requiere un comando con el que filtrar, salvo que se use --jq o --where.",
+		"error.where.command":           "no se puede indicar un comando ni una expresión jq junto con una condición where.",
+		"error.where.empty":             "la condición where está vacía.",
+		"error.where":                   "condición where '%s' no válida: %v.",
+		"error.jq.command":              "no se puede indicar un comando junto con una expresión jq.",
+		"error.hook.nocommand":          "el hook %s #%d no tiene comando.",
+		"error.hook.onfailure":          "el hook %s #%d tiene on_failure '%s', se esperaba '%s' o '%s'.",
+		"error.hook":                    "el hook %s '%s' falló: %v.",
+		"error.play.nocommand":          "la fuente de datos '%s' no tiene comando, script, expresión jq ni condición where.",
+		"error.chunk":                   "tamaño de bloque '%s' no válido. Use un número entero de horas, días o semanas, como 12h, 7d o 2w.",
+		"error.backfill.stdout":         "--stdout no se puede usar con backfill.",
+		"error.profile.sample":          "--%s no puede ser negativo, se recibió %d.",
+		"sessions.written":              "\nSe escribieron %d sesión(es).",
+		"notices.loaded":                "Se leyeron %d aviso(s) y coincidencia(s) de intel para correlacionar los registros.\n",
+		"error.notices":                 "no se pudieron leer los logs de notice e intel: %v",
+		"shipper.written":               "Se escribió la configuración del transportador en %s.\n",
+		"k8s.written":                   "Se escribió el manifiesto en %s. Aplíquelo con kubectl apply -f.\n",
+		"error.shipper":                 "transportador desconocido '%s'. Uno de: %s",
+		"error.shipper.sink":            "--sink inválido '%s'. Uno de: %s",
+		"error.shipper.endpoint":        "el destino %s necesita un --endpoint.",
+		"error.k8s.playbook":            "se requiere un playbook a ejecutar, indicado con --playbook.",
+		"error.k8s.claim":               "se requiere un PersistentVolumeClaim con los logs, indicado con --log-claim.",
+		"error.k8s.schedule":            "programación inválida '%s'. Use cinco campos de cron, como \"0 6 * * *\", o una macro como @daily.",
+		"error.k8s.image":               "se requiere una imagen a ejecutar, indicada con --image.",
+		"prune.rule":                    "Salidas en %s sin modificar desde hace %s: %d\n",
+		"prune.output":                  "  %s  modificada por última vez %s  %s\n",
+		"prune.removed":                 "Se eliminaron %d salidas, liberando %s.\n",
+		"error.prune.flags":             "--root y --older-than deben indicarse juntos.",
+		"error.prune.rules":             "no hay reglas de retención: indique --root y --older-than, o defina retention en el archivo de configuración.",
+		"error.prune.age":               "la antigüedad de salida %s no es una duración positiva como 30d, 2w o 72h.",
+		"error.prune.root":              "la raíz a depurar %s no es un directorio existente.",
+		"error.prune.logdir":            "la raíz a depurar %s contiene o está dentro del directorio de logs %s. Depure solo las salidas de extracciones, para no modificar el archivo.",
+		"dictionary.trained":            "Se entrenó %s a partir de %d salidas.\n",
+		"run.dictionary":                "Comprimiendo las salidas con el diccionario %s.\n",
+		"error.dictionary.size":         "el tamaño de diccionario %d debe ser positivo.",
+		"error.dictionary.samples":      "no hay salidas de %s a partir de las cuales entrenar un diccionario.",
+		"error.dictionary.dir":          "no hay dictionary_dir en el archivo de configuración donde guardar diccionarios.",
+		"synth.written":                 "Se escribieron %d logs en %s, del %s al %s.\n",
+		"error.synth.start":             "el día de inicio %s no es una fecha como 2021/06/01.",
+		"error.synth.days":              "el número de días %d debe ser positivo.",
+		"error.synth.records":           "los registros por hora %d no pueden ser negativos.",
+		"error.synth.types":             "no hay tipos de log que escribir.",
+		"error.synth.logtype":           "tipo de log desconocido %s: añada sus campos a log_types del archivo de configuración.",
+		"error.synth.format":            "formato de log desconocido %s, debe ser uno de: %s.",
+		"run.current":                   "Leyendo la hora en curso de una copia de %s.\n",
+		"error.current.remote":          "--current necesita un directorio de logs local, ya que el directorio current de uno remoto no se descarga.",
+		"error.types.stdout":            "--stdout no se puede usar con más de un tipo de registro, ni con un patrón de ellos.",
+		"error.types.duplicate":         "el tipo de registro '%s' se indica más de una vez.",
+		"error.logtype.nomatch":         "no se encontraron tipos de registro que coincidan con '%s' en %s entre %s y %s.",
+		"error.logtype.pattern":         "el patrón de tipo de registro '%s' no es válido: %v.",
+		"error.logtype.remote":          "el patrón de tipo de registro '%s' no se puede comparar con un archivo remoto, indique los tipos de registro.",
+		"error.cidr":                    "'%s' no es una subred, como 10.0.0.0/24, ni una dirección.",
+		"error.cidr.none":               "se requiere al menos una subred por la que filtrar, como argumentos o en --targets.",
+		"resume.finished":               "Se terminó %s.\n",
+		"resume.none":                   "Nada que terminar en %s: ninguna salida quedó incompleta.\n",
+		"filehashes.retrieved":          "Se recuperaron %d de %d archivo(s) en %s.\n",
+		"warn.history":                  "AVISO: no se pudo registrar la ejecución en el archivo de historial %s: %s\n",
+		"warn.maxinput":                 "AVISO: el pull lee %s de logs, por encima del --max-input-size de %s, se continúa por --force.\n",
+		"warn.maxinput.remote":          "AVISO: %s: los logs de %s se descargan antes de leerlos, así que no se cuentan para el --max-input-size de %s.\n",
+		"warn.lineage":                  "AVISO: no se pudo publicar el evento de linaje %s de %s: %v\n",
+		"warn.hook":                     "AVISO: el hook %s '%s' falló, se continúa: %v\n",
+		"warn.retrieve":                 "AVISO: no se pudo recuperar el archivo %s: %s\n",
+		"profile.sampled":               "Se perfilaron %d registro(s) de %d de %d log(s).\n",
+		"profile.header":                "CAMPO\tNULOS\tDISTINTOS\tVALORES MÁS COMUNES\n",
+		"error.onchange":                "--on-change inválido '%s'. Uno de: %s",
+		"error.waitlate":                "--wait-late inválido %s. No debe ser negativo.",
+		"error.waitlate.remote":         "--wait-late no puede vigilar un directorio de logs remoto.",
+		"error.manifest.stdout":         "--manifest lista los archivos de un directorio de salida, así que no se puede usar con --stdout.",
+		"error.compress":                "--compress inválido '%s'. Uno de: %s",
+		"error.compress.stdout":         "--compress no se puede usar con --stdout.",
+		"error.compress.zstd":           "--compress zstd necesita el comando zstd, que no se encontró.",
+		"error.compressoutput":          "--compress-output inválido '%s'. Uno de: %s",
+		"error.compressoutput.compress": "--compress-output ya escribe cada salida comprimida, así que no se puede usar con --compress.",
+		"error.compressoutput.zstd":     "--compress-output zstd necesita el comando zstd, que no se encontró.",
+		"error.compressoutput.arg":      "'%[1]s' se leyó como un argumento, por ejemplo del filtro, y no como el formato de --compress-output, que se puede dar sin él. Use --compress-output=%[1]s.",
+		"error.compresslevel":           "--compress-level inválido %d. Para %s, de 1 a %d, o 0 para su valor por defecto.",
+		"error.cachesize":               "el tamaño de la caché no puede ser negativo, se recibió %d.",
+		"remote.fetch":                  "Descargando %d log(s) de %s, %d ya en caché.\n",
+		"tar.extract":                   "Extrayendo %d log(s) de %s, %d ya extraídos.\n",
+		"error.retries":                 "el número de reintentos no puede ser negativo, se recibió %d.",
+		"warn.exhausted":                "AVISO: %s se quedó sin recursos (%s). Se ejecutará de nuevo con un máximo de %d tarea(s) a la vez.\n",
+		"warn.stall":                    "AVISO: el filtro de %s lleva inactivo %s (estado %s), acción: %s\n",
+		"error.stagebuffer":             "el búfer entre etapas debe ser de al menos 1 KB, se recibió %d.",
+		"error.readahead":               "la lectura anticipada no puede ser negativa, se recibió %d.",
+		"error.stalltimeout":            "el tiempo de detención no puede ser negativo, se recibió %s.",
+		"error.stallaction":             "acción de detención '%s' desconocida. Use una de: %s.",
+		"error.batchdelimiter":          "--batch-delimiter no puede estar vacío con --batch.",
+		"error.top":                     "--top no puede ser negativo, se recibió %d.",
+		"error.connsummary":             "resumen de conn '%s' desconocido. Use uno de: %s.",
+		"error.connsummary.conn":        "--conn-summary resume logs conn, no logs %s.",
+		"error.connsummary.unique":      "--conn-summary no se puede usar junto con --unique.",
+		"error.connsummary.stdout":      "--conn-summary alongside necesita un directorio de salida donde escribir el resumen. Use --conn-summary only para escribirlo en la salida estándar.",
+		"error.top.unique":              "--top necesita los campos cuyos valores contar, dados con --unique.",
+		"error.hash.salt":               "--hash necesita una sal con la que calcular el hash de los valores, dada con --hash-salt o en %s.",
+		"error.hash.unique":             "el campo '%s' de --hash no es uno de los campos de --unique.",
+		"error.fingerprints":            "no hay huellas que buscar: páselas como argumentos, o lístelas en un archivo --targets.",
+		"error.hashes":                  "no hay hashes que buscar: páselos como argumentos, o lístelos en un archivo --targets.",
+		"error.extract.stdout":          "--extract escribe los archivos recuperados en el directorio de salida, así que no puede usarse con --stdout.",
+		"error.extract.command":         "--extract necesita un file_extract_command en el archivo de configuración con el que recuperar archivos.",
+		"error.maxrecords":              "el máximo de registros no puede ser negativo, se recibió %d.",
+		"error.order":                   "orden '%s' desconocido. Use %s o %s.",
+		"error.corrupt":                 "%d registro(s) de origen están corruptos: %s",
+		"error.corruptflags":            "--skip-corrupt y --fail-on-corrupt no se pueden usar juntos.",
+		"error.optionaltime":            "--%s '%s' está mal formado. Proporcione una hora con el siguiente formato: AAAA/MM/DD:HH",
+		"error.bytesize":                "--%s '%s' está mal formado. Proporcione un tamaño como 500G, en K, M, G, T o P.",
+		"error.filetimewindow":          "--modified-since debe ser anterior a --modified-before.",
+		"error.filetimefield":           "tiempo de archivo '%s' desconocido. Use mtime o ctime.",
+		"error.monthrange":              "--month y --timerange no se pueden usar juntos.",
+		"error.hours":                   "las horas '%s' están mal formadas. Proporcione un rango de horas con el formato HH-HH, como 08-18.",
+		"error.masknone":                "--outside-mask necesita --hours, --weekdays o --weekends para invertir.",
+		"error.preset.notfound":         "no hay ningún preset llamado '%s'. Use 'nagini preset' para ver los presets disponibles.",
+		"error.playbook.name":           "el nombre de playbook '%s' no está dentro de la biblioteca de playbooks.",
+		"error.playbook.notfound":       "no hay ningún playbook llamado '%s' en %s. Use 'nagini playbook list' para ver los playbooks disponibles.",
+		"library.unversioned":           "no es un checkout de git",
+		"error.outputformat.parquet":    "--output-format parquet escribe un archivo por tipo de log y fecha, así que no se puede usar con --%s.",
+		"error.outputformat":            "el formato de salida '%s' no es compatible. Use uno de: %s.",
+		"error.fieldorder":              "el orden de campos '%s' no es válido. Use source, alphabetical o una lista de campos separados por comas.",
+		"error.fieldorder.msgpack":      "--field-order solo se aplica a la salida json, los mapas msgpack siempre se escriben con sus claves ordenadas.",
+		"error.reportformat":            "el formato de informe '%s' no es compatible. Use uno de: %s.",
+		"error.provenance.stdout":       "--provenance no se puede usar con --stdout, ya que no hay archivos de salida que describir.",
+		"error.reportstdout":            "--render-report no se puede usar con --stdout, ya que no hay directorio de salida donde generarlo.",
+		"error.reporttemplate":          "la plantilla de informe %s no existe.",
+		"error.reporttemplate.noformat": "--report-template requiere --render-report.",
+		"error.ticket.nowebhook":        "--ticket requiere que ticket_webhook esté configurado en el archivo de configuración.",
+		"error.ticket":                  "no se pudo actualizar el ticket %s, la salida se conserva: %v",
+		"error.upload.target":           "--upload debe ser una URL s3://bucket/prefijo/, no %s.",
+		"error.upload.stdout":           "--upload no se puede usar con --stdout, ya que no hay directorio de salida que subir.",
+		"error.upload.credentials":      "--upload requiere s3_access_key_id y s3_secret_access_key en el archivo de configuración, o AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY en el entorno.",
+		"error.upload.remove":           "--upload-remove requiere --upload.",
+		"error.upload":                  "no se pudo subir la salida a %s, los archivos no subidos se conservan: %v",
+		"error.schemascan":              "no se pudieron leer los esquemas de los logs: %v",
+		"error.var":                     "la variable '%s' está mal formada. Proporciónela como nombre=valor.",
+		"validate.failed":               "se encontraron %d problema(s) con los argumentos proporcionados:",
+		"error.logdir":                  "directorio de registros Zeek %s no válido: no existe o no es un directorio.",
+		"error.script":                  "el script '%s' no existe.",
+		"error.script.confirm":          "--script - lee el script de la entrada estándar, por lo que requiere --noconfirm.",
+		"error.script.empty":            "el script en línea está vacío.",
+		"error.script.shebang":          "el script en línea debe empezar con una línea #! que indique su intérprete, como #!/bin/sh.",
+		"error.script.interpreter":      "el script '%s' se ejecuta con '%s', que no se encontró.",
+		"error.script.requires":         "el script '%s' requiere '%s', que no está en el PATH.",
+		"error.script.selftest":         "el script '%s' no superó su autoprueba, ejecutado con %s: %s.",
+		"script.timeout":                "se agotó el tiempo tras %s",
+		"error.scriptexec":              "el script '%s' existe pero no está marcado como ejecutable.",
+		"error.command":                 "no se encontró un ejecutable '%s'. Asegúrese de que existe y está marcado como ejecutable.",
+		"error.language":                "error: idioma '%s' no soportado. Idiomas soportados: %s\n",
+
+		"config.notfound": "AVISO: no se encontró un archivo de configuración en /etc/nagini ni en ~/.config/nagini, usando valores por defecto. Ejecute 'nagini init' para crear uno.",
+
+		"init.logdir":       "¿Qué directorio de registros Zeek se debe usar?",
+		"init.logdir.other": "Otro directorio",
+		"init.logdir.enter": "Directorio de registros Zeek",
+		"init.logdir.none":  "No se encontró un directorio de registros Zeek en las ubicaciones habituales.",
+		"init.threads":      "Número de hilos por defecto (este sistema tiene %d CPUs)",
+		"init.overwrite":    "%s ya existe. ¿Sobrescribirlo?",
+		"init.written":      "Configuración escrita en %s\n",
+		"init.validating":   "Ejecutando una extracción de validación de registros %s desde %s\n",
+		"init.validated":    "Validación correcta: se leyeron %d registros de %s\n",
+		"init.novalidation": "AVISO: la extracción de validación falló: %s\n",
+		"error.number":      "error: '%s' no es un número positivo.\n",
+	},
+}
+
+// returns the list of languages that have a message catalog.
+func SupportedLanguages() (langs []string) {
+	for lang := range messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// sets the language used for user-facing messages. Returns an error if there is
+// no catalog for the given language, leaving the current language untouched.
+func SetLanguage(lang string) error {
+	lang = normalizeLanguage(lang)
+	if _, ok := messages[lang]; !ok {
+		return fmt.Errorf("unsupported language '%s'", lang)
+	}
+	language = lang
+	return nil
+}
+
+// returns the currently selected language.
+func Language() string {
+	return language
+}
+
+// determines the language to use. A configured language always wins, otherwise
+// the standard locale environment variables are checked in order of priority.
+// Falls back to DefaultLanguage if nothing usable is found.
+func DetectLanguage(configured string) string {
+	candidates := []string{configured, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")}
+	for _, candidate := range candidates {
+		lang := normalizeLanguage(candidate)
+		if _, ok := messages[lang]; ok {
+			return lang
+		}
+	}
+	return DefaultLanguage
+}
+
+// turns a locale such as es_MX.UTF-8 into a bare language code (es).
+func normalizeLanguage(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "_.@-"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// translates the message with the given id into the current language, formatting
+// it with args if any are given. Untranslated messages fall back to English, and
+// unknown ids are returned as-is so a missing entry is obvious but not fatal.
+func T(id string, args ...interface{}) string {
+	msg, ok := messages[language][id]
+	if !ok {
+		msg, ok = messages[DefaultLanguage][id]
+		if !ok {
+			msg = id
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
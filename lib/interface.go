@@ -1,8 +1,11 @@
 package lib
 
 import (
+	"bufio"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/cheggaaa/pb"
 	"github.com/spf13/cobra"
@@ -11,10 +14,17 @@ import (
 
 // ask the user to continue or exit. Returns true if continue, false if not.
 func WaitForConfirm(cmd *cobra.Command) (start bool) {
-	startMenu := wmenu.NewMenu("Continue?")
-	startMenu.IsYesNo(0)
+	startMenu := wmenu.NewMenu(T("confirm.continue"))
+	if Language() == DefaultLanguage {
+		startMenu.IsYesNo(0)
+	} else {
+		// wmenu only understands english y/n answers, so present translated
+		// numbered options instead. Option 0 is yes, matching IsYesNo.
+		startMenu.Option(T("confirm.yes"), nil, true, nil)
+		startMenu.Option(T("confirm.no"), nil, false, nil)
+	}
 	startMenu.LoopOnInvalid()
-	startMenu.ChangeReaderWriter(os.Stdin, os.Stderr, os.Stderr)
+	startMenu.ChangeReaderWriter(cmd.InOrStdin(), cmd.ErrOrStderr(), cmd.ErrOrStderr())
 	startMenu.Action(func(opts []wmenu.Opt) error {
 		start = (opts[0].ID == 0)
 		return nil
@@ -31,10 +41,10 @@ func WaitForConfirm(cmd *cobra.Command) (start bool) {
 // set up task, bar interface.
 func InitBars(dayCount int, taskCount int, logger *log.Logger) (pool *pb.Pool, dayBar *pb.ProgressBar, taskBar *pb.ProgressBar) {
 	dayBar = pb.New(dayCount)
-	dayBar.BarStart = "Days Complete: ["
+	dayBar.BarStart = T("bar.days")
 	dayBar.ShowPercent = false
 	taskBar = pb.New(taskCount)
-	taskBar.BarStart = "Log Parses Complete: ["
+	taskBar.BarStart = T("bar.tasks")
 	pool, err := pb.StartPool(taskBar, dayBar)
 	pool.Output = os.Stderr
 	if err != nil {
@@ -42,3 +52,50 @@ func InitBars(dayCount int, taskCount int, logger *log.Logger) (pool *pb.Pool, d
 	}
 	return pool, dayBar, taskBar
 }
+
+// ask the user to pick one of the given options. Returns the index of the chosen option,
+// or def if the user just presses enter.
+func PromptChoice(cmd *cobra.Command, question string, options []string, def int) (choice int) {
+	choice = def
+	menu := wmenu.NewMenu(question)
+	menu.LoopOnInvalid()
+	menu.ChangeReaderWriter(cmd.InOrStdin(), cmd.ErrOrStderr(), cmd.ErrOrStderr())
+	for i, option := range options {
+		menu.Option(option, i, i == def, nil)
+	}
+	menu.Action(func(opts []wmenu.Opt) error {
+		choice = opts[0].Value.(int)
+		return nil
+	})
+	e := menu.Run()
+	if e != nil {
+		cmd.PrintErrln(e)
+	}
+	cmd.Println()
+	return choice
+}
+
+// shared reader for free text prompts, so buffered input is not lost between prompts.
+// it is replaced whenever prompts start reading from a different source.
+var promptSource io.Reader
+var promptReader *bufio.Reader
+
+// ask the user for a line of free text. Returns def if the user just presses enter
+// or input could not be read.
+func PromptString(cmd *cobra.Command, question string, def string) string {
+	cmd.Printf("%s [%s]: ", question, def)
+	if promptSource != cmd.InOrStdin() {
+		promptSource = cmd.InOrStdin()
+		promptReader = bufio.NewReader(promptSource)
+	}
+	line, e := promptReader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if e != nil && line == "" {
+		cmd.Println()
+		return def
+	}
+	if line == "" {
+		return def
+	}
+	return line
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// fields holding addresses in the standard zeek log types, besides the id.orig_h and the like
+// ending in _h, and the *_addr and *_hosts fields, such as the src of notice logs or the
+// x_originating_ip of smtp logs.
+var addressFields = map[string]bool{"src": true, "dst": true, "host": true, "x_originating_ip": true, "path": true, "san.ip": true}
+
+// returns whether field holds addresses, by its name, or by its zeek type, from the #types
+// header of a TSV log, if known.
+func isAddressField(field string, zeekType string) bool {
+	if zeekType != "" {
+		return zeekType == "addr" || zeekType == "set[addr]" || zeekType == "vector[addr]"
+	}
+	switch {
+	case strings.HasSuffix(field, "_l2_addr"):
+		return false
+	case strings.HasSuffix(field, "_h"), strings.HasSuffix(field, "_addr"), strings.HasSuffix(field, "_hosts"):
+		return true
+	}
+	return addressFields[field]
+}
+
+// returns the fields of logType in known that hold addresses, such as id.orig_h and id.resp_h
+// of conn logs, in the order of the log type. Empty if the log type is not known.
+func AddressFields(logType string, known LogTypes) (fields []string) {
+	for _, field := range known[logType] {
+		if isAddressField(field, "") {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// IPFilter keeps the records of a log with an address in one of a list of subnets, in-process,
+// rather than running a tool such as grepcidr on each log. JSON records are matched on their
+// address fields, and TSV records on the columns their #types header says hold addresses, or
+// named like address fields if there is none. Sets and vectors of addresses match if any of
+// their addresses does. Headers are passed on, so TSV records can still be read by field.
+type IPFilter struct {
+	subnets []string
+	nets    []*net.IPNet
+	fields  []string        // the only fields matched on, if set
+	matched map[string]bool // fields, to look up
+}
+
+// returns a filter keeping the records with an address in any of subnets, each a CIDR such as
+// 10.0.0.0/24 or an address, matched on fields if any are given, otherwise on every address
+// field. Returns an error naming the first subnet that is not valid.
+func NewIPFilter(subnets []string, fields []string) (*IPFilter, error) {
+	f := &IPFilter{subnets: subnets}
+	for _, subnet := range subnets {
+		ipNet, err := parseSubnet(subnet)
+		if err != nil {
+			return nil, err
+		}
+		f.nets = append(f.nets, ipNet)
+	}
+	if len(fields) > 0 {
+		f.fields, f.matched = fields, make(map[string]bool, len(fields))
+		for _, field := range fields {
+			f.matched[field] = true
+		}
+	}
+	return f, nil
+}
+
+// parses subnet, a CIDR such as 10.0.0.0/24, or an address, as a subnet of only itself.
+func parseSubnet(subnet string) (*net.IPNet, error) {
+	cidr := subnet
+	if !strings.Contains(cidr, "/") {
+		if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else if ip != nil {
+			cidr += "/128"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.New(T("error.cidr", subnet))
+	}
+	return ipNet, nil
+}
+
+// returns the subnets of the filter.
+func (f *IPFilter) String() string {
+	return strings.Join(f.subnets, " ")
+}
+
+// returns the only fields the filter matches on, or nil if it matches on every address field.
+func (f *IPFilter) Fields() []string {
+	return f.fields
+}
+
+// returns whether field of type zeekType is matched on, see isAddressField.
+func (f *IPFilter) matchesField(field string, zeekType string) bool {
+	if f.matched != nil {
+		return f.matched[field]
+	}
+	return isAddressField(field, zeekType)
+}
+
+// returns whether value, an address or a list of them separated by commas, is in one of the
+// subnets.
+func (f *IPFilter) matchesValue(value string) bool {
+	return inSubnets(f.nets, value)
+}
+
+// returns whether value, an address or a list of them separated by commas, is in one of nets.
+func inSubnets(nets []*net.IPNet, value string) bool {
+	for _, address := range strings.Split(value, ",") {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns whether the JSON record has an address in one of the subnets.
+func (f *IPFilter) matchesJSON(record []byte) (matched bool) {
+	scanObject(record, func(key []byte, value []byte) bool {
+		if !f.matchesField(string(key), "") {
+			return true
+		}
+		switch value[0] {
+		case '"':
+			matched = f.matchesValue(string(value[1 : len(value)-1]))
+		case '[':
+			var addresses []string
+			json.Unmarshal(value, &addresses)
+			matched = f.matchesValue(strings.Join(addresses, ","))
+		}
+		return !matched
+	})
+	return matched
+}
+
+// copies the headers of input, and the records with an address in one of the subnets, to
+// output. Stops early once ctx is cancelled, such as when no more records are wanted, or once
+// writing to output fails.
+func (f *IPFilter) Filter(ctx context.Context, input io.Reader, output io.Writer) error {
+	lines, w := newLineReader(input), getWriter(output)
+	defer lines.close()
+	defer putWriter(w)
+	var fields, types []string // of the last #fields and #types headers, for TSV records
+	var columns []int          // columns of TSV records matched on
+	for ctx.Err() == nil {
+		line, readErr := lines.next()
+		record := bytes.TrimRight(line, "\r\n")
+		keep := false
+		switch {
+		case len(record) == 0:
+		case bytes.HasPrefix(record, []byte("#fields\t")), bytes.HasPrefix(record, []byte("#types\t")):
+			keep = true
+			if record[1] == 'f' {
+				fields, types = strings.Split(string(record), "\t")[1:], nil
+			} else {
+				types = strings.Split(string(record), "\t")[1:]
+			}
+			columns = columns[:0]
+			for i, field := range fields {
+				zeekType := ""
+				if len(types) == len(fields) {
+					zeekType = types[i]
+				}
+				if f.matchesField(field, zeekType) {
+					columns = append(columns, i)
+				}
+			}
+		case record[0] == '#':
+			keep = true
+		case record[0] == '{':
+			keep = f.matchesJSON(record)
+		default:
+			values := bytes.Split(record, []byte("\t"))
+			for _, i := range columns {
+				if i < len(values) && f.matchesValue(string(values[i])) {
+					keep = true
+					break
+				}
+			}
+		}
+		if keep {
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ConcatJournalSuffix is added to the name of an output file for the journal kept next to it
+// while it is concatenated.
+const ConcatJournalSuffix = ".concat-journal"
+
+// the progress of concatenating inputs into an output file, saved after each input so a
+// concatenation cut short can be finished from where it was.
+type concatJournal struct {
+	Output        string   `json:"output"`
+	Inputs        []string `json:"inputs"`         // in the order they are written
+	Done          int      `json:"done"`           // inputs written in full
+	Offset        int64    `json:"offset"`         // size of the output once they were
+	DeleteInputs  bool     `json:"delete_inputs"`  // delete each input once written
+	IgnoreMissing bool     `json:"ignore_missing"` // do not log inputs that are missing
+
+	// with a final name, the output is written under a partial name and renamed to it once
+	// complete, and then recorded as Entry in the manifest, if any.
+	Final    string         `json:"final,omitempty"`
+	Manifest string         `json:"manifest,omitempty"`
+	Entry    *ManifestEntry `json:"entry,omitempty"`
+}
+
+// saves the journal next to its output, replacing the last one at once so a crash never
+// leaves it half written.
+func (j *concatJournal) save() error {
+	encoded, _ := json.Marshal(j)
+	path := j.Output + ConcatJournalSuffix
+	if err := ioutil.WriteFile(path+".tmp", encoded, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// sorts the inputs, saves the journal and creates the output, then writes every input to it.
+func (j *concatJournal) start(logger *log.Logger) error {
+	sort.Strings(j.Inputs)
+	if err := j.save(); err != nil {
+		return err
+	}
+	out, err := os.Create(j.Output)
+	if err != nil {
+		return err
+	}
+	return j.run(logger, out)
+}
+
+// writes the inputs not done yet to out, which must be at the offset of the journal, saving
+// the journal after each. Closes out, and removes the journal once every input is written.
+// If the output is compressed as it is written, each input is compressed on its own, as a
+// member of a gzip stream or a frame of a zstd one, so the output can be cut back to the end
+// of any of them.
+func (j *concatJournal) run(logger *log.Logger, out *os.File) (e error) {
+	compression := writtenCompression(j.finalName())
+	for j.Done < len(j.Inputs) {
+		inputFile := j.Inputs[j.Done]
+		if compression != "" {
+			var compressor io.WriteCloser
+			if compressor, e = newCompressor(out, compression); e == nil {
+				e = concatFile(logger, inputFile, compressor, j.IgnoreMissing)
+				if closeErr := compressor.Close(); e == nil {
+					e = closeErr
+				}
+			}
+		} else {
+			e = concatFile(logger, inputFile, out, j.IgnoreMissing)
+		}
+		if e == nil {
+			// the input is only done once it is on disk.
+			e = out.Sync()
+		}
+		if e == nil {
+			j.Offset, e = out.Seek(0, io.SeekCurrent)
+		}
+		if e == nil {
+			j.Done++
+			e = j.save()
+		}
+		if e != nil {
+			out.Close()
+			return e
+		}
+		// an input is only removed once the journal says it is done, so a crash in between
+		// leaves it to be removed on resume rather than written twice.
+		if j.DeleteInputs {
+			removeConcatInput(logger, inputFile)
+		}
+	}
+	if e = out.Close(); e != nil {
+		return e
+	}
+	return j.finish()
+}
+
+// renames the complete output to its final name and records it in the manifest, if it has
+// them, then removes the journal. Safe to repeat if cut short after the rename.
+func (j *concatJournal) finish() error {
+	if j.Final != "" {
+		if err := os.Rename(j.Output, j.Final); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if j.Manifest != "" && j.Entry != nil {
+			if err := recordOutput(j.Manifest, *j.Entry); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Remove(j.Output + ConcatJournalSuffix)
+}
+
+// returns the file the output of the journal ends up in.
+func (j *concatJournal) finalName() string {
+	if j.Final != "" {
+		return j.Final
+	}
+	return j.Output
+}
+
+// finishes the concatenation journaled at path: drops whatever was written to the output
+// after the last input done, removes inputs done but not yet removed, and writes the rest.
+// Returns the file the output ends up in.
+func resumeConcat(logger *log.Logger, path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var j concatJournal
+	if err = json.Unmarshal(content, &j); err != nil {
+		return "", fmt.Errorf("could not read concat journal %s: %w", path, err)
+	}
+	if j.Done > len(j.Inputs) {
+		return "", fmt.Errorf("could not read concat journal %s: %d of %d inputs done", path, j.Done, len(j.Inputs))
+	}
+	if j.DeleteInputs {
+		for _, inputFile := range j.Inputs[:j.Done] {
+			removeConcatInput(logger, inputFile)
+		}
+	}
+	// cut short after the output was renamed into place, so only the rest is left to do.
+	if _, err = os.Stat(j.Output); j.Final != "" && j.Done == len(j.Inputs) && os.IsNotExist(err) {
+		return j.Final, j.finish()
+	}
+	out, err := os.OpenFile(j.Output, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return "", err
+	}
+	if err = out.Truncate(j.Offset); err == nil {
+		_, err = out.Seek(j.Offset, io.SeekStart)
+	}
+	if err != nil {
+		out.Close()
+		return "", err
+	}
+	return j.finalName(), j.run(logger, out)
+}
+
+// ResumeConcats finishes every concatenation of outputs in dir that was cut short, such as by
+// the process being killed, from the journals left next to them. Returns the output files
+// finished. Outputs that are built from others, such as the single file of --concat, are only
+// built if they were started.
+func ResumeConcats(logger *log.Logger, dir string) (finished []string, err error) {
+	journals, err := filepath.Glob(filepath.Join(dir, "*"+ConcatJournalSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(journals)
+	// a crash while saving a journal leaves its temp file next to the journal it replaced.
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*"+ConcatJournalSuffix+".tmp"))
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+	for _, journal := range journals {
+		output, err := resumeConcat(logger, journal)
+		if err != nil {
+			return finished, err
+		}
+		finished = append(finished, output)
+	}
+	return finished, nil
+}
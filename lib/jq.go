@@ -0,0 +1,154 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// JQFilter runs a jq expression over every record of a log in-process, rather than running
+// jq once per log. JSON records are given to it as they are, and zeek TSV records as an
+// object of the fields in the #fields header before them, with unset fields null, and values
+// typed by the #types header, so ports and counts compare as numbers as in JSON records.
+type JQFilter struct {
+	expr string
+	code *gojq.Code
+}
+
+// compiles the jq expression expr. Returns an error if it is not valid jq.
+func NewJQFilter(expr string) (*JQFilter, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("jq: %w", err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("jq: %w", err)
+	}
+	return &JQFilter{expr: expr, code: code}, nil
+}
+
+// returns the expression of the filter.
+func (f *JQFilter) String() string {
+	return f.expr
+}
+
+// runs the expression over every record of input, writing each result to output as a line of
+// compact JSON. Records the expression fails on are skipped, like jq does, and the first
+// failure is returned once input is done. Stops early once ctx is cancelled, such as when no
+// more records are wanted, or once writing to output fails.
+func (f *JQFilter) Filter(ctx context.Context, input io.Reader, output io.Writer) error {
+	lines, w := newLineReader(input), getWriter(output)
+	defer lines.close()
+	defer putWriter(w)
+	var fields, types []string // of the last #fields and #types headers, for TSV records
+	var failed int
+	var firstErr error
+	for ctx.Err() == nil {
+		line, readErr := lines.next()
+		line = bytes.TrimRight(line, "\r\n")
+		if bytes.HasPrefix(line, []byte("#fields\t")) {
+			types = nil
+		} else if bytes.HasPrefix(line, []byte("#types\t")) {
+			types = strings.Split(string(line), "\t")[1:]
+		}
+		if record, ok := decodeRecord(line, &fields); ok {
+			if object, isObject := record.(map[string]interface{}); isObject && line[0] != '{' {
+				typeTSVRecord(object, fields, types)
+			}
+			iter := f.code.RunWithContext(ctx, record)
+			for {
+				result, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if err, isErr := result.(error); isErr {
+					if failed++; firstErr == nil {
+						firstErr = err
+					}
+					break
+				}
+				encoded, err := gojq.Marshal(result)
+				if err == nil {
+					w.Write(encoded)
+					err = w.WriteByte('\n')
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return fmt.Errorf("jq failed on %d record(s), first: %w", failed, firstErr)
+	}
+	return nil
+}
+
+// types the values of a TSV record by the zeek types of its fields, as parquetValue does, with
+// numbers as json.Number, as those of JSON records are decoded.
+func typeTSVRecord(record map[string]interface{}, fields []string, types []string) {
+	for i, field := range fields {
+		if i >= len(types) {
+			break
+		}
+		value, isString := record[field].(string)
+		if !isString {
+			continue
+		}
+		switch typed := parquetValue(value, types[i]).(type) {
+		case int64, float64:
+			record[field] = json.Number(value)
+		case bool:
+			record[field] = typed
+		}
+	}
+}
+
+// returns the record held by a line of a log, or false if it holds no record, such as a
+// header. JSON records are decoded with numbers as json.Number, and TSV records as an object
+// of fields, with unset fields nil. A #fields header replaces the fields of TSV records.
+func decodeRecord(line []byte, fields *[]string) (record interface{}, ok bool) {
+	switch {
+	case len(bytes.TrimSpace(line)) == 0:
+		return nil, false
+	case bytes.HasPrefix(line, []byte("#fields\t")):
+		*fields = strings.Split(string(line), "\t")[1:]
+		return nil, false
+	case line[0] == '#':
+		return nil, false
+	case line[0] == '{':
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if decoder.Decode(&record) == nil {
+			return record, true
+		}
+	}
+	values := strings.Split(string(line), "\t")
+	if len(values) != len(*fields) {
+		// not a record of the last header, so it is given as a string.
+		return string(line), true
+	}
+	object := make(map[string]interface{}, len(values))
+	for i, field := range *fields {
+		if values[i] == unsetField {
+			object[field] = nil
+		} else {
+			object[field] = values[i]
+		}
+	}
+	return object, true
+}
@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// calls visit with the raw key and value of each member of the JSON object record, in order,
+// until visit returns false, without decoding or copying them, so the fields of a record can
+// be read or rewritten without allocating. Keys are given without their quotes, with any
+// escapes as they are. Returns false if record is not an object, or is cut short.
+func scanObject(record []byte, visit func(key []byte, value []byte) bool) bool {
+	i := skipSpace(record, 0)
+	if i >= len(record) || record[i] != '{' {
+		return false
+	}
+	i = skipSpace(record, i+1)
+	if i < len(record) && record[i] == '}' {
+		return skipSpace(record, i+1) == len(record)
+	}
+	for {
+		if i >= len(record) || record[i] != '"' {
+			return false
+		}
+		end := scanString(record, i)
+		if end < 0 {
+			return false
+		}
+		key := record[i+1 : end-1]
+		if i = skipSpace(record, end); i >= len(record) || record[i] != ':' {
+			return false
+		}
+		i = skipSpace(record, i+1)
+		if end = scanValue(record, i); end < 0 {
+			return false
+		}
+		if !visit(key, record[i:end]) {
+			return true
+		}
+		if i = skipSpace(record, end); i >= len(record) {
+			return false
+		}
+		switch record[i] {
+		case '}':
+			return skipSpace(record, i+1) == len(record)
+		case ',':
+			i = skipSpace(record, i+1)
+		default:
+			return false
+		}
+	}
+}
+
+// returns the index of the first byte of b from i on that is not JSON whitespace.
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\r' || b[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// returns the index just past the JSON string starting at b[i], or -1 if it is not closed.
+func scanString(b []byte, i int) int {
+	for j := i + 1; j < len(b); j++ {
+		switch b[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// returns the index just past the JSON value starting at b[i], or -1 if there is none.
+// Objects and arrays are skipped over without checking what is in them.
+func scanValue(b []byte, i int) int {
+	if i >= len(b) {
+		return -1
+	}
+	switch c := b[i]; {
+	case c == '"':
+		return scanString(b, i)
+	case c == '{' || c == '[':
+		depth := 0
+		for j := i; j < len(b); j++ {
+			switch b[j] {
+			case '"':
+				if j = scanString(b, j); j < 0 {
+					return -1
+				}
+				j--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return -1
+	case c == '-' || (c >= '0' && c <= '9'):
+		j := i + 1
+		for j < len(b) && isNumberByte(b[j]) {
+			j++
+		}
+		return j
+	}
+	for _, literal := range [...]string{"true", "false", "null"} {
+		if len(b)-i >= len(literal) && string(b[i:i+len(literal)]) == literal {
+			return i + len(literal)
+		}
+	}
+	return -1
+}
+
+// returns whether c can be part of a JSON number.
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-'
+}
+
+// appends a raw scalar JSON value to dst as text the way sqlRecord gives it: strings decoded,
+// numbers as written, booleans as T or F, and null as unset, which it also says. Returns false
+// for objects and arrays.
+func appendScalarText(dst []byte, value []byte) (text []byte, null bool, ok bool) {
+	switch value[0] {
+	case '"':
+		raw := value[1 : len(value)-1]
+		// the decoder replaces invalid UTF-8, which is only worth doing here when there is any.
+		if bytes.IndexByte(raw, '\\') < 0 && utf8.Valid(raw) {
+			return append(dst, raw...), false, true
+		}
+		var decoded string
+		if json.Unmarshal(value, &decoded) != nil {
+			return dst, false, false
+		}
+		return append(dst, decoded...), false, true
+	case '{', '[':
+		return dst, false, false
+	case 't':
+		return append(dst, 'T'), false, true
+	case 'f':
+		return append(dst, 'F'), false, true
+	case 'n':
+		return append(dst, unsetField...), true, true
+	}
+	return append(dst, value...), false, true
+}
+
+// returns whether a zeek field name, such as id.orig_h, is given by name with its dots written
+// as underscores, such as id_orig_h, as in a SQL query.
+func underscoredField(key []byte, name string) bool {
+	if len(key) != len(name) || bytes.IndexByte(key, '.') < 0 {
+		return false
+	}
+	for i, c := range key {
+		if c == '.' {
+			c = '_'
+		}
+		if c != name[i] {
+			return false
+		}
+	}
+	return true
+}
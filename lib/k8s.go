@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ContainerLogDir is where the zeek logs are mounted in a container, as by the Dockerfile and
+// the manifests of RenderJobManifest.
+const ContainerLogDir = "/data/zeek/logs"
+
+// memory requested per thread by the manifests of RenderJobManifest. Each is allowed twice
+// this before being killed.
+const JobMemoryPerThreadMB = 256
+
+// JobManifest describes a Kubernetes Job, or CronJob, that runs a playbook in a container.
+type JobManifest struct {
+	Name        string   // name of the Job or CronJob, and of the ConfigMap holding its playbook
+	Namespace   string   // namespace to create them in, or empty for the current one
+	Image       string   // nagini image to run
+	Schedule    string   // cron schedule to run on, as a CronJob, or empty to run once, as a Job
+	LogClaim    string   // PersistentVolumeClaim holding the zeek logs, mounted read-only
+	OutputClaim string   // PersistentVolumeClaim to write outputs to, or empty for a scratch volume
+	Threads     int      // threads of the pull, which its cpu and memory are derived from
+	Playbook    Playbook // playbook to run, with its variables filled in
+}
+
+// non DNS-1123 characters of a name.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// returns a Kubernetes name for the playbook at path, from its file name, such as dns-evil for
+// dns_evil.yaml. Names are cut to 52 characters, the longest a CronJob can have.
+func JobName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > 52 {
+		name = name[:52]
+	}
+	if name = strings.Trim(name, "-"); name == "" {
+		name = "nagini"
+	}
+	return name
+}
+
+// functions of the manifest templates. Strings are quoted as JSON, which YAML reads as is.
+var manifestFuncs = template.FuncMap{
+	"quote": func(s string) string {
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	},
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n"+pad)
+	},
+	"mul": func(a, b int) int { return a * b },
+}
+
+var jobManifestTemplate = template.Must(template.New("job").Funcs(manifestFuncs).Parse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ quote .Name }}
+{{- if .Namespace }}
+  namespace: {{ quote .Namespace }}
+{{- end }}
+  labels:
+    app.kubernetes.io/name: nagini
+data:
+  playbook.yaml: |
+{{ indent 4 .PlaybookYAML }}
+---
+{{- if .Schedule }}
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: {{ quote .Name }}
+{{- if .Namespace }}
+  namespace: {{ quote .Namespace }}
+{{- end }}
+  labels:
+    app.kubernetes.io/name: nagini
+spec:
+  schedule: {{ quote .Schedule }}
+  concurrencyPolicy: Forbid
+  jobTemplate:
+    spec:
+{{ indent 6 .JobSpec }}
+{{- else }}
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ quote .Name }}
+{{- if .Namespace }}
+  namespace: {{ quote .Namespace }}
+{{- end }}
+  labels:
+    app.kubernetes.io/name: nagini
+spec:
+{{ indent 2 .JobSpec }}
+{{- end }}
+`))
+
+var jobSpecTemplate = template.Must(template.New("spec").Funcs(manifestFuncs).Parse(`backoffLimit: 0
+template:
+  metadata:
+    labels:
+      app.kubernetes.io/name: nagini
+  spec:
+    restartPolicy: Never
+    containers:
+      - name: nagini
+        image: {{ quote .Image }}
+        args: ["play", "/etc/nagini/playbook/playbook.yaml"]
+        env:
+          - name: NAGINI_CONTAINER
+            value: "true"
+          - name: NAGINI_ZEEK_LOG_DIR
+            value: {{ quote .LogDir }}
+        resources:
+          requests:
+            cpu: "{{ .Threads }}"
+            memory: "{{ mul .Threads .MemoryMB }}Mi"
+          limits:
+            cpu: "{{ .Threads }}"
+            memory: "{{ mul .Threads (mul .MemoryMB 2) }}Mi"
+        volumeMounts:
+          - name: logs
+            mountPath: {{ quote .LogDir }}
+            readOnly: true
+          - name: output
+            mountPath: {{ quote .OutputDir }}
+          - name: playbook
+            mountPath: /etc/nagini/playbook
+            readOnly: true
+    volumes:
+      - name: logs
+        persistentVolumeClaim:
+          claimName: {{ quote .LogClaim }}
+          readOnly: true
+      - name: output
+{{- if .OutputClaim }}
+        persistentVolumeClaim:
+          claimName: {{ quote .OutputClaim }}
+{{- else }}
+        emptyDir: {}
+{{- end }}
+      - name: playbook
+        configMap:
+          name: {{ quote .Name }}
+`))
+
+// RenderJobManifest writes the Kubernetes manifest of m to w: a ConfigMap holding its
+// playbook, then a Job running it once, or a CronJob running it on m.Schedule. The logs are
+// mounted read-only at ContainerLogDir and outputs written under ContainerOutputDir, which the
+// playbook is pointed at. Each thread gets a cpu and JobMemoryPerThreadMB of memory.
+func RenderJobManifest(w io.Writer, m JobManifest) error {
+	playbook := m.Playbook
+	playbook.ZeekLogDir = ContainerLogDir
+	// output directories are kept on the output volume. Without one, every run gets its own.
+	if playbook.OutputDir != "" {
+		playbook.OutputDir = filepath.Join(ContainerOutputDir, filepath.Base(playbook.OutputDir))
+	}
+	encoded, err := yaml.Marshal(playbook)
+	if err != nil {
+		return err
+	}
+	if m.Threads < 1 {
+		m.Threads = 1
+	}
+
+	var spec strings.Builder
+	err = jobSpecTemplate.Execute(&spec, struct {
+		JobManifest
+		LogDir    string
+		OutputDir string
+		MemoryMB  int
+	}{m, ContainerLogDir, ContainerOutputDir, JobMemoryPerThreadMB})
+	if err != nil {
+		return err
+	}
+	return jobManifestTemplate.Execute(w, struct {
+		JobManifest
+		PlaybookYAML string
+		JobSpec      string
+	}{m, string(encoded), spec.String()})
+}
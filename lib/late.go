@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// time a late log has to go unmodified before it is read, so one still being written is not
+// read half way. Logs still being written when the grace period is over are read as they are.
+const lateSettle = 2 * time.Second
+
+// lateWatcher watches the date directories of a pull for logs delivered late, such as by a
+// sensor catching up, until the grace period after the first pass over the logs is over.
+type lateWatcher struct {
+	watcher *fsnotify.Watcher
+	logDir  string
+	logger  *log.Logger
+	done    chan struct{} // closed once the grace period is over.
+
+	lock    sync.Mutex
+	changed map[string]chan struct{} // by date directory name, closed on its next change.
+}
+
+// starts watching logDir, and the date directories of days in it, for late logs. Date
+// directories that do not exist yet are watched once created.
+func newLateWatcher(logDir string, days []TimeChunk, logger *log.Logger) (*lateWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err = watcher.Add(logDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	w := &lateWatcher{
+		watcher: watcher,
+		logDir:  logDir,
+		logger:  logger,
+		done:    make(chan struct{}),
+		changed: make(map[string]chan struct{}),
+	}
+	for _, day := range days {
+		w.watchDir(filepath.Join(logDir, day.Start.Format("2006-01-02")))
+	}
+	go w.watch()
+	return w, nil
+}
+
+// watches dir, and the directories in it, such as the per-worker directories of a cluster.
+// Does nothing if dir is not a directory.
+func (w *lateWatcher) watchDir(dir string) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	w.watcher.Add(dir)
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			w.watcher.Add(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// passes every change under the log directory on to the date directory it is in, until the
+// watcher is closed.
+func (w *lateWatcher) watch() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				w.watchDir(event.Name)
+			}
+			rel, err := filepath.Rel(w.logDir, event.Name)
+			if err != nil {
+				continue
+			}
+			w.notify(strings.SplitN(rel, string(filepath.Separator), 2)[0])
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Printf("ERROR: watching for late logs: %s\n", err)
+		}
+	}
+}
+
+// returns a channel closed on the next change in the date directory named date.
+func (w *lateWatcher) changes(date string) <-chan struct{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ch, ok := w.changed[date]
+	if !ok {
+		ch = make(chan struct{})
+		w.changed[date] = ch
+	}
+	return ch
+}
+
+// wakes whatever waits on changes to the date directory named date.
+func (w *lateWatcher) notify(date string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if ch, ok := w.changed[date]; ok {
+		close(ch)
+		delete(w.changed, date)
+	}
+}
+
+// starts the grace period, after which every day stops waiting for late logs.
+func (w *lateWatcher) start(grace time.Duration) {
+	time.AfterFunc(grace, func() { close(w.done) })
+}
+
+// stops watching.
+func (w *lateWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// queues every log of day that is not in handled as it arrives, until the grace period is
+// over, adding each to handled. A log is only queued once it has settled, except for those
+// found when the grace period is over, which are queued as they are.
+func (w *lateWatcher) watchDay(rc RuntimeConfig, day TimeChunk, handled map[string]bool, queue func(logFile string, curTime time.Time)) {
+	date := day.Start.Format("2006-01-02")
+	changed := w.changes(date)
+	pending := false
+	for {
+		var settle <-chan time.Time
+		if pending {
+			settle = time.After(lateSettle)
+		}
+		final := false
+		select {
+		case <-changed:
+		case <-settle:
+		case <-w.done:
+			final = true
+		}
+		// taken before looking, so a change while looking is looked at again.
+		changed = w.changes(date)
+
+		pending = false
+		for curTime := day.Start; !curTime.After(day.End); curTime = curTime.Add(time.Hour) {
+			if !includesHour(rc, curTime) {
+				continue
+			}
+			logFiles, err := hourLogs(w.logDir, "", rc.LogType, curTime, rc.Cluster, nil)
+			if err != nil {
+				continue
+			}
+			for _, logFile := range selectByFileTime(withoutSidecars(logFiles), rc) {
+				if handled[logFile] {
+					continue
+				}
+				if !final && !settled(logFile) {
+					pending = true
+					continue
+				}
+				handled[logFile] = true
+				queue(logFile, curTime)
+			}
+		}
+		if final {
+			return
+		}
+	}
+}
+
+// returns whether file has gone unmodified for lateSettle.
+func settled(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && time.Since(info.ModTime()) >= lateSettle
+}
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// file extensions of playbooks in a playbook library, in the order they are looked for.
+var playbookExtensions = []string{".yaml", ".yml"}
+
+// LibraryPlaybook is a playbook found in a playbook library directory.
+type LibraryPlaybook struct {
+	Name        string // path relative to the library without extension, such as dns/evil
+	Path        string // path of the playbook file
+	Description string // description set in the playbook itself, if any
+}
+
+// returns every playbook in the library directory dir, sorted by name. Hidden files and
+// directories, such as .git, are skipped.
+func ListPlaybooks(dir string) (playbooks []LibraryPlaybook, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if info.IsDir() || !isPlaybookExtension(ext) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		playbooks = append(playbooks, LibraryPlaybook{
+			Name:        filepath.ToSlash(strings.TrimSuffix(rel, ext)),
+			Path:        path,
+			Description: playbookDescription(path),
+		})
+		return nil
+	})
+	sort.Slice(playbooks, func(i, j int) bool { return playbooks[i].Name < playbooks[j].Name })
+	return playbooks, err
+}
+
+// returns the path of the playbook called name in the library directory dir. Names are
+// relative to the library, and may not leave it.
+func FindPlaybook(dir string, name string) (path string, err error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New(T("error.playbook.name", name))
+	}
+	for _, ext := range append([]string{""}, playbookExtensions...) {
+		path = filepath.Join(dir, clean+ext)
+		if info, e := os.Stat(path); e == nil && !info.IsDir() && isPlaybookExtension(filepath.Ext(path)) {
+			return path, nil
+		}
+	}
+	return "", errors.New(T("error.playbook.notfound", name, dir))
+}
+
+// returns the git commit the library directory dir is checked out at, followed by "-dirty" if
+// it has uncommitted changes. Returns "" if it is not a git checkout, or git is not installed.
+func LibraryRevision(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	revision := strings.TrimSpace(string(out))
+	if status, err := exec.Command("git", "-C", dir, "status", "--porcelain").Output(); err == nil && len(status) > 0 {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+func isPlaybookExtension(ext string) bool {
+	for _, playbookExt := range playbookExtensions {
+		if ext == playbookExt {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the description of the playbook at path, or "" if it has none or cannot be read.
+// Variables are not filled in, so a playbook that is not valid YAML until then has none.
+func playbookDescription(path string) string {
+	var playbook struct {
+		Description string `yaml:"description"`
+	}
+	configBuffer, err := ioutil.ReadFile(path)
+	if err != nil || yaml.Unmarshal(configBuffer, &playbook) != nil {
+		return ""
+	}
+	return playbook.Description
+}
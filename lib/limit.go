@@ -0,0 +1,154 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// returned by a record writer once its pull or day needs no more records.
+var errLimitReached = errors.New("record limit reached")
+
+// RecordLimit stops a pull early once enough records have been found: after max records
+// in total, and/or after the first record of each day. It is shared by every task of a pull,
+// and is safe for concurrent use.
+type RecordLimit struct {
+	max    int  // stop after this many records in total, 0 for no limit.
+	perDay bool // stop each day after its first record.
+
+	lock       sync.Mutex
+	count      int                           // records written so far.
+	ctx        context.Context               // cancelled once max records are written.
+	cancel     context.CancelFunc            // cancels ctx.
+	dayCtx     map[string]context.Context    // per day, cancelled once the day has a record.
+	dayCancels map[string]context.CancelFunc // cancels each of dayCtx.
+}
+
+// returns a limit for a single pull, from the max records and per-day settings of rc.
+func NewRecordLimit(rc RuntimeConfig) *RecordLimit {
+	l := &RecordLimit{
+		max:        rc.MaxRecords,
+		perDay:     rc.FirstMatchPerDay,
+		dayCtx:     make(map[string]context.Context),
+		dayCancels: make(map[string]context.CancelFunc),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	return l
+}
+
+// returns true once max records have been written, so nothing else needs to run.
+func (l *RecordLimit) Reached() bool {
+	return l.ctx.Err() != nil
+}
+
+// returns a context that is cancelled once no more records are wanted from the given day.
+// Tasks should be started with it, so they are stopped as soon as they are not needed.
+func (l *RecordLimit) Context(day time.Time) context.Context {
+	if !l.perDay {
+		return l.ctx
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	key := day.Format(TimeFormatDate)
+	if _, ok := l.dayCtx[key]; !ok {
+		l.dayCtx[key], l.dayCancels[key] = context.WithCancel(l.ctx)
+	}
+	return l.dayCtx[key]
+}
+
+// reserves room for one more record of the given day. Returns false if no more are wanted.
+func (l *RecordLimit) reserve(day time.Time) bool {
+	ctx := l.Context(day)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	l.count++
+	if l.max > 0 && l.count >= l.max {
+		l.cancel()
+	}
+	if l.perDay {
+		l.dayCancels[day.Format(TimeFormatDate)]()
+	}
+	return true
+}
+
+// returns a writer that passes whole records (lines) of the given day through to w while
+// the limit allows, and fails once no more are wanted. Headers of TSV logs are passed
+// through without being counted. Close must be called to write a
+// final record without a trailing newline.
+func (l *RecordLimit) Writer(w io.Writer, day time.Time) io.WriteCloser {
+	if l.max == 0 && !l.perDay {
+		return nopWriteCloser{w}
+	}
+	return &recordWriter{limit: l, day: day, w: w}
+}
+
+// passes everything through when there is no limit, without counting records.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type recordWriter struct {
+	limit   *RecordLimit
+	day     time.Time
+	w       io.Writer
+	pending []byte // start of a record whose newline has not been written yet
+	done    bool
+}
+
+func (rw *recordWriter) Write(p []byte) (n int, err error) {
+	if rw.done {
+		return 0, errLimitReached
+	}
+	rw.pending = append(rw.pending, p...)
+	for {
+		end := bytes.IndexByte(rw.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if err = rw.writeRecord(rw.pending[:end+1]); err != nil {
+			return 0, err
+		}
+		rw.pending = rw.pending[end+1:]
+	}
+}
+
+func (rw *recordWriter) Close() error {
+	if rw.done || len(rw.pending) == 0 {
+		return nil
+	}
+	err := rw.writeRecord(rw.pending)
+	rw.pending = nil
+	if err == errLimitReached {
+		return nil
+	}
+	return err
+}
+
+// writes a line of the output, counting it against the limit unless it is a header of a TSV
+// log, such as #fields, which is passed through while records are still wanted.
+func (rw *recordWriter) writeRecord(record []byte) error {
+	if len(record) > 0 && record[0] == '#' {
+		if rw.limit.Context(rw.day).Err() != nil {
+			rw.done = true
+			return errLimitReached
+		}
+		_, err := rw.w.Write(record)
+		return err
+	}
+	if !rw.limit.reserve(rw.day) {
+		rw.done = true
+		return errLimitReached
+	}
+	_, err := rw.w.Write(record)
+	return err
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// types of the OpenLineage events posted for a pull: when it starts, and once it is done or
+// has failed.
+const (
+	LineageStart    = "START"
+	LineageComplete = "COMPLETE"
+	LineageFail     = "FAIL"
+)
+
+// DefaultLineageNamespace is the namespace of the jobs of lineage events, unless the config
+// file sets lineage_namespace.
+const DefaultLineageNamespace = "nagini"
+
+// producer and schemas of the lineage events, as the OpenLineage spec asks every event and
+// custom facet to name.
+const (
+	lineageProducer      = "https://github.com/OSU-SOC/nagini"
+	lineageSchemaURL     = "https://openlineage.io/spec/1-0-5/OpenLineage.json#/definitions/RunEvent"
+	lineageFacetURL      = "https://github.com/OSU-SOC/nagini/blob/main/lib/lineage.go"
+	lineageErrorFacetURL = "https://openlineage.io/spec/facets/1-0-0/ErrorMessageRunFacet.json"
+)
+
+// LineageEvent is an OpenLineage run event, posted to a lineage endpoint such as Marquez so
+// data governance can track which raw logs fed which output directories.
+type LineageEvent struct {
+	EventType string           `json:"eventType"` // LineageStart, LineageComplete or LineageFail
+	EventTime time.Time        `json:"eventTime"`
+	Run       LineageRun       `json:"run"`
+	Job       LineageJob       `json:"job"`
+	Inputs    []LineageDataset `json:"inputs"`  // the log type pulled, in the zeek log directory
+	Outputs   []LineageDataset `json:"outputs"` // the output directory, unless written to stdout
+	Producer  string           `json:"producer"`
+	SchemaURL string           `json:"schemaURL"`
+}
+
+// LineageRun is the run of a lineage event: a pull, with what it was run through.
+type LineageRun struct {
+	RunID  string                 `json:"runId"`
+	Facets map[string]interface{} `json:"facets,omitempty"`
+}
+
+// LineageJob is the job of a lineage event, such as run.conn or a play of a playbook.
+type LineageJob struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// LineageDataset is an input or output of a lineage event, named by the directory it is in
+// within the namespace of the host holding it.
+type LineageDataset struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// the nagini facet of the run of a lineage event, with the time range pulled and the filter.
+type lineagePullFacet struct {
+	Producer  string    `json:"_producer"`
+	SchemaURL string    `json:"_schemaURL"`
+	Version   string    `json:"nagini_version"`
+	LogType   string    `json:"log_type"`
+	Filter    string    `json:"filter"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// the facet of the run of a failed pull, with what it failed with.
+type lineageErrorFacet struct {
+	Producer  string `json:"_producer"`
+	SchemaURL string `json:"_schemaURL"`
+	Message   string `json:"message"`
+	Language  string `json:"programmingLanguage"`
+}
+
+// returns a new run id for the lineage events of a pull, a random UUID as OpenLineage asks.
+func NewLineageRunID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// returns the lineage event of eventType of the pull of rc through filter, run as job in
+// namespace with runID. rc is the pull as it was given, with its log directory before any
+// remote logs were fetched. A LineageFail event holds failure.
+func NewLineageEvent(eventType string, runID string, namespace string, job string, rc RuntimeConfig, filter string, failure error) LineageEvent {
+	event := LineageEvent{
+		EventType: eventType,
+		EventTime: time.Now().UTC(),
+		Run:       LineageRun{RunID: runID, Facets: make(map[string]interface{})},
+		Job:       LineageJob{Namespace: namespace, Name: job},
+		Inputs:    []LineageDataset{lineageDataset(rc.LogDir, rc.LogType)},
+		Outputs:   []LineageDataset{},
+		Producer:  lineageProducer,
+		SchemaURL: lineageSchemaURL,
+	}
+	event.Run.Facets["nagini"] = lineagePullFacet{
+		Producer:  lineageProducer,
+		SchemaURL: lineageFacetURL,
+		Version:   Version(),
+		LogType:   rc.LogType,
+		Filter:    filter,
+		Start:     rc.StartTime,
+		End:       rc.EndTime,
+	}
+	if failure != nil {
+		event.Run.Facets["errorMessage"] = lineageErrorFacet{
+			Producer:  lineageProducer,
+			SchemaURL: lineageErrorFacetURL,
+			Message:   failure.Error(),
+			Language:  "go",
+		}
+	}
+	if !rc.WriteStdout {
+		event.Outputs = append(event.Outputs, lineageDataset(rc.OutDir, ""))
+	}
+	return event
+}
+
+// returns the dataset of the directory name, within dir if set. Local directories are named
+// within the namespace of this host, and remote ones within that of their scheme and host,
+// without the user they are logged in to as.
+func lineageDataset(dir string, name string) LineageDataset {
+	if IsRemoteLogDir(dir) {
+		if u, err := url.Parse(dir); err == nil {
+			return LineageDataset{Namespace: u.Scheme + "://" + u.Host, Name: pathJoin(u.Path, name)}
+		}
+	}
+	host, _ := os.Hostname()
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return LineageDataset{Namespace: "file://" + host, Name: pathJoin(filepath.ToSlash(dir), name)}
+}
+
+// joins name to dir with a slash, if name is set.
+func pathJoin(dir string, name string) string {
+	if name == "" {
+		return dir
+	}
+	return dir + "/" + name
+}
+
+// posts the lineage event to the OpenLineage endpoint at url, such as the
+// /api/v1/lineage of Marquez. If token is set, it is sent as a bearer token.
+func PostLineageEvent(url string, token string, event LineageEvent) error {
+	return postJSON(url, token, event)
+}
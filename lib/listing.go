@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DirListing remembers the entries of each directory it lists, so pulls of several log types
+// over the same time range list each date directory once between them, rather than once per
+// hour of each log type. Logs written after a directory is listed are not seen, so it is only
+// shared by pulls of logs that are done being written. Safe for concurrent use.
+type DirListing struct {
+	lock sync.Mutex
+	dirs map[string][]string
+}
+
+// returns an empty listing.
+func NewDirListing() *DirListing {
+	return &DirListing{dirs: make(map[string][]string)}
+}
+
+// returns the paths matching pattern, as filepath.Glob does, from the entries of the
+// directories it names as they were when first listed.
+func (l *DirListing) Glob(pattern string) (matches []string, err error) {
+	if _, err = filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	dir, file := filepath.Split(pattern)
+	dir = filepath.Clean(dir)
+	dirs := []string{dir}
+	if strings.ContainsAny(dir, `*?[\`) {
+		if dirs, err = l.Glob(dir); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range dirs {
+		for _, name := range l.entries(dir) {
+			if ok, _ := filepath.Match(file, name); ok {
+				matches = append(matches, filepath.Join(dir, name))
+			}
+		}
+	}
+	return matches, nil
+}
+
+// returns the names of the entries of dir, sorted, listing it if it was not yet. A directory
+// that cannot be listed has no entries.
+func (l *DirListing) entries(dir string) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if names, ok := l.dirs[dir]; ok {
+		return names
+	}
+	var names []string
+	if f, err := os.Open(dir); err == nil {
+		names, _ = f.Readdirnames(-1)
+		f.Close()
+	}
+	sort.Strings(names)
+	l.dirs[dir] = names
+	return names
+}
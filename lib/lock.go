@@ -0,0 +1,33 @@
+package lib
+
+import "os"
+
+// DirLock is an advisory lock on a directory, held by a run writing into it until Unlock is
+// called, or the process exits, so the lock of a run that was killed is not left behind.
+type DirLock struct {
+	f *os.File
+}
+
+// LockDir takes the lock of dir, an existing directory, so two runs pointed at it, such as two
+// pulls given the same output directory, or two backfills sharing a checkpoint, cannot corrupt
+// each other's files. Rather than waiting, fails at once with an error matching
+// ErrOutputLocked if another run holds it.
+func LockDir(dir string) (lock *DirLock, err error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		if err == errLocked {
+			return nil, &messageError{T("error.locked", dir), ErrOutputLocked}
+		}
+		return nil, err
+	}
+	return &DirLock{f}, nil
+}
+
+// releases the lock, so another run can write into the directory.
+func (l *DirLock) Unlock() error {
+	return l.f.Close()
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package lib
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// returned by lockFile if another process holds the lock.
+var errLocked = errors.New("locked")
+
+// takes an exclusive flock of f, without waiting. The lock is released once f is closed.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errLocked
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// returns whether logType is a pattern of log types rather than a log type: a glob such as
+// conn*, or a regular expression between slashes such as /^(conn|dns)$/.
+func IsLogTypePattern(logType string) bool {
+	return strings.ContainsAny(logType, `*?[`) || isLogTypeRegexp(logType)
+}
+
+// returns whether pattern is a regular expression between slashes.
+func isLogTypeRegexp(pattern string) bool {
+	return len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// returns the log types matching pattern, see IsLogTypePattern, that have logs in the date
+// directories of the time range of rc, sorted. Logs of cluster workers count if rc.Cluster
+// is set, and the logs of the current directory if rc.Current is set. Returns an error if
+// the pattern is malformed, or matches no log type.
+func MatchLogTypes(rc RuntimeConfig, pattern string) (logTypes []string, err error) {
+	match, err := logTypeMatcher(pattern)
+	if err != nil {
+		return nil, err
+	}
+	// logs of the workers of a cluster may be in a directory of their own.
+	found := make(map[string]bool)
+	var add func(dir string, cluster bool)
+	add = func(dir string, cluster bool) {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				if cluster {
+					add(filepath.Join(dir, entry.Name()), false)
+				}
+				continue
+			}
+			if match := logTypeName.FindStringSubmatch(entry.Name()); match != nil {
+				found[match[1]] = true
+			}
+		}
+	}
+	for curDate := rc.StartTime.Truncate(24 * time.Hour); !curDate.After(rc.EndTime); curDate = curDate.AddDate(0, 0, 1) {
+		add(filepath.Join(rc.LogDir, curDate.Format(TimeFormatDay)), rc.Cluster)
+	}
+	if rc.Current {
+		entries, _ := os.ReadDir(filepath.Join(rc.LogDir, CurrentDir))
+		for _, entry := range entries {
+			if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".log") {
+				found[strings.TrimSuffix(name, ".log")] = true
+			}
+		}
+	}
+
+	for logType := range found {
+		if match(logType) {
+			logTypes = append(logTypes, logType)
+		}
+	}
+	if len(logTypes) == 0 {
+		return nil, &messageError{T("error.logtype.nomatch", pattern, rc.LogDir, rc.StartTime.Format(TimeFormatDate), rc.EndTime.Format(TimeFormatDate)), ErrNoMatches}
+	}
+	sort.Strings(logTypes)
+	return logTypes, nil
+}
+
+// returns a function telling whether a log type matches pattern.
+func logTypeMatcher(pattern string) (func(string) bool, error) {
+	if isLogTypeRegexp(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, errors.New(T("error.logtype.pattern", pattern, err))
+		}
+		return re.MatchString, nil
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, errors.New(T("error.logtype.pattern", pattern, err))
+	}
+	return func(logType string) bool {
+		ok, _ := filepath.Match(pattern, logType)
+		return ok
+	}, nil
+}
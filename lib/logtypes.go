@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"strings"
+)
+
+// LogTypes holds the fields of each known log type, so references to fields can be checked
+// before a pull rather than silently matching nothing.
+type LogTypes map[string][]string
+
+// the id fields shared by most zeek logs.
+var zeekIDFields = []string{"id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p"}
+
+// returns the fields of a log that has a uid and id, followed by the given fields.
+func connFields(fields ...string) []string {
+	return append(append([]string{"ts", "uid"}, zeekIDFields...), fields...)
+}
+
+// fields of the standard zeek log types. Fields that were renamed or removed in some version
+// of zeek are kept, since an archive holds logs of many versions.
+var standardLogTypes = LogTypes{
+	"conn": connFields("proto", "service", "duration", "orig_bytes", "resp_bytes", "conn_state", "local_orig", "local_resp",
+		"missed_bytes", "history", "orig_pkts", "orig_ip_bytes", "resp_pkts", "resp_ip_bytes", "tunnel_parents", "orig_l2_addr",
+		"resp_l2_addr", "vlan", "inner_vlan", "community_id"),
+	"dce_rpc": connFields("rtt", "named_pipe", "endpoint", "operation"),
+	"dhcp": {"ts", "uids", "client_addr", "server_addr", "mac", "host_name", "client_fqdn", "domain", "requested_addr",
+		"assigned_addr", "lease_time", "client_message", "server_message", "msg_types", "duration"},
+	"dns": connFields("proto", "trans_id", "rtt", "query", "qclass", "qclass_name", "qtype", "qtype_name", "rcode",
+		"rcode_name", "AA", "TC", "RD", "RA", "Z", "answers", "TTLs", "rejected"),
+	"files": connFields("fuid", "tx_hosts", "rx_hosts", "conn_uids", "source", "depth", "analyzers", "mime_type",
+		"filename", "duration", "local_orig", "is_orig", "seen_bytes", "total_bytes", "missing_bytes", "overflow_bytes",
+		"timedout", "parent_fuid", "md5", "sha1", "sha256", "extracted", "extracted_cutoff", "extracted_size"),
+	"ftp": connFields("user", "password", "command", "arg", "mime_type", "file_size", "reply_code", "reply_msg",
+		"data_channel.passive", "data_channel.orig_h", "data_channel.resp_h", "data_channel.resp_p", "fuid"),
+	"http": connFields("trans_depth", "method", "host", "uri", "referrer", "version", "user_agent", "origin",
+		"request_body_len", "response_body_len", "status_code", "status_msg", "info_code", "info_msg", "tags", "username",
+		"password", "proxied", "orig_fuids", "orig_filenames", "orig_mime_types", "resp_fuids", "resp_filenames",
+		"resp_mime_types"),
+	"kerberos": connFields("request_type", "client", "service", "success", "error_msg", "from", "till", "cipher",
+		"forwardable", "renewable", "client_cert_subject", "client_cert_fuid", "server_cert_subject", "server_cert_fuid"),
+	"notice": connFields("fuid", "file_mime_type", "file_desc", "proto", "note", "msg", "sub", "src", "dst", "p", "n",
+		"peer_descr", "actions", "email_dest", "suppress_for", "remote_location.country_code", "remote_location.region",
+		"remote_location.city", "remote_location.latitude", "remote_location.longitude"),
+	"ntlm": connFields("username", "hostname", "domainname", "server_nb_computer_name", "server_dns_computer_name",
+		"server_tree_name", "success"),
+	"rdp": connFields("cookie", "result", "security_protocol", "client_channels", "keyboard_layout", "client_build",
+		"client_name", "client_dig_product_id", "desktop_width", "desktop_height", "requested_color_depth", "cert_type",
+		"cert_count", "cert_permanent", "encryption_level", "encryption_method"),
+	"sip": connFields("trans_depth", "method", "uri", "date", "request_from", "request_to", "response_from",
+		"response_to", "reply_to", "call_id", "seq", "subject", "request_path", "response_path", "user_agent",
+		"status_code", "status_msg", "warning", "request_body_len", "response_body_len", "content_type"),
+	"smb_files": connFields("fuid", "action", "path", "name", "size", "prev_name", "times.modified", "times.accessed",
+		"times.created", "times.changed"),
+	"smb_mapping": connFields("path", "service", "native_file_system", "share_type"),
+	"smtp": connFields("trans_depth", "helo", "mailfrom", "rcptto", "date", "from", "to", "cc", "reply_to", "msg_id",
+		"in_reply_to", "subject", "x_originating_ip", "first_received", "second_received", "last_reply", "path",
+		"user_agent", "tls", "fuids", "is_webmail"),
+	"snmp": connFields("duration", "version", "community", "get_requests", "get_bulk_requests", "get_responses",
+		"set_requests", "display_string", "up_since"),
+	"software": {"ts", "host", "host_p", "software_type", "name", "version.major", "version.minor", "version.minor2",
+		"version.minor3", "version.addl", "unparsed_version"},
+	"ssh": connFields("version", "auth_success", "auth_attempts", "direction", "client", "server", "cipher_alg",
+		"mac_alg", "compression_alg", "kex_alg", "host_key_alg", "host_key", "remote_location.country_code",
+		"remote_location.region", "remote_location.city", "remote_location.latitude", "remote_location.longitude"),
+	"ssl": connFields("version", "cipher", "curve", "server_name", "resumed", "last_alert", "next_protocol",
+		"established", "ssl_history", "cert_chain_fps", "client_cert_chain_fps", "cert_chain_fuids",
+		"client_cert_chain_fuids", "subject", "issuer", "client_subject", "client_issuer", "sni_matches_cert",
+		"validation_status"),
+	"tunnel": connFields("tunnel_type", "action"),
+	"weird":  connFields("name", "addl", "notice", "peer", "source"),
+	"x509": {"ts", "id", "fingerprint", "certificate.version", "certificate.serial", "certificate.subject",
+		"certificate.issuer", "certificate.not_valid_before", "certificate.not_valid_after", "certificate.key_alg",
+		"certificate.sig_alg", "certificate.key_type", "certificate.key_length", "certificate.exponent",
+		"certificate.curve", "san.dns", "san.uri", "san.email", "san.ip", "basic_constraints.ca",
+		"basic_constraints.path_len", "host_cert", "client_cert"},
+}
+
+// KnownLogTypes returns the standard zeek log types, with the fields of each log type in
+// overrides replacing those of the standard one, or adding a log type of its own. Set in the
+// global config as log_types, for sites with scripts that add fields or log types.
+func KnownLogTypes(overrides map[string][]string) LogTypes {
+	known := make(LogTypes)
+	for logType, fields := range standardLogTypes {
+		known[logType] = fields
+	}
+	for logType, fields := range overrides {
+		known[logType] = fields
+	}
+	return known
+}
+
+// returns whether logType has field, also accepting a field like id.orig_h written as
+// id_orig_h. A log type that is not known has every field.
+func (known LogTypes) HasField(logType string, field string) bool {
+	fields, ok := known[logType]
+	if !ok {
+		return true
+	}
+	for _, candidate := range fields {
+		if candidate == field || strings.ReplaceAll(candidate, ".", "_") == field {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the field of logType closest to the given unknown one, if any is close enough to be
+// a likely typo of it.
+func (known LogTypes) closestField(logType string, field string) (closest string) {
+	best := 3 // at most two edits away.
+	for _, candidate := range known[logType] {
+		if distance := editDistance(strings.ToLower(strings.ReplaceAll(field, ".", "_")), strings.ToLower(strings.ReplaceAll(candidate, ".", "_"))); distance < best {
+			best, closest = distance, candidate
+		}
+	}
+	return closest
+}
+
+// returns the number of single character insertions, deletions and substitutions that turn a
+// into b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest written into the output directory of a pull with
+// RuntimeConfig.Manifest set.
+const ManifestFile = "manifest.jsonl"
+
+// PartialSuffix is added to the hidden name an output file is written under until it is
+// complete, so it does not match the globs of a shipper reading the output directory.
+const PartialSuffix = ".partial"
+
+// ManifestEntry is an output file that is complete, recorded in the manifest as a JSON object
+// per line only once the file has been renamed into place, so a shipper, such as Filebeat or
+// Vector, that reads the files listed never reads one half written or reads one twice.
+type ManifestEntry struct {
+	Path      string    `json:"path"`           // absolute path of the output file
+	LogType   string    `json:"log_type"`       // log type the output was pulled from
+	Date      string    `json:"date,omitempty"` // date of the output, if it has one per date
+	Size      int64     `json:"size"`           // size of the output file
+	Completed time.Time `json:"completed"`      // when the output file was renamed into place
+}
+
+// guards appending to manifests, as the output of every date is recorded from its own goroutine.
+var manifestLock sync.Mutex
+
+// returns the hidden name outputFile is written under until it is complete.
+func PartialName(outputFile string) string {
+	return filepath.Join(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+PartialSuffix)
+}
+
+// appends entry to the manifest at path, unless its output file is already listed, such as
+// when a concatenation is resumed after being recorded.
+func recordManifest(path string, entry ManifestEntry) error {
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+	entries, err := ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	for _, listed := range entries {
+		if listed.Path == entry.Path {
+			return nil
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoded, _ := json.Marshal(entry)
+	if _, err = f.Write(append(encoded, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// records the complete output file at entry.Path in the manifest at path, with its size and
+// completion time.
+func recordOutput(path string, entry ManifestEntry) error {
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		return err
+	}
+	entry.Size = info.Size()
+	entry.Completed = info.ModTime()
+	return recordManifest(path, entry)
+}
+
+// reads the output files listed in the manifest at path, in the order they were completed. A
+// missing manifest lists none.
+func ReadManifest(path string) (entries []ManifestEntry, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// concatenates inputFiles like ConcatFiles, but under the partial name of outputFile, which
+// is renamed into place once complete. If manifest is set, the output is then recorded in
+// the manifest at that path as entry, with its path, size and completion time filled in.
+func ConcatFilesAtomic(logger *log.Logger, inputFiles []string, outputFile string, manifest string, entry ManifestEntry, deleteInputAfterRead bool, ignoreMissing bool) (e error) {
+	final, e := filepath.Abs(outputFile)
+	if e != nil {
+		return e
+	}
+	entry.Path = final
+	journal := &concatJournal{
+		Output:        PartialName(final),
+		Final:         final,
+		Manifest:      manifest,
+		Entry:         &entry,
+		Inputs:        inputFiles,
+		DeleteInputs:  deleteInputAfterRead,
+		IgnoreMissing: ignoreMissing,
+	}
+	return journal.start(logger)
+}
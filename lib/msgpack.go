@@ -0,0 +1,306 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// formats output records can be written in.
+const (
+	OutputJSON    = "json"
+	OutputMsgpack = "msgpack"
+	OutputParquet = "parquet" // records of each date converted to Parquet once done, see WriteParquet
+)
+
+// returns the formats output records can be written in.
+func OutputFormats() []string {
+	return []string{OutputJSON, OutputMsgpack, OutputParquet}
+}
+
+// returns the file extension of output written in format.
+func outputExtension(format string) string {
+	if format == OutputMsgpack {
+		return ".msgpack"
+	}
+	return ".json"
+}
+
+// returns a writer that encodes the records (lines) written to it in format before passing
+// them to w. Close must be called once done.
+func NewOutputWriter(w io.Writer, format string) io.WriteCloser {
+	if format == OutputMsgpack {
+		return NewMsgpackWriter(w)
+	}
+	return nopWriteCloser{w}
+}
+
+// returns a writer that converts every record (line) written to it to a MessagePack map
+// before passing it to w, so the output is a stream of maps that can be decoded one after
+// another. JSON records keep their fields, and zeek TSV records are mapped with the fields
+// of the #fields header before them. Other lines are written as strings, and headers are
+// dropped. Close must be called to write a final record without a trailing newline.
+func NewMsgpackWriter(w io.Writer) io.WriteCloser {
+	return &msgpackWriter{w: w}
+}
+
+type msgpackWriter struct {
+	w       io.Writer
+	fields  []string // fields of the last #fields header, for TSV records
+	pending []byte   // start of a record whose newline has not been written yet
+	buf     []byte
+}
+
+func (mw *msgpackWriter) Write(p []byte) (n int, err error) {
+	mw.pending = append(mw.pending, p...)
+	for {
+		end := bytes.IndexByte(mw.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if err = mw.writeRecord(mw.pending[:end]); err != nil {
+			return 0, err
+		}
+		mw.pending = mw.pending[end+1:]
+	}
+}
+
+func (mw *msgpackWriter) Close() error {
+	if len(mw.pending) == 0 {
+		return nil
+	}
+	err := mw.writeRecord(mw.pending)
+	mw.pending = nil
+	return err
+}
+
+func (mw *msgpackWriter) writeRecord(line []byte) error {
+	record := strings.TrimRight(string(line), "\r")
+	var value interface{}
+	switch {
+	case strings.TrimSpace(record) == "":
+		return nil
+	case strings.HasPrefix(record, "#fields\t"):
+		mw.fields = strings.Split(record, "\t")[1:]
+		return nil
+	case strings.HasPrefix(record, "#"):
+		return nil
+	case strings.HasPrefix(record, "{"):
+		decoder := json.NewDecoder(strings.NewReader(record))
+		decoder.UseNumber()
+		if decoder.Decode(&value) != nil {
+			value = record
+		}
+	default:
+		values := strings.Split(record, "\t")
+		if len(values) != len(mw.fields) {
+			value = record
+			break
+		}
+		fields := make(map[string]interface{}, len(values))
+		for i, field := range mw.fields {
+			fields[field] = values[i]
+		}
+		value = fields
+	}
+	mw.buf = appendMsgpack(mw.buf[:0], value)
+	_, err := mw.w.Write(mw.buf)
+	return err
+}
+
+// appends the MessagePack encoding of v, a value decoded from JSON, to buf. Map keys are
+// sorted, so the same record is always encoded the same way.
+func appendMsgpack(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if v {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(buf, i)
+		}
+		f, _ := v.Float64()
+		return appendMsgpackFloat(buf, f)
+	case float64:
+		return appendMsgpackFloat(buf, v)
+	case int64:
+		return appendMsgpackInt(buf, v)
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			buf = append(buf, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			buf = append(buf, 0xda)
+			buf = appendUint16(buf, uint16(n))
+		default:
+			buf = append(buf, 0xdb)
+			buf = appendUint32(buf, uint32(n))
+		}
+		return append(buf, v...)
+	case []interface{}:
+		buf = appendMsgpackLength(buf, len(v), 0x90, 0xdc, 0xdd)
+		for _, item := range v {
+			buf = appendMsgpack(buf, item)
+		}
+		return buf
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf = appendMsgpackLength(buf, len(v), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			buf = appendMsgpack(buf, key)
+			buf = appendMsgpack(buf, v[key])
+		}
+		return buf
+	default:
+		return appendMsgpack(buf, fmt.Sprint(v))
+	}
+}
+
+// appends the header of an array or map of n items: fixed if it fits, else 16 or 32 bit.
+func appendMsgpackLength(buf []byte, n int, fixed byte, prefix16 byte, prefix32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fixed|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(buf, prefix16), uint16(n))
+	default:
+		return appendUint32(append(buf, prefix32), uint32(n))
+	}
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(i))
+	default:
+		return appendUint64(append(buf, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackFloat(buf []byte, f float64) []byte {
+	return appendUint64(append(buf, 0xcb), math.Float64bits(f))
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
+// returned when MessagePack data ends in the middle of a value.
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+// decodes the first MessagePack value in data, as written by NewMsgpackWriter, returning it
+// and the data after it. Integers are decoded as int64, floats as float64 and maps as
+// map[string]interface{}.
+func DecodeMsgpack(data []byte) (v interface{}, rest []byte, err error) {
+	if len(data) == 0 {
+		return nil, data, errMsgpackShort
+	}
+	b, data := data[0], data[1:]
+	switch {
+	case b <= 0x7f:
+		return int64(b), data, nil
+	case b >= 0xe0:
+		return int64(int8(b)), data, nil
+	case b&0xe0 == 0xa0:
+		return decodeMsgpackString(data, int(b&0x1f))
+	case b&0xf0 == 0x90:
+		return decodeMsgpackArray(data, int(b&0x0f))
+	case b&0xf0 == 0x80:
+		return decodeMsgpackMap(data, int(b&0x0f))
+	}
+
+	// everything else has a fixed size header after its first byte.
+	need := map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4, 0xdc: 2, 0xdd: 4, 0xde: 2, 0xdf: 4, 0xd3: 8, 0xcb: 8}[b]
+	if len(data) < need {
+		return nil, data, errMsgpackShort
+	}
+	switch b {
+	case 0xc0:
+		return nil, data, nil
+	case 0xc2:
+		return false, data, nil
+	case 0xc3:
+		return true, data, nil
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(data)), data[8:], nil
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	case 0xd9:
+		return decodeMsgpackString(data[1:], int(data[0]))
+	case 0xda:
+		return decodeMsgpackString(data[2:], int(binary.BigEndian.Uint16(data)))
+	case 0xdb:
+		return decodeMsgpackString(data[4:], int(binary.BigEndian.Uint32(data)))
+	case 0xdc:
+		return decodeMsgpackArray(data[2:], int(binary.BigEndian.Uint16(data)))
+	case 0xdd:
+		return decodeMsgpackArray(data[4:], int(binary.BigEndian.Uint32(data)))
+	case 0xde:
+		return decodeMsgpackMap(data[2:], int(binary.BigEndian.Uint16(data)))
+	case 0xdf:
+		return decodeMsgpackMap(data[4:], int(binary.BigEndian.Uint32(data)))
+	}
+	return nil, data, fmt.Errorf("msgpack: unsupported type 0x%02x", b)
+}
+
+func decodeMsgpackString(data []byte, n int) (interface{}, []byte, error) {
+	if len(data) < n {
+		return nil, data, errMsgpackShort
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+func decodeMsgpackArray(data []byte, n int) (interface{}, []byte, error) {
+	items := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		item, rest, err := DecodeMsgpack(data)
+		if err != nil {
+			return nil, data, err
+		}
+		items, data = append(items, item), rest
+	}
+	return items, data, nil
+}
+
+func decodeMsgpackMap(data []byte, n int) (interface{}, []byte, error) {
+	fields := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, rest, err := DecodeMsgpack(data)
+		if err != nil {
+			return nil, data, err
+		}
+		value, rest, err := DecodeMsgpack(rest)
+		if err != nil {
+			return nil, data, err
+		}
+		fields[fmt.Sprint(key)], data = value, rest
+	}
+	return fields, data, nil
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// name of the field that records of a pull related to notices or intel hits are annotated with.
+const RelatedNoticesField = "related_notices"
+
+// RelatedNotice is a record of a notice or intel log, as it is annotated onto the records of a
+// pull that share its uid or, for intel, its indicator.
+type RelatedNotice struct {
+	Log           string      `json:"log"` // notice or intel
+	TS            interface{} `json:"ts,omitempty"`
+	Note          string      `json:"note,omitempty"`
+	Msg           string      `json:"msg,omitempty"`
+	Indicator     string      `json:"indicator,omitempty"`
+	IndicatorType string      `json:"indicator_type,omitempty"`
+}
+
+// NoticeIndex holds the notices and intel hits of a time range, by the uid of their connection
+// and, for intel hits, by the indicator seen, such as an address or domain.
+type NoticeIndex struct {
+	Notices     int
+	byUID       map[string][]*RelatedNotice
+	byIndicator map[string][]*RelatedNotice
+}
+
+// LoadNotices reads the notice and intel logs of the time range of rc, whichever it has, into
+// an index to annotate the records of a pull with. Corrupt logs are recorded in rc.Report, if
+// set, and skipped.
+func LoadNotices(rc RuntimeConfig) (index *NoticeIndex, err error) {
+	index = &NoticeIndex{byUID: make(map[string][]*RelatedNotice), byIndicator: make(map[string][]*RelatedNotice)}
+	for _, logType := range []string{"notice", "intel"} {
+		rc.LogType = logType
+		logFiles, err := PullLogs(rc)
+		if err != nil {
+			return nil, err
+		}
+		for _, logFile := range logFiles {
+			records, err := logRecords(logFile, rc.Report)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				index.add(logType, record)
+			}
+		}
+	}
+	return index, nil
+}
+
+// adds a record of a notice or intel log to the index.
+func (index *NoticeIndex) add(logType string, record map[string]interface{}) {
+	text := func(field string) string {
+		value, _ := record[field].(string)
+		return value
+	}
+	notice := &RelatedNotice{Log: logType, TS: record["ts"], Note: text("note"), Msg: text("msg")}
+	if logType == "intel" {
+		notice.Indicator, notice.IndicatorType = text("seen.indicator"), text("seen.indicator_type")
+		if seen, ok := record["seen"].(map[string]interface{}); ok {
+			// nested JSON, as written with LogAscii::use_json and json_encoding of nested records.
+			notice.Indicator, _ = seen["indicator"].(string)
+			notice.IndicatorType, _ = seen["indicator_type"].(string)
+		}
+	}
+	index.Notices++
+	if uid := text("uid"); uid != "" {
+		index.byUID[uid] = append(index.byUID[uid], notice)
+	}
+	if notice.Indicator != "" {
+		index.byIndicator[notice.Indicator] = append(index.byIndicator[notice.Indicator], notice)
+	}
+}
+
+// returns the notices and intel hits related to a record: those of its uid, and those whose
+// indicator is the value of any of its fields, each once.
+func (index *NoticeIndex) related(record map[string]interface{}) (related []*RelatedNotice) {
+	seen := make(map[*RelatedNotice]bool)
+	add := func(notices []*RelatedNotice) {
+		for _, notice := range notices {
+			if !seen[notice] {
+				seen[notice] = true
+				related = append(related, notice)
+			}
+		}
+	}
+	if uid, ok := record["uid"].(string); ok {
+		add(index.byUID[uid])
+	}
+	if len(index.byIndicator) == 0 {
+		return related
+	}
+	for _, value := range record {
+		switch v := value.(type) {
+		case string:
+			add(index.byIndicator[v])
+		case []interface{}:
+			for _, element := range v {
+				if s, ok := element.(string); ok {
+					add(index.byIndicator[s])
+				}
+			}
+		}
+	}
+	return related
+}
+
+// returns a writer that adds a related_notices field to every record (line) written to it
+// before passing it to w, listing the notices and intel hits of index related to it. JSON
+// records get it as a key, only if they have any, and zeek TSV records as an extra column,
+// named in the #fields header, unset if they have none. Close must be called to write a final
+// record without a trailing newline.
+func NewNoticeWriter(w io.Writer, index *NoticeIndex) io.WriteCloser {
+	if index == nil {
+		return nopWriteCloser{w}
+	}
+	return &noticeWriter{w: w, index: index}
+}
+
+type noticeWriter struct {
+	w       io.Writer
+	index   *NoticeIndex
+	fields  []string // fields of the last #fields header, for TSV records
+	pending []byte   // start of a record whose newline has not been written yet
+}
+
+func (nw *noticeWriter) Write(p []byte) (n int, err error) {
+	nw.pending = append(nw.pending, p...)
+	for {
+		end := bytes.IndexByte(nw.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if _, err = io.WriteString(nw.w, nw.annotate(string(nw.pending[:end]))+"\n"); err != nil {
+			return 0, err
+		}
+		nw.pending = nw.pending[end+1:]
+	}
+}
+
+func (nw *noticeWriter) Close() error {
+	if len(nw.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(nw.w, nw.annotate(string(nw.pending)))
+	nw.pending = nil
+	return err
+}
+
+// returns the record with its related notices added.
+func (nw *noticeWriter) annotate(record string) string {
+	record = strings.TrimSuffix(record, "\r")
+	trimmed := strings.TrimSpace(record)
+	switch {
+	case trimmed == "":
+		return record
+	case strings.HasPrefix(record, "#fields\t"):
+		nw.fields = strings.Split(record, "\t")[1:]
+		return record + "\t" + RelatedNoticesField
+	case strings.HasPrefix(record, "#types\t"):
+		return record + "\tstring"
+	case strings.HasPrefix(record, "#"):
+		return record
+	case strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}"):
+		decoded, _ := decodeRecord([]byte(trimmed), &nw.fields)
+		fields, ok := decoded.(map[string]interface{})
+		if !ok {
+			return record
+		}
+		related := nw.index.related(fields)
+		if len(related) == 0 {
+			return record
+		}
+		body := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+		annotation := `"` + RelatedNoticesField + `":` + encodeNotices(related)
+		if body == "" {
+			return "{" + annotation + "}"
+		}
+		return "{" + body + "," + annotation + "}"
+	}
+	values := strings.Split(record, "\t")
+	if len(values) != len(nw.fields) {
+		return record
+	}
+	fields := make(map[string]interface{}, len(values))
+	for i, field := range nw.fields {
+		if values[i] != unsetField {
+			fields[field] = values[i]
+		}
+	}
+	related := nw.index.related(fields)
+	if len(related) == 0 {
+		return record + "\t" + unsetField
+	}
+	return record + "\t" + encodeNotices(related)
+}
+
+// returns the notices as a compact JSON array, without escaping HTML.
+func encodeNotices(notices []*RelatedNotice) string {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(notices)
+	return strings.TrimSuffix(encoded.String(), "\n")
+}
@@ -0,0 +1,547 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// records written to a row group of a Parquet file before the next is started, bounding the
+// memory a conversion takes.
+const parquetRowGroupRows = 100000
+
+// physical types of Parquet columns, as numbered by the format.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// returns the file the records of logType for date are written to as Parquet under outDir, in
+// a directory per partition, named as Hive names them, so Spark, Athena or DuckDB read the
+// log type and date from the path, such as log_type=conn/date=2021-06-01/conn-2021-06-01.parquet.
+func ParquetPartition(outDir string, logType string, date time.Time) string {
+	day := date.Format("2006-01-02")
+	return filepath.Join(outDir, "log_type="+logType, "date="+day, logType+"-"+day+".parquet")
+}
+
+// a column of a Parquet file, with the values of the row group being written.
+type parquetColumn struct {
+	name    string
+	kind    int    // physical type of the column
+	defined []bool // for each record of the row group, whether it has a value
+	bools   []bool // values of a boolean column
+	values  []byte // values of any other column, PLAIN encoded
+	chunks  []parquetChunk
+}
+
+// where a column chunk of a row group was written, for the footer.
+type parquetChunk struct {
+	offset       int64 // of its page header
+	size         int64 // of its page, header included, as written
+	uncompressed int64 // of its page, header included, before compression
+	values       int64 // records of the row group, unset ones included
+}
+
+// WriteParquet converts the records of the output file src, JSON records or TSV records after
+// a #fields header, into a Parquet file at dst, created with its directory. Each field is a
+// column of the file, in the order fields are first seen, typed by the values it holds: a
+// column of integers is INT64, of numbers DOUBLE, of booleans BOOLEAN, and any other a UTF8
+// string, with sets and other values written as JSON. TSV values are typed by the #types
+// header. dst is written under its partial name and renamed into place once complete, then
+// src is removed. An output with no records is removed without writing dst, and false
+// returned.
+func WriteParquet(src string, dst string) (written bool, err error) {
+	// the columns and their types are only known once every record is seen.
+	var columns []*parquetColumn
+	index := make(map[string]int)
+	rows := 0
+	err = scanParquetRecords(src, func(record map[string]interface{}, order []string) {
+		rows++
+		for _, field := range order {
+			kind := parquetKind(record[field])
+			i, seen := index[field]
+			if !seen {
+				i = len(columns)
+				index[field] = i
+				columns = append(columns, &parquetColumn{name: field, kind: -1})
+			}
+			columns[i].kind = mergeParquetKinds(columns[i].kind, kind)
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, os.Remove(src)
+	}
+	for _, column := range columns {
+		if column.kind < 0 {
+			column.kind = parquetByteArray
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return false, err
+	}
+	partial := PartialName(dst)
+	out, err := os.Create(partial)
+	if err != nil {
+		return false, err
+	}
+	pw := &parquetWriter{w: out, columns: columns}
+	pw.write([]byte("PAR1"))
+	err = scanParquetRecords(src, func(record map[string]interface{}, order []string) {
+		for _, column := range columns {
+			column.add(record[column.name])
+		}
+		if pw.rows++; pw.rows == parquetRowGroupRows {
+			pw.flush()
+		}
+	})
+	if err == nil {
+		pw.flush()
+		pw.footer()
+		err = pw.err
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, dst)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return false, err
+	}
+	return true, os.Remove(src)
+}
+
+// calls visit with every record of the output file src, with its values typed for Parquet, see
+// parquetValue, and its fields in the order they are written.
+func scanParquetRecords(src string, visit func(record map[string]interface{}, order []string)) error {
+	in, err := openOutput(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	lines := newLineReader(in)
+	defer lines.close()
+	var fields, types []string
+	for {
+		line, readErr := lines.next()
+		line = bytes.TrimRight(line, "\r\n")
+		if bytes.HasPrefix(line, []byte("#types\t")) {
+			types = strings.Split(string(line), "\t")[1:]
+		}
+		if decoded, ok := decodeRecord(line, &fields); ok {
+			if record, isObject := decoded.(map[string]interface{}); isObject {
+				order := fields
+				if line[0] == '{' {
+					order = jsonFieldOrder(line)
+				}
+				for i, field := range order {
+					zeekType := ""
+					if line[0] != '{' && i < len(types) {
+						zeekType = types[i]
+					}
+					record[field] = parquetValue(record[field], zeekType)
+				}
+				visit(record, order)
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// returns the fields of a JSON record in the order they are written.
+func jsonFieldOrder(record []byte) (order []string) {
+	seen := make(map[string]bool)
+	scanObject(record, func(key []byte, value []byte) bool {
+		name := string(key)
+		if bytes.IndexByte(key, '\\') >= 0 {
+			json.Unmarshal(append(append([]byte{'"'}, key...), '"'), &name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			order = append(order, name)
+		}
+		return true
+	})
+	return order
+}
+
+// returns a value of a record as the Go type of the Parquet column it fits: int64, float64,
+// bool or string, or nil if unset. TSV values are typed by their zeek type, and other values
+// of JSON records, such as sets, are written as JSON.
+func parquetValue(value interface{}, zeekType string) interface{} {
+	switch v := value.(type) {
+	case nil, bool:
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return string(v)
+	case string:
+		switch zeekType {
+		case "count", "int", "port":
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i
+			}
+		case "double", "time", "interval":
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		case "bool":
+			if v == "T" || v == "F" {
+				return v == "T"
+			}
+		}
+		return v
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// returns the physical type of the Parquet column a value fits, or -1 if it is unset.
+func parquetKind(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return -1
+	case bool:
+		return parquetBoolean
+	case int64:
+		return parquetInt64
+	case float64:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// returns the physical type of a column holding values of both types: integers and numbers
+// are numbers, and any other mix is strings.
+func mergeParquetKinds(a int, b int) int {
+	switch {
+	case a < 0 || a == b:
+		return b
+	case b < 0:
+		return a
+	case (a == parquetInt64 || a == parquetDouble) && (b == parquetInt64 || b == parquetDouble):
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// adds a value of the next record to the column, converted to its type.
+func (c *parquetColumn) add(value interface{}) {
+	c.defined = append(c.defined, value != nil)
+	if value == nil {
+		return
+	}
+	switch c.kind {
+	case parquetBoolean:
+		c.bools = append(c.bools, value.(bool))
+	case parquetInt64:
+		c.values = appendUint64LE(c.values, uint64(value.(int64)))
+	case parquetDouble:
+		number, isInt := value.(int64)
+		f, _ := value.(float64)
+		if isInt {
+			f = float64(number)
+		}
+		c.values = appendUint64LE(c.values, math.Float64bits(f))
+	default:
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case bool:
+			text = strconv.FormatBool(v)
+		case int64:
+			text = strconv.FormatInt(v, 10)
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(text)))
+		c.values = append(append(c.values, length[:]...), text...)
+	}
+}
+
+// returns the page of the row group of the column: the definition level of each record,
+// whether it is set, then the values set, PLAIN encoded.
+func (c *parquetColumn) page() []byte {
+	levels := rleBits(c.defined)
+	var page []byte
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(levels)))
+	page = append(append(page, length[:]...), levels...)
+	if c.kind == parquetBoolean {
+		packed := make([]byte, (len(c.bools)+7)/8)
+		for i, b := range c.bools {
+			if b {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		return append(page, packed...)
+	}
+	return append(page, c.values...)
+}
+
+// returns bits in the RLE encoding of Parquet levels one bit wide, as a run per repeated value.
+func rleBits(bits []bool) (encoded []byte) {
+	for i := 0; i < len(bits); {
+		run := 1
+		for i+run < len(bits) && bits[i+run] == bits[i] {
+			run++
+		}
+		encoded = appendUvarint(encoded, uint64(run)<<1)
+		if bits[i] {
+			encoded = append(encoded, 1)
+		} else {
+			encoded = append(encoded, 0)
+		}
+		i += run
+	}
+	return encoded
+}
+
+// appends v little-endian, as Parquet writes numbers, unlike MessagePack.
+func appendUint64LE(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// writes the row groups of a Parquet file, then its footer.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int   // records of the row group being written
+	groupRows []int // records of each row group written
+	err       error
+}
+
+func (pw *parquetWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	var n int
+	n, pw.err = pw.w.Write(b)
+	pw.offset += int64(n)
+}
+
+// writes the records added since the last row group as a row group of their own, a gzip
+// compressed page per column.
+func (pw *parquetWriter) flush() {
+	if pw.rows == 0 {
+		return
+	}
+	for _, column := range pw.columns {
+		page := column.page()
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page)
+		gz.Close()
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, 0) // type: DATA_PAGE
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(compressed.Len()))
+		header.structField(5) // data_page_header
+		header.i32(1, int32(pw.rows))
+		header.i32(2, 0) // encoding: PLAIN
+		header.i32(3, 3) // definition_level_encoding: RLE
+		header.i32(4, 3) // repetition_level_encoding: RLE
+		header.end()
+		header.end()
+
+		chunk := parquetChunk{offset: pw.offset, values: int64(pw.rows)}
+		pw.write(header.buf.Bytes())
+		pw.write(compressed.Bytes())
+		chunk.size = pw.offset - chunk.offset
+		chunk.uncompressed = int64(header.buf.Len() + len(page))
+		column.chunks = append(column.chunks, chunk)
+		column.defined, column.bools, column.values = column.defined[:0], column.bools[:0], column.values[:0]
+	}
+	pw.groupRows = append(pw.groupRows, pw.rows)
+	pw.rows = 0
+}
+
+// writes the metadata of the file, its length and the closing magic number.
+func (pw *parquetWriter) footer() {
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1) // version
+	meta.list(2, thriftStruct, len(pw.columns)+1)
+	meta.begin()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.end()
+	for _, column := range pw.columns {
+		meta.begin()
+		meta.i32(1, int32(column.kind))
+		meta.i32(3, 1) // repetition_type: OPTIONAL
+		meta.str(4, column.name)
+		if column.kind == parquetByteArray {
+			meta.i32(6, 0) // converted_type: UTF8
+		}
+		meta.end()
+	}
+	total := int64(0)
+	for _, rows := range pw.groupRows {
+		total += int64(rows)
+	}
+	meta.i64(3, total)
+	meta.list(4, thriftStruct, len(pw.groupRows))
+	for g, rows := range pw.groupRows {
+		meta.begin()
+		meta.list(1, thriftStruct, len(pw.columns))
+		size := int64(0)
+		for _, column := range pw.columns {
+			chunk := column.chunks[g]
+			size += chunk.uncompressed
+			meta.begin()
+			meta.i64(2, chunk.offset)
+			meta.structField(3) // meta_data
+			meta.i32(1, int32(column.kind))
+			meta.list(2, thriftI32, 2)
+			meta.element(0) // PLAIN
+			meta.element(3) // RLE
+			meta.list(3, thriftBinary, 1)
+			meta.text(column.name)
+			meta.i32(4, 2) // codec: GZIP
+			meta.i64(5, chunk.values)
+			meta.i64(6, chunk.uncompressed)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, size)
+		meta.i64(3, int64(rows))
+		meta.end()
+	}
+	meta.str(6, "nagini")
+	meta.end()
+
+	pw.write(meta.buf.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	pw.write(length[:])
+	pw.write([]byte("PAR1"))
+}
+
+// types of the Thrift compact protocol, as numbered by it.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// writes the structs of Parquet metadata in the Thrift compact protocol, which only needs
+// what is written here: integers, strings, lists and structs.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // id of the last field written of each struct being written
+}
+
+// starts a struct, as an element of a list or the outermost one.
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+// ends the struct being written.
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// writes the header of a field, by how far its id is past the last one when it can be.
+func (t *thriftWriter) field(id int16, kind byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.buf.WriteByte(kind)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// writes a signed integer zigzag encoded, as the protocol writes every one.
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(appendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.text(s)
+}
+
+// writes a string without a field header, as an element of a list.
+func (t *thriftWriter) text(s string) {
+	t.buf.Write(appendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+// writes an integer without a field header, as an element of a list.
+func (t *thriftWriter) element(v int32) {
+	t.varint(int64(v))
+}
+
+// starts a list field of size elements of the given type, which are written after it.
+func (t *thriftWriter) list(id int16, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | kind)
+	} else {
+		t.buf.WriteByte(0xf0 | kind)
+		t.buf.Write(appendUvarint(nil, uint64(size)))
+	}
+}
+
+// starts a struct field, ended with end.
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// PipelineConfig sizes what is handed between the stages of a task: decompressing a log,
+// filtering it, and writing out its records. Large buffers and a deep read-ahead suit fast
+// local disks, and small ones machines short on memory or reading logs over NFS.
+type PipelineConfig struct {
+	BufferSize int // bytes handed from one stage to the next at once
+	ReadAhead  int // buffers of a log decompressed ahead of its filter, 0 to only decompress as it reads
+}
+
+// DefaultPipeline is used unless SetPipeline says otherwise.
+var DefaultPipeline = PipelineConfig{BufferSize: 64 * 1024, ReadAhead: 4}
+
+var pipeline = DefaultPipeline
+
+// sets how the stages of the tasks of a pull hand data to each other. Must not be called
+// while a pull runs.
+func SetPipeline(config PipelineConfig) {
+	pipeline = config
+}
+
+// buffers shared by the tasks of a pull, so each log read or written does not allocate its
+// own, which adds up over the thousands of logs of a big pull. Buffers of another size, from
+// before SetPipeline, are dropped rather than reused.
+var (
+	readerPool sync.Pool
+	writerPool sync.Pool
+	copyPool   sync.Pool
+)
+
+// returns a pooled reader of r, to be given back with putReader once done.
+func getReader(r io.Reader) *bufio.Reader {
+	reader, ok := readerPool.Get().(*bufio.Reader)
+	if !ok || reader.Size() != pipeline.BufferSize {
+		return bufio.NewReaderSize(r, pipeline.BufferSize)
+	}
+	reader.Reset(r)
+	return reader
+}
+
+// gives a reader from getReader back to the pool.
+func putReader(reader *bufio.Reader) {
+	reader.Reset(nil)
+	readerPool.Put(reader)
+}
+
+// returns a pooled writer to w, to be flushed and given back with putWriter once done.
+func getWriter(w io.Writer) *bufio.Writer {
+	writer, ok := writerPool.Get().(*bufio.Writer)
+	if !ok || writer.Size() != pipeline.BufferSize {
+		return bufio.NewWriterSize(w, pipeline.BufferSize)
+	}
+	writer.Reset(w)
+	return writer
+}
+
+// gives a writer from getWriter back to the pool. Whatever was not flushed is dropped.
+func putWriter(writer *bufio.Writer) {
+	writer.Reset(nil)
+	writerPool.Put(writer)
+}
+
+// returns a pooled buffer of the pipeline's buffer size, to be given back with putBuffer.
+func getBuffer() *[]byte {
+	buf, ok := copyPool.Get().(*[]byte)
+	if !ok || len(*buf) != pipeline.BufferSize {
+		made := make([]byte, pipeline.BufferSize)
+		return &made
+	}
+	return buf
+}
+
+// gives a buffer from getBuffer back to the pool.
+func putBuffer(buf *[]byte) {
+	copyPool.Put(buf)
+}
+
+// copies src to dst like io.Copy, through a pooled buffer.
+func copyPooled(dst io.Writer, src io.Reader) (int64, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// lineReader reads the lines of a log through a pooled reader. Unlike ReadBytes, the lines it
+// returns are only good until the next one is read, so reading one allocates nothing unless
+// it is longer than the buffer.
+type lineReader struct {
+	reader *bufio.Reader
+	long   []byte // a line longer than the buffer, put together
+}
+
+// returns a line reader of r, to be closed once done.
+func newLineReader(r io.Reader) lineReader {
+	return lineReader{reader: getReader(r)}
+}
+
+// returns the next line with its newline, if it has one, like ReadBytes.
+func (lr *lineReader) next() (line []byte, err error) {
+	line, err = lr.reader.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		return line, err
+	}
+	lr.long = append(lr.long[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = lr.reader.ReadSlice('\n')
+		lr.long = append(lr.long, line...)
+	}
+	return lr.long, err
+}
+
+// gives the reader back to the pool.
+func (lr *lineReader) close() {
+	putReader(lr.reader)
+	lr.reader = nil
+}
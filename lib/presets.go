@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"embed"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// built-in playbooks, run by name with 'nagini preset'.
+//
+//go:embed presets/*.yaml
+var presets embed.FS
+
+// returns every preset, sorted by name, with its description.
+func ListPresets() (playbooks []LibraryPlaybook) {
+	entries, _ := presets.ReadDir("presets")
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		content, _ := PresetContent(name)
+		var playbook struct {
+			Description string `yaml:"description"`
+		}
+		yaml.Unmarshal(content, &playbook)
+		playbooks = append(playbooks, LibraryPlaybook{Name: name, Description: playbook.Description})
+	}
+	sort.Slice(playbooks, func(i, j int) bool { return playbooks[i].Name < playbooks[j].Name })
+	return playbooks
+}
+
+// returns the playbook of the preset called name, before variables are filled in.
+func PresetContent(name string) ([]byte, error) {
+	content, err := presets.ReadFile("presets/" + name + ".yaml")
+	if err != nil || strings.Contains(name, "/") {
+		return nil, errors.New(T("error.preset.notfound", name))
+	}
+	return content, nil
+}
+
+// reads the preset called name like ParsePlaybookWithVars, or like ParsePlaybookStrict if
+// strict is set. Presets are whole playbooks, so they do not extend or include others.
+func ParsePreset(name string, vars map[string]string, strict bool) (playbook Playbook, err error) {
+	content, err := PresetContent(name)
+	if err != nil {
+		return playbook, err
+	}
+	return parsePlaybookContent(name, content, vars, strict)
+}
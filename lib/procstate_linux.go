@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// names of the process states in /proc/<pid>/stat.
+var procStates = map[string]string{
+	"R": "running",
+	"S": "sleeping",
+	"D": "waiting on disk",
+	"Z": "zombie",
+	"T": "stopped",
+	"t": "stopped by a tracer",
+	"I": "idle",
+}
+
+// returns the state of the process with the given pid, and what it is waiting in if it is
+// blocked, such as "S (sleeping) in pipe_read". Returns "unknown" if it cannot be read.
+func ProcessState(pid int) string {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "unknown"
+	}
+	// the state follows the command name, which is in parentheses and may hold spaces.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	state := fields[0]
+	if name, ok := procStates[state]; ok {
+		state += " (" + name + ")"
+	}
+	if wchan, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/wchan", pid)); err == nil && len(wchan) > 0 && string(wchan) != "0" {
+		state += " in " + strings.TrimSpace(string(wchan))
+	}
+	return state
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package lib
+
+// the state of a process is only read on linux.
+func ProcessState(pid int) string {
+	return "unknown"
+}
@@ -0,0 +1,218 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"sort"
+	"sync"
+)
+
+// most distinct values of a field that are counted. Past this, values not seen yet are only
+// noted as more, so a field like uid does not hold every record in memory.
+const profileMaxDistinct = 10000
+
+// ValueCount is a value of a field and the number of records it was seen in.
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// FieldProfile describes the values a field took in the records of a profile.
+type FieldProfile struct {
+	Name         string
+	Nulls        int  // records the field was unset or missing in.
+	Distinct     int  // distinct values the field was set to, up to profileMaxDistinct.
+	MoreDistinct bool // there were more distinct values than were counted.
+	Top          []ValueCount
+}
+
+// Profile describes the fields of a sample of the logs of a time range.
+type Profile struct {
+	Logs    int      // logs in the time range.
+	Sampled []string // logs read for the profile.
+	Records int      // records read.
+	Fields  []FieldProfile
+}
+
+// returns the share of the records of the profile the field was unset or missing in, from 0 to 1.
+func (p Profile) NullRate(field FieldProfile) float64 {
+	if p.Records == 0 {
+		return 0
+	}
+	return float64(field.Nulls) / float64(p.Records)
+}
+
+// counts of a field over the records read so far.
+type fieldCounts struct {
+	set    int
+	values map[string]int
+	more   bool
+}
+
+func (c *fieldCounts) add(value string, n int) {
+	if _, ok := c.values[value]; ok || len(c.values) < profileMaxDistinct {
+		c.values[value] += n
+	} else {
+		c.more = true
+	}
+}
+
+// counts of every field over the records read so far.
+type profileCounts struct {
+	records int
+	fields  map[string]*fieldCounts
+}
+
+func (p *profileCounts) field(name string) *fieldCounts {
+	c, ok := p.fields[name]
+	if !ok {
+		c = &fieldCounts{values: make(map[string]int)}
+		p.fields[name] = c
+	}
+	return c
+}
+
+// adds the counts of other, such as those of another log.
+func (p *profileCounts) merge(other *profileCounts) {
+	p.records += other.records
+	for name, counts := range other.fields {
+		c := p.field(name)
+		c.set += counts.set
+		c.more = c.more || counts.more
+		for value, n := range counts.values {
+			c.add(value, n)
+		}
+	}
+}
+
+// ProfileLogs reads a sample of the logs that a pull with rc would read, several at a time,
+// and describes every field of their records: how often it is unset, how many distinct values
+// it has, and its top most common values. Up to sampleLogs logs are read, spread evenly over
+// the time range, or every log if sampleLogs is 0, and up to sampleRecords records of each,
+// or every record if 0. Corrupt logs are recorded in rc.Report, if set, and skipped.
+func ProfileLogs(rc RuntimeConfig, sampleLogs int, sampleRecords int, top int) (profile Profile, err error) {
+	logFiles, err := PullLogs(rc)
+	if err != nil {
+		return profile, err
+	}
+	profile.Logs = len(logFiles)
+	profile.Sampled = sampleEvenly(logFiles, sampleLogs)
+
+	total := &profileCounts{fields: make(map[string]*fieldCounts)}
+	var lock sync.Mutex
+	var firstErr error
+	logs := make(chan string)
+	var wg sync.WaitGroup
+	threads := rc.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for logFile := range logs {
+				counts, err := profileLog(logFile, sampleRecords, rc.Report)
+				lock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				total.merge(counts)
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, logFile := range profile.Sampled {
+		logs <- logFile
+	}
+	close(logs)
+	wg.Wait()
+	if firstErr != nil {
+		return profile, firstErr
+	}
+
+	profile.Records = total.records
+	for name, counts := range total.fields {
+		field := FieldProfile{
+			Name:         name,
+			Nulls:        total.records - counts.set,
+			Distinct:     len(counts.values),
+			MoreDistinct: counts.more,
+		}
+		for value, n := range counts.values {
+			field.Top = append(field.Top, ValueCount{value, n})
+		}
+		sort.Slice(field.Top, func(i, j int) bool {
+			if field.Top[i].Count != field.Top[j].Count {
+				return field.Top[i].Count > field.Top[j].Count
+			}
+			return field.Top[i].Value < field.Top[j].Value
+		})
+		if len(field.Top) > top {
+			field.Top = field.Top[:top]
+		}
+		profile.Fields = append(profile.Fields, field)
+	}
+	sort.Slice(profile.Fields, func(i, j int) bool {
+		return profile.Fields[i].Name < profile.Fields[j].Name
+	})
+	return profile, nil
+}
+
+// returns up to n of the given files, spread evenly from the first to the last, or all of
+// them if n is 0.
+func sampleEvenly(files []string, n int) (sample []string) {
+	if n <= 0 || n >= len(files) {
+		return files
+	}
+	if n == 1 {
+		return files[:1]
+	}
+	for i := 0; i < n; i++ {
+		sample = append(sample, files[i*(len(files)-1)/(n-1)])
+	}
+	return sample
+}
+
+// counts the fields of up to maxRecords records of a single log, or every record if 0.
+func profileLog(logFile string, maxRecords int, report *RunReport) (counts *profileCounts, err error) {
+	counts = &profileCounts{fields: make(map[string]*fieldCounts)}
+	f, err := os.Open(logFile)
+	if err != nil {
+		return counts, err
+	}
+	defer f.Close()
+	checked, err := NewCheckedReader(f)
+	if err != nil {
+		if report != nil {
+			report.AddCorrupt(logFile, err)
+		}
+		return counts, nil
+	}
+	defer checked.Close()
+
+	reader := bufio.NewReader(checked)
+	var fields []string
+	for maxRecords <= 0 || counts.records < maxRecords {
+		line, readErr := reader.ReadBytes('\n')
+		if record, ok := sqlRecord(bytes.TrimRight(line, "\r\n"), &fields); ok {
+			counts.records++
+			for name, value := range record {
+				c := counts.field(name)
+				if value != nil {
+					c.set++
+					c.add(sqlString(value), 1)
+				}
+			}
+		}
+		// a log that ends early is corrupt, and is recorded below.
+		if readErr != nil {
+			break
+		}
+	}
+	if checked.Err != nil && report != nil {
+		report.AddCorrupt(logFile, checked.Err)
+	}
+	return counts, nil
+}
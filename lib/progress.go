@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cheggaaa/pb"
+)
+
+// The task bar counts whole logs, so a single huge log can sit at the same count for an
+// hour. Logs over a size threshold also show how much of their compressed stream has been
+// read after the bar, so a slow log can be told apart from a hung run.
+
+// number of large logs listed after the task bar, past which only a count is shown.
+const maxProgressShown = 2
+
+// large logs being read, by the bar they are shown on. Guarded by progressLock.
+var inProgress = make(map[*pb.ProgressBar][]*ProgressReader)
+var progressLock sync.Mutex
+
+// ProgressReader counts the bytes read from a large log, and shows the share of its size
+// read so far after a task bar.
+type ProgressReader struct {
+	r     io.Reader
+	bar   *pb.ProgressBar
+	name  string
+	size  int64
+	read  int64 // bytes read so far, updated atomically
+	shown int64 // percent last shown, updated atomically
+}
+
+// returns a reader of r, the log at logFile of the given size, that shows the share of it
+// read so far after bar. Logs smaller than threshold bytes, or any log if threshold is not
+// positive, are returned as they are. Close must be called once the log is done.
+func NewProgressReader(r io.Reader, bar *pb.ProgressBar, logFile string, size int64, threshold int64) io.ReadCloser {
+	if threshold <= 0 || size < threshold || bar == nil {
+		return io.NopCloser(r)
+	}
+	pr := &ProgressReader{r: r, bar: bar, name: filepath.Base(logFile), size: size}
+	progressLock.Lock()
+	inProgress[bar] = append(inProgress[bar], pr)
+	showProgress(bar)
+	progressLock.Unlock()
+	return pr
+}
+
+func (pr *ProgressReader) Read(p []byte) (n int, err error) {
+	n, err = pr.r.Read(p)
+	// the postfix is only rebuilt when a percent is crossed, not on every read.
+	if percent := pr.percent(atomic.AddInt64(&pr.read, int64(n))); percent != atomic.LoadInt64(&pr.shown) {
+		atomic.StoreInt64(&pr.shown, percent)
+		progressLock.Lock()
+		showProgress(pr.bar)
+		progressLock.Unlock()
+	}
+	return n, err
+}
+
+// stops showing the log after the bar.
+func (pr *ProgressReader) Close() error {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	readers := inProgress[pr.bar]
+	for i, other := range readers {
+		if other == pr {
+			readers = append(readers[:i:i], readers[i+1:]...)
+			break
+		}
+	}
+	if len(readers) == 0 {
+		delete(inProgress, pr.bar)
+	} else {
+		inProgress[pr.bar] = readers
+	}
+	showProgress(pr.bar)
+	return nil
+}
+
+// returns read bytes as a percent of the size of the log.
+func (pr *ProgressReader) percent(read int64) int64 {
+	if read >= pr.size {
+		return 100
+	}
+	return read * 100 / pr.size
+}
+
+// sets the postfix of bar to the large logs being read for it. progressLock must be held.
+func showProgress(bar *pb.ProgressBar) {
+	var shown []string
+	readers := inProgress[bar]
+	for i, pr := range readers {
+		if i == maxProgressShown {
+			shown = append(shown, T("bar.progress.more", len(readers)-maxProgressShown))
+			break
+		}
+		shown = append(shown, fmt.Sprintf("%s %d%%", pr.name, atomic.LoadInt64(&pr.shown)))
+	}
+	if len(shown) == 0 {
+		bar.Postfix("")
+		return
+	}
+	bar.Postfix(" " + strings.Join(shown, ", "))
+}
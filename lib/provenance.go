@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// ProvenanceExtension is added to the name of an output file to name its provenance sidecar,
+// such as conn-2021-06-01.json.meta.json.
+const ProvenanceExtension = ".meta.json"
+
+// version of nagini, set when building a release with
+// -ldflags "-X github.com/OSU-SOC/nagini/lib.version=v1.2.0".
+var version string
+
+// Version returns the version of nagini: the one it was built as, or else the version of the
+// module it was installed from, or (devel) if it was built from a checkout.
+func Version() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// Provenance describes how an output file was made. It is written next to the file as a JSON
+// sidecar, so a results file found months after the pull still says what it holds.
+type Provenance struct {
+	File        string    `json:"file"`           // name of the output file, in the same directory
+	Size        int64     `json:"size"`           // size of the output file when it was written
+	Version     string    `json:"nagini_version"` // version of nagini, see Version
+	CommandLine string    `json:"command_line"`   // nagini command the pull was run with
+	Filter      string    `json:"filter"`         // filter command and its args, or jq expression, run on each log
+	LogType     string    `json:"log_type"`       // log type pulled
+	LogDir      string    `json:"log_dir"`        // zeek log directory pulled from
+	Start       time.Time `json:"start"`          // first hour pulled
+	End         time.Time `json:"end"`            // last hour pulled, inclusive
+	Written     time.Time `json:"written"`        // when the sidecar was written
+}
+
+// returns the provenance of the outputs of a pull of rc through filter, run as commandLine.
+func NewProvenance(commandLine string, filter string, rc RuntimeConfig) Provenance {
+	return Provenance{
+		Version:     Version(),
+		CommandLine: commandLine,
+		Filter:      filter,
+		LogType:     rc.LogType,
+		LogDir:      rc.LogDir,
+		Start:       rc.StartTime,
+		End:         rc.EndTime,
+	}
+}
+
+// returns whether name is the provenance sidecar of an output file.
+func IsProvenanceFile(name string) bool {
+	return strings.HasSuffix(name, ProvenanceExtension)
+}
+
+// WriteProvenance writes p as the sidecar of every output file in outDir, with the name and
+// size of the file filled in. Hidden files, and the manifests, reports, dictionaries and
+// sidecars written with outputs, are skipped. Returns the number of sidecars written.
+func WriteProvenance(outDir string, p Provenance) (written int, err error) {
+	files, err := ioutil.ReadDir(outDir)
+	if err != nil {
+		return 0, err
+	}
+	p.Written = time.Now()
+	for _, file := range files {
+		if file.IsDir() || !isOutputFile(file.Name()) {
+			continue
+		}
+		p.File, p.Size = file.Name(), file.Size()
+		encoded, _ := json.MarshalIndent(p, "", "  ")
+		if err = os.WriteFile(filepath.Join(outDir, file.Name()+ProvenanceExtension), append(encoded, '\n'), 0644); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// name of the file ParseLogs leaves in each output directory it writes, so prune can tell the
+// outputs of pulls from other directories under a root.
+const OutputMarker = ".nagini-output"
+
+// RetentionRule says how long the outputs of pulls under a directory are kept, from retention
+// in the global config. Each directory under Root holding the OutputMarker is the output of a
+// pull, and is removed by prune once nothing in it was modified for OlderThan.
+type RetentionRule struct {
+	Root      string `yaml:"root" mapstructure:"root"`             // root: directory pulls write their outputs under
+	OlderThan string `yaml:"older_than" mapstructure:"older_than"` // older_than: such as 30d, 2w or 72h
+}
+
+// ExpiredOutput is the output directory of a pull that a retention rule no longer keeps.
+type ExpiredOutput struct {
+	Path     string
+	Modified time.Time // last time anything in it was modified
+	Size     int64
+	root     string // root of the retention rule it was found under
+}
+
+// parses the age outputs are kept for, such as 30d, 2w or 72h. Returns an error if it is
+// not a positive duration.
+func ParseAge(age string) (time.Duration, error) {
+	if size, ok := parseDays(age); ok && size > 0 {
+		return size, nil
+	}
+	return 0, &messageError{T("error.prune.age", age), ErrBadTimeRange}
+}
+
+// takes the lock of dir, of every directory under it, and of those between root and it, such
+// as the output directory of a backfill holding its chunks, so no run writes into them while
+// they are removed. Fails with an error matching ErrOutputLocked if a run holds any of them,
+// releasing those already taken.
+func lockOutput(root string, dir string) (locks []*DirLock, err error) {
+	lock := func(path string) error {
+		l, err := LockDir(path)
+		if errors.Is(err, ErrOutputLocked) {
+			return err
+		} else if err == nil {
+			locks = append(locks, l)
+		}
+		return nil
+	}
+	for parent := filepath.Dir(dir); err == nil && parent != root && strings.HasPrefix(parent, root); parent = filepath.Dir(parent) {
+		err = lock(parent)
+	}
+	if err == nil {
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+			return lock(path)
+		})
+	}
+	if err != nil {
+		unlockOutput(locks)
+		return nil, err
+	}
+	return locks, nil
+}
+
+// releases the locks taken by lockOutput.
+func unlockOutput(locks []*DirLock) {
+	for _, lock := range locks {
+		lock.Unlock()
+	}
+}
+
+// returns the output directory dir under root, with when anything in it was last modified,
+// and its size.
+func outputUsage(root string, dir string) ExpiredOutput {
+	output := ExpiredOutput{Path: dir, root: root}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(output.Modified) {
+			output.Modified = info.ModTime()
+		}
+		if !info.IsDir() {
+			output.Size += info.Size()
+		}
+		return nil
+	})
+	return output
+}
+
+// returns the output directories under root in which nothing was modified for olderThan
+// before now, oldest first. Only a directory holding the OutputMarker ParseLogs leaves is an
+// output, and is removed whole. Other directories, such as those of a case, are looked in for
+// outputs, and kept with anything else in them. Symlinks are skipped rather than followed, and
+// outputs a run is still writing into are skipped as well.
+func ExpiredOutputs(root string, olderThan time.Duration, now time.Time) (expired []ExpiredOutput, err error) {
+	root = filepath.Clean(os.ExpandEnv(root))
+	cutoff := now.Add(-olderThan)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if path == root {
+			return err
+		}
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if marker, err := os.Lstat(filepath.Join(path, OutputMarker)); err != nil || !marker.Mode().IsRegular() {
+			return nil
+		}
+		// an output is removed whole, so what is in it is not looked at apart.
+		output := outputUsage(root, path)
+		if output.Modified.Before(cutoff) {
+			if locks, err := lockOutput(root, path); err == nil {
+				unlockOutput(locks)
+				expired = append(expired, output)
+			}
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Modified.Before(expired[j].Modified) })
+	return expired, nil
+}
+
+// removes the given outputs, holding their locks so a run started since they were listed is
+// not removed from under it. Returns the first error, once every output was tried.
+func PruneOutputs(outputs []ExpiredOutput) (err error) {
+	for _, output := range outputs {
+		locks, removeErr := lockOutput(output.root, output.Path)
+		if removeErr == nil {
+			removeErr = os.RemoveAll(output.Path)
+			unlockOutput(locks)
+		}
+		if removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// returns the line reporting the outputs were removed, and the space it freed.
+func PrunedLabel(outputs []ExpiredOutput) string {
+	var size int64
+	for _, output := range outputs {
+		size += output.Size
+	}
+	return T("prune.removed", len(outputs), FormatBytes(size))
+}
+
+// returns the line listing an expired output.
+func (o ExpiredOutput) Label() string {
+	return T("prune.output", o.Path, o.Modified.Format(TimeFormatHuman), FormatBytes(o.Size))
+}
@@ -0,0 +1,311 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A zeek log directory can be on another host, given as sftp://[user@]host[:port]/path, or
+// served over HTTP(S) as http[s]://host[:port]/path. The logs a pull would read are listed
+// and fetched into a local cache first, which mirrors the layout of the archive, and the pull
+// then reads the cache. Only logs of the hours pulled are fetched, going by their names.
+//
+// Over SFTP, the system sftp client is used, in batch mode, so the host has to be reachable
+// without a password prompt, such as with a key loaded into ssh-agent. Over HTTP(S), logs are
+// listed from an index manifest at the root of the archive, if there is one, or else from the
+// directory listing of each date. Archived logs are assumed never to change, so a log already
+// in the cache is not fetched again, and an interrupted download is resumed with a ranged
+// request.
+
+// RemoteArchive is a zeek log directory on another host, read over SFTP or HTTP(S).
+type RemoteArchive struct {
+	Scheme string // sftp, http or https.
+	User   string // only for sftp.
+	Host   string
+	Port   int // 0 for the default port.
+	Path   string
+}
+
+// returns whether logDir names a log directory on another host, rather than a local one.
+func IsRemoteLogDir(logDir string) bool {
+	for _, scheme := range []string{"sftp://", "http://", "https://"} {
+		if strings.HasPrefix(logDir, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// parses a remote log directory, such as sftp://analyst@archive-host/data/zeek/logs or
+// https://cold-storage/zeek/logs.
+func ParseRemoteArchive(logDir string) (*RemoteArchive, error) {
+	u, err := url.Parse(logDir)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme == "sftp":
+		if u.Hostname() == "" || !strings.HasPrefix(u.Path, "/") {
+			return nil, fmt.Errorf("%s is not of the form sftp://[user@]host[:port]/path", logDir)
+		}
+	case u.Scheme == "http" || u.Scheme == "https":
+		if u.Hostname() == "" || u.User != nil || u.RawQuery != "" {
+			return nil, fmt.Errorf("%s is not of the form %s://host[:port]/path", logDir, u.Scheme)
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	default:
+		return nil, fmt.Errorf("%s is not an sftp, http or https URL", logDir)
+	}
+	r := &RemoteArchive{Scheme: u.Scheme, User: u.User.Username(), Host: u.Hostname(), Path: path.Clean(u.Path)}
+	if port := u.Port(); port != "" {
+		if r.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("%s has an invalid port: %w", logDir, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *RemoteArchive) String() string {
+	u := url.URL{Scheme: r.Scheme, Host: r.Host, Path: r.Path}
+	if r.Port != 0 {
+		u.Host += ":" + strconv.Itoa(r.Port)
+	}
+	if r.User != "" {
+		u.User = url.User(r.User)
+	}
+	return u.String()
+}
+
+// runs the given sftp commands in a single session, returning what they printed.
+func (r *RemoteArchive) batch(commands []string) ([]byte, error) {
+	args := []string{"-b", "-"}
+	if r.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(r.Port))
+	}
+	target := r.Host
+	if r.User != "" {
+		target = r.User + "@" + r.Host
+	}
+	sftp := exec.Command("sftp", append(args, target)...)
+	sftp.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stderr bytes.Buffer
+	sftp.Stderr = &stderr
+	output, err := sftp.Output()
+	if err != nil {
+		return output, fmt.Errorf("sftp %s: %w: %s", target, err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// quotes an argument of an sftp command.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// LogCache is a local directory holding logs fetched from remote archives. Once it holds
+// more than MaxBytes, the logs used least recently are removed, except those of the pull
+// being fetched for.
+type LogCache struct {
+	Dir      string
+	MaxBytes int64
+}
+
+// name of the file in the cache directory recording when each log was last used.
+const cacheIndexFile = "index.json"
+
+// returns the directory of the cache that mirrors the remote archive.
+func (c LogCache) archiveDir(r *RemoteArchive) string {
+	host := r.Host
+	if r.Port != 0 {
+		host += "_" + strconv.Itoa(r.Port)
+	}
+	return filepath.Join(c.Dir, r.Scheme, host, filepath.FromSlash(r.Path))
+}
+
+// FetchRemoteLogs lists the logs of the remote archive that a pull with rc would read,
+// fetches those missing from the cache, and returns the directory of the cache to read them
+// from instead. Progress is written to out.
+func FetchRemoteLogs(rc RuntimeConfig, r *RemoteArchive, cache LogCache, out io.Writer) (localDir string, err error) {
+	localDir = cache.archiveDir(r)
+
+	// list the logs of the type in each date directory of the range, then keep those of the
+	// hours pulled, like hourLogs does with a local directory.
+	var dateDirs, wanted []string
+	for _, day := range pullDays(rc) {
+		dateDir := day.Start.Format(TimeFormatDay)
+		dateDirs = append(dateDirs, dateDir)
+		for curTime := day.Start; !curTime.After(day.End); curTime = curTime.Add(time.Hour) {
+			if includesHour(rc, curTime) {
+				for _, pattern := range hourPatterns(rc.LogType, curTime, rc.Cluster) {
+					wanted = append(wanted, path.Join(dateDir, pattern))
+				}
+			}
+		}
+	}
+	var listed []string
+	if r.Scheme == "sftp" {
+		listed, err = r.listSFTP(dateDirs, datePatterns(rc.LogType, rc.Cluster))
+	} else {
+		listed, err = r.listHTTP(dateDirs, datePatterns(rc.LogType, rc.Cluster))
+	}
+	if err != nil {
+		return localDir, err
+	}
+	var remoteLogs []string
+	for _, rel := range listed {
+		for _, pattern := range wanted {
+			if matched, _ := path.Match(pattern, rel); matched {
+				remoteLogs = append(remoteLogs, rel)
+				break
+			}
+		}
+	}
+
+	var missing []string
+	for _, rel := range remoteLogs {
+		if _, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(rel))); err != nil {
+			missing = append(missing, rel)
+		}
+	}
+	fmt.Fprint(out, T("remote.fetch", len(missing), r, len(remoteLogs)-len(missing)))
+	if len(missing) > 0 {
+		if r.Scheme == "sftp" {
+			err = r.fetchSFTP(missing, localDir)
+		} else {
+			err = r.fetchHTTP(missing, localDir)
+		}
+		if err != nil {
+			return localDir, err
+		}
+	}
+
+	var used []string
+	for _, rel := range remoteLogs {
+		used = append(used, filepath.Join(localDir, filepath.FromSlash(rel)))
+	}
+	return localDir, cache.use(used)
+}
+
+// returns the logs in the given date directories of the archive that match any of patterns,
+// relative to the archive, listed over SFTP.
+func (r *RemoteArchive) listSFTP(dateDirs []string, patterns []string) (logs []string, err error) {
+	var list []string
+	for _, dateDir := range dateDirs {
+		for _, pattern := range patterns {
+			// a date with no such logs is not an error, so the command is allowed to fail.
+			list = append(list, "-ls -1 "+sftpQuote(path.Join(r.Path, dateDir, pattern)))
+		}
+	}
+	output, err := r.batch(list)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		rel := strings.TrimPrefix(line, strings.TrimSuffix(r.Path, "/")+"/")
+		if line == "" || strings.HasPrefix(line, "sftp>") || rel == line {
+			continue
+		}
+		logs = append(logs, rel)
+	}
+	return logs, nil
+}
+
+// fetches the given logs of the archive into localDir over SFTP, in a single session. Each is
+// fetched to a partial file first, so an interrupted fetch never leaves a log in the cache
+// that looks complete.
+func (r *RemoteArchive) fetchSFTP(logs []string, localDir string) error {
+	var gets, locals []string
+	for _, rel := range logs {
+		local := filepath.Join(localDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(local), 0775); err != nil {
+			return err
+		}
+		gets = append(gets, "get -p "+sftpQuote(path.Join(r.Path, rel))+" "+sftpQuote(local+".part"))
+		locals = append(locals, local)
+	}
+	_, err := r.batch(gets)
+	for _, local := range locals {
+		if err != nil {
+			os.Remove(local + ".part")
+		} else if renameErr := os.Rename(local+".part", local); renameErr != nil {
+			err = renameErr
+		}
+	}
+	return err
+}
+
+// records that the given logs of the cache were just used, then removes the logs used least
+// recently, other than those, until the cache holds no more than MaxBytes.
+func (c LogCache) use(logFiles []string) error {
+	if err := os.MkdirAll(c.Dir, 0775); err != nil {
+		return err
+	}
+	indexPath := filepath.Join(c.Dir, cacheIndexFile)
+	lastUsed := make(map[string]int64)
+	if content, err := ioutil.ReadFile(indexPath); err == nil {
+		// an unreadable index only loses track of when logs were used.
+		json.Unmarshal(content, &lastUsed)
+	}
+	now := time.Now().UnixNano()
+	keep := make(map[string]bool)
+	for _, logFile := range logFiles {
+		if rel, err := filepath.Rel(c.Dir, logFile); err == nil {
+			lastUsed[filepath.ToSlash(rel)] = now
+			keep[filepath.ToSlash(rel)] = true
+		}
+	}
+
+	type cached struct {
+		rel  string
+		size int64
+		used int64
+	}
+	var logs []cached
+	var total int64
+	for rel, used := range lastUsed {
+		info, err := os.Stat(filepath.Join(c.Dir, filepath.FromSlash(rel)))
+		if err != nil {
+			delete(lastUsed, rel)
+			continue
+		}
+		logs = append(logs, cached{rel, info.Size(), used})
+		total += info.Size()
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].used < logs[j].used
+	})
+	for _, log := range logs {
+		if total <= c.MaxBytes {
+			break
+		}
+		if keep[log.rel] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.Dir, filepath.FromSlash(log.rel))); err != nil {
+			return err
+		}
+		delete(lastUsed, log.rel)
+		total -= log.size
+	}
+
+	content, err := json.Marshal(lastUsed)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(indexPath, content, 0664)
+}
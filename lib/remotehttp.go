@@ -0,0 +1,250 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long to wait for an HTTP(S) archive to start responding. Downloads of large logs can
+// take much longer, so the whole request is not limited.
+const remoteHTTPTimeout = 60 * time.Second
+
+// most bytes of a directory listing that are read.
+const remoteListingLimit = 32 << 20
+
+// name of the index manifest at the root of an HTTP(S) archive. It lists every log of the
+// archive, one path relative to the root per line, and spares listing each date directory.
+// Blank lines and lines starting with # are ignored.
+const remoteIndexFile = "index.txt"
+
+var remoteHTTPClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ResponseHeaderTimeout: remoteHTTPTimeout,
+}}
+
+// matches the links of a directory listing.
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#?]+)`)
+
+// returns the URL of a file of the archive, or of a directory if rel ends with a slash.
+func (r *RemoteArchive) url(rel string) *url.URL {
+	u := &url.URL{Scheme: r.Scheme, Host: r.Host, Path: path.Join(r.Path, rel)}
+	if r.Port != 0 {
+		u.Host += ":" + strconv.Itoa(r.Port)
+	}
+	if strings.HasSuffix(rel, "/") && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u
+}
+
+// requests a file of the archive, failing unless the response has one of the given statuses.
+func (r *RemoteArchive) get(rel string, header http.Header, statuses ...int) (*http.Response, error) {
+	u := r.url(rel)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := remoteHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+}
+
+// returns the logs in the given date directories of the archive that match any of patterns,
+// relative to the archive, listed from its index manifest or else its directory listings.
+func (r *RemoteArchive) listHTTP(dateDirs []string, patterns []string) (logs []string, err error) {
+	listed, err := r.index()
+	if err != nil {
+		return nil, err
+	}
+	if listed == nil {
+		// the logs of a worker may be kept in a directory of its own.
+		subDirs := false
+		for _, pattern := range patterns {
+			subDirs = subDirs || strings.Contains(pattern, "/")
+		}
+		for _, dateDir := range dateDirs {
+			entries, err := r.listDir(dateDir + "/")
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !strings.HasSuffix(entry, "/") {
+					listed = append(listed, path.Join(dateDir, entry))
+					continue
+				}
+				if !subDirs {
+					continue
+				}
+				workerEntries, err := r.listDir(path.Join(dateDir, entry) + "/")
+				if err != nil {
+					return nil, err
+				}
+				for _, workerEntry := range workerEntries {
+					if !strings.HasSuffix(workerEntry, "/") {
+						listed = append(listed, path.Join(dateDir, entry, workerEntry))
+					}
+				}
+			}
+		}
+	}
+
+	for _, rel := range listed {
+	matching:
+		for _, dateDir := range dateDirs {
+			for _, pattern := range patterns {
+				if matched, _ := path.Match(path.Join(dateDir, pattern), rel); matched {
+					logs = append(logs, rel)
+					break matching
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// returns the logs listed by the index manifest of the archive, or nil if it has none.
+func (r *RemoteArchive) index() (logs []string, err error) {
+	resp, err := r.get(remoteIndexFile, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	logs = []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			logs = append(logs, strings.TrimPrefix(path.Clean(line), "/"))
+		}
+	}
+	return logs, scanner.Err()
+}
+
+// returns the entries of a directory of the archive from its directory listing, with a slash
+// after those that are directories. A directory that does not exist has no entries.
+func (r *RemoteArchive) listDir(dir string) (entries []string, err error) {
+	resp, err := r.get(dir, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, remoteListingLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	// only links to entries of the directory itself count, not those to its parent, to
+	// sort the listing, or elsewhere. Listings often link to an entry more than once.
+	base := r.url(dir)
+	seen := make(map[string]bool)
+	for _, match := range hrefPattern.FindAllSubmatch(body, -1) {
+		ref, err := url.Parse(html.UnescapeString(string(match[1])))
+		if err != nil {
+			continue
+		}
+		u := base.ResolveReference(ref)
+		name := strings.TrimPrefix(u.Path, base.Path)
+		if u.Host != base.Host || name == u.Path || name == "" || strings.Contains(strings.TrimSuffix(name, "/"), "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, name)
+	}
+	return entries, nil
+}
+
+// fetches the given logs of the archive into localDir over HTTP(S).
+func (r *RemoteArchive) fetchHTTP(logs []string, localDir string) error {
+	for _, rel := range logs {
+		if err := r.download(rel, filepath.Join(localDir, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloads a log of the archive to local, through a partial file. The partial file of an
+// interrupted download is kept, and the next download of the log only requests the rest of
+// it. The log keeps its time of modification on the server, if given.
+func (r *RemoteArchive) download(rel string, local string) error {
+	if err := os.MkdirAll(filepath.Dir(local), 0775); err != nil {
+		return err
+	}
+	part := local + ".part"
+	var header http.Header
+	var offset int64
+	if info, err := os.Stat(part); err == nil && info.Size() > 0 {
+		offset = info.Size()
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+	}
+	resp, err := r.get(rel, header, http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch contentRange := resp.Header.Get("Content-Range"); resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file may already be whole, if it was downloaded but not renamed.
+		// Otherwise it is not a part of this log, and is downloaded again next time.
+		if contentRange != fmt.Sprintf("bytes */%d", offset) {
+			os.Remove(part)
+			return fmt.Errorf("GET %s: %s", r.url(rel), resp.Status)
+		}
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("GET %s: unexpected range %s", r.url(rel), contentRange)
+		}
+		flags |= os.O_APPEND
+	default:
+		// the server ignored the range, so the log is downloaded from the start.
+		flags |= os.O_TRUNC
+	}
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		f, err := os.OpenFile(part, flags, 0664)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, resp.Body)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(part, modified, modified)
+	}
+	return os.Rename(part, local)
+}
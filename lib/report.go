@@ -0,0 +1,430 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// number of most expensive files listed in a run report.
+const reportTopFiles = 10
+
+// TaskUsage holds the resources used by the filter process of a single log file.
+type TaskUsage struct {
+	LogFile    string
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64 // peak resident memory in bytes, 0 if unknown on this platform.
+}
+
+// returns the total CPU time used by the task.
+func (u TaskUsage) CPUTime() time.Duration {
+	return u.UserTime + u.SystemTime
+}
+
+// returns the resources used by the finished process that filtered logFile.
+func UsageOf(logFile string, state *os.ProcessState) TaskUsage {
+	return TaskUsage{
+		LogFile:    logFile,
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
+
+// CorruptFile is a source log that could not be decompressed, in full or in part.
+type CorruptFile struct {
+	LogFile string
+	Err     error
+}
+
+// StalledTask is a task whose filter neither read input nor wrote output for too long.
+type StalledTask struct {
+	LogFile string
+	Idle    time.Duration
+	State   string // state of the filter process when it was found stalled, see ProcessState.
+	Action  string // action taken, see StallActions.
+}
+
+// RunReport collects what happened during a pull, to summarize once it is done. It is
+// shared by every task of a pull, and is safe for concurrent use.
+type RunReport struct {
+	lock    sync.Mutex
+	Usage   []TaskUsage   // resources used by each task that ran a filter process.
+	Corrupt []CorruptFile // source logs that could not be decompressed.
+	Stalled []StalledTask // tasks found stalled, in the order they were found.
+
+	Verified   int           // source logs that matched their checksum sidecar.
+	NoChecksum int           // source logs without a checksum sidecar.
+	Mismatched []CorruptFile // source logs that did not match, or could not be checked against, their sidecar.
+
+	OutsideFileTime int          // source logs skipped for being modified outside the selected file times.
+	Appeared        int          // source logs skipped for appearing after the pull started.
+	Changed         []ChangedLog // source logs that changed while they were read.
+	Late            int          // source logs delivered late, while waiting for them.
+
+	Exhausted   int // tasks run again after running out of resources.
+	Concurrency int // tasks let run at once after running out of resources, 0 if never lowered.
+
+	Schemas          map[string]Schema // schema of each TSV source log, by path.
+	SchemaNormalized bool              // every record was rewritten to the union of the schemas.
+}
+
+// ChangedLog is a source log that changed while it was read, such as one still being written.
+type ChangedLog struct {
+	LogFile     string
+	Reprocessed bool // read again once it had stopped changing, so its output matches it.
+}
+
+// SchemaChange is a source log whose fields differ from those of the log before it.
+type SchemaChange struct {
+	LogFile string
+	Added   []string
+	Removed []string
+}
+
+// adds everything recorded in other to this report.
+func (r *RunReport) Merge(other *RunReport) {
+	other.lock.Lock()
+	usage := append([]TaskUsage(nil), other.Usage...)
+	corrupt := append([]CorruptFile(nil), other.Corrupt...)
+	stalled := append([]StalledTask(nil), other.Stalled...)
+	schemas := make(map[string]Schema)
+	for logFile, schema := range other.Schemas {
+		schemas[logFile] = schema
+	}
+	other.lock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Usage = append(r.Usage, usage...)
+	r.Corrupt = append(r.Corrupt, corrupt...)
+	r.Stalled = append(r.Stalled, stalled...)
+	r.Verified += other.Verified
+	r.NoChecksum += other.NoChecksum
+	r.Mismatched = append(r.Mismatched, other.Mismatched...)
+	r.OutsideFileTime += other.OutsideFileTime
+	r.Appeared += other.Appeared
+	r.Late += other.Late
+	r.Changed = append(r.Changed, other.Changed...)
+	r.addExhausted(other.Exhausted, other.Concurrency)
+	for logFile, schema := range schemas {
+		r.addSchema(logFile, schema)
+	}
+	r.SchemaNormalized = r.SchemaNormalized || other.SchemaNormalized
+}
+
+// records the schema of a source log. JSON logs have none, and are not recorded.
+func (r *RunReport) AddSchema(logFile string, schema Schema) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.addSchema(logFile, schema)
+}
+
+func (r *RunReport) addSchema(logFile string, schema Schema) {
+	if schema.Empty() {
+		return
+	}
+	if r.Schemas == nil {
+		r.Schemas = make(map[string]Schema)
+	}
+	r.Schemas[logFile] = schema
+}
+
+// returns every source log whose fields differ from those of the log of the same type before
+// it, in the order of their paths, which is the order of their dates and hours.
+func (r *RunReport) SchemaChanges() (changes []SchemaChange) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var logFiles []string
+	for logFile := range r.Schemas {
+		logFiles = append(logFiles, logFile)
+	}
+	sort.Strings(logFiles)
+	previous := make(map[string]Schema) // last schema seen of each log type
+	for _, logFile := range logFiles {
+		logType, current := logTypeOf(logFile), r.Schemas[logFile]
+		if last, ok := previous[logType]; ok {
+			added, removed := current.Missing(last), last.Missing(current)
+			if len(added)+len(removed) > 0 {
+				changes = append(changes, SchemaChange{logFile, added, removed})
+			}
+		}
+		previous[logType] = current
+	}
+	return changes
+}
+
+// records a source log skipped for being modified outside the selected file times.
+func (r *RunReport) AddOutsideFileTime(logFile string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.OutsideFileTime++
+}
+
+// records a source log skipped for appearing after the pull started.
+func (r *RunReport) AddAppeared(logFile string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Appeared++
+}
+
+// records a source log delivered late, while waiting for late logs.
+func (r *RunReport) AddLate(logFile string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Late++
+}
+
+// records a source log that changed while it was read, and whether it was read again once it
+// had stopped changing.
+func (r *RunReport) AddChanged(logFile string, reprocessed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Changed = append(r.Changed, ChangedLog{logFile, reprocessed})
+}
+
+// records the result of VerifyChecksum for a source log.
+func (r *RunReport) AddChecksum(logFile string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch {
+	case err == nil:
+		r.Verified++
+	case errors.Is(err, ErrNoChecksum):
+		r.NoChecksum++
+	default:
+		r.Mismatched = append(r.Mismatched, CorruptFile{logFile, err})
+	}
+}
+
+// records a source log that could not be decompressed.
+func (r *RunReport) AddCorrupt(logFile string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Corrupt = append(r.Corrupt, CorruptFile{logFile, err})
+}
+
+// records a task run again after running out of resources, with the number of tasks let
+// run at once since.
+func (r *RunReport) AddExhausted(concurrency int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.addExhausted(1, concurrency)
+}
+
+func (r *RunReport) addExhausted(tasks int, concurrency int) {
+	r.Exhausted += tasks
+	if concurrency > 0 && (r.Concurrency == 0 || concurrency < r.Concurrency) {
+		r.Concurrency = concurrency
+	}
+}
+
+// records a task found stalled.
+func (r *RunReport) AddStall(stall StalledTask) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Stalled = append(r.Stalled, stall)
+}
+
+// returns whether any of logFiles was recorded as corrupt.
+func (r *RunReport) anyCorrupt(logFiles []string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, corrupt := range r.Corrupt {
+		for _, logFile := range logFiles {
+			if corrupt.LogFile == logFile {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns the source logs that could not be decompressed, sorted by name.
+func (r *RunReport) CorruptFiles() []CorruptFile {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	corrupt := append([]CorruptFile(nil), r.Corrupt...)
+	sort.Slice(corrupt, func(i, j int) bool {
+		return corrupt[i].LogFile < corrupt[j].LogFile
+	})
+	return corrupt
+}
+
+// records the resources used by a single task.
+func (r *RunReport) AddUsage(usage TaskUsage) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Usage = append(r.Usage, usage)
+}
+
+// returns up to n tasks that used the most CPU time, most expensive first.
+func (r *RunReport) TopUsage(n int) []TaskUsage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	top := append([]TaskUsage(nil), r.Usage...)
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].CPUTime() > top[j].CPUTime()
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// writes a summary of the pull: corrupt source logs, total resources used, and the most
+// expensive files.
+func (r *RunReport) Write(w io.Writer) {
+	if corrupt := r.CorruptFiles(); len(corrupt) > 0 {
+		fmt.Fprint(w, T("report.corrupt", len(corrupt)))
+		for _, c := range corrupt {
+			fmt.Fprintf(w, "  %s: %s\n", c.LogFile, c.Err)
+		}
+	}
+
+	r.lock.Lock()
+	stalled := append([]StalledTask(nil), r.Stalled...)
+	r.lock.Unlock()
+	if len(stalled) > 0 {
+		fmt.Fprint(w, T("report.stalled", len(stalled)))
+		for _, stall := range stalled {
+			fmt.Fprint(w, T("report.stalled.task", stall.LogFile, stall.Idle.Round(time.Second), stall.State, stall.Action))
+		}
+	}
+
+	r.lock.Lock()
+	exhausted, concurrency := r.Exhausted, r.Concurrency
+	r.lock.Unlock()
+	if exhausted > 0 {
+		fmt.Fprint(w, T("report.exhausted", exhausted, concurrency))
+	}
+
+	r.lock.Lock()
+	outsideFileTime, appeared, late := r.OutsideFileTime, r.Appeared, r.Late
+	changed := append([]ChangedLog(nil), r.Changed...)
+	verified, noChecksum := r.Verified, r.NoChecksum
+	mismatched := append([]CorruptFile(nil), r.Mismatched...)
+	r.lock.Unlock()
+	if outsideFileTime > 0 {
+		fmt.Fprint(w, T("report.filetime", outsideFileTime))
+	}
+	if appeared > 0 {
+		fmt.Fprint(w, T("report.appeared", appeared))
+	}
+	if late > 0 {
+		fmt.Fprint(w, T("report.late", late))
+	}
+	if len(changed) > 0 {
+		fmt.Fprint(w, T("report.changed", len(changed)))
+		sort.Slice(changed, func(i, j int) bool {
+			return changed[i].LogFile < changed[j].LogFile
+		})
+		for _, c := range changed {
+			status := T("report.changed.flagged")
+			if c.Reprocessed {
+				status = T("report.changed.reprocessed")
+			}
+			fmt.Fprintf(w, "  %s: %s\n", c.LogFile, status)
+		}
+	}
+	if verified+noChecksum+len(mismatched) > 0 {
+		fmt.Fprint(w, T("report.checksums", verified, noChecksum, len(mismatched)))
+		sort.Slice(mismatched, func(i, j int) bool {
+			return mismatched[i].LogFile < mismatched[j].LogFile
+		})
+		for _, m := range mismatched {
+			fmt.Fprintf(w, "  %s: %s\n", m.LogFile, m.Err)
+		}
+	}
+
+	if changes := r.SchemaChanges(); len(changes) > 0 {
+		fmt.Fprint(w, T("report.schemadrift", len(changes)))
+		for _, change := range changes {
+			var fields []string
+			for _, field := range change.Added {
+				fields = append(fields, "+"+field)
+			}
+			for _, field := range change.Removed {
+				fields = append(fields, "-"+field)
+			}
+			fmt.Fprintf(w, "  %s %s: %s\n", outputFileDate.FindString(change.LogFile), filepath.Base(change.LogFile), strings.Join(fields, " "))
+		}
+		r.lock.Lock()
+		normalized := r.SchemaNormalized
+		r.lock.Unlock()
+		if normalized {
+			fmt.Fprint(w, T("report.schemadrift.normalized"))
+		} else {
+			fmt.Fprint(w, T("report.schemadrift.hint"))
+		}
+	}
+
+	r.lock.Lock()
+	var user, system time.Duration
+	var peak int64
+	for _, usage := range r.Usage {
+		user += usage.UserTime
+		system += usage.SystemTime
+		if usage.MaxRSS > peak {
+			peak = usage.MaxRSS
+		}
+	}
+	tasks := len(r.Usage)
+	r.lock.Unlock()
+
+	if tasks == 0 {
+		return
+	}
+	fmt.Fprint(w, T("report.usage", tasks, user.Round(time.Millisecond), system.Round(time.Millisecond), FormatBytes(peak)))
+	fmt.Fprint(w, T("report.top", reportTopFiles))
+	for _, usage := range r.TopUsage(reportTopFiles) {
+		fmt.Fprintf(w, "  %10s  %8s  %s\n", usage.CPUTime().Round(time.Millisecond), FormatBytes(usage.MaxRSS), usage.LogFile)
+	}
+}
+
+// FormatBytes formats a size in bytes for humans, such as 12.3 MiB.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseByteSize parses a size such as 500G, 1.5T or 800MiB into bytes. Units are powers of
+// 1024, as FormatBytes writes them, in either case, and a size without one is in bytes.
+func ParseByteSize(size string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(size))
+	for _, suffix := range []string{"IB", "B"} {
+		if strings.HasSuffix(number, suffix) {
+			number = strings.TrimSuffix(number, suffix)
+			break
+		}
+	}
+	multiplier := 1.0
+	if number != "" {
+		if exp := strings.IndexByte("KMGTPE", number[len(number)-1]); exp >= 0 {
+			multiplier = math.Pow(1024, float64(exp+1))
+			number = number[:len(number)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || value*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf("%q is not a size such as 500G", size)
+	}
+	return int64(value * multiplier), nil
+}
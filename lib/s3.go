@@ -0,0 +1,395 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outputs can be uploaded to S3, or an S3 compatible store such as MinIO, as a pull finishes
+// each, and the rest once it is done. Requests are signed with AWS Signature Version 4, with the payload left unsigned so
+// each output is streamed from disk rather than read twice. Objects are addressed by path,
+// as endpoint/bucket/key, which both AWS and MinIO serve.
+
+// DefaultS3Region is the region requests are signed for, unless the config file or
+// environment sets one.
+const DefaultS3Region = "us-east-1"
+
+// DefaultS3PartSize is the size of the parts of the multipart uploads of outputs larger than
+// it. S3 takes at most 5 GiB in a single upload.
+const DefaultS3PartSize = 256 << 20
+
+// payload hash of requests whose body is not signed, so it can be streamed.
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Target is where outputs are uploaded to, given as s3://bucket/prefix/.
+type S3Target struct {
+	Bucket string
+	Prefix string // key prefix, ending in / unless empty
+}
+
+// ParseS3Target parses an s3://bucket/prefix/ URL. The prefix is optional.
+func ParseS3Target(target string) (t S3Target, err error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "s3" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return t, fmt.Errorf("%s is not an s3://bucket/prefix/ URL", target)
+	}
+	t.Bucket, t.Prefix = u.Host, strings.TrimPrefix(u.Path, "/")
+	if t.Prefix != "" && !strings.HasSuffix(t.Prefix, "/") {
+		t.Prefix += "/"
+	}
+	return t, nil
+}
+
+// returns the target as an s3:// URL.
+func (t S3Target) String() string {
+	return "s3://" + t.Bucket + "/" + t.Prefix
+}
+
+// S3Client uploads objects to S3, or an S3 compatible store, with static credentials.
+type S3Client struct {
+	Endpoint        string // such as http://minio:9000, or empty for AWS in Region
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // only for temporary credentials
+	PartSize        int64  // DefaultS3PartSize if 0
+}
+
+// WithEnv returns c with the settings of the standard AWS environment variables, where they
+// are set, in place of its own: AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL), AWS_REGION (or
+// AWS_DEFAULT_REGION), AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func (c S3Client) WithEnv() S3Client {
+	for _, setting := range []struct {
+		value *string
+		names []string
+	}{
+		{&c.Endpoint, []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"}},
+		{&c.Region, []string{"AWS_REGION", "AWS_DEFAULT_REGION"}},
+		{&c.AccessKeyID, []string{"AWS_ACCESS_KEY_ID"}},
+		{&c.SecretAccessKey, []string{"AWS_SECRET_ACCESS_KEY"}},
+		{&c.SessionToken, []string{"AWS_SESSION_TOKEN"}},
+	} {
+		for _, name := range setting.names {
+			if value := os.Getenv(name); value != "" {
+				*setting.value = value
+				break
+			}
+		}
+	}
+	return c
+}
+
+// returns the region requests are signed for.
+func (c S3Client) region() string {
+	if c.Region == "" {
+		return DefaultS3Region
+	}
+	return c.Region
+}
+
+// returns the URL of the object key in bucket, with query appended if not empty.
+func (c S3Client) objectURL(bucket string, key string, query url.Values) string {
+	endpoint := strings.TrimSuffix(c.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + c.region() + ".amazonaws.com"
+	}
+	u := endpoint + "/" + s3Escape(bucket+"/"+key)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// escapes path as SigV4 canonical URIs are, every byte but unreserved ones and / encoded.
+func s3Escape(path string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(path) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || strings.IndexByte("-._~/", b) >= 0 {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Sign signs req with AWS Signature Version 4 for S3 as of t, over the host and every header
+// already set on it, with payloadHash as the hex SHA-256 of its body, or UNSIGNED-PAYLOAD.
+func (c S3Client) Sign(req *http.Request, payloadHash string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// query values are encoded as SigV4 asks, with spaces as %20 rather than +.
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	canonical := strings.Join([]string{req.Method, s3Escape(req.URL.Path), query, canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := amzDate[:8] + "/" + c.region() + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], c.region(), "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// sends a signed request for the object key in bucket, with size bytes of body, and returns
+// the response if S3 accepted it. Its body is then for the caller to close.
+func (c S3Client) do(method string, bucket string, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	if body != nil && size == 0 {
+		// an empty body of unknown length would be sent chunked, which S3 refuses.
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, c.objectURL(bucket, key, query), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	payloadHash := s3UnsignedPayload
+	if body == nil {
+		empty := sha256.Sum256(nil)
+		payloadHash = hex.EncodeToString(empty[:])
+	} else if buffered, ok := body.(*bytes.Reader); ok {
+		// small bodies, such as the list of parts, are signed.
+		content, _ := ioutil.ReadAll(buffered)
+		buffered.Seek(0, io.SeekStart)
+		hash := sha256.Sum256(content)
+		payloadHash = hex.EncodeToString(hash[:])
+	}
+	c.Sign(req, payloadHash, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("s3 answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
+
+// PutFile uploads the file at path to the object key in bucket. Files larger than the part
+// size are uploaded in parts, and the upload is aborted if a part fails.
+func (c S3Client) PutFile(bucket string, key string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	partSize := c.PartSize
+	if partSize <= 0 {
+		partSize = DefaultS3PartSize
+	}
+	if info.Size() <= partSize {
+		resp, err := c.do(http.MethodPut, bucket, key, nil, f, info.Size())
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	return c.putParts(bucket, key, f, info.Size(), partSize)
+}
+
+// the XML bodies of multipart uploads.
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+type s3CompletePart struct {
+	PartNumber int
+	ETag       string
+}
+type s3CompleteUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+// uploads the size bytes of f to the object key in bucket in parts of partSize.
+func (c S3Client) putParts(bucket string, key string, f *os.File, size int64, partSize int64) (err error) {
+	resp, err := c.do(http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil, 0)
+	if err != nil {
+		return err
+	}
+	var initiated s3InitiateResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3 did not start the upload of %s: %v", key, err)
+	}
+	defer func() {
+		if err != nil {
+			if resp, abortErr := c.do(http.MethodDelete, bucket, key, url.Values{"uploadId": {initiated.UploadID}}, nil, 0); abortErr == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	var complete s3CompleteUpload
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		length := partSize
+		if size-offset < length {
+			length = size - offset
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}
+		resp, err := c.do(http.MethodPut, bucket, key, query, io.NewSectionReader(f, offset, length), length)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", number, err)
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, s3CompletePart{number, resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err = c.do(http.MethodPost, bucket, key, url.Values{"uploadId": {initiated.UploadID}}, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// a completion that fails once started is answered with 200, and the error in the body.
+	answer, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if bytes.Contains(answer, []byte("<Error>")) {
+		return fmt.Errorf("s3 did not complete the upload of %s: %s", key, bytes.TrimSpace(answer))
+	}
+	return nil
+}
+
+// Uploader uploads the outputs under a directory to a target, keyed by the prefix of the
+// target, the name of the directory, and their path under it, such as
+// prefix/conn-pull/conn-2021-06-01.json. Outputs can be uploaded as soon as each is final, with
+// DayDone, so a pull need not hold all of them on disk at once, and the rest once the pull is
+// done, with Finish. Safe for concurrent use.
+type Uploader struct {
+	Client S3Client
+	Target S3Target
+	Dir    string
+	Remove bool // remove each file once uploaded, and the directories left empty by Finish
+	// with Remove, files uploaded before Finish are only removed by it, such as when a report
+	// of the outputs is rendered from them once the pull is done.
+	KeepUntilFinish bool
+
+	lock     sync.Mutex
+	uploaded map[string]bool // files uploaded, so Finish does not upload them again
+}
+
+// uploads file, under the directory of u, and removes it once uploaded if remove is set.
+func (u *Uploader) upload(file string, remove bool) error {
+	rel, err := filepath.Rel(u.Dir, file)
+	if err != nil {
+		return err
+	}
+	key := u.Target.Prefix + path.Join(filepath.Base(u.Dir), filepath.ToSlash(rel))
+	if err = u.Client.PutFile(u.Target.Bucket, key, file); err != nil {
+		return fmt.Errorf("upload %s to %s: %w", file, u.Target.String()+strings.TrimPrefix(key, u.Target.Prefix), err)
+	}
+	u.lock.Lock()
+	if u.uploaded == nil {
+		u.uploaded = map[string]bool{}
+	}
+	u.uploaded[file] = true
+	u.lock.Unlock()
+	if remove {
+		return os.Remove(file)
+	}
+	return nil
+}
+
+// DayDone uploads the output of a date as soon as it is final, as RuntimeConfig.OnDayDone. An
+// output that fails to upload is kept, for Finish to upload again, and report if it fails.
+func (u *Uploader) DayDone(date time.Time, outputFile string) {
+	u.upload(outputFile, u.Remove && !u.KeepUntilFinish)
+}
+
+// Finish uploads every file under the directory of u not uploaded yet. Hidden files, such as
+// partial outputs and checkpoints, are left out. With Remove, the files uploaded are removed,
+// then the directories left empty, the directory of u included. Returns the number of files
+// uploaded, by DayDone as well.
+func (u *Uploader) Finish() (uploaded int, err error) {
+	var dirs []string
+	err = filepath.Walk(u.Dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			dirs = append(dirs, file)
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") || !info.Mode().IsRegular() {
+			return nil
+		}
+		u.lock.Lock()
+		done := u.uploaded[file]
+		u.lock.Unlock()
+		if done {
+			if u.Remove {
+				return os.Remove(file)
+			}
+			return nil
+		}
+		return u.upload(file, u.Remove)
+	})
+	u.lock.Lock()
+	uploaded = len(u.uploaded)
+	u.lock.Unlock()
+	if err != nil {
+		return uploaded, err
+	}
+	if u.Remove {
+		// deepest first, so parents are empty by the time they are reached. Those holding hidden
+		// files are kept.
+		for i := len(dirs) - 1; i >= 0; i-- {
+			os.Remove(dirs[i])
+		}
+	}
+	return uploaded, nil
+}
@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// zeek writes a field that is not set as this, in TSV logs.
+const unsetField = "-"
+
+// Schema is the set of fields of a zeek TSV log, from its #fields and #types headers. JSON
+// logs describe themselves, and have an empty schema.
+type Schema struct {
+	Fields []string
+	Types  []string
+}
+
+// returns true if the schema has no fields, such as for a JSON log.
+func (s Schema) Empty() bool {
+	return len(s.Fields) == 0
+}
+
+// returns true if both schemas have the same fields, in the same order.
+func (s Schema) Equal(other Schema) bool {
+	return strings.Join(s.Fields, "\t") == strings.Join(other.Fields, "\t")
+}
+
+// returns the fields of s missing from other.
+func (s Schema) Missing(other Schema) (missing []string) {
+	has := make(map[string]bool)
+	for _, field := range other.Fields {
+		has[field] = true
+	}
+	for _, field := range s.Fields {
+		if !has[field] {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// type of a zeek log, such as dns of dns.00:00:00-01:00:00.log.gz or worker-01.dns.00:00:00-01:00:00.log.gz.
+var logTypeName = regexp.MustCompile(`([^.]+)\.\d{2}:\d{2}:\d{2}-`)
+
+// returns the type of the zeek log at logFile, or its name if it is not named like one.
+func logTypeOf(logFile string) string {
+	if match := logTypeName.FindStringSubmatch(filepath.Base(logFile)); match != nil {
+		return match[1]
+	}
+	return filepath.Base(logFile)
+}
+
+// reads the schema from the headers of the compressed log at logFile. Only the headers are read.
+func ReadSchema(logFile string) (schema Schema, err error) {
+	f, err := os.Open(logFile)
+	if err != nil {
+		return schema, err
+	}
+	defer f.Close()
+	checked, err := NewCheckedReader(f)
+	if err != nil {
+		return schema, err
+	}
+	defer checked.Close()
+
+	reader := bufio.NewReader(checked)
+	for {
+		line, err := reader.ReadString('\n')
+		if !strings.HasPrefix(line, "#") {
+			// the headers are over, or this is not a TSV log.
+			return schema, nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "#fields\t") {
+			schema.Fields = strings.Split(line, "\t")[1:]
+		} else if strings.HasPrefix(line, "#types\t") {
+			schema.Types = strings.Split(line, "\t")[1:]
+		}
+		if err == io.EOF {
+			return schema, nil
+		} else if err != nil {
+			return schema, err
+		}
+	}
+}
+
+// returns a schema with every field of the given schemas, in the order they are first seen.
+func UnionSchema(schemas []Schema) (union Schema) {
+	seen := make(map[string]bool)
+	for _, schema := range schemas {
+		for i, field := range schema.Fields {
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			union.Fields = append(union.Fields, field)
+			fieldType := "string"
+			if i < len(schema.Types) {
+				fieldType = schema.Types[i]
+			}
+			union.Types = append(union.Types, fieldType)
+		}
+	}
+	return union
+}
+
+// reads the schema of every log that a pull with rc would read, and returns their union.
+func ScanSchemas(rc RuntimeConfig) (union Schema, err error) {
+	// the logs are only looked at, so nothing is recorded in the report.
+	rc.Report = nil
+	logFiles, err := PullLogs(rc)
+	if err != nil {
+		return union, err
+	}
+	var schemas []Schema
+	for _, logFile := range logFiles {
+		// unreadable logs are reported by the pull itself.
+		if schema, err := ReadSchema(logFile); err == nil {
+			schemas = append(schemas, schema)
+		}
+	}
+	return UnionSchema(schemas), nil
+}
+
+// returns a writer that rewrites TSV records (lines) written to it from the from schema to the
+// to schema before passing them to w: fields are moved to their column in to, and fields
+// missing from from are left unset. JSON records, and records that do not match from, are
+// passed through as they are. Close must be called to write a final record without a
+// trailing newline.
+func NewSchemaWriter(w io.Writer, from Schema, to Schema) io.WriteCloser {
+	if from.Empty() || from.Equal(to) {
+		return nopWriteCloser{w}
+	}
+	sw := &schemaWriter{w: w, from: from, to: to, columns: make([]int, len(to.Fields))}
+	index := make(map[string]int)
+	for i, field := range from.Fields {
+		index[field] = i
+	}
+	for i, field := range to.Fields {
+		if column, ok := index[field]; ok {
+			sw.columns[i] = column
+		} else {
+			sw.columns[i] = -1
+		}
+	}
+	return sw
+}
+
+type schemaWriter struct {
+	w       io.Writer
+	from    Schema
+	to      Schema
+	columns []int  // for each field of to, its column in from, or -1 if from does not have it
+	pending []byte // start of a record whose newline has not been written yet
+}
+
+func (sw *schemaWriter) Write(p []byte) (n int, err error) {
+	sw.pending = append(sw.pending, p...)
+	for {
+		end := bytes.IndexByte(sw.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if _, err = io.WriteString(sw.w, sw.rewrite(string(sw.pending[:end]))+"\n"); err != nil {
+			return 0, err
+		}
+		sw.pending = sw.pending[end+1:]
+	}
+}
+
+func (sw *schemaWriter) Close() error {
+	if len(sw.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(sw.w, sw.rewrite(string(sw.pending)))
+	sw.pending = nil
+	return err
+}
+
+// returns the record rewritten to the to schema.
+func (sw *schemaWriter) rewrite(record string) string {
+	switch {
+	case strings.HasPrefix(record, "#fields\t"):
+		return "#fields\t" + strings.Join(sw.to.Fields, "\t")
+	case strings.HasPrefix(record, "#types\t"):
+		return "#types\t" + strings.Join(sw.to.Types, "\t")
+	case strings.HasPrefix(record, "#") || strings.HasPrefix(record, "{"):
+		return record
+	}
+	values := strings.Split(record, "\t")
+	if len(values) != len(sw.from.Fields) {
+		return record
+	}
+	rewritten := make([]string, len(sw.columns))
+	for i, column := range sw.columns {
+		rewritten[i] = unsetField
+		if column >= 0 {
+			rewritten[i] = values[column]
+		}
+	}
+	return strings.Join(rewritten, "\t")
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SelfTestArg is the arg a script is run with to test itself, see SelfTestScript.
+const SelfTestArg = "--self-test"
+
+// SelfTestTimeout is how long a script is given to pass its self-test.
+const SelfTestTimeout = 30 * time.Second
+
+// a line of the comments at the top of a script listing the commands it runs, such as
+// # requires: jq, grepcidr
+var scriptRequires = regexp.MustCompile(`^#\s*requires:(.*)$`)
+
+// WriteScript writes an inline filter script, such as one read from stdin or given in a
+// playbook, to a new temp file only its owner can read, write or run, and returns its path,
+// to run as a command. The script must start with a #! line naming its interpreter. The
+// caller removes the file once done with it.
+func WriteScript(script []byte) (path string, err error) {
+	if len(bytes.TrimSpace(script)) == 0 {
+		return "", errors.New(T("error.script.empty"))
+	}
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		return "", errors.New(T("error.script.shebang"))
+	}
+	f, err := ioutil.TempFile("", "nagini-script-")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(script)
+	if err == nil {
+		err = f.Chmod(0700)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// CheckScript returns the problems that would fail every run of the script at path, found
+// before any is started: an interpreter named by its #! line that does not exist, or a
+// command listed by a "# requires:" line of the comments at its top that is not in PATH.
+// Executables that are not scripts, and files that cannot be read, have none.
+func CheckScript(path string) (problems []error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), "#!") {
+		return nil
+	}
+	if interpreter := scriptInterpreter(lines.Text()); interpreter == "" {
+		problems = append(problems, errors.New(T("error.script.interpreter", path, strings.TrimSpace(lines.Text()))))
+	} else if _, err := exec.LookPath(interpreter); err != nil {
+		problems = append(problems, errors.New(T("error.script.interpreter", path, interpreter)))
+	}
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		match := scriptRequires.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		for _, command := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if _, err := exec.LookPath(command); err != nil {
+				problems = append(problems, errors.New(T("error.script.requires", path, command)))
+			}
+		}
+	}
+	return problems
+}
+
+// returns the interpreter the #! line of a script runs it with, such as /bin/sh, or python3
+// for #!/usr/bin/env python3, or "" if there is none.
+func scriptInterpreter(shebang string) string {
+	fields := strings.Fields(strings.TrimPrefix(shebang, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	if filepath.Base(fields[0]) != "env" {
+		return fields[0]
+	}
+	// env takes flags, such as -S, and variables to set before the command.
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+			return field
+		}
+	}
+	return fields[0]
+}
+
+// SelfTestScript runs the script at path with SelfTestArg and no input, and returns an error
+// with the last line it wrote if it fails, or does not finish within SelfTestTimeout.
+func SelfTestScript(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SelfTestTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, SelfTestArg).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	reason := err.Error()
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if ctx.Err() != nil {
+		reason = T("script.timeout", SelfTestTimeout)
+	} else if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		reason = strings.TrimSuffix(last, ".")
+	}
+	return errors.New(T("error.script.selftest", path, SelfTestArg, reason))
+}
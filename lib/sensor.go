@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SensorConfig names the sensor, and optionally the site, of the logs under Path. Set in the
+// global config as a list under sensors.
+type SensorConfig struct {
+	Name string `yaml:"name" mapstructure:"name"` // name
+	Site string `yaml:"site" mapstructure:"site"` // site
+	Path string `yaml:"path" mapstructure:"path"` // path: log directory of the sensor
+
+	// clock_offset: how far ahead of true time the clock of the sensor runs, such as 47m, or
+	// behind if negative. Pulls of its logs read them by the hours of their time range in its
+	// clock, and can correct the ts of its records, see NewClockReader.
+	ClockOffset time.Duration `yaml:"clock_offset" mapstructure:"clock_offset"`
+}
+
+// worker prefix of a per-worker cluster log, such as worker-01 of worker-01.dns.00:00:00-01:00:00.log.gz.
+var workerPrefix = regexp.MustCompile(`^(.+)\.[^.]+\.\d{2}:\d{2}:\d{2}-`)
+
+// date directory of a zeek archive.
+var dateDirName = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// returns the sensor that logFile came from: the configured sensor with the longest path
+// holding it, otherwise the cluster worker that wrote it, otherwise the name of the log
+// directory holding its date directory (or of its parent, if that is just called logs).
+func SensorOf(logFile string, sensors []SensorConfig) (sensor SensorConfig) {
+	for _, candidate := range sensors {
+		rel, err := filepath.Rel(candidate.Path, logFile)
+		if err == nil && !strings.HasPrefix(rel, "..") && len(candidate.Path) > len(sensor.Path) {
+			sensor = candidate
+		}
+	}
+	if sensor.Name != "" {
+		return sensor
+	}
+
+	// walk up to the date directory, noting a directory per worker on the way.
+	dir, worker := filepath.Dir(logFile), ""
+	if match := workerPrefix.FindStringSubmatch(filepath.Base(logFile)); match != nil {
+		worker = match[1]
+	}
+	if !dateDirName.MatchString(filepath.Base(dir)) && dateDirName.MatchString(filepath.Base(filepath.Dir(dir))) {
+		worker = filepath.Base(dir)
+		dir = filepath.Dir(dir)
+	}
+	if worker != "" {
+		return SensorConfig{Name: worker}
+	}
+	logDir := filepath.Dir(dir)
+	if filepath.Base(logDir) == "logs" {
+		logDir = filepath.Dir(logDir)
+	}
+	return SensorConfig{Name: filepath.Base(logDir)}
+}
+
+// returns a writer that adds a sensor field, and a site field if the sensor has one, to
+// every record (line) written to it before passing it to w. JSON records get the fields as
+// keys, and zeek TSV records as extra columns, named in the #fields header. Close must be
+// called to write a final record without a trailing newline.
+func NewSensorWriter(w io.Writer, sensor SensorConfig) io.WriteCloser {
+	sw := &sensorWriter{w: w}
+	names, values := []string{"sensor"}, []string{sensor.Name}
+	if sensor.Site != "" {
+		names, values = append(names, "site"), append(values, sensor.Site)
+	}
+	for i := range names {
+		name, _ := json.Marshal(names[i])
+		value, _ := json.Marshal(values[i])
+		sw.jsonFields = append(sw.jsonFields, string(name)+":"+string(value))
+	}
+	sw.tsvFields = "\t" + strings.Join(names, "\t")
+	sw.tsvTypes = strings.Repeat("\tstring", len(names))
+	sw.tsvValues = "\t" + strings.Join(values, "\t")
+	return sw
+}
+
+type sensorWriter struct {
+	w          io.Writer
+	jsonFields []string
+	tsvFields  string // appended to the #fields header
+	tsvTypes   string // appended to the #types header
+	tsvValues  string // appended to every record
+	pending    []byte // start of a record whose newline has not been written yet
+}
+
+func (sw *sensorWriter) Write(p []byte) (n int, err error) {
+	sw.pending = append(sw.pending, p...)
+	for {
+		end := bytes.IndexByte(sw.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		if _, err = io.WriteString(sw.w, sw.tag(string(sw.pending[:end]))+"\n"); err != nil {
+			return 0, err
+		}
+		sw.pending = sw.pending[end+1:]
+	}
+}
+
+func (sw *sensorWriter) Close() error {
+	if len(sw.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(sw.w, sw.tag(string(sw.pending)))
+	sw.pending = nil
+	return err
+}
+
+// returns the record with the sensor fields added.
+func (sw *sensorWriter) tag(record string) string {
+	record = strings.TrimSuffix(record, "\r")
+	trimmed := strings.TrimSpace(record)
+	switch {
+	case trimmed == "":
+		return record
+	case strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}"):
+		body := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+		fields := strings.Join(sw.jsonFields, ",")
+		if body == "" {
+			return "{" + fields + "}"
+		}
+		return "{" + body + "," + fields + "}"
+	case strings.HasPrefix(record, "#fields"):
+		return record + sw.tsvFields
+	case strings.HasPrefix(record, "#types"):
+		return record + sw.tsvTypes
+	case strings.HasPrefix(record, "#"):
+		return record
+	default:
+		return record + sw.tsvValues
+	}
+}
@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a session is every record of a single connection, grouped by its zeek uid across conn and
+// app-layer logs.
+type session struct {
+	uid     string
+	records map[string][]interface{} // records of each log type, in the order they were logged.
+	start   float64                  // earliest ts of its records, to order sessions by.
+}
+
+// ReassembleSessions groups the records of the given log types over the time range of rc by
+// their zeek uid, one day at a time, and writes the sessions of each day that has any to the
+// writer returned by dayOut for the first hour pulled of the day, as a JSON object per
+// session, in order of their earliest record. Records without a uid, such as those of dhcp
+// logs, are left out. Returns the number of sessions written. Corrupt logs are recorded in rc.Report, if set, and skipped.
+func ReassembleSessions(rc RuntimeConfig, logTypes []string, dayOut func(day time.Time) (io.WriteCloser, error)) (written int, err error) {
+	for _, day := range pullDays(rc) {
+		dayRC := rc
+		dayRC.StartTime, dayRC.EndTime = day.Start, day.End
+		sessions, err := daySessions(dayRC, logTypes)
+		if err != nil {
+			return written, err
+		}
+		if len(sessions) == 0 {
+			continue
+		}
+		out, err := dayOut(day.Start)
+		if err != nil {
+			return written, err
+		}
+		buffered := bufio.NewWriter(out)
+		for _, s := range sessions {
+			if err = writeSession(buffered, s, logTypes); err != nil {
+				out.Close()
+				return written, err
+			}
+			written++
+		}
+		if err = buffered.Flush(); err != nil {
+			out.Close()
+			return written, err
+		}
+		if err = out.Close(); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// returns the sessions of the logs of a single day, in order of their earliest record. Logs
+// are read several at a time, and their records added in the order of the logs.
+func daySessions(rc RuntimeConfig, logTypes []string) (sessions []*session, err error) {
+	type sessionLog struct {
+		logType string
+		logFile string
+	}
+	var logs []sessionLog
+	for _, logType := range logTypes {
+		rc.LogType = logType
+		logFiles, err := PullLogs(rc)
+		if err != nil {
+			return nil, err
+		}
+		for _, logFile := range logFiles {
+			logs = append(logs, sessionLog{logType, logFile})
+		}
+	}
+
+	records := make([][]map[string]interface{}, len(logs))
+	errs := make([]error, len(logs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	threads := rc.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				records[i], errs[i] = logRecords(logs[i].logFile, rc.Report)
+			}
+		}()
+	}
+	for i := range logs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	byUID := make(map[string]*session)
+	for i, log := range logs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, record := range records[i] {
+			uid, ok := record["uid"].(string)
+			if !ok || uid == "" {
+				continue
+			}
+			s, seen := byUID[uid]
+			if !seen {
+				s = &session{uid: uid, records: make(map[string][]interface{}), start: sessionTime(record)}
+				byUID[uid] = s
+				sessions = append(sessions, s)
+			}
+			s.records[log.logType] = append(s.records[log.logType], record)
+			if start := sessionTime(record); start < s.start {
+				s.start = start
+			}
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].start != sessions[j].start {
+			return sessions[i].start < sessions[j].start
+		}
+		return sessions[i].uid < sessions[j].uid
+	})
+	return sessions, nil
+}
+
+// returns the records of a single log, with their values as they were logged.
+func logRecords(logFile string, report *RunReport) (records []map[string]interface{}, err error) {
+	f, err := os.Open(logFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	checked, err := NewCheckedReader(f)
+	if err != nil {
+		if report != nil {
+			report.AddCorrupt(logFile, err)
+		}
+		return nil, nil
+	}
+	defer checked.Close()
+
+	reader := bufio.NewReader(checked)
+	var fields []string
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if decoded, ok := decodeRecord(bytes.TrimRight(line, "\r\n"), &fields); ok {
+			if record, isObject := decoded.(map[string]interface{}); isObject {
+				records = append(records, record)
+			}
+		}
+		// a log that ends early is corrupt, and is recorded below.
+		if readErr != nil {
+			break
+		}
+	}
+	if checked.Err != nil && report != nil {
+		report.AddCorrupt(logFile, checked.Err)
+	}
+	return records, nil
+}
+
+// returns the ts of a record as seconds since the epoch, whether logged as a number or as an
+// ISO 8601 time, or 0 if it has none.
+func sessionTime(record map[string]interface{}) float64 {
+	ts := sqlString(record["ts"])
+	if seconds, err := strconv.ParseFloat(ts, 64); err == nil {
+		return seconds
+	}
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		return float64(t.UnixNano()) / float64(time.Second)
+	}
+	return 0
+}
+
+// writes a session as a JSON object on a line of its own: its uid, then an array of the
+// records of each of the log types that it has records of. Values are written as they were
+// logged, without escaping HTML.
+func writeSession(w *bufio.Writer, s *session, logTypes []string) error {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoded.WriteString(`{"uid":`)
+	encoder.Encode(s.uid)
+	for _, logType := range logTypes {
+		records, ok := s.records[logType]
+		if !ok {
+			continue
+		}
+		// the encoder ends every value with a newline, which is replaced by what follows it.
+		encoded.Truncate(encoded.Len() - 1)
+		encoded.WriteByte(',')
+		encoder.Encode(logType)
+		encoded.Truncate(encoded.Len() - 1)
+		encoded.WriteByte(':')
+		if err := encoder.Encode(records); err != nil {
+			return err
+		}
+	}
+	encoded.Truncate(encoded.Len() - 1)
+	encoded.WriteString("}\n")
+	_, err := w.Write(encoded.Bytes())
+	return err
+}
@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// shippers a config can be generated for by RenderShipperConfig.
+const (
+	ShipperVector  = "vector"
+	ShipperFluentd = "fluentd"
+)
+
+// sinks a shipper config can forward outputs to.
+const (
+	SinkElasticsearch = "elasticsearch"
+	SinkHTTP          = "http"
+	SinkKafka         = "kafka"
+	SinkConsole       = "console"
+)
+
+// returns the shippers a config can be generated for, in the order they are documented.
+func Shippers() []string {
+	return []string{ShipperVector, ShipperFluentd}
+}
+
+// returns the sinks a shipper config can forward to, in the order they are documented.
+func ShipperSinks() []string {
+	return []string{SinkElasticsearch, SinkHTTP, SinkKafka, SinkConsole}
+}
+
+// ShipperConfig describes a config for a log shipper that reads the JSON outputs of pulls and
+// forwards each record to a sink.
+type ShipperConfig struct {
+	Shipper  string // ShipperVector or ShipperFluentd
+	Dir      string // absolute directory the output directories of pulls are created in, or one of them
+	LogType  string // only ship the outputs of this log type, or every output if empty
+	Sink     string // one of ShipperSinks
+	Endpoint string // URL of the sink, or its brokers for kafka. Unused by console
+	Target   string // index or topic to write to, where the sink has one
+}
+
+// returns the globs matching the outputs of c under its directory, at any depth. They match
+// the output of each date, and the single file of --concat, but not the partial names of
+// outputs being written with --manifest, nor the manifest itself.
+func (c ShipperConfig) Include() []string {
+	if c.LogType == "" {
+		return []string{filepath.Join(c.Dir, "**", "*.json")}
+	}
+	return []string{
+		filepath.Join(c.Dir, "**", c.LogType+"-*.json"),
+		filepath.Join(c.Dir, "**", c.LogType+".json"),
+	}
+}
+
+// returns the globs of files under the directory of c that match Include but are not outputs,
+// the provenance sidecars written next to them.
+func (c ShipperConfig) Exclude() []string {
+	return []string{filepath.Join(c.Dir, "**", "*"+ProvenanceExtension)}
+}
+
+// strings are quoted as JSON, which TOML reads as is.
+var vectorTemplate = template.Must(template.New("vector").Funcs(manifestFuncs).Parse(`# ships the outputs of nagini pulls under {{ .Dir }}.
+[sources.nagini]
+type = "file"
+include = [{{ range $i, $glob := .Include }}{{ if $i }}, {{ end }}{{ quote $glob }}{{ end }}]
+exclude = [{{ range $i, $glob := .Exclude }}{{ if $i }}, {{ end }}{{ quote $glob }}{{ end }}]
+read_from = "beginning"
+
+[transforms.nagini_records]
+type = "remap"
+inputs = ["nagini"]
+source = '''
+file = .file
+. = parse_json!(string!(.message))
+.nagini_file = file
+'''
+
+[sinks.nagini_out]
+inputs = ["nagini_records"]
+{{- if eq .Sink "elasticsearch" }}
+type = "elasticsearch"
+endpoints = [{{ quote .Endpoint }}]
+bulk.index = {{ quote .Target }}
+{{- else if eq .Sink "http" }}
+type = "http"
+uri = {{ quote .Endpoint }}
+encoding.codec = "json"
+{{- else if eq .Sink "kafka" }}
+type = "kafka"
+bootstrap_servers = {{ quote .Endpoint }}
+topic = {{ quote .Target }}
+encoding.codec = "json"
+{{- else }}
+type = "console"
+encoding.codec = "json"
+{{- end }}
+`))
+
+var fluentdTemplate = template.Must(template.New("fluentd").Funcs(template.FuncMap{"join": strings.Join}).Parse(`# ships the outputs of nagini pulls under {{ .Dir }}.
+<source>
+  @type tail
+  path {{ join .Include "," }}
+  exclude_path {{ join .Exclude "," }}
+  pos_file /var/log/fluentd/nagini.pos
+  tag nagini.*
+  read_from_head true
+  path_key nagini_file
+  <parse>
+    @type json
+  </parse>
+</source>
+
+<match nagini.**>
+{{- if eq .Sink "elasticsearch" }}
+  @type elasticsearch
+  hosts {{ .Endpoint }}
+  index_name {{ .Target }}
+{{- else if eq .Sink "http" }}
+  @type http
+  endpoint {{ .Endpoint }}
+  <format>
+    @type json
+  </format>
+{{- else if eq .Sink "kafka" }}
+  @type kafka2
+  brokers {{ .Endpoint }}
+  default_topic {{ .Target }}
+  <format>
+    @type json
+  </format>
+{{- else }}
+  @type stdout
+{{- end }}
+</match>
+`))
+
+// RenderShipperConfig writes the config of c to w, for the shipper it names: a source tailing
+// every output under c.Dir from its beginning, parsing each line as a JSON record with the
+// path of its output added as nagini_file, and a sink forwarding the records.
+func RenderShipperConfig(w io.Writer, c ShipperConfig) error {
+	if c.Shipper == ShipperFluentd {
+		return fluentdTemplate.Execute(w, c)
+	}
+	return vectorTemplate.Execute(w, c)
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SiteFilter drops the records of a log type that a site never wants, such as lookups of
+// checkup domains or connections of internal scanners, before they reach the filter of a
+// pull. Each condition is a SQL condition over the fields of a record, as in a WHERE clause,
+// and records matching any of them are dropped. Records that are kept, and headers, are
+// passed on as they are.
+type SiteFilter struct {
+	conditions []string
+	exprs      []sqlExpr
+}
+
+// returns a filter dropping the records matching any of conditions, from the site_filters of
+// the global config. Returns an error naming the first condition that is not valid.
+func NewSiteFilter(conditions []string) (*SiteFilter, error) {
+	f := &SiteFilter{conditions: conditions}
+	for _, condition := range conditions {
+		expr, err := parseSQLCondition(condition)
+		if err != nil {
+			return nil, fmt.Errorf("site filter %q: %w", condition, err)
+		}
+		f.exprs = append(f.exprs, expr)
+	}
+	return f, nil
+}
+
+// returns the conditions of the filter.
+func (f *SiteFilter) String() string {
+	return strings.Join(f.conditions, "; ")
+}
+
+// whether a record matches any of the conditions. A condition that is unknown, such as on a
+// field the record does not have, does not match.
+func (f *SiteFilter) drops(record map[string]interface{}) bool {
+	for _, expr := range f.exprs {
+		if truth, _ := sqlTruth(expr.eval(sqlRow{record: record})); truth {
+			return true
+		}
+	}
+	return false
+}
+
+// returns a reader of the lines of r other than the records the filter drops, to be closed
+// once done.
+func (f *SiteFilter) Reader(r io.Reader) io.ReadCloser {
+	return &siteFilterReader{f: f, lines: newLineReader(r)}
+}
+
+type siteFilterReader struct {
+	f       *SiteFilter
+	lines   lineReader
+	fields  []string // fields of the last #fields header, for TSV records
+	pending []byte   // rest of the line being read, good until the next is
+	err     error    // error that ended r, once every line before it is read
+}
+
+func (sr *siteFilterReader) Read(p []byte) (n int, err error) {
+	for len(sr.pending) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		var line []byte
+		line, sr.err = sr.lines.next()
+		if record, ok := sqlRecord(bytes.TrimRight(line, "\r\n"), &sr.fields); !ok || !sr.f.drops(record) {
+			sr.pending = line
+		}
+	}
+	n = copy(p, sr.pending)
+	sr.pending = sr.pending[n:]
+	return n, nil
+}
+
+// gives the buffers of the reader back to the pool.
+func (sr *siteFilterReader) Close() error {
+	if sr.lines.reader != nil {
+		sr.lines.close()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// what to do with a log that changes while a pull reads it.
+const (
+	ChangeFlag      = "flag"      // list it in the report.
+	ChangeReprocess = "reprocess" // read it again once, then list it in the report.
+)
+
+// returns the actions for a log that changes while read, in the order they are documented.
+func ChangeActions() []string {
+	return []string{ChangeFlag, ChangeReprocess}
+}
+
+// size and modification time of a log, to tell whether it changed.
+type logState struct {
+	size    int64
+	modTime time.Time
+}
+
+// LogSnapshot is the listing of the logs of a pull taken before reading any of them, so logs
+// that appear or change while an archive is still being written are told apart.
+type LogSnapshot struct {
+	lock sync.Mutex
+	logs map[string]logState
+}
+
+// returns whether the time range of rc includes the current hour, or later, whose logs may
+// still be written or rotated while they are pulled. The hour is that of the clock of the
+// sensor, which writes them.
+func IncludesNow(rc RuntimeConfig) bool {
+	_, end := sensorRange(rc)
+	return end.Add(time.Hour).After(time.Now().Add(rc.ClockOffset))
+}
+
+// lists the logs a pull with rc would read, with their size and modification time.
+func TakeLogSnapshot(rc RuntimeConfig) (*LogSnapshot, error) {
+	// logs skipped for their file times are counted once they are pulled.
+	rc.Report = nil
+	logFiles, err := PullLogs(rc)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &LogSnapshot{logs: make(map[string]logState, len(logFiles))}
+	for _, logFile := range logFiles {
+		if info, err := os.Stat(logFile); err == nil {
+			snapshot.logs[logFile] = logState{info.Size(), info.ModTime()}
+		}
+	}
+	return snapshot, nil
+}
+
+// returns whether the log was listed when the snapshot was taken.
+func (s *LogSnapshot) Listed(logFile string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.logs[logFile]
+	return ok
+}
+
+// returns whether the log has changed size or modification time since it was last seen, or
+// is gone, and remembers it as it is now.
+func (s *LogSnapshot) Changed(logFile string) bool {
+	var current logState
+	if info, err := os.Stat(logFile); err == nil {
+		current = logState{info.Size(), info.ModTime()}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	last := s.logs[logFile]
+	s.logs[logFile] = current
+	return current.size != last.size || !current.modTime.Equal(last.modTime)
+}
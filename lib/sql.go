@@ -0,0 +1,1488 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// formats of the result of a SQL query.
+const (
+	SQLFormatTSV  = "tsv"
+	SQLFormatJSON = "json"
+)
+
+// returns every format a SQL query result can be written in.
+func SQLFormats() []string {
+	return []string{SQLFormatTSV, SQLFormatJSON}
+}
+
+// SQLQuery is a query of the form
+//
+//	SELECT items FROM logtype [WHERE cond] [GROUP BY exprs] [ORDER BY terms] [LIMIT n]
+//
+// run over the records of logs by RunSQL. It is meant for quick counts and breakdowns, so
+// it only knows a small part of SQL: there are no joins, subqueries or HAVING. Fields are
+// named as in the logs, and since zeek names fields like id.orig_h, id_orig_h works too.
+// LIKE is case-insensitive. Selecting a field that is neither grouped by nor aggregated in a
+// grouped query gives its value in the first record of the group. Conditions can also be
+// written with ==, &&, || and !, and IN can match addresses against subnets, such as
+// id.orig_h IN 10.0.0.0/8, or IN (10.0.0.0/8, 192.168.0.0/16), with addresses unquoted.
+type SQLQuery struct {
+	items      []sqlItem // selected items, then items that are only ordered by.
+	columns    int       // number of selected items.
+	from       string
+	where      sqlExpr
+	groupBy    []sqlExpr
+	orderBy    []sqlOrder
+	limit      int // -1 for no limit.
+	aggregates []*sqlAggregate
+}
+
+// an item of the SELECT list.
+type sqlItem struct {
+	name string
+	expr sqlExpr
+}
+
+// a term of the ORDER BY list, as the item it orders by.
+type sqlOrder struct {
+	item int
+	desc bool
+}
+
+// returns the log type the query is run over.
+func (q *SQLQuery) LogType() string {
+	return q.from
+}
+
+// returns the names of the columns of the result, the alias of each item or its text.
+func (q *SQLQuery) Columns() (columns []string) {
+	for _, item := range q.items[:q.columns] {
+		columns = append(columns, item.name)
+	}
+	return columns
+}
+
+// returns the fields of the log type the query refers to, in the order they first appear.
+func (q *SQLQuery) Fields() (fields []string) {
+	var exprs []sqlExpr
+	for _, item := range q.items {
+		exprs = append(exprs, item.expr)
+	}
+	if q.where != nil {
+		exprs = append(exprs, q.where)
+	}
+	exprs = append(exprs, q.groupBy...)
+	seen := make(map[string]bool)
+	for _, expr := range exprs {
+		walkSQL(expr, func(e sqlExpr) {
+			if column, ok := e.(*sqlColumn); ok && !seen[column.name] {
+				seen[column.name] = true
+				fields = append(fields, column.name)
+			}
+		})
+	}
+	return fields
+}
+
+// whether the query results in a row per group of records, rather than per record.
+func (q *SQLQuery) grouped() bool {
+	return len(q.groupBy) > 0 || len(q.aggregates) > 0
+}
+
+// ParseSQL parses a SQL query. Returns an error, with where in the query it is, if it is
+// not valid or uses SQL that is not supported.
+func ParseSQL(query string) (*SQLQuery, error) {
+	tokens, err := lexSQL(query)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	p := &sqlParser{query: query, tokens: tokens}
+	q, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	return q, nil
+}
+
+// parses a SQL condition on its own, as in a WHERE clause, such as for a site filter.
+func parseSQLCondition(condition string) (sqlExpr, error) {
+	tokens, err := lexSQL(condition)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	p := &sqlParser{query: condition, tokens: tokens, noAggregates: "a condition"}
+	expr, err := p.expr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.errorf("unexpected")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	return expr, nil
+}
+
+// kinds of SQL tokens.
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenQuoted // quoted identifier, never a keyword.
+	tokenString
+	tokenNumber
+	tokenSymbol
+	tokenAddress // IP address or subnet, such as 10.0.0.5 or 10.0.0.0/8.
+)
+
+type sqlToken struct {
+	kind     int
+	text     string
+	pos, end int // offsets of the token in the query.
+}
+
+// words that cannot be used as an unquoted field name or alias.
+var sqlReserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "ORDER": true,
+	"LIMIT": true, "AND": true, "OR": true, "NOT": true, "LIKE": true, "IN": true, "IS": true,
+	"NULL": true, "AS": true, "ASC": true, "DESC": true, "DISTINCT": true,
+}
+
+// splits a query into tokens.
+func lexSQL(query string) (tokens []sqlToken, err error) {
+	isIdent := func(c byte, first bool) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && (c == '.' || c >= '0' && c <= '9')
+	}
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case addressLength(query[i:]) > 0:
+			i += addressLength(query[i:])
+			tokens = append(tokens, sqlToken{tokenAddress, query[start:i], start, i})
+		case isIdent(c, true):
+			for i < len(query) && isIdent(query[i], false) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenIdent, query[start:i], start, i})
+		case c >= '0' && c <= '9':
+			for i < len(query) && (query[i] >= '0' && query[i] <= '9' || query[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenNumber, query[start:i], start, i})
+		case c == '\'' || c == '"' || c == '`':
+			// quotes are escaped by doubling them.
+			var text strings.Builder
+			for i++; ; i++ {
+				if i >= len(query) {
+					return nil, fmt.Errorf("unterminated %c at %d", c, start+1)
+				}
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+					} else {
+						break
+					}
+				}
+				text.WriteByte(query[i])
+			}
+			i++
+			kind := tokenQuoted
+			if c == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, sqlToken{kind, text.String(), start, i})
+		default:
+			symbol := ""
+			for _, s := range []string{"<=", ">=", "<>", "!=", "==", "&&", "||", "=", "!", "<", ">", "(", ")", ",", "*", "+", "-", "/"} {
+				if strings.HasPrefix(query[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, start+1)
+			}
+			i += len(symbol)
+			tokens = append(tokens, sqlToken{tokenSymbol, symbol, start, i})
+		}
+	}
+	return append(tokens, sqlToken{kind: tokenEOF, pos: len(query), end: len(query)}), nil
+}
+
+// the start of a query that could be an address or subnet.
+var sqlAddress = regexp.MustCompile(`^[0-9A-Fa-f:.]+(/[0-9]+)?`)
+
+// returns the length of the IP address or subnet at the start of query, or 0 if there is none.
+// IPv4 addresses are told apart from numbers by their four parts.
+func addressLength(query string) int {
+	match := sqlAddress.FindString(query)
+	address := strings.SplitN(match, "/", 2)[0]
+	if !strings.Contains(address, ":") && strings.Count(address, ".") != 3 || net.ParseIP(address) == nil {
+		return 0
+	}
+	if next := query[len(match):]; next != "" && strings.IndexByte("_.ghijklmnopqrstuvwxyzGHIJKLMNOPQRSTUVWXYZ", next[0]) >= 0 {
+		return 0
+	}
+	if _, err := parseSubnet(match); err != nil {
+		return 0
+	}
+	return len(match)
+}
+
+type sqlParser struct {
+	query        string
+	tokens       []sqlToken
+	i            int
+	aggregates   []*sqlAggregate
+	noAggregates string // clause being parsed that cannot hold aggregates, if any.
+	inAggregate  bool
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.i]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// returns an error about the next token.
+func (p *sqlParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	near := "end of query"
+	if t.kind != tokenEOF {
+		near = fmt.Sprintf("%q at %d", p.query[t.pos:t.end], t.pos+1)
+	}
+	return fmt.Errorf("%s, near %s", fmt.Sprintf(format, args...), near)
+}
+
+// whether the next token is the given keyword.
+func (p *sqlParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+// skips the next token if it is the given keyword.
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %s", keyword)
+	}
+	return nil
+}
+
+// skips the next token if it is the given symbol.
+func (p *sqlParser) acceptSymbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("expected %s", symbol)
+	}
+	return nil
+}
+
+// parses a field name or alias, which is either quoted or not a reserved word.
+func (p *sqlParser) name() (string, bool) {
+	t := p.peek()
+	if t.kind == tokenQuoted || t.kind == tokenIdent && !sqlReserved[strings.ToUpper(t.text)] {
+		p.i++
+		return t.text, true
+	}
+	return "", false
+}
+
+func (p *sqlParser) parse() (q *SQLQuery, err error) {
+	q = &SQLQuery{limit: -1}
+	if err = p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	for {
+		if p.acceptSymbol("*") {
+			return nil, fmt.Errorf("SELECT * is not supported, list the fields to select instead")
+		}
+		start := p.peek().pos
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		item := sqlItem{name: strings.TrimSpace(p.query[start:p.tokens[p.i-1].end]), expr: expr}
+		if p.acceptKeyword("AS") {
+			alias, ok := p.name()
+			if !ok {
+				return nil, p.errorf("expected an alias")
+			}
+			item.name = alias
+		} else if alias, ok := p.name(); ok {
+			item.name = alias
+		}
+		q.items = append(q.items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	q.columns = len(q.items)
+
+	if err = p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if q.from, _ = p.name(); q.from == "" {
+		return nil, p.errorf("expected a log type")
+	}
+
+	if p.acceptKeyword("WHERE") {
+		p.noAggregates = "WHERE"
+		if q.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		p.noAggregates = "GROUP BY"
+		for {
+			if t := p.peek(); t.kind == tokenNumber {
+				item, err := p.ordinal(q)
+				if err != nil {
+					return nil, err
+				}
+				if q.items[item].hasAggregate() {
+					return nil, fmt.Errorf("cannot GROUP BY %s, it is an aggregate", t.text)
+				}
+				q.groupBy = append(q.groupBy, q.items[item].expr)
+			} else {
+				expr, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				q.groupBy = append(q.groupBy, q.aliased(expr))
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	p.noAggregates = ""
+
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			order, err := p.orderTerm(q)
+			if err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("DESC") {
+				order.desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, order)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		if q.limit, err = strconv.Atoi(t.text); t.kind != tokenNumber || err != nil || q.limit < 0 {
+			p.i--
+			return nil, p.errorf("expected a number of rows")
+		}
+	}
+
+	if p.peek().kind != tokenEOF {
+		return nil, p.errorf("unexpected")
+	}
+	q.aggregates = p.aggregates
+	return q, nil
+}
+
+// returns the expression of the item that expr names by its alias, or expr if it names none.
+func (q *SQLQuery) aliased(expr sqlExpr) sqlExpr {
+	if column, ok := expr.(*sqlColumn); ok {
+		for _, item := range q.items[:q.columns] {
+			if !item.hasAggregate() && strings.EqualFold(item.name, column.name) {
+				return item.expr
+			}
+		}
+	}
+	return expr
+}
+
+// parses a 1-based ordinal of an item of the SELECT list, returning the index of the item.
+func (p *sqlParser) ordinal(q *SQLQuery) (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if err != nil || n < 1 || n > q.columns {
+		p.i--
+		return 0, p.errorf("expected a column number from 1 to %d", q.columns)
+	}
+	return n - 1, nil
+}
+
+// parses a term of ORDER BY: a column number, an alias, or an expression, which is added as
+// a hidden item unless it is already selected.
+func (p *sqlParser) orderTerm(q *SQLQuery) (sqlOrder, error) {
+	if p.peek().kind == tokenNumber {
+		item, err := p.ordinal(q)
+		return sqlOrder{item: item}, err
+	}
+	start := p.peek().pos
+	expr, err := p.expr()
+	if err != nil {
+		return sqlOrder{}, err
+	}
+	text := strings.TrimSpace(p.query[start:p.tokens[p.i-1].end])
+	if column, ok := expr.(*sqlColumn); ok {
+		for i, item := range q.items[:q.columns] {
+			if strings.EqualFold(item.name, column.name) {
+				return sqlOrder{item: i}, nil
+			}
+		}
+	}
+	for i, item := range q.items[:q.columns] {
+		if item.name == text {
+			return sqlOrder{item: i}, nil
+		}
+	}
+	q.items = append(q.items, sqlItem{name: text, expr: expr})
+	return sqlOrder{item: len(q.items) - 1}, nil
+}
+
+// parses an expression, from the operator that binds loosest to the one that binds tightest.
+func (p *sqlParser) expr() (sqlExpr, error) {
+	return p.or()
+}
+
+func (p *sqlParser) or() (sqlExpr, error) {
+	left, err := p.and()
+	for err == nil && (p.acceptKeyword("OR") || p.acceptSymbol("||")) {
+		var right sqlExpr
+		right, err = p.and()
+		left = &sqlLogic{or: true, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) and() (sqlExpr, error) {
+	left, err := p.not()
+	for err == nil && (p.acceptKeyword("AND") || p.acceptSymbol("&&")) {
+		var right sqlExpr
+		right, err = p.not()
+		left = &sqlLogic{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) not() (sqlExpr, error) {
+	if p.acceptKeyword("NOT") || p.acceptSymbol("!") {
+		expr, err := p.not()
+		return &sqlNot{expr}, err
+	}
+	return p.comparison()
+}
+
+func (p *sqlParser) comparison() (sqlExpr, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenSymbol {
+		switch t.text {
+		case "=", "==", "!=", "<>", "<", "<=", ">", ">=":
+			p.i++
+			right, err := p.additive()
+			op := t.text
+			if op == "==" {
+				op = "="
+			}
+			return &sqlCompare{op: op, left: left, right: right}, err
+		}
+	}
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &sqlIsNull{expr: left, not: not}, nil
+	}
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return newSQLLike(left, pattern, not), nil
+	case p.acceptKeyword("IN"):
+		if p.peek().kind == tokenAddress {
+			return p.inSubnets(left, not, false)
+		}
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t.kind == tokenAddress && strings.Contains(t.text, "/") {
+			return p.inSubnets(left, not, true)
+		}
+		in := &sqlIn{expr: left, not: not}
+		for {
+			value, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			in.values = append(in.values, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		return in, p.expectSymbol(")")
+	case not:
+		return nil, p.errorf("expected LIKE or IN after NOT")
+	}
+	return left, nil
+}
+
+// parses the subnets, or addresses, that expr is IN, after IN, or after its opening
+// parenthesis if listed.
+func (p *sqlParser) inSubnets(expr sqlExpr, not bool, listed bool) (sqlExpr, error) {
+	in := &sqlInSubnets{expr: expr, not: not}
+	for {
+		t := p.peek()
+		if t.kind != tokenAddress {
+			return nil, p.errorf("expected a subnet")
+		}
+		p.i++
+		ipNet, _ := parseSubnet(t.text)
+		in.nets = append(in.nets, ipNet)
+		if !listed || !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if listed {
+		return in, p.expectSymbol(")")
+	}
+	return in, nil
+}
+
+func (p *sqlParser) additive() (sqlExpr, error) {
+	left, err := p.multiplicative()
+	for err == nil {
+		t := p.peek()
+		if t.kind != tokenSymbol || t.text != "+" && t.text != "-" {
+			break
+		}
+		p.i++
+		var right sqlExpr
+		right, err = p.multiplicative()
+		left = &sqlArithmetic{op: t.text[0], left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) multiplicative() (sqlExpr, error) {
+	left, err := p.unary()
+	for err == nil {
+		t := p.peek()
+		if t.kind != tokenSymbol || t.text != "*" && t.text != "/" {
+			break
+		}
+		p.i++
+		var right sqlExpr
+		right, err = p.unary()
+		left = &sqlArithmetic{op: t.text[0], left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) unary() (sqlExpr, error) {
+	if p.acceptSymbol("-") {
+		expr, err := p.unary()
+		return &sqlArithmetic{op: '-', left: &sqlLiteral{float64(0)}, right: expr}, err
+	}
+	return p.primary()
+}
+
+func (p *sqlParser) primary() (sqlExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.i++
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.i--
+			return nil, p.errorf("expected a number")
+		}
+		return &sqlLiteral{n}, nil
+	case t.kind == tokenString:
+		p.i++
+		return &sqlLiteral{t.text}, nil
+	case t.kind == tokenAddress && !strings.Contains(t.text, "/"):
+		p.i++
+		return &sqlLiteral{t.text}, nil
+	case t.kind == tokenAddress:
+		return nil, p.errorf("a subnet can only be matched with IN")
+	case p.acceptKeyword("NULL"):
+		return &sqlLiteral{nil}, nil
+	case p.acceptSymbol("("):
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectSymbol(")")
+	}
+	name, ok := p.name()
+	if !ok {
+		return nil, p.errorf("expected a field, value or function")
+	}
+	if t.kind == tokenIdent && p.acceptSymbol("(") {
+		return p.call(strings.ToLower(name))
+	}
+	return &sqlColumn{name}, nil
+}
+
+// parses the arguments of a call to the named function, after its opening parenthesis.
+func (p *sqlParser) call(name string) (sqlExpr, error) {
+	switch name {
+	case "count", "sum", "min", "max", "avg":
+		if p.noAggregates != "" {
+			return nil, fmt.Errorf("%s cannot be used in %s", name, p.noAggregates)
+		}
+		if p.inAggregate {
+			return nil, fmt.Errorf("%s cannot be used inside another aggregate", name)
+		}
+		agg := &sqlAggregate{fn: name, index: len(p.aggregates)}
+		if name == "count" && p.acceptSymbol("*") {
+			p.aggregates = append(p.aggregates, agg)
+			return agg, p.expectSymbol(")")
+		}
+		agg.distinct = p.acceptKeyword("DISTINCT")
+		p.inAggregate = true
+		arg, err := p.expr()
+		p.inAggregate = false
+		if err != nil {
+			return nil, err
+		}
+		agg.arg = arg
+		p.aggregates = append(p.aggregates, agg)
+		return agg, p.expectSymbol(")")
+	case "lower", "upper", "length":
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlFunc{name: name, arg: arg}, p.expectSymbol(")")
+	}
+	return nil, fmt.Errorf("unknown function %s", name)
+}
+
+// whether the item holds an aggregate.
+func (item sqlItem) hasAggregate() (found bool) {
+	walkSQL(item.expr, func(e sqlExpr) {
+		if _, ok := e.(*sqlAggregate); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// calls visit with expr and every expression inside it.
+func walkSQL(expr sqlExpr, visit func(sqlExpr)) {
+	visit(expr)
+	switch e := expr.(type) {
+	case *sqlLogic:
+		walkSQL(e.left, visit)
+		walkSQL(e.right, visit)
+	case *sqlCompare:
+		walkSQL(e.left, visit)
+		walkSQL(e.right, visit)
+	case *sqlArithmetic:
+		walkSQL(e.left, visit)
+		walkSQL(e.right, visit)
+	case *sqlNot:
+		walkSQL(e.expr, visit)
+	case *sqlIsNull:
+		walkSQL(e.expr, visit)
+	case *sqlLike:
+		walkSQL(e.expr, visit)
+		walkSQL(e.pattern, visit)
+	case *sqlInSubnets:
+		walkSQL(e.expr, visit)
+	case *sqlIn:
+		walkSQL(e.expr, visit)
+		for _, value := range e.values {
+			walkSQL(value, visit)
+		}
+	case *sqlFunc:
+		walkSQL(e.arg, visit)
+	case *sqlAggregate:
+		if e.arg != nil {
+			walkSQL(e.arg, visit)
+		}
+	}
+}
+
+// sqlRow is what an expression is evaluated against: a record, and the results of the
+// aggregates of its group once they are known.
+type sqlRow struct {
+	record map[string]interface{}
+	aggs   []interface{}
+}
+
+// sqlExpr is an expression of a query. Values are nil for NULL, string, float64, int64 for
+// counts, or bool for conditions.
+type sqlExpr interface {
+	eval(row sqlRow) interface{}
+}
+
+type sqlLiteral struct{ value interface{} }
+
+func (e *sqlLiteral) eval(row sqlRow) interface{} {
+	return e.value
+}
+
+type sqlColumn struct{ name string }
+
+func (e *sqlColumn) eval(row sqlRow) interface{} {
+	if value, ok := row.record[e.name]; ok {
+		return value
+	}
+	// zeek names fields like id.orig_h, which is easier to type as id_orig_h.
+	if strings.Contains(e.name, "_") {
+		for field, value := range row.record {
+			if strings.Contains(field, ".") && strings.ReplaceAll(field, ".", "_") == e.name {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+type sqlLogic struct {
+	or          bool
+	left, right sqlExpr
+}
+
+func (e *sqlLogic) eval(row sqlRow) interface{} {
+	left, leftKnown := sqlTruth(e.left.eval(row))
+	if leftKnown && left == e.or {
+		return left
+	}
+	right, rightKnown := sqlTruth(e.right.eval(row))
+	if rightKnown && right == e.or {
+		return right
+	}
+	if !leftKnown || !rightKnown {
+		return nil
+	}
+	return !e.or
+}
+
+type sqlNot struct{ expr sqlExpr }
+
+func (e *sqlNot) eval(row sqlRow) interface{} {
+	if value, known := sqlTruth(e.expr.eval(row)); known {
+		return !value
+	}
+	return nil
+}
+
+type sqlCompare struct {
+	op          string
+	left, right sqlExpr
+}
+
+func (e *sqlCompare) eval(row sqlRow) interface{} {
+	c, ok := sqlCompareValues(e.left.eval(row), e.right.eval(row))
+	if !ok {
+		return nil
+	}
+	switch e.op {
+	case "=":
+		return c == 0
+	case "!=", "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+type sqlArithmetic struct {
+	op          byte
+	left, right sqlExpr
+}
+
+func (e *sqlArithmetic) eval(row sqlRow) interface{} {
+	left, leftOk := sqlNumber(e.left.eval(row))
+	right, rightOk := sqlNumber(e.right.eval(row))
+	if !leftOk || !rightOk {
+		return nil
+	}
+	switch e.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	}
+	if right == 0 {
+		return nil
+	}
+	return left / right
+}
+
+type sqlIsNull struct {
+	expr sqlExpr
+	not  bool
+}
+
+func (e *sqlIsNull) eval(row sqlRow) interface{} {
+	return (e.expr.eval(row) == nil) != e.not
+}
+
+type sqlLike struct {
+	expr, pattern sqlExpr
+	not           bool
+	compiled      *regexp.Regexp // the pattern, if it is a literal.
+}
+
+func newSQLLike(expr sqlExpr, pattern sqlExpr, not bool) *sqlLike {
+	like := &sqlLike{expr: expr, pattern: pattern, not: not}
+	if literal, ok := pattern.(*sqlLiteral); ok && literal.value != nil {
+		like.compiled = likePattern(sqlString(literal.value))
+	}
+	return like
+}
+
+// returns a regexp matching what the LIKE pattern does: % is any text, _ is any character.
+func likePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+func (e *sqlLike) eval(row sqlRow) interface{} {
+	value := e.expr.eval(row)
+	if value == nil {
+		return nil
+	}
+	compiled := e.compiled
+	if compiled == nil {
+		pattern := e.pattern.eval(row)
+		if pattern == nil {
+			return nil
+		}
+		compiled = likePattern(sqlString(pattern))
+	}
+	return compiled.MatchString(sqlString(value)) != e.not
+}
+
+type sqlIn struct {
+	expr   sqlExpr
+	values []sqlExpr
+	not    bool
+}
+
+func (e *sqlIn) eval(row sqlRow) interface{} {
+	value := e.expr.eval(row)
+	if value == nil {
+		return nil
+	}
+	for _, v := range e.values {
+		if c, ok := sqlCompareValues(value, v.eval(row)); ok && c == 0 {
+			return !e.not
+		}
+	}
+	return e.not
+}
+
+type sqlInSubnets struct {
+	expr sqlExpr
+	nets []*net.IPNet
+	not  bool
+}
+
+// an address is in the subnets if it is in any of them, and a set or vector of addresses if
+// any of its addresses is, written as a list separated by commas, or as a JSON array.
+func (e *sqlInSubnets) eval(row sqlRow) interface{} {
+	value := e.expr.eval(row)
+	if value == nil {
+		return nil
+	}
+	addresses := sqlString(value)
+	if strings.HasPrefix(addresses, "[") {
+		var list []string
+		json.Unmarshal([]byte(addresses), &list)
+		addresses = strings.Join(list, ",")
+	}
+	return inSubnets(e.nets, addresses) != e.not
+}
+
+type sqlFunc struct {
+	name string
+	arg  sqlExpr
+}
+
+func (e *sqlFunc) eval(row sqlRow) interface{} {
+	value := e.arg.eval(row)
+	if value == nil {
+		return nil
+	}
+	switch e.name {
+	case "lower":
+		return strings.ToLower(sqlString(value))
+	case "upper":
+		return strings.ToUpper(sqlString(value))
+	default:
+		return int64(len([]rune(sqlString(value))))
+	}
+}
+
+// sqlAggregate is a call to count, sum, min, max or avg, evaluated over a group of records.
+type sqlAggregate struct {
+	fn       string
+	arg      sqlExpr // nil for count(*).
+	distinct bool
+	index    int // index of the aggregate in the query, and of its result in a row.
+}
+
+func (e *sqlAggregate) eval(row sqlRow) interface{} {
+	return row.aggs[e.index]
+}
+
+// the state of an aggregate over the records of a group seen so far.
+type sqlAggState struct {
+	count    int64   // values that are not null.
+	numbers  int64   // values that are numbers.
+	sum      float64 // sum of the values that are numbers.
+	min, max interface{}
+	distinct map[string]interface{} // distinct values by their text, for DISTINCT.
+}
+
+// adds a record of the group to the state.
+func (e *sqlAggregate) add(s *sqlAggState, record map[string]interface{}) {
+	if e.arg == nil {
+		s.count++
+		return
+	}
+	value := e.arg.eval(sqlRow{record: record})
+	if value == nil {
+		return
+	}
+	if e.distinct {
+		if s.distinct == nil {
+			s.distinct = make(map[string]interface{})
+		}
+		s.distinct[sqlString(value)] = value
+		return
+	}
+	s.accumulate(value)
+}
+
+func (s *sqlAggState) accumulate(value interface{}) {
+	s.count++
+	if n, ok := sqlNumber(value); ok {
+		s.numbers++
+		s.sum += n
+	}
+	if c, ok := sqlCompareValues(value, s.min); s.min == nil || ok && c < 0 {
+		s.min = value
+	}
+	if c, ok := sqlCompareValues(value, s.max); s.max == nil || ok && c > 0 {
+		s.max = value
+	}
+}
+
+// adds the records of another state of the same aggregate, such as from another log.
+func (s *sqlAggState) merge(other *sqlAggState) {
+	if other.distinct != nil {
+		if s.distinct == nil {
+			s.distinct = make(map[string]interface{})
+		}
+		for key, value := range other.distinct {
+			s.distinct[key] = value
+		}
+	}
+	s.count += other.count
+	s.numbers += other.numbers
+	s.sum += other.sum
+	if c, ok := sqlCompareValues(other.min, s.min); s.min == nil || ok && c < 0 {
+		s.min = other.min
+	}
+	if c, ok := sqlCompareValues(other.max, s.max); s.max == nil || ok && c > 0 {
+		s.max = other.max
+	}
+}
+
+// returns the result of the aggregate over every record added to s.
+func (e *sqlAggregate) result(s *sqlAggState) interface{} {
+	if e.distinct {
+		distinct := &sqlAggState{}
+		for _, value := range s.distinct {
+			distinct.accumulate(value)
+		}
+		s = distinct
+	}
+	switch e.fn {
+	case "count":
+		return s.count
+	case "min":
+		return s.min
+	case "max":
+		return s.max
+	}
+	if s.numbers == 0 {
+		return nil
+	}
+	if e.fn == "avg" {
+		return s.sum / float64(s.numbers)
+	}
+	return s.sum
+}
+
+// returns whether a condition holds, and false if it is null and so is not known.
+func sqlTruth(value interface{}) (truth bool, known bool) {
+	switch v := value.(type) {
+	case nil:
+		return false, false
+	case bool:
+		return v, true
+	}
+	n, ok := sqlNumber(value)
+	return ok && n != 0, true
+}
+
+// returns value as a number, or false if it is not one.
+func sqlNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// returns value as text, as it is written in a result.
+func sqlString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return unsetField
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// compares two values, as numbers if both are and as text otherwise. Returns false if either
+// is null, since null is neither equal to nor ordered against anything.
+func sqlCompareValues(a interface{}, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if x, ok := sqlNumber(a); ok {
+		if y, ok := sqlNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return strings.Compare(sqlString(a), sqlString(b)), true
+}
+
+// orders two values of a column of the result, with nulls first.
+func sqlOrderValues(a interface{}, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := sqlCompareValues(a, b)
+	return c
+}
+
+// returns the record held by a line of a log as the values a query sees, or false if it holds
+// no record. Booleans are written as zeek writes them in TSV logs, T or F, and values that
+// are neither text nor numbers, such as sets, as compact JSON. JSON records are read with
+// scanObject, rather than decoded and the values that are not text encoded again.
+func sqlRecord(line []byte, fields *[]string) (map[string]interface{}, bool) {
+	if len(line) > 0 && line[0] == '{' {
+		record := make(map[string]interface{})
+		if scanObject(line, func(key []byte, value []byte) bool {
+			record[string(key)] = sqlJSONValue(value)
+			return true
+		}) {
+			return record, true
+		}
+	}
+	decoded, ok := decodeRecord(line, fields)
+	record, isObject := decoded.(map[string]interface{})
+	if !ok || !isObject {
+		return nil, false
+	}
+	for field, value := range record {
+		switch v := value.(type) {
+		case json.Number:
+			record[field] = string(v)
+		case bool:
+			record[field] = map[bool]string{true: "T", false: "F"}[v]
+		case string, nil:
+		default:
+			encoded, _ := json.Marshal(v)
+			record[field] = string(encoded)
+		}
+	}
+	return record, true
+}
+
+// returns the value a query sees of the raw JSON value of a record, as sqlRecord gives it.
+func sqlJSONValue(value []byte) interface{} {
+	switch value[0] {
+	case '"':
+		if bytes.IndexByte(value, '\\') < 0 {
+			return string(value[1 : len(value)-1])
+		}
+		var s string
+		json.Unmarshal(value, &s)
+		return s
+	case 'n':
+		return nil
+	case 't':
+		return "T"
+	case 'f':
+		return "F"
+	case '[', '{':
+		// objects are written with their keys sorted, so the same object is the same text
+		// whatever order it was logged in. Sets and vectors only need compacting.
+		if bytes.IndexByte(value, '{') >= 0 {
+			decoder := json.NewDecoder(bytes.NewReader(value))
+			decoder.UseNumber()
+			var decoded interface{}
+			if decoder.Decode(&decoded) == nil {
+				encoded, _ := json.Marshal(decoded)
+				return string(encoded)
+			}
+		}
+		var compact bytes.Buffer
+		if json.Compact(&compact, value) == nil {
+			return compact.String()
+		}
+	}
+	return string(value)
+}
+
+// a group of records of a grouped query.
+type sqlGroup struct {
+	sample     map[string]interface{} // first record of the group.
+	sampleFile int                    // index of the log the sample is from.
+	aggs       []sqlAggState
+}
+
+// the partial result of a query over a single log.
+type sqlPartial struct {
+	groups map[string]*sqlGroup
+	rows   [][]interface{}
+}
+
+// RunSQL runs the query over every log that a pull with rc would read, several logs at a
+// time, and returns the rows of the result, with a value for each of its Columns. Corrupt
+// logs are recorded in rc.Report, if set, and skipped.
+func RunSQL(q *SQLQuery, rc RuntimeConfig) (rows [][]interface{}, err error) {
+	rc.LogType = q.from
+	logFiles, err := PullLogs(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows of each log, for queries that are not grouped, or the groups of every log.
+	perFile := make([][][]interface{}, len(logFiles))
+	groups := make(map[string]*sqlGroup)
+	var lock sync.Mutex
+	var firstErr error
+
+	// a query with a limit and no order is done once the logs read so far, in order, have
+	// enough rows.
+	var stop int32
+	finished := make([]bool, len(logFiles))
+	var done, doneRows int
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	threads := rc.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if atomic.LoadInt32(&stop) != 0 {
+					continue
+				}
+				partial, err := q.runLog(logFiles[i], i, rc.Report, &stop)
+				lock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					atomic.StoreInt32(&stop, 1)
+				}
+				for key, group := range partial.groups {
+					if merged, ok := groups[key]; !ok {
+						groups[key] = group
+					} else {
+						if group.sampleFile < merged.sampleFile {
+							merged.sample, merged.sampleFile = group.sample, group.sampleFile
+						}
+						for a := range merged.aggs {
+							merged.aggs[a].merge(&group.aggs[a])
+						}
+					}
+				}
+				perFile[i], finished[i] = partial.rows, true
+				for ; done < len(finished) && finished[done]; done++ {
+					doneRows += len(perFile[done])
+				}
+				if q.limit >= 0 && len(q.orderBy) == 0 && !q.grouped() && doneRows >= q.limit {
+					atomic.StoreInt32(&stop, 1)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for i := range logFiles {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if q.grouped() {
+		// an aggregate without GROUP BY is over every record, even if there are none.
+		if len(q.groupBy) == 0 && len(groups) == 0 {
+			groups[""] = &sqlGroup{aggs: make([]sqlAggState, len(q.aggregates))}
+		}
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			group := groups[key]
+			row := sqlRow{record: group.sample}
+			for a, agg := range q.aggregates {
+				row.aggs = append(row.aggs, agg.result(&group.aggs[a]))
+			}
+			rows = append(rows, q.project(row))
+		}
+	} else {
+		for _, fileRows := range perFile {
+			rows = append(rows, fileRows...)
+		}
+	}
+
+	if len(q.orderBy) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, order := range q.orderBy {
+				if c := sqlOrderValues(rows[i][order.item], rows[j][order.item]); c != 0 {
+					return c < 0 != order.desc
+				}
+			}
+			return false
+		})
+	}
+	if q.limit >= 0 && len(rows) > q.limit {
+		rows = rows[:q.limit]
+	}
+	for i := range rows {
+		rows[i] = rows[i][:q.columns]
+	}
+	return rows, nil
+}
+
+// evaluates every item of the query, hidden or not, against row.
+func (q *SQLQuery) project(row sqlRow) []interface{} {
+	values := make([]interface{}, len(q.items))
+	for i, item := range q.items {
+		values[i] = item.expr.eval(row)
+	}
+	return values
+}
+
+// runs the query over a single log, the index-th of the pull, until it is done or stop is set.
+func (q *SQLQuery) runLog(logFile string, index int, report *RunReport, stop *int32) (partial sqlPartial, err error) {
+	partial.groups = make(map[string]*sqlGroup)
+	f, err := os.Open(logFile)
+	if err != nil {
+		return partial, err
+	}
+	defer f.Close()
+	checked, err := NewCheckedReader(f)
+	if err != nil {
+		if report != nil {
+			report.AddCorrupt(logFile, err)
+		}
+		return partial, nil
+	}
+	defer checked.Close()
+
+	lines := newLineReader(checked)
+	defer lines.close()
+	var fields []string
+	var key strings.Builder
+	for atomic.LoadInt32(stop) == 0 {
+		line, readErr := lines.next()
+		if record, ok := sqlRecord(bytes.TrimRight(line, "\r\n"), &fields); ok {
+			if truth, _ := q.matches(record); truth {
+				if !q.grouped() {
+					partial.rows = append(partial.rows, q.project(sqlRow{record: record}))
+					if q.limit >= 0 && len(q.orderBy) == 0 && len(partial.rows) >= q.limit {
+						break
+					}
+				} else {
+					key.Reset()
+					for _, expr := range q.groupBy {
+						// nulls are kept apart from the text of unset fields.
+						if value := expr.eval(sqlRow{record: record}); value == nil {
+							key.WriteString("\x01")
+						} else {
+							key.WriteString("\x02" + sqlString(value))
+						}
+						key.WriteString("\x00")
+					}
+					group, ok := partial.groups[key.String()]
+					if !ok {
+						group = &sqlGroup{sample: record, sampleFile: index, aggs: make([]sqlAggState, len(q.aggregates))}
+						partial.groups[key.String()] = group
+					}
+					for a, agg := range q.aggregates {
+						agg.add(&group.aggs[a], record)
+					}
+				}
+			}
+		}
+		// a log that ends early is corrupt, and is recorded below.
+		if readErr != nil {
+			break
+		}
+	}
+	if checked.Err != nil && report != nil {
+		report.AddCorrupt(logFile, checked.Err)
+	}
+	return partial, nil
+}
+
+// whether record matches the WHERE clause of the query.
+func (q *SQLQuery) matches(record map[string]interface{}) (bool, bool) {
+	if q.where == nil {
+		return true, true
+	}
+	return sqlTruth(q.where.eval(sqlRow{record: record}))
+}
+
+// WriteSQLResult writes the rows of the result of q to w in the given format: as TSV with
+// a header of the columns and unset values as -, or as a JSON object per row.
+func WriteSQLResult(w io.Writer, q *SQLQuery, rows [][]interface{}, format string) error {
+	out := bufio.NewWriter(w)
+	columns := q.Columns()
+	if format == SQLFormatTSV {
+		out.WriteString(strings.Join(columns, "\t") + "\n")
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if format == SQLFormatTSV {
+				if i > 0 {
+					out.WriteByte('\t')
+				}
+				out.WriteString(sqlString(value))
+				continue
+			}
+			if i == 0 {
+				out.WriteByte('{')
+			} else {
+				out.WriteByte(',')
+			}
+			name, _ := json.Marshal(columns[i])
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			out.Write(name)
+			out.WriteByte(':')
+			out.Write(encoded)
+		}
+		if format != SQLFormatTSV {
+			out.WriteByte('}')
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// readAhead decompresses a log in the background into a queue of buffers, so the filter is
+// not kept waiting on a slow disk, and decompressing is not kept waiting on the filter.
+type readAhead struct {
+	filled  chan []byte   // decompressed, in order, closed once the log is done
+	free    chan []byte   // ready to be filled again
+	buffers []*[]byte     // every buffer, given back to the pool on Close
+	err     error         // the error that ended the log, set before filled is closed
+	current []byte        // rest of the buffer being read
+	last    []byte        // buffer being read, to be freed once done
+	stop    chan struct{} // closed on Close
+	done    chan struct{} // closed once nothing more is filled
+}
+
+// returns a reader of r that reads up to the pipeline's ReadAhead buffers of it ahead of
+// being read, to be closed once done, before looking at any error of r. With no read-ahead,
+// r is read as it is.
+func NewReadAhead(r io.Reader) io.ReadCloser {
+	if pipeline.ReadAhead <= 0 {
+		return ioutil.NopCloser(r)
+	}
+	ra := &readAhead{
+		filled: make(chan []byte, pipeline.ReadAhead),
+		free:   make(chan []byte, pipeline.ReadAhead+1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	// one more than are queued, for the one being read.
+	for i := 0; i <= pipeline.ReadAhead; i++ {
+		buf := getBuffer()
+		ra.buffers = append(ra.buffers, buf)
+		ra.free <- *buf
+	}
+	go ra.fill(r)
+	return ra
+}
+
+// fills free buffers from r and queues them until r ends or the reader is closed.
+func (ra *readAhead) fill(r io.Reader) {
+	defer close(ra.done)
+	defer close(ra.filled)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.stop:
+			return
+		}
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			select {
+			case ra.filled <- buf[:n]:
+			case <-ra.stop:
+				return
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		} else if err != nil {
+			ra.err = err
+			return
+		}
+	}
+}
+
+// moves on to the next filled buffer once the one being read is done. Returns false once
+// there are none left.
+func (ra *readAhead) next() bool {
+	if ra.last != nil {
+		ra.free <- ra.last[:cap(ra.last)]
+		ra.last = nil
+	}
+	buf, ok := <-ra.filled
+	ra.last, ra.current = buf, buf
+	return ok
+}
+
+func (ra *readAhead) Read(p []byte) (n int, err error) {
+	for len(ra.current) == 0 {
+		if !ra.next() {
+			if ra.err != nil {
+				return 0, ra.err
+			}
+			return 0, io.EOF
+		}
+	}
+	n = copy(p, ra.current)
+	ra.current = ra.current[n:]
+	return n, nil
+}
+
+// stops reading ahead and waits for it to stop, then gives the buffers back to the pool.
+func (ra *readAhead) Close() error {
+	select {
+	case <-ra.stop:
+		return nil
+	default:
+	}
+	close(ra.stop)
+	<-ra.done
+	for _, buf := range ra.buffers {
+		putBuffer(buf)
+	}
+	return nil
+}
+
+// stageWriter passes what a filter writes on to w a buffer at a time, of the pipeline's
+// buffer size.
+type stageWriter struct {
+	w io.Writer
+}
+
+// returns a writer to w that reads up to the pipeline's buffer size from a filter's output
+// at once when copied to, such as by a command writing its stdout to it.
+func NewStageWriter(w io.Writer) io.Writer {
+	return stageWriter{w: w}
+}
+
+func (s stageWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s stageWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for {
+		read, readErr := r.Read(*buf)
+		if read > 0 {
+			written, err := s.w.Write((*buf)[:read])
+			n += int64(written)
+			if err != nil {
+				return n, err
+			}
+		}
+		if readErr == io.EOF {
+			return n, nil
+		} else if readErr != nil {
+			return n, readErr
+		}
+	}
+}
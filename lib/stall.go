@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// actions taken on a stalled task, see WatchStall.
+const (
+	StallWarn  = "warn"  // only warn, and let the filter carry on.
+	StallKill  = "kill"  // kill the filter, keeping what it wrote so far.
+	StallRetry = "retry" // kill the filter and run it once more from the start.
+)
+
+// returns the actions that can be taken on a stalled task.
+func StallActions() []string {
+	return []string{StallWarn, StallKill, StallRetry}
+}
+
+// Activity records when a task last read input or wrote output, so a filter that is slow
+// but still working can be told apart from one that is hung. Safe for concurrent use.
+type Activity struct {
+	last int64 // unix nanoseconds of the last read or write, updated atomically
+}
+
+// returns an activity that was last active now.
+func NewActivity() *Activity {
+	a := &Activity{}
+	a.Touch()
+	return a
+}
+
+// records activity now.
+func (a *Activity) Touch() {
+	atomic.StoreInt64(&a.last, time.Now().UnixNano())
+}
+
+// returns how long it has been since the last activity.
+func (a *Activity) Idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&a.last)))
+}
+
+// returns a reader of r that records activity whenever something is read.
+func (a *Activity) Reader(r io.Reader) io.Reader {
+	return activityReader{r, a}
+}
+
+// returns a writer to w that records activity whenever something is written.
+func (a *Activity) Writer(w io.Writer) io.Writer {
+	return activityWriter{w, a}
+}
+
+type activityReader struct {
+	r io.Reader
+	a *Activity
+}
+
+func (ar activityReader) Read(p []byte) (n int, err error) {
+	n, err = ar.r.Read(p)
+	if n > 0 {
+		ar.a.Touch()
+	}
+	return n, err
+}
+
+type activityWriter struct {
+	w io.Writer
+	a *Activity
+}
+
+func (aw activityWriter) Write(p []byte) (n int, err error) {
+	n, err = aw.w.Write(p)
+	if n > 0 {
+		aw.a.Touch()
+	}
+	return n, err
+}
+
+// calls onStall, from its own goroutine, once activity has been idle for timeout. It is
+// called again only after activity resumes and stalls once more. Nothing is watched if
+// timeout is not positive. The returned function stops watching, returning once onStall
+// is no longer running, and must be called once the task is done.
+func WatchStall(activity *Activity, timeout time.Duration, onStall func(idle time.Duration)) (stop func()) {
+	if timeout <= 0 {
+		return func() {}
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		// checked four times a timeout, so a stall is noticed soon after it starts, but no
+		// more often than every millisecond, however short the timeout.
+		tick := timeout / 4
+		if tick < time.Millisecond {
+			tick = time.Millisecond
+		}
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		stalled := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			idle := activity.Idle()
+			if idle < timeout {
+				stalled = false
+			} else if !stalled {
+				stalled = true
+				onStall(idle)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,385 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// formats a summary can be rendered in, and the file each is written to.
+const (
+	SummaryMarkdown = "markdown"
+	SummaryHTML     = "html"
+)
+
+var summaryFiles = map[string]string{
+	SummaryMarkdown: "report.md",
+	SummaryHTML:     "report.html",
+}
+
+// number of top talkers listed for each pull in a summary.
+const summaryTopTalkers = 10
+
+// fields of a zeek record that name the hosts involved in it, counted as talkers.
+var talkerFields = []string{"id.orig_h", "id.resp_h"}
+
+// date in the name of an output file, such as conn-2021-06-01.json.
+var outputFileDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// Parameter is a named setting of a pull, listed in its summary.
+type Parameter struct {
+	Name  string
+	Value string
+}
+
+// Count is the number of records with a given key, such as a date or a host.
+type Count struct {
+	Key   string
+	Count int
+}
+
+// PullSummary holds statistics on the output of a single pull.
+type PullSummary struct {
+	Name       string
+	OutDir     string
+	Parameters []Parameter
+	Files      int
+	Records    int
+	Days       []Count // records per day, by date
+	TopTalkers []Count // hosts in the most records, most first
+}
+
+// returns the largest number of records in a single day, to scale histograms by.
+func (p PullSummary) MaxDay() (max int) {
+	for _, day := range p.Days {
+		if day.Count > max {
+			max = day.Count
+		}
+	}
+	return max
+}
+
+// Summary is everything a rendered report is made from. Custom templates are executed
+// with it as their data.
+type Summary struct {
+	Title      string
+	Generated  time.Time
+	Parameters []Parameter
+	Pulls      []PullSummary
+	Corrupt    []CorruptFile // source logs that could not be decompressed
+	Mismatched []CorruptFile // source logs that did not match their checksum sidecar
+}
+
+// returns the summary of a pull, titled title, with the given parameters and what report
+// recorded, if set.
+func NewSummary(title string, parameters []Parameter, report *RunReport) Summary {
+	s := Summary{Title: title, Generated: time.Now(), Parameters: parameters}
+	if report != nil {
+		s.Corrupt = report.CorruptFiles()
+		report.lock.Lock()
+		s.Mismatched = append([]CorruptFile(nil), report.Mismatched...)
+		report.lock.Unlock()
+	}
+	return s
+}
+
+// reads every output file in outDir and returns statistics on the records in them. Records
+// are counted by day using their ts field, or the date in the file name if they have none.
+// Hidden files and rendered reports are skipped.
+func SummarizeOutput(name string, outDir string, parameters []Parameter) (p PullSummary, err error) {
+	p = PullSummary{Name: name, OutDir: outDir, Parameters: parameters}
+	days := make(map[string]int)
+	talkers := make(map[string]int)
+
+	files, err := ioutil.ReadDir(outDir)
+	if err != nil {
+		return p, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !isOutputFile(file.Name()) {
+			continue
+		}
+		p.Files++
+		if err = summarizeFile(&p, filepath.Join(outDir, file.Name()), days, talkers); err != nil {
+			return p, err
+		}
+	}
+
+	p.Days = sortedCounts(days, false)
+	p.TopTalkers = sortedCounts(talkers, true)
+	if len(p.TopTalkers) > summaryTopTalkers {
+		p.TopTalkers = p.TopTalkers[:summaryTopTalkers]
+	}
+	return p, nil
+}
+
+// counts the records of a single output file into p, days and talkers.
+func summarizeFile(p *PullSummary, path string, days map[string]int, talkers map[string]int) error {
+	f, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fileDate := outputFileDate.FindString(filepath.Base(path))
+	count := func(record map[string]interface{}) {
+		p.Records++
+		if day := recordDate(record); day != "" {
+			days[day]++
+		} else if fileDate != "" {
+			days[fileDate]++
+		}
+		for _, field := range talkerFields {
+			if host, ok := record[field].(string); ok && host != "" {
+				talkers[host]++
+			}
+		}
+	}
+
+	if filepath.Ext(uncompressedName(path)) == outputExtension(OutputMsgpack) {
+		data, err := ioutil.ReadAll(f)
+		for len(data) > 0 && err == nil {
+			var value interface{}
+			if value, data, err = DecodeMsgpack(data); err == nil {
+				record, _ := value.(map[string]interface{})
+				count(record)
+			}
+		}
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[0] != '#' && len(strings.TrimSpace(string(line))) > 0 {
+			var record map[string]interface{}
+			if json.Unmarshal(line, &record) != nil {
+				record = nil
+			}
+			count(record)
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// returns the local date of the ts field of a record, as YYYY-MM-DD, or "" if it has none.
+// zeek writes ts as epoch seconds, or as an ISO 8601 time if configured to.
+func recordDate(record map[string]interface{}) string {
+	switch ts := record["ts"].(type) {
+	case float64:
+		return time.Unix(int64(ts), 0).Format(TimeFormatDay)
+	case int64:
+		return time.Unix(ts, 0).Format(TimeFormatDay)
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return t.Local().Format(TimeFormatDay)
+		}
+	}
+	return ""
+}
+
+// returns counts sorted by key, or by count, most first, if byCount is set.
+func sortedCounts(counts map[string]int, byCount bool) (sorted []Count) {
+	for key, count := range counts {
+		sorted = append(sorted, Count{key, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if byCount && sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// returns whether name is an output file of a pull, rather than a hidden file, or a file
+// written with the outputs, such as a manifest, report, dictionary or provenance sidecar.
+func isOutputFile(name string) bool {
+	return !strings.HasPrefix(name, ".") && !isSummaryFile(name) && name != ManifestFile && filepath.Ext(name) != DictionaryExtension && !IsProvenanceFile(name)
+}
+
+func isSummaryFile(name string) bool {
+	for _, summaryFile := range summaryFiles {
+		if name == summaryFile {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the formats a summary can be rendered in.
+func SummaryFormats() []string {
+	return []string{SummaryMarkdown, SummaryHTML}
+}
+
+// renders the summary in the given format into dir, using the template at templatePath, or
+// the built in template of the format if it is empty. Returns the path of the written report.
+func WriteSummary(dir string, format string, templatePath string, s Summary) (path string, err error) {
+	fileName, ok := summaryFiles[format]
+	if !ok {
+		return "", fmt.Errorf("unknown report format '%s'", format)
+	}
+	var rendered bytes.Buffer
+	if err = RenderSummary(&rendered, format, templatePath, s); err != nil {
+		return "", err
+	}
+	path = filepath.Join(dir, fileName)
+	return path, ioutil.WriteFile(path, rendered.Bytes(), 0644)
+}
+
+// renders the summary in the given format to w, like WriteSummary. HTML templates escape
+// everything they insert, as output can hold anything a log did.
+func RenderSummary(w io.Writer, format string, templatePath string, s Summary) (err error) {
+	source, ok := summaryTemplates[format]
+	if !ok {
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+	if templatePath != "" {
+		content, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return err
+		}
+		source = string(content)
+	}
+
+	type executor interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+	var tmpl executor
+	if format == SummaryHTML {
+		tmpl, err = htmltemplate.New(format).Funcs(summaryFuncs).Parse(source)
+	} else {
+		tmpl, err = texttemplate.New(format).Funcs(summaryFuncs).Parse(source)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse report template: %w", err)
+	}
+	if err = tmpl.Execute(w, s); err != nil {
+		return fmt.Errorf("could not render report: %w", err)
+	}
+	return nil
+}
+
+// functions available to report templates.
+var summaryFuncs = map[string]interface{}{
+	// a bar of up to width characters, scaled so max fills it, for text histograms.
+	"bar": func(count int, max int, width int) string {
+		if max == 0 {
+			return ""
+		}
+		return strings.Repeat("#", (count*width+max-1)/max)
+	},
+	// count as a percentage of max, for html histograms.
+	"percent": func(count int, max int) int {
+		if max == 0 {
+			return 0
+		}
+		return count * 100 / max
+	},
+	"time": func(t time.Time) string {
+		return t.Format(TimeFormatHuman)
+	},
+}
+
+// built in templates of each format.
+var summaryTemplates = map[string]string{
+	SummaryMarkdown: `# {{ .Title }}
+
+Generated {{ time .Generated }}.
+{{ if .Parameters }}
+## Parameters
+
+| Setting | Value |
+| --- | --- |
+{{ range .Parameters }}| {{ .Name }} | {{ if .Value }}` + "`{{ .Value }}`" + `{{ end }} |
+{{ end }}{{ end }}{{ range .Pulls }}
+## {{ .Name }}
+
+{{ .Records }} records in {{ .Files }} files, in ` + "`{{ .OutDir }}`" + `.
+{{ if .Parameters }}
+| Setting | Value |
+| --- | --- |
+{{ range .Parameters }}| {{ .Name }} | {{ if .Value }}` + "`{{ .Value }}`" + `{{ end }} |
+{{ end }}{{ end }}{{ if .Days }}
+### Records per day
+
+` + "```" + `
+{{ $max := .MaxDay }}{{ range .Days }}{{ .Key }} {{ printf "%8d" .Count }} {{ bar .Count $max 50 }}
+{{ end }}` + "```" + `
+{{ end }}{{ if .TopTalkers }}
+### Top talkers
+
+| Host | Records |
+| --- | --- |
+{{ range .TopTalkers }}| {{ .Key }} | {{ .Count }} |
+{{ end }}{{ end }}{{ end }}{{ if .Corrupt }}
+## Corrupt source logs
+
+{{ range .Corrupt }}- ` + "`{{ .LogFile }}`" + `: {{ .Err }}
+{{ end }}{{ end }}{{ if .Mismatched }}
+## Checksum mismatches
+
+{{ range .Mismatched }}- ` + "`{{ .LogFile }}`" + `: {{ .Err }}
+{{ end }}{{ end }}`,
+
+	SummaryHTML: `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.bar { background: #4a7ab5; height: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>Generated {{ time .Generated }}.</p>
+{{ if .Parameters }}<h2>Parameters</h2>
+<table>
+<tr><th>Setting</th><th>Value</th></tr>
+{{ range .Parameters }}<tr><td>{{ .Name }}</td><td><code>{{ .Value }}</code></td></tr>
+{{ end }}</table>
+{{ end }}{{ range .Pulls }}<h2>{{ .Name }}</h2>
+<p>{{ .Records }} records in {{ .Files }} files, in <code>{{ .OutDir }}</code>.</p>
+{{ if .Parameters }}<table>
+<tr><th>Setting</th><th>Value</th></tr>
+{{ range .Parameters }}<tr><td>{{ .Name }}</td><td><code>{{ .Value }}</code></td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Days }}<h3>Records per day</h3>
+<table>
+{{ $max := .MaxDay }}{{ range .Days }}<tr><td>{{ .Key }}</td><td>{{ .Count }}</td><td style="width: 20em"><div class="bar" style="width: {{ percent .Count $max }}%"></div></td></tr>
+{{ end }}</table>
+{{ end }}{{ if .TopTalkers }}<h3>Top talkers</h3>
+<table>
+<tr><th>Host</th><th>Records</th></tr>
+{{ range .TopTalkers }}<tr><td>{{ .Key }}</td><td>{{ .Count }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ end }}{{ if .Corrupt }}<h2>Corrupt source logs</h2>
+<ul>
+{{ range .Corrupt }}<li><code>{{ .LogFile }}</code>: {{ .Err }}</li>
+{{ end }}</ul>
+{{ end }}{{ if .Mismatched }}<h2>Checksum mismatches</h2>
+<ul>
+{{ range .Mismatched }}<li><code>{{ .LogFile }}</code>: {{ .Err }}</li>
+{{ end }}</ul>
+{{ end }}</body>
+</html>
+`,
+}
@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formats and compressions of the logs of a synthetic archive. Logs are compressed with
+// CompressGzip or CompressZstd, or left as plain .log files with SynthUncompressed.
+const (
+	SynthJSON         = "json"
+	SynthTSV          = "tsv"
+	SynthUncompressed = "none"
+)
+
+// SynthConfig describes a synthetic Zeek archive, to exercise pulls without real logs. Records
+// are made up from the fields of each log type: hosts, ports, times and the like get values of
+// their kind, and any other field is left unset, as Zeek does for fields it has no value for.
+// Connections are from 10.0.0.0/24 to 192.0.2.0/24 and 198.51.100.0/24, so they can be
+// filtered on by host.
+type SynthConfig struct {
+	Start          time.Time // first day of the archive
+	Days           int       // number of days, each in a date directory
+	LogTypes       []string  // log types to write an hourly log of
+	RecordsPerHour int       // records in each hourly log
+	Format         string    // SynthJSON or SynthTSV
+	Compress       string    // CompressGzip, CompressZstd or SynthUncompressed
+	Seed           int64     // seed of the made up values, so the same config writes the same archive
+}
+
+// returns the formats a synthetic archive can be written in.
+func SynthFormats() []string {
+	return []string{SynthJSON, SynthTSV}
+}
+
+// returns the compressions a synthetic archive can be written with.
+func SynthCompressions() []string {
+	return append(Compressions(), SynthUncompressed)
+}
+
+// writes the synthetic archive described by config into logDir, one date directory per day
+// holding an hourly log of each log type, named as Zeek rotates them. Fields of the log types
+// are taken from known. Returns the number of log files written.
+func GenerateArchive(logDir string, config SynthConfig, known LogTypes) (files int, err error) {
+	rng := rand.New(rand.NewSource(config.Seed))
+	start := time.Date(config.Start.Year(), config.Start.Month(), config.Start.Day(), 0, 0, 0, 0, time.UTC)
+	for day := 0; day < config.Days; day++ {
+		date := start.AddDate(0, 0, day)
+		dateDir := filepath.Join(logDir, date.Format(TimeFormatDay))
+		if err = os.MkdirAll(dateDir, 0755); err != nil {
+			return files, err
+		}
+		for hour := 0; hour < 24; hour++ {
+			for _, logType := range config.LogTypes {
+				fields, ok := known[logType]
+				if !ok {
+					return files, errors.New(T("error.synth.logtype", logType))
+				}
+				if err = writeSynthLog(dateDir, logType, fields, date.Add(time.Duration(hour)*time.Hour), config, rng); err != nil {
+					return files, err
+				}
+				files++
+			}
+		}
+	}
+	return files, nil
+}
+
+// writes the log of logType for the hour starting at t into dateDir, compressing it once
+// written.
+func writeSynthLog(dateDir string, logType string, fields []string, t time.Time, config SynthConfig, rng *rand.Rand) (err error) {
+	name := fmt.Sprintf("%s.%s-%s.log", logType, t.Format("15:04:05"), t.Add(time.Hour).Format("15:04:05"))
+	plain := filepath.Join(dateDir, name)
+	if config.Compress != SynthUncompressed {
+		plain = PartialName(plain)
+	}
+	f, err := os.Create(plain)
+	if err != nil {
+		return err
+	}
+	w := getWriter(f)
+	if config.Format == SynthTSV {
+		writeSynthHeader(w, logType, fields, t)
+	}
+	for i := 0; i < config.RecordsPerHour; i++ {
+		// records are spread over the hour in order, as Zeek writes them.
+		ts := t.Add(time.Duration(i) * time.Hour / time.Duration(config.RecordsPerHour)).Add(time.Duration(rng.Intn(1000)) * time.Millisecond)
+		values := make([]interface{}, len(fields))
+		for j, field := range fields {
+			values[j] = synthValue(field, ts, rng)
+		}
+		if config.Format == SynthTSV {
+			writeSynthTSV(w, values)
+		} else {
+			writeSynthJSON(w, fields, values)
+		}
+	}
+	if config.Format == SynthTSV {
+		fmt.Fprintf(w, "#close\t%s\n", t.Add(time.Hour).Format("2006-01-02-15-04-05"))
+	}
+	err = w.Flush()
+	putWriter(w)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || config.Compress == SynthUncompressed {
+		return err
+	}
+	return CompressFile(plain, filepath.Join(dateDir, name+compressedExtension(config.Compress)), config.Compress)
+}
+
+// writes the header of a TSV log, as Zeek writes it.
+func writeSynthHeader(w *bufio.Writer, logType string, fields []string, t time.Time) {
+	types := make([]string, len(fields))
+	for i, field := range fields {
+		types[i] = synthType(field)
+	}
+	fmt.Fprint(w, "#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n")
+	fmt.Fprintf(w, "#path\t%s\n#open\t%s\n", logType, t.Format("2006-01-02-15-04-05"))
+	fmt.Fprintf(w, "#fields\t%s\n#types\t%s\n", strings.Join(fields, "\t"), strings.Join(types, "\t"))
+}
+
+// writes a record as a TSV line, with - for unset fields.
+func writeSynthTSV(w *bufio.Writer, values []interface{}) {
+	for i, value := range values {
+		if i > 0 {
+			w.WriteByte('\t')
+		}
+		switch value := value.(type) {
+		case nil:
+			w.WriteByte('-')
+		case float64:
+			w.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+		default:
+			fmt.Fprint(w, value)
+		}
+	}
+	w.WriteByte('\n')
+}
+
+// writes a record as a JSON line, leaving out unset fields as Zeek does.
+func writeSynthJSON(w *bufio.Writer, fields []string, values []interface{}) {
+	w.WriteByte('{')
+	first := true
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+		key, _ := json.Marshal(fields[i])
+		encoded, _ := json.Marshal(value)
+		w.Write(key)
+		w.WriteByte(':')
+		w.Write(encoded)
+	}
+	w.WriteString("}\n")
+}
+
+// returns a made up value of field for a record at ts, or nil to leave it unset.
+func synthValue(field string, ts time.Time, rng *rand.Rand) interface{} {
+	switch {
+	case field == "ts":
+		return float64(ts.UnixNano()/int64(time.Millisecond)) / 1000
+	case field == "uid" || field == "fuid":
+		return synthUID(field, rng)
+	case field == "id.orig_h":
+		return fmt.Sprintf("10.0.0.%d", 1+rng.Intn(254))
+	case field == "id.resp_h":
+		return fmt.Sprintf("%s.%d", []string{"192.0.2", "198.51.100"}[rng.Intn(2)], 1+rng.Intn(254))
+	case field == "id.orig_p":
+		return 1024 + rng.Intn(64511)
+	case field == "id.resp_p":
+		return []int{53, 80, 443, 22, 445}[rng.Intn(5)]
+	case field == "proto":
+		return []string{"tcp", "udp"}[rng.Intn(2)]
+	case field == "query" || field == "host" || field == "server_name" || field == "host_name":
+		return fmt.Sprintf("host%d.example.com", rng.Intn(100))
+	case field == "duration" || field == "rtt":
+		return float64(rng.Intn(100000)) / 1000
+	case strings.HasSuffix(field, "_bytes") || strings.HasSuffix(field, "_pkts"):
+		return rng.Intn(100000)
+	}
+	return nil
+}
+
+// returns the Zeek type of field, as in the #types header of a TSV log.
+func synthType(field string) string {
+	switch {
+	case field == "ts":
+		return "time"
+	case strings.HasSuffix(field, "_h"):
+		return "addr"
+	case strings.HasSuffix(field, "_p"):
+		return "port"
+	case field == "duration" || field == "rtt":
+		return "interval"
+	case strings.HasSuffix(field, "_bytes") || strings.HasSuffix(field, "_pkts"):
+		return "count"
+	}
+	return "string"
+}
+
+// returns a made up uid, or file id if field is fuid, such as CHhAvVGS1DHFjwGM9.
+func synthUID(field string, rng *rand.Rand) string {
+	const letters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	uid := make([]byte, 18)
+	uid[0] = 'C'
+	if field == "fuid" {
+		uid[0] = 'F'
+	}
+	for i := 1; i < len(uid); i++ {
+		uid[i] = letters[rng.Intn(len(letters))]
+	}
+	return string(uid)
+}
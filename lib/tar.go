@@ -0,0 +1,198 @@
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cold storage can pack each date of an archive into a tar container in place of its date
+// directory, such as 2021-06-01.tar, 2021-06-01.tar.gz (or .tgz) or 2021-06-01.tar.zst. The
+// logs of a container may be at its root, or under the date directory. The logs a pull would
+// read from a container are extracted into the cache first, into a directory that mirrors the
+// log directory, and are read from there. A date directory is used over a container of the
+// same date. Containers compressed with zstd are read through the system zstd command.
+
+// extensions of the tar containers of a date, in the order they are looked for.
+var tarExtensions = []string{".tar", ".tar.gz", ".tgz", ".tar.zst"}
+
+// returns the tar container of the date of t in logDir, or "" if there is none, or if the date
+// has a date directory.
+func dateContainer(logDir string, t time.Time) string {
+	dateDir := filepath.Join(logDir, t.Format(TimeFormatDay))
+	if info, err := os.Stat(dateDir); err == nil && info.IsDir() {
+		return ""
+	}
+	for _, ext := range tarExtensions {
+		if info, err := os.Stat(dateDir + ext); err == nil && !info.IsDir() {
+			return dateDir + ext
+		}
+	}
+	return ""
+}
+
+// returns the directory of the cache that logs extracted from the containers of logDir are
+// extracted into. It mirrors logDir, so extracted logs are named after it as a sensor.
+func (c LogCache) extractDir(logDir string) string {
+	return filepath.Join(c.Dir, "tar", logDir)
+}
+
+// ExtractTarLogs extracts the logs that a pull with rc would read from the tar containers of
+// its dates into the cache, except those already extracted. Returns the directory they are
+// extracted into, to set as the ExtractDir of rc, or "" if no date of the pull is in a
+// container. Progress is written to out.
+func ExtractTarLogs(rc RuntimeConfig, cache LogCache, out io.Writer) (extractDir string, err error) {
+	var used []string
+	for _, day := range pullDays(rc) {
+		container := dateContainer(rc.LogDir, day.Start)
+		if container == "" {
+			continue
+		}
+		extractDir = cache.extractDir(rc.LogDir)
+		var patterns []string
+		for curTime := day.Start; !curTime.After(day.End); curTime = curTime.Add(time.Hour) {
+			if includesHour(rc, curTime) {
+				patterns = append(patterns, hourPatterns(rc.LogType, curTime, rc.Cluster)...)
+			}
+		}
+		dateDir := filepath.Join(extractDir, day.Start.Format(TimeFormatDay))
+		logFiles, extracted, err := extractTar(container, day.Start.Format(TimeFormatDay), patterns, dateDir)
+		if err != nil {
+			return extractDir, fmt.Errorf("could not extract logs from %s: %w", container, err)
+		}
+		fmt.Fprint(out, T("tar.extract", extracted, container, len(logFiles)-extracted))
+		used = append(used, logFiles...)
+	}
+	if extractDir == "" {
+		return "", nil
+	}
+	return extractDir, cache.use(used)
+}
+
+// reads the container of a date, and extracts the logs in it matching any of patterns,
+// relative to the date directory, into dateDir. Logs already in dateDir are not extracted
+// again. Returns every log matched, and how many were extracted.
+func extractTar(container string, date string, patterns []string, dateDir string) (logFiles []string, extracted int, err error) {
+	f, err := os.Open(container)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(container, ".gz") || strings.HasSuffix(container, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer gz.Close()
+		r = gz
+	case strings.HasSuffix(container, ".zst"):
+		zstd := exec.Command("zstd", "-dc")
+		zstd.Stdin = f
+		var stderr bytes.Buffer
+		zstd.Stderr = &stderr
+		var stdout io.ReadCloser
+		if stdout, err = zstd.StdoutPipe(); err != nil {
+			return nil, 0, err
+		}
+		if err = zstd.Start(); err != nil {
+			return nil, 0, err
+		}
+		defer func() {
+			// the rest of the container is drained, so zstd is not stopped by a broken pipe.
+			io.Copy(io.Discard, stdout)
+			if waitErr := zstd.Wait(); waitErr != nil && err == nil {
+				err = fmt.Errorf("zstd: %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+			}
+		}()
+		r = stdout
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return logFiles, extracted, err
+		}
+		// members are named relative to the date directory, whether or not they are under it.
+		// Members outside of it are never extracted.
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		name = strings.TrimPrefix(name, date+"/")
+		if header.Typeflag != tar.TypeReg || !matchesAny(patterns, name) {
+			continue
+		}
+		local := filepath.Join(dateDir, filepath.FromSlash(name))
+		logFiles = append(logFiles, local)
+		if _, err := os.Stat(local); err == nil {
+			continue
+		}
+		if err = extractMember(tr, header, local); err != nil {
+			return logFiles, extracted, err
+		}
+		extracted++
+	}
+	return logFiles, extracted, nil
+}
+
+// returns whether name matches any of patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// writes the member of the container being read to local, keeping its time of modification.
+// It is written to a partial file first, so an interrupted extraction never leaves a log that
+// looks complete.
+func extractMember(tr *tar.Reader, header *tar.Header, local string) error {
+	if err := os.MkdirAll(filepath.Dir(local), 0775); err != nil {
+		return err
+	}
+	part := local + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, tr)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(part, header.ModTime, header.ModTime)
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, local)
+}
+
+// returns sensors, along with a copy of each sensor under logDir that names the logs
+// extracted from its containers into extractDir.
+func ExtractedSensors(sensors []SensorConfig, logDir string, extractDir string) []SensorConfig {
+	extracted := append([]SensorConfig{}, sensors...)
+	for _, sensor := range sensors {
+		rel, err := filepath.Rel(logDir, sensor.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		sensor.Path = filepath.Join(extractDir, rel)
+		extracted = append(extracted, sensor)
+	}
+	return extracted
+}
@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// TaskManifest is the outcome of the discovery pass of a pull: every log it reads, by the date
+// whose output it is written to. A pull given one with RuntimeConfig.Tasks reads exactly those
+// logs instead of looking for them again, so it can be run again over the same logs, such as
+// once it failed, even as the archive changes.
+type TaskManifest struct {
+	LogType string    `json:"log_type"`
+	LogDir  string    `json:"log_dir"`
+	Start   time.Time `json:"start"` // first hour of the pull
+	End     time.Time `json:"end"`   // last hour of the pull, inclusive
+	Days    []TaskDay `json:"days"`  // every date of the pull, in the order it is pulled, empty ones included
+}
+
+// TaskDay is a date of a task manifest, with the logs written to its output.
+type TaskDay struct {
+	Date   string     `json:"date"`   // such as 2021-06-01
+	Output string     `json:"output"` // name of its output file in the output directory
+	Tasks  []TaskFile `json:"tasks"`
+}
+
+// TaskFile is a log of a task manifest, with the hour it was found for.
+type TaskFile struct {
+	Log  string    `json:"log"`
+	Hour time.Time `json:"hour"`
+}
+
+// DiscoverTasks finds the logs a pull with rc reads, without reading them, as its task manifest.
+// Logs of the hour in progress that are not rotated yet are left out, as they are only copied
+// once a pull reaches them. Logs that cannot be listed are logged to logger.
+func DiscoverTasks(rc RuntimeConfig, logger *log.Logger) TaskManifest {
+	m := TaskManifest{LogType: rc.LogType, LogDir: rc.LogDir, Start: rc.StartTime, End: rc.EndTime}
+	for _, day := range pullDays(rc) {
+		date := day.Start.Truncate(24 * time.Hour)
+		taskDay := TaskDay{Date: date.Format(TimeFormatDay), Output: dateOutputName(rc, date), Tasks: []TaskFile{}}
+		for _, found := range discoverDay(rc, day, nil, false, false, logger) {
+			taskDay.Tasks = append(taskDay.Tasks, TaskFile{Log: found.file, Hour: found.hour})
+		}
+		m.Days = append(m.Days, taskDay)
+	}
+	return m
+}
+
+// returns the dates of the manifest as the days of a pull, with the logs found for each.
+func (m TaskManifest) found() (days []TimeChunk, found [][]foundLog, err error) {
+	for _, taskDay := range m.Days {
+		date, err := time.Parse(TimeFormatDay, taskDay.Date)
+		if err != nil {
+			return nil, nil, fmt.Errorf("date of task manifest: %w", err)
+		}
+		days = append(days, TimeChunk{date, date.Add(23 * time.Hour)})
+		var logs []foundLog
+		for _, task := range taskDay.Tasks {
+			logs = append(logs, foundLog{file: task.Log, hour: task.Hour})
+		}
+		found = append(found, logs)
+	}
+	return days, found, nil
+}
+
+// returns every log of the manifest, in the order they are read.
+func (m TaskManifest) logs() (logFiles []string) {
+	for _, taskDay := range m.Days {
+		for _, task := range taskDay.Tasks {
+			logFiles = append(logFiles, task.Log)
+		}
+	}
+	return logFiles
+}
+
+// WriteTaskManifest writes m as indented JSON to path.
+func WriteTaskManifest(path string, m TaskManifest) error {
+	encoded, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(encoded, '\n'), 0644)
+}
+
+// ReadTaskManifest reads the task manifest written to path by WriteTaskManifest.
+func ReadTaskManifest(path string) (m TaskManifest, err error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(encoded, &m); err != nil {
+		return m, fmt.Errorf("%s is not a task manifest: %w", path, err)
+	}
+	if m.LogType == "" {
+		return m, fmt.Errorf("%s is not a task manifest: it has no log type", path)
+	}
+	return m, nil
+}
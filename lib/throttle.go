@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// returns whether err is from running out of a resource, such as open files, memory or
+// processes, rather than from the task itself, so it may succeed with fewer tasks running.
+func IsResourceExhausted(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOMEM, syscall.EAGAIN} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// Throttle bounds the number of tasks running at once, like a pool of slots, but the number
+// of slots can be lowered while tasks run, such as once they start running out of resources.
+// It is safe for concurrent use.
+type Throttle struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	running int
+}
+
+// returns a throttle that lets up to limit tasks run at once.
+func NewThrottle(limit int) *Throttle {
+	if limit < 1 {
+		limit = 1
+	}
+	t := &Throttle{limit: limit}
+	t.cond = sync.NewCond(&t.lock)
+	return t
+}
+
+// waits until fewer tasks than the limit are running, then takes a slot.
+func (t *Throttle) Acquire() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for t.running >= t.limit {
+		t.cond.Wait()
+	}
+	t.running++
+}
+
+// gives back a slot taken by Acquire.
+func (t *Throttle) Release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.running--
+	t.cond.Broadcast()
+}
+
+// returns the number of tasks that may run at once.
+func (t *Throttle) Limit() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.limit
+}
+
+// halves from, the limit a task that ran out of resources started with, and lowers the limit
+// to it. Tasks that ran out of resources together started with the same limit, so they only
+// lower it once between them. Tasks already running keep their slot. Returns the new limit.
+func (t *Throttle) Shrink(from int) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if lowered := from / 2; lowered < t.limit {
+		t.limit = lowered
+		if t.limit < 1 {
+			t.limit = 1
+		}
+	}
+	return t.limit
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// how long to wait for the ticket webhook, or the lineage endpoint, to answer.
+const ticketTimeout = 30 * time.Second
+
+// TicketUpdate is the JSON body posted to the ticket webhook once a pull is done. The webhook,
+// such as a Jira automation or TheHive responder, decides whether to create or update the ticket.
+type TicketUpdate struct {
+	Ticket  string   `json:"ticket"`  // ticket to create or update, such as INC-1234
+	Title   string   `json:"title"`   // the command that was run
+	Host    string   `json:"host"`    // host the outputs are on
+	Records int      `json:"records"` // records found across every pull
+	Outputs []string `json:"outputs"` // output directories, and the rendered report if any
+	Summary string   `json:"summary"` // the summary rendered as markdown
+}
+
+// returns the update of ticket for the given summary. outputs are the paths the results of the
+// pull were written to.
+func NewTicketUpdate(ticket string, s Summary, outputs []string) (update TicketUpdate, err error) {
+	update = TicketUpdate{Ticket: ticket, Title: s.Title, Outputs: outputs}
+	update.Host, _ = os.Hostname()
+	for _, pull := range s.Pulls {
+		update.Records += pull.Records
+	}
+	var summary bytes.Buffer
+	if err = RenderSummary(&summary, SummaryMarkdown, "", s); err != nil {
+		return update, err
+	}
+	update.Summary = summary.String()
+	return update, nil
+}
+
+// posts the update to the ticket webhook at url. If token is set, it is sent as a bearer token.
+// Any status other than 2xx is an error, holding the start of the response.
+func PostTicketUpdate(url string, token string, update TicketUpdate) error {
+	return postJSON(url, token, update)
+}
+
+// posts value as JSON to url, with token as a bearer token if set. Any status other than 2xx
+// is an error, holding the start of the response.
+func postJSON(url string, token string, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := http.Client{Timeout: ticketTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
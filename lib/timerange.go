@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parses a time range in the format YYYY/MM/DD:HH-YYYY/MM/DD:HH, or one of the wildcard
+// forms YYYY/MM/DD:* for every hour of a day and YYYY/MM/* for every hour of a month.
+// Returns an error wrapping ErrBadTimeRange if it is malformed or the start is after the end.
+func ParseTimeRange(timeRange string) (startTime time.Time, endTime time.Time, err error) {
+	switch {
+	case strings.HasSuffix(timeRange, ":*"):
+		startTime, err = time.Parse("2006/01/02", strings.TrimSuffix(timeRange, ":*"))
+		if err != nil {
+			return startTime, endTime, &messageError{T("error.timerange"), ErrBadTimeRange}
+		}
+		return startTime, startTime.AddDate(0, 0, 1).Add(-time.Hour), nil
+	case strings.HasSuffix(timeRange, "/*"):
+		startTime, err = time.Parse("2006/01", strings.TrimSuffix(timeRange, "/*"))
+		if err != nil {
+			return startTime, endTime, &messageError{T("error.timerange"), ErrBadTimeRange}
+		}
+		return startTime, startTime.AddDate(0, 1, 0).Add(-time.Hour), nil
+	}
+
+	dateStrings := strings.Split(timeRange, "-")
+	if len(dateStrings) != 2 {
+		return startTime, endTime, &messageError{T("error.timerange"), ErrBadTimeRange}
+	}
+	startTime, startErr := time.Parse(TimeFormatShort, dateStrings[0])
+	endTime, endErr := time.Parse(TimeFormatShort, dateStrings[1])
+	if startErr != nil || endErr != nil {
+		return startTime, endTime, &messageError{T("error.timerange"), ErrBadTimeRange}
+	}
+	if startTime.After(endTime) {
+		return startTime, endTime, &messageError{T("error.rangeorder", startTime.Format(TimeFormatHuman), endTime.Format(TimeFormatHuman)), ErrBadTimeRange}
+	}
+	return startTime, endTime, nil
+}
+
+// TimeChunk is one piece of a time range split by SplitTimeRange. Both ends are inclusive hours.
+type TimeChunk struct {
+	Start time.Time
+	End   time.Time
+}
+
+// returns a name for the chunk that is unique within its time range and safe to use as a
+// directory name, such as 2021-06-01T00_2021-06-07T23.
+func (c TimeChunk) Name() string {
+	return c.Start.Format(TimeFormatChunk) + "_" + c.End.Format(TimeFormatChunk)
+}
+
+// parses a chunk size such as 7d, 2w or 12h. Days and weeks are accepted on top of the units
+// of time.ParseDuration. Returns an error wrapping ErrBadTimeRange if the size is not a
+// positive whole number of hours.
+func ParseChunkSize(chunkSize string) (size time.Duration, err error) {
+	err = &messageError{T("error.chunk", chunkSize), ErrBadTimeRange}
+	size, ok := parseDays(chunkSize)
+	if !ok || size < time.Hour || size%time.Hour != 0 {
+		return size, err
+	}
+	return size, nil
+}
+
+// parses a duration such as 30d, 2w or 12h, accepting days and weeks on top of the units of
+// time.ParseDuration. Returns false if it is not one, or is too long for a time.Duration
+// rather than letting it wrap around into a short one.
+func parseDays(duration string) (time.Duration, bool) {
+	if strings.HasSuffix(duration, "d") || strings.HasSuffix(duration, "w") {
+		unit := 24 * time.Hour
+		if strings.HasSuffix(duration, "w") {
+			unit *= 7
+		}
+		count, e := strconv.ParseInt(duration[:len(duration)-1], 10, 64)
+		if e != nil || count > math.MaxInt64/int64(unit) || count < math.MinInt64/int64(unit) {
+			return 0, false
+		}
+		return time.Duration(count) * unit, true
+	}
+	size, e := time.ParseDuration(duration)
+	return size, e == nil
+}
+
+// splits the inclusive hours from startTime to endTime into consecutive chunks of the given
+// size. The last chunk ends at endTime, so it may be shorter.
+func SplitTimeRange(startTime time.Time, endTime time.Time, size time.Duration) (chunks []TimeChunk) {
+	for chunkStart := startTime; !chunkStart.After(endTime); chunkStart = chunkStart.Add(size) {
+		chunkEnd := chunkStart.Add(size - time.Hour)
+		if chunkEnd.After(endTime) {
+			chunkEnd = endTime
+		}
+		chunks = append(chunks, TimeChunk{chunkStart, chunkEnd})
+	}
+	return chunks
+}
+
+// TimeMask selects the hours of a time range to pull, such as business hours on weekdays.
+// An hour is selected if it is in Hours and on one of Days, or the opposite if Invert.
+type TimeMask struct {
+	Hours  [24]bool
+	Days   [7]bool // indexed by time.Weekday
+	Invert bool
+
+	description string
+}
+
+// returns true if the hour starting at t should be pulled.
+func (m *TimeMask) Includes(t time.Time) bool {
+	return (m.Hours[t.Hour()] && m.Days[t.Weekday()]) != m.Invert
+}
+
+// describes the mask for humans, such as "hours 08-18, weekdays".
+func (m *TimeMask) String() string {
+	return m.description
+}
+
+// builds a time mask from an hour range HH-HH and day selection. The hour range includes its
+// start and excludes its end, and wraps past midnight if the end is before the start, so
+// 08-18 is business hours and 18-08 is overnight. An empty hour range selects every hour.
+// Returns nil if nothing is masked, or an error wrapping ErrBadTimeRange if hours is malformed.
+func ParseTimeMask(hours string, weekdays bool, weekends bool, invert bool) (mask *TimeMask, err error) {
+	if hours == "" && !weekdays && !weekends {
+		if invert {
+			return nil, &messageError{T("error.masknone"), ErrBadTimeRange}
+		}
+		return nil, nil
+	}
+	mask = &TimeMask{Invert: invert}
+
+	var parts []string
+	if hours == "" {
+		for h := range mask.Hours {
+			mask.Hours[h] = true
+		}
+	} else {
+		bounds := strings.Split(hours, "-")
+		start, startErr := strconv.Atoi(bounds[0])
+		end, endErr := -1, error(nil)
+		if len(bounds) == 2 {
+			end, endErr = strconv.Atoi(bounds[1])
+		}
+		if len(bounds) != 2 || startErr != nil || endErr != nil || start < 0 || start > 23 || end < 0 || end > 24 || start == end {
+			return nil, &messageError{T("error.hours", hours), ErrBadTimeRange}
+		}
+		count := (end - start + 24) % 24
+		if count == 0 {
+			count = 24
+		}
+		for h := 0; h < count; h++ {
+			mask.Hours[(start+h)%24] = true
+		}
+		parts = append(parts, fmt.Sprintf("hours %02d-%02d", start, end))
+	}
+
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekend := d == time.Saturday || d == time.Sunday
+		mask.Days[d] = (!weekdays && !weekends) || (weekdays && !weekend) || (weekends && weekend)
+	}
+	if weekdays && !weekends {
+		parts = append(parts, "weekdays")
+	} else if weekends && !weekdays {
+		parts = append(parts, "weekends")
+	}
+
+	mask.description = strings.Join(parts, ", ")
+	if invert {
+		mask.description = "outside " + mask.description
+	}
+	return mask, nil
+}
@@ -0,0 +1,361 @@
+package lib
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// UniqueValues counts the distinct values that some fields take together over the records of
+// a pull, such as every id.resp_h that was connected to, and how many records had each.
+// With Top set, only about the Top most common values are wanted, so each writer keeps a
+// bounded number of candidates rather than every value, and the counts are approximate.
+// With Salt set, the values of the HashFields are written as salted hashes instead, so the
+// counts can be shared without the values, and compared with others counted with the same salt.
+type UniqueValues struct {
+	Fields     []string
+	Top        int      // number of most common values to write, 0 for all of them.
+	HashFields []string // fields of Fields whose values are written as hashes, with Salt.
+	Salt       string
+
+	lock   sync.Mutex
+	counts map[string]map[string]int // for each writer key, records of each distinct set of values, joined by tabs.
+}
+
+// returns an empty count of the distinct values of fields.
+func NewUniqueValues(fields []string) *UniqueValues {
+	return &UniqueValues{Fields: fields, counts: make(map[string]map[string]int)}
+}
+
+// returns a writer that counts the values of the fields of the records (lines) written to it,
+// JSON records or TSV records after a #fields header, rather than passing them on. Records
+// with none of the fields are not counted. Each writer counts on its own, so tasks writing at
+// once do not wait on each other, and its counts are added to u once it is closed, replacing
+// those of an earlier writer of the same key, such as a task over the same log run again.
+func (u *UniqueValues) Writer(key string) io.WriteCloser {
+	uw := &uniqueWriter{u: u, key: key, counts: make(map[string]*int)}
+	if u.Top > 0 {
+		uw.top = newSpaceSaving(u.Top * topCandidates)
+	}
+	return uw
+}
+
+// returns a writer that counts the values of the fields of the records written to it like
+// Writer, while also passing them on to w as they are. Closing it does not close w.
+func (u *UniqueValues) Tee(key string, w io.Writer) io.WriteCloser {
+	uw := u.Writer(key).(*uniqueWriter)
+	uw.w = w
+	return uw
+}
+
+// candidates kept by each writer for every value wanted with Top, so values that are common
+// overall but not in every log still make it into the merged counts.
+const topCandidates = 10
+
+type uniqueWriter struct {
+	u       *UniqueValues
+	key     string
+	w       io.Writer // passed every record, if set.
+	fields  []string  // fields of the last #fields header, for TSV records
+	counts  map[string]*int
+	top     *spaceSaving // with Top set, counts the candidates instead of counts.
+	pending []byte       // start of a record whose newline has not been written yet
+
+	// the raw values of the fields of the JSON record last scanned, and the values joined by
+	// tabs, kept between records so counting a value already seen allocates nothing.
+	values [][]byte
+	found  []uint8 // how each field was found: not at all, by its underscored name, or by its name
+	joined []byte
+}
+
+func (uw *uniqueWriter) Write(p []byte) (n int, err error) {
+	if uw.w != nil {
+		if n, err = uw.w.Write(p); err != nil {
+			return n, err
+		}
+	}
+	n = len(p)
+	for {
+		end := bytes.IndexByte(p, '\n')
+		if end < 0 {
+			uw.pending = append(uw.pending, p...)
+			return n, nil
+		}
+		// records written whole are counted where they are, without copying them.
+		if len(uw.pending) == 0 {
+			uw.count(p[:end])
+		} else {
+			uw.pending = append(uw.pending, p[:end]...)
+			uw.count(uw.pending)
+			uw.pending = uw.pending[:0]
+		}
+		p = p[end+1:]
+	}
+}
+
+func (uw *uniqueWriter) Close() error {
+	uw.count(uw.pending)
+	uw.pending = nil
+	counts := make(map[string]int, len(uw.counts))
+	for value, n := range uw.counts {
+		counts[value] = *n
+	}
+	if uw.top != nil {
+		counts = uw.top.counts()
+	}
+	uw.u.lock.Lock()
+	defer uw.u.lock.Unlock()
+	uw.u.counts[uw.key] = counts
+	return nil
+}
+
+// counts the values of the fields of a record.
+func (uw *uniqueWriter) count(line []byte) {
+	line = bytes.TrimRight(line, "\r\n")
+	joined, set, ok := uw.scanValues(line)
+	if !ok {
+		if joined, set, ok = uw.decodeValues(line); !ok {
+			return
+		}
+	}
+	switch {
+	case !set:
+	case uw.top != nil:
+		uw.top.add(string(joined))
+	default:
+		// looking up a []byte converted to a string does not copy it, so only a value not
+		// seen before is.
+		if n := uw.counts[string(joined)]; n != nil {
+			*n++
+		} else {
+			n = new(int)
+			*n = 1
+			uw.counts[string(joined)] = n
+		}
+	}
+}
+
+// ways a field can be found in a JSON record, the later ones taking precedence.
+const (
+	fieldNotFound uint8 = iota
+	fieldUnderscored
+	fieldNamed
+)
+
+// returns the values of the fields of a JSON record joined by tabs, read without decoding it,
+// and whether any is set. The values are only good until the next record. Returns false if it
+// cannot be read this way, such as for TSV records or fields holding objects, which are left
+// to decodeValues.
+func (uw *uniqueWriter) scanValues(line []byte) (joined []byte, set bool, ok bool) {
+	if len(line) == 0 || line[0] != '{' {
+		return nil, false, false
+	}
+	fields := uw.u.Fields
+	if uw.values == nil {
+		uw.values, uw.found = make([][]byte, len(fields)), make([]uint8, len(fields))
+	}
+	for i := range fields {
+		uw.values[i], uw.found[i] = nil, fieldNotFound
+	}
+
+	ok = true
+	scanned := scanObject(line, func(key []byte, value []byte) bool {
+		if bytes.IndexByte(key, '\\') >= 0 {
+			ok = false
+			return false
+		}
+		for i, field := range fields {
+			// fields like id.orig_h can be given as id_orig_h, like in a SQL query, but a
+			// field named as given is used over one that only matches that way.
+			if string(key) == field {
+				uw.values[i], uw.found[i] = value, fieldNamed
+			} else if uw.found[i] != fieldNamed && underscoredField(key, field) {
+				uw.values[i], uw.found[i] = value, fieldUnderscored
+			}
+		}
+		return true
+	})
+	if !scanned || !ok {
+		return nil, false, false
+	}
+	joined = uw.joined[:0]
+	for i := range fields {
+		if i > 0 {
+			joined = append(joined, '\t')
+		}
+		if uw.found[i] == fieldNotFound {
+			joined = append(joined, unsetField...)
+			continue
+		}
+		var null bool
+		if joined, null, ok = appendScalarText(joined, uw.values[i]); !ok {
+			return nil, false, false
+		}
+		set = set || !null
+	}
+	uw.joined = joined
+	return joined, set, true
+}
+
+// returns the values of the fields of a record joined by tabs, decoding it in full, and
+// whether any is set.
+func (uw *uniqueWriter) decodeValues(line []byte) (joined []byte, set bool, ok bool) {
+	record, ok := sqlRecord(line, &uw.fields)
+	if !ok {
+		return nil, false, false
+	}
+	values := make([]string, len(uw.u.Fields))
+	for i, field := range uw.u.Fields {
+		value := (&sqlColumn{name: field}).eval(sqlRow{record: record})
+		set = set || value != nil
+		values[i] = sqlString(value)
+	}
+	return []byte(strings.Join(values, "\t")), set, true
+}
+
+// returns the distinct values counted so far, the most common first, and only the Top most
+// common if set, each with the number of records that had it.
+func (u *UniqueValues) Rows() (rows [][]string, counts []int) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	total := make(map[string]int)
+	for _, keyCounts := range u.counts {
+		for value, n := range keyCounts {
+			total[u.hashed(value)] += n
+		}
+	}
+	values := make([]string, 0, len(total))
+	for value := range total {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if total[values[i]] != total[values[j]] {
+			return total[values[i]] > total[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if u.Top > 0 && len(values) > u.Top {
+		values = values[:u.Top]
+	}
+	for _, value := range values {
+		rows = append(rows, strings.Split(value, "\t"))
+		counts = append(counts, total[value])
+	}
+	return rows, counts
+}
+
+// returns the values of the fields joined by tabs, with those of the HashFields hashed if
+// Salt is set. The values are hashed before they are ordered, so the order of values counted
+// as many times says nothing of the values.
+func (u *UniqueValues) hashed(joined string) string {
+	if u.Salt == "" || len(u.HashFields) == 0 {
+		return joined
+	}
+	values := strings.Split(joined, "\t")
+	for i, field := range u.Fields {
+		for _, hashField := range u.HashFields {
+			if field == hashField && i < len(values) {
+				values[i] = HashValue(u.Salt, values[i])
+			}
+		}
+	}
+	return strings.Join(values, "\t")
+}
+
+// returns the hex HMAC-SHA256 of value keyed by salt, so values can only be matched by those
+// who know the salt. Unset values are left unset.
+func HashValue(salt string, value string) string {
+	if value == unsetField {
+		return value
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writes the distinct values counted so far as TSV, with a header of the fields and count,
+// the most common values first, and only the Top most common if set.
+func (u *UniqueValues) WriteCounts(w io.Writer) error {
+	rows, counts := u.Rows()
+	if _, err := fmt.Fprintf(w, "%s\tcount\n", strings.Join(u.Fields, "\t")); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if _, err := fmt.Fprintf(w, "%s\t%d\n", strings.Join(row, "\t"), counts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spaceSaving keeps the approximate counts of the most common of a stream of values in bounded
+// memory, with the space-saving algorithm: once it holds capacity values, a new value takes
+// the place of the least counted one, along with its count. Counts are never too low, and too
+// high by at most the count of the value they replaced.
+type spaceSaving struct {
+	capacity int
+	values   []string
+	count    []int
+	index    map[string]int // position of each value in the heap.
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, index: make(map[string]int)}
+}
+
+// counts a value.
+func (s *spaceSaving) add(value string) {
+	if i, ok := s.index[value]; ok {
+		s.count[i]++
+		heap.Fix(s, i)
+		return
+	}
+	if len(s.values) < s.capacity {
+		heap.Push(s, value)
+		return
+	}
+	delete(s.index, s.values[0])
+	s.values[0] = value
+	s.index[value] = 0
+	s.count[0]++
+	heap.Fix(s, 0)
+}
+
+// returns the count of each value held.
+func (s *spaceSaving) counts() map[string]int {
+	counts := make(map[string]int, len(s.values))
+	for i, value := range s.values {
+		counts[value] = s.count[i]
+	}
+	return counts
+}
+
+// the heap of values, least counted first.
+func (s *spaceSaving) Len() int           { return len(s.values) }
+func (s *spaceSaving) Less(i, j int) bool { return s.count[i] < s.count[j] }
+func (s *spaceSaving) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.count[i], s.count[j] = s.count[j], s.count[i]
+	s.index[s.values[i]], s.index[s.values[j]] = i, j
+}
+
+func (s *spaceSaving) Push(x interface{}) {
+	s.index[x.(string)] = len(s.values)
+	s.values = append(s.values, x.(string))
+	s.count = append(s.count, 1)
+}
+
+func (s *spaceSaving) Pop() interface{} {
+	last := len(s.values) - 1
+	value := s.values[last]
+	delete(s.index, value)
+	s.values, s.count = s.values[:last], s.count[:last]
+	return value
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package lib
+
+import "os"
+
+// peak memory of a child process is not available on this platform.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
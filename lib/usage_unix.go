@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package lib
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// returns the peak resident memory of the finished process, in bytes.
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// darwin reports bytes, everything else reports kilobytes.
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss)
+	}
+	return int64(rusage.Maxrss) * 1024
+}
@@ -0,0 +1,295 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Validator collects every problem found with user provided input, so they can all
+// be reported together before anything is run, rather than one at a time.
+type Validator struct {
+	Problems []error
+
+	// the log directory is prepared by a command run later, such as a pre_run hook of a
+	// playbook mounting it, so LogDir only resolves it and LogType does not look for logs.
+	LogDirPending bool
+}
+
+// records a problem, with a message already formatted, such as by T, so it is kept as is.
+func (v *Validator) Add(message string) {
+	v.Problems = append(v.Problems, errors.New(message))
+}
+
+// records a problem from an existing error.
+func (v *Validator) AddErr(err error) {
+	v.Problems = append(v.Problems, err)
+}
+
+// returns true if any problems have been recorded.
+func (v *Validator) Failed() bool {
+	return len(v.Problems) > 0
+}
+
+// returns a *ValidationError holding all recorded problems, or nil if there are none.
+func (v *Validator) Err() error {
+	if !v.Failed() {
+		return nil
+	}
+	return &ValidationError{v.Problems}
+}
+
+// parses a time range in the format YYYY/MM/DD:HH-YYYY/MM/DD:HH, recording a problem
+// if it is malformed or the start is after the end.
+func (v *Validator) TimeRange(timeRange string) (startTime time.Time, endTime time.Time) {
+	startTime, endTime, e := ParseTimeRange(timeRange)
+	if e != nil {
+		v.AddErr(e)
+	}
+	return
+}
+
+// parses the order to pull dates in, recording a problem if it is not OrderOldestFirst or
+// OrderNewestFirst. Returns true if the newest dates should be pulled first.
+func (v *Validator) Order(order string) (newestFirst bool) {
+	if order != OrderOldestFirst && order != OrderNewestFirst {
+		v.Add(T("error.order", order, OrderOldestFirst, OrderNewestFirst))
+	}
+	return order == OrderNewestFirst
+}
+
+// parses an optional time in the format YYYY/MM/DD:HH (local time), recording a problem naming
+// the flag if it is malformed. Returns the zero time if value is empty.
+func (v *Validator) OptionalTime(flag string, value string) (t time.Time) {
+	if value == "" {
+		return t
+	}
+	t, e := time.ParseInLocation(TimeFormatShort, value, time.Local)
+	if e != nil {
+		v.Add(T("error.optionaltime", flag, value))
+	}
+	return t
+}
+
+// parses an optional size such as 500G, recording a problem naming the flag if it is
+// malformed. Returns 0 if value is empty.
+func (v *Validator) OptionalByteSize(flag string, value string) (size int64) {
+	if value == "" {
+		return 0
+	}
+	size, e := ParseByteSize(value)
+	if e != nil {
+		v.Add(T("error.bytesize", flag, value))
+	}
+	return size
+}
+
+// builds the time mask of the given hours and day selection, recording a problem if it is
+// malformed. Returns nil if nothing is masked.
+func (v *Validator) TimeMask(hours string, weekdays bool, weekends bool, invert bool) (mask *TimeMask) {
+	mask, e := ParseTimeMask(hours, weekdays, weekends, invert)
+	if e != nil {
+		v.AddErr(e)
+	}
+	return mask
+}
+
+// records a problem if the thread count is not positive.
+func (v *Validator) Threads(threads int) {
+	if threads <= 0 {
+		v.Add(T("error.threads", threads))
+	}
+}
+
+// resolves the zeek log directory, recording a problem if it is not an existing directory.
+// A remote log directory is only checked to be well formed, and is returned as it is.
+func (v *Validator) LogDir(logDir string) (resolvedLogDir string) {
+	if IsRemoteLogDir(logDir) {
+		if _, e := ParseRemoteArchive(logDir); e != nil {
+			v.AddErr(e)
+		}
+		return logDir
+	}
+	resolvedLogDir, e := filepath.Abs(logDir)
+	if e != nil {
+		v.Add(T("error.relativepath"))
+		return logDir
+	}
+	if v.LogDirPending {
+		return resolvedLogDir
+	}
+	logDirInfo, e := os.Stat(resolvedLogDir)
+	if e != nil || !logDirInfo.IsDir() {
+		v.Add(T("error.logdir", resolvedLogDir))
+	}
+	return resolvedLogDir
+}
+
+// resolves the output directory and makes sure it could be created and written to, without
+// creating it. If empty is set, an existing directory must also be empty.
+func (v *Validator) OutputDir(outputDir string, empty bool) (resolvedOutDir string) {
+	resolvedOutDir, e := filepath.Abs(outputDir)
+	if e != nil {
+		v.Add(T("error.relativepath"))
+		return outputDir
+	}
+
+	// the directory we will need to write in: the output directory if it exists, otherwise its parent.
+	writeDir := resolvedOutDir
+	outInfo, e := os.Stat(resolvedOutDir)
+	if e == nil {
+		if !outInfo.IsDir() {
+			v.Add(T("error.outdir.notdir", resolvedOutDir))
+			return
+		}
+		if empty {
+			f, e := os.Open(resolvedOutDir)
+			if e == nil {
+				_, e = f.Readdirnames(1)
+				f.Close()
+				if e != io.EOF {
+					v.AddErr(&messageError{T("error.outdir.notempty", resolvedOutDir), ErrOutputNotEmpty})
+					return
+				}
+			}
+		}
+	} else {
+		// missing parents are created as needed, so check the nearest existing ancestor.
+		writeDir = filepath.Dir(resolvedOutDir)
+		parentInfo, e := os.Stat(writeDir)
+		for os.IsNotExist(e) && writeDir != filepath.Dir(writeDir) {
+			writeDir = filepath.Dir(writeDir)
+			parentInfo, e = os.Stat(writeDir)
+		}
+		if e != nil || !parentInfo.IsDir() {
+			v.Add(T("error.outdir.parent", writeDir))
+			return
+		}
+	}
+
+	// the only portable way to know we can write is to try it.
+	probe, e := ioutil.TempFile(writeDir, ".nagini-write-test")
+	if e != nil {
+		v.Add(T("error.outdir.write", writeDir))
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return
+}
+
+// records a problem if the output directory is not under one of the allowed roots, if any
+// are set, or is under a denied root, or inside the log directory, so a pull neither fills a
+// filesystem it should not nor writes into the archive it reads. Roots can hold environment
+// variables such as $HOME, and symlinks are followed, so a link cannot get around them.
+func (v *Validator) OutputRoot(resolvedOutDir string, resolvedLogDir string, allowed []string, denied []string) {
+	outDir := realPath(resolvedOutDir)
+	if len(allowed) > 0 {
+		inAllowed := false
+		for _, root := range allowed {
+			inAllowed = inAllowed || underDir(outDir, realPath(os.ExpandEnv(root)))
+		}
+		if !inAllowed {
+			v.Add(T("error.outdir.root", resolvedOutDir, strings.Join(allowed, ", ")))
+		}
+	}
+	for _, root := range denied {
+		if underDir(outDir, realPath(os.ExpandEnv(root))) {
+			v.Add(T("error.outdir.denied", resolvedOutDir, root))
+		}
+	}
+	if resolvedLogDir != "" && !IsRemoteLogDir(resolvedLogDir) && underDir(outDir, realPath(resolvedLogDir)) {
+		v.Add(T("error.outdir.logdir", resolvedOutDir, resolvedLogDir))
+	}
+}
+
+// records a problem if root, whose expired outputs are to be pruned, is not a directory, or
+// holds the log directory or is inside it, so pruning never removes logs.
+func (v *Validator) PruneRoot(root string, logDir string) {
+	info, e := os.Stat(os.ExpandEnv(root))
+	if e != nil || !info.IsDir() {
+		v.Add(T("error.prune.root", root))
+		return
+	}
+	if logDir == "" || IsRemoteLogDir(logDir) {
+		return
+	}
+	real, realLogDir := realPath(os.ExpandEnv(root)), realPath(logDir)
+	if underDir(realLogDir, real) || underDir(real, realLogDir) {
+		v.Add(T("error.prune.logdir", root, logDir))
+	}
+}
+
+// returns path made absolute with the symlinks of its nearest existing ancestor followed, as
+// the parts that do not exist yet cannot be links.
+func realPath(path string) string {
+	path, _ = filepath.Abs(path)
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{real}, missing...)...)
+		}
+		if dir == filepath.Dir(dir) {
+			return path
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// whether path is dir or inside it. Both must be clean and absolute.
+func underDir(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// records a problem if no logs of the given type exist in any date directory of the time range.
+// Only checks when the log directory and time range are themselves valid, and the log
+// directory is local, since listing a remote one is left until the logs are fetched. A date
+// packed into a tar container is assumed to have logs, since reading it could take long. A time
+// range including the hour in progress also has the un-rotated log in the current directory.
+func (v *Validator) LogType(logType string, resolvedLogDir string, startTime time.Time, endTime time.Time) {
+	if v.Failed() || v.LogDirPending || logType == "" || IsRemoteLogDir(resolvedLogDir) {
+		return
+	}
+	for curDate := startTime.Truncate(24 * time.Hour); !curDate.After(endTime); curDate = curDate.AddDate(0, 0, 1) {
+		// per-worker logs of a cluster count too, whether or not they will be pulled.
+		dateDir := fmt.Sprintf("%s/%04d-%02d-%02d", resolvedLogDir, curDate.Year(), curDate.Month(), curDate.Day())
+		if dateContainer(resolvedLogDir, curDate) != "" {
+			return
+		}
+		for _, pattern := range datePatterns(logType, true) {
+			if matches, _ := filepath.Glob(filepath.Join(dateDir, pattern)); len(matches) > 0 {
+				return
+			}
+		}
+	}
+	if now := time.Now(); !startTime.After(now) && endTime.Add(time.Hour).After(now) {
+		if _, e := os.Stat(currentLog(resolvedLogDir, logType)); e == nil {
+			return
+		}
+	}
+	v.AddErr(&messageError{T("error.logtype", logType, resolvedLogDir, startTime.Format(TimeFormatDate), endTime.Format(TimeFormatDate)), ErrNoMatches})
+}
+
+// records a problem for each of the given fields that logType does not have, suggesting the
+// field that was likely meant. Log types that are not known are not checked.
+func (v *Validator) Fields(logType string, fields []string, known LogTypes) {
+	for _, field := range fields {
+		if known.HasField(logType, field) {
+			continue
+		}
+		if closest := known.closestField(logType, field); closest != "" {
+			v.Add(T("error.field.closest", field, logType, closest))
+		} else {
+			names := append([]string{}, known[logType]...)
+			sort.Strings(names)
+			v.Add(T("error.field", field, logType, strings.Join(names, ", ")))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// WhereFilter keeps the records of a log matching a condition, in-process, rather than running
+// a command on each log. Conditions are those of the WHERE clause of SQLQuery, also written
+// as id.resp_p == 3389 && id.orig_h in 10.0.0.0/8. Fields are read by name from JSON records,
+// and from TSV records by their #fields header. Headers are passed on, so TSV records can still
+// be read by field.
+type WhereFilter struct {
+	condition string
+	expr      sqlExpr
+}
+
+// returns a filter keeping the records matching condition, or an error if it is malformed.
+func NewWhereFilter(condition string) (*WhereFilter, error) {
+	if strings.TrimSpace(condition) == "" {
+		return nil, errors.New(T("error.where.empty"))
+	}
+	expr, err := parseSQLCondition(condition)
+	if err != nil {
+		return nil, errors.New(T("error.where", condition, err))
+	}
+	return &WhereFilter{condition: condition, expr: expr}, nil
+}
+
+// returns the condition of the filter.
+func (f *WhereFilter) String() string {
+	return f.condition
+}
+
+// returns whether record matches the condition. Records that cannot be decoded never do.
+func (f *WhereFilter) matches(record []byte, fields *[]string) bool {
+	decoded, ok := sqlRecord(record, fields)
+	if !ok {
+		return false
+	}
+	truth, _ := sqlTruth(f.expr.eval(sqlRow{record: decoded}))
+	return truth
+}
+
+// copies the headers of input, and the records matching the condition, to output. Stops early
+// once ctx is cancelled, such as when no more records are wanted, or once writing to output
+// fails.
+func (f *WhereFilter) Filter(ctx context.Context, input io.Reader, output io.Writer) error {
+	lines, w := newLineReader(input), getWriter(output)
+	defer lines.close()
+	defer putWriter(w)
+	var fields []string // of the last #fields header, for TSV records
+	for ctx.Err() == nil {
+		line, readErr := lines.next()
+		record := bytes.TrimRight(line, "\r\n")
+		keep := false
+		switch {
+		case len(record) == 0:
+		case record[0] == '#':
+			keep = true
+			decodeRecord(record, &fields)
+		default:
+			keep = f.matches(record, &fields)
+		}
+		if keep {
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	return w.Flush()
+}
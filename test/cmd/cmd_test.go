@@ -0,0 +1,1926 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/cmd"
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+const testRange = "2021/06/01:00-2021/06/01:01"
+
+// runs the tests with a HOME of their own, so the pulls they run are not recorded in the
+// history file of whoever runs them.
+func TestMain(m *testing.M) {
+	home, e := os.MkdirTemp("", "nagini-home")
+	if e != nil {
+		panic(e)
+	}
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.Setenv("HOME", oldHome)
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// writes a synthetic zeek archive for 2021-06-01 holding the given conn records.
+func writeLogDir(t *testing.T, records ...string) string {
+	logDir := t.TempDir()
+	writeLog(t, logDir, "2021-06-01", records...)
+	return logDir
+}
+
+// writes a conn log for the first hour of the given date (YYYY-MM-DD) into logDir.
+func writeLog(t *testing.T, logDir string, date string, records ...string) {
+	dateDir := filepath.Join(logDir, date)
+	if e := os.MkdirAll(dateDir, 0755); e != nil {
+		t.Fatal(e)
+	}
+	f, e := os.Create(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	for _, record := range records {
+		zw.Write([]byte(record + "\n"))
+	}
+	if e := zw.Close(); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// runs nagini with the given args, returning what was written to stdout and stderr.
+func execute(t *testing.T, stdin string, args ...string) (stdout string, stderr string, e error) {
+	var outBuf, errBuf bytes.Buffer
+	e = cmd.ExecuteWith(args, strings.NewReader(stdin), &outBuf, &errBuf)
+	return outBuf.String(), errBuf.String(), e
+}
+
+// Test that the play command is registered under its own name.
+func TestPlayRegistered(t *testing.T) {
+	_, stderr, e := execute(t, "", "help")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stderr, "play") {
+		t.Errorf("help does not list play:\n%s", stderr)
+	}
+}
+
+// Test that bad arguments are returned as a validation error, rather than exiting.
+func TestRunBadArgs(t *testing.T) {
+	_, _, e := execute(t, "", "run", "-N", "-r", "bad", "-t", "0", "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Fatalf("expected *lib.ValidationError, got %v", e)
+	}
+	if len(ve.Problems) < 2 {
+		t.Errorf("expected every problem to be reported, got %v", ve.Problems)
+	}
+}
+
+// Test that run writes filtered records to stdout with --stdout.
+func TestRunStdout(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	stdout, _, e := execute(t, "", "run", "-N", "-S",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "first\nsecond\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+}
+
+// Test that the confirmation prompt reads from the injected stdin.
+func TestRunDeclined(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	outDir := filepath.Join(t.TempDir(), "out")
+	// prompts are skipped by default in a container, such as the one the tests may run in.
+	_, _, e := execute(t, "n\n", "run", "--noconfirm=false", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("output directory created after declining: %v", e)
+	}
+}
+
+// Test that play runs each data source into its own directory, taking settings from the playbook.
+func TestPlay(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+data_sources:
+  - name: all
+    log_type: conn
+    command: [cat]
+  - name: second
+    log_type: conn
+    command: [grep, second]
+`), 0644)
+
+	_, _, e := execute(t, "", "play", "-N", playbook)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for name, expected := range map[string]string{"all": "first\nsecond\n", "second": "second\n"} {
+		content, e := os.ReadFile(filepath.Join(outDir, name, "conn-2021-06-01.json"))
+		if e != nil {
+			t.Errorf("%s: %v", name, e)
+		} else if string(content) != expected {
+			t.Errorf("%s: unexpected output: %q", name, content)
+		}
+	}
+}
+
+// Test that the pre_run hooks of a playbook run before its log directory is looked in, and its
+// post_run hooks once every data source is pulled, and that a failed hook only stops the run
+// if it is not to be warned about.
+func TestPlayHooks(t *testing.T) {
+	snapshot := writeLogDir(t, "first")
+	logDir := filepath.Join(t.TempDir(), "mnt")
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	marker := filepath.Join(t.TempDir(), "ingested")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+pre_run:
+  - command: [cp, -r, `+snapshot+`, `+logDir+`]
+  - command: ["false"]
+    on_failure: warn
+post_run:
+  - command: [sh, -c, 'echo "$NAGINI_OUTPUT_DIR" > `+marker+`']
+data_sources:
+  - name: all
+    log_type: conn
+    command: [cat]
+`), 0644)
+
+	_, stderr, e := execute(t, "", "play", "-N", playbook)
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if content, e := os.ReadFile(filepath.Join(outDir, "all", "conn-2021-06-01.json")); e != nil || string(content) != "first\n" {
+		t.Errorf("unexpected output: %q, %v", content, e)
+	}
+	if content, e := os.ReadFile(marker); e != nil || strings.TrimSpace(string(content)) != outDir {
+		t.Errorf("post_run hook not run with the output directory: %q, %v", content, e)
+	}
+
+	// the logs the hooks mount are checked by --verify-access, and sized against
+	// --max-input-size, once mounted.
+	os.RemoveAll(outDir)
+	os.RemoveAll(logDir)
+	if _, stderr, e := execute(t, "", "play", "-N", "--verify-access", playbook); e != nil || !strings.Contains(stderr, "conn: 2 paths checked, 0 cannot be read.") {
+		t.Errorf("expected the mounted logs to be checked, got %q (%v)", stderr, e)
+	}
+	if _, e := os.Stat(filepath.Join(outDir, "all")); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled, got %v", e)
+	}
+	os.RemoveAll(logDir)
+	if _, _, e := execute(t, "", "play", "-N", "--max-input-size", "10", playbook); e == nil || !strings.Contains(e.Error(), "over the --max-input-size of 10") {
+		t.Errorf("expected the mounted logs to be refused, got %v", e)
+	}
+	if _, e := os.Stat(filepath.Join(outDir, "all")); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled, got %v", e)
+	}
+
+	// a hook that fails stops the run before anything is pulled.
+	os.RemoveAll(outDir)
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+pre_run:
+  - command: ["false"]
+data_sources:
+  - name: all
+    log_type: conn
+    command: [cat]
+`), 0644)
+	if _, _, e := execute(t, "", "play", "-N", playbook); e == nil || !strings.Contains(e.Error(), "pre_run") {
+		t.Errorf("expected the failed pre_run hook to be reported, got %v", e)
+	}
+	if _, e := os.Stat(filepath.Join(outDir, "all")); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled, got %v", e)
+	}
+}
+
+// Test that problems in a playbook are reported together.
+func TestPlayBadPlaybook(t *testing.T) {
+	playbook := filepath.Join(t.TempDir(), "bad.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+pre_run:
+  - on_failure: retry
+data_sources:
+  - log_type: conn
+    command: [cat]
+  - name: dup
+    log_type: conn
+    command: [cat]
+  - name: dup
+    log_type: conn
+    command: [cat]
+`), 0644)
+
+	_, _, e := execute(t, "", "play", "-N", "-o", filepath.Join(t.TempDir(), "out"), "-i", writeLogDir(t), playbook)
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Fatalf("expected *lib.ValidationError, got %v", e)
+	}
+	if len(ve.Problems) != 4 {
+		t.Errorf("expected 4 problems, got %v", ve.Problems)
+	}
+}
+
+// Test that examples are written to stdout.
+func TestExamples(t *testing.T) {
+	stdout, _, e := execute(t, "", "examples", "run")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stdout, "nagini run") {
+		t.Errorf("unexpected examples: %q", stdout)
+	}
+}
+
+// Test that --show-config-sources lists where each setting came from, without running.
+func TestShowConfigSources(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+data_sources:
+  - name: all
+    log_type: conn
+    threads: 2
+    command: [cat]
+`), 0644)
+
+	stdout, _, e := execute(t, "", "play", "--show-config-sources", "-i", logDir, "-o", outDir, playbook)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, expected := range []string{"timerange", "(playbook)", "logdir", "(flag)", "concat", "(default)"} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("missing %q in:\n%s", expected, stdout)
+		}
+	}
+	if _, e := os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("output directory created by --show-config-sources: %v", e)
+	}
+}
+
+// Test that backfill pulls each chunk into its own directory, and skips finished chunks on a rerun.
+func TestBackfill(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	writeLog(t, logDir, "2021-06-02", "first")
+	outDir := filepath.Join(t.TempDir(), "backfill")
+	args := []string{"backfill", "-N", "-i", logDir, "-o", outDir, "-r", "2021/06/01:00-2021/06/02:23", "--chunk", "1d", "conn", "cat"}
+
+	_, stderr, e := execute(t, "", args...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, day := range []string{"01", "02"} {
+		chunk := "2021-06-" + day + "T00_2021-06-" + day + "T23"
+		content, e := os.ReadFile(filepath.Join(outDir, chunk, "conn-2021-06-"+day+".json"))
+		if e != nil || string(content) != "first\n" {
+			t.Errorf("%s: unexpected output %q (%v)", chunk, content, e)
+		}
+	}
+
+	_, stderr, e = execute(t, "", args...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stderr, "0 done, 2 skipped, 0 failed") {
+		t.Errorf("expected every chunk to be skipped:\n%s", stderr)
+	}
+}
+
+// Test that a backfill fails at once while another holds its output directory.
+func TestBackfillLocked(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	outDir := t.TempDir()
+	lock, e := lib.LockDir(outDir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer lock.Unlock()
+
+	_, _, e = execute(t, "", "backfill", "-N", "-i", logDir, "-o", outDir, "-r", testRange, "--chunk", "1d", "conn", "cat")
+	if !errors.Is(e, lib.ErrOutputLocked) {
+		t.Errorf("expected ErrOutputLocked, got %v", e)
+	}
+	if _, e := os.Stat(filepath.Join(outDir, lib.CheckpointFile)); !os.IsNotExist(e) {
+		t.Errorf("expected the checkpoint to be left alone, got %v", e)
+	}
+}
+
+// Test that --script - runs an inline script read from stdin, with the command args as its
+// args, and removes it once done, as do playbooks with an inline script.
+func TestRunInlineScript(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "nagini-script-*"))
+	script := "#!/bin/sh\ngrep \"$1\"\n"
+	stdout, stderr, e := execute(t, script, "run", "-N", "-S", "--script", "-", "-i", logDir, "-r", testRange, "conn", "sec")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if stdout != "second\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+data_sources:
+  - name: second
+    log_type: conn
+    script: |
+      #!/bin/sh
+      grep "$1"
+    command: [sec]
+`), 0644)
+	if _, stderr, e := execute(t, "", "play", "-N", playbook); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if content, e := os.ReadFile(filepath.Join(outDir, "second", "conn-2021-06-01.json")); e != nil || string(content) != "second\n" {
+		t.Errorf("unexpected output of the playbook: %q, %v", content, e)
+	}
+	if after, _ := filepath.Glob(filepath.Join(os.TempDir(), "nagini-script-*")); len(after) != len(before) {
+		t.Errorf("expected the inline scripts to be removed, found %v", after)
+	}
+
+	// a script on stdin leaves nothing to confirm with, and must name its interpreter.
+	for _, c := range []struct{ stdin, confirm string }{{script, "--noconfirm=false"}, {"grep sec\n", "-N"}, {"", "-N"}} {
+		args := []string{"run", c.confirm, "-S", "--script", "-", "-i", logDir, "-r", testRange, "conn"}
+		var ve *lib.ValidationError
+		if _, _, e := execute(t, c.stdin, args...); !errors.As(e, &ve) {
+			t.Errorf("%q %s: expected *lib.ValidationError, got %v", c.stdin, c.confirm, e)
+		}
+	}
+}
+
+// Test that a script that would fail every task is rejected before any is started: one
+// missing a required command, or with --self-test, failing its self-test.
+func TestRunScriptPreflight(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	script := filepath.Join(t.TempDir(), "filter.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\n# requires: grep, nagini-no-such-tool\ngrep \"$1\"\n"), 0755)
+	_, _, e := execute(t, "", "run", "-N", "-S", "-i", logDir, "-r", testRange, "conn", script, "sec")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || !strings.Contains(e.Error(), "nagini-no-such-tool") {
+		t.Errorf("expected the missing required command to be rejected, got %v", e)
+	}
+
+	os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = --self-test ] && { echo intel feed is empty; exit 1; }\ngrep \"$1\"\n"), 0755)
+	if stdout, stderr, e := execute(t, "", "run", "-N", "-S", "-i", logDir, "-r", testRange, "conn", script, "sec"); e != nil || stdout != "second\n" {
+		t.Fatalf("unexpected output %q without --self-test, %v:\n%s", stdout, e, stderr)
+	}
+	_, _, e = execute(t, "", "run", "-N", "-S", "--self-test", "-i", logDir, "-r", testRange, "conn", script, "sec")
+	if !errors.As(e, &ve) || !strings.Contains(e.Error(), "intel feed is empty") {
+		t.Errorf("expected the failed self-test to be rejected, got %v", e)
+	}
+}
+
+// Test that --max-records stops the pull once enough records were found.
+func TestRunMaxRecords(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second", "third")
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--max-records", "2",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "first\nsecond\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+}
+
+// Test that --order newest-first filters the newest dates first, but still writes output oldest first.
+func TestRunNewestFirst(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	writeLog(t, logDir, "2021-06-02", "second")
+	filtered := filepath.Join(t.TempDir(), "filtered")
+
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "-t", "1", "--order", "newest-first",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", "2021/06/01:00-2021/06/02:23", "--", "conn", "tee", "-a", filtered)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "first\nsecond\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if order, _ := os.ReadFile(filtered); string(order) != "second\nfirst\n" {
+		t.Errorf("expected the newest date to be filtered first, got %q", order)
+	}
+}
+
+// Test that corrupt logs are listed and skipped by default, and fail the pull with --fail-on-corrupt.
+func TestRunCorrupt(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	// a log that is not gzip at all, and one cut off mid-stream.
+	os.WriteFile(filepath.Join(dateDir, "conn.01:00:00-02:00:00.log.gz"), []byte("not gzip"), 0644)
+	var truncated bytes.Buffer
+	zw := gzip.NewWriter(&truncated)
+	for i := 0; i < 10000; i++ {
+		zw.Write([]byte("truncated record\n"))
+	}
+	zw.Close()
+	os.WriteFile(filepath.Join(dateDir, "conn.02:00:00-03:00:00.log.gz"), truncated.Bytes()[:truncated.Len()/2], 0644)
+	timeRange := "2021/06/01:00-2021/06/01:02"
+
+	_, stderr, e := execute(t, "", "run", "-N", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", timeRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, corrupt := range []string{"conn.01:00:00-02:00:00.log.gz", "conn.02:00:00-03:00:00.log.gz"} {
+		if !strings.Contains(stderr, corrupt) {
+			t.Errorf("%s not reported as corrupt:\n%s", corrupt, stderr)
+		}
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	_, _, e = execute(t, "", "run", "-N", "--fail-on-corrupt", "-i", logDir, "-o", outDir, "-r", timeRange, "conn", "cat")
+	if !errors.Is(e, lib.ErrCorruptInput) {
+		t.Errorf("expected error matching %v, got %v", lib.ErrCorruptInput, e)
+	}
+	// the date of the corrupt logs is not written from the rest of its logs.
+	entries, _ := os.ReadDir(outDir)
+	for _, entry := range entries {
+		if entry.Name() != lib.OutputMarker {
+			t.Errorf("expected no output of the date with corrupt logs, found %s", entry.Name())
+		}
+	}
+}
+
+// Test that checksum sidecars are not filtered as logs, and are verified with --verify-checksums.
+func TestRunVerifyChecksums(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	logFile := filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz")
+	content, _ := os.ReadFile(logFile)
+	sum := sha256.Sum256(content)
+	os.WriteFile(logFile+lib.ChecksumSuffix, []byte(hex.EncodeToString(sum[:])+"\n"), 0644)
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "--verify-checksums",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "first\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if !strings.Contains(stderr, "1 verified, 0 without a sidecar, 0 mismatched") {
+		t.Errorf("checksum not verified:\n%s", stderr)
+	}
+}
+
+// Test that --modified-since skips logs by their modification time, whatever their date directory.
+func TestRunModifiedSince(t *testing.T) {
+	logDir := writeLogDir(t, "old")
+	writeLog(t, logDir, "2021-06-02", "restored")
+	old := time.Date(2021, 6, 1, 1, 0, 0, 0, time.Local)
+	os.Chtimes(filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"), old, old)
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "--modified-since", "2021/07/01:00",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", "2021/06/01:00-2021/06/02:23", "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "restored\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if !strings.Contains(stderr, "Skipped 1 log(s)") {
+		t.Errorf("skipped log not reported:\n%s", stderr)
+	}
+}
+
+// Test that --month pulls the whole month, and cannot be combined with --timerange.
+func TestRunMonth(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	writeLog(t, logDir, "2021-06-30", "last")
+	writeLog(t, logDir, "2021-07-01", "next month")
+
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--month", "2021/06",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "first\nlast\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "--month", "2021/06", "-r", testRange, "conn", "cat")
+	if e == nil {
+		t.Error("expected --month and --timerange to conflict")
+	}
+}
+
+// Test that play fills in playbook variables from --var.
+func TestPlayVars(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+data_sources:
+  - name: match
+    log_type: conn
+    command: [grep, "{{ .pattern }}"]
+`), 0644)
+
+	if _, _, e := execute(t, "", "play", "-N", playbook); e == nil {
+		t.Error("expected an error for a missing variable")
+	}
+	if _, _, e := execute(t, "", "play", "-N", "--var", "pattern=sec", playbook); e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(filepath.Join(outDir, "match", "conn-2021-06-01.json"))
+	if e != nil || string(content) != "second\n" {
+		t.Errorf("unexpected output %q (%v)", content, e)
+	}
+}
+
+// Test that --check validates a playbook, rejecting unknown keys, without running it.
+func TestPlayCheck(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	body := `time_range: ` + testRange + `
+output_dir: ` + outDir + `
+zeek_log_dir: ` + logDir + `
+data_sources:
+  - name: all
+    log_type: conn
+    command: [cat]
+`
+	os.WriteFile(playbook, []byte(body), 0644)
+
+	stdout, _, e := execute(t, "", "play", "--check", playbook)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stdout, "valid") {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if _, e := os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be run, got %v", e)
+	}
+
+	os.WriteFile(playbook, []byte(body+"    thread: 4\n"), 0644)
+	if _, _, e := execute(t, "", "play", "--check", playbook); e == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+// Test that playbooks in the library are listed and run by name.
+func TestPlaybookLibrary(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	library := t.TempDir()
+	os.MkdirAll(filepath.Join(library, "conn"), 0755)
+	os.WriteFile(filepath.Join(library, "conn", "second.yaml"), []byte(`description: records matching second
+time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+data_sources:
+  - name: second
+    log_type: conn
+    command: [grep, second]
+`), 0644)
+
+	stdout, _, e := execute(t, "", "playbook", "list", "--playbook-dir", library)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stdout, "conn/second") || !strings.Contains(stdout, "records matching second") {
+		t.Errorf("unexpected list: %q", stdout)
+	}
+
+	if _, _, e := execute(t, "", "playbook", "run", "-N", "--playbook-dir", library, "conn/second"); e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(filepath.Join(outDir, "second", "conn-2021-06-01.json"))
+	if e != nil || string(content) != "second\n" {
+		t.Errorf("unexpected output %q (%v)", content, e)
+	}
+}
+
+// Test that --render-report writes a report of the output into the output directory.
+func TestRunRenderReport(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.5"}`, `{"id.orig_h":"10.0.0.6"}`)
+	outDir := filepath.Join(t.TempDir(), "out")
+	_, _, e := execute(t, "", "run", "-N", "--render-report", "markdown", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "grep", "10.0.0.5")
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(filepath.Join(outDir, "report.md"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, expected := range []string{"nagini run", "grep 10.0.0.5", "| 10.0.0.5 | 1 |", "2021-06-01"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("report is missing %q:\n%s", expected, content)
+		}
+	}
+
+	if _, _, e := execute(t, "", "run", "-N", "-S", "--render-report", "pdf", "-i", logDir, "-r", testRange, "conn", "cat"); e == nil {
+		t.Error("expected an error for an unknown format with --stdout")
+	}
+}
+
+// Test that --provenance writes a sidecar next to each output file, describing the pull it was
+// made by, which the report does not count as an output.
+func TestRunProvenance(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.5"}`)
+	outDir := filepath.Join(t.TempDir(), "out")
+	_, _, e := execute(t, "", "run", "-N", "--provenance", "--render-report", "markdown", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "grep", "10.0.0.5")
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(filepath.Join(outDir, "conn-2021-06-01.json"+lib.ProvenanceExtension))
+	if e != nil {
+		t.Fatal(e)
+	}
+	var p lib.Provenance
+	if e = json.Unmarshal(content, &p); e != nil {
+		t.Fatal(e)
+	}
+	if p.File != "conn-2021-06-01.json" || !strings.HasSuffix(p.Filter, "grep 10.0.0.5") || p.LogType != "conn" || p.LogDir != logDir || p.Version == "" {
+		t.Errorf("unexpected provenance: %+v", p)
+	}
+	if !strings.Contains(p.CommandLine, "--provenance=true") || !strings.HasSuffix(p.CommandLine, "conn grep 10.0.0.5") {
+		t.Errorf("unexpected command line: %s", p.CommandLine)
+	}
+	if start, _ := time.ParseInLocation(lib.TimeFormatShort, "2021/06/01:00", time.Local); !p.Start.Equal(start) {
+		t.Errorf("unexpected start: %v", p.Start)
+	}
+	if report, _ := os.ReadFile(filepath.Join(outDir, "report.md")); strings.Contains(string(report), lib.ProvenanceExtension) {
+		t.Errorf("expected the sidecar to not be reported as an output:\n%s", report)
+	}
+
+	if _, _, e := execute(t, "", "run", "-N", "-S", "--provenance", "-i", logDir, "-r", testRange, "conn", "cat"); e == nil {
+		t.Error("expected an error for --provenance with --stdout")
+	}
+}
+
+// Test that --ticket is refused before running when no webhook is configured.
+func TestRunTicketNoWebhook(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	_, _, e := execute(t, "", "run", "-N", "--ticket", "INC-1234", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Fatalf("expected *lib.ValidationError, got %v", e)
+	}
+}
+
+// Test that --cluster pulls the logs of every worker, whether prefixed or in a directory per
+// worker, and merges those with the same name rather than overwriting one with another.
+func TestRunCluster(t *testing.T) {
+	logDir := writeLogDir(t, "manager")
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	for worker, record := range map[string]string{"worker-01": "first", "worker-02": "second", "worker-03": "prefixed"} {
+		writeLog(t, dateDir, worker, record)
+	}
+	os.Rename(filepath.Join(dateDir, "worker-03", "conn.00:00:00-01:00:00.log.gz"), filepath.Join(dateDir, "worker-03.conn.00:00:00-01:00:00.log.gz"))
+
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "manager\n" {
+		t.Errorf("expected only the merged log without --cluster, got %q", stdout)
+	}
+
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "--cluster", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "manager\nfirst\nsecond\nprefixed\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+}
+
+// Test that --tag-sensor adds the sensor of each log to its records.
+func TestRunTagSensor(t *testing.T) {
+	logDir := filepath.Join(t.TempDir(), "east", "logs")
+	writeLog(t, logDir, "2021-06-01", `{"id.orig_h":"10.0.0.5"}`)
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--tag-sensor", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != `{"id.orig_h":"10.0.0.5","sensor":"east"}`+"\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+}
+
+// Test that --correlate-notices annotates the records sharing the uid of a notice.
+func TestRunCorrelateNotices(t *testing.T) {
+	logDir := t.TempDir()
+	writeLog(t, logDir, "2021-06-01", `{"uid":"C1"}`)
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	if e := os.Rename(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), filepath.Join(dateDir, "notice.00:00:00-01:00:00.log.gz")); e != nil {
+		t.Fatal(e)
+	}
+	writeLog(t, logDir, "2021-06-01", `{"uid":"C1"}`, `{"uid":"C2"}`)
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "--correlate-notices", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != `{"uid":"C1","related_notices":[{"log":"notice"}]}`+"\n"+`{"uid":"C2"}`+"\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if !strings.Contains(stderr, "Read 1 notice(s)") {
+		t.Errorf("expected the notices read to be listed:\n%s", stderr)
+	}
+}
+
+// Test that --manifest lists each output once complete, and cannot be used with --stdout.
+func TestRunManifest(t *testing.T) {
+	logDir := t.TempDir()
+	writeLog(t, logDir, "2021-06-01", `{"uid":"C1"}`)
+	writeLog(t, logDir, "2021-06-02", `{"uid":"C2"}`)
+	outDir := filepath.Join(t.TempDir(), "out")
+
+	_, stderr, e := execute(t, "", "run", "-N", "--manifest", "-i", logDir, "-o", outDir, "-r", "2021/06/01:00-2021/06/02:00", "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	entries, e := lib.ReadManifest(filepath.Join(outDir, lib.ManifestFile))
+	if e != nil || len(entries) != 2 {
+		t.Fatalf("expected two manifest entries, got %+v (%v)", entries, e)
+	}
+	// dates are listed in the order they finish.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	for i, date := range []string{"2021-06-01", "2021-06-02"} {
+		if filepath.Base(entries[i].Path) != "conn-"+date+".json" || entries[i].Size != 13 {
+			t.Errorf("unexpected manifest entry: %+v", entries[i])
+		}
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--manifest", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "--manifest") {
+		t.Errorf("expected --manifest with --stdout to fail, got %v", e)
+	}
+}
+
+// Test that --compress leaves only the compressed output of each date, listed in the manifest.
+func TestRunCompress(t *testing.T) {
+	logDir := writeLogDir(t, `{"uid":"C1"}`)
+	outDir := filepath.Join(t.TempDir(), "out")
+
+	_, stderr, e := execute(t, "", "run", "-N", "--compress", "gzip", "--manifest", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	entries, _ := os.ReadDir(outDir)
+	if len(entries) != 3 || entries[0].Name() != lib.OutputMarker || entries[1].Name() != "conn-2021-06-01.json.gz" || entries[2].Name() != lib.ManifestFile {
+		t.Fatalf("unexpected outputs: %v", entries)
+	}
+	f, _ := os.Open(filepath.Join(outDir, "conn-2021-06-01.json.gz"))
+	defer f.Close()
+	zr, e := gzip.NewReader(f)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var content bytes.Buffer
+	content.ReadFrom(zr)
+	if content.String() != `{"uid":"C1"}`+"\n" {
+		t.Errorf("unexpected output: %q", content.String())
+	}
+	listed, _ := lib.ReadManifest(filepath.Join(outDir, lib.ManifestFile))
+	if len(listed) != 1 || filepath.Base(listed[0].Path) != "conn-2021-06-01.json.gz" {
+		t.Errorf("unexpected manifest entries: %+v", listed)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--compress", "gzip", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "--compress") {
+		t.Errorf("expected --compress with --stdout to fail, got %v", e)
+	}
+}
+
+// Test that --compress-output writes the temp file of each log and the output of each date
+// compressed, in gzip or zstd at the level given, leaving only the compressed outputs, and
+// that the records still reach stdout.
+func TestRunCompressOutput(t *testing.T) {
+	logDir := writeLogDir(t, `{"uid":"C1"}`, `{"uid":"C2"}`)
+	outDir := filepath.Join(t.TempDir(), "out")
+
+	_, stderr, e := execute(t, "", "run", "-N", "--compress-output", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	entries, _ := os.ReadDir(outDir)
+	if len(entries) != 2 || entries[0].Name() != lib.OutputMarker || entries[1].Name() != "conn-2021-06-01.json.gz" {
+		t.Fatalf("unexpected outputs: %v", entries)
+	}
+	f, _ := os.Open(filepath.Join(outDir, "conn-2021-06-01.json.gz"))
+	defer f.Close()
+	zr, e := gzip.NewReader(f)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var content bytes.Buffer
+	content.ReadFrom(zr)
+	if content.String() != `{"uid":"C1"}`+"\n"+`{"uid":"C2"}`+"\n" {
+		t.Errorf("unexpected output: %q", content.String())
+	}
+
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--compress-output=gzip", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil || stdout != `{"uid":"C1"}`+"\n"+`{"uid":"C2"}`+"\n" {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	if _, e = exec.LookPath("zstd"); e == nil {
+		outDir = filepath.Join(t.TempDir(), "out")
+		if _, stderr, e = execute(t, "", "run", "-N", "--compress-output=zstd", "--compress-level", "19", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat"); e != nil {
+			t.Fatalf("%v:\n%s", e, stderr)
+		}
+		content, e := exec.Command("zstd", "-dcq", filepath.Join(outDir, "conn-2021-06-01.json.zst")).Output()
+		if e != nil || string(content) != `{"uid":"C1"}`+"\n"+`{"uid":"C2"}`+"\n" {
+			t.Errorf("unexpected zstd output: %q (%v)", content, e)
+		}
+	}
+
+	for _, args := range [][]string{{"--compress-output=lz4"}, {"--compress-output", "--compress", "gzip"}, {"--compress-output", "--compress-level", "12"}, {"--compress-output=zstd", "--compress-level", "-1"}} {
+		_, _, e = execute(t, "", append(append([]string{"run", "-N", "-i", logDir, "-r", testRange}, args...), "conn", "cat")...)
+		var ve *lib.ValidationError
+		if !errors.As(e, &ve) {
+			t.Errorf("%v: expected to be rejected, got %v", args, e)
+		}
+	}
+	// a format after --compress-output is an argument, so would silently be given to the filter.
+	outDir = filepath.Join(t.TempDir(), "zstd")
+	_, _, e = execute(t, "", "run", "-N", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat", "--compress-output", "zstd")
+	if e == nil || !strings.Contains(e.Error(), "Use --compress-output=zstd") {
+		t.Errorf("expected the format read as an argument to be rejected, got %v", e)
+	}
+	if _, e = os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled into %s", outDir)
+	}
+}
+
+// Test that zstd compressed logs, as rotated by a Zeek set to zstd, are pulled alongside
+// gzipped ones.
+func TestRunZstdLogs(t *testing.T) {
+	if _, e := exec.LookPath("zstd"); e != nil {
+		t.Skip("zstd is not installed")
+	}
+	logDir := writeLogDir(t, `{"uid":"C1"}`)
+	zstd := exec.Command("zstd", "-q", "-o", filepath.Join(logDir, "2021-06-01", "conn.01:00:00-02:00:00.log.zst"))
+	zstd.Stdin = strings.NewReader(`{"uid":"C2"}` + "\n")
+	if out, e := zstd.CombinedOutput(); e != nil {
+		t.Fatalf("%v: %s", e, out)
+	}
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if stdout != `{"uid":"C1"}`+"\n"+`{"uid":"C2"}`+"\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+}
+
+// Test that a dictionary trained for a log type is copied next to the zstd outputs of later
+// pulls of it and compresses them, unless --no-dictionary is set.
+func TestRunDictionary(t *testing.T) {
+	if _, e := exec.LookPath("zstd"); e != nil {
+		t.Skip("zstd is not installed")
+	}
+	var records []string
+	for i := 0; i < 500; i++ {
+		records = append(records, fmt.Sprintf(`{"uid":"C%d","id.orig_h":"10.0.0.%d","query":"host%d.example.com"}`, i, i%250, i))
+	}
+	logDir := writeLogDir(t, records...)
+	trainDir := filepath.Join(t.TempDir(), "train")
+	if _, stderr, e := execute(t, "", "run", "-N", "-i", logDir, "-o", trainDir, "-r", testRange, "conn", "cat"); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	_, stderr, e := execute(t, "", "dictionary", "train", "--size", "4", "conn", trainDir)
+	if e != nil || !strings.Contains(stderr, "conn.zdict") {
+		t.Fatalf("expected a dictionary trained, got %q (%v)", stderr, e)
+	}
+	defer os.RemoveAll(filepath.Dir(lib.DictionaryPath(lib.DefaultDictionaryDir, "conn")))
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, stderr, e = execute(t, "", "run", "-N", "--compress", "zstd", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat"); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	output, dictionary := filepath.Join(outDir, "conn-2021-06-01.json.zst"), filepath.Join(outDir, "conn.zdict")
+	content, e := exec.Command("zstd", "-dcq", "-D", dictionary, output).Output()
+	if e != nil || string(content) != strings.Join(records, "\n")+"\n" {
+		t.Errorf("unexpected output %d bytes: %v", len(content), e)
+	}
+	if _, e = exec.Command("zstd", "-dcq", output).Output(); e == nil {
+		t.Error("expected the output to be compressed with the dictionary")
+	}
+
+	outDir = filepath.Join(t.TempDir(), "plain")
+	if _, stderr, e = execute(t, "", "run", "-N", "--compress", "zstd", "--no-dictionary", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat"); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if _, e = os.Stat(filepath.Join(outDir, "conn.zdict")); !os.IsNotExist(e) {
+		t.Errorf("expected no dictionary with --no-dictionary: %v", e)
+	}
+}
+
+// Test a pull end to end over a synthetic archive: every hourly log of two days is found,
+// filtered and concatenated into a single output.
+func TestSynthPull(t *testing.T) {
+	logDir := filepath.Join(t.TempDir(), "archive")
+	_, stderr, e := execute(t, "", "synth", "--days", "2", "--types", "conn,dns", "--records", "10", logDir)
+	if e != nil || !strings.Contains(stderr, "Wrote 96 logs") {
+		t.Fatalf("expected 96 logs written, got %q (%v)", stderr, e)
+	}
+	if _, _, e = execute(t, "", "synth", logDir); e == nil {
+		t.Error("expected synth to refuse a directory that is not empty")
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, stderr, e = execute(t, "", "run", "-N", "-c", "-i", logDir, "-o", outDir, "-r", "2021/06/01:00-2021/06/02:23", "dns", "grep", "10.0.0."); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	content, e := os.ReadFile(filepath.Join(outDir, "dns.json"))
+	if lines := strings.Count(string(content), "\n"); e != nil || lines != 2*24*10 {
+		t.Errorf("expected %d records, got %d: %v", 2*24*10, lines, e)
+	}
+}
+
+// Test that several log types, as a list or with --type, are each pulled into a directory of
+// their own, and that a type given twice is rejected.
+func TestRunTypes(t *testing.T) {
+	logDir := filepath.Join(t.TempDir(), "archive")
+	if _, stderr, e := execute(t, "", "synth", "--days", "1", "--types", "conn,dns,http", "--records", "5", logDir); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	for _, args := range [][]string{{"conn,dns", "cat"}, {"--type", "conn", "--type", "dns", "cat"}} {
+		outDir := filepath.Join(t.TempDir(), "out")
+		_, stderr, e := execute(t, "", append([]string{"run", "-N", "-c", "-i", logDir, "-o", outDir, "-r", "2021/06/01:00-2021/06/01:23"}, args...)...)
+		if e != nil {
+			t.Fatalf("%v: %v:\n%s", args, e, stderr)
+		}
+		for _, logType := range []string{"conn", "dns"} {
+			content, e := os.ReadFile(filepath.Join(outDir, logType, logType+".json"))
+			if lines := strings.Count(string(content), "\n"); e != nil || lines != 24*5 {
+				t.Errorf("%v: expected %d %s records, got %d: %v", args, 24*5, logType, lines, e)
+			}
+		}
+		if _, e = os.Stat(filepath.Join(outDir, "http")); !os.IsNotExist(e) {
+			t.Errorf("%v: expected no http output: %v", args, e)
+		}
+	}
+
+	_, _, e := execute(t, "", "run", "-N", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "conn,dns,conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || !strings.Contains(e.Error(), "more than once") {
+		t.Errorf("expected a duplicate log type rejected, got %v", e)
+	}
+}
+
+// Test that a pattern of log types pulls each log type it matches into a directory of its own,
+// and is rejected if it matches none.
+func TestRunTypePattern(t *testing.T) {
+	logDir := writeLogDir(t, `{"uid":"C1"}`)
+	summary := `{"uid":"S1"}` + "\n"
+	if e := os.WriteFile(filepath.Join(logDir, "2021-06-01", "conn-summary.00:00:00-01:00:00.log"), []byte(summary), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, stderr, e := execute(t, "", "run", "-N", "-c", "-i", logDir, "-o", outDir, "-r", testRange, "conn*", "cat"); e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	for logType, want := range map[string]string{"conn": `{"uid":"C1"}` + "\n", "conn-summary": summary} {
+		if content, e := os.ReadFile(filepath.Join(outDir, logType, logType+".json")); e != nil || string(content) != want {
+			t.Errorf("%s: unexpected output %q (%v)", logType, content, e)
+		}
+	}
+
+	_, _, e := execute(t, "", "run", "-N", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "/^dns$/", "cat")
+	if !errors.Is(e, lib.ErrNoMatches) {
+		t.Errorf("expected no log types matched, got %v", e)
+	}
+}
+
+// Test that filter-ip keeps the records with an address in the given subnets, on every address
+// field or only those of --fields, and rejects subnets that are not valid.
+func TestFilterIP(t *testing.T) {
+	records := []string{
+		`{"uid":"C1","id.orig_h":"10.0.0.5","id.resp_h":"198.51.100.1"}`,
+		`{"uid":"C2","id.orig_h":"198.51.100.1","id.resp_h":"10.0.0.6"}`,
+		`{"uid":"C3","id.orig_h":"198.51.100.1","id.resp_h":"198.51.100.2"}`,
+	}
+	logDir := writeLogDir(t, records...)
+
+	stdout, stderr, e := execute(t, "", "filter-ip", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "10.0.0.0/24")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if stdout != records[0]+"\n"+records[1]+"\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if !strings.Contains(stderr, "id.orig_h, id.resp_h") {
+		t.Errorf("expected the address fields of conn listed, got:\n%s", stderr)
+	}
+
+	stdout, _, e = execute(t, "", "filter-ip", "-N", "-S", "--fields", "id.resp_h", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "10.0.0.6")
+	if e != nil || stdout != records[1]+"\n" {
+		t.Errorf("expected only the responder matched, got %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "filter-ip", "-N", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "conn", "10.0.0.0/33")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected a bad subnet rejected, got %v", e)
+	}
+	if _, _, e = execute(t, "", "filter-ip", "-N", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "conn"); !errors.As(e, &ve) {
+		t.Errorf("expected a subnet required, got %v", e)
+	}
+}
+
+// Test that --current pulls the records of the hour in progress from the current directory,
+// leaving out a record still being written, and leaves the log as it is.
+func TestRunCurrent(t *testing.T) {
+	now := time.Now().UTC()
+	logDir := t.TempDir()
+	os.MkdirAll(filepath.Join(logDir, now.Format("2006-01-02")), 0755)
+	os.MkdirAll(filepath.Join(logDir, lib.CurrentDir), 0755)
+	live := `{"uid":"C1"}` + "\n" + `{"uid":"C2"}` + "\n" + `{"uid":"C`
+	os.WriteFile(filepath.Join(logDir, lib.CurrentDir, "conn.log"), []byte(live), 0644)
+	// the hours around now, so the hour in progress is in range even if the next one starts.
+	timeRange := now.Add(-time.Hour).Format("2006/01/02:15") + "-" + now.Add(time.Hour).Format("2006/01/02:15")
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "--current", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", timeRange, "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if stdout != `{"uid":"C1"}`+"\n"+`{"uid":"C2"}`+"\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if content, _ := os.ReadFile(filepath.Join(logDir, lib.CurrentDir, "conn.log")); string(content) != live {
+		t.Errorf("expected the live log left as it is, got %q", content)
+	}
+
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", timeRange, "conn", "cat")
+	if e != nil || stdout != "" {
+		t.Errorf("expected nothing without --current, got %q (%v)", stdout, e)
+	}
+}
+
+// Test that uncompressed hourly logs are filtered like gzipped ones.
+func TestRunPlainLogs(t *testing.T) {
+	logDir := writeLogDir(t, `{"uid":"C1"}`)
+	plain := `{"uid":"C2"}` + "\n"
+	if e := os.WriteFile(filepath.Join(logDir, "2021-06-01", "conn.01:00:00-02:00:00.log"), []byte(plain), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	if stdout != `{"uid":"C1"}`+"\n"+plain {
+		t.Errorf("unexpected output %q", stdout)
+	}
+}
+
+// Test that pulls with small or no read-ahead and buffers write the same records, and that
+// negative sizes are rejected.
+func TestRunStageFlags(t *testing.T) {
+	records := []string{`{"uid":"C1"}`, `{"uid":"C2"}`, `{"uid":"C3"}`}
+	logDir := writeLogDir(t, records...)
+	for _, args := range [][]string{{"--stage-buffer", "1", "--read-ahead", "0"}, {"--stage-buffer", "1", "--read-ahead", "16"}} {
+		stdout, stderr, e := execute(t, "", append([]string{"run", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat"}, args...)...)
+		if e != nil {
+			t.Fatalf("%v:\n%s", e, stderr)
+		}
+		if stdout != strings.Join(records, "\n")+"\n" {
+			t.Errorf("%v: unexpected output %q", args, stdout)
+		}
+	}
+
+	_, _, e := execute(t, "", "run", "-N", "-S", "--stage-buffer", "0", "--read-ahead", "-1", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || len(ve.Problems) != 2 {
+		t.Errorf("expected both sizes to be rejected, got %v", e)
+	}
+}
+
+// Test that schema drift is reported, and that --normalize-schema writes every record with
+// the union of the fields.
+func TestRunSchemaDrift(t *testing.T) {
+	logDir := t.TempDir()
+	writeLog(t, logDir, "2021-06-01", "#fields\tts\tuid", "1.0\tC1")
+	writeLog(t, logDir, "2021-06-02", "#fields\tts\tproto\tuid", "2.0\ttcp\tC2")
+	timeRange := "2021/06/01:00-2021/06/02:00"
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", timeRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stderr, "2021-06-02 conn.00:00:00-01:00:00.log.gz: +proto") {
+		t.Errorf("expected drift to be reported:\n%s", stderr)
+	}
+	if stdout != "#fields\tts\tuid\n1.0\tC1\n#fields\tts\tproto\tuid\n2.0\ttcp\tC2\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "--normalize-schema", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", timeRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "#fields\tts\tuid\tproto\n1.0\tC1\t-\n#fields\tts\tuid\tproto\n2.0\tC2\ttcp\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+}
+
+// Test that --output-format msgpack names the output after the format, and writes records
+// that decode, and that the report still counts them.
+func TestRunOutputMsgpack(t *testing.T) {
+	logDir, outDir := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeLog(t, logDir, "2021-06-01", `{"id.orig_h":"10.0.0.5"}`)
+	_, _, e := execute(t, "", "run", "-N", "--output-format", "msgpack", "--render-report", "markdown", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	data, e := os.ReadFile(filepath.Join(outDir, "conn-2021-06-01.msgpack"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	record, rest, e := lib.DecodeMsgpack(data)
+	if e != nil || len(rest) != 0 {
+		t.Fatalf("unexpected output %x: %v", data, e)
+	}
+	if !reflect.DeepEqual(record, map[string]interface{}{"id.orig_h": "10.0.0.5"}) {
+		t.Errorf("unexpected record %#v", record)
+	}
+	report, e := os.ReadFile(filepath.Join(outDir, "report.md"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(string(report), "10.0.0.5") {
+		t.Errorf("expected the report to count the records:\n%s", report)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "--output-format", "xml", "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected *lib.ValidationError, got %v", e)
+	}
+}
+
+// Test that --output-format parquet writes the records of each date to a Parquet file in its
+// partition, and cannot be combined with one output.
+func TestRunOutputParquet(t *testing.T) {
+	logDir, outDir := writeLogDir(t, `{"uid":"C1"}`, `{"uid":"C2"}`), filepath.Join(t.TempDir(), "out")
+	_, stderr, e := execute(t, "", "run", "-N", "--output-format", "parquet", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatalf("%v:\n%s", e, stderr)
+	}
+	data, e := os.ReadFile(filepath.Join(outDir, "log_type=conn", "date=2021-06-01", "conn-2021-06-01.parquet"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) || !bytes.Contains(data, []byte("uid")) {
+		t.Errorf("unexpected output %q", data)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 2 || entries[0].Name() != lib.OutputMarker {
+		t.Errorf("expected only the partition to be left, got %v", entries)
+	}
+
+	for _, args := range [][]string{{"-c"}, {"-S"}, {"--compress", "gzip"}, {"--compress-output"}} {
+		args = append(append([]string{"run", "-N", "--output-format", "parquet"}, args...), "-i", logDir, "-o", filepath.Join(t.TempDir(), "out"), "-r", testRange, "conn", "cat")
+		_, _, e = execute(t, "", args...)
+		var ve *lib.ValidationError
+		if !errors.As(e, &ve) {
+			t.Errorf("%v: expected *lib.ValidationError, got %v", args, e)
+		}
+	}
+}
+
+// Test that a filter that neither reads nor writes is listed in the report, and killed with
+// --stall-action kill rather than left to run.
+func TestRunStallKill(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	start := time.Now()
+	_, stderr, e := execute(t, "", "run", "-N", "-S", "--stall-timeout", "200ms", "--stall-action", "kill",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "sleep", "30")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("stalled filter was not killed, took %s", elapsed)
+	}
+	if !strings.Contains(stderr, "Stalled tasks (1)") || !strings.Contains(stderr, "conn.00:00:00-01:00:00.log.gz: idle") {
+		t.Errorf("expected the stall to be reported:\n%s", stderr)
+	}
+}
+
+// Test that --batch feeds every log to the same filter, and still splits the output by date.
+func TestRunBatch(t *testing.T) {
+	logDir := writeLogDir(t, "first")
+	writeLog(t, logDir, "2021-06-02", "second")
+	script := filepath.Join(t.TempDir(), "filter.sh")
+	os.WriteFile(script, []byte(`#!/bin/sh
+while IFS= read -r line; do
+	if [ "$line" = "`+lib.DefaultBatchDelimiter+`" ]; then echo "$line"; else echo "$$ $line"; fi
+done
+`), 0755)
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	_, _, e := execute(t, "", "run", "-N", "--batch", "-t", "1", "-i", logDir, "-o", outDir, "-r", "2021/06/01:00-2021/06/02:00", "conn", script)
+	if e != nil {
+		t.Fatal(e)
+	}
+	first, _ := os.ReadFile(filepath.Join(outDir, "conn-2021-06-01.json"))
+	second, _ := os.ReadFile(filepath.Join(outDir, "conn-2021-06-02.json"))
+	pid := strings.Fields(string(first) + " ")[0]
+	if string(first) != pid+" first\n" || string(second) != pid+" second\n" {
+		t.Errorf("expected both logs filtered by one process, got %q and %q", first, second)
+	}
+}
+
+// Test that --jq filters records in-process, without a command, and that a playbook data
+// source can do the same.
+func TestRunJQ(t *testing.T) {
+	logDir := writeLogDir(t, `{"query":"evil.ru"}`, `{"query":"good.com"}`)
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--jq", `select(.query | test("evil")) | .query`,
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != `"evil.ru"`+"\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--jq", ".", "-i", logDir, "-r", testRange, "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected a command and --jq together to be rejected, got %v", e)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+data_sources:
+  - name: evil
+    log_type: conn
+    jq: 'select(.query == "evil.ru")'
+`), 0644)
+	if _, _, e = execute(t, "", "play", "-N", playbook); e != nil {
+		t.Fatal(e)
+	}
+	content, _ := os.ReadFile(filepath.Join(outDir, "evil", "conn-2021-06-01.json"))
+	if string(content) != `{"query":"evil.ru"}`+"\n" {
+		t.Errorf("unexpected play output %q", content)
+	}
+}
+
+// Test that --where keeps the records matching its condition in-process, instead of a command,
+// for run and from the data sources of playbooks.
+func TestRunWhere(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.5","id.resp_p":3389}`, `{"id.orig_h":"10.0.0.5","id.resp_p":22}`, `{"id.orig_h":"192.0.2.1","id.resp_p":3389}`)
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--where", "id.resp_p == 3389 && id.orig_h in 10.0.0.0/8",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != `{"id.orig_h":"10.0.0.5","id.resp_p":3389}`+"\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	for _, args := range [][]string{{"--where", "id.resp_p == 3389", "conn", "cat"}, {"--where", "id.resp_p == 3389", "--jq", ".", "conn"}, {"--where", "id.resp_p ==", "conn"}} {
+		_, _, e = execute(t, "", append([]string{"run", "-N", "-S", "-i", logDir, "-r", testRange}, args...)...)
+		var ve *lib.ValidationError
+		if !errors.As(e, &ve) {
+			t.Errorf("%v: expected to be rejected, got %v", args, e)
+		}
+	}
+
+	outDir := filepath.Join(t.TempDir(), "hunt")
+	playbook := filepath.Join(t.TempDir(), "hunt.yaml")
+	os.WriteFile(playbook, []byte(`time_range: `+testRange+`
+output_dir: `+outDir+`
+zeek_log_dir: `+logDir+`
+data_sources:
+  - name: rdp
+    log_type: conn
+    where: id.resp_p = 3389 AND id.orig_h NOT IN 10.0.0.0/8
+`), 0644)
+	if _, _, e = execute(t, "", "play", "-N", playbook); e != nil {
+		t.Fatal(e)
+	}
+	content, _ := os.ReadFile(filepath.Join(outDir, "rdp", "conn-2021-06-01.json"))
+	if string(content) != `{"id.orig_h":"192.0.2.1","id.resp_p":3389}`+"\n" {
+		t.Errorf("unexpected play output %q", content)
+	}
+}
+
+// Test that a query runs over the logs of the time range, printed as tsv or json.
+func TestSQL(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.1","service":"evil.ru"}`, `{"id.orig_h":"10.0.0.1","service":"bad.ru"}`, `{"id.orig_h":"10.0.0.2","service":"good.com"}`)
+	query := "SELECT id_orig_h AS host, count(*) FROM conn WHERE service LIKE '%.ru' GROUP BY host"
+	stdout, _, e := execute(t, "", "sql", "-i", logDir, "-r", testRange, query)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "host\tcount(*)\n10.0.0.1\t2\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	stdout, _, e = execute(t, "", "sql", "--format", "json", "-i", logDir, "-r", testRange, query)
+	if e != nil || stdout != `{"host":"10.0.0.1","count(*)":2}`+"\n" {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "sql", "--format", "xml", "-i", logDir, "-r", testRange, "SELECT query FROM")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || len(ve.Problems) != 2 {
+		t.Errorf("expected the query and format to be rejected together, got %v", e)
+	}
+
+	// fields the log type does not have are rejected before reading any log.
+	_, _, e = execute(t, "", "sql", "-i", logDir, "-r", testRange, "SELECT id_orig_h FROM conn WHERE servise = 'dns'")
+	if !errors.As(e, &ve) || len(ve.Problems) != 1 || !strings.Contains(e.Error(), "did you mean 'service'?") {
+		t.Errorf("expected the unknown field to be rejected, got %v", e)
+	}
+}
+
+// Test that the fields of a log type are profiled to stdout.
+func TestProfile(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.1","query":"evil.ru"}`, `{"id.orig_h":"10.0.0.1"}`)
+	stdout, stderr, e := execute(t, "", "profile", "-i", logDir, "-r", testRange, "conn")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stderr, "2 record(s) from 1 of 1 log(s)") {
+		t.Errorf("expected the sample to be described, got %q", stderr)
+	}
+	lines := strings.Split(stdout, "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "FIELD") ||
+		strings.Join(strings.Fields(lines[1]), " ") != "id.orig_h 0.0% 1 10.0.0.1 (2)" ||
+		strings.Join(strings.Fields(lines[2]), " ") != "query 50.0% 1 evil.ru (1)" {
+		t.Errorf("unexpected profile %q", stdout)
+	}
+
+	_, _, e = execute(t, "", "profile", "--top", "-1", "-i", logDir, "-r", testRange, "conn")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected a negative --top to be rejected, got %v", e)
+	}
+}
+
+// Test that a date packed into a tar container is pulled like its date directory.
+func TestRunTar(t *testing.T) {
+	logDir := writeLogDir(t, "first", "second")
+	logFile := filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz")
+	content, e := os.ReadFile(logFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "2021-06-01/conn.00:00:00-01:00:00.log.gz", Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	os.WriteFile(filepath.Join(logDir, "2021-06-01.tar"), buf.Bytes(), 0644)
+	os.RemoveAll(filepath.Join(logDir, "2021-06-01"))
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "--cache-dir", t.TempDir(),
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if stdout != "first\nsecond\n" || !strings.Contains(stderr, "Extracting 1 log(s)") {
+		t.Errorf("unexpected output: %q, %q", stdout, stderr)
+	}
+}
+
+// Test that records are written with their fields in the given order, which msgpack rejects.
+func TestRunFieldOrder(t *testing.T) {
+	logDir := writeLogDir(t, `{"uid":"C1","ts":1.5,"id.orig_h":"10.0.0.1"}`)
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--field-order", "ts,id.orig_h",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil || stdout != `{"ts":1.5,"id.orig_h":"10.0.0.1","uid":"C1"}`+"\n" {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--field-order", "alphabetical", "--output-format", "msgpack",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || len(ve.Problems) != 1 {
+		t.Errorf("expected the field order to be rejected for msgpack, got %v", e)
+	}
+}
+
+// Test that run writes the distinct values of fields with --unique, rather than the records.
+func TestRunUnique(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.resp_h":"10.0.0.2"}`, `{"id.resp_h":"10.0.0.1"}`, `{"id.resp_h":"10.0.0.2"}`)
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--unique", "id.resp_h",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil || stdout != "id.resp_h\tcount\n10.0.0.2\t2\n10.0.0.1\t1\n" {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, _, e = execute(t, "", "run", "-N", "--unique", "id.resp_h",
+		"-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat"); e != nil {
+		t.Fatal(e)
+	}
+	counts, e := os.ReadFile(filepath.Join(outDir, "unique.tsv"))
+	if e != nil || string(counts) != "id.resp_h\tcount\n10.0.0.2\t2\n10.0.0.1\t1\n" {
+		t.Errorf("unexpected unique.tsv: %q (%v)", counts, e)
+	}
+
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "--unique", "id.resp_h", "--top", "1",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil || stdout != "id.resp_h\tcount\n10.0.0.2\t2\n" {
+		t.Errorf("unexpected top output: %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--unique", "id.rsp_h",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected an unknown field to be rejected, got %v", e)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--top", "5",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if !errors.As(e, &ve) {
+		t.Errorf("expected --top without --unique to be rejected, got %v", e)
+	}
+}
+
+// Test that --verify-access checks the logs of the pull without pulling them, and fails once
+// one cannot be read.
+func TestRunVerifyAccess(t *testing.T) {
+	logDir, outDir := writeLogDir(t, `{"uid":"C1"}`), filepath.Join(t.TempDir(), "out")
+	_, stderr, e := execute(t, "", "run", "-N", "--verify-access", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil || !strings.Contains(stderr, "conn: 2 paths checked, 0 cannot be read.") {
+		t.Errorf("unexpected output %q (%v)", stderr, e)
+	}
+	if _, e = os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled into %s", outDir)
+	}
+
+	if os.Getuid() == 0 {
+		t.Skip("root can read every file")
+	}
+	log := filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz")
+	os.Chmod(log, 0)
+	stdout, _, e := execute(t, "", "run", "-N", "--verify-access", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e == nil || stdout != log+": permission denied\n" {
+		t.Errorf("unexpected output %q (%v)", stdout, e)
+	}
+}
+
+// Test that --hash writes salted hashes of the values counted rather than the values, and
+// needs a salt and fields that are counted.
+func TestRunHash(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.5","proto":"tcp"}`, `{"id.orig_h":"10.0.0.5","proto":"tcp"}`, `{"proto":"udp"}`)
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--hash", "id.orig_h", "--hash-salt", "secret",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	expected := "id.orig_h\tcount\n" + lib.HashValue("secret", "10.0.0.5") + "\t2\n"
+	if e != nil || stdout != expected {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	os.Setenv("NAGINI_HASH_SALT", "secret")
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "--unique", "id.orig_h,proto", "--hash", "id.orig_h",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	os.Unsetenv("NAGINI_HASH_SALT")
+	expected = "id.orig_h\tproto\tcount\n" + lib.HashValue("secret", "10.0.0.5") + "\ttcp\t2\n-\tudp\t1\n"
+	if e != nil || stdout != expected {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	for _, args := range [][]string{{"--hash", "id.orig_h"}, {"--hash", "id.orig_h", "--hash-salt", "secret", "--unique", "proto"}} {
+		args = append(append([]string{"run", "-N", "-S"}, args...), "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+		_, _, e = execute(t, "", args...)
+		var ve *lib.ValidationError
+		if !errors.As(e, &ve) {
+			t.Errorf("%v: expected *lib.ValidationError, got %v", args, e)
+		}
+	}
+}
+
+// Test that --conn-summary rolls up conn records into flows, alongside the records or instead
+// of them.
+func TestRunConnSummary(t *testing.T) {
+	logDir := writeLogDir(t, `{"id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1","id.resp_p":22,"proto":"tcp","orig_bytes":10}`,
+		`{"id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1","id.resp_p":22,"proto":"tcp","orig_bytes":30}`)
+	summary := "id.orig_h\tid.resp_h\tid.resp_p\tproto\tconns\torig_bytes\tresp_bytes\torig_pkts\tresp_pkts\tduration\tfirst_ts\tlast_ts\n" +
+		"10.0.0.5\t192.0.2.1\t22\ttcp\t2\t40\t0\t0\t0\t0.000000\t-\t-\n"
+	stdout, _, e := execute(t, "", "run", "-N", "-S", "--conn-summary", "only",
+		"-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "conn", "cat")
+	if e != nil || stdout != summary {
+		t.Errorf("unexpected output: %q (%v)", stdout, e)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, _, e = execute(t, "", "run", "-N", "--conn-summary", "alongside",
+		"-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat"); e != nil {
+		t.Fatal(e)
+	}
+	if content, e := os.ReadFile(filepath.Join(outDir, lib.ConnSummaryFile)); e != nil || string(content) != summary {
+		t.Errorf("unexpected %s: %q (%v)", lib.ConnSummaryFile, content, e)
+	}
+	if records, _ := os.ReadFile(filepath.Join(outDir, "conn-2021-06-01.json")); strings.Count(string(records), "\n") != 2 {
+		t.Errorf("expected the records alongside the summary, got %q", records)
+	}
+
+	for _, args := range [][]string{{"--conn-summary", "sideways", "conn"}, {"--conn-summary", "only", "dns"}, {"--conn-summary", "alongside", "-S", "conn"}, {"--conn-summary", "only", "--unique", "proto", "conn"}} {
+		_, _, e = execute(t, "", append(append([]string{"run", "-N", "-i", logDir, "-r", testRange}, args...), "cat")...)
+		var ve *lib.ValidationError
+		if !errors.As(e, &ve) {
+			t.Errorf("%v: expected to be rejected, got %v", args, e)
+		}
+	}
+}
+
+// Test that sessions groups conn and app-layer records by uid, into a file per day.
+func TestSessions(t *testing.T) {
+	logDir := writeLogDir(t, `{"ts":1.0,"uid":"C1","proto":"tcp"}`, `{"ts":2.0,"uid":"C2","proto":"udp"}`)
+	stdout, _, e := execute(t, "", "sessions", "-S", "-i", logDir, "-r", testRange)
+	if e != nil || stdout != `{"uid":"C1","conn":[{"proto":"tcp","ts":1.0,"uid":"C1"}]}`+"\n"+`{"uid":"C2","conn":[{"proto":"udp","ts":2.0,"uid":"C2"}]}`+"\n" {
+		t.Errorf("unexpected sessions: %q (%v)", stdout, e)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, _, e = execute(t, "", "sessions", "-i", logDir, "-o", outDir, "-r", testRange); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = os.Stat(filepath.Join(outDir, "sessions-2021-06-01.json")); e != nil {
+		t.Error(e)
+	}
+
+	// dhcp logs have no uid to group by.
+	_, _, e = execute(t, "", "sessions", "-S", "-i", logDir, "-r", testRange, "dhcp")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected a log type without uid to be rejected, got %v", e)
+	}
+}
+
+// Test that fingerprints counts the listed fingerprints of ssl logs.
+func TestFingerprints(t *testing.T) {
+	logDir := writeLogDir(t, `{"ja3":"aaa","ja3s":"bbb"}`, `{"ja3":"aaa"}`, `{"ja3":"ccc"}`)
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	if e := os.Rename(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), filepath.Join(dateDir, "ssl.00:00:00-01:00:00.log.gz")); e != nil {
+		t.Fatal(e)
+	}
+	stdout, _, e := execute(t, "", "fingerprints", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "AAA", "bbb")
+	if e != nil || stdout != "fingerprint_type\tfingerprint\tcount\nja3\taaa\t2\nja3s\tbbb\t1\n" {
+		t.Errorf("unexpected counts: %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "fingerprints", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange)
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) {
+		t.Errorf("expected no fingerprints to be rejected, got %v", e)
+	}
+}
+
+// Test that filehashes pulls the records of files logs matching a hash. Retrieving files needs
+// a file_extract_command in the config file, which is read once nagini starts.
+func TestFileHashes(t *testing.T) {
+	logDir := writeLogDir(t, `{"fuid":"F1","md5":"aaa"}`, `{"fuid":"F2","sha256":"bbb"}`, `{"fuid":"F3","md5":"ccc"}`)
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	if e := os.Rename(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), filepath.Join(dateDir, "files.00:00:00-01:00:00.log.gz")); e != nil {
+		t.Fatal(e)
+	}
+	stdout, _, e := execute(t, "", "filehashes", "-N", "-S", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "AAA", "bbb")
+	if e != nil || stdout != `{"fuid":"F1","md5":"aaa"}`+"\n"+`{"fuid":"F2","sha256":"bbb"}`+"\n" {
+		t.Errorf("unexpected records: %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "filehashes", "-N", "-S", "--extract", "-i", logDir, "-o", filepath.Join(t.TempDir(), "tmp"), "-r", testRange, "aaa")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || len(ve.Problems) != 2 {
+		t.Errorf("expected --extract with --stdout and no command to be rejected, got %v", e)
+	}
+}
+
+// Test that presets are listed, checked and run like playbooks.
+func TestPreset(t *testing.T) {
+	stdout, _, e := execute(t, "", "preset")
+	if e != nil || !strings.Contains(stdout, "lateral-movement") {
+		t.Errorf("expected lateral-movement to be listed, got %q (%v)", stdout, e)
+	}
+
+	logDir := writeLogDir(t, `{"request_type":"TGS","cipher":"rc4-hmac","service":"MSSQLSvc/db"}`, `{"request_type":"TGS","cipher":"aes256-cts-hmac-sha1-96"}`)
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	if e := os.Rename(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), filepath.Join(dateDir, "kerberos.00:00:00-01:00:00.log.gz")); e != nil {
+		t.Fatal(e)
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, _, e = execute(t, "", "preset", "-N", "-c", "-i", logDir, "-o", outDir, "-r", testRange, "kerberoasting"); e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(filepath.Join(outDir, "rc4-service-tickets", "kerberos.json"))
+	if e != nil || !strings.Contains(string(content), "MSSQLSvc/db") || strings.Contains(string(content), "aes256") {
+		t.Errorf("unexpected output %q (%v)", content, e)
+	}
+}
+
+// Test that k8s generate reports every missing flag at once, and writes a CronJob of a
+// playbook to the given file.
+func TestK8sGenerate(t *testing.T) {
+	_, _, e := execute(t, "", "k8s", "generate", "--schedule", "daily")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || len(ve.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", e)
+	}
+
+	playbook := filepath.Join(t.TempDir(), "dns_evil.yaml")
+	os.WriteFile(playbook, []byte("threads: 3\ndata_sources:\n  - name: evil\n    log_type: dns\n    command: [grep, -F, \"{{ .domain }}\"]\n"), 0644)
+	manifest := filepath.Join(t.TempDir(), "cronjob.yaml")
+	_, stderr, e := execute(t, "", "k8s", "generate", "--playbook", playbook, "--var", "domain=evil.example.com", "--log-claim", "zeek-logs", "--schedule", "0 6 * * *", manifest)
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(manifest)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, expected := range []string{"kind: CronJob", `name: "dns-evil"`, "evil.example.com", `cpu: "3"`} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %s in the manifest:\n%s", expected, content)
+		}
+	}
+	if !strings.Contains(stderr, manifest) {
+		t.Errorf("expected the manifest to be listed:\n%s", stderr)
+	}
+}
+
+// Test that emit-shipper-config reports every problem at once, and writes a config reading
+// the outputs of a log type.
+func TestEmitShipperConfig(t *testing.T) {
+	_, _, e := execute(t, "", "emit-shipper-config", "logstash", "--sink", "kafka")
+	var ve *lib.ValidationError
+	if !errors.As(e, &ve) || len(ve.Problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", e)
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(t.TempDir(), "fluent.conf")
+	_, stderr, e := execute(t, "", "emit-shipper-config", "fluentd", "--dir", dir, "--log-type", "dns", "--sink", "kafka", "--endpoint", "kafka:9092", "--target", "hunts", config)
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(config)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, expected := range []string{"path " + filepath.Join(dir, "**", "dns-*.json"), "@type kafka2", "brokers kafka:9092", "default_topic hunts"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %s in the config:\n%s", expected, content)
+		}
+	}
+	if !strings.Contains(stderr, config) {
+		t.Errorf("expected the config to be listed:\n%s", stderr)
+	}
+}
+
+// Test that a pull is estimated from the past pulls of the same filter and log type.
+func TestRunEstimate(t *testing.T) {
+	logDir := writeLogDir(t, `{"uid":"C1"}`)
+	args := []string{"run", "-N", "-i", logDir, "-r", testRange, "--jq", `select(.uid == "estimate-me")`, "conn"}
+	_, stderr, e := execute(t, "", append(args, "-o", filepath.Join(t.TempDir(), "first"))...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if strings.Contains(stderr, "Estimate:") {
+		t.Errorf("expected no estimate without past pulls:\n%s", stderr)
+	}
+	_, stderr, e = execute(t, "", append(args, "-o", filepath.Join(t.TempDir(), "second"))...)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(stderr, "Estimate:") || !strings.Contains(stderr, "from 1 past run(s)") {
+		t.Errorf("expected an estimate from the first pull:\n%s", stderr)
+	}
+}
+
+// Test that resume finishes the output left in a directory, and says when there is none.
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	_, stderr, e := execute(t, "", "resume", dir)
+	if e != nil || !strings.Contains(stderr, "Nothing to finish") {
+		t.Errorf("expected nothing to finish, got %q (%v)", stderr, e)
+	}
+
+	input := filepath.Join(dir, "conn-2021-06-01-00.json")
+	os.WriteFile(input, []byte(`{"uid":"C1"}`+"\n"), 0644)
+	output := filepath.Join(dir, "conn-2021-06-01.json")
+	os.WriteFile(output+lib.ConcatJournalSuffix, []byte(`{"output":"`+output+`","inputs":["`+input+`"],"delete_inputs":true}`), 0644)
+	_, stderr, e = execute(t, "", "resume", dir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, _ := os.ReadFile(output)
+	if string(content) != `{"uid":"C1"}`+"\n" || !strings.Contains(stderr, "Finished "+output) {
+		t.Errorf("unexpected output %q:\n%s", content, stderr)
+	}
+}
+
+// Test that prune lists the outputs past their age with --dry-run and removes them
+// otherwise, leaving newer outputs and directories nagini did not write, and refusing a root
+// holding the log directory.
+func TestPrune(t *testing.T) {
+	root := t.TempDir()
+	old, recent, other := filepath.Join(root, "output-old"), filepath.Join(root, "output-recent"), filepath.Join(root, "notes")
+	long := time.Now().Add(-40 * 24 * time.Hour)
+	for _, dir := range []string{old, recent, other} {
+		os.Mkdir(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "conn.log"), []byte("record\n"), 0644)
+		if dir != other {
+			os.WriteFile(filepath.Join(dir, lib.OutputMarker), nil, 0644)
+		}
+		if dir != recent {
+			for _, name := range []string{"conn.log", lib.OutputMarker, ""} {
+				os.Chtimes(filepath.Join(dir, name), long, long)
+			}
+		}
+	}
+
+	logDir := writeLogDir(t, "record")
+	_, stderr, e := execute(t, "", "prune", "-i", logDir, "--root", root, "--older-than", "30d", "--dry-run")
+	if e != nil || !strings.Contains(stderr, old) || strings.Contains(stderr, recent) {
+		t.Fatalf("expected only %s listed, got %q (%v)", old, stderr, e)
+	}
+	if _, e := os.Stat(old); e != nil {
+		t.Fatalf("expected --dry-run to keep %s: %v", old, e)
+	}
+
+	if _, stderr, e = execute(t, "", "prune", "-N", "-i", logDir, "--root", root, "--older-than", "30d"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(old); !os.IsNotExist(e) {
+		t.Errorf("expected %s removed:\n%s", old, stderr)
+	}
+	for _, dir := range []string{recent, other} {
+		if _, e := os.Stat(dir); e != nil {
+			t.Errorf("expected %s kept: %v", dir, e)
+		}
+	}
+
+	var ve *lib.ValidationError
+	for _, args := range [][]string{
+		{"prune", "-N", "-i", logDir, "--root", filepath.Dir(logDir), "--older-than", "30d"},
+		{"prune", "-N", "-i", logDir, "--root", root},
+		{"prune", "-N", "-i", logDir, "--root", root, "--older-than", "-1d"},
+	} {
+		if _, _, e := execute(t, "", args...); !errors.As(e, &ve) {
+			t.Errorf("%v: expected *lib.ValidationError, got %v", args, e)
+		}
+	}
+	if _, e := os.Stat(logDir); e != nil {
+		t.Errorf("expected the log directory kept: %v", e)
+	}
+}
+
+// Test that --emit-manifest writes the logs of a pull without pulling, and that a pull with
+// --from-manifest reads only those logs.
+func TestRunTaskManifest(t *testing.T) {
+	logDir, outDir := writeLogDir(t, `{"uid":"C1"}`), filepath.Join(t.TempDir(), "out")
+	manifest := filepath.Join(t.TempDir(), "conn.json")
+	stdout, stderr, e := execute(t, "", "run", "-N", "--emit-manifest", manifest, "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil || !strings.Contains(stderr, "Wrote the task manifest of 1 logs over 1 dates to "+manifest) || stdout != "" {
+		t.Errorf("unexpected output %q %q (%v)", stdout, stderr, e)
+	}
+	if _, e = os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled into %s", outDir)
+	}
+
+	// a log that appears after the manifest is written is left out.
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	os.Link(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), filepath.Join(dateDir, "conn.01:00:00-02:00:00.log.gz"))
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "--from-manifest", manifest, "-o", outDir, "conn", "cat")
+	if e != nil || stdout != `{"uid":"C1"}`+"\n" {
+		t.Errorf("unexpected output %q (%v)", stdout, e)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "-S", "--from-manifest", manifest, "-o", outDir, "dns", "cat")
+	if e == nil || !strings.Contains(e.Error(), "lists conn logs, not dns logs") {
+		t.Errorf("expected a manifest of another log type to be refused, got %v", e)
+	}
+	_, _, e = execute(t, "", "run", "-N", "-S", "--from-manifest", manifest, "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "--timerange cannot be given too") {
+		t.Errorf("expected a time range to be refused with a manifest, got %v", e)
+	}
+}
+
+// Test that --upload puts every output file under the prefix and output directory name, and
+// --upload-remove removes them once uploaded.
+func TestRunUpload(t *testing.T) {
+	var lock sync.Mutex
+	uploaded := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		uploaded[r.Method+" "+r.URL.Path] = string(body)
+		lock.Unlock()
+	}))
+	defer server.Close()
+	for name, value := range map[string]string{"AWS_ENDPOINT_URL": server.URL, "AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	logDir, outDir := writeLogDir(t, `{"uid":"C1"}`), filepath.Join(t.TempDir(), "hunt")
+	_, stderr, e := execute(t, "", "run", "-N", "--upload", "s3://hunts/soc", "--upload-remove", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e != nil || !strings.Contains(stderr, "Uploaded 1 output files to s3://hunts/soc/hunt/.") {
+		t.Errorf("unexpected output %q (%v)", stderr, e)
+	}
+	expected := map[string]string{"PUT /hunts/soc/hunt/conn-2021-06-01.json": `{"uid":"C1"}` + "\n"}
+	if !reflect.DeepEqual(uploaded, expected) {
+		t.Errorf("expected %v, got %v", expected, uploaded)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) > 0 && !strings.HasPrefix(entries[0].Name(), ".") {
+		t.Errorf("expected the output to be removed once uploaded, found %s", entries[0].Name())
+	}
+
+	// a report that fails to render leaves the outputs complete, so they are still uploaded.
+	delete(uploaded, "PUT /hunts/soc/hunt/conn-2021-06-01.json")
+	brokenTemplate := filepath.Join(t.TempDir(), "report.tmpl")
+	os.WriteFile(brokenTemplate, []byte("{{"), 0644)
+	_, _, e = execute(t, "", "run", "-N", "--upload", "s3://hunts/soc", "--render-report", "markdown", "--report-template", brokenTemplate, "-i", logDir, "-o", filepath.Join(t.TempDir(), "hunt"), "-r", testRange, "conn", "cat")
+	if e == nil || uploaded["PUT /hunts/soc/hunt/conn-2021-06-01.json"] != `{"uid":"C1"}`+"\n" {
+		t.Errorf("expected the output uploaded though the report failed, got %v (%v)", uploaded, e)
+	}
+
+	_, _, e = execute(t, "", "run", "-N", "--upload", "s3://hunts/soc", "-S", "-i", logDir, "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "--upload cannot be used with --stdout") {
+		t.Errorf("expected --upload to be refused with --stdout, got %v", e)
+	}
+	_, _, e = execute(t, "", "run", "-N", "--upload-remove", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "--upload-remove requires --upload") {
+		t.Errorf("expected --upload-remove to be refused without --upload, got %v", e)
+	}
+}
+
+// Test that a pull over --max-input-size is refused before it starts, unless --force is given.
+func TestRunMaxInputSize(t *testing.T) {
+	logDir, outDir := writeLogDir(t, `{"uid":"C1"}`), filepath.Join(t.TempDir(), "out")
+	_, _, e := execute(t, "", "run", "-N", "--max-input-size", "10", "-i", logDir, "-o", outDir, "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "over the --max-input-size of 10") {
+		t.Errorf("expected the pull to be refused, got %v", e)
+	}
+	if _, e = os.Stat(outDir); !os.IsNotExist(e) {
+		t.Errorf("expected nothing to be pulled into %s", outDir)
+	}
+
+	stdout, stderr, e := execute(t, "", "run", "-N", "-S", "--max-input-size", "10", "--force", "-i", logDir, "-r", testRange, "conn", "cat")
+	if e != nil || !strings.Contains(stderr, "WARN: the pull reads") || stdout != `{"uid":"C1"}`+"\n" {
+		t.Errorf("unexpected output %q %q (%v)", stdout, stderr, e)
+	}
+	stdout, _, e = execute(t, "", "run", "-N", "-S", "--max-input-size", "1M", "-i", logDir, "-r", testRange, "conn", "cat")
+	if e != nil || stdout != `{"uid":"C1"}`+"\n" {
+		t.Errorf("unexpected output %q (%v)", stdout, e)
+	}
+	_, _, e = execute(t, "", "run", "-N", "-S", "--max-input-size", "lots", "-i", logDir, "-r", testRange, "conn", "cat")
+	if e == nil || !strings.Contains(e.Error(), "--max-input-size 'lots' is malformed") {
+		t.Errorf("expected a malformed size to be refused, got %v", e)
+	}
+	// logs on another host are only sized once fetched, which is warned about.
+	_, stderr, _ = execute(t, "", "run", "-N", "-S", "--max-input-size", "10", "-i", "http://127.0.0.1:1/logs", "-r", testRange, "conn", "cat")
+	if !strings.Contains(stderr, "WARN: conn: the logs of http://127.0.0.1:1/logs are fetched before they are read") {
+		t.Errorf("expected the remote logs to be warned about, got %q", stderr)
+	}
+}
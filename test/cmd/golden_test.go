@@ -0,0 +1,151 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// rewrites the golden files with what the pulls write now, for a change to an output format
+// that is meant: go test ./test/cmd -run TestGolden -update, then review the diff of testdata.
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of TestGolden with the outputs of the pulls.")
+
+// a pull over a tiny synthetic archive, whose outputs are checked against the golden files in
+// testdata/golden/<name>.
+type goldenCase struct {
+	name   string
+	format string   // format of the synthetic archive, json or tsv
+	args   []string // command and flags, given the archive, time range and output directory
+}
+
+var goldenCases = []goldenCase{
+	{"json", lib.SynthJSON, []string{"run", "conn", "cat"}},
+	{"json-concat", lib.SynthJSON, []string{"run", "-c", "dns", "cat"}},
+	{"json-alphabetical", lib.SynthJSON, []string{"run", "-c", "--field-order", "alphabetical", "conn", "cat"}},
+	{"json-msgpack", lib.SynthJSON, []string{"run", "-c", "--output-format", "msgpack", "dns", "cat"}},
+	{"json-unique", lib.SynthJSON, []string{"run", "--unique", "id.resp_p,proto", "conn", "cat"}},
+	{"json-conn-summary", lib.SynthJSON, []string{"run", "-c", "--conn-summary", "alongside", "conn", "cat"}},
+	{"json-jq", lib.SynthJSON, []string{"run", "-c", "--jq", "{query, rtt}", "dns"}},
+	{"json-filter-ip", lib.SynthJSON, []string{"filter-ip", "-c", "conn", "192.0.2.0/24"}},
+	{"json-where", lib.SynthJSON, []string{"run", "-c", "--where", "proto == 'tcp' || id.resp_h in 192.0.2.0/24", "conn"}},
+	{"tsv", lib.SynthTSV, []string{"run", "-c", "dns", "cat"}},
+	{"tsv-msgpack", lib.SynthTSV, []string{"run", "-c", "--output-format", "msgpack", "dns", "cat"}},
+	{"tsv-conn-summary", lib.SynthTSV, []string{"run", "--conn-summary", "only", "conn", "cat"}},
+	{"tsv-jq", lib.SynthTSV, []string{"run", "-c", "--jq", "{query, rtt}", "dns"}},
+	{"tsv-filter-ip", lib.SynthTSV, []string{"filter-ip", "-c", "conn", "192.0.2.0/24"}},
+	{"tsv-where", lib.SynthTSV, []string{"run", "-c", "--where", "proto == 'tcp' || id.resp_h in 192.0.2.0/24", "conn"}},
+	{"sql-tsv", lib.SynthTSV, []string{"sql", "SELECT proto, count(*) AS n FROM conn GROUP BY proto ORDER BY proto"}},
+	{"sql-json", lib.SynthJSON, []string{"sql", "--format", "json", "SELECT id_resp_p, count(*) FROM conn GROUP BY 1 ORDER BY 1"}},
+}
+
+// Test the outputs of pulls in every format against the golden files checked in with them, so
+// a change to what is written is deliberate, and reviewed as a diff of testdata. Every file in
+// the output directory is compared, MessagePack outputs decoded, and what sql prints is
+// compared as stdout.
+func TestGolden(t *testing.T) {
+	archives := make(map[string]string)
+	for _, format := range lib.SynthFormats() {
+		archives[format] = filepath.Join(t.TempDir(), "archive")
+		if _, stderr, e := execute(t, "", "synth", "--records", "2", "--format", format, archives[format]); e != nil {
+			t.Fatalf("%v:\n%s", e, stderr)
+		}
+	}
+
+	for _, c := range goldenCases {
+		outDir := filepath.Join(t.TempDir(), "out")
+		args := append([]string{c.args[0], "-N", "-i", archives[c.format], "-r", testRange}, c.args[1:]...)
+		if c.args[0] != "sql" {
+			args = append(args[:1], append([]string{"-o", outDir}, args[1:]...)...)
+		}
+		stdout, stderr, e := execute(t, "", args...)
+		if e != nil {
+			t.Errorf("%s: %v:\n%s", c.name, e, stderr)
+			continue
+		}
+
+		outputs := make(map[string][]byte)
+		if stdout != "" {
+			outputs["stdout"] = []byte(stdout)
+		}
+		entries, _ := os.ReadDir(outDir)
+		for _, entry := range entries {
+			if entry.Name() == lib.OutputMarker {
+				continue
+			}
+			content, e := os.ReadFile(filepath.Join(outDir, entry.Name()))
+			if e != nil {
+				t.Fatal(e)
+			}
+			if strings.HasSuffix(entry.Name(), ".msgpack") {
+				content = decodedMsgpack(t, content)
+			}
+			outputs[entry.Name()] = content
+		}
+		checkGolden(t, filepath.Join("testdata", "golden", c.name), outputs)
+	}
+}
+
+// compares outputs, by file name, with the golden files in dir, or rewrites them with -update.
+func checkGolden(t *testing.T, dir string, outputs map[string][]byte) {
+	if *updateGolden {
+		os.RemoveAll(dir)
+		if e := os.MkdirAll(dir, 0755); e != nil {
+			t.Fatal(e)
+		}
+		for name, content := range outputs {
+			if e := os.WriteFile(filepath.Join(dir, name), content, 0644); e != nil {
+				t.Fatal(e)
+			}
+		}
+		return
+	}
+
+	entries, e := os.ReadDir(dir)
+	if e != nil {
+		t.Errorf("%s: %v, run with -update to write it", dir, e)
+		return
+	}
+	var golden, produced []string
+	for _, entry := range entries {
+		golden = append(golden, entry.Name())
+	}
+	for name := range outputs {
+		produced = append(produced, name)
+	}
+	sort.Strings(produced)
+	if strings.Join(golden, " ") != strings.Join(produced, " ") {
+		t.Errorf("%s: produced %v, expected %v", dir, produced, golden)
+	}
+	for _, name := range golden {
+		want, _ := os.ReadFile(filepath.Join(dir, name))
+		if got, ok := outputs[name]; ok && !bytes.Equal(got, want) {
+			t.Errorf("%s: differs from the golden file:\n%s\nexpected:\n%s", filepath.Join(dir, name), got, want)
+		}
+	}
+}
+
+// returns the MessagePack values of content as a JSON line each, so their golden files can be
+// read and diffed. Keys of maps are sorted.
+func decodedMsgpack(t *testing.T, content []byte) []byte {
+	var decoded bytes.Buffer
+	for len(content) > 0 {
+		var v interface{}
+		var e error
+		if v, content, e = lib.DecodeMsgpack(content); e != nil {
+			t.Fatal(e)
+		}
+		line, e := json.Marshal(v)
+		if e != nil {
+			t.Fatal(e)
+		}
+		decoded.Write(append(line, '\n'))
+	}
+	return decoded.Bytes()
+}
@@ -0,0 +1,57 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the logs and date directories of a pull that cannot be read are listed, while
+// the readable ones are only counted.
+func TestVerifyAccess(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can read every file")
+	}
+	logDir := t.TempDir()
+	for _, log := range []string{"2021-06-01/conn.00:00:00-01:00:00.log.gz", "2021-06-01/conn.01:00:00-02:00:00.log.gz", "2021-06-02/conn.00:00:00-01:00:00.log.gz"} {
+		path := filepath.Join(logDir, log)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if e := os.WriteFile(path, []byte("x"), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	denied := filepath.Join(logDir, "2021-06-01", "conn.01:00:00-02:00:00.log.gz")
+	os.Chmod(denied, 0)
+	deniedDir := filepath.Join(logDir, "2021-06-02")
+	os.Chmod(deniedDir, 0)
+	defer os.Chmod(deniedDir, 0755)
+
+	rc := lib.RuntimeConfig{
+		LogType:   "conn",
+		LogDir:    logDir,
+		StartTime: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2021, 6, 3, 23, 0, 0, 0, time.UTC),
+	}
+	failures, checked, e := lib.VerifyAccess(rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var paths []string
+	for _, failure := range failures {
+		if !os.IsPermission(failure.Err) {
+			t.Errorf("expected %s to be denied, got %v", failure.Path, failure.Err)
+		}
+		paths = append(paths, failure.Path)
+	}
+	if want := []string{deniedDir, denied}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected %v to be denied, got %v", want, paths)
+	}
+	// both date directories, and the logs of the readable one.
+	if checked != 4 {
+		t.Errorf("expected 4 paths to be checked, got %d", checked)
+	}
+}
@@ -0,0 +1,85 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// echoes every line back, prefixed with its pid, and the delimiter as it is.
+const batchScript = `while IFS= read -r line; do
+	if [ "$line" = "` + lib.DefaultBatchDelimiter + `" ]; then echo "$line"; else echo "$$ $line"; fi
+done`
+
+// Test that logs fed to a pool are filtered by the same process, each getting only its output.
+func TestFilterPool(t *testing.T) {
+	pool := lib.NewFilterPool("/bin/sh", []string{"-c", batchScript}, lib.DefaultBatchDelimiter)
+	var outputs []string
+	for _, input := range []string{"first\nsecond\n", "third"} {
+		filter, e := pool.Get()
+		if e != nil {
+			t.Fatal(e)
+		}
+		var out bytes.Buffer
+		if e = filter.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+			t.Fatal(e)
+		}
+		pool.Put(filter, false)
+		outputs = append(outputs, out.String())
+	}
+
+	pid := strings.Fields(outputs[0])[0]
+	if outputs[0] != pid+" first\n"+pid+" second\n" || outputs[1] != pid+" third\n" {
+		t.Errorf("unexpected outputs %q", outputs)
+	}
+	if usage := pool.Close(); len(usage) != 1 || !strings.Contains(usage[0].LogFile, "2 logs") {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+// Test that a filter that exits in the middle of a log is reported as failed.
+func TestBatchFilterExited(t *testing.T) {
+	filter, e := lib.StartBatchFilter("/bin/sh", []string{"-c", "read -r line; echo $line"}, lib.DefaultBatchDelimiter)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var out bytes.Buffer
+	if e = filter.Filter(context.Background(), strings.NewReader("first\nsecond\n"), &out); e == nil {
+		t.Error("expected an error from a filter that exited")
+	}
+	if out.String() != "first\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	filter.Close()
+}
+
+// Test that a log that fails part way, such as a corrupt one, still ends with the delimiter,
+// so the filter gives the output read so far, the error is returned rather than waited on
+// forever, and the filter can be fed the next log.
+func TestBatchFilterInputFails(t *testing.T) {
+	filter, e := lib.StartBatchFilter("/bin/sh", []string{"-c", batchScript}, lib.DefaultBatchDelimiter)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer filter.Close()
+	corrupt := errors.New("gzip: invalid checksum")
+	var out bytes.Buffer
+	input := io.MultiReader(strings.NewReader("first\npart"), iotest.ErrReader(corrupt))
+	if e = filter.Filter(context.Background(), input, &out); !errors.Is(e, corrupt) {
+		t.Errorf("expected the error of the input, got %v", e)
+	}
+	pid := strings.Fields(out.String())[0]
+	if out.String() != pid+" first\n"+pid+" part\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	out.Reset()
+	if e = filter.Filter(context.Background(), strings.NewReader("next\n"), &out); e != nil || out.String() != pid+" next\n" {
+		t.Errorf("unexpected output of the next log %q (%v)", out.String(), e)
+	}
+}
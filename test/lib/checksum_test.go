@@ -0,0 +1,46 @@
+package lib_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that logs are checked against sha256sum style sidecars.
+func TestVerifyChecksum(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("log content")
+	sum := sha256.Sum256(content)
+
+	type testEntry struct {
+		name     string
+		sidecar  string // empty for no sidecar
+		expected error
+	}
+	testTable := []testEntry{
+		{"hash only", hex.EncodeToString(sum[:]) + "\n", nil},
+		{"sha256sum format", hex.EncodeToString(sum[:]) + "  conn.log.gz\n", nil},
+		{"mismatch", hex.EncodeToString(make([]byte, 32)) + "\n", lib.ErrChecksumMismatch},
+		{"no sidecar", "", lib.ErrNoChecksum},
+	}
+
+	for i, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			logFile := filepath.Join(dir, string(rune('a'+i))+".log.gz")
+			ioutil.WriteFile(logFile, content, 0644)
+			if testCase.sidecar != "" {
+				ioutil.WriteFile(logFile+lib.ChecksumSuffix, []byte(testCase.sidecar), 0644)
+			}
+
+			e := lib.VerifyChecksum(logFile)
+			if testCase.expected == nil && e != nil || !errors.Is(e, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, e)
+			}
+		})
+	}
+}
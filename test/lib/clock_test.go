@@ -0,0 +1,81 @@
+package lib_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the logs of a sensor whose clock is off are read by the hours of the time range in
+// its clock, both logs of an hour spread over two, and that the clock offset is that of the
+// configured sensor holding the log directory.
+func TestPullLogsClockOffset(t *testing.T) {
+	logDir := t.TempDir()
+	os.Mkdir(filepath.Join(logDir, "2021-06-01"), 0755)
+	for hour := 8; hour < 13; hour++ {
+		name := time.Date(2021, 6, 1, hour, 0, 0, 0, time.UTC).Format("conn.15:04:05-") + time.Date(2021, 6, 1, hour+1, 0, 0, 0, time.UTC).Format("15:04:05.log.gz")
+		ioutil.WriteFile(filepath.Join(logDir, "2021-06-01", name), nil, 0644)
+	}
+	rc := lib.RuntimeConfig{LogType: "conn", LogDir: logDir}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:10-2021/06/01:10")
+
+	for offset, expected := range map[time.Duration]string{
+		0:                 "conn.10",
+		47 * time.Minute:  "conn.10,conn.11",
+		-47 * time.Minute: "conn.09,conn.10",
+		2 * time.Hour:     "conn.12",
+	} {
+		rc.ClockOffset = offset
+		logFiles, e := lib.PullLogs(rc)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var hours []string
+		for _, logFile := range logFiles {
+			hours = append(hours, filepath.Base(logFile)[:7])
+		}
+		if strings.Join(hours, ",") != expected {
+			t.Errorf("%s: read %v, expected %s", offset, hours, expected)
+		}
+	}
+
+	sensors := []lib.SensorConfig{{Name: "legacy", Path: logDir, ClockOffset: 47 * time.Minute}}
+	if offset := lib.ClockOffsetOf(logDir, sensors); offset != 47*time.Minute {
+		t.Errorf("expected the offset of the sensor, got %s", offset)
+	}
+	if offset := lib.ClockOffsetOf(t.TempDir(), sensors); offset != 0 {
+		t.Errorf("expected no offset for a log directory of no sensor, got %s", offset)
+	}
+}
+
+// Test that the ts of JSON and TSV records is corrected for the clock offset, and that other
+// lines, and records whose ts is unset, are read as they are.
+func TestClockReader(t *testing.T) {
+	input := `{"ts":1622541600.123456,"uid":"C1"}
+{"uid":"C2", "ts" : "2021-06-01T10:00:00.123456Z"}
+{"ts":"-","uid":"C3"}
+#separator \x09
+#fields	uid	ts
+C4	1622541600.123456
+C5	-
+`
+	expected := `{"ts":1622538780.123456,"uid":"C1"}
+{"uid":"C2", "ts" : "2021-06-01T09:13:00.123456Z"}
+{"ts":"-","uid":"C3"}
+#separator \x09
+#fields	uid	ts
+C4	1622538780.123456
+C5	-
+`
+	r := lib.NewClockReader(strings.NewReader(input), 47*time.Minute)
+	defer r.Close()
+	corrected, e := ioutil.ReadAll(r)
+	if e != nil || string(corrected) != expected {
+		t.Errorf("unexpected records:\n%s\nexpected:\n%s (%v)", corrected, expected, e)
+	}
+}
@@ -0,0 +1,102 @@
+package lib_test
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a compressed output replaces the original, and is summarized like it.
+func TestCompressFile(t *testing.T) {
+	for _, format := range lib.Compressions() {
+		if _, e := exec.LookPath("zstd"); format == lib.CompressZstd && e != nil {
+			continue
+		}
+		outDir := t.TempDir()
+		src := filepath.Join(outDir, "conn-2021-06-01.json")
+		os.WriteFile(src, []byte(`{"id.orig_h":"10.0.0.5"}`+"\n"+`{"id.orig_h":"10.0.0.6"}`+"\n"), 0644)
+		dst := src + map[string]string{lib.CompressGzip: ".gz", lib.CompressZstd: ".zst"}[format]
+
+		if e := lib.CompressFile(src, dst, format); e != nil {
+			t.Fatalf("%s: %v", format, e)
+		}
+		entries, _ := os.ReadDir(outDir)
+		if len(entries) != 1 || entries[0].Name() != filepath.Base(dst) {
+			t.Errorf("%s: expected only %s to be left, got %v", format, filepath.Base(dst), entries)
+		}
+		pull, e := lib.SummarizeOutput("conn", outDir, nil)
+		if e != nil || pull.Records != 2 || len(pull.Days) != 1 || pull.Days[0].Key != "2021-06-01" {
+			t.Errorf("%s: unexpected summary %+v (%v)", format, pull, e)
+		}
+	}
+}
+
+// returns the content of a gzip or zstd compressed file.
+func readCompressed(t *testing.T, path string) string {
+	if filepath.Ext(path) == ".zst" {
+		content, e := exec.Command("zstd", "-dcq", path).Output()
+		if e != nil {
+			t.Fatal(e)
+		}
+		return string(content)
+	}
+	f, e := os.Open(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+	zr, e := gzip.NewReader(f)
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, e := io.ReadAll(zr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return string(content)
+}
+
+// Test that outputs compressed as they are written are concatenated into a compressed output,
+// each input as a member or frame of it, which reads back as the inputs in order, at any level.
+func TestConcatCompressedOutputs(t *testing.T) {
+	defer lib.SetCompressLevel(0)
+	for _, format := range lib.OutputCompressions() {
+		if _, e := exec.LookPath("zstd"); format == lib.CompressZstd && e != nil {
+			continue
+		}
+		for _, level := range []int{0, 1, lib.MaxCompressLevel(format)} {
+			lib.SetCompressLevel(level)
+			ext := map[string]string{lib.CompressGzip: ".gz", lib.CompressZstd: ".zst"}[format]
+			dir := t.TempDir()
+			var inputs []string
+			for _, name := range []string{"b.json", "a.json"} {
+				input := filepath.Join(dir, name+ext)
+				w, e := lib.CreateOutput(input)
+				if e != nil {
+					t.Fatal(e)
+				}
+				w.Write([]byte(name + "\r\n"))
+				if e = w.Close(); e != nil {
+					t.Fatal(e)
+				}
+				inputs = append(inputs, input)
+			}
+			output := filepath.Join(dir, "out.json"+ext)
+			if e := lib.ConcatFiles(log.New(io.Discard, "", 0), inputs, output, true, false); e != nil {
+				t.Fatalf("%s %d: %v", format, level, e)
+			}
+			if content := readCompressed(t, output); content != "a.json\nb.json\n" {
+				t.Errorf("%s %d: unexpected output: %q", format, level, content)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%s %d: expected only the output to be left, got %v", format, level, entries)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package lib_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that conn records are rolled up into a flow per originator, responder, port and
+// protocol, across writers, from JSON and TSV records, the flows with the most bytes first.
+func TestConnSummary(t *testing.T) {
+	s := lib.NewConnSummary()
+	w := s.Writer("a")
+	io.WriteString(w, `{"ts":1622505600.5,"id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1","id.resp_p":3389,"proto":"tcp","duration":1.5,"orig_bytes":100,"resp_bytes":200,"orig_pkts":3,"resp_pkts":4}
+{"ts":1622505700.25,"id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1","id.resp_p":3389,"proto":"tcp","orig_bytes":50,"resp_bytes":null}
+{"ts":1622505650,"id.orig_h":"10.0.0.6","id.resp_h":"192.0.2.1","id.resp_p":53,"proto":"udp","duration":0.25,"orig_bytes":40,"resp_bytes":80}
+`)
+	w.Close()
+	w = s.Writer("b")
+	io.WriteString(w, "#fields\tts\tid.orig_h\tid.resp_h\tid.resp_p\tproto\tduration\torig_bytes\tresp_bytes\torig_pkts\tresp_pkts\n"+
+		"1622505500.000000\t10.0.0.5\t192.0.2.1\t3389\ttcp\t2.000000\t1000\t-\t10\t-\n")
+	w.Close()
+
+	var out bytes.Buffer
+	if e := s.WriteSummary(&out); e != nil {
+		t.Fatal(e)
+	}
+	expected := "id.orig_h\tid.resp_h\tid.resp_p\tproto\tconns\torig_bytes\tresp_bytes\torig_pkts\tresp_pkts\tduration\tfirst_ts\tlast_ts\n" +
+		"10.0.0.5\t192.0.2.1\t3389\ttcp\t3\t1150\t200\t13\t4\t3.500000\t1622505500.000000\t1622505700.250000\n" +
+		"10.0.0.6\t192.0.2.1\t53\tudp\t1\t40\t80\t0\t0\t0.250000\t1622505650.000000\t1622505650.000000\n"
+	if out.String() != expected {
+		t.Errorf("unexpected summary:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+// Test that a writer of the same key replaces the flows of an earlier one, such as a task over
+// the same log run again, and that Tee passes the records on.
+func TestConnSummaryRetried(t *testing.T) {
+	s := lib.NewConnSummary()
+	record := `{"id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1","id.resp_p":22,"proto":"tcp","orig_bytes":10}` + "\n"
+	for i := 0; i < 2; i++ {
+		var passed bytes.Buffer
+		w := s.Tee("a", &passed)
+		io.WriteString(w, record)
+		w.Close()
+		if passed.String() != record {
+			t.Errorf("unexpected records passed on %q", passed.String())
+		}
+	}
+	if flows := s.Flows(); len(flows) != 1 || flows[0].Conns != 1 || flows[0].Bytes() != 10 {
+		t.Errorf("expected the flow of the task run again once, got %+v", flows)
+	}
+}
@@ -0,0 +1,53 @@
+package lib_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// sets the environment variable for the rest of the test.
+func setEnv(t *testing.T, key string, value string) {
+	old, had := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// Test that NAGINI_CONTAINER overrides detection, and that outputs only go to the container
+// volume in a container.
+func TestInContainer(t *testing.T) {
+	setEnv(t, lib.ContainerEnv, "false")
+	if lib.InContainer() {
+		t.Error("expected NAGINI_CONTAINER=false to not be in a container")
+	}
+	if parent := lib.DefaultOutputParent(""); parent != "." {
+		t.Errorf("expected outputs in the working directory, got %s", parent)
+	}
+	setEnv(t, lib.ContainerEnv, "true")
+	if !lib.InContainer() {
+		t.Error("expected NAGINI_CONTAINER=true to be in a container")
+	}
+	if parent := lib.DefaultOutputParent("/srv/hunts"); parent != "/srv/hunts" {
+		t.Errorf("expected the configured output_dir, got %s", parent)
+	}
+}
+
+// Test that global config keys are read from environment variables, and listed as such.
+func TestReadGlobalConfigEnv(t *testing.T) {
+	setEnv(t, lib.ConfigEnvVar("zeek_log_dir"), "/mnt/zeek")
+	setEnv(t, lib.ConfigEnvVar("cache_size_mb"), "64")
+	config, sources, _ := lib.ReadGlobalConfig()
+	if config.ZeekLogDir != "/mnt/zeek" || config.CacheSizeMB != 64 {
+		t.Errorf("expected settings from the environment, got %s and %d", config.ZeekLogDir, config.CacheSizeMB)
+	}
+	if sources["zeek_log_dir"] != lib.SourceEnv {
+		t.Errorf("expected zeek_log_dir from the environment, got %s", sources["zeek_log_dir"])
+	}
+}
@@ -0,0 +1,63 @@
+package lib_test
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that zstd compressed logs are read like gzipped ones, and that a truncated one is
+// found to be corrupt.
+func TestCheckedReaderZstd(t *testing.T) {
+	if _, e := exec.LookPath("zstd"); e != nil {
+		t.Skip("zstd is not installed")
+	}
+	content := strings.Repeat(`{"uid":"C1"}`+"\n", 1000)
+	zstd := exec.Command("zstd", "-q", "-c")
+	zstd.Stdin = strings.NewReader(content)
+	compressed, e := zstd.Output()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	checked, e := lib.NewCheckedReader(bytes.NewReader(compressed))
+	if e != nil {
+		t.Fatal(e)
+	}
+	read, _ := io.ReadAll(checked)
+	if e = checked.Close(); e != nil || checked.Err != nil || string(read) != content {
+		t.Errorf("expected %d bytes, got %d: %v, %v", len(content), len(read), e, checked.Err)
+	}
+
+	checked, e = lib.NewCheckedReader(bytes.NewReader(compressed[:len(compressed)/2]))
+	if e != nil {
+		t.Fatal(e)
+	}
+	io.ReadAll(checked)
+	checked.Close()
+	if checked.Err == nil {
+		t.Error("expected a truncated log to be found corrupt")
+	}
+}
+
+// Test that a plain log, starting with a header or a JSON record, is read as it is, and that
+// anything else that is not compressed is found to be corrupt.
+func TestCheckedReaderPlain(t *testing.T) {
+	for _, content := range []string{"#separator \\x09\n#fields\tuid\nC1\n", `{"uid":"C1"}` + "\n"} {
+		checked, e := lib.NewCheckedReader(strings.NewReader(content))
+		if e != nil {
+			t.Fatal(e)
+		}
+		read, _ := io.ReadAll(checked)
+		if e = checked.Close(); e != nil || checked.Err != nil || string(read) != content {
+			t.Errorf("expected %q, got %q: %v, %v", content, read, e, checked.Err)
+		}
+	}
+	if _, e := lib.NewCheckedReader(strings.NewReader("not a log")); e == nil {
+		t.Error("expected a log that is neither compressed nor a zeek log to be rejected")
+	}
+}
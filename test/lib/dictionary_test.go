@@ -0,0 +1,67 @@
+package lib_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// writes count daily dns outputs of records similar to each other into dir.
+func writeDNSOutputs(t *testing.T, dir string, count int) {
+	for day := 1; day <= count; day++ {
+		var records strings.Builder
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(&records, `{"ts":1622505600.%d,"uid":"C%d%d","id.orig_h":"10.0.0.%d","query":"host%d.example.com","qtype_name":"A"}`+"\n", i, day, i, i%250, i)
+		}
+		if e := os.WriteFile(filepath.Join(dir, fmt.Sprintf("dns-2021-06-%02d.json", day)), []byte(records.String()), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+}
+
+// Test that a dictionary is trained from the outputs of a log type alone, compressed ones
+// included, and that outputs compressed with the copy next to them are read back whole.
+func TestTrainDictionary(t *testing.T) {
+	if _, e := exec.LookPath("zstd"); e != nil {
+		t.Skip("zstd is not installed")
+	}
+	outDir := t.TempDir()
+	writeDNSOutputs(t, outDir, 5)
+	if e := lib.CompressFile(filepath.Join(outDir, "dns-2021-06-05.json"), filepath.Join(outDir, "dns-2021-06-05.json.gz"), lib.CompressGzip); e != nil {
+		t.Fatal(e)
+	}
+	os.WriteFile(filepath.Join(outDir, "conn-2021-06-01.json"), []byte(`{"uid":"C1"}`+"\n"), 0644)
+
+	dictionary := lib.DictionaryPath(t.TempDir(), "dns")
+	samples, e := lib.TrainDictionary("dns", []string{outDir}, dictionary, 8<<10)
+	if e != nil || samples != 5 {
+		t.Fatalf("expected 5 outputs trained from, got %d: %v", samples, e)
+	}
+
+	// an output compressed next to the dictionary is compressed with it.
+	pullDir := t.TempDir()
+	writeDNSOutputs(t, pullDir, 1)
+	content, _ := os.ReadFile(filepath.Join(pullDir, "dns-2021-06-01.json"))
+	copied, _ := os.ReadFile(dictionary)
+	os.WriteFile(filepath.Join(pullDir, "dns"+lib.DictionaryExtension), copied, 0644)
+	dst := filepath.Join(pullDir, "dns-2021-06-01.json.zst")
+	if e = lib.CompressFile(filepath.Join(pullDir, "dns-2021-06-01.json"), dst, lib.CompressZstd); e != nil {
+		t.Fatal(e)
+	}
+	if out, e := exec.Command("zstd", "-dc", dst).CombinedOutput(); e == nil {
+		t.Errorf("expected the output to need its dictionary, got %q", out)
+	}
+	pull, e := lib.SummarizeOutput("dns", pullDir, nil)
+	if e != nil || pull.Files != 1 || pull.Records != strings.Count(string(content), "\n") {
+		t.Errorf("unexpected summary %+v (%v)", pull, e)
+	}
+
+	if _, e = lib.TrainDictionary("http", []string{outDir}, lib.DictionaryPath(t.TempDir(), "http"), 8<<10); e == nil {
+		t.Error("expected training with no outputs of the log type to fail")
+	}
+}
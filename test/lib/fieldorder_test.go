@@ -0,0 +1,42 @@
+package lib_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the fields of JSON and TSV records are written in the given order.
+func TestFieldOrderWriter(t *testing.T) {
+	testTable := []struct {
+		order    string
+		input    string
+		expected string
+	}{
+		{"alphabetical", `{"uid":"C1","ts":1.5,"id.orig_h":"10.0.0.1","tags":["<a>"]}` + "\nnot json\n",
+			`{"id.orig_h":"10.0.0.1","tags":["<a>"],"ts":1.5,"uid":"C1"}` + "\nnot json\n"},
+		{"uid, ts,missing", `{"ts":1.5,"proto":"tcp","uid":"C1"}`,
+			`{"uid":"C1","ts":1.5,"proto":"tcp"}`},
+		{"uid,ts,missing", "#fields\tts\tproto\tuid\n#types\ttime\tenum\tstring\n1.5\ttcp\tC1\nodd\n",
+			"#fields\tuid\tts\tmissing\tproto\n#types\tstring\ttime\tstring\tenum\nC1\t1.5\t-\ttcp\nodd\n"},
+		{"source", `{"uid":"C1","ts":1.5}`, `{"uid":"C1","ts":1.5}`},
+	}
+	for _, testCase := range testTable {
+		order, e := lib.ParseFieldOrder(testCase.order)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var out bytes.Buffer
+		w := lib.NewFieldOrderWriter(&out, order)
+		w.Write([]byte(testCase.input))
+		w.Close()
+		if out.String() != testCase.expected {
+			t.Errorf("%s: unexpected output %q", testCase.order, out.String())
+		}
+	}
+
+	if _, e := lib.ParseFieldOrder("ts,,uid"); e == nil {
+		t.Error("expected an empty field to be rejected")
+	}
+}
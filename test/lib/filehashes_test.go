@@ -0,0 +1,59 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that records of files logs with any listed hash are selected, regardless of case.
+func TestFileHashJQ(t *testing.T) {
+	f, e := lib.NewJQFilter(lib.FileHashJQ([]string{"D41D8CD98F00B204E9800998ECF8427E", "da39a3ee5e6b4b0d3255bfef95601890afd80709"}))
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"fuid":"F1","md5":"d41d8cd98f00b204e9800998ecf8427e"}
+{"fuid":"F2","md5":"other","sha1":"DA39A3EE5E6B4B0D3255BFEF95601890AFD80709"}
+{"fuid":"F3","md5":"other"}
+#fields	fuid	md5	sha1	sha256
+F4	-	-	-
+`
+	var out bytes.Buffer
+	if e = f.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+		t.Fatal(e)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "F1") || !strings.Contains(lines[1], "F2") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+// Test that the retrieval command is run for each file with its fields, carrying on past a
+// file that cannot be retrieved.
+func TestRetrieveFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "extracted")
+	command := []string{"sh", "-c", `test -n "$1" && echo "$2" > "$3/$1"`, "retrieve", "{{ .extracted }}", "{{ .sha256 }}", "{{ .dir }}"}
+	rows := [][]string{
+		{"F1", "-", "-", "abc", "extract-F1.exe"},
+		{"F2", "-", "-", "def", "-"},
+	}
+	var out bytes.Buffer
+	retrieved, e := lib.RetrieveFiles(command, rows, dir, &out)
+	if e != nil || retrieved != 1 {
+		t.Fatalf("expected 1 file to be retrieved, got %d (%v)", retrieved, e)
+	}
+	if content, e := os.ReadFile(filepath.Join(dir, "extract-F1.exe")); e != nil || string(content) != "abc\n" {
+		t.Errorf("unexpected retrieved file %q (%v)", content, e)
+	}
+	if !strings.Contains(out.String(), "F2") {
+		t.Errorf("expected a warning about F2, got %q", out.String())
+	}
+
+	if _, e = lib.RetrieveFiles([]string{"echo", "{{ .fuid"}, rows, dir, &out); e == nil {
+		t.Error("expected an invalid template to be an error")
+	}
+}
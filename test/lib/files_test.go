@@ -0,0 +1,149 @@
+package lib_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// handler that writes the name of each log file as its output.
+func nameHandler(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+	wgDate.Add(1)
+	go func() {
+		defer wgDate.Done()
+		defer taskBar.Increment()
+		ioutil.WriteFile(outputFile, []byte(filepath.Base(logFile)+"\n"), 0644)
+	}()
+}
+
+// Test that the task bar holds the logs of every date, empty dates included, before the first
+// log is handled, and ends at its total.
+func TestParseLogsTaskTotal(t *testing.T) {
+	logDir := t.TempDir()
+	for _, log := range []string{"2021-06-01/conn.00:00:00-01:00:00.log.gz", "2021-06-01/conn.05:00:00-06:00:00.log.gz", "2021-06-04/conn.00:00:00-01:00:00.log.gz"} {
+		os.MkdirAll(filepath.Join(logDir, filepath.Dir(log)), 0755)
+		ioutil.WriteFile(filepath.Join(logDir, log), nil, 0644)
+	}
+	rc := lib.RuntimeConfig{LogType: "conn", LogDir: logDir, OutDir: filepath.Join(t.TempDir(), "out"), Threads: 1, WriteStdout: true}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/04:23")
+
+	var lock sync.Mutex
+	var totals []int64
+	var bar *pb.ProgressBar
+	handler := func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+		lock.Lock()
+		totals, bar = append(totals, taskBar.Total), taskBar
+		lock.Unlock()
+		nameHandler(logFile, outputFile, curTime, wgDate, taskBar)
+	}
+	if e := lib.ParseLogs(io.Discard, io.Discard, handler, log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	if len(totals) != 3 || totals[0] != 3 || totals[2] != 3 {
+		t.Errorf("expected a total of 3 from the first log, got %v", totals)
+	}
+	if bar.Get() != bar.Total {
+		t.Errorf("expected the bar to end at its total of %d, got %d", bar.Total, bar.Get())
+	}
+}
+
+// Test that the logs of every cluster worker are merged in time order, with those of an hour
+// together, whether a worker's logs are named for it or are in a directory of its own.
+func TestParseLogsClusterOrder(t *testing.T) {
+	logDir := t.TempDir()
+	for _, log := range []string{"worker-01.conn.00:00:00-01:00:00.log.gz", "worker-01.conn.01:00:00-02:00:00.log.gz", "worker-02.conn.00:00:00-01:00:00.log.gz", "worker-02.conn.01:00:00-02:00:00.log.gz", "worker-03/conn.00:00:00-01:00:00.log.gz"} {
+		os.MkdirAll(filepath.Join(logDir, "2021-06-01", filepath.Dir(log)), 0755)
+		ioutil.WriteFile(filepath.Join(logDir, "2021-06-01", log), nil, 0644)
+	}
+	rc := lib.RuntimeConfig{LogType: "conn", LogDir: logDir, OutDir: filepath.Join(t.TempDir(), "out"), Threads: 2, WriteStdout: true, Cluster: true}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/01:01")
+
+	var out bytes.Buffer
+	if e := lib.ParseLogs(&out, io.Discard, nameHandler, log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	expected := "worker-01.conn.00:00:00-01:00:00.log.gz\nworker-02.conn.00:00:00-01:00:00.log.gz\nconn.00:00:00-01:00:00.log.gz\n" +
+		"worker-01.conn.01:00:00-02:00:00.log.gz\nworker-02.conn.01:00:00-02:00:00.log.gz\n"
+	if out.String() != expected {
+		t.Errorf("expected the logs of each hour together, got %q", out.String())
+	}
+}
+
+// Test that ParseLogs passes the output of each date with logs to OnDayDone while it still exists.
+func TestParseLogsOnDayDone(t *testing.T) {
+	logDir := t.TempDir()
+	for _, date := range []string{"2021-06-01", "2021-06-03"} {
+		os.Mkdir(filepath.Join(logDir, date), 0755)
+		ioutil.WriteFile(filepath.Join(logDir, date, "conn.00:00:00-01:00:00.log.gz"), nil, 0644)
+	}
+
+	var lock sync.Mutex
+	var done []string
+	rc := lib.RuntimeConfig{
+		LogType:     "conn",
+		LogDir:      logDir,
+		OutDir:      filepath.Join(t.TempDir(), "out"),
+		Threads:     2,
+		WriteStdout: true,
+		OnDayDone: func(date time.Time, outputFile string) {
+			content, e := ioutil.ReadFile(outputFile)
+			if e != nil || string(content) != "conn.00:00:00-01:00:00.log.gz\n" {
+				t.Errorf("%s: unexpected output %q (%v)", date.Format(lib.TimeFormatDate), content, e)
+			}
+			lock.Lock()
+			done = append(done, date.Format(lib.TimeFormatDate))
+			lock.Unlock()
+		},
+	}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/03:23")
+
+	e := lib.ParseLogs(io.Discard, io.Discard, nameHandler, log.New(io.Discard, "", 0), rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	sort.Strings(done)
+	if len(done) != 2 || done[0] != "2021/06/01" || done[1] != "2021/06/03" {
+		t.Errorf("unexpected dates passed to OnDayDone: %v", done)
+	}
+}
+
+// Test that with --compress, OnDayDone is passed the compressed output of each date, once it
+// is written.
+func TestParseLogsOnDayDoneCompressed(t *testing.T) {
+	logDir := t.TempDir()
+	os.Mkdir(filepath.Join(logDir, "2021-06-01"), 0755)
+	ioutil.WriteFile(filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"), nil, 0644)
+	outDir := filepath.Join(t.TempDir(), "out")
+	var done []string
+	rc := lib.RuntimeConfig{
+		LogType:  "conn",
+		LogDir:   logDir,
+		OutDir:   outDir,
+		Threads:  1,
+		Compress: lib.CompressGzip,
+		OnDayDone: func(date time.Time, outputFile string) {
+			if _, e := os.Stat(outputFile); e != nil {
+				t.Errorf("expected the output to exist when passed: %v", e)
+			}
+			done = append(done, outputFile)
+		},
+	}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/01:23")
+	if e := lib.ParseLogs(io.Discard, io.Discard, nameHandler, log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	if len(done) != 1 || done[0] != filepath.Join(outDir, "conn-2021-06-01.json.gz") {
+		t.Errorf("expected the compressed output, got %v", done)
+	}
+}
@@ -0,0 +1,49 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that every fingerprint field of a record holding a listed fingerprint is written,
+// regardless of case.
+func TestFingerprintJQ(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "ja3.txt")
+	os.WriteFile(list, []byte("# known bad\nE7D705A3286E19EA42F587B344EE6865\n\nt13d1516h2_8daaf6152771_02713d6af862\n"), 0644)
+	fingerprints, e := lib.ReadTargets(list)
+	if e != nil || !reflect.DeepEqual(fingerprints, []string{"E7D705A3286E19EA42F587B344EE6865", "t13d1516h2_8daaf6152771_02713d6af862"}) {
+		t.Fatalf("unexpected fingerprints %v (%v)", fingerprints, e)
+	}
+
+	f, e := lib.NewJQFilter(lib.FingerprintJQ(fingerprints))
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"ja3":"e7d705a3286e19ea42f587b344ee6865","ja3s":"other","ja4":"t13d1516h2_8daaf6152771_02713d6af862"}
+{"ja3":"other"}
+#fields	ts	ja3	ja4
+1.0	E7D705A3286E19EA42F587B344EE6865	-
+`
+	var out bytes.Buffer
+	if e = f.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+		t.Fatal(e)
+	}
+	expected := `{"fingerprint":"e7d705a3286e19ea42f587b344ee6865","fingerprint_type":"ja3"}
+{"fingerprint":"t13d1516h2_8daaf6152771_02713d6af862","fingerprint_type":"ja4"}
+{"fingerprint":"E7D705A3286E19EA42F587B344EE6865","fingerprint_type":"ja3"}
+`
+	if out.String() != expected {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	if _, e = lib.ReadTargets(filepath.Join(t.TempDir(), "missing.txt")); e == nil {
+		t.Error("expected a missing list to be an error")
+	}
+}
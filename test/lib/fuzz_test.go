@@ -0,0 +1,122 @@
+//go:build go1.18
+// +build go1.18
+
+package lib_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Fuzz targets for the parsers that read what users and archives hand them. Each runs over its
+// seeds with go test; to fuzz one, such as the time range parser, run
+//
+//	go test -run '^$' -fuzz FuzzParseTimeRange ./test/lib
+
+// Fuzz the time range parser: a range it accepts never ends before it starts.
+func FuzzParseTimeRange(f *testing.F) {
+	for _, seed := range []string{"2021/06/01:00-2021/06/03:23", "2021/06/01:*", "2021/06/*", "2021/06/01:23-2021/06/01:00", "-", ":*"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, timeRange string) {
+		start, end, e := lib.ParseTimeRange(timeRange)
+		if e == nil && end.Before(start) {
+			t.Errorf("%q: accepted a range ending at %v before its start %v", timeRange, end, start)
+		}
+	})
+}
+
+// Fuzz the chunk size and age parsers: days and weeks they accept are as long as they say,
+// rather than wrapped around into another length.
+func FuzzParseChunkSize(f *testing.F) {
+	for _, seed := range []string{"12h", "7d", "2w", "-1d", "15250284453w", "106751991167d"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, chunkSize string) {
+		if chunkSize == "" {
+			return
+		}
+		unit := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[chunkSize[len(chunkSize)-1:]]
+		count, countErr := strconv.ParseInt(chunkSize[:len(chunkSize)-1], 10, 64)
+		for _, parse := range []func(string) (time.Duration, error){lib.ParseChunkSize, lib.ParseAge} {
+			size, e := parse(chunkSize)
+			if e == nil && unit != 0 && (countErr != nil || size/unit != time.Duration(count) || size%unit != 0) {
+				t.Errorf("%q: accepted as %v", chunkSize, size)
+			}
+		}
+	})
+}
+
+// Fuzz the TSV header parser, both reading the schema of a log and filtering its records.
+func FuzzTSVHeaders(f *testing.F) {
+	f.Add("#separator \\x09\n#fields\tts\tid.orig_h\tquery\n#types\ttime\taddr\tstring\n1.0\t10.0.0.5\tevil.ru\n")
+	f.Add("#fields\n#fields\t\n10.0.0.1\n")
+	f.Add(`{"id.orig_h":"10.0.0.5","query":"evil.ru"}` + "\n#fields\tquery\n")
+	filter, e := lib.NewSiteFilter([]string{"id_orig_h = '10.0.0.5'", "query LIKE '%.ru'"})
+	if e != nil {
+		f.Fatal(e)
+	}
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, content string) {
+		path := filepath.Join(dir, "conn.00:00:00-01:00:00.log")
+		if e := os.WriteFile(path, []byte(content), 0644); e != nil {
+			t.Fatal(e)
+		}
+		lib.ReadSchema(path)
+		r := filter.Reader(strings.NewReader(content))
+		defer r.Close()
+		if kept, e := io.ReadAll(r); e != nil || len(kept) > len(content) {
+			t.Errorf("%q: kept %q: %v", content, kept, e)
+		}
+	})
+}
+
+// Fuzz the filter expression language, parsing queries and running those it accepts.
+func FuzzParseSQL(f *testing.F) {
+	for _, seed := range []string{
+		"SELECT id_orig_h, count(*) AS n, max(rtt) FROM dns WHERE query LIKE '%.ru' GROUP BY 1 ORDER BY n DESC, id_orig_h",
+		"select * from dns where rtt / 0 > 1 or not (query in ('a', 'b')) limit 2",
+		"select sum(rtt) - min(rtt) * -1 from dns having count(*) >= 1",
+		"query LIKE '%.checkup.example.com'",
+	} {
+		f.Add(seed)
+	}
+	rc := sqlLogs(f, `{"id.orig_h":"10.0.0.1","query":"a.ru","rtt":1}
+{"id.orig_h":"10.0.0.2","query":"b.RU","rtt":"x"}
+`)
+	f.Fuzz(func(t *testing.T, query string) {
+		lib.NewSiteFilter([]string{query})
+		q, e := lib.ParseSQL(query)
+		if e != nil {
+			return
+		}
+		rows, e := lib.RunSQL(q, rc)
+		if e == nil {
+			lib.WriteSQLResult(io.Discard, q, rows, lib.SQLFormatTSV)
+		}
+	})
+}
+
+// Fuzz the playbook loader, with its variables and strict keys.
+func FuzzParsePlaybook(f *testing.F) {
+	f.Add("description: hunt\ntime_range: 2021/06/01:00-2021/06/01:23\nthreads: 2\ndata_sources:\n  - name: dns\n    log_type: dns\n    command: [grep, '{{ .ip }}']\n")
+	f.Add("extends: base.yaml\ninclude: [a.yaml]\n")
+	f.Add("{{ .missing }}")
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, content string) {
+		path := filepath.Join(dir, "playbook.yaml")
+		if e := os.WriteFile(path, []byte(content), 0644); e != nil {
+			t.Fatal(e)
+		}
+		vars := map[string]string{"ip": "10.0.0.5"}
+		lib.ParsePlaybookWithVars(path, vars)
+		lib.ParsePlaybookStrict(path, vars)
+	})
+}
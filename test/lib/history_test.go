@@ -0,0 +1,74 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that pulls are estimated from the throughput and output ratio of the past pulls of the
+// same log type and filter, read back from the history file.
+func TestEstimateRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "history.jsonl")
+	entries := []lib.HistoryEntry{
+		{LogType: "conn", Filter: "grep x", InputBytes: 100 << 20, OutputBytes: 10 << 20, Seconds: 10},
+		{LogType: "conn", Filter: "grep x", InputBytes: 300 << 20, Stdout: true, Seconds: 30},
+		{LogType: "dns", Filter: "grep x", InputBytes: 1 << 20, OutputBytes: 1 << 20, Seconds: 100},
+		{LogType: "conn", Filter: "grep y", InputBytes: 1 << 20, OutputBytes: 1 << 20, Seconds: 100},
+	}
+	for _, entry := range entries {
+		if e := lib.AppendHistory(path, entry); e != nil {
+			t.Fatal(e)
+		}
+	}
+	// a line cut short, as by a crash while writing it, is skipped.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"log_type":"conn","filter":"gr`)
+	f.Close()
+
+	history, e := lib.ReadHistory(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(history) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(history))
+	}
+	estimate, ok := lib.EstimateRun(history, "conn", "grep x", 1000<<20)
+	if !ok {
+		t.Fatal("expected an estimate")
+	}
+	// 10 MiB/s, and a tenth of the input written by the pull that wrote to a directory.
+	if estimate.Runs != 2 || estimate.Duration != 100*time.Second || estimate.OutputBytes != 100<<20 {
+		t.Errorf("unexpected estimate: %+v", estimate)
+	}
+	if _, ok = lib.EstimateRun(history, "ssl", "grep x", 1000<<20); ok {
+		t.Error("expected no estimate without past pulls of the log type")
+	}
+
+	missing, e := lib.ReadHistory(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if e != nil || len(missing) != 0 {
+		t.Errorf("expected a missing history file to be empty, got %v (%v)", missing, e)
+	}
+}
+
+// Test that the input of a pull is the size of its logs, with the tar containers of dates
+// without a date directory counted whole.
+func TestInputSize(t *testing.T) {
+	logDir := t.TempDir()
+	os.Mkdir(filepath.Join(logDir, "2021-06-01"), 0755)
+	os.WriteFile(filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(logDir, "2021-06-01", "dns.00:00:00-01:00:00.log.gz"), make([]byte, 1000), 0644)
+	os.WriteFile(filepath.Join(logDir, "2021-06-02.tar"), make([]byte, 20), 0644)
+	rc := lib.RuntimeConfig{LogType: "conn", LogDir: logDir}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/02:23")
+	if size, e := lib.InputSize(rc); e != nil || size != 120 {
+		t.Errorf("expected 120 bytes, got %d (%v)", size, e)
+	}
+	rc.LogDir = "sftp://archive/zeek"
+	if size, e := lib.InputSize(rc); e != nil || size != 0 {
+		t.Errorf("expected remote logs not to be counted, got %d (%v)", size, e)
+	}
+}
@@ -0,0 +1,34 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that DetectLanguage honors configuration and locale variables, and that
+// T falls back to english for unknown languages and ids.
+func TestTranslate(t *testing.T) {
+	setEnv(t, "LC_ALL", "")
+	setEnv(t, "LC_MESSAGES", "")
+	setEnv(t, "LANG", "es_MX.UTF-8")
+
+	if lang := lib.DetectLanguage(""); lang != "es" {
+		t.Errorf("expected es from LANG, got %s", lang)
+	}
+	if lang := lib.DetectLanguage("en"); lang != "en" {
+		t.Errorf("expected configured en to win, got %s", lang)
+	}
+	if e := lib.SetLanguage("xx"); e == nil {
+		t.Errorf("expected error for unsupported language")
+	}
+
+	defer lib.SetLanguage(lib.DefaultLanguage)
+	lib.SetLanguage("es")
+	if msg := lib.T("label.threads", 4); msg != "Hilos:\t\t\t\t4\n" {
+		t.Errorf("unexpected translation %q", msg)
+	}
+	if msg := lib.T("no.such.id"); msg != "no.such.id" {
+		t.Errorf("expected unknown id to be returned as-is, got %q", msg)
+	}
+}
@@ -0,0 +1,90 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that records are kept for an address in any address field, in JSON logs by the names of
+// their fields and in TSV logs by their #types, with headers passed on.
+func TestIPFilter(t *testing.T) {
+	f, e := lib.NewIPFilter([]string{"10.0.0.0/24", "192.0.2.7", "2001:db8::/32"}, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"id.orig_h":"10.0.0.5","id.resp_h":"198.51.100.1"}
+{"id.orig_h":"10.0.1.5","id.resp_h":"198.51.100.1"}
+{"src":"192.0.2.7","msg":"10.0.0.5"}
+{"tx_hosts":["198.51.100.9","2001:db8::1"]}
+{"query":"10.0.0.5","orig_l2_addr":"10.0.0.5"}
+#separator \x09
+#fields	ts	peer	query	rx_hosts
+#types	time	addr	string	set[addr]
+1.0	198.51.100.1	10.0.0.5	-
+2.0	198.51.100.1	-	198.51.100.2,10.0.0.9
+3.0	10.0.0.200	-	-
+`
+	var out bytes.Buffer
+	if e = f.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(input, "\n")
+	expected := strings.Join([]string{lines[0], lines[2], lines[3], lines[5], lines[6], lines[7], lines[9], lines[10]}, "\n") + "\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+// Test that only the given fields are matched on, if any.
+func TestIPFilterFields(t *testing.T) {
+	f, e := lib.NewIPFilter([]string{"10.0.0.0/8"}, []string{"id.orig_h"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"id.orig_h":"10.0.0.5","id.resp_h":"198.51.100.1"}
+{"id.orig_h":"198.51.100.1","id.resp_h":"10.0.0.5"}
+#fields	id.orig_h	id.resp_h
+10.1.1.1	198.51.100.1
+198.51.100.1	10.1.1.1
+`
+	var out bytes.Buffer
+	if e = f.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(input, "\n")
+	if expected := strings.Join([]string{lines[0], lines[2], lines[3]}, "\n") + "\n"; out.String() != expected {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if !reflect.DeepEqual(f.Fields(), []string{"id.orig_h"}) {
+		t.Errorf("unexpected fields %v", f.Fields())
+	}
+}
+
+// Test that subnets that are not CIDRs or addresses are rejected.
+func TestIPFilterInvalid(t *testing.T) {
+	for _, subnet := range []string{"10.0.0.0/33", "10.0.0", "evil.ru", ""} {
+		if _, e := lib.NewIPFilter([]string{subnet}, nil); e == nil {
+			t.Errorf("%q: expected an error", subnet)
+		}
+	}
+}
+
+// Test that the address fields of known log types are found by their names.
+func TestAddressFields(t *testing.T) {
+	known := lib.KnownLogTypes(nil)
+	for logType, want := range map[string][]string{
+		"conn":   {"id.orig_h", "id.resp_h"},
+		"dhcp":   {"client_addr", "server_addr", "requested_addr", "assigned_addr"},
+		"notice": {"id.orig_h", "id.resp_h", "src", "dst"},
+		"custom": nil,
+	} {
+		if got := lib.AddressFields(logType, known); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", logType, got, want)
+		}
+	}
+}
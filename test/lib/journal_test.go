@@ -0,0 +1,64 @@
+package lib_test
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a concatenation leaves no journal once done, and deletes its inputs.
+func TestConcatFilesJournal(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for _, name := range []string{"b.json", "a.json"} {
+		input := filepath.Join(dir, name)
+		os.WriteFile(input, []byte(name+"\n"), 0644)
+		inputs = append(inputs, input)
+	}
+	output := filepath.Join(dir, "out.json")
+	if e := lib.ConcatFiles(log.New(io.Discard, "", 0), inputs, output, true, false); e != nil {
+		t.Fatal(e)
+	}
+	content, _ := os.ReadFile(output)
+	if string(content) != "a.json\nb.json\n" {
+		t.Errorf("unexpected output: %q", content)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the output to be left, got %v", entries)
+	}
+}
+
+// Test that a concatenation cut short is finished from its journal: output written after the
+// last input done is dropped, an input done but not removed is removed, and the rest written.
+func TestResumeConcats(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.json", "c.json"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name+"\n"), 0644)
+	}
+	output := filepath.Join(dir, "out.json")
+	// a.json is done and removed, b.json is done but not removed, c.json was cut short.
+	os.WriteFile(output, []byte("a.json\nb.json\nc.j"), 0644)
+	journal := `{"output":"` + output + `","inputs":["` + filepath.Join(dir, "a.json") + `","` + filepath.Join(dir, "b.json") + `","` + filepath.Join(dir, "c.json") + `"],"done":2,"offset":14,"delete_inputs":true}`
+	os.WriteFile(output+lib.ConcatJournalSuffix, []byte(journal), 0644)
+
+	finished, e := lib.ResumeConcats(log.New(io.Discard, "", 0), dir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(finished) != 1 || finished[0] != output {
+		t.Errorf("expected %s to be finished, got %v", output, finished)
+	}
+	content, _ := os.ReadFile(output)
+	if string(content) != "a.json\nb.json\nc.json\n" {
+		t.Errorf("unexpected output: %q", content)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the output to be left, got %v", entries)
+	}
+}
@@ -0,0 +1,66 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that json and tsv records are run through the expression, skipping those it fails on.
+func TestJQFilter(t *testing.T) {
+	f, e := lib.NewJQFilter(`select(.query | test("evil")) | {query, n: (.n // 0)}`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"query":"evil.ru","n":12345678901}
+{"query":"good.com"}
+{"query":1}
+#separator \x09
+#fields	ts	query	n
+1.0	evil.com	-
+`
+	var out bytes.Buffer
+	e = f.Filter(context.Background(), strings.NewReader(input), &out)
+	if e == nil || !strings.Contains(e.Error(), "1 record(s)") {
+		t.Errorf("expected the record with a numeric query to fail, got %v", e)
+	}
+	expected := `{"n":12345678901,"query":"evil.ru"}` + "\n" + `{"n":0,"query":"evil.com"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+// Test that the values of TSV records are typed by their #types header, so numbers and
+// booleans compare as they do in JSON records, and are written as numbers and booleans.
+func TestJQFilterTypes(t *testing.T) {
+	f, e := lib.NewJQFilter(`select(."id.resp_p" == 443 and .local_orig) | {ts, "id.resp_p", local_orig, history}`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `#fields	ts	id.resp_p	local_orig	history
+#types	time	port	bool	string
+1623456789.123456	443	T	ShAD
+1623456790.5	80	T	S
+1623456791.0	443	F	-
+{"ts":1623456792.0,"id.resp_p":443,"local_orig":true,"history":"Sh"}
+`
+	var out bytes.Buffer
+	if e = f.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+		t.Fatal(e)
+	}
+	expected := `{"history":"ShAD","id.resp_p":443,"local_orig":true,"ts":1623456789.123456}` + "\n" +
+		`{"history":"Sh","id.resp_p":443,"local_orig":true,"ts":1623456792}` + "\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+// Test that an invalid expression is rejected before anything runs.
+func TestJQFilterInvalid(t *testing.T) {
+	if _, e := lib.NewJQFilter(`select(`); e == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
@@ -0,0 +1,82 @@
+package lib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that job names are valid Kubernetes names.
+func TestJobName(t *testing.T) {
+	cases := map[string]string{
+		"hunts/dns_evil.yaml":  "dns-evil",
+		"Lateral Movement.yml": "lateral-movement",
+		"__.yaml":              "nagini",
+	}
+	for path, expected := range cases {
+		if name := lib.JobName(path); name != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, name)
+		}
+	}
+}
+
+// Test that a job runs its playbook, pointed at the mounted volumes, with resources derived
+// from its threads, and that a schedule makes it a CronJob.
+func TestRenderJobManifest(t *testing.T) {
+	playbook := lib.Playbook{
+		OutputDir:   "./hunt",
+		ZeekLogDir:  "/nsm/zeek",
+		DataSources: []lib.DataSource{{Name: "dns-evil", Type: "dns", JQ: `select(.query == "evil.com")`}},
+	}
+	var out bytes.Buffer
+	e := lib.RenderJobManifest(&out, lib.JobManifest{Name: "hunt", Image: "nagini:1.0", LogClaim: "zeek-logs", Threads: 2, Playbook: playbook})
+	if e != nil {
+		t.Fatal(e)
+	}
+	docs := strings.Split(out.String(), "\n---\n")
+	if len(docs) != 2 {
+		t.Fatalf("expected a ConfigMap and a Job, got:\n%s", out.String())
+	}
+	var configMap struct {
+		Data map[string]string `yaml:"data"`
+	}
+	if e = yaml.Unmarshal([]byte(docs[0]), &configMap); e != nil {
+		t.Fatal(e)
+	}
+	var stored lib.Playbook
+	if e = yaml.UnmarshalStrict([]byte(configMap.Data["playbook.yaml"]), &stored); e != nil {
+		t.Fatal(e)
+	}
+	if stored.ZeekLogDir != lib.ContainerLogDir || stored.OutputDir != "/output/hunt" || stored.DataSources[0].JQ != playbook.DataSources[0].JQ {
+		t.Errorf("unexpected playbook: %+v", stored)
+	}
+
+	var job map[string]interface{}
+	if e = yaml.Unmarshal([]byte(docs[1]), &job); e != nil {
+		t.Fatal(e)
+	}
+	if job["kind"] != "Job" {
+		t.Errorf("expected a Job, got %v", job["kind"])
+	}
+	for _, expected := range []string{`memory: "512Mi"`, `memory: "1024Mi"`, `cpu: "2"`, `claimName: "zeek-logs"`, "emptyDir: {}"} {
+		if !strings.Contains(docs[1], expected) {
+			t.Errorf("expected %s in the job:\n%s", expected, docs[1])
+		}
+	}
+
+	out.Reset()
+	e = lib.RenderJobManifest(&out, lib.JobManifest{Name: "hunt", Image: "nagini:1.0", LogClaim: "zeek-logs", Schedule: "@daily", Threads: 2, Playbook: playbook})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = yaml.Unmarshal([]byte(strings.Split(out.String(), "\n---\n")[1]), &job); e != nil {
+		t.Fatal(e)
+	}
+	if job["kind"] != "CronJob" {
+		t.Errorf("expected a CronJob, got %v", job["kind"])
+	}
+}
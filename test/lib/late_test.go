@@ -0,0 +1,94 @@
+package lib_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that logs delivered while waiting for late logs are pulled into the output of their date.
+func TestParseLogsWaitLate(t *testing.T) {
+	logDir := t.TempDir()
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	os.Mkdir(dateDir, 0755)
+	ioutil.WriteFile(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), nil, 0644)
+
+	rc := lib.RuntimeConfig{
+		LogType:     "conn",
+		LogDir:      logDir,
+		OutDir:      filepath.Join(t.TempDir(), "out"),
+		Threads:     1,
+		WriteStdout: true,
+		WaitLate:    time.Second,
+		Report:      &lib.RunReport{},
+	}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/01:02")
+
+	// reading the first log delivers the next hour late, which has settled, and the one after,
+	// which is still being written when the grace period is over.
+	var once sync.Once
+	handler := func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+		once.Do(func() {
+			// delivered once the first pass is over.
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				settled := filepath.Join(dateDir, "conn.01:00:00-02:00:00.log.gz")
+				ioutil.WriteFile(settled, nil, 0644)
+				os.Chtimes(settled, time.Now().Add(-time.Minute), time.Now().Add(-time.Minute))
+				ioutil.WriteFile(filepath.Join(dateDir, "conn.02:00:00-03:00:00.log.gz"), nil, 0644)
+			}()
+		})
+		nameHandler(logFile, outputFile, curTime, wgDate, taskBar)
+	}
+
+	var stdout bytes.Buffer
+	if e := lib.ParseLogs(&stdout, io.Discard, handler, log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	expected := "conn.00:00:00-01:00:00.log.gz\nconn.01:00:00-02:00:00.log.gz\nconn.02:00:00-03:00:00.log.gz\n"
+	if stdout.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, stdout.String())
+	}
+	if rc.Report.Late != 2 {
+		t.Errorf("expected 2 late logs, got %d", rc.Report.Late)
+	}
+}
+
+// Test that logs of a date directory created while waiting for late logs are pulled.
+func TestParseLogsWaitLateNewDate(t *testing.T) {
+	logDir := t.TempDir()
+	rc := lib.RuntimeConfig{
+		LogType:     "conn",
+		LogDir:      logDir,
+		OutDir:      filepath.Join(t.TempDir(), "out"),
+		Threads:     1,
+		WriteStdout: true,
+		WaitLate:    time.Second,
+	}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/01:01")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		dateDir := filepath.Join(logDir, "2021-06-01")
+		os.Mkdir(dateDir, 0755)
+		ioutil.WriteFile(filepath.Join(dateDir, "conn.00:00:00-01:00:00.log.gz"), nil, 0644)
+	}()
+
+	var stdout bytes.Buffer
+	if e := lib.ParseLogs(&stdout, io.Discard, nameHandler, log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	if stdout.String() != "conn.00:00:00-01:00:00.log.gz\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
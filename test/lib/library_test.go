@@ -0,0 +1,41 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that playbooks are listed and found by name, skipping hidden directories and other
+// files, and that names cannot leave the library.
+func TestPlaybookLibrary(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dns"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, "dns", "evil.yaml"), []byte("description: evil domains\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "rdp.yml"), []byte("data_sources: []\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".git", "config.yaml"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "README.md"), nil, 0644)
+
+	playbooks, e := lib.ListPlaybooks(dir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(playbooks) != 2 || playbooks[0].Name != "dns/evil" || playbooks[0].Description != "evil domains" || playbooks[1].Name != "rdp" {
+		t.Errorf("unexpected playbooks: %+v", playbooks)
+	}
+
+	if path, e := lib.FindPlaybook(dir, "rdp"); e != nil || path != filepath.Join(dir, "rdp.yml") {
+		t.Errorf("unexpected path %s (%v)", path, e)
+	}
+	if path, e := lib.FindPlaybook(dir, "dns/evil.yaml"); e != nil || path != filepath.Join(dir, "dns", "evil.yaml") {
+		t.Errorf("unexpected path %s (%v)", path, e)
+	}
+	for _, name := range []string{"missing", "README.md", "../rdp", "/etc/passwd", ""} {
+		if _, e := lib.FindPlaybook(dir, name); e == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package lib_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a record limit lets exactly max whole records through, across writers.
+func TestRecordLimitMax(t *testing.T) {
+	limit := lib.NewRecordLimit(lib.RuntimeConfig{MaxRecords: 3})
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var first, second bytes.Buffer
+	w := limit.Writer(&first, day)
+	// records split across writes are only counted once complete.
+	w.Write([]byte("a\nb"))
+	w.Write([]byte("b\n"))
+	w.Close()
+	w = limit.Writer(&second, day.Add(time.Hour))
+	if _, e := w.Write([]byte("c\nd\ne\n")); e == nil {
+		t.Error("expected an error once the limit was reached")
+	}
+	w.Close()
+
+	if first.String() != "a\nbb\n" || second.String() != "c\n" {
+		t.Errorf("unexpected records: %q, %q", first.String(), second.String())
+	}
+	if !limit.Reached() || limit.Context(day).Err() == nil {
+		t.Error("expected the limit to be reached")
+	}
+}
+
+// Test that a per-day limit lets one record through for each day.
+func TestRecordLimitPerDay(t *testing.T) {
+	limit := lib.NewRecordLimit(lib.RuntimeConfig{FirstMatchPerDay: true})
+	firstDay := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	secondDay := firstDay.AddDate(0, 0, 1)
+
+	var out bytes.Buffer
+	for _, day := range []time.Time{firstDay, firstDay.Add(time.Hour), secondDay} {
+		w := limit.Writer(&out, day)
+		w.Write([]byte(day.Format(lib.TimeFormatHuman) + "\nmore\n"))
+		w.Close()
+	}
+
+	if out.String() != "2021/06/01 00:00:00\n2021/06/02 00:00:00\n" {
+		t.Errorf("unexpected records: %q", out.String())
+	}
+	if limit.Reached() {
+		t.Error("a per-day limit should not stop the whole pull")
+	}
+}
+
+// Test that the headers of TSV logs are passed through without being counted as records,
+// while records are still wanted.
+func TestRecordLimitTSV(t *testing.T) {
+	header := "#separator \\x09\n#fields\tts\tuid\n#types\ttime\tstring\n"
+	for _, rc := range []lib.RuntimeConfig{{MaxRecords: 2}, {FirstMatchPerDay: true}} {
+		limit := lib.NewRecordLimit(rc)
+		day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+		var out bytes.Buffer
+		w := limit.Writer(&out, day)
+		w.Write([]byte(header + "1.0\tC1\n2.0\tC2\n3.0\tC3\n#close\t2021-06-01-01-00-00\n"))
+		w.Close()
+
+		expected := header + "1.0\tC1\n"
+		if rc.MaxRecords == 2 {
+			expected += "2.0\tC2\n"
+		}
+		if out.String() != expected {
+			t.Errorf("%+v: unexpected records: %q", rc, out.String())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package lib_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the lineage events of a pull name its log type as the input and its output
+// directory as the output, with a random run id, and a failed one holds what it failed with.
+func TestNewLineageEvent(t *testing.T) {
+	rc := lib.RuntimeConfig{
+		LogType:   "conn",
+		LogDir:    "/data/zeek/logs",
+		OutDir:    "/out/conn",
+		StartTime: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2021, 6, 1, 23, 0, 0, 0, time.UTC),
+	}
+	runID := lib.NewLineageRunID()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(runID) || runID == lib.NewLineageRunID() {
+		t.Errorf("expected a random UUID, got %s", runID)
+	}
+
+	event := lib.NewLineageEvent(lib.LineageStart, runID, "soc", "run.conn", rc, "grepcidr 10.0.0.5", nil)
+	host, _ := os.Hostname()
+	if event.EventType != "START" || event.Run.RunID != runID || event.Job != (lib.LineageJob{Namespace: "soc", Name: "run.conn"}) {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if len(event.Inputs) != 1 || event.Inputs[0] != (lib.LineageDataset{Namespace: "file://" + host, Name: "/data/zeek/logs/conn"}) {
+		t.Errorf("unexpected inputs %+v", event.Inputs)
+	}
+	if len(event.Outputs) != 1 || event.Outputs[0] != (lib.LineageDataset{Namespace: "file://" + host, Name: "/out/conn"}) {
+		t.Errorf("unexpected outputs %+v", event.Outputs)
+	}
+	if _, failed := event.Run.Facets["errorMessage"]; failed {
+		t.Errorf("expected no error facet, got %+v", event.Run.Facets)
+	}
+
+	rc.LogDir, rc.WriteStdout = "sftp://analyst@archive-host/data/zeek/logs", true
+	event = lib.NewLineageEvent(lib.LineageFail, runID, "soc", "run.conn", rc, "cat", errors.New("no logs"))
+	if event.Inputs[0] != (lib.LineageDataset{Namespace: "sftp://archive-host", Name: "/data/zeek/logs/conn"}) || len(event.Outputs) != 0 {
+		t.Errorf("unexpected datasets %+v, %+v", event.Inputs, event.Outputs)
+	}
+	if _, failed := event.Run.Facets["errorMessage"]; !failed {
+		t.Errorf("expected an error facet, got %+v", event.Run.Facets)
+	}
+}
+
+// Test that lineage events are posted as OpenLineage JSON with the bearer token.
+func TestPostLineageEvent(t *testing.T) {
+	var received map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if e := json.NewDecoder(r.Body).Decode(&received); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	rc := lib.RuntimeConfig{LogType: "dns", LogDir: "/data/zeek/logs", OutDir: "/out"}
+	event := lib.NewLineageEvent(lib.LineageComplete, lib.NewLineageRunID(), "soc", "run.dns", rc, "cat", nil)
+	if e := lib.PostLineageEvent(server.URL, "secret", event); e != nil {
+		t.Fatal(e)
+	}
+	if auth != "Bearer secret" || received["eventType"] != "COMPLETE" || received["producer"] == nil || received["schemaURL"] == nil {
+		t.Errorf("unexpected event %v (auth %q)", received, auth)
+	}
+	facets := received["run"].(map[string]interface{})["facets"].(map[string]interface{})
+	if nagini := facets["nagini"].(map[string]interface{}); nagini["log_type"] != "dns" || nagini["_producer"] == nil {
+		t.Errorf("unexpected facets %v", facets)
+	}
+}
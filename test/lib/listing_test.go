@@ -0,0 +1,40 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a listing matches as filepath.Glob does, including in the directories of cluster
+// workers, and keeps what it listed first.
+func TestDirListingGlob(t *testing.T) {
+	dateDir := filepath.Join(t.TempDir(), "2021-06-01")
+	for _, name := range []string{"conn.00:00:00-01:00:00.log.gz", "dns.00:00:00-01:00:00.log.gz", "worker-01/conn.00:00:00-01:00:00.log.gz", "worker-02/conn.00:00:00-01:00:00.log.gz"} {
+		path := filepath.Join(dateDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if e := os.WriteFile(path, nil, 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	listing := lib.NewDirListing()
+	for _, pattern := range []string{"conn.00*", "*/conn.00*", "*.conn.00*", "http.*"} {
+		want, _ := filepath.Glob(filepath.Join(dateDir, pattern))
+		got, e := listing.Glob(filepath.Join(dateDir, pattern))
+		if e != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v (%v), want %v", pattern, got, e, want)
+		}
+	}
+	if _, e := listing.Glob(filepath.Join(dateDir, "[")); e == nil {
+		t.Error("expected a bad pattern rejected")
+	}
+
+	os.WriteFile(filepath.Join(dateDir, "conn.01:00:00-02:00:00.log.gz"), nil, 0644)
+	if got, _ := listing.Glob(filepath.Join(dateDir, "conn.01*")); len(got) != 0 {
+		t.Errorf("expected a log written since the listing not seen, got %v", got)
+	}
+}
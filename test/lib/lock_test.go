@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package lib_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a locked directory cannot be locked again until it is unlocked.
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	lock, e := lib.LockDir(dir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := lib.LockDir(dir); !errors.Is(e, lib.ErrOutputLocked) {
+		t.Errorf("expected ErrOutputLocked, got %v", e)
+	}
+
+	if e = lock.Unlock(); e != nil {
+		t.Fatal(e)
+	}
+	lock, e = lib.LockDir(dir)
+	if e != nil {
+		t.Fatalf("expected the lock to be released, got %v", e)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,55 @@
+package lib_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that patterns of log types are told apart from log types.
+func TestIsLogTypePattern(t *testing.T) {
+	for logType, want := range map[string]bool{"conn": false, "conn-summary": false, "conn*": true, "dn?": true, "[cd]*": true, "/^conn/": true, "/": false} {
+		if got := lib.IsLogTypePattern(logType); got != want {
+			t.Errorf("%q: got %v, want %v", logType, got, want)
+		}
+	}
+}
+
+// Test that a pattern matches the log types that have logs in the time range, including those
+// of cluster workers when pulled.
+func TestMatchLogTypes(t *testing.T) {
+	logDir := t.TempDir()
+	for _, name := range []string{"2021-06-01/conn.00:00:00-01:00:00.log.gz", "2021-06-01/conn-summary.00:00:00-01:00:00.log.gz", "2021-06-01/dns.00:00:00-01:00:00.log.gz", "2021-06-01/worker-01/conn_long.00:00:00-01:00:00.log.gz", "2021-06-03/connx.00:00:00-01:00:00.log.gz"} {
+		path := filepath.Join(logDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if e := os.WriteFile(path, nil, 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	rc := lib.RuntimeConfig{LogDir: logDir, StartTime: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), EndTime: time.Date(2021, 6, 2, 23, 0, 0, 0, time.UTC)}
+
+	for pattern, want := range map[string][]string{"conn*": {"conn", "conn-summary"}, "/^(conn|dns)$/": {"conn", "dns"}, "?ns": {"dns"}} {
+		got, e := lib.MatchLogTypes(rc, pattern)
+		if e != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v (%v), want %v", pattern, got, e, want)
+		}
+	}
+	rc.Cluster = true
+	if got, _ := lib.MatchLogTypes(rc, "conn*"); !reflect.DeepEqual(got, []string{"conn", "conn-summary", "conn_long"}) {
+		t.Errorf("expected the logs of workers matched, got %v", got)
+	}
+
+	if _, e := lib.MatchLogTypes(rc, "http*"); !errors.Is(e, lib.ErrNoMatches) {
+		t.Errorf("expected no matches, got %v", e)
+	}
+	for _, pattern := range []string{"[conn", "/conn(/"} {
+		if _, e := lib.MatchLogTypes(rc, pattern); e == nil || errors.Is(e, lib.ErrNoMatches) {
+			t.Errorf("%s: expected the pattern rejected, got %v", pattern, e)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package lib_test
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that an atomic concatenation leaves only the output under its final name, listed once
+// in the manifest.
+func TestConcatFilesAtomic(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.json")
+	os.WriteFile(input, []byte("a.json\n"), 0644)
+	output := filepath.Join(dir, "out.json")
+	manifest := filepath.Join(dir, lib.ManifestFile)
+
+	entry := lib.ManifestEntry{LogType: "conn", Date: "2021/06/01"}
+	if e := lib.ConcatFilesAtomic(log.New(io.Discard, "", 0), []string{input}, output, manifest, entry, true, false); e != nil {
+		t.Fatal(e)
+	}
+	content, _ := os.ReadFile(output)
+	if string(content) != "a.json\n" {
+		t.Errorf("unexpected output: %q", content)
+	}
+	if _, e := os.Stat(lib.PartialName(output)); !os.IsNotExist(e) {
+		t.Errorf("expected the partial output to be gone, got %v", e)
+	}
+	entries, e := lib.ReadManifest(manifest)
+	if e != nil || len(entries) != 1 {
+		t.Fatalf("expected one manifest entry, got %+v (%v)", entries, e)
+	}
+	if entries[0].Path != output || entries[0].Size != 7 || entries[0].LogType != "conn" || entries[0].Date != "2021/06/01" {
+		t.Errorf("unexpected manifest entry: %+v", entries[0])
+	}
+}
+
+// Test that an atomic concatenation cut short after its output was renamed into place is
+// finished by recording it in the manifest, once.
+func TestResumeConcatsRenamed(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.json")
+	os.WriteFile(output, []byte("a.json\n"), 0644)
+	manifest := filepath.Join(dir, lib.ManifestFile)
+	journal := `{"output":"` + lib.PartialName(output) + `","inputs":["` + filepath.Join(dir, "a.json") + `"],"done":1,"offset":7,"final":"` + output + `","manifest":"` + manifest + `","entry":{"path":"` + output + `","log_type":"conn"}}`
+	os.WriteFile(lib.PartialName(output)+lib.ConcatJournalSuffix, []byte(journal), 0644)
+
+	for i := 0; i < 2; i++ {
+		finished, e := lib.ResumeConcats(log.New(io.Discard, "", 0), dir)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if i == 0 && (len(finished) != 1 || finished[0] != output) {
+			t.Errorf("expected %s to be finished, got %v", output, finished)
+		}
+		// cut short again after recording it in the manifest.
+		os.WriteFile(lib.PartialName(output)+lib.ConcatJournalSuffix, []byte(journal), 0644)
+	}
+	entries, _ := lib.ReadManifest(manifest)
+	if len(entries) != 1 || entries[0].Path != output || entries[0].Size != 7 {
+		t.Errorf("expected %s to be listed once, got %+v", output, entries)
+	}
+}
@@ -0,0 +1,52 @@
+package lib_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that json and tsv records are encoded as maps that decode back to their fields.
+func TestMsgpackWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := lib.NewMsgpackWriter(&out)
+	w.Write([]byte("{\"ts\":1.5,\"n\":-3,\"ok\":true,\"tags\":[\"a\",null]}\n#separator \\x09\n#fields\tts\tuid\n"))
+	w.Write([]byte("1.0\tC1\n\nnot a record\n{\"long\":\"" + strings.Repeat("x", 300)))
+	w.Write([]byte("\"}"))
+	w.Close()
+
+	expected := []interface{}{
+		map[string]interface{}{"ts": 1.5, "n": int64(-3), "ok": true, "tags": []interface{}{"a", nil}},
+		map[string]interface{}{"ts": "1.0", "uid": "C1"},
+		"not a record",
+		map[string]interface{}{"long": strings.Repeat("x", 300)},
+	}
+	data := out.Bytes()
+	for i, record := range expected {
+		var value interface{}
+		var e error
+		if value, data, e = lib.DecodeMsgpack(data); e != nil {
+			t.Fatalf("record %d: %s", i, e)
+		}
+		if !reflect.DeepEqual(value, record) {
+			t.Errorf("record %d: expected %#v, got %#v", i, record, value)
+		}
+	}
+	if len(data) != 0 {
+		t.Errorf("unexpected trailing data: %x", data)
+	}
+}
+
+// Test that truncated data is an error, rather than a partial record.
+func TestDecodeMsgpackShort(t *testing.T) {
+	var out bytes.Buffer
+	w := lib.NewMsgpackWriter(&out)
+	w.Write([]byte("{\"uid\":\"C1\"}\n"))
+	w.Close()
+	if _, _, e := lib.DecodeMsgpack(out.Bytes()[:out.Len()-1]); e == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
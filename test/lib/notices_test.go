@@ -0,0 +1,77 @@
+package lib_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// writes a gzipped log of the given type for the first hour of the logs of rc.
+func writeHourLog(t *testing.T, rc lib.RuntimeConfig, logType string, content string) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(content))
+	zw.Close()
+	if e := os.WriteFile(filepath.Join(rc.LogDir, "2021-06-01", logType+".00:00:00-01:00:00.log.gz"), buf.Bytes(), 0644); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// Test that json and tsv records are annotated with the notices of their uid and the intel
+// hits of their uid or of any of their values, and left alone otherwise.
+func TestNoticeWriter(t *testing.T) {
+	rc := sqlLogs(t, "")
+	writeHourLog(t, rc, "notice", `{"ts":1.5,"uid":"C1","note":"Scan::Port_Scan","msg":"<scan>"}
+{"ts":2.5,"note":"SSL::Invalid_Server_Cert"}
+`)
+	writeHourLog(t, rc, "intel", "#fields\tts\tuid\tseen.indicator\tseen.indicator_type\n3.0\tC9\tevil.ru\tIntel::DOMAIN\n4.0\tC1\t10.0.0.9\tIntel::ADDR\n")
+
+	index, e := lib.LoadNotices(rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if index.Notices != 4 {
+		t.Errorf("expected 4 notices, got %d", index.Notices)
+	}
+
+	var out bytes.Buffer
+	w := lib.NewNoticeWriter(&out, index)
+	w.Write([]byte(`{"uid":"C1","query":"a.com"}` + "\n" + `{"uid":"C2","answers":["1.1.1.1","evil.ru"]}` + "\n" + `{"uid":"C3"}` + "\n"))
+	w.Write([]byte("#fields\tuid\tquery\n#types\tstring\tstring\nC3\tevil.ru\nC4\t-"))
+	w.Close()
+	expected := `{"uid":"C1","query":"a.com","related_notices":[{"log":"notice","ts":1.5,"note":"Scan::Port_Scan","msg":"<scan>"},{"log":"intel","ts":"4.0","indicator":"10.0.0.9","indicator_type":"Intel::ADDR"}]}
+{"uid":"C2","answers":["1.1.1.1","evil.ru"],"related_notices":[{"log":"intel","ts":"3.0","indicator":"evil.ru","indicator_type":"Intel::DOMAIN"}]}
+{"uid":"C3"}
+#fields	uid	query	related_notices
+#types	string	string	string
+C3	evil.ru	[{"log":"intel","ts":"3.0","indicator":"evil.ru","indicator_type":"Intel::DOMAIN"}]
+C4	-	-`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+// Test that a pull without notice or intel logs loads an empty index, and that a nil index
+// passes records through.
+func TestNoticeWriterEmpty(t *testing.T) {
+	rc := sqlLogs(t, "")
+	index, e := lib.LoadNotices(rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if index.Notices != 0 {
+		t.Errorf("expected no notices, got %d", index.Notices)
+	}
+
+	var out bytes.Buffer
+	w := lib.NewNoticeWriter(&out, nil)
+	w.Write([]byte(`{"uid":"C1"}` + "\n"))
+	w.Close()
+	if out.String() != `{"uid":"C1"}`+"\n" {
+		t.Errorf("expected the record unchanged, got %q", out.String())
+	}
+}
@@ -0,0 +1,217 @@
+package lib_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// reads a value of the Thrift compact protocol of the given type from data at *i, structs as
+// maps of their fields by id, and lists as slices.
+func readThrift(data []byte, i *int, kind byte) interface{} {
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(data[*i:])
+		*i += n
+		return v
+	}
+	zigzag := func() int64 {
+		v := uvarint()
+		return int64(v>>1) ^ -int64(v&1)
+	}
+	switch kind {
+	case 1, 2:
+		return kind == 1
+	case 5, 6:
+		return zigzag()
+	case 8:
+		size := int(uvarint())
+		*i += size
+		return string(data[*i-size : *i])
+	case 9:
+		header := data[*i]
+		*i++
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(uvarint())
+		}
+		list := make([]interface{}, size)
+		for j := range list {
+			list[j] = readThrift(data, i, elem)
+		}
+		return list
+	case 12:
+		fields := make(map[int16]interface{})
+		var id int16
+		for {
+			header := data[*i]
+			*i++
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(zigzag())
+			}
+			fields[id] = readThrift(data, i, header&0x0f)
+		}
+	}
+	panic("unsupported thrift type")
+}
+
+// reads the records of a Parquet file as written by WriteParquet, with the names and physical
+// types of its columns.
+func readParquet(t *testing.T, path string) (records []map[string]interface{}, names []string, kinds []int64) {
+	data, e := os.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("%s is not a parquet file", path)
+	}
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	i := len(data) - 8 - length
+	meta := readThrift(data, &i, 12).(map[int16]interface{})
+	for _, element := range meta[2].([]interface{})[1:] {
+		schema := element.(map[int16]interface{})
+		names = append(names, schema[4].(string))
+		kinds = append(kinds, schema[1].(int64))
+	}
+	for _, group := range meta[4].([]interface{}) {
+		rows := int(group.(map[int16]interface{})[3].(int64))
+		start := len(records)
+		for r := 0; r < rows; r++ {
+			records = append(records, make(map[string]interface{}))
+		}
+		for c, chunk := range group.(map[int16]interface{})[1].([]interface{}) {
+			columnMeta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			offset := int(columnMeta[9].(int64))
+			header := readThrift(data, &offset, 12).(map[int16]interface{})
+			size := int(header[3].(int64))
+			zr, e := gzip.NewReader(bytes.NewReader(data[offset : offset+size]))
+			if e != nil {
+				t.Fatal(e)
+			}
+			page, _ := io.ReadAll(zr)
+
+			// definition levels, as RLE runs, then the values set.
+			levelsEnd := 4 + int(binary.LittleEndian.Uint32(page))
+			var defined []bool
+			for p := 4; p < levelsEnd; {
+				run, n := binary.Uvarint(page[p:])
+				for j := uint64(0); j < run>>1; j++ {
+					defined = append(defined, page[p+n] == 1)
+				}
+				p += n + 1
+			}
+			values, set := page[levelsEnd:], 0
+			for r, isSet := range defined {
+				if !isSet {
+					continue
+				}
+				var value interface{}
+				switch kinds[c] {
+				case 0:
+					value = values[set/8]&(1<<uint(set%8)) != 0
+				case 2:
+					value = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case 5:
+					value = math.Float64frombits(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case 6:
+					size := binary.LittleEndian.Uint32(values)
+					value = string(values[4 : 4+size])
+					values = values[4+size:]
+				}
+				records[start+r][names[c]] = value
+				set++
+			}
+		}
+	}
+	return records, names, kinds
+}
+
+// Test that the records of an output are written to its Parquet file, with columns typed by
+// their values.
+func TestWriteParquet(t *testing.T) {
+	outDir := t.TempDir()
+	src := filepath.Join(outDir, "conn-2021-06-01.json")
+	os.WriteFile(src, []byte(`{"ts":1622505600.5,"id.orig_h":"10.0.0.5","orig_bytes":10,"local_orig":true,"tunnel_parents":["a"]}`+"\n"+
+		`{"ts":1622505601,"id.orig_h":"10.0.0.6","orig_bytes":null,"local_orig":false,"service":"dns"}`+"\n"), 0644)
+	dst := lib.ParquetPartition(outDir, "conn", time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	if want := filepath.Join(outDir, "log_type=conn", "date=2021-06-01", "conn-2021-06-01.parquet"); dst != want {
+		t.Fatalf("expected partition %s, got %s", want, dst)
+	}
+
+	written, e := lib.WriteParquet(src, dst)
+	if e != nil || !written {
+		t.Fatalf("expected the parquet file to be written, got %v (%v)", written, e)
+	}
+	if _, e = os.Stat(src); !os.IsNotExist(e) {
+		t.Errorf("expected %s to be removed", src)
+	}
+	records, names, kinds := readParquet(t, dst)
+	if want := []string{"ts", "id.orig_h", "orig_bytes", "local_orig", "tunnel_parents", "service"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected columns %v, got %v", want, names)
+	}
+	if want := []int64{5, 6, 2, 0, 6, 6}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("expected column types %v, got %v", want, kinds)
+	}
+	want := []map[string]interface{}{
+		{"ts": 1622505600.5, "id.orig_h": "10.0.0.5", "orig_bytes": int64(10), "local_orig": true, "tunnel_parents": `["a"]`},
+		{"ts": 1622505601.0, "id.orig_h": "10.0.0.6", "local_orig": false, "service": "dns"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("expected records %v, got %v", want, records)
+	}
+}
+
+// Test that TSV records are typed by the #types header, and unset fields are null.
+func TestWriteParquetTSV(t *testing.T) {
+	outDir := t.TempDir()
+	src := filepath.Join(outDir, "dns-2021-06-01.json")
+	os.WriteFile(src, []byte("#fields\tts\tquery\tqtype\tAA\n#types\ttime\tstring\tcount\tbool\n"+
+		"1622505600.000000\texample.com\t1\tT\n1622505601.000000\t-\t28\tF\n"), 0644)
+	dst := filepath.Join(outDir, "dns.parquet")
+
+	if _, e := lib.WriteParquet(src, dst); e != nil {
+		t.Fatal(e)
+	}
+	records, _, kinds := readParquet(t, dst)
+	if want := []int64{5, 6, 2, 0}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("expected column types %v, got %v", want, kinds)
+	}
+	want := []map[string]interface{}{
+		{"ts": 1622505600.0, "query": "example.com", "qtype": int64(1), "AA": true},
+		{"ts": 1622505601.0, "qtype": int64(28), "AA": false},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("expected records %v, got %v", want, records)
+	}
+}
+
+// Test that an output without records is removed without writing a Parquet file.
+func TestWriteParquetEmpty(t *testing.T) {
+	outDir := t.TempDir()
+	src := filepath.Join(outDir, "conn-2021-06-01.json")
+	os.WriteFile(src, nil, 0644)
+	dst := filepath.Join(outDir, "conn.parquet")
+
+	written, e := lib.WriteParquet(src, dst)
+	if e != nil || written {
+		t.Fatalf("expected nothing to be written, got %v (%v)", written, e)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 0 {
+		t.Errorf("expected no files to be left, got %v", entries)
+	}
+}
@@ -0,0 +1,117 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// records of each log the benchmarks read.
+const benchRecords = 1000
+
+// returns benchRecords dns records as JSON lines.
+func benchLog() string {
+	var records strings.Builder
+	for i := 0; i < benchRecords; i++ {
+		fmt.Fprintf(&records, `{"ts":1622505600.%d,"uid":"C%d","id.orig_h":"10.0.0.%d","id.resp_h":"10.0.1.1","query":"host%d.example.com","qtype_name":"A"}`+"\n", i, i, i%10, i%50)
+	}
+	return records.String()
+}
+
+// runs run b.N times, and fails if it allocated more than budget times per record of a log on
+// average. The pooled buffers make most of the cost of a log up front, so the budgets hold
+// for the records of a log rather than for the log.
+func benchAllocs(b *testing.B, budget float64, run func()) {
+	b.ReportAllocs()
+	run()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		run()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	if allocs := float64(after.Mallocs-before.Mallocs) / float64(b.N) / benchRecords; allocs > budget {
+		b.Errorf("expected at most %v allocations per record, got %.2f", budget, allocs)
+	}
+}
+
+// Benchmark concatenating a log, which copies its lines through pooled buffers.
+func BenchmarkConcatFiles(b *testing.B) {
+	dir := b.TempDir()
+	input := filepath.Join(dir, "dns-00:00.json")
+	os.WriteFile(input, []byte(benchLog()), 0644)
+	logger := log.New(io.Discard, "", 0)
+	benchAllocs(b, 0.05, func() {
+		if e := lib.ConcatFiles(logger, []string{input}, filepath.Join(dir, "dns.json"), false, false); e != nil {
+			b.Fatal(e)
+		}
+	})
+}
+
+// Benchmark running a jq expression over a log.
+func BenchmarkJQFilter(b *testing.B) {
+	f, e := lib.NewJQFilter(`select(.qtype_name == "A") | .query`)
+	if e != nil {
+		b.Fatal(e)
+	}
+	input := benchLog()
+	benchAllocs(b, 60, func() {
+		if e := f.Filter(context.Background(), strings.NewReader(input), io.Discard); e != nil {
+			b.Fatal(e)
+		}
+	})
+}
+
+// Benchmark running a grouped query over a log.
+func BenchmarkRunSQL(b *testing.B) {
+	rc := sqlLogs(b, benchLog())
+	q, e := lib.ParseSQL(`SELECT query, count(*) FROM dns WHERE qtype_name = 'A' GROUP BY query`)
+	if e != nil {
+		b.Fatal(e)
+	}
+	benchAllocs(b, 40, func() {
+		if _, e := lib.RunSQL(q, rc); e != nil {
+			b.Fatal(e)
+		}
+	})
+}
+
+// Benchmark counting the unique values of a log, which allocates nothing for values seen
+// before.
+func BenchmarkUniqueValues(b *testing.B) {
+	unique := lib.NewUniqueValues([]string{"id.orig_h", "query"})
+	w := unique.Writer("a")
+	input := []byte(benchLog())
+	benchAllocs(b, 0.05, func() {
+		w.Write(input)
+	})
+	w.Close()
+}
+
+// Test that concatenated lines longer than the pooled buffers are written whole, and that
+// carriage returns are dropped and a last line without a newline is ended.
+func TestConcatFilesLongLines(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 200*1024)
+	input := filepath.Join(dir, "dns-00:00.json")
+	os.WriteFile(input, []byte("a\r\n"+long+"\nb"), 0644)
+	output := filepath.Join(dir, "dns.json")
+	if e := lib.ConcatFiles(log.New(io.Discard, "", 0), []string{input}, output, false, false); e != nil {
+		t.Fatal(e)
+	}
+	content, _ := os.ReadFile(output)
+	if !bytes.Equal(content, []byte("a\n"+long+"\nb\n")) {
+		t.Errorf("unexpected output of %d bytes, starting %q", len(content), content[:10])
+	}
+}
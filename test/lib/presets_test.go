@@ -0,0 +1,42 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that every preset is a valid playbook once its variables are filled in, with jq
+// expressions that compile.
+func TestPresets(t *testing.T) {
+	presets := lib.ListPresets()
+	if len(presets) == 0 {
+		t.Fatal("expected built-in presets")
+	}
+	vars := map[string]string{"host": "10.1.2.3"}
+	for _, preset := range presets {
+		if preset.Description == "" {
+			t.Errorf("%s: no description", preset.Name)
+		}
+		playbook, e := lib.ParsePreset(preset.Name, vars, true)
+		if e != nil {
+			t.Errorf("%s: %v", preset.Name, e)
+			continue
+		}
+		if len(playbook.DataSources) == 0 {
+			t.Errorf("%s: no data sources", preset.Name)
+		}
+		for _, source := range playbook.DataSources {
+			if _, e = lib.NewJQFilter(source.JQ); e != nil {
+				t.Errorf("%s/%s: %v", preset.Name, source.Name, e)
+			}
+		}
+	}
+
+	if _, e := lib.ParsePreset("lateral-movement", map[string]string{}, false); e == nil {
+		t.Error("expected a missing variable to be an error")
+	}
+	if _, e := lib.ParsePreset("missing", vars, false); e == nil {
+		t.Error("expected an unknown preset to be an error")
+	}
+}
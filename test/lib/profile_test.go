@@ -0,0 +1,44 @@
+package lib_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that null rates, distinct counts and top values are counted over json and tsv logs.
+func TestProfileLogs(t *testing.T) {
+	rc := sqlLogs(t,
+		`{"query":"a.ru","rcode":0}
+{"query":"a.ru"}
+{"query":"b.com","rcode":3}
+`,
+		"#separator \\x09\n#fields\tquery\trcode\nc.org\t0\n",
+		`{"query":"d.net"}`+"\n")
+
+	profile, e := lib.ProfileLogs(rc, 0, 0, 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if profile.Logs != 3 || len(profile.Sampled) != 3 || profile.Records != 5 || len(profile.Fields) != 2 {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+	query, rcode := profile.Fields[0], profile.Fields[1]
+	if query.Name != "query" || query.Nulls != 0 || query.Distinct != 4 || !reflect.DeepEqual(query.Top, []lib.ValueCount{{Value: "a.ru", Count: 2}}) {
+		t.Errorf("unexpected query profile %+v", query)
+	}
+	if rcode.Name != "rcode" || rcode.Nulls != 2 || rcode.Distinct != 2 || profile.NullRate(rcode) != 0.4 {
+		t.Errorf("unexpected rcode profile %+v", rcode)
+	}
+
+	// the sample is spread from the first log to the last, reading only some of each.
+	profile, e = lib.ProfileLogs(rc, 2, 1, 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(profile.Sampled) != 2 || !strings.HasSuffix(profile.Sampled[1], "dns.02:00:00-03:00:00.log.gz") || profile.Records != 2 {
+		t.Errorf("unexpected sample %v of %d record(s)", profile.Sampled, profile.Records)
+	}
+}
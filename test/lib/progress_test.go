@@ -0,0 +1,39 @@
+package lib_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cheggaaa/pb"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a log over the threshold shows how much of it has been read after the bar, and
+// stops once closed, and that smaller logs are not shown.
+func TestProgressReader(t *testing.T) {
+	bar := pb.New(1)
+	bar.NotPrint = true
+	bar.SetWidth(200)
+	data := strings.Repeat("x", 100)
+
+	small := lib.NewProgressReader(strings.NewReader(data), bar, "/logs/dns.00:00:00-01:00:00.log.gz", 100, 200)
+	large := lib.NewProgressReader(strings.NewReader(data), bar, "/logs/conn.00:00:00-01:00:00.log.gz", 100, 50)
+	small.Read(make([]byte, 10))
+	large.Read(make([]byte, 40))
+	bar.Update()
+	if line := bar.String(); !strings.Contains(line, "conn.00:00:00-01:00:00.log.gz 40%") || strings.Contains(line, "dns") {
+		t.Errorf("unexpected bar %q", line)
+	}
+
+	if rest, e := ioutil.ReadAll(large); e != nil || len(rest) != 60 {
+		t.Fatalf("unexpected read of %d bytes: %v", len(rest), e)
+	}
+	large.Close()
+	small.Close()
+	bar.Update()
+	if line := bar.String(); strings.Contains(line, "conn") {
+		t.Errorf("log still shown once closed: %q", line)
+	}
+}
@@ -0,0 +1,92 @@
+package lib_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that output ages are parsed in days, weeks and Go durations, and must be positive. An
+// age too long to hold is rejected rather than wrapping around into a short one.
+func TestParseAge(t *testing.T) {
+	for age, expected := range map[string]time.Duration{"30d": 30 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "72h": 72 * time.Hour} {
+		if parsed, e := lib.ParseAge(age); e != nil || parsed != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", age, expected, parsed, e)
+		}
+	}
+	for _, age := range []string{"", "0d", "-1d", "soon", "15250284453w"} {
+		if _, e := lib.ParseAge(age); e == nil {
+			t.Errorf("expected %q to be rejected", age)
+		}
+	}
+}
+
+// Test that an output is expired by the newest file in it, that expired outputs are listed
+// oldest first, that an output under a case directory is removed without the rest of the case,
+// and that files, symlinks, directories without the marker, such as one holding a report the
+// user wrote, and outputs a run holds the lock of are left alone.
+func TestExpiredOutputs(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	touch := func(path string, age time.Duration) {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("record\n"), 0644)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	day := 24 * time.Hour
+	touch(filepath.Join(root, "a", "conn.log"), 40*day)
+	touch(filepath.Join(root, "b", "conn.log"), 50*day)
+	touch(filepath.Join(root, "c", "conn.log"), 40*day)
+	touch(filepath.Join(root, "c", "dns.log"), time.Hour)
+	touch(filepath.Join(root, "d", "conn.log"), 40*day)
+	touch(filepath.Join(root, "e", "conn.log"), 45*day)
+	touch(filepath.Join(root, "e", "report.md"), 45*day)
+	touch(filepath.Join(root, "e", lib.ManifestFile), 45*day)
+	touch(filepath.Join(root, "f", "all", "conn.log"), 40*day)
+	touch(filepath.Join(root, "g", "notes.txt"), 90*day)
+	touch(filepath.Join(root, "g", "pull", "conn.log"), 45*day)
+	touch(filepath.Join(root, "notes.txt"), 90*day)
+	for _, output := range []string{"a", "b", "c", "f/all", "g/pull"} {
+		marker := filepath.Join(root, output, lib.OutputMarker)
+		os.WriteFile(marker, nil, 0644)
+		os.Chtimes(marker, now.Add(-60*day), now.Add(-60*day))
+	}
+	for _, dir := range []string{"a", "b", "c", "d", "e", "f/all", "f", "g/pull", "g"} {
+		os.Chtimes(filepath.Join(root, dir), now.Add(-60*day), now.Add(-60*day))
+	}
+	os.Symlink(filepath.Join(root, "b"), filepath.Join(root, "link"))
+	lock, e := lib.LockDir(filepath.Join(root, "f", "all"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer lock.Unlock()
+
+	expired, e := lib.ExpiredOutputs(root, 30*day, now)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(expired) != 3 || expired[0].Path != filepath.Join(root, "b") || expired[1].Path != filepath.Join(root, "g", "pull") || expired[2].Path != filepath.Join(root, "a") {
+		t.Fatalf("expected b, g/pull then a, got %+v", expired)
+	}
+	if expired[0].Size != int64(len("record\n")) {
+		t.Errorf("unexpected size %d", expired[0].Size)
+	}
+	// a run started since the outputs were listed keeps its output from being removed.
+	started, e := lib.LockDir(filepath.Join(root, "a"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := lib.PruneOutputs(expired); !errors.Is(e, lib.ErrOutputLocked) {
+		t.Errorf("expected the output being written to be refused, got %v", e)
+	}
+	started.Unlock()
+	for name, kept := range map[string]bool{"a": true, "b": false, "c": true, "d": true, "e/report.md": true, "f/all": true, "g/notes.txt": true, "g/pull": false, "notes.txt": true, "link": true} {
+		if _, e := os.Lstat(filepath.Join(root, name)); (e == nil) != kept {
+			t.Errorf("%s: expected kept %v, got %v", name, kept, e)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package lib_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// a stand-in for the sftp client, serving the local filesystem. It runs the ls and get
+// commands given in batch mode, echoing each command like sftp does.
+const fakeSFTP = `#!/bin/sh
+while IFS= read -r line; do
+	echo "sftp> $line"
+	eval "set -- $line"
+	case "$1" in
+	-ls) for f in $3; do [ -e "$f" ] && echo "$f"; done ;;
+	get) cp -p "$3" "$4" || exit 1 ;;
+	esac
+done
+`
+
+// puts the fake sftp client first in PATH for the rest of the test.
+func useFakeSFTP(t *testing.T) {
+	bin := t.TempDir()
+	if e := os.WriteFile(filepath.Join(bin, "sftp"), []byte(fakeSFTP), 0755); e != nil {
+		t.Fatal(e)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+}
+
+// writes conn logs of a few hours, and a dns log, into a date directory of a new archive.
+func writeRemoteLogs(t *testing.T) (archiveDir string) {
+	archiveDir = t.TempDir()
+	os.MkdirAll(filepath.Join(archiveDir, "2021-06-01"), 0755)
+	for _, name := range []string{"conn.00:00:00-01:00:00.log.gz", "conn.01:00:00-02:00:00.log.gz", "conn.05:00:00-06:00:00.log.gz", "dns.00:00:00-01:00:00.log.gz"} {
+		os.WriteFile(filepath.Join(archiveDir, "2021-06-01", name), []byte(name), 0644)
+	}
+	return archiveDir
+}
+
+// Test that remote log directories are parsed, and that anything else is rejected.
+func TestParseRemoteArchive(t *testing.T) {
+	r, e := lib.ParseRemoteArchive("sftp://analyst@archive-host:2222/data/zeek/logs/")
+	if e != nil || r.User != "analyst" || r.Host != "archive-host" || r.Port != 2222 || r.Path != "/data/zeek/logs" {
+		t.Errorf("unexpected archive %+v (%v)", r, e)
+	}
+	if r.String() != "sftp://analyst@archive-host:2222/data/zeek/logs" {
+		t.Errorf("unexpected name %s", r)
+	}
+	if r, e = lib.ParseRemoteArchive("https://cold-storage/zeek"); e != nil || r.Scheme != "https" || r.Path != "/zeek" {
+		t.Errorf("unexpected archive %+v (%v)", r, e)
+	}
+	for _, logDir := range []string{"sftp:///data/zeek/logs", "sftp://host", "ftp://host/data", "https://analyst@cold-storage/zeek"} {
+		if _, e := lib.ParseRemoteArchive(logDir); e == nil {
+			t.Errorf("%s: expected an error", logDir)
+		}
+	}
+}
+
+// Test that only the logs of the pull are fetched, only once, and that the logs used least
+// recently are removed once the cache is full.
+func TestFetchRemoteLogs(t *testing.T) {
+	useFakeSFTP(t)
+	remoteDir := writeRemoteLogs(t)
+	remote, e := lib.ParseRemoteArchive("sftp://analyst@archive-host" + filepath.ToSlash(remoteDir))
+	if e != nil {
+		t.Fatal(e)
+	}
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	rc := lib.RuntimeConfig{LogType: "conn", StartTime: start, EndTime: start.Add(time.Hour)}
+	cache := lib.LogCache{Dir: t.TempDir(), MaxBytes: 1 << 20}
+
+	var out bytes.Buffer
+	localDir, e := lib.FetchRemoteLogs(rc, remote, cache, &out)
+	if e != nil {
+		t.Fatal(e)
+	}
+	matches, _ := filepath.Glob(filepath.Join(localDir, "2021-06-01", "*"))
+	if len(matches) != 2 || filepath.Base(matches[1]) != "conn.01:00:00-02:00:00.log.gz" || !strings.Contains(out.String(), "Fetching 2 log(s)") {
+		t.Errorf("unexpected logs fetched %v: %s", matches, out.String())
+	}
+
+	out.Reset()
+	if _, e = lib.FetchRemoteLogs(rc, remote, cache, &out); e != nil || !strings.Contains(out.String(), "Fetching 0 log(s)") || !strings.Contains(out.String(), "2 already cached") {
+		t.Errorf("expected the logs to be cached, got %q (%v)", out.String(), e)
+	}
+
+	// a full cache keeps the logs of the pull, and removes the others.
+	cache.MaxBytes = 1
+	rc.StartTime, rc.EndTime = start.Add(5*time.Hour), start.Add(5*time.Hour)
+	if _, e = lib.FetchRemoteLogs(rc, remote, cache, &out); e != nil {
+		t.Fatal(e)
+	}
+	matches, _ = filepath.Glob(filepath.Join(localDir, "2021-06-01", "*"))
+	if len(matches) != 1 || filepath.Base(matches[0]) != "conn.05:00:00-06:00:00.log.gz" {
+		t.Errorf("unexpected logs left in the cache %v", matches)
+	}
+}
+
+// Test that logs of an HTTP archive are listed from its directory listings, or from its index
+// manifest when it has one, and that an interrupted download is resumed with a ranged request.
+func TestFetchRemoteLogsHTTP(t *testing.T) {
+	archiveDir := writeRemoteLogs(t)
+	var ranges []string
+	files := http.FileServer(http.Dir(archiveDir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r := req.Header.Get("Range"); r != "" {
+			ranges = append(ranges, req.URL.Path+" "+r)
+		}
+		files.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+	remote, e := lib.ParseRemoteArchive(server.URL + "/")
+	if e != nil {
+		t.Fatal(e)
+	}
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	rc := lib.RuntimeConfig{LogType: "conn", StartTime: start, EndTime: start.Add(time.Hour)}
+	cache := lib.LogCache{Dir: t.TempDir(), MaxBytes: 1 << 20}
+
+	// half of a log was downloaded before being interrupted.
+	localDir := filepath.Join(cache.Dir, "http", remote.Host+"_"+strconv.Itoa(remote.Port))
+	part := filepath.Join(localDir, "2021-06-01", "conn.01:00:00-02:00:00.log.gz.part")
+	os.MkdirAll(filepath.Dir(part), 0755)
+	os.WriteFile(part, []byte("conn.01:00"), 0644)
+
+	var out bytes.Buffer
+	if _, e = lib.FetchRemoteLogs(rc, remote, cache, &out); e != nil {
+		t.Fatal(e)
+	}
+	matches, _ := filepath.Glob(filepath.Join(localDir, "2021-06-01", "*"))
+	if len(matches) != 2 || !strings.Contains(out.String(), "Fetching 2 log(s)") {
+		t.Fatalf("unexpected logs fetched %v: %s", matches, out.String())
+	}
+	content, _ := os.ReadFile(matches[1])
+	if string(content) != "conn.01:00:00-02:00:00.log.gz" || len(ranges) != 1 || ranges[0] != "/2021-06-01/conn.01:00:00-02:00:00.log.gz bytes=10-" {
+		t.Errorf("expected the download to be resumed, got %q after %v", content, ranges)
+	}
+
+	// an index manifest is used instead of the listing, even if it leaves logs out.
+	os.WriteFile(filepath.Join(archiveDir, "index.txt"), []byte("# conn logs\n2021-06-01/conn.05:00:00-06:00:00.log.gz\n"), 0644)
+	rc.EndTime = start.Add(5 * time.Hour)
+	out.Reset()
+	if _, e = lib.FetchRemoteLogs(rc, remote, cache, &out); e != nil || !strings.Contains(out.String(), "Fetching 1 log(s)") || !strings.Contains(out.String(), "0 already cached") {
+		t.Errorf("expected only the log of the manifest, got %q (%v)", out.String(), e)
+	}
+}
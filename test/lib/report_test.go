@@ -0,0 +1,81 @@
+package lib_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the run report lists the tasks that used the most CPU time first, up to ten.
+func TestRunReportTopUsage(t *testing.T) {
+	var report lib.RunReport
+	for i := 1; i <= 12; i++ {
+		report.AddUsage(lib.TaskUsage{
+			LogFile:    fmt.Sprintf("conn.%02d.log.gz", i),
+			UserTime:   time.Duration(i) * time.Second,
+			SystemTime: time.Second,
+			MaxRSS:     int64(i) << 20,
+		})
+	}
+
+	top := report.TopUsage(10)
+	if len(top) != 10 || top[0].LogFile != "conn.12.log.gz" || top[9].LogFile != "conn.03.log.gz" {
+		t.Errorf("unexpected top usage: %v", top)
+	}
+
+	var out bytes.Buffer
+	report.Write(&out)
+	if !strings.Contains(out.String(), "12 task(s)") || !strings.Contains(out.String(), "12.0 MiB") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "conn.02.log.gz") {
+		t.Errorf("report lists more than ten files:\n%s", out.String())
+	}
+}
+
+// Test that tasks run again after running out of resources are summed across reports, with
+// the lowest number of tasks let run at once.
+func TestRunReportExhausted(t *testing.T) {
+	var first, second lib.RunReport
+	first.AddExhausted(4)
+	second.AddExhausted(2)
+	second.AddExhausted(4)
+	first.Merge(&second)
+	if first.Exhausted != 3 || first.Concurrency != 2 {
+		t.Errorf("unexpected exhaustion %d at %d", first.Exhausted, first.Concurrency)
+	}
+
+	var out bytes.Buffer
+	first.Write(&out)
+	if !strings.Contains(out.String(), "3 task(s) run again, with at most 2 running at once") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+// Test that sizes are parsed in powers of 1024, with or without a unit, in either case.
+func TestParseByteSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"500G":   500 << 30,
+		"500gib": 500 << 30,
+		"1.5T":   3 << 39,
+		"800MB":  800 << 20,
+		"4096":   4096,
+		"12B":    12,
+	} {
+		if parsed, e := lib.ParseByteSize(size); e != nil || parsed != expected {
+			t.Errorf("%s: expected %d, got %d (%v)", size, expected, parsed, e)
+		}
+	}
+	for _, size := range []string{"", "G", "-1G", "500X", "10000E"} {
+		if _, e := lib.ParseByteSize(size); e == nil {
+			t.Errorf("expected %q to be refused", size)
+		}
+	}
+	if formatted := lib.FormatBytes(500 << 30); formatted != "500.0 GiB" {
+		t.Errorf("unexpected %s", formatted)
+	}
+}
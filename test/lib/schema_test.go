@@ -0,0 +1,62 @@
+package lib_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the schema of a TSV log is read from its headers, and that JSON logs have none.
+func TestReadSchema(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(content))
+		zw.Close()
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, buf.Bytes(), 0644)
+		return path
+	}
+
+	schema, e := lib.ReadSchema(write("conn.log.gz", "#separator \\x09\n#fields\tts\tuid\n#types\ttime\tstring\n1.0\tC1\n"))
+	if e != nil || len(schema.Fields) != 2 || schema.Fields[1] != "uid" || schema.Types[0] != "time" {
+		t.Errorf("unexpected schema %+v (%v)", schema, e)
+	}
+	if schema, e = lib.ReadSchema(write("json.log.gz", "{\"ts\":1.0}\n")); e != nil || !schema.Empty() {
+		t.Errorf("expected an empty schema for json, got %+v (%v)", schema, e)
+	}
+}
+
+// Test that records are rewritten to the union schema, leaving missing fields unset.
+func TestSchemaWriter(t *testing.T) {
+	old := lib.Schema{Fields: []string{"ts", "uid"}, Types: []string{"time", "string"}}
+	upgraded := lib.Schema{Fields: []string{"ts", "proto", "uid"}, Types: []string{"time", "enum", "string"}}
+	union := lib.UnionSchema([]lib.Schema{old, upgraded})
+	if len(union.Fields) != 3 || union.Fields[2] != "proto" || union.Types[2] != "enum" {
+		t.Fatalf("unexpected union %+v", union)
+	}
+
+	var out bytes.Buffer
+	w := lib.NewSchemaWriter(&out, old, union)
+	w.Write([]byte("#fields\tts\tuid\n#types\ttime\tstring\n1.0\tC1\nodd\n2.0\tC2"))
+	w.Close()
+	expected := "#fields\tts\tuid\tproto\n#types\ttime\tstring\tenum\n1.0\tC1\t-\nodd\n2.0\tC2\t-"
+	if out.String() != expected {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	var report lib.RunReport
+	report.AddSchema("/logs/2021-06-01/conn.00:00:00-01:00:00.log.gz", old)
+	report.AddSchema("/logs/2021-06-01/dns.00:00:00-01:00:00.log.gz", lib.Schema{Fields: []string{"query"}})
+	report.AddSchema("/logs/2021-06-02/conn.00:00:00-01:00:00.log.gz", upgraded)
+	report.AddSchema("/logs/2021-06-02/dns.00:00:00-01:00:00.log.gz", lib.Schema{Fields: []string{"query"}})
+	changes := report.SchemaChanges()
+	if len(changes) != 1 || changes[0].Added[0] != "proto" || len(changes[0].Removed) != 0 {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+}
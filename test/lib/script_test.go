@@ -0,0 +1,57 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// writes an executable script to a temp dir, returning its path.
+func writeScript(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "filter.sh")
+	if e := os.WriteFile(path, []byte(script), 0755); e != nil {
+		t.Fatal(e)
+	}
+	return path
+}
+
+// Test that a missing interpreter, or a missing command of a requires line of the comments at
+// the top of a script, are found, and nothing else is.
+func TestCheckScript(t *testing.T) {
+	for script, expected := range map[string][]string{
+		"#!/bin/sh\n# requires: sh, cat\ngrep x\n":                      nil,
+		"#!/usr/bin/env sh\n":                                           nil,
+		"#!/usr/bin/env -S nagini-no-such-shell -e\n":                   {"nagini-no-such-shell"},
+		"#!/nagini/no/such/shell\n":                                     {"/nagini/no/such/shell"},
+		"#!/bin/sh\n\n# a filter\n#requires: cat,nagini-no-such-tool\n": {"nagini-no-such-tool"},
+		"#!/bin/sh\ngrep x\n# requires: nagini-no-such-tool\n":          nil,
+		"grep x\n# requires: nagini-no-such-tool\n":                     nil,
+		"#!/nagini/no/such/shell\n# requires: nagini-a, nagini-b\n":     {"/nagini/no/such/shell", "nagini-a", "nagini-b"},
+	} {
+		problems := lib.CheckScript(writeScript(t, script))
+		if len(problems) != len(expected) {
+			t.Errorf("%q: unexpected problems %v", script, problems)
+			continue
+		}
+		for i, problem := range problems {
+			if !strings.Contains(problem.Error(), "'"+expected[i]+"'") {
+				t.Errorf("%q: expected a problem with %s, got %v", script, expected[i], problem)
+			}
+		}
+	}
+}
+
+// Test that a script passes its self-test if it exits 0 when run with --self-test, and
+// otherwise fails it with the last line it wrote.
+func TestSelfTestScript(t *testing.T) {
+	if e := lib.SelfTestScript(writeScript(t, "#!/bin/sh\n[ \"$1\" = --self-test ] && exit 0\nexit 1\n")); e != nil {
+		t.Error(e)
+	}
+	e := lib.SelfTestScript(writeScript(t, "#!/bin/sh\necho checking\necho intel feed is empty >&2\nexit 1\n"))
+	if e == nil || !strings.Contains(e.Error(), "intel feed is empty") {
+		t.Errorf("expected the self-test to fail with what the script wrote, got %v", e)
+	}
+}
@@ -0,0 +1,53 @@
+package lib_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the sensor of a log comes from the config, then the cluster worker, then the
+// log directory.
+func TestSensorOf(t *testing.T) {
+	sensors := []lib.SensorConfig{
+		{Name: "all", Path: "/data"},
+		{Name: "east", Site: "osu-east", Path: "/data/east/"},
+	}
+	for logFile, expected := range map[string]lib.SensorConfig{
+		"/data/east/logs/2021-06-01/conn.00:00:00-01:00:00.log.gz":      sensors[1],
+		"/data/west/logs/2021-06-01/conn.00:00:00-01:00:00.log.gz":      sensors[0],
+		"/nsm/west/logs/2021-06-01/conn.00:00:00-01:00:00.log.gz":       {Name: "west"},
+		"/nsm/zeek/2021-06-01/conn.00:00:00-01:00:00.log.gz":            {Name: "zeek"},
+		"/nsm/zeek/2021-06-01/worker-01.conn.00:00:00-01:00:00.log.gz":  {Name: "worker-01"},
+		"/nsm/zeek/2021-06-01/worker-02/conn.00:00:00-01:00:00.log.gz":  {Name: "worker-02"},
+		"/nsm/zeek/2021-06-01/conn_summary.00:00:00-01:00:00.log.gz":    {Name: "zeek"},
+		"/nsm/zeek/2021-06-01/worker-03.conn.00:00:00-01:00:00.log.zst": {Name: "worker-03"},
+	} {
+		if sensor := lib.SensorOf(logFile, sensors); sensor != expected {
+			t.Errorf("%s: expected %+v, got %+v", logFile, expected, sensor)
+		}
+	}
+}
+
+// Test that json and tsv records are tagged, including a last record without a newline.
+func TestSensorWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := lib.NewSensorWriter(&out, lib.SensorConfig{Name: "east", Site: "osu"})
+	w.Write([]byte("{\"a\":1}\n{}\n#separator \\x09\n#fields\tts\n#types\ttime\n"))
+	w.Write([]byte("1.0\n\n{\"b\":"))
+	w.Write([]byte("2}"))
+	w.Close()
+
+	expected := `{"a":1,"sensor":"east","site":"osu"}
+{"sensor":"east","site":"osu"}
+#separator \x09
+#fields	ts	sensor	site
+#types	time	string	string
+1.0	east	osu
+
+{"b":2,"sensor":"east","site":"osu"}`
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
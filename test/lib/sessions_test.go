@@ -0,0 +1,56 @@
+package lib_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// bufferCloser is a buffer that records that it was closed.
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+// Test that the conn and app-layer records of a connection are grouped by uid, in order of
+// their earliest record, over both json and tsv logs.
+func TestReassembleSessions(t *testing.T) {
+	rc := sqlLogs(t, `{"ts":5.5,"uid":"C2","query":"a.ru"}
+{"ts":2.5,"uid":"C1","query":"<b>.com"}
+{"ts":2.6,"uid":"C1","query":"c.org"}
+{"ts":9,"query":"no-uid.net"}
+`)
+	var conn bytes.Buffer
+	zw := gzip.NewWriter(&conn)
+	zw.Write([]byte("#fields\tts\tuid\tproto\n2.0\tC1\ttcp\n5.0\tC2\t-\n7.0\tC3\tudp\n"))
+	zw.Close()
+	os.WriteFile(filepath.Join(rc.LogDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"), conn.Bytes(), 0644)
+
+	var out bufferCloser
+	var days []time.Time
+	written, e := lib.ReassembleSessions(rc, []string{"conn", "dns"}, func(day time.Time) (io.WriteCloser, error) {
+		days = append(days, day)
+		return &out, nil
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := `{"uid":"C1","conn":[{"proto":"tcp","ts":"2.0","uid":"C1"}],"dns":[{"query":"<b>.com","ts":2.5,"uid":"C1"},{"query":"c.org","ts":2.6,"uid":"C1"}]}
+{"uid":"C2","conn":[{"proto":null,"ts":"5.0","uid":"C2"}],"dns":[{"query":"a.ru","ts":5.5,"uid":"C2"}]}
+{"uid":"C3","conn":[{"proto":"udp","ts":"7.0","uid":"C3"}]}
+`
+	if written != 3 || out.String() != expected || !out.closed || len(days) != 1 || days[0].Day() != 1 {
+		t.Errorf("unexpected sessions (%d, days %v):\n%s", written, days, out.String())
+	}
+}
@@ -0,0 +1,35 @@
+package lib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a Vector config reads every output under its directory and forwards it to the sink.
+func TestRenderShipperConfigVector(t *testing.T) {
+	var out bytes.Buffer
+	config := lib.ShipperConfig{Shipper: lib.ShipperVector, Dir: "/hunts", Sink: lib.SinkElasticsearch, Endpoint: "http://es:9200", Target: "nagini"}
+	if e := lib.RenderShipperConfig(&out, config); e != nil {
+		t.Fatal(e)
+	}
+	for _, expected := range []string{`include = ["/hunts/**/*.json"]`, `exclude = ["/hunts/**/*.meta.json"]`, `type = "elasticsearch"`, `endpoints = ["http://es:9200"]`, `bulk.index = "nagini"`, "parse_json!"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %s in the config:\n%s", expected, out.String())
+		}
+	}
+}
+
+// Test that the outputs of a log type are matched by date and as a single file, but not the
+// partial names of outputs still being written, nor the outputs of other log types.
+func TestShipperConfigInclude(t *testing.T) {
+	include := lib.ShipperConfig{Dir: "/hunts", LogType: "dns"}.Include()
+	if len(include) != 2 || include[0] != "/hunts/**/dns-*.json" || include[1] != "/hunts/**/dns.json" {
+		t.Errorf("unexpected globs: %v", include)
+	}
+	if !strings.HasSuffix(lib.PartialName("/hunts/out/dns-2021-06-01.json"), lib.PartialSuffix) {
+		t.Errorf("expected partial names to not end in .json")
+	}
+}
@@ -0,0 +1,73 @@
+package lib_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that records matching any condition are dropped, over both json and tsv records, and
+// that headers and the records kept are passed on as they are.
+func TestSiteFilter(t *testing.T) {
+	f, e := lib.NewSiteFilter([]string{"query LIKE '%.checkup.example.com'", "id_orig_h IN ('10.0.0.5', '10.0.0.6')"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"id.orig_h":"10.0.0.1","query":"evil.ru"}
+{"id.orig_h":"10.0.0.1","query":"a.checkup.example.com"}
+{"id.orig_h":"10.0.0.5","query":"evil.ru"}
+#separator \x09
+#fields	ts	id.orig_h	query
+1.0	10.0.0.6	evil.com
+2.0	10.0.0.2	-
+{"query":1}`
+	r := f.Reader(strings.NewReader(input))
+	out, e := io.ReadAll(r)
+	r.Close()
+	expected := `{"id.orig_h":"10.0.0.1","query":"evil.ru"}
+#separator \x09
+#fields	ts	id.orig_h	query
+2.0	10.0.0.2	-
+{"query":1}`
+	if e != nil || string(out) != expected {
+		t.Errorf("unexpected output %q: %v", out, e)
+	}
+}
+
+// Test that the values of json records are matched as they are in tsv records, with escapes
+// read, booleans as T or F, and sets as compact json, and that records that are not objects
+// are kept.
+func TestSiteFilterJSONValues(t *testing.T) {
+	f, e := lib.NewSiteFilter([]string{"query = 'a\"b'", "id_resp_p = 8080 AND local_orig = 'T'", `answers = '["10.0.0.1","10.0.0.2"]'`})
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"query":"a\"b"}
+{"id.resp_p":8080,"local_orig":true}
+{"id.resp_p":8080,"local_orig":false}
+{"answers": ["10.0.0.1", "10.0.0.2"]}
+{"answers":["10.0.0.1"]}
+{"query":"a\"b"
+`
+	r := f.Reader(strings.NewReader(input))
+	out, e := io.ReadAll(r)
+	r.Close()
+	expected := `{"id.resp_p":8080,"local_orig":false}
+{"answers":["10.0.0.1"]}
+{"query":"a\"b"
+`
+	if e != nil || string(out) != expected {
+		t.Errorf("unexpected output %q: %v", out, e)
+	}
+}
+
+// Test that a condition that is not valid SQL, or holds an aggregate, is rejected.
+func TestSiteFilterInvalid(t *testing.T) {
+	for _, condition := range []string{"query LIKE", "count(*) > 1", "query = 'a' LIMIT 1"} {
+		if _, e := lib.NewSiteFilter([]string{condition}); e == nil || !strings.Contains(e.Error(), condition) {
+			t.Errorf("expected %q to be rejected, got %v", condition, e)
+		}
+	}
+}
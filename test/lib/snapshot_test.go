@@ -0,0 +1,100 @@
+package lib_test
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// writes a conn log for the current hour, returning the runtime config of a pull of today
+// up to now and the path of the log.
+func currentLog(t *testing.T) (rc lib.RuntimeConfig, logFile string) {
+	now := time.Now()
+	logDir := t.TempDir()
+	dateDir := filepath.Join(logDir, now.Format("2006-01-02"))
+	os.Mkdir(dateDir, 0755)
+	logFile = filepath.Join(dateDir, now.Format("conn.15:00:00.log.gz"))
+	ioutil.WriteFile(logFile, []byte("first\n"), 0644)
+
+	rc = lib.RuntimeConfig{
+		LogType:     "conn",
+		LogDir:      logDir,
+		OutDir:      filepath.Join(t.TempDir(), "out"),
+		Threads:     1,
+		WriteStdout: true,
+		Report:      &lib.RunReport{},
+	}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange(now.Format("2006/01/02:00") + "-" + now.Format("2006/01/02:15"))
+	return rc, logFile
+}
+
+// handler that appends to each log the first time it reads it, as a log still being written.
+func growingHandler(reads *int) func(string, string, time.Time, *sync.WaitGroup, *pb.ProgressBar) {
+	return func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+		*reads++
+		if *reads == 1 {
+			f, _ := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+			f.WriteString("second\n")
+			f.Close()
+		}
+		nameHandler(logFile, outputFile, curTime, wgDate, taskBar)
+	}
+}
+
+// Test that a log that changes while read is flagged in the report, and only read once.
+func TestParseLogsChangedFlag(t *testing.T) {
+	rc, logFile := currentLog(t)
+	rc.OnChange = lib.ChangeFlag
+	reads := 0
+	if e := lib.ParseLogs(io.Discard, io.Discard, growingHandler(&reads), log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	if reads != 1 {
+		t.Errorf("expected the log to be read once, got %d", reads)
+	}
+	if len(rc.Report.Changed) != 1 || rc.Report.Changed[0].LogFile != logFile || rc.Report.Changed[0].Reprocessed {
+		t.Errorf("unexpected changed logs: %+v", rc.Report.Changed)
+	}
+}
+
+// Test that a log that changes while read is read again with ChangeReprocess.
+func TestParseLogsChangedReprocess(t *testing.T) {
+	rc, logFile := currentLog(t)
+	rc.OnChange = lib.ChangeReprocess
+	reads := 0
+	if e := lib.ParseLogs(io.Discard, io.Discard, growingHandler(&reads), log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	if reads != 2 {
+		t.Errorf("expected the log to be read twice, got %d", reads)
+	}
+	if len(rc.Report.Changed) != 1 || rc.Report.Changed[0].LogFile != logFile || !rc.Report.Changed[0].Reprocessed {
+		t.Errorf("unexpected changed logs: %+v", rc.Report.Changed)
+	}
+}
+
+// Test that a snapshot only lists the logs there when it was taken.
+func TestLogSnapshotListed(t *testing.T) {
+	rc, logFile := currentLog(t)
+	snapshot, e := lib.TakeLogSnapshot(rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	appeared := filepath.Join(filepath.Dir(logFile), "conn.00:00:00.appeared.log.gz")
+	ioutil.WriteFile(appeared, nil, 0644)
+	if !snapshot.Listed(logFile) || snapshot.Listed(appeared) {
+		t.Errorf("expected only %s to be listed", logFile)
+	}
+	if snapshot.Changed(logFile) {
+		t.Errorf("expected %s to be unchanged", logFile)
+	}
+}
@@ -0,0 +1,119 @@
+package lib_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// writes a dns log for each hour of 2021-06-01, one after another, and returns a runtime
+// config covering them.
+func sqlLogs(t testing.TB, hours ...string) lib.RuntimeConfig {
+	logDir := t.TempDir()
+	dateDir := filepath.Join(logDir, "2021-06-01")
+	os.MkdirAll(dateDir, 0755)
+	for i, content := range hours {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(content))
+		zw.Close()
+		name := time.Date(2021, 6, 1, i, 0, 0, 0, time.Local).Format("dns.15:04:05-") + time.Date(2021, 6, 1, i+1, 0, 0, 0, time.Local).Format("15:04:05.log.gz")
+		os.WriteFile(filepath.Join(dateDir, name), buf.Bytes(), 0644)
+	}
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	return lib.RuntimeConfig{LogDir: logDir, LogType: "dns", StartTime: start, EndTime: start.Add(time.Duration(len(hours)-1) * time.Hour), Threads: 2}
+}
+
+// runs the query over rc, returning its rows as text.
+func runSQL(t *testing.T, rc lib.RuntimeConfig, query string) string {
+	q, e := lib.ParseSQL(query)
+	if e != nil {
+		t.Fatal(e)
+	}
+	rows, e := lib.RunSQL(q, rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var out bytes.Buffer
+	lib.WriteSQLResult(&out, q, rows, lib.SQLFormatTSV)
+	return out.String()
+}
+
+// Test that groups are merged across logs, over both json and tsv records.
+func TestRunSQLGroupBy(t *testing.T) {
+	rc := sqlLogs(t,
+		`{"id.orig_h":"10.0.0.1","query":"a.ru","rtt":1}
+{"id.orig_h":"10.0.0.2","query":"b.RU","rtt":3}
+{"id.orig_h":"10.0.0.1","query":"c.com"}
+`,
+		"#separator \\x09\n#fields\tid.orig_h\tquery\trtt\n10.0.0.1\td.ru\t-\n10.0.0.3\te.ru\t5\n")
+
+	out := runSQL(t, rc, "SELECT id_orig_h, count(*) AS n, max(rtt) FROM dns WHERE query LIKE '%.ru' GROUP BY 1 ORDER BY n DESC, id_orig_h")
+	expected := "id_orig_h\tn\tmax(rtt)\n10.0.0.1\t2\t1\n10.0.0.2\t1\t3\n10.0.0.3\t1\t5\n"
+	if out != expected {
+		t.Errorf("unexpected result %q", out)
+	}
+
+	out = runSQL(t, rc, "select count(*), count(rtt), count(distinct id.orig_h), sum(rtt), avg(rtt) from dns")
+	if expected = "count(*)\tcount(rtt)\tcount(distinct id.orig_h)\tsum(rtt)\tavg(rtt)\n5\t3\t3\t9\t3\n"; out != expected {
+		t.Errorf("unexpected result %q", out)
+	}
+
+	// an aggregate over no records still has a row.
+	out = runSQL(t, rc, "SELECT count(*), sum(rtt) FROM dns WHERE query = 'none'")
+	if expected = "count(*)\tsum(rtt)\n0\t-\n"; out != expected {
+		t.Errorf("unexpected result %q", out)
+	}
+}
+
+// Test that records are filtered, ordered and limited without grouping.
+func TestRunSQLRows(t *testing.T) {
+	rc := sqlLogs(t,
+		`{"query":"a.ru","rtt":10}
+{"query":"b.com","rtt":2}
+`,
+		`{"query":"c.org"}
+{"query":"d.ru","rtt":9.5}
+`)
+	tests := map[string]string{
+		"SELECT query FROM dns LIMIT 3":                                                   "query\na.ru\nb.com\nc.org\n",
+		"SELECT query, rtt FROM dns WHERE rtt > 5 ORDER BY rtt":                           "query\trtt\nd.ru\t9.5\na.ru\t10\n",
+		"SELECT upper(query) q FROM dns WHERE rtt IS NULL":                                "q\nC.ORG\n",
+		"SELECT query FROM dns WHERE query IN ('b.com', 'c.org') AND NOT query LIKE 'c%'": "query\nb.com\n",
+		"SELECT query FROM dns WHERE rtt * 2 >= 19 OR query = 'b.com' ORDER BY rtt DESC":  "query\na.ru\nd.ru\nb.com\n",
+	}
+	for query, expected := range tests {
+		if out := runSQL(t, rc, query); out != expected {
+			t.Errorf("%s: unexpected result %q", query, out)
+		}
+	}
+}
+
+// Test that queries that are not valid, or not supported, are rejected with where they went wrong.
+func TestParseSQLInvalid(t *testing.T) {
+	for _, query := range []string{
+		"SELECT * FROM dns",
+		"SELECT query FROM",
+		"SELECT query FROM dns WHERE count(*) > 1",
+		"SELECT count(max(rtt)) FROM dns",
+		"SELECT query FROM dns GROUP BY 2",
+		"SELECT query FROM dns LIMIT x",
+		"SELECT 'query FROM dns",
+		"SELECT nope(query) FROM dns",
+	} {
+		if _, e := lib.ParseSQL(query); e == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+
+	q, e := lib.ParseSQL(`select "id.orig_h" as host, count(*) from dns group by host`)
+	if e != nil || q.LogType() != "dns" || !reflect.DeepEqual(q.Columns(), []string{"host", "count(*)"}) {
+		t.Errorf("unexpected query %v (%v)", q.Columns(), e)
+	}
+}
@@ -0,0 +1,62 @@
+package lib_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a log read ahead is read whole and in order, whatever the buffers and how far
+// ahead, and with no read-ahead at all.
+func TestReadAhead(t *testing.T) {
+	defer lib.SetPipeline(lib.DefaultPipeline)
+	content := strings.Repeat("0123456789abcdef\n", 1000)
+	for _, config := range []lib.PipelineConfig{{BufferSize: 16, ReadAhead: 1}, {BufferSize: 1000, ReadAhead: 3}, {BufferSize: 1 << 20, ReadAhead: 4}, {BufferSize: 64, ReadAhead: 0}} {
+		lib.SetPipeline(config)
+		r := lib.NewReadAhead(iotest.HalfReader(strings.NewReader(content)))
+		read, e := io.ReadAll(iotest.OneByteReader(r))
+		r.Close()
+		if e != nil || string(read) != content {
+			t.Errorf("%+v: expected %d bytes, got %d: %v", config, len(content), len(read), e)
+		}
+	}
+}
+
+// Test that an error reading the log is returned once what was read before it is, and that a
+// reader closed early stops reading the log.
+func TestReadAheadError(t *testing.T) {
+	defer lib.SetPipeline(lib.DefaultPipeline)
+	lib.SetPipeline(lib.PipelineConfig{BufferSize: 4, ReadAhead: 2})
+	failed := errors.New("failed")
+	r := lib.NewReadAhead(io.MultiReader(strings.NewReader("abcdefgh"), iotest.ErrReader(failed)))
+	read, e := io.ReadAll(r)
+	r.Close()
+	if string(read) != "abcdefgh" || !errors.Is(e, failed) {
+		t.Errorf("expected the log then its error, got %q, %v", read, e)
+	}
+
+	// the rest of a log no longer wanted is not read.
+	rest := strings.NewReader(strings.Repeat("x", 1<<20))
+	r = lib.NewReadAhead(rest)
+	io.ReadFull(r, make([]byte, 4))
+	r.Close()
+	if rest.Len() < 1<<19 {
+		t.Errorf("expected reading to stop once closed, %d bytes left", rest.Len())
+	}
+}
+
+// Test that the stage writer passes on all that is copied to it.
+func TestStageWriter(t *testing.T) {
+	defer lib.SetPipeline(lib.DefaultPipeline)
+	lib.SetPipeline(lib.PipelineConfig{BufferSize: 7, ReadAhead: 1})
+	var out bytes.Buffer
+	content := strings.Repeat("record\n", 100)
+	if n, e := io.Copy(lib.NewStageWriter(&out), strings.NewReader(content)); e != nil || n != int64(len(content)) || out.String() != content {
+		t.Errorf("expected %d bytes, got %d: %v", len(content), n, e)
+	}
+}
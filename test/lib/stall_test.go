@@ -0,0 +1,52 @@
+package lib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a stall is found once per idle stretch, and that reads and writes count as activity.
+func TestWatchStall(t *testing.T) {
+	activity := lib.NewActivity()
+	stalls := make(chan time.Duration, 10)
+	stop := lib.WatchStall(activity, 40*time.Millisecond, func(idle time.Duration) { stalls <- idle })
+
+	// keep busy for longer than the timeout, which is not a stall.
+	var out bytes.Buffer
+	r, w := activity.Reader(strings.NewReader(strings.Repeat("x", 10))), activity.Writer(&out)
+	for i := 0; i < 10; i++ {
+		buf := make([]byte, 1)
+		r.Read(buf)
+		w.Write(buf)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(stalls) != 0 {
+		t.Fatalf("busy task reported as stalled after %s", <-stalls)
+	}
+
+	// then go idle, which is reported once.
+	time.Sleep(150 * time.Millisecond)
+	stop()
+	if len(stalls) != 1 {
+		t.Fatalf("expected a single stall, got %d", len(stalls))
+	}
+	if idle := <-stalls; idle < 40*time.Millisecond {
+		t.Errorf("stall reported after only %s", idle)
+	}
+}
+
+// Test that a timeout too short to check four times over is still watched, rather than
+// panicking on a ticker of no interval.
+func TestWatchStallShortTimeout(t *testing.T) {
+	stalls := make(chan time.Duration, 10)
+	stop := lib.WatchStall(lib.NewActivity(), 3*time.Nanosecond, func(idle time.Duration) { stalls <- idle })
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	if len(stalls) != 1 {
+		t.Errorf("expected a single stall, got %d", len(stalls))
+	}
+}
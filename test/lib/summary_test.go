@@ -0,0 +1,65 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that output is summarized by day and talker, and rendered in both formats with
+// everything a log held escaped in html.
+func TestSummary(t *testing.T) {
+	outDir := t.TempDir()
+	os.WriteFile(filepath.Join(outDir, "conn-2021-06-01.json"), []byte(
+		`{"ts":"2021-06-01T10:00:00Z","id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1"}
+{"ts":"2021-06-01T11:00:00Z","id.orig_h":"10.0.0.5","id.resp_h":"<script>"}
+not json
+`), 0644)
+	os.WriteFile(filepath.Join(outDir, "conn-2021-06-02.json"), []byte("#fields\tts\nplain\n"), 0644)
+	os.WriteFile(filepath.Join(outDir, ".nagini-checkpoint"), []byte("ignored\n"), 0644)
+
+	pull, e := lib.SummarizeOutput("conn", outDir, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if pull.Files != 2 || pull.Records != 4 {
+		t.Errorf("expected 4 records in 2 files, got %d in %d", pull.Records, pull.Files)
+	}
+	if len(pull.Days) != 2 || pull.Days[1].Key != "2021-06-02" || pull.Days[1].Count != 1 || pull.MaxDay() != 3 {
+		t.Errorf("unexpected days: %+v", pull.Days)
+	}
+	if len(pull.TopTalkers) != 3 || pull.TopTalkers[0] != (lib.Count{Key: "10.0.0.5", Count: 2}) {
+		t.Errorf("unexpected top talkers: %+v", pull.TopTalkers)
+	}
+
+	summary := lib.NewSummary("nagini run conn", []lib.Parameter{{Name: "threads", Value: "4"}}, nil)
+	summary.Pulls = []lib.PullSummary{pull}
+	for _, format := range lib.SummaryFormats() {
+		path, e := lib.WriteSummary(outDir, format, "", summary)
+		if e != nil {
+			t.Fatal(e)
+		}
+		content, _ := os.ReadFile(path)
+		if !strings.Contains(string(content), "10.0.0.5") || !strings.Contains(string(content), "threads") {
+			t.Errorf("%s: unexpected report:\n%s", format, content)
+		}
+		if format == lib.SummaryHTML && strings.Contains(string(content), "<script>") {
+			t.Errorf("html report does not escape records:\n%s", content)
+		}
+	}
+
+	// rendered reports are not summarized as output.
+	if again, _ := lib.SummarizeOutput("conn", outDir, nil); again.Files != 2 {
+		t.Errorf("expected reports to be skipped, got %d files", again.Files)
+	}
+
+	custom := filepath.Join(t.TempDir(), "custom.tmpl")
+	os.WriteFile(custom, []byte(`{{ range .Pulls }}{{ .Name }}={{ .Records }}{{ end }}`), 0644)
+	path, e := lib.WriteSummary(outDir, lib.SummaryMarkdown, custom, summary)
+	if content, _ := os.ReadFile(path); e != nil || string(content) != "conn=4" {
+		t.Errorf("unexpected custom report %q (%v)", content, e)
+	}
+}
@@ -0,0 +1,60 @@
+package lib_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that a synthetic archive holds an hourly log of each log type for each day, with the
+// records asked for, and that the same seed writes the same archive.
+func TestGenerateArchive(t *testing.T) {
+	config := lib.SynthConfig{
+		Start:          time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		Days:           2,
+		LogTypes:       []string{"conn", "dns"},
+		RecordsPerHour: 5,
+		Format:         lib.SynthTSV,
+		Compress:       lib.SynthUncompressed,
+		Seed:           7,
+	}
+	known := lib.KnownLogTypes(nil)
+	logDir := t.TempDir()
+	files, e := lib.GenerateArchive(logDir, config, known)
+	if e != nil || files != 2*24*2 {
+		t.Fatalf("expected %d logs, got %d: %v", 2*24*2, files, e)
+	}
+	last := filepath.Join(logDir, "2021-06-02", "dns.23:00:00-00:00:00.log")
+	content, e := os.ReadFile(last)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var records int
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			records++
+			if fields := strings.Split(line, "\t"); len(fields) != len(known["dns"]) || !strings.HasPrefix(fields[2], "10.0.0.") {
+				t.Errorf("unexpected record %q", line)
+			}
+		}
+	}
+	if records != 5 || !strings.Contains(string(content), "#fields\tts\tuid\t") {
+		t.Errorf("expected a header and 5 records, got:\n%s", content)
+	}
+
+	again := t.TempDir()
+	lib.GenerateArchive(again, config, known)
+	if same, _ := os.ReadFile(filepath.Join(again, "2021-06-02", "dns.23:00:00-00:00:00.log")); !bytes.Equal(same, content) {
+		t.Error("expected the same seed to write the same archive")
+	}
+
+	config.LogTypes = []string{"nonsense"}
+	if _, e = lib.GenerateArchive(t.TempDir(), config, known); e == nil {
+		t.Error("expected an unknown log type to be rejected")
+	}
+}
@@ -0,0 +1,111 @@
+package lib_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// writes a tar container with the given members, named in order, each holding its own name.
+// It is compressed with gzip or zstd if its name ends with .gz or .zst.
+func writeTar(t *testing.T, container string, members ...string) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range members {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), ModTime: time.Now()})
+		tw.Write([]byte(name))
+	}
+	tw.Close()
+	content := buf.Bytes()
+	switch {
+	case strings.HasSuffix(container, ".gz"):
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(content)
+		zw.Close()
+		content = zbuf.Bytes()
+	case strings.HasSuffix(container, ".zst"):
+		zstd := exec.Command("zstd", "-c")
+		zstd.Stdin = bytes.NewReader(content)
+		var e error
+		if content, e = zstd.Output(); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := os.WriteFile(container, content, 0644); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// Test that only the logs of the pulled hours are extracted from the containers of dates
+// with no date directory, only once, and that the pull then reads them with the others.
+func TestExtractTarLogs(t *testing.T) {
+	logDir := t.TempDir()
+	writeTar(t, filepath.Join(logDir, "2021-06-01.tar.gz"), "2021-06-01/conn.00:00:00-01:00:00.log.gz", "2021-06-01/conn.05:00:00-06:00:00.log.gz", "2021-06-01/dns.00:00:00-01:00:00.log.gz", "../conn.01:00:00-02:00:00.log.gz")
+	writeTar(t, filepath.Join(logDir, "2021-06-02.tar"), "./conn.00:00:00-01:00:00.log.gz")
+	writeTar(t, filepath.Join(logDir, "2021-06-03.tar"), "conn.00:00:00-01:00:00.log.gz", "conn.01:00:00-02:00:00.log.gz")
+	os.MkdirAll(filepath.Join(logDir, "2021-06-03"), 0755)
+	os.WriteFile(filepath.Join(logDir, "2021-06-03", "conn.00:00:00-01:00:00.log.gz"), nil, 0644)
+
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	rc := lib.RuntimeConfig{LogDir: logDir, LogType: "conn", StartTime: start, EndTime: start.AddDate(0, 0, 2)}
+	cache := lib.LogCache{Dir: t.TempDir(), MaxBytes: 1 << 20}
+	var out bytes.Buffer
+	extractDir, e := lib.ExtractTarLogs(rc, cache, &out)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(out.String(), "Extracting 3 log(s) from "+filepath.Join(logDir, "2021-06-01.tar.gz")) || !strings.Contains(out.String(), "Extracting 1 log(s) from "+filepath.Join(logDir, "2021-06-02.tar")) || strings.Contains(out.String(), "2021-06-03.tar") {
+		t.Errorf("unexpected extraction: %s", out.String())
+	}
+
+	// the member outside of the date directory is kept inside of the cache.
+	rc.ExtractDir = extractDir
+	logFiles, e := lib.PullLogs(rc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := []string{
+		filepath.Join(extractDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"),
+		filepath.Join(extractDir, "2021-06-01", "conn.01:00:00-02:00:00.log.gz"),
+		filepath.Join(extractDir, "2021-06-01", "conn.05:00:00-06:00:00.log.gz"),
+		filepath.Join(extractDir, "2021-06-02", "conn.00:00:00-01:00:00.log.gz"),
+		filepath.Join(logDir, "2021-06-03", "conn.00:00:00-01:00:00.log.gz"),
+	}
+	if strings.Join(logFiles, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected logs %v, got %v", expected, logFiles)
+	}
+
+	out.Reset()
+	if _, e = lib.ExtractTarLogs(rc, cache, &out); e != nil || !strings.Contains(out.String(), "Extracting 0 log(s)") || !strings.Contains(out.String(), "3 already extracted") {
+		t.Errorf("expected the logs to be extracted already, got %q (%v)", out.String(), e)
+	}
+}
+
+// Test that containers compressed with zstd are read through the zstd command.
+func TestExtractTarLogsZstd(t *testing.T) {
+	if _, e := exec.LookPath("zstd"); e != nil {
+		t.Skip("zstd is not installed")
+	}
+	logDir := t.TempDir()
+	writeTar(t, filepath.Join(logDir, "2021-06-01.tar.zst"), "2021-06-01/conn.00:00:00-01:00:00.log.gz")
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	rc := lib.RuntimeConfig{LogDir: logDir, LogType: "conn", StartTime: start, EndTime: start}
+	var out bytes.Buffer
+	extractDir, e := lib.ExtractTarLogs(rc, lib.LogCache{Dir: t.TempDir(), MaxBytes: 1 << 20}, &out)
+	if e != nil {
+		t.Fatal(e)
+	}
+	content, e := os.ReadFile(filepath.Join(extractDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"))
+	if e != nil || string(content) != "2021-06-01/conn.00:00:00-01:00:00.log.gz" {
+		t.Errorf("unexpected log %q (%v)", content, e)
+	}
+}
@@ -0,0 +1,87 @@
+package lib_test
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheggaaa/pb"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the task manifest of a pull lists its logs by date, empty dates included, and
+// survives being written and read back.
+func TestDiscoverTasks(t *testing.T) {
+	logDir := t.TempDir()
+	for _, log := range []string{"2021-06-01/conn.00:00:00-01:00:00.log.gz", "2021-06-01/conn.05:00:00-06:00:00.log.gz", "2021-06-03/conn.00:00:00-01:00:00.log.gz"} {
+		os.MkdirAll(filepath.Join(logDir, filepath.Dir(log)), 0755)
+		ioutil.WriteFile(filepath.Join(logDir, log), nil, 0644)
+	}
+	rc := lib.RuntimeConfig{LogType: "conn", LogDir: logDir, OutDir: t.TempDir(), Threads: 1}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/03:23")
+
+	m := lib.DiscoverTasks(rc, log.New(io.Discard, "", 0))
+	if len(m.Days) != 3 || m.Days[0].Date != "2021-06-01" || len(m.Days[0].Tasks) != 2 || len(m.Days[1].Tasks) != 0 || len(m.Days[2].Tasks) != 1 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if task := m.Days[0].Tasks[1]; filepath.Base(task.Log) != "conn.05:00:00-06:00:00.log.gz" || !task.Hour.Equal(time.Date(2021, 6, 1, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected task %+v", task)
+	}
+
+	path := filepath.Join(t.TempDir(), "conn.json")
+	if e := lib.WriteTaskManifest(path, m); e != nil {
+		t.Fatal(e)
+	}
+	read, e := lib.ReadTaskManifest(path)
+	if e != nil || !reflect.DeepEqual(read, m) {
+		t.Errorf("expected %+v, read %+v (%v)", m, read, e)
+	}
+
+	ioutil.WriteFile(path, []byte("{}"), 0644)
+	if _, e = lib.ReadTaskManifest(path); e == nil {
+		t.Error("expected a manifest without a log type to be refused")
+	}
+}
+
+// Test that a pull with a task manifest reads the logs listed in it, and no others.
+func TestParseLogsTasks(t *testing.T) {
+	logDir := t.TempDir()
+	for _, log := range []string{"2021-06-01/conn.00:00:00-01:00:00.log.gz", "2021-06-01/conn.05:00:00-06:00:00.log.gz"} {
+		os.MkdirAll(filepath.Join(logDir, filepath.Dir(log)), 0755)
+		ioutil.WriteFile(filepath.Join(logDir, log), nil, 0644)
+	}
+	rc := lib.RuntimeConfig{LogType: "conn", LogDir: logDir, OutDir: filepath.Join(t.TempDir(), "out"), Threads: 1, WriteStdout: true}
+	rc.StartTime, rc.EndTime, _ = lib.ParseTimeRange("2021/06/01:00-2021/06/01:23")
+	m := lib.DiscoverTasks(rc, log.New(io.Discard, "", 0))
+	m.Days[0].Tasks = m.Days[0].Tasks[1:]
+	// a log that appears after the discovery pass is left out.
+	ioutil.WriteFile(filepath.Join(logDir, "2021-06-01", "conn.07:00:00-08:00:00.log.gz"), nil, 0644)
+	rc.Tasks = &m
+
+	var lock sync.Mutex
+	var read []string
+	handler := func(logFile string, outputFile string, curTime time.Time, wgDate *sync.WaitGroup, taskBar *pb.ProgressBar) {
+		lock.Lock()
+		read = append(read, filepath.Base(logFile))
+		lock.Unlock()
+		nameHandler(logFile, outputFile, curTime, wgDate, taskBar)
+	}
+	if e := lib.ParseLogs(io.Discard, io.Discard, handler, log.New(io.Discard, "", 0), rc); e != nil {
+		t.Fatal(e)
+	}
+	sort.Strings(read)
+	if !reflect.DeepEqual(read, []string{"conn.05:00:00-06:00:00.log.gz"}) {
+		t.Errorf("expected only the listed log to be read, got %v", read)
+	}
+	if logs, _ := lib.PullLogs(rc); len(logs) != 1 {
+		t.Errorf("expected the logs of the manifest, got %v", logs)
+	}
+}
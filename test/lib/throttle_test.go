@@ -0,0 +1,62 @@
+package lib_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that only errors from running out of resources are told apart, however wrapped.
+func TestIsResourceExhausted(t *testing.T) {
+	wrapped := fmt.Errorf("start: %w", &os.PathError{Op: "fork/exec", Path: "/bin/true", Err: syscall.EAGAIN})
+	if !lib.IsResourceExhausted(wrapped) || !lib.IsResourceExhausted(syscall.EMFILE) {
+		t.Error("expected EAGAIN and EMFILE to be resource exhaustion")
+	}
+	if lib.IsResourceExhausted(nil) || lib.IsResourceExhausted(os.ErrNotExist) {
+		t.Error("expected other errors not to be resource exhaustion")
+	}
+}
+
+// Test that tasks that ran out of resources together only halve the limit once, and that
+// no more tasks than the lowered limit run once running tasks finish.
+func TestThrottleShrink(t *testing.T) {
+	throttle := lib.NewThrottle(8)
+	for i := 0; i < 3; i++ {
+		if limit := throttle.Shrink(8); limit != 4 {
+			t.Fatalf("expected the limit to be halved once, got %d", limit)
+		}
+	}
+	if limit := throttle.Shrink(1); limit != 1 {
+		t.Errorf("expected the limit to stay at 1 or more, got %d", limit)
+	}
+
+	var lock sync.Mutex
+	var running, peak int
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		throttle.Acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer throttle.Release()
+			lock.Lock()
+			if running++; running > peak {
+				peak = running
+			}
+			lock.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("expected at most 1 task at once, got %d", peak)
+	}
+}
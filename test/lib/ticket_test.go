@@ -0,0 +1,46 @@
+package lib_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that ticket updates are posted as json with the bearer token, and that a failed
+// answer from the webhook is an error.
+func TestPostTicketUpdate(t *testing.T) {
+	var received lib.TicketUpdate
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if e := json.NewDecoder(r.Body).Decode(&received); e != nil || received.Ticket == "bad" {
+			http.Error(w, "no such ticket", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	summary := lib.NewSummary("nagini run conn cat", nil, nil)
+	summary.Pulls = []lib.PullSummary{{Name: "conn", Records: 3}}
+	update, e := lib.NewTicketUpdate("INC-1234", summary, []string{"/out"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = lib.PostTicketUpdate(server.URL, "secret", update); e != nil {
+		t.Fatal(e)
+	}
+	if auth != "Bearer secret" || received.Ticket != "INC-1234" || received.Records != 3 || received.Outputs[0] != "/out" {
+		t.Errorf("unexpected update %+v (auth %q)", received, auth)
+	}
+	if !strings.Contains(received.Summary, "# nagini run conn cat") {
+		t.Errorf("expected a markdown summary, got %q", received.Summary)
+	}
+
+	update.Ticket = "bad"
+	if e = lib.PostTicketUpdate(server.URL, "", update); e == nil || !strings.Contains(e.Error(), "no such ticket") {
+		t.Errorf("expected the webhook's answer as an error, got %v", e)
+	}
+}
@@ -0,0 +1,134 @@
+package lib_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that whole days and months can be given with wildcards.
+func TestParseTimeRangeWildcards(t *testing.T) {
+	testTable := map[string]string{
+		"2021/06/01:*": "2021-06-01T00_2021-06-01T23",
+		"2021/02/*":    "2021-02-01T00_2021-02-28T23",
+		"2020/02/*":    "2020-02-01T00_2020-02-29T23",
+		"2021/12/*":    "2021-12-01T00_2021-12-31T23",
+	}
+	for timeRange, expected := range testTable {
+		start, end, e := lib.ParseTimeRange(timeRange)
+		if e != nil || (lib.TimeChunk{Start: start, End: end}).Name() != expected {
+			t.Errorf("%s: expected %s, got %s - %s (%v)", timeRange, expected, start, end, e)
+		}
+	}
+	for _, timeRange := range []string{"2021/13/*", "2021/06/32:*", "2021/*", "*"} {
+		if _, _, e := lib.ParseTimeRange(timeRange); !errors.Is(e, lib.ErrBadTimeRange) {
+			t.Errorf("%s: expected error matching %v, got %v", timeRange, lib.ErrBadTimeRange, e)
+		}
+	}
+}
+
+// Test that chunk sizes accept hours, days and weeks, and reject anything else.
+func TestParseChunkSize(t *testing.T) {
+	testTable := map[string]time.Duration{
+		"12h": 12 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"0d":  0,
+		"90m": 0,
+		"d":   0,
+		"7x":  0,
+	}
+
+	for chunkSize, expected := range testTable {
+		size, e := lib.ParseChunkSize(chunkSize)
+		if expected == 0 {
+			if !errors.Is(e, lib.ErrBadTimeRange) {
+				t.Errorf("%s: expected error matching %v, got %v", chunkSize, lib.ErrBadTimeRange, e)
+			}
+		} else if e != nil || size != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", chunkSize, expected, size, e)
+		}
+	}
+}
+
+// Test that a time range is split into consecutive chunks covering every hour exactly once.
+func TestSplitTimeRange(t *testing.T) {
+	start, end, _ := lib.ParseTimeRange("2021/06/01:00-2021/06/10:05")
+	chunks := lib.SplitTimeRange(start, end, 4*24*time.Hour)
+
+	expected := []string{
+		"2021-06-01T00_2021-06-04T23",
+		"2021-06-05T00_2021-06-08T23",
+		"2021-06-09T00_2021-06-10T05",
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("expected %d chunks, got %v", len(expected), chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Name() != expected[i] {
+			t.Errorf("chunk %d: expected %s, got %s", i, expected[i], chunk.Name())
+		}
+	}
+}
+
+// Test that checkpoints record names across reads, and that a missing checkpoint is empty.
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lib.CheckpointFile)
+	done, e := lib.ReadCheckpoint(path)
+	if e != nil || len(done) != 0 {
+		t.Fatalf("expected an empty checkpoint, got %v (%v)", done, e)
+	}
+
+	lib.AppendCheckpoint(path, "first")
+	lib.AppendCheckpoint(path, "second")
+	done, e = lib.ReadCheckpoint(path)
+	if e != nil || !done["first"] || !done["second"] || len(done) != 2 {
+		t.Errorf("expected first and second, got %v (%v)", done, e)
+	}
+}
+
+// Test that time masks select business hours, overnight hours, and their inverse.
+func TestTimeMask(t *testing.T) {
+	monday9 := time.Date(2021, 6, 7, 9, 0, 0, 0, time.UTC)
+	monday18 := monday9.Add(9 * time.Hour)
+	monday23 := monday9.Add(14 * time.Hour)
+	saturday9 := monday9.AddDate(0, 0, 5)
+
+	type testEntry struct {
+		hours    string
+		weekdays bool
+		weekends bool
+		invert   bool
+		expected [4]bool // monday9, monday18, monday23, saturday9
+	}
+	testTable := []testEntry{
+		{"08-18", true, false, false, [4]bool{true, false, false, false}},
+		{"08-18", true, false, true, [4]bool{false, true, true, true}},
+		{"18-08", false, false, false, [4]bool{false, true, true, false}},
+		{"00-24", false, true, false, [4]bool{false, false, false, true}},
+		{"", true, false, false, [4]bool{true, true, true, false}},
+	}
+	for _, testCase := range testTable {
+		mask, e := lib.ParseTimeMask(testCase.hours, testCase.weekdays, testCase.weekends, testCase.invert)
+		if e != nil {
+			t.Fatalf("%v: %v", testCase, e)
+		}
+		for i, hour := range []time.Time{monday9, monday18, monday23, saturday9} {
+			if mask.Includes(hour) != testCase.expected[i] {
+				t.Errorf("%s: expected %v for %s", mask, testCase.expected[i], hour.Format("Mon 15:04"))
+			}
+		}
+	}
+
+	if mask, e := lib.ParseTimeMask("", false, false, false); mask != nil || e != nil {
+		t.Errorf("expected no mask, got %v (%v)", mask, e)
+	}
+	for _, hours := range []string{"8", "08-08", "25-03", "a-b"} {
+		if _, e := lib.ParseTimeMask(hours, false, false, false); !errors.Is(e, lib.ErrBadTimeRange) {
+			t.Errorf("%s: expected error matching %v, got %v", hours, lib.ErrBadTimeRange, e)
+		}
+	}
+}
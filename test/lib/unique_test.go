@@ -0,0 +1,128 @@
+package lib_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that the distinct values of fields are counted across writers, most common first.
+func TestUniqueValues(t *testing.T) {
+	unique := lib.NewUniqueValues([]string{"id_resp_h", "proto"})
+	first := unique.Writer("a")
+	first.Write([]byte(`{"id.resp_h":"10.0.0.2","proto":"tcp"}` + "\n" + `{"id.resp_h":"10.0.0.1","proto":"udp"}` + "\n{\"uid\":"))
+	first.Write([]byte(`"C1"}` + "\nnot json\n"))
+	first.Close()
+	second := unique.Writer("b")
+	second.Write([]byte("#fields\tid.resp_h\tproto\n10.0.0.2\ttcp\n10.0.0.3\t-"))
+	second.Close()
+
+	// a writer of the same key replaces the counts of the earlier one.
+	retried := unique.Writer("c")
+	retried.Write([]byte(`{"id.resp_h":"10.0.0.9","proto":"tcp"}` + "\n"))
+	retried.Close()
+	retried = unique.Writer("c")
+	retried.Close()
+
+	var out bytes.Buffer
+	if e := unique.WriteCounts(&out); e != nil {
+		t.Fatal(e)
+	}
+	expected := "id_resp_h\tproto\tcount\n10.0.0.2\ttcp\t2\n10.0.0.1\tudp\t1\n10.0.0.3\t-\t1\n"
+	if out.String() != expected {
+		t.Errorf("unexpected counts %q", out.String())
+	}
+}
+
+// Test that only the most common values are written with Top, even once there are more
+// distinct values than candidates are kept.
+func TestUniqueValuesTop(t *testing.T) {
+	unique := lib.NewUniqueValues([]string{"query"})
+	unique.Top = 2
+	for task := 0; task < 3; task++ {
+		w := unique.Writer(fmt.Sprint(task))
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(w, "{\"query\":\"rare%d-%d.example\"}\n{\"query\":\"common.example\"}\n", task, i)
+			if i%2 == 0 {
+				fmt.Fprintln(w, `{"query":"second.example"}`)
+			}
+		}
+		w.Close()
+	}
+
+	var out bytes.Buffer
+	if e := unique.WriteCounts(&out); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "common.example\t") || !strings.HasPrefix(lines[2], "second.example\t") {
+		t.Errorf("unexpected counts %q", out.String())
+	}
+}
+
+// Test that JSON records read without decoding them count the same values as when decoded:
+// escaped strings, booleans, nulls, a field named as given over one with dots, and fields
+// holding objects.
+func TestUniqueValuesJSON(t *testing.T) {
+	unique := lib.NewUniqueValues([]string{"id_orig_h", "local", "note"})
+	w := unique.Writer("a")
+	w.Write([]byte(strings.Join([]string{
+		`{"id.orig_h":"10.0.0.1","local":true,"note":"a \"b\""}`,
+		`{"id.orig_h":"10.0.0.1","id_orig_h":"10.0.0.2","local":false,"note":null}`,
+		`{"id.orig_h":"10.0.0.3","local":null,"note":{"b":1,"a":[1,2]}}`,
+		`{"id.orig_h":"10.0.0.4",`,
+		`{"uid":"C1"}`,
+	}, "\n") + "\n"))
+	w.Close()
+
+	rows, counts := unique.Rows()
+	expected := [][]string{{"10.0.0.1", "T", `a "b"`}, {"10.0.0.2", "F", "-"}, {"10.0.0.3", "-", `{"a":[1,2],"b":1}`}}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d values, got %q", len(expected), rows)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	for i := range expected {
+		if strings.Join(rows[i], "\t") != strings.Join(expected[i], "\t") || counts[i] != 1 {
+			t.Errorf("expected %q, got %q", expected[i], rows[i])
+		}
+	}
+}
+
+// Test that counting a JSON record whose values were seen before allocates nothing.
+func TestUniqueValuesJSONAllocs(t *testing.T) {
+	unique := lib.NewUniqueValues([]string{"id.orig_h", "id_resp_h", "proto"})
+	w := unique.Writer("a")
+	record := []byte(`{"ts":1622505600.1,"uid":"C1","id.orig_h":"10.0.0.1","id.orig_p":51234,"id.resp_h":"10.0.0.2","id.resp_p":443,"proto":"tcp","service":"ssl","duration":1.5,"local_orig":true,"history":"ShADadFf"}` + "\n")
+	w.Write(record)
+	if allocs := testing.AllocsPerRun(100, func() { w.Write(record) }); allocs > 0 {
+		t.Errorf("expected no allocations per record, got %v", allocs)
+	}
+	w.Close()
+}
+
+// Test that the values of HashFields are written as salted hashes, keyed by the salt, and
+// unset values are left unset.
+func TestUniqueValuesHash(t *testing.T) {
+	unique := lib.NewUniqueValues([]string{"id_orig_h", "proto"})
+	unique.HashFields, unique.Salt = []string{"id_orig_h"}, "secret"
+	w := unique.Writer("a")
+	w.Write([]byte(`{"id.orig_h":"10.0.0.1","proto":"tcp"}` + "\n" + `{"id.orig_h":"10.0.0.1","proto":"tcp"}` + "\n" + `{"proto":"udp"}` + "\n"))
+	w.Close()
+
+	hash := lib.HashValue("secret", "10.0.0.1")
+	if len(hash) != 64 || hash == lib.HashValue("other", "10.0.0.1") || hash == lib.HashValue("secret", "10.0.0.2") {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	var out bytes.Buffer
+	if e := unique.WriteCounts(&out); e != nil {
+		t.Fatal(e)
+	}
+	expected := "id_orig_h\tproto\tcount\n" + hash + "\ttcp\t2\n-\tudp\t1\n"
+	if out.String() != expected {
+		t.Errorf("unexpected counts %q", out.String())
+	}
+}
@@ -0,0 +1,140 @@
+package lib_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that problems are kept as given, so a value holding a % is not formatted again.
+func TestValidatorKeepsMessages(t *testing.T) {
+	var v lib.Validator
+	v.Order("x%v")
+	v.LogDir("/tmp/nope%d%s")
+	if len(v.Problems) != 2 || !strings.Contains(v.Problems[0].Error(), "'x%v'") || !strings.Contains(v.Problems[1].Error(), "/tmp/nope%d%s") {
+		t.Errorf("unexpected problems %v", v.Problems)
+	}
+}
+
+// Test that GenRuntimeConfig records every problem, rather than stopping at the first.
+func TestParseSharedArgs(t *testing.T) {
+	logDir := t.TempDir()
+	os.Mkdir(filepath.Join(logDir, "2021-06-01"), 0755)
+	os.WriteFile(filepath.Join(logDir, "2021-06-01", "conn.00:00:00-01:00:00.log.gz"), nil, 0644)
+	// missing parents of the output directory are created, so only a file in the way is fatal.
+	notDir := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(notDir, nil, 0644)
+
+	type testEntry struct {
+		name             string
+		timeRange        string
+		logDir           string
+		outDir           string
+		logType          string
+		threads          int
+		expectedProblems int
+		expectedErr      error
+	}
+
+	testTable := []testEntry{
+		{"valid", "2021/06/01:00-2021/06/01:05", logDir, filepath.Join(t.TempDir(), "out"), "conn", 4, 0, nil},
+		{"malformed range", "2021/06/01", logDir, filepath.Join(t.TempDir(), "out"), "conn", 4, 1, lib.ErrBadTimeRange},
+		{"reversed range", "2021/06/02:00-2021/06/01:00", logDir, filepath.Join(t.TempDir(), "out"), "conn", 4, 1, lib.ErrBadTimeRange},
+		{"missing log type", "2021/06/01:00-2021/06/01:05", logDir, filepath.Join(t.TempDir(), "out"), "dns", 4, 1, lib.ErrNoMatches},
+		{"everything wrong", "2021/06/02:00-2021/06/01:00", "/does/not/exist", filepath.Join(notDir, "out"), "conn", 0, 4, lib.ErrBadTimeRange},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var v lib.Validator
+			lib.GenRuntimeConfig(&v, testCase.timeRange, testCase.logDir, testCase.outDir, testCase.logType, testCase.threads, false, false)
+			if len(v.Problems) != testCase.expectedProblems {
+				t.Errorf("\nexpected %d problems\ngot %v", testCase.expectedProblems, v.Problems)
+			}
+			if testCase.expectedErr != nil && !errors.Is(v.Err(), testCase.expectedErr) {
+				t.Errorf("\nexpected error matching %v\ngot %v", testCase.expectedErr, v.Err())
+			}
+		})
+	}
+}
+
+// Test that TryCreateDir reports a non-empty directory with ErrOutputNotEmpty.
+func TestTryCreateDirNotEmpty(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+
+	e := lib.TryCreateDir(dir, true)
+	if !errors.Is(e, lib.ErrOutputNotEmpty) {
+		t.Errorf("\nexpected error matching %v\ngot %v", lib.ErrOutputNotEmpty, e)
+	}
+}
+
+// Test that fields are checked against the known log types, which the config can override.
+func TestValidatorFields(t *testing.T) {
+	known := lib.KnownLogTypes(map[string][]string{"conn": {"ts", "id.orig_h", "site_tag"}, "beacon": {"ts", "score"}})
+	testTable := []struct {
+		logType          string
+		fields           []string
+		expectedProblems int
+	}{
+		{"dns", []string{"query", "id_orig_h", "id.resp_h", "AA"}, 0},
+		{"dns", []string{"qurey", "anything"}, 2},
+		{"conn", []string{"site_tag", "id_orig_h"}, 0},
+		{"conn", []string{"service"}, 1},
+		{"beacon", []string{"score"}, 0},
+		{"custom", []string{"anything"}, 0},
+	}
+	for _, testCase := range testTable {
+		var v lib.Validator
+		v.Fields(testCase.logType, testCase.fields, known)
+		if len(v.Problems) != testCase.expectedProblems {
+			t.Errorf("%s %v: expected %d problems, got %v", testCase.logType, testCase.fields, testCase.expectedProblems, v.Problems)
+		}
+	}
+
+	var v lib.Validator
+	v.Fields("dns", []string{"qurey"}, known)
+	if !v.Failed() || !strings.Contains(v.Problems[0].Error(), "did you mean 'query'?") {
+		t.Errorf("expected a suggestion, got %v", v.Problems)
+	}
+}
+
+// Test that output directories must be under an allowed root, if any, outside denied roots
+// and outside the log directory, including through a symlink that does not look like it.
+func TestValidatorOutputRoot(t *testing.T) {
+	cases, scratch, logDir := t.TempDir(), t.TempDir(), t.TempDir()
+	os.Mkdir(filepath.Join(cases, "denied"), 0755)
+	link := filepath.Join(cases, "archive")
+	os.Symlink(logDir, link)
+	allowed, denied := []string{cases, scratch}, []string{filepath.Join(cases, "denied")}
+
+	testTable := []struct {
+		outDir           string
+		expectedProblems int
+	}{
+		{filepath.Join(cases, "hunt", "out"), 0},
+		{scratch, 0},
+		{filepath.Join(t.TempDir(), "out"), 1},
+		{filepath.Join(cases, "denied", "out"), 1},
+		{filepath.Join(cases, "denied-not", "out"), 0},
+		{filepath.Join(logDir, "out"), 2},
+		{filepath.Join(link, "2021-06-01", "out"), 2},
+	}
+	for _, testCase := range testTable {
+		var v lib.Validator
+		v.OutputRoot(testCase.outDir, logDir, allowed, denied)
+		if len(v.Problems) != testCase.expectedProblems {
+			t.Errorf("%s: expected %d problems, got %v", testCase.outDir, testCase.expectedProblems, v.Problems)
+		}
+	}
+
+	var v lib.Validator
+	v.OutputRoot(filepath.Join(t.TempDir(), "out"), logDir, nil, nil)
+	if len(v.Problems) != 0 {
+		t.Errorf("expected any directory outside the log directory without roots, got %v", v.Problems)
+	}
+}
@@ -0,0 +1,89 @@
+package lib_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/OSU-SOC/nagini/lib"
+)
+
+// Test that only the records matching the condition are kept, of JSON and TSV logs, with
+// headers passed on.
+func TestWhereFilter(t *testing.T) {
+	f, e := lib.NewWhereFilter("id.resp_p == 3389 && id.orig_h in 10.0.0.0/8")
+	if e != nil {
+		t.Fatal(e)
+	}
+	input := `{"id.orig_h":"10.0.0.5","id.resp_p":3389}
+{"id.orig_h":"10.0.0.5","id.resp_p":22}
+{"id.orig_h":"198.51.100.1","id.resp_p":3389}
+#separator \x09
+#fields	id.orig_h	id.resp_p
+10.1.1.1	3389
+198.51.100.1	3389
+-	3389
+`
+	var out bytes.Buffer
+	if e = f.Filter(context.Background(), strings.NewReader(input), &out); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(input, "\n")
+	if expected := strings.Join([]string{lines[0], lines[3], lines[4], lines[5]}, "\n") + "\n"; out.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+	if f.String() != "id.resp_p == 3389 && id.orig_h in 10.0.0.0/8" {
+		t.Errorf("unexpected condition %q", f.String())
+	}
+}
+
+// Test the operators of conditions besides those of sql: ==, &&, ||, !, and matching
+// addresses, and sets of them, against subnets and addresses.
+func TestWhereFilterOperators(t *testing.T) {
+	records := []string{
+		`{"id.orig_h":"10.0.0.5","id.resp_h":"192.0.2.1","proto":"tcp","tx_hosts":["198.51.100.9","2001:db8::1"]}`,
+		`{"id.orig_h":"172.16.0.5","id.resp_h":"10.0.0.9","proto":"udp","tx_hosts":["198.51.100.9"]}`,
+	}
+	for condition, matched := range map[string]string{
+		"id.orig_h in 10.0.0.0/8":                                               "0",
+		"id.orig_h IN (10.0.0.0/8, 172.16.0.0/12)":                              "01",
+		"id.orig_h not in 10.0.0.0/8":                                           "1",
+		"!(id.orig_h in 10.0.0.0/8)":                                            "1",
+		"id.resp_h == 192.0.2.1":                                                "0",
+		"id.resp_h = '192.0.2.1' || proto == 'udp'":                             "01",
+		"id_orig_h in 10.0.0.0/8 && proto == 'tcp'":                             "0",
+		"tx_hosts in 2001:db8::/32":                                             "0",
+		"tx_hosts in 198.51.100.9":                                              "01",
+		"id.orig_h in (10.0.0.5, 172.16.0.5)":                                   "01",
+		"missing in 10.0.0.0/8 || proto != 'tcp' && !(id.orig_h in 10.0.0.0/8)": "1",
+	} {
+		f, e := lib.NewWhereFilter(condition)
+		if e != nil {
+			t.Errorf("%s: %v", condition, e)
+			continue
+		}
+		kept := ""
+		for i, record := range records {
+			var out bytes.Buffer
+			if e = f.Filter(context.Background(), strings.NewReader(record+"\n"), &out); e != nil {
+				t.Fatal(e)
+			}
+			if out.Len() > 0 {
+				kept += string(rune('0' + i))
+			}
+		}
+		if kept != matched {
+			t.Errorf("%s: kept records %q, expected %q", condition, kept, matched)
+		}
+	}
+}
+
+// Test that malformed conditions are rejected.
+func TestWhereFilterInvalid(t *testing.T) {
+	for _, condition := range []string{"", "id.resp_p ==", "id.orig_h = 10.0.0.0/8", "id.orig_h in 10.0.0.0/33", "count(*) > 1"} {
+		if _, e := lib.NewWhereFilter(condition); e == nil {
+			t.Errorf("%q: expected an error", condition)
+		}
+	}
+}
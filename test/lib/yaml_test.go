@@ -1,19 +1,22 @@
 package lib_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/OSU-SOC/nagini/lib"
 )
 
-// Test the ParseConfig command.
+// Test the ParsePlaybook command.
 // Runs the command, and passes in various test.yaml
 // files to parse. Compares them to an expected struct.
 func TestParseConfig(t *testing.T) {
 	type testEntry struct {
 		input        string
-		expectedData lib.Config
+		expectedData lib.Playbook
 		expectedErr  error
 	}
 
@@ -22,7 +25,7 @@ func TestParseConfig(t *testing.T) {
 		// TEST #1
 		{
 			input: "test1.yaml",
-			expectedData: lib.Config{
+			expectedData: lib.Playbook{
 				DataSources: []lib.DataSource{
 					{
 						Name:       "test_name",
@@ -39,7 +42,7 @@ func TestParseConfig(t *testing.T) {
 	// Run function over test table
 	for _, testCase := range testTable {
 		t.Run(testCase.input, func(t *testing.T) {
-			actualData, actualErr := lib.ParseConfig(testCase.input)
+			actualData, actualErr := lib.ParsePlaybook(testCase.input)
 			if !reflect.DeepEqual(actualData, testCase.expectedData) {
 				t.Errorf("\nIncorrect Data.\nexpected %v\ngot %v", testCase.expectedData, actualErr)
 			} else if actualErr != testCase.expectedErr {
@@ -48,3 +51,110 @@ func TestParseConfig(t *testing.T) {
 		})
 	}
 }
+
+// Test that playbook variables are filled in, and that missing variables are an error.
+func TestParsePlaybookWithVars(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hunt.yaml")
+	ioutil.WriteFile(path, []byte(`data_sources:
+  - name: {{ .name }}
+    log_type: conn
+    command: [grepcidr, "{{ .ip }}"]
+`), 0644)
+
+	setEnv(t, lib.PlaybookVarEnvPrefix+"ip", "10.0.0.1")
+	vars := lib.PlaybookVarsFromEnv()
+	vars["name"] = "ip-hunt"
+	playbook, e := lib.ParsePlaybookWithVars(path, vars)
+	if e != nil {
+		t.Fatal(e)
+	}
+	source := playbook.DataSources[0]
+	if source.Name != "ip-hunt" || !reflect.DeepEqual(source.Command, []string{"grepcidr", "10.0.0.1"}) {
+		t.Errorf("variables not filled in: %+v", source)
+	}
+
+	delete(vars, "ip")
+	if _, e := lib.ParsePlaybookWithVars(path, vars); e == nil {
+		t.Error("expected an error for a missing variable")
+	}
+}
+
+// Test that playbook variables are filled in as they are, rather than read as YAML, whether or
+// not they are quoted in the playbook.
+func TestParsePlaybookVarsEscaped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hunt.yaml")
+	ioutil.WriteFile(path, []byte(`threads: {{ .threads }}
+data_sources:
+  - name: {{ .name }}
+    log_type: conn
+    command: [grep, "{{ .pattern }}", '{{ .pattern }}', {{ .name }}]
+`), 0644)
+
+	vars := map[string]string{"name": "# x", "pattern": "a, --flag", "threads": "4"}
+	playbook, e := lib.ParsePlaybookStrict(path, vars)
+	if e != nil {
+		t.Fatal(e)
+	}
+	source := playbook.DataSources[0]
+	if playbook.Threads != 4 || source.Name != "# x" || !reflect.DeepEqual(source.Command, []string{"grep", "a, --flag", "a, --flag", "# x"}) {
+		t.Errorf("variables not filled in as they are: %+v %+v", playbook, source)
+	}
+}
+
+// Test that playbooks are merged on top of what they extend and include.
+func TestParsePlaybookExtends(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "site"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "site", "base.yaml"), []byte(`zeek_log_dir: /data/zeek/logs
+threads: 4
+output_dir: ./out
+pre_run:
+  - command: [mount-snapshot, /data/zeek]
+data_sources:
+  - name: conn
+    log_type: conn
+    command: [cat]
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "fragment.yaml"), []byte(`threads: 2
+data_sources:
+  - name: dns
+    log_type: dns
+    command: [cat]
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "hunt.yaml"), []byte(`extends: site/base.yaml
+include: [fragment.yaml]
+time_range: 2021/06/*
+post_run:
+  - command: [ingest, "{{ .ip }}"]
+    on_failure: warn
+data_sources:
+  - name: conn
+    log_type: conn
+    command: [grep, "{{ .ip }}"]
+`), 0644)
+
+	playbook, e := lib.ParsePlaybookWithVars(filepath.Join(dir, "hunt.yaml"), map[string]string{"ip": "10.0.0.1"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := lib.Playbook{
+		TimeRange:  "2021/06/*",
+		OutputDir:  "./out",
+		ZeekLogDir: "/data/zeek/logs",
+		Threads:    2,
+		PreRun:     []lib.PlaybookHook{{Command: []string{"mount-snapshot", "/data/zeek"}}},
+		PostRun:    []lib.PlaybookHook{{Command: []string{"ingest", "10.0.0.1"}, OnFailure: lib.HookWarn}},
+		DataSources: []lib.DataSource{
+			{Name: "conn", Type: "conn", Command: []string{"grep", "10.0.0.1"}},
+			{Name: "dns", Type: "dns", Command: []string{"cat"}},
+		},
+	}
+	if !reflect.DeepEqual(playbook, expected) {
+		t.Errorf("\nexpected %+v\ngot      %+v", expected, playbook)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "fragment.yaml"), []byte("include: [hunt.yaml]\n"), 0644)
+	if _, e := lib.ParsePlaybookWithVars(filepath.Join(dir, "hunt.yaml"), map[string]string{"ip": "10.0.0.1"}); e == nil {
+		t.Error("expected an error for a playbook that includes itself")
+	}
+}